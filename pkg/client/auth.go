@@ -0,0 +1,116 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// refreshEarly refreshes an access token this long before it runs out, so it doesn't expire in flight
+const refreshEarly = 30 * time.Second
+
+// ErrNotSignedIn is returned by calls that need credentials before Login, WithTokens or WithAPIKey
+var ErrNotSignedIn = errors.New("docstream: not signed in")
+
+// Tokens are a signed in session, save them to pick it up again with WithTokens
+type Tokens struct {
+	AccessToken  string
+	RefreshToken string
+	// ExpiresAt is when the access token runs out, zero when it isn't known
+	ExpiresAt time.Time
+}
+
+// tokenResponse is what /login and /refresh answer with
+type tokenResponse struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+func (t tokenResponse) tokens() Tokens {
+	tokens := Tokens{AccessToken: t.AccessToken, RefreshToken: t.RefreshToken}
+	if t.ExpiresIn > 0 {
+		tokens.ExpiresAt = time.Now().Add(time.Duration(t.ExpiresIn) * time.Second)
+	}
+	return tokens
+}
+
+// Login signs in with an email and password, the client keeps the session fresh from then on
+func (c *Client) Login(ctx context.Context, email, password string) error {
+	var resp tokenResponse
+	err := c.call(ctx, request{
+		method: http.MethodPost,
+		path:   "/login",
+		body:   jsonBody(map[string]string{"email": email, "password": password}),
+		public: true,
+	}, &resp)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tokens = resp.tokens()
+	return nil
+}
+
+// Tokens is the current session, it changes with every refresh
+func (c *Client) Tokens() Tokens {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tokens
+}
+
+// authorize puts the credentials on a request's header, refreshing the access token first
+// when it is about to run out. It returns the access token used, "" with an API key.
+func (c *Client) authorize(ctx context.Context, header http.Header) (string, error) {
+	if c.apiKey != "" {
+		header.Set("X-API-Key", c.apiKey)
+		return "", nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.tokens.AccessToken == "" {
+		return "", ErrNotSignedIn
+	}
+	if !c.tokens.ExpiresAt.IsZero() && time.Until(c.tokens.ExpiresAt) < refreshEarly && c.tokens.RefreshToken != "" {
+		if err := c.refreshLocked(ctx); err != nil {
+			return "", err
+		}
+	}
+	header.Set("Authorization", "Bearer "+c.tokens.AccessToken)
+	return c.tokens.AccessToken, nil
+}
+
+// refresh renews the session after rejected was turned down, unless another call already has
+func (c *Client) refresh(ctx context.Context, rejected string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.tokens.AccessToken != rejected {
+		return nil
+	}
+	return c.refreshLocked(ctx)
+}
+
+// refreshLocked swaps the refresh token for a new pair, c.mu must be held
+func (c *Client) refreshLocked(ctx context.Context) error {
+	if c.tokens.RefreshToken == "" {
+		return ErrNotSignedIn
+	}
+	var resp tokenResponse
+	err := c.call(ctx, request{
+		method: http.MethodPost,
+		path:   "/refresh",
+		body:   jsonBody(map[string]string{"refresh_token": c.tokens.RefreshToken}),
+		public: true,
+		// a retry after a lost response would spend the token twice, which ends the session
+		once: true,
+	}, &resp)
+	if err != nil {
+		return err
+	}
+	c.tokens = resp.tokens()
+	return nil
+}
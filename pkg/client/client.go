@@ -0,0 +1,302 @@
+// Package client is a Go client for the DocStream API. It signs in, keeps the access token fresh
+// with the refresh token, retries what the gateway asks to be retried and streams uploads, so a
+// service can hand documents over and search them in a few lines:
+//
+//	c := client.New("https://docstream.example.com")
+//	if err := c.Login(ctx, email, password); err != nil { ... }
+//	up, err := c.Upload(ctx, "report.pdf", file, nil)
+//	job, err := c.WaitForJob(ctx, up.JobID)
+//	results, err := c.Search(ctx, client.SearchRequest{Query: "quarterly revenue"})
+//
+// Scripts can use an API key instead of signing in, see WithAPIKey.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRetries    = 3
+	defaultBackoff    = 500 * time.Millisecond
+	defaultMaxBackoff = 30 * time.Second
+)
+
+// Client talks to one gateway, it is safe for concurrent use
+type Client struct {
+	baseURL    string
+	http       *http.Client
+	apiKey     string
+	retries    int
+	backoff    time.Duration
+	maxBackoff time.Duration
+
+	// mu guards the tokens, a refresh holds it so two calls never spend the same refresh token
+	// (the gateway takes a reused one for a stolen one and revokes the whole session)
+	mu     sync.Mutex
+	tokens Tokens
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sends requests with hc instead of http.DefaultClient
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.http = hc }
+}
+
+// WithAPIKey authenticates with an X-API-Key header instead of signing in, the key's
+// scopes decide what it may call
+func WithAPIKey(key string) Option {
+	return func(c *Client) { c.apiKey = key }
+}
+
+// WithTokens starts from tokens saved by an earlier session instead of signing in again
+func WithTokens(tokens Tokens) Option {
+	return func(c *Client) { c.tokens = tokens }
+}
+
+// WithRetries sets how many times a failed request is tried again, and the first wait in between.
+// The wait doubles every attempt, a Retry-After from the gateway takes its place. 0 turns retries off.
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.backoff = backoff
+	}
+}
+
+// WithMaxBackoff caps the wait before a retry, a Retry-After longer than this (an account
+// lockout, say) is returned as the error instead of slept through
+func WithMaxBackoff(d time.Duration) Option {
+	return func(c *Client) { c.maxBackoff = d }
+}
+
+// New returns a client for the gateway at baseURL, https://docstream.example.com or http://localhost:8080
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		http:       http.DefaultClient,
+		retries:    defaultRetries,
+		backoff:    defaultBackoff,
+		maxBackoff: defaultMaxBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Error is a request the gateway turned down
+type Error struct {
+	StatusCode int
+	Message    string
+	// Code says what went wrong for programs, validation_failed or rate_limited say
+	Code string
+	// Fields are what is wrong with each field of the input, with validation_failed
+	Fields []FieldError
+	// RequestID is the gateway's ID of the request, for reporting a problem
+	RequestID string
+	// RetryAfter is how long the gateway asked to wait, with 429 and 503
+	RetryAfter time.Duration
+}
+
+// FieldError is what is wrong with one field of the input
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("docstream: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+	if e.RequestID != "" {
+		msg += " (request " + e.RequestID + ")"
+	}
+	return msg
+}
+
+// StatusCode is the HTTP status of err when the gateway answered with one, 0 otherwise
+func StatusCode(err error) int {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+// request is one call to the gateway. body is called for every attempt, so a retry sends it
+// again from the start, nil means the request can't be sent twice.
+type request struct {
+	method string
+	path   string
+	body   func() (io.Reader, string, error)
+	// public requests go out without credentials, signing in is one
+	public bool
+	// once requests aren't retried, their body can't be read twice
+	once bool
+	// accept is the content type asked for, JSON when empty
+	accept string
+}
+
+// jsonBody is a request body of v as JSON
+func jsonBody(v any) func() (io.Reader, string, error) {
+	return func() (io.Reader, string, error) {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return nil, "", err
+		}
+		return bytes.NewReader(raw), "application/json", nil
+	}
+}
+
+// call sends req and decodes the JSON answer into out, which may be nil
+func (c *Client) call(ctx context.Context, req request, out any) error {
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("docstream: decoding the response of %s %s: %w", req.method, req.path, err)
+	}
+	return nil
+}
+
+// send does req, retrying failures worth retrying and refreshing the access token once when it
+// was turned down. A 2xx response is returned with its body open, anything else as an error.
+func (c *Client) send(ctx context.Context, req request) (*http.Response, error) {
+	refreshed := false
+	for attempt := 0; ; attempt++ {
+		// failing to build or sign the request isn't worth retrying, only sending it is
+		httpReq, token, err := c.prepare(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.http.Do(httpReq)
+		if err == nil && resp.StatusCode < 300 {
+			return resp, nil
+		}
+
+		var apiErr *Error
+		if err == nil {
+			apiErr = readError(resp)
+			err = apiErr
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		// an access token can run out or be revoked between the expiry check and the request
+		if apiErr != nil && apiErr.StatusCode == http.StatusUnauthorized && token != "" && !refreshed && !req.once {
+			refreshed = true
+			if refreshErr := c.refresh(ctx, token); refreshErr != nil {
+				return nil, err
+			}
+			attempt--
+			continue
+		}
+
+		if req.once || attempt >= c.retries || !retryable(apiErr) {
+			return nil, err
+		}
+		wait := c.backoff << attempt
+		if apiErr != nil && apiErr.RetryAfter > 0 {
+			wait = apiErr.RetryAfter
+		}
+		if wait > c.maxBackoff {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// prepare builds the request for one attempt at req, token is the access token it goes out
+// with, "" for public requests and API keys
+func (c *Client) prepare(ctx context.Context, req request) (*http.Request, string, error) {
+	// credentials first, an upload's body starts streaming as soon as it is made
+	header := http.Header{}
+	var token string
+	if !req.public {
+		var err error
+		if token, err = c.authorize(ctx, header); err != nil {
+			return nil, "", err
+		}
+	}
+
+	var body io.Reader
+	if req.body != nil {
+		var contentType string
+		var err error
+		if body, contentType, err = req.body(); err != nil {
+			return nil, "", err
+		}
+		header.Set("Content-Type", contentType)
+	}
+	accept := req.accept
+	if accept == "" {
+		accept = "application/json"
+	}
+	header.Set("Accept", accept)
+
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, c.baseURL+req.path, body)
+	if err != nil {
+		if closer, ok := body.(io.Closer); ok {
+			closer.Close()
+		}
+		return nil, "", err
+	}
+	for name, values := range header {
+		httpReq.Header[name] = values
+	}
+	return httpReq, token, nil
+}
+
+// retryable says whether trying again may work: the gateway was unreachable, overloaded or
+// asked us to slow down. apiErr is nil when no response came back at all.
+func retryable(apiErr *Error) bool {
+	if apiErr == nil {
+		return true
+	}
+	switch apiErr.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// readError turns a failed response into an *Error, closing its body
+func readError(resp *http.Response) *Error {
+	defer resp.Body.Close()
+	apiErr := &Error{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode), RequestID: resp.Header.Get("X-Request-ID")}
+	var body struct {
+		Error     string       `json:"error"`
+		Code      string       `json:"code"`
+		Fields    []FieldError `json:"fields"`
+		RequestID string       `json:"request_id"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err == nil && body.Error != "" {
+		apiErr.Message, apiErr.Code, apiErr.Fields = body.Error, body.Code, body.Fields
+		if body.RequestID != "" {
+			apiErr.RequestID = body.RequestID
+		}
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		apiErr.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return apiErr
+}
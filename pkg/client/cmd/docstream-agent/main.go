@@ -0,0 +1,164 @@
+// Command docstream-agent watches directories and uploads what lands in them to a DocStream
+// gateway, for a shared drive or the folder a scanner saves to:
+//
+//	DOCSTREAM_URL=https://docstream.example.com DOCSTREAM_API_KEY=dsk_... \
+//		docstream-agent --tag scans /srv/scans /mnt/shared/invoices
+//
+// Files already there are uploaded on start, then every file that is created or changed once
+// it has been left alone for --settle. A changed file becomes a new version of the document it
+// was uploaded as. The path it came from goes along as the source_path metadata.
+//
+// What was uploaded is remembered in a state file (see --state), so a restart only uploads what
+// changed while the agent was down. The gateway's duplicate check covers a lost state file.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/pkg/client"
+)
+
+const usage = `Usage: docstream-agent [flags] <directories...>
+
+Environment:
+  DOCSTREAM_URL      the gateway, instead of --url
+  DOCSTREAM_API_KEY  an API key with the upload scope, required
+
+Flags:
+`
+
+// defaultIgnore are the names of files still being written by common tools
+var defaultIgnore = []string{"*.tmp", "*.part", "*.crdownload", "*.swp", "~$*"}
+
+func main() {
+	flags := flag.NewFlagSet("docstream-agent", flag.ExitOnError)
+	url := flags.String("url", os.Getenv("DOCSTREAM_URL"), "the gateway, http://localhost:8080 say")
+	statePath := flags.String("state", "", "where to remember what was uploaded, docstream/agent-state.json in the user's config directory by default")
+	org := flags.String("org", "", "share the documents with this organization")
+	collection := flags.String("collection", "", "file the documents in this collection")
+	var tags, ignore multiFlag
+	flags.Var(&tags, "tag", "tag the documents, repeatable")
+	flags.Var(&ignore, "ignore", "leave out files whose name matches this pattern, repeatable (default "+strings.Join(defaultIgnore, ", ")+")")
+	settle := flags.Duration("settle", 2*time.Second, "how long a file has to stay unchanged before it is uploaded")
+	parallel := flags.Int("parallel", 2, "uploads at a time")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flags.PrintDefaults()
+	}
+	flags.Parse(os.Args[1:])
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if len(ignore) == 0 {
+		ignore = defaultIgnore
+	}
+
+	err := run(agentConfig{
+		url:       *url,
+		apiKey:    os.Getenv("DOCSTREAM_API_KEY"),
+		statePath: *statePath,
+		dirs:      flags.Args(),
+		opts:      client.UploadOptions{OrgID: *org, CollectionID: *collection, Tags: tags},
+		ignore:    ignore,
+		settle:    *settle,
+		parallel:  *parallel,
+	})
+	if err != nil && !errors.Is(err, context.Canceled) {
+		fmt.Fprintln(os.Stderr, "docstream-agent:", err)
+		os.Exit(1)
+	}
+}
+
+// agentConfig is what the flags and the environment set
+type agentConfig struct {
+	url       string
+	apiKey    string
+	statePath string
+	dirs      []string
+	opts      client.UploadOptions
+	ignore    []string
+	settle    time.Duration
+	parallel  int
+}
+
+func run(cfg agentConfig) error {
+	if cfg.url == "" {
+		return errors.New("no gateway URL, set --url or DOCSTREAM_URL")
+	}
+	// the agent runs unattended, a session would sign it out when its refresh token ran out
+	if cfg.apiKey == "" {
+		return errors.New("no API key, set DOCSTREAM_API_KEY to a key with the upload scope")
+	}
+	if cfg.parallel < 1 {
+		return errors.New("--parallel must be at least 1")
+	}
+	for _, pattern := range cfg.ignore {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("--ignore %q: %w", pattern, err)
+		}
+	}
+	dirs := make([]string, len(cfg.dirs))
+	for i, dir := range cfg.dirs {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		info, err := os.Stat(abs)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", dir)
+		}
+		dirs[i] = abs
+	}
+
+	path, err := stateFile(cfg.statePath)
+	if err == nil {
+		// absolute like the watched paths, so the state file is never taken for a document
+		path, err = filepath.Abs(path)
+	}
+	if err != nil {
+		return err
+	}
+	state, err := loadState(path)
+	if err != nil {
+		return err
+	}
+	host, _ := os.Hostname()
+
+	a := &agent{
+		client: client.New(cfg.url, client.WithAPIKey(cfg.apiKey)),
+		state:  state,
+		opts:   cfg.opts,
+		host:   host,
+		ignore: cfg.ignore,
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	log.Printf("Watching %s, state in %s\n", strings.Join(dirs, ", "), path)
+	return a.watch(ctx, dirs, cfg.settle, cfg.parallel)
+}
+
+// multiFlag is a flag that may be repeated
+type multiFlag []string
+
+func (m *multiFlag) String() string {
+	return strings.Join(*m, ",")
+}
+
+func (m *multiFlag) Set(value string) error {
+	*m = append(*m, value)
+	return nil
+}
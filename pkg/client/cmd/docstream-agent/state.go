@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// uploadedFile is what the agent remembers of a file it uploaded
+type uploadedFile struct {
+	DocumentID string `json:"document_id,omitempty"`
+	// SHA256 is the hex digest of the content last uploaded, or refused, for the file
+	SHA256  string    `json:"sha256"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	// Refused is why the gateway turned the content down, it isn't tried again until it changes
+	Refused string `json:"refused,omitempty"`
+}
+
+// state is the uploaded files by path, saved after every change. It goes to a temporary file
+// first so a crash never leaves half of it behind.
+type state struct {
+	path string
+
+	mu    sync.Mutex
+	Files map[string]uploadedFile `json:"files"`
+}
+
+// stateFile is --state or docstream/agent-state.json in the user's config directory
+func stateFile(flagValue string) (string, error) {
+	if flagValue != "" {
+		return flagValue, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "docstream", "agent-state.json"), nil
+}
+
+// loadState reads the state file, a missing one is an empty state
+func loadState(path string) (*state, error) {
+	s := &state{path: path, Files: map[string]uploadedFile{}}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, s); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	if s.Files == nil {
+		s.Files = map[string]uploadedFile{}
+	}
+	return s, nil
+}
+
+func (s *state) get(path string) (uploadedFile, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.Files[path]
+	return f, ok
+}
+
+// set records f for path and saves the state
+func (s *state) set(path string, f uploadedFile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Files[path] = f
+	return s.save()
+}
+
+func (s *state) save() error {
+	raw, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".agent-state-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(raw, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dhruvkshah75/docstream/pkg/client"
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// retryDelay is how long a file waits after an upload failed on the gateway's side
+	retryDelay = time.Minute
+	// maxSourcePath is the longest metadata value the gateway takes
+	maxSourcePath = 1024
+)
+
+// agent uploads the files of the watched directories
+type agent struct {
+	client *client.Client
+	state  *state
+	opts   client.UploadOptions
+	host   string
+	ignore []string
+}
+
+// synced is a file an upload worker is done with
+type synced struct {
+	path  string
+	retry bool
+}
+
+// watch uploads every file under dirs, then every file created or changed in them, until ctx
+// is cancelled. A file is uploaded once it has settled without an event for settle, files
+// written a bit at a time (a scan, a copy over the network) go up whole.
+func (a *agent) watch(ctx context.Context, dirs []string, settle time.Duration, parallel int) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	// pending are the files to upload by when, queued and inflight those handed to the workers
+	pending := map[string]time.Time{}
+	var queue []string
+	inflight := map[string]bool{}
+	for _, dir := range dirs {
+		if err := a.addTree(w, dir, pending, time.Now()); err != nil {
+			return err
+		}
+	}
+
+	work := make(chan string)
+	// room for every worker's last file, none of them blocks on a loop that already returned
+	done := make(chan synced, parallel)
+	for range parallel {
+		go func() {
+			for path := range work {
+				done <- synced{path: path, retry: a.sync(ctx, path)}
+			}
+		}()
+	}
+	defer close(work)
+
+	tick := time.NewTicker(min(settle, time.Second))
+	defer tick.Stop()
+	for {
+		var next chan string
+		if len(queue) > 0 {
+			next = work
+		}
+		var head string
+		if next != nil {
+			head = queue[0]
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case next <- head:
+			queue = queue[1:]
+
+		case s := <-done:
+			delete(inflight, s.path)
+			if s.retry {
+				pending[s.path] = time.Now().Add(retryDelay)
+			}
+
+		case ev, ok := <-w.Events:
+			if !ok {
+				return errors.New("watcher closed")
+			}
+			if a.skip(ev.Name) {
+				continue
+			}
+			switch {
+			case ev.Has(fsnotify.Create):
+				// a new directory has to be watched too, what was moved in with it is uploaded
+				if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+					if err := a.addTree(w, ev.Name, pending, time.Now().Add(settle)); err != nil {
+						log.Printf("Watching %s: %v\n", ev.Name, err)
+					}
+					continue
+				}
+				pending[ev.Name] = time.Now().Add(settle)
+			case ev.Has(fsnotify.Write):
+				pending[ev.Name] = time.Now().Add(settle)
+			case ev.Has(fsnotify.Remove), ev.Has(fsnotify.Rename):
+				// the document stays, the file may come back under another name and dedup finds it
+				delete(pending, ev.Name)
+			}
+
+		case err, ok := <-w.Errors:
+			if !ok {
+				return errors.New("watcher closed")
+			}
+			log.Println("Watch error:", err)
+
+		case now := <-tick.C:
+			for _, path := range sortedKeys(pending) {
+				if inflight[path] || pending[path].After(now) {
+					continue
+				}
+				delete(pending, path)
+				inflight[path] = true
+				queue = append(queue, path)
+			}
+		}
+	}
+}
+
+// addTree watches dir and the directories under it, and has their files uploaded at due
+func (a *agent) addTree(w *fsnotify.Watcher, dir string, pending map[string]time.Time, due time.Time) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && a.skip(path) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return w.Add(path)
+		}
+		if d.Type().IsRegular() {
+			pending[path] = due
+		}
+		return nil
+	})
+}
+
+// skip leaves out hidden files and directories, the ignored names and the state file
+func (a *agent) skip(path string) bool {
+	name := filepath.Base(path)
+	if strings.HasPrefix(name, ".") || path == a.state.path {
+		return true
+	}
+	for _, pattern := range a.ignore {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// sync uploads the file at path unless its content was uploaded already, as a new version when
+// an earlier content was. It reports whether to try again later.
+func (a *agent) sync(ctx context.Context, path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		// gone again before it settled
+		return false
+	}
+	prev, known := a.state.get(path)
+	if known && prev.Size == info.Size() && prev.ModTime.Equal(info.ModTime()) {
+		return false
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		log.Printf("%s: %v\n", path, err)
+		return false
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		log.Printf("%s: %v\n", path, err)
+		return true
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	record := uploadedFile{DocumentID: prev.DocumentID, SHA256: sum, Size: info.Size(), ModTime: info.ModTime()}
+	if known && prev.SHA256 == sum {
+		// touched, not changed
+		record.Refused = prev.Refused
+		a.save(path, record)
+		return false
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		log.Printf("%s: %v\n", path, err)
+		return true
+	}
+
+	var up *client.Uploaded
+	if prev.DocumentID != "" {
+		up, err = a.client.UploadVersion(ctx, prev.DocumentID, filepath.Base(path), f)
+		if client.StatusCode(err) == http.StatusNotFound {
+			// the document was deleted since, the file starts over as a new one
+			if _, err = f.Seek(0, io.SeekStart); err == nil {
+				up, err = a.upload(ctx, path, f)
+			}
+		}
+	} else {
+		up, err = a.upload(ctx, path, f)
+	}
+	if ctx.Err() != nil {
+		return false
+	}
+	if refused(err) {
+		log.Printf("%s: refused, it is tried again when it changes: %v\n", path, err)
+		record.Refused = err.Error()
+		a.save(path, record)
+		return false
+	} else if err != nil {
+		log.Printf("%s: %v, trying again in %s\n", path, err, retryDelay)
+		return true
+	}
+
+	record.DocumentID = up.DocumentID
+	a.save(path, record)
+	result := "uploaded"
+	if up.Duplicate {
+		result = "duplicate"
+	} else if up.Version > 1 {
+		result = "new version"
+	}
+	log.Println(strings.Join([]string{path, up.JobID, up.DocumentID, result}, "\t"))
+	return false
+}
+
+// upload sends the file as a new document, its path and host as metadata
+func (a *agent) upload(ctx context.Context, path string, f *os.File) (*client.Uploaded, error) {
+	opts := a.opts
+	opts.Metadata = map[string]string{"source": "agent", "source_path": truncate(path, maxSourcePath)}
+	if a.host != "" {
+		opts.Metadata["source_host"] = a.host
+	}
+	return a.client.Upload(ctx, filepath.Base(path), f, &opts)
+}
+
+func (a *agent) save(path string, record uploadedFile) {
+	if err := a.state.set(path, record); err != nil {
+		log.Println("Saving the state:", err)
+	}
+}
+
+// refused says whether the gateway turned the content itself down, a type it doesn't take or a
+// file too large, which trying again won't change. Anything else, credentials or a plan that is
+// full included, may be fixed in the meantime.
+func refused(err error) bool {
+	switch client.StatusCode(err) {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity:
+		return true
+	}
+	return false
+}
+
+// sortedKeys uploads what was found first in a stable order, a directory's files by name
+func sortedKeys(m map[string]time.Time) []string {
+	return slices.Sorted(maps.Keys(m))
+}
+
+// truncate cuts s to at most n bytes without splitting a UTF-8 sequence
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	s = s[:n]
+	for len(s) > 0 && !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+	return s
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/pkg/client"
+)
+
+// config is what the CLI keeps between runs, the session login started included. It is
+// rewritten after every command since each token refresh hands out a new refresh token.
+type config struct {
+	URL          string    `json:"url"`
+	APIKey       string    `json:"api_key,omitempty"`
+	AccessToken  string    `json:"access_token,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at,omitzero"`
+
+	path string
+}
+
+// configPath is --config, DOCSTREAM_CONFIG or docstream/config.json in the user's config directory
+func configPath(flagValue string) (string, error) {
+	if flagValue != "" {
+		return flagValue, nil
+	}
+	if env := os.Getenv("DOCSTREAM_CONFIG"); env != "" {
+		return env, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "docstream", "config.json"), nil
+}
+
+// loadConfig reads the config file, a missing one is an empty config
+func loadConfig(path string) (*config, error) {
+	cfg := &config{path: path}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, cfg); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// gatewayURL and apiKey prefer DOCSTREAM_URL and DOCSTREAM_API_KEY to the file, for CI where
+// there is no file. What comes from the environment is never written to it.
+func (cfg *config) gatewayURL() string {
+	if url := os.Getenv("DOCSTREAM_URL"); url != "" {
+		return url
+	}
+	return cfg.URL
+}
+
+func (cfg *config) apiKey() string {
+	if key := os.Getenv("DOCSTREAM_API_KEY"); key != "" {
+		return key
+	}
+	return cfg.APIKey
+}
+
+// save writes the config, readable by the user alone since it holds credentials. It goes to
+// a temporary file first so a failed write never leaves half a session behind.
+func (cfg *config) save() error {
+	raw, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(cfg.path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(cfg.path), ".config-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(raw, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), cfg.path)
+}
+
+// client is a client for the configured gateway, signed in with the API key or the saved session
+func (cfg *config) client() (*client.Client, error) {
+	url := cfg.gatewayURL()
+	if url == "" {
+		return nil, errors.New("no gateway URL, run docstream-cli login or set DOCSTREAM_URL")
+	}
+	if key := cfg.apiKey(); key != "" {
+		return client.New(url, client.WithAPIKey(key)), nil
+	}
+	if cfg.AccessToken == "" {
+		return nil, errors.New("not signed in, run docstream-cli login or set DOCSTREAM_API_KEY")
+	}
+	return client.New(url, client.WithTokens(client.Tokens{
+		AccessToken:  cfg.AccessToken,
+		RefreshToken: cfg.RefreshToken,
+		ExpiresAt:    cfg.ExpiresAt,
+	})), nil
+}
+
+// keep saves the client's session when a refresh changed it
+func (cfg *config) keep(c *client.Client) error {
+	if cfg.apiKey() != "" {
+		return nil
+	}
+	tokens := c.Tokens()
+	if tokens.RefreshToken == cfg.RefreshToken && tokens.AccessToken == cfg.AccessToken {
+		return nil
+	}
+	cfg.AccessToken, cfg.RefreshToken, cfg.ExpiresAt = tokens.AccessToken, tokens.RefreshToken, tokens.ExpiresAt
+	return cfg.save()
+}
@@ -0,0 +1,231 @@
+// Command docstream-cli uploads documents to a DocStream gateway and searches them, from a
+// laptop or a CI job:
+//
+//	docstream-cli login --url https://docstream.example.com --email me@example.com
+//	docstream-cli upload --wait --tag reports ./reports/
+//	docstream-cli status job_123
+//	docstream-cli search "quarterly revenue"
+//
+// login keeps the session in docstream/config.json under the user's config directory (see
+// --config). CI can set DOCSTREAM_URL and DOCSTREAM_API_KEY instead and skip login altogether.
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dhruvkshah75/docstream/pkg/client"
+)
+
+const usage = `Usage: docstream-cli [--config FILE] <command> [flags] [args]
+
+Commands:
+  login              sign in and save the session
+  upload <paths...>  upload files, directories are walked
+  status <jobs...>   show jobs' status
+  search <query>     search the documents
+
+Environment:
+  DOCSTREAM_URL       the gateway, instead of the config file's
+  DOCSTREAM_API_KEY   an API key to use instead of a session
+  DOCSTREAM_PASSWORD  the password for login, it is read from stdin otherwise
+  DOCSTREAM_CONFIG    the config file, instead of the default
+
+Run docstream-cli <command> --help for a command's flags.
+`
+
+// errFailed is a command that printed its failures already
+var errFailed = errors.New("failed")
+
+func main() {
+	global := flag.NewFlagSet("docstream-cli", flag.ExitOnError)
+	configFlag := global.String("config", "", "config file")
+	global.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	global.Parse(os.Args[1:])
+	if global.NArg() == 0 {
+		global.Usage()
+		os.Exit(2)
+	}
+
+	commands := map[string]func(ctx context.Context, cfg *config, args []string) error{
+		"login":  login,
+		"upload": upload,
+		"status": status,
+		"search": search,
+	}
+	name, args := global.Arg(0), global.Args()[1:]
+	command, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "docstream-cli: unknown command %q\n\n", name)
+		global.Usage()
+		os.Exit(2)
+	}
+
+	path, err := configPath(*configFlag)
+	if err == nil {
+		var cfg *config
+		if cfg, err = loadConfig(path); err == nil {
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			err = command(ctx, cfg, args)
+			stop()
+		}
+	}
+	if errors.Is(err, errFailed) {
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "docstream-cli:", err)
+		os.Exit(1)
+	}
+}
+
+// --- login ---
+func login(ctx context.Context, cfg *config, args []string) error {
+	flags := flag.NewFlagSet("login", flag.ExitOnError)
+	url := flags.String("url", cfg.gatewayURL(), "the gateway, http://localhost:8080 say")
+	email := flags.String("email", "", "the account's email")
+	flags.Parse(args)
+	if *url == "" || *email == "" {
+		return errors.New("login needs --url and --email")
+	}
+
+	password := os.Getenv("DOCSTREAM_PASSWORD")
+	if password == "" {
+		fmt.Fprint(os.Stderr, "Password: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("reading the password: %w", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+
+	c := client.New(*url)
+	if err := c.Login(ctx, *email, password); err != nil {
+		return err
+	}
+	tokens := c.Tokens()
+	cfg.URL = *url
+	cfg.AccessToken, cfg.RefreshToken, cfg.ExpiresAt = tokens.AccessToken, tokens.RefreshToken, tokens.ExpiresAt
+	if err := cfg.save(); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "Signed in, the session is saved in", cfg.path)
+	return nil
+}
+
+// --- status ---
+func status(ctx context.Context, cfg *config, args []string) error {
+	flags := flag.NewFlagSet("status", flag.ExitOnError)
+	wait := flags.Bool("wait", false, "wait for the jobs to finish")
+	asJSON := flags.Bool("json", false, "print the jobs as JSON lines")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		return errors.New("status needs at least one job ID")
+	}
+
+	c, err := cfg.client()
+	if err != nil {
+		return err
+	}
+	defer keepSession(cfg, c)
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer out.Flush()
+	failed := false
+	for _, id := range flags.Args() {
+		var job *client.Job
+		if *wait {
+			job, err = c.WaitForJob(ctx, id)
+		} else {
+			job, err = c.GetJob(ctx, id)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", id, err)
+			failed = true
+			continue
+		}
+		if job.Status == client.JobFailed || job.Status == client.JobCancelled {
+			failed = true
+		}
+		if *asJSON {
+			json.NewEncoder(os.Stdout).Encode(job)
+			continue
+		}
+		fmt.Fprintf(out, "%s\t%s\t%s\t%s\n", job.ID, job.Status, job.Filename, job.Error)
+	}
+	if failed {
+		return errFailed
+	}
+	return nil
+}
+
+// --- search ---
+func search(ctx context.Context, cfg *config, args []string) error {
+	flags := flag.NewFlagSet("search", flag.ExitOnError)
+	limit := flags.Int("limit", 0, "the number of results, the gateway's default when 0")
+	org := flags.String("org", "", "search an organization's documents")
+	var tags, languages multiFlag
+	flags.Var(&tags, "tag", "only documents with this tag, repeatable")
+	flags.Var(&languages, "language", "only documents in this language (ISO 639-1), repeatable")
+	asJSON := flags.Bool("json", false, "print the results as JSON lines")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		return errors.New("search needs a query")
+	}
+
+	c, err := cfg.client()
+	if err != nil {
+		return err
+	}
+	defer keepSession(cfg, c)
+
+	results, err := c.Search(ctx, client.SearchRequest{
+		Query:     strings.Join(flags.Args(), " "),
+		Limit:     *limit,
+		OrgID:     *org,
+		Tags:      tags,
+		Languages: languages,
+	})
+	if err != nil {
+		return err
+	}
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer out.Flush()
+	for _, r := range results {
+		if *asJSON {
+			json.NewEncoder(os.Stdout).Encode(r)
+			continue
+		}
+		snippet := strings.Join(strings.Fields(r.Snippet), " ")
+		fmt.Fprintf(out, "%.3f\t%s\t%s\t%s\n", r.Score, r.DocumentID, r.Filename, snippet)
+	}
+	return nil
+}
+
+// keepSession saves a refreshed session, a lost refresh token would sign the user out
+func keepSession(cfg *config, c *client.Client) {
+	if err := cfg.keep(c); err != nil {
+		fmt.Fprintln(os.Stderr, "docstream-cli: saving the session:", err)
+	}
+}
+
+// multiFlag is a flag that may be repeated
+type multiFlag []string
+
+func (m *multiFlag) String() string {
+	return strings.Join(*m, ",")
+}
+
+func (m *multiFlag) Set(value string) error {
+	*m = append(*m, value)
+	return nil
+}
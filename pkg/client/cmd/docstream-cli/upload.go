@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/dhruvkshah75/docstream/pkg/client"
+)
+
+// --- upload ---
+// Uploads every file named and every file under the directories named, skipping hidden ones,
+// a few at a time. Prints a line per file as it finishes, path, job and document, and exits 1
+// if any of them failed, so a CI step fails with it.
+func upload(ctx context.Context, cfg *config, args []string) error {
+	flags := flag.NewFlagSet("upload", flag.ExitOnError)
+	org := flags.String("org", "", "share the documents with this organization")
+	collection := flags.String("collection", "", "file the documents in this collection")
+	var tags multiFlag
+	flags.Var(&tags, "tag", "tag the documents, repeatable")
+	parallel := flags.Int("parallel", 4, "uploads at a time")
+	wait := flags.Bool("wait", false, "wait for processing to finish, a failed job fails the upload")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		return errors.New("upload needs at least one file or directory")
+	}
+	if *parallel < 1 {
+		return errors.New("--parallel must be at least 1")
+	}
+
+	files, err := collectFiles(flags.Args())
+	if err != nil {
+		return err
+	}
+	c, err := cfg.client()
+	if err != nil {
+		return err
+	}
+	defer keepSession(cfg, c)
+
+	opts := &client.UploadOptions{OrgID: *org, CollectionID: *collection, Tags: tags}
+	paths := make(chan string)
+	var mu sync.Mutex
+	failed := 0
+	var wg sync.WaitGroup
+	for range *parallel {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				line, err := uploadFile(ctx, c, path, opts, *wait)
+				mu.Lock()
+				if err != nil {
+					failed++
+					fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+				} else {
+					fmt.Println(line)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, path := range files {
+		select {
+		case paths <- path:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(paths)
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d of %d uploads failed\n", failed, len(files))
+		return errFailed
+	}
+	return nil
+}
+
+// uploadFile uploads one file, the line it returns is "path<TAB>job<TAB>document<TAB>status"
+func uploadFile(ctx context.Context, c *client.Client, path string, opts *client.UploadOptions, wait bool) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	up, err := c.Upload(ctx, filepath.Base(path), f, opts)
+	if err != nil {
+		return "", err
+	}
+	state := "uploaded"
+	if up.Duplicate {
+		state = "duplicate"
+	}
+	if wait && up.JobID != "" {
+		job, err := c.WaitForJob(ctx, up.JobID)
+		if err != nil {
+			return "", err
+		}
+		if job.Status != client.JobCompleted {
+			return "", fmt.Errorf("job %s %s: %s", job.ID, job.Status, job.Error)
+		}
+		state = job.Status
+	}
+	return strings.Join([]string{path, up.JobID, up.DocumentID, state}, "\t"), nil
+}
+
+// collectFiles expands directories into the regular files under them, leaving out hidden files
+// and directories (.git and the like). A file named outright is always included.
+func collectFiles(args []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		err = filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if path != arg && strings.HasPrefix(d.Name(), ".") {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.Type().IsRegular() {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(files) == 0 {
+		return nil, errors.New("no files to upload")
+	}
+	return files, nil
+}
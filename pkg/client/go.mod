@@ -0,0 +1,7 @@
+module github.com/dhruvkshah75/docstream/pkg/client
+
+go 1.25.1
+
+require github.com/fsnotify/fsnotify v1.10.1
+
+require golang.org/x/sys v0.13.0 // indirect
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Job statuses, a job goes pending -> queued -> processing and ends completed, failed or cancelled
+const (
+	JobPending    = "pending"
+	JobQueued     = "queued"
+	JobProcessing = "processing"
+	JobCompleted  = "completed"
+	JobFailed     = "failed"
+	JobCancelled  = "cancelled"
+)
+
+// pollInterval is how often WaitForJob looks at a job
+const pollInterval = 2 * time.Second
+
+// Job is the processing of an uploaded document
+type Job struct {
+	ID         string `json:"job_id"`
+	DocumentID string `json:"document_id"`
+	Filename   string `json:"filename"`
+	Status     string `json:"status"`
+	// SHA256 is the hex digest of the content the job processes, empty for old documents
+	SHA256 string `json:"sha256"`
+	// Error is why it failed
+	Error     string    `json:"error"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Done says whether the job has finished, one way or another
+func (j *Job) Done() bool {
+	return j.Status == JobCompleted || j.Status == JobFailed || j.Status == JobCancelled
+}
+
+// GetJob looks up a job
+func (c *Client) GetJob(ctx context.Context, jobID string) (*Job, error) {
+	var job Job
+	if err := c.call(ctx, request{method: http.MethodGet, path: "/jobs/" + url.PathEscape(jobID)}, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// WaitForJob polls a job until it is done, a failed job is returned like a completed one so check its Status
+func (c *Client) WaitForJob(ctx context.Context, jobID string) (*Job, error) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		job, err := c.GetJob(ctx, jobID)
+		if err != nil {
+			return nil, err
+		}
+		if job.Done() {
+			return job, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
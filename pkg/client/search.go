@@ -0,0 +1,162 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// SearchRequest is a semantic search, only Query is required
+type SearchRequest struct {
+	Query string `json:"query"`
+	// Limit is the number of results, the gateway's default when 0
+	Limit int `json:"limit,omitempty"`
+	// OrgID searches an organization's documents instead of the caller's own
+	OrgID       string   `json:"org_id,omitempty"`
+	DocumentIDs []string `json:"document_ids,omitempty"`
+	// Tags only searches documents that carry all of them
+	Tags []string `json:"tags,omitempty"`
+	// Languages only searches documents in one of them, by ISO 639-1 code
+	Languages []string `json:"languages,omitempty"`
+}
+
+// SearchResult is one matching chunk of a document
+type SearchResult struct {
+	DocumentID string  `json:"document_id"`
+	Filename   string  `json:"filename"`
+	OrgID      string  `json:"org_id"`
+	ChunkIndex int     `json:"chunk_index"`
+	Page       int     `json:"page"`
+	Heading    string  `json:"heading"`
+	Language   string  `json:"language"`
+	Score      float32 `json:"score"`
+	Snippet    string  `json:"snippet"`
+}
+
+// Search finds the chunks closest to the query, best first
+func (c *Client) Search(ctx context.Context, req SearchRequest) ([]SearchResult, error) {
+	var resp struct {
+		Results []SearchResult `json:"results"`
+	}
+	if err := c.call(ctx, request{method: http.MethodPost, path: "/search", body: jsonBody(req)}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Results, nil
+}
+
+// AskRequest is a question about the documents, only Question is required
+type AskRequest struct {
+	Question string `json:"question"`
+	// TopK is how many chunks the answer is built from, the gateway's default when 0
+	TopK        int      `json:"top_k,omitempty"`
+	OrgID       string   `json:"org_id,omitempty"`
+	DocumentIDs []string `json:"document_ids,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Languages   []string `json:"languages,omitempty"`
+}
+
+// Answer is what the model answered, citing Sources by their N as [1], [2], ...
+type Answer struct {
+	Text    string   `json:"answer"`
+	Model   string   `json:"model"`
+	Sources []Source `json:"sources"`
+}
+
+// Source is a chunk an answer was built from
+type Source struct {
+	N          int     `json:"n"`
+	DocumentID string  `json:"document_id"`
+	Filename   string  `json:"filename"`
+	Page       int     `json:"page"`
+	ChunkIndex int     `json:"chunk_index"`
+	Score      float32 `json:"score"`
+	// Cited says whether the answer refers to it
+	Cited bool `json:"cited"`
+}
+
+// Ask answers a question from the documents
+func (c *Client) Ask(ctx context.Context, req AskRequest) (*Answer, error) {
+	return c.AskStream(ctx, req, nil)
+}
+
+// AskStream is Ask handing every piece of the answer to onToken as the model writes it
+func (c *Client) AskStream(ctx context.Context, req AskRequest, onToken func(text string)) (*Answer, error) {
+	resp, err := c.send(ctx, request{method: http.MethodPost, path: "/ask", body: jsonBody(req), accept: "text/event-stream"})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var answer *Answer
+	err = readEvents(resp.Body, func(event string, data []byte) error {
+		switch event {
+		case "token":
+			var token struct {
+				Text string `json:"text"`
+			}
+			if err := json.Unmarshal(data, &token); err != nil {
+				return err
+			}
+			if onToken != nil {
+				onToken(token.Text)
+			}
+		case "done":
+			answer = &Answer{}
+			return json.Unmarshal(data, answer)
+		case "error":
+			var failed struct {
+				Error string `json:"error"`
+			}
+			json.Unmarshal(data, &failed)
+			return fmt.Errorf("docstream: answering failed: %s", failed.Error)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if answer == nil {
+		return nil, fmt.Errorf("docstream: the answer stream ended early: %w", io.ErrUnexpectedEOF)
+	}
+	return answer, nil
+}
+
+// readEvents reads server-sent events, calling handle with each one's name and data
+func readEvents(r io.Reader, handle func(event string, data []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	var event string
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if len(data) > 0 {
+				if err := handle(event, []byte(strings.Join(data, "\n"))); err != nil {
+					return err
+				}
+			}
+			event, data = "", nil
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	// the last event may not have its blank line when the stream is cut short
+	if len(data) > 0 {
+		return handle(event, []byte(strings.Join(data, "\n")))
+	}
+	return nil
+}
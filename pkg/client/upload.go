@@ -0,0 +1,121 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// UploadOptions are the optional fields of an upload
+type UploadOptions struct {
+	// OrgID shares the document with an organization's members
+	OrgID string
+	// CollectionID files it in a collection, whose processing defaults apply
+	CollectionID string
+	Tags         []string
+	Metadata     map[string]string
+}
+
+// Uploaded is where an upload went
+type Uploaded struct {
+	JobID      string `json:"job_id"`
+	DocumentID string `json:"document_id"`
+	FileID     string `json:"file_id"`
+	// Duplicate means the content was uploaded before, DocumentID is the document that has it.
+	// For a version it is content the same as the current version's.
+	Duplicate bool `json:"duplicate"`
+	// Version is the document's version number, set by UploadVersion
+	Version int `json:"version,omitempty"`
+}
+
+// Upload streams content to POST /upload as filename, it is never held in memory whole.
+// Content that is an io.Seeker (an *os.File, a *bytes.Reader) is rewound and sent again when
+// the upload needs retrying, any other reader is sent once.
+func (c *Client) Upload(ctx context.Context, filename string, content io.Reader, opts *UploadOptions) (*Uploaded, error) {
+	if opts == nil {
+		opts = &UploadOptions{}
+	}
+	var metadata []byte
+	if len(opts.Metadata) > 0 {
+		var err error
+		if metadata, err = json.Marshal(opts.Metadata); err != nil {
+			return nil, err
+		}
+	}
+	return c.upload(ctx, "/upload", filename, content, opts, metadata)
+}
+
+// UploadVersion streams content to POST /documents/{id}/versions as the document's new current
+// version, retried like Upload. Content the same as the current version's makes no new version,
+// Duplicate says so.
+func (c *Client) UploadVersion(ctx context.Context, documentID, filename string, content io.Reader) (*Uploaded, error) {
+	return c.upload(ctx, "/documents/"+url.PathEscape(documentID)+"/versions", filename, content, &UploadOptions{}, nil)
+}
+
+// upload sends content as the multipart "file" to path, with the optional fields of opts
+func (c *Client) upload(ctx context.Context, path, filename string, content io.Reader, opts *UploadOptions, metadata []byte) (*Uploaded, error) {
+	seeker, replayable := content.(io.Seeker)
+	var start int64
+	if replayable {
+		var err error
+		if start, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+			replayable = false
+		}
+	}
+
+	// the previous attempt's pipe, and its writer's end, a retry waits for it to stop reading content
+	var last *io.PipeReader
+	var written chan struct{}
+	body := func() (io.Reader, string, error) {
+		if last != nil {
+			last.Close()
+			<-written
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return nil, "", fmt.Errorf("docstream: rewinding the upload: %w", err)
+			}
+		}
+
+		pr, pw := io.Pipe()
+		form := multipart.NewWriter(pw)
+		last, written = pr, make(chan struct{})
+		go func(done chan struct{}) {
+			defer close(done)
+			pw.CloseWithError(writeUploadForm(form, filename, content, opts, metadata))
+		}(written)
+		return pr, form.FormDataContentType(), nil
+	}
+
+	var uploaded Uploaded
+	err := c.call(ctx, request{method: http.MethodPost, path: path, body: body, once: !replayable}, &uploaded)
+	if err != nil {
+		return nil, err
+	}
+	return &uploaded, nil
+}
+
+// writeUploadForm writes the optional fields, then the file
+func writeUploadForm(form *multipart.Writer, filename string, content io.Reader, opts *UploadOptions, metadata []byte) error {
+	fields := [][2]string{{"org_id", opts.OrgID}, {"collection_id", opts.CollectionID}, {"tags", strings.Join(opts.Tags, ",")}, {"metadata", string(metadata)}}
+	for _, field := range fields {
+		if field[1] == "" {
+			continue
+		}
+		if err := form.WriteField(field[0], field[1]); err != nil {
+			return err
+		}
+	}
+
+	part, err := form.CreateFormFile("file", filename)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, content); err != nil {
+		return err
+	}
+	return form.Close()
+}
@@ -1,17 +1,48 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
-	"time"
 
+	"github.com/dhruvkshah75/docstream/gateway/internal/alerts"
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/backpressure"
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+	"github.com/dhruvkshah75/docstream/gateway/internal/consumer"
+	"github.com/dhruvkshah75/docstream/gateway/internal/digest"
+	"github.com/dhruvkshah75/docstream/gateway/internal/embeddings"
+	"github.com/dhruvkshah75/docstream/gateway/internal/envelope"
+	"github.com/dhruvkshah75/docstream/gateway/internal/events"
+	"github.com/dhruvkshah75/docstream/gateway/internal/exporter"
+	"github.com/dhruvkshah75/docstream/gateway/internal/grpcapi"
 	"github.com/dhruvkshah75/docstream/gateway/internal/handlers"
-	"github.com/dhruvkshah75/docstream/gateway/internal/producer"
+	"github.com/dhruvkshah75/docstream/gateway/internal/keyword"
+	"github.com/dhruvkshah75/docstream/gateway/internal/llm"
+	"github.com/dhruvkshah75/docstream/gateway/internal/mailin"
+	"github.com/dhruvkshah75/docstream/gateway/internal/mailout"
+	"github.com/dhruvkshah75/docstream/gateway/internal/metrics"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/notifier"
+	"github.com/dhruvkshah75/docstream/gateway/internal/objectstore"
+	"github.com/dhruvkshah75/docstream/gateway/internal/openapi"
+	"github.com/dhruvkshah75/docstream/gateway/internal/passwords"
+	"github.com/dhruvkshah75/docstream/gateway/internal/purger"
+	"github.com/dhruvkshah75/docstream/gateway/internal/queue"
+	"github.com/dhruvkshah75/docstream/gateway/internal/ratelimit"
+	"github.com/dhruvkshah75/docstream/gateway/internal/rerank"
+	"github.com/dhruvkshah75/docstream/gateway/internal/scanner"
+	"github.com/dhruvkshah75/docstream/gateway/internal/scheduler"
+	"github.com/dhruvkshah75/docstream/gateway/internal/server"
 	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/dhruvkshah75/docstream/gateway/internal/stripe"
+	"github.com/dhruvkshah75/docstream/gateway/internal/tracing"
+	"github.com/dhruvkshah75/docstream/gateway/internal/vectorstore"
 
-	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 func main() {
@@ -20,54 +51,557 @@ func main() {
 		log.Println("No .env file found, using system vars")
 	}
 
+	// `gateway migrate ...` only touches the database and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+
+	// Everything configurable comes from here, a bad value stops the gateway before it serves anything
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalln("Config:", err)
+	}
+
+	// Refuse to start without a proper signing key, there is no safe default
+	if err := middleware.LoadKeys(cfg.JWT); err != nil {
+		log.Fatalln("JWT keys:", err)
+	}
+
+	// Tracing first so everything below can create spans
+	shutdownTracing := tracing.Init("docstream-gateway")
+	defer shutdownTracing(context.Background())
+
 	// 2. Initialize Infrastructure
-	minioClient := storage.InitMinio()
-	rabbitConn, rabbitChan, rabbitQueue := producer.InitRabbitMQ()
+	// Object storage is MinIO, AWS S3 or a local directory depending on STORAGE_BACKEND
+	objects, err := objectstore.New(context.Background(), cfg.Storage)
+	if err != nil {
+		log.Fatalln("Object storage:", err)
+	}
+	objectstore.SetupBucket(objects, cfg.Storage.Bucket)
+	// Objects are encrypted with data keys wrapped by ENCRYPTION_KEYS or ENCRYPTION_KMS_KEY_ID, the worker needs the same keys
+	keys, err := envelope.New(context.Background(), cfg.Encryption)
+	if err != nil {
+		log.Fatalln("Encryption:", err)
+	}
+	if keys.Enabled() {
+		log.Println("Encrypting stored objects, data keys are wrapped by", keys.Current())
+	} else {
+		log.Println("ENCRYPTION_KEYS not set, objects are stored unencrypted")
+	}
+	// The message queue is RabbitMQ or Kafka depending on QUEUE_BACKEND, the worker has to use the same
+	bus, err := queue.New(context.Background(), cfg.Queue, cfg.RabbitMQURL)
+	if err != nil {
+		log.Fatalln("Queue:", err)
+	}
 	
-	// --- Initialize SQLite ---
-	sqliteDB := storage.InitSQLite() // calling the storage.sqlite.go file 
+	// --- Initialize the Database (SQLite or PostgreSQL, see DB_DRIVER) ---
+	store := storage.InitStore(cfg.Database)
 
 	// close the connections when the server stops 
-	defer rabbitConn.Close()
-	defer rabbitChan.Close()
-	defer sqliteDB.Close() 
+	defer bus.Close()
+	defer store.Close()
+
+	// The gateway's own live events go through the bus too, every replica's streams hear them
+	eventPublisher := events.NewPublisher(bus)
+
+	// Keyword search indexes the chunk text the worker sends, in the database or Elasticsearch/OpenSearch (KEYWORD_SEARCH)
+	keywordIndex, err := keyword.New(cfg.KeywordSearch, store)
+	if err != nil {
+		log.Fatalln("Keyword search:", err)
+	}
+
+	// Webhooks fire as jobs finish and documents match saved searches
+	webhookNotifier := notifier.New(store)
+
+	// Purge soft-deleted documents once their retention window is over, the purge_documents schedule runs it.
+	// It also finishes deleting accounts, the purge_accounts schedule.
+	documentPurger := purger.New(store, objects, bus, keywordIndex, cfg.Storage.Bucket, cfg.Documents.Retention)
+
+	// Optional ClamAV scan of every upload before it is queued, see CLAMAV_ADDR
+	virusScanner := scanner.New(store, objects, keys, cfg.ClamAV)
+
+	// Semantic search needs the same embedding provider as the worker plus the vector store it indexes into
+	queryEmbedder, err := embeddings.New(cfg.Embeddings, cfg.Providers)
+	if err != nil {
+		log.Fatalln("Embedding provider:", err)
+	}
+	searchIndex, err := vectorstore.New(cfg.VectorStore)
+	if err != nil {
+		log.Fatalln("Vector store:", err)
+	}
+	if (queryEmbedder == nil || searchIndex == nil) && keywordIndex == nil {
+		log.Println("EMBEDDING_PROVIDER or VECTOR_STORE and KEYWORD_SEARCH not set, /search is disabled")
+	}
+
+	// Answering questions additionally needs an LLM, see LLM_PROVIDER
+	answerLLM, err := llm.New(cfg.LLM, cfg.Providers)
+	if err != nil {
+		log.Fatalln("LLM provider:", err)
+	}
+	if answerLLM == nil {
+		log.Println("LLM_PROVIDER not set, /ask is disabled")
+	}
+
+	// Optional cross-encoder that puts the best search hits in order again, see RERANK_PROVIDER
+	reranker, err := rerank.New(cfg.Rerank)
+	if err != nil {
+		log.Fatalln("Reranker:", err)
+	}
+
+	// Data exports are built in the background, the link goes out by email when SMTP_ADDR is set
+	mailer := mailout.New(cfg.SMTP)
+	dataExporter := exporter.New(store, objects, keys, searchIndex, mailer, eventPublisher, cfg.Storage.Bucket, cfg.Accounts.ExportTTL)
+
+	// Fan out live events to WebSocket and Server-Sent Events clients
+	eventHub := events.NewHub()
+	go eventHub.Run(bus)
+
+	// Browser origins allowed to talk to the gateway, see CORS_ORIGINS
+	allowedOrigins, err := middleware.NewOrigins(cfg.CORS.Origins)
+	if err != nil {
+		log.Fatalln("CORS:", err)
+	}
 
 	// Initialize Handlers
-	authHandler := handlers.NewAuthHandler(sqliteDB) // Create Auth Handler
+	passwordPolicy := passwords.New(cfg.Passwords)
+	authHandler := handlers.NewAuthHandler(store, cfg.Login, passwordPolicy) // Create Auth Handler
+	oauthHandler := handlers.NewOAuthHandler(store, cfg.OAuth)
+	jobHandler := handlers.NewJobHandler(store, bus)
+	documentHandler := handlers.NewDocumentHandler(store, objects, keys, bus, documentPurger, searchIndex, keywordIndex, cfg.Documents, cfg.OAuth.RedirectBaseURL)
+	chunkedUploadHandler := handlers.NewChunkedUploadHandler(store, objects, keys, bus, virusScanner, cfg)
+	directUploadHandler := handlers.NewDirectUploadHandler(store, objects, keys, bus, virusScanner, cfg)
+	batchHandler := handlers.NewBatchHandler(store, objects, keys, bus, virusScanner, cfg)
+	urlIngestHandler := handlers.NewURLIngestHandler(store, objects, keys, bus, virusScanner, cfg)
+	inboxHandler := handlers.NewInboxHandler(store, objects, keys, bus, virusScanner, cfg)
+	bucketEventHandler := handlers.NewBucketEventHandler(store, objects, keys, bus, virusScanner, cfg)
+	connectorHandler := handlers.NewConnectorHandler(store, objects, keys, bus, virusScanner, cfg)
+	webhookHandler := handlers.NewWebhookHandler(store)
+	jobWatchHandler := handlers.NewJobWatchHandler(store, eventHub, allowedOrigins)
+	eventStreamHandler := handlers.NewEventStreamHandler(eventHub)
+	// Queue depths for GET /admin/stats come from RabbitMQ's management API
+	var queueManagement *queue.Management
+	if cfg.Queue.Backend == "rabbitmq" && cfg.Queue.ManagementURL != "" {
+		if queueManagement, err = queue.NewManagement(cfg.Queue.ManagementURL, cfg.RabbitMQURL); err != nil {
+			log.Fatalln("Config:", err)
+		}
+	}
+	// the rate limit overrides admins give single users, for the REST and gRPC limits alike
+	quotas := ratelimit.NewQuotas(store)
+	adminHandler := handlers.NewAdminHandler(store, bus, queueManagement, quotas)
+	// Uploads are turned away while the ingestion backlog is over UPLOAD_MAX_BACKLOG, counted
+	// by the management API when there is one and a passive declare otherwise
+	var backlogSource queue.Backlog
+	if queueManagement != nil {
+		backlogSource = queueManagement
+	} else if source, ok := bus.(queue.Backlog); ok {
+		backlogSource = source
+	}
+	backlog := backpressure.New(backlogSource, cfg.Queue.Backpressure)
+	if backlog != nil {
+		go backlog.Run(context.Background())
+	}
+	apiKeyHandler := handlers.NewAPIKeyHandler(store)
+	sessionHandler := handlers.NewSessionHandler(store)
+	profileHandler := handlers.NewProfileHandler(store, objects, cfg.Storage.Bucket, passwordPolicy)
+	accountHandler := handlers.NewAccountHandler(store, documentPurger, cfg.Accounts)
+	exportHandler := handlers.NewExportHandler(store, dataExporter)
+	orgHandler := handlers.NewOrgHandler(store)
+	retentionHandler := handlers.NewRetentionHandler(store)
+	collectionHandler := handlers.NewCollectionHandler(store)
+	shareHandler := handlers.NewShareHandler(store, documentHandler, cfg.Login)
+	versionHandler := handlers.NewVersionHandler(store, objects, keys, bus, virusScanner, cfg)
+	searchHandler := handlers.NewSearchHandler(store, queryEmbedder, searchIndex, keywordIndex, reranker, cfg.Rerank, cfg.Embeddings.LanguageModels, cfg.Searches)
+	savedSearchHandler := handlers.NewSavedSearchHandler(store)
+	askHandler := handlers.NewAskHandler(searchHandler, answerLLM)
+	chatHandler := handlers.NewChatHandler(store, askHandler)
+	chunkHandler := handlers.NewChunkHandler(store, searchIndex, keywordIndex)
+	annotationHandler := handlers.NewAnnotationHandler(store, chunkHandler)
+	activityHandler := handlers.NewActivityHandler(store)
+	modelHandler := handlers.NewModelHandler(store, queryEmbedder, answerLLM)
+	planHandler := handlers.NewPlanHandler(store)
+	embeddingMigrationHandler := handlers.NewEmbeddingMigrationHandler(store, queryEmbedder, searchIndex, cfg.VectorStore.Collection)
+	usageHandler := handlers.NewUsageHandler(store)
+	billingHandler := handlers.NewBillingHandler(store, stripe.New(cfg.Stripe), cfg.Stripe)
+	healthHandler := handlers.NewHealthHandler(store, objects, cfg.Storage.Bucket, bus, backlog)
+
+	// Keep the jobs table in sync with what the worker reports. Processed documents are run
+	// against the saved searches with alerts, matches go out by webhook or email. Uploaders
+	// are emailed about finished jobs straight away or in the send_digests schedule's digest.
+	searchAlerts := alerts.New(store, searchHandler, webhookNotifier, mailer, cfg.Searches.AlertMinScore)
+	processingDigest := digest.New(store, mailer)
+	go consumer.ConsumeResults(bus, store, keywordIndex, webhookNotifier, processingDigest, eventPublisher, searchAlerts)
+
+	// Files dropped into the bucket, announced by its notifications through the broker, see BUCKET_EVENTS_QUEUE
+	if cfg.BucketEvents.Queue {
+		go bucketEventHandler.Consume(bus)
+	}
+
+	// Periodic tasks, run on the schedules kept in the database (see /admin/schedules)
+	taskScheduler := scheduler.New(store, map[string]scheduler.Task{
+		"sync_connectors":   scheduler.Func(connectorHandler.Syncer.SyncDue),
+		"purge_documents":   scheduler.Func(documentPurger.Reap),
+		"expire_documents":  scheduler.Func(documentPurger.Expire),
+		"purge_accounts":    scheduler.Func(documentPurger.PurgeAccounts),
+		"expire_uploads":    scheduler.Func(documentPurger.ExpireUploads),
+		"process_exports":   scheduler.Func(dataExporter.Process),
+		"reembed_documents": handlers.NewReembedTask(store, bus),
+		// moves the corpus to another embedding model, see /admin/embedding-migrations
+		"migrate_embeddings": scheduler.Func(handlers.NewEmbeddingMigrationTask(store, bus).Run),
+		// daily usage to the billing endpoint and usage.reported webhooks
+		"report_usage": scheduler.Func(handlers.NewUsageTask(store, webhookNotifier, notifier.NewBilling(cfg.Billing)).Run),
+		// lifts read-only from accounts back within their plan's storage
+		"check_storage": scheduler.Func(handlers.NewStorageTask(store).Run),
+		// the daily emails of processing completions and failures, for users who want a digest
+		"send_digests": scheduler.Func(processingDigest.Send),
+	})
+	scheduleHandler := handlers.NewScheduleHandler(store, taskScheduler)
+
+	// gin.Default's logger, with panics answered like any other error
+	r := gin.New()
+	// only the load balancers in TRUSTED_PROXIES get to say who the client is, rate limits and audit entries go by it
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalln("Trusted proxies:", err)
+	}
+	r.Use(gin.Logger(), gin.CustomRecovery(apierror.Recovery))
+	// first, so every error body carries the ID and every response the header
+	r.Use(apierror.RequestID())
+	r.NoRoute(apierror.NoRoute)
+	// uploads past this much are spooled to disk instead of held in memory
+	r.MaxMultipartMemory = handlers.MultipartMemory
 
-	r := gin.Default()
+	// Kubernetes probes, registered before the middleware below so they aren't rate limited, counted or traced
+	r.GET("/healthz", healthHandler.Live)
+	r.GET("/readyz", healthHandler.Ready)
 
 	// CORS Config
-	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:3000"},  // the frontend to talk 
-		AllowMethods:     []string{"POST", "GET", "OPTIONS", "PUT", "DELETE"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-		MaxAge:           12 * time.Hour,
-	}))
+	r.Use(middleware.CORS(allowedOrigins, cfg.CORS))
+
+	// Request latency and status counts for Prometheus
+	r.Use(metrics.Middleware())
+
+	// A span per request, picking up traceparent from the caller
+	r.Use(otelgin.Middleware("docstream-gateway"))
+
+	// Rate Limiting, shared through Redis when REDIS_URL is set
+	limiter := ratelimit.New(cfg.RedisURL)
+	rate := func(name, value string) ratelimit.Rate {
+		parsed, err := ratelimit.ParseRate(value)
+		if err != nil {
+			log.Fatalf("Config: %s rate limit: %v\n", name, err)
+		}
+		return parsed
+	}
+	r.Use(ratelimit.PerIP(limiter, rate("ip", cfg.RateLimits.IP)))
+	// turned down requests warn the user on their event stream
+	uploadLimit := ratelimit.PerUser(limiter, rate("uploads", cfg.RateLimits.Uploads), "uploads", eventPublisher.QuotaWarning, quotas)
+	// every route that queues new work, a 503 while the workers are too far behind
+	shedLoad := backlog.Middleware()
+	// every search costs an embedding call
+	searchLimit := ratelimit.PerUser(limiter, rate("search", cfg.RateLimits.Search), "search", eventPublisher.QuotaWarning, quotas)
+	askLimit := ratelimit.PerUser(limiter, rate("ask", cfg.RateLimits.Ask), "ask", eventPublisher.QuotaWarning, quotas)
 
 	// --- Routes --
 	// Auth Routes
 	r.POST("/signup", authHandler.Signup) 
 	r.POST("/login", authHandler.Login)   
+	r.POST("/refresh", authHandler.Refresh)
+
+	// Public keys for services verifying our tokens themselves (RS256 only)
+	r.GET("/.well-known/jwks.json", handlers.JWKS)
+
+	// OAuth Login Routes (google, github)
+	r.GET("/auth/:provider", oauthHandler.Start)
+	r.GET("/auth/:provider/callback", oauthHandler.Callback)
+
+	// Connector OAuth Callback (google_drive, dropbox), the browser comes back here without a token
+	r.GET("/connectors/callback/:provider", connectorHandler.Callback)
+
+	// Stripe Webhook, subscription events signed with STRIPE_WEBHOOK_SECRET
+	r.POST("/billing/stripe/webhook", billingHandler.Webhook)
+
+	// Keyed Routes, scripts can use an X-API-Key with the right scope instead of a Bearer token
+	keyed := func(scope string) gin.HandlerFunc {
+		return middleware.RequireAuthOrAPIKey(store, scope)
+	}
+
+	// Routes that need object storage or the queue get a quick 503 while it is down instead of hanging on it
+	objectStorage := middleware.Dependency{Name: "Storage", Check: objects.Available}
+	jobQueue := middleware.Dependency{Name: "Queue", Check: bus.Ready}
+	needs := middleware.RequireAvailable
 
 	// Upload Route
-	r.POST("/upload", handlers.UploadHandler(minioClient, rabbitChan, rabbitQueue))
-	
-	// Health Check
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "Gateway is active"})
-	})
+	r.POST("/upload", keyed(models.ScopeUpload), uploadLimit, shedLoad, needs(objectStorage, jobQueue), handlers.UploadHandler(store, objects, keys, bus, virusScanner, cfg))
+
+	// Resumable (chunked) Upload Routes, only starting one counts against the upload limit
+	r.POST("/upload/init", keyed(models.ScopeUpload), uploadLimit, shedLoad, needs(objectStorage), chunkedUploadHandler.Init)
+	r.PATCH("/upload/:id", keyed(models.ScopeUpload), needs(objectStorage), chunkedUploadHandler.UploadPart)
+	r.GET("/upload/:id", keyed(models.ScopeUpload), chunkedUploadHandler.Status)
+	r.POST("/upload/:id/complete", keyed(models.ScopeUpload), needs(objectStorage, jobQueue), chunkedUploadHandler.Complete)
+	r.DELETE("/upload/:id", keyed(models.ScopeUpload), needs(objectStorage), chunkedUploadHandler.Abort)
+
+	// Direct Upload Routes, the client sends the file to a presigned storage URL in between
+	r.POST("/uploads/presign", keyed(models.ScopeUpload), uploadLimit, shedLoad, needs(objectStorage), directUploadHandler.Presign)
+	r.POST("/uploads/:id/complete", keyed(models.ScopeUpload), needs(objectStorage, jobQueue), directUploadHandler.Complete)
+
+	// Bucket Notification Route, MinIO announces files dropped under BUCKET_EVENTS_PREFIX with BUCKET_EVENTS_WEBHOOK_TOKEN
+	r.POST("/storage/events", needs(objectStorage, jobQueue), bucketEventHandler.Webhook)
+
+	// Batch Upload Routes, many files (or a zip of them) in one request with one job each
+	r.POST("/upload/batch", keyed(models.ScopeUpload), uploadLimit, shedLoad, needs(objectStorage, jobQueue), batchHandler.Upload)
+	r.GET("/batches/:id", keyed(models.ScopeJobsRead), batchHandler.Get)
+
+	// URL Ingest Route, the gateway downloads the document itself
+	r.POST("/ingest/url", keyed(models.ScopeUpload), uploadLimit, shedLoad, needs(objectStorage, jobQueue), urlIngestHandler.Ingest)
+
+	// Job Status Routes
+	r.GET("/jobs", keyed(models.ScopeJobsRead), jobHandler.ListJobs)
+	r.GET("/jobs/:id", keyed(models.ScopeJobsRead), jobHandler.GetJob)
+	r.POST("/jobs/:id/cancel", keyed(models.ScopeJobsWrite), jobHandler.Cancel)
+	// Everything the user's jobs report as Server-Sent Events, instead of polling /jobs
+	r.GET("/events", keyed(models.ScopeJobsRead), eventStreamHandler.Stream)
+
+	// Document Routes
+	r.GET("/documents", keyed(models.ScopeDocumentsRead), documentHandler.ListDocuments)
+	r.GET("/documents/:id", keyed(models.ScopeDocumentsRead), documentHandler.Get)
+	r.GET("/documents/:id/download", keyed(models.ScopeDocumentsRead), needs(objectStorage), documentHandler.Download)
+	// Streams documents with Range support, download links of encrypted documents lead here too
+	// and the token in the link takes the place of the usual credentials
+	contentAuth := func(c *gin.Context) {
+		if c.Query("token") == "" {
+			keyed(models.ScopeDocumentsRead)(c)
+		}
+	}
+	r.GET("/documents/:id/content", contentAuth, needs(objectStorage), documentHandler.Content)
+	r.HEAD("/documents/:id/content", contentAuth, needs(objectStorage), documentHandler.Content)
+	r.GET("/documents/:id/thumbnail", keyed(models.ScopeDocumentsRead), needs(objectStorage), documentHandler.Thumbnail)
+	r.GET("/documents/:id/export", keyed(models.ScopeDocumentsRead), chunkHandler.Export)
+	r.PATCH("/documents/:id", keyed(models.ScopeUpload), documentHandler.Update)
+	r.DELETE("/documents/:id", keyed(models.ScopeDocumentsDelete), documentHandler.Delete)
+	r.POST("/documents/:id/restore", keyed(models.ScopeDocumentsDelete), documentHandler.Restore)
+	r.POST("/documents/:id/reprocess", keyed(models.ScopeUpload), uploadLimit, shedLoad, needs(jobQueue), documentHandler.Reprocess)
+
+	// Version Routes, a re-upload keeps the earlier content around to go back to
+	r.POST("/documents/:id/versions", keyed(models.ScopeUpload), uploadLimit, shedLoad, needs(objectStorage, jobQueue), versionHandler.Upload)
+	r.GET("/documents/:id/versions", keyed(models.ScopeDocumentsRead), versionHandler.List)
+	r.POST("/documents/:id/versions/:version/restore", keyed(models.ScopeUpload), needs(objectStorage, jobQueue), versionHandler.Restore)
+
+	// Annotation Routes, highlights and comments on ranges of a document's text
+	r.POST("/documents/:id/annotations", keyed(models.ScopeUpload), annotationHandler.Create)
+	r.GET("/documents/:id/annotations", keyed(models.ScopeDocumentsRead), annotationHandler.List)
+	r.PATCH("/annotations/:id", keyed(models.ScopeUpload), annotationHandler.Update)
+	r.DELETE("/annotations/:id", keyed(models.ScopeUpload), annotationHandler.Delete)
+
+	// Activity Routes, what happened to a document or an organization's documents, from the audit log
+	r.GET("/documents/:id/activity", keyed(models.ScopeDocumentsRead), activityHandler.Document)
+	r.GET("/orgs/:id/activity", keyed(models.ScopeDocumentsRead), activityHandler.Org)
+
+	// Collection Routes, folders for documents that can carry processing defaults
+	r.POST("/collections", keyed(models.ScopeUpload), collectionHandler.Create)
+	r.GET("/collections", keyed(models.ScopeDocumentsRead), collectionHandler.List)
+	r.GET("/collections/:id", keyed(models.ScopeDocumentsRead), collectionHandler.Get)
+	r.PATCH("/collections/:id", keyed(models.ScopeUpload), collectionHandler.Update)
+	r.DELETE("/collections/:id", keyed(models.ScopeDocumentsDelete), collectionHandler.Delete)
+
+	// Sharing Routes, documents and collections shared with other users read like their own
+	r.POST("/shares", keyed(models.ScopeUpload), shareHandler.Create)
+	r.GET("/shares", keyed(models.ScopeDocumentsRead), shareHandler.List)
+	r.DELETE("/shares/:id", keyed(models.ScopeUpload), shareHandler.Delete)
+	r.POST("/share-links", keyed(models.ScopeUpload), shareHandler.CreateLink)
+	r.GET("/share-links", keyed(models.ScopeDocumentsRead), shareHandler.ListLinks)
+	r.DELETE("/share-links/:id", keyed(models.ScopeUpload), shareHandler.DeleteLink)
+	// Share links open without credentials, the token in the path is the credential
+	r.GET("/shared/:token", shareHandler.Open)
+	r.GET("/shared/:token/download", needs(objectStorage), shareHandler.Download)
+
+	// Semantic Search Routes, the query goes in ?q= or a JSON body
+	r.GET("/search", keyed(models.ScopeDocumentsRead), searchLimit, searchHandler.Search)
+	r.POST("/search", keyed(models.ScopeDocumentsRead), searchLimit, searchHandler.Search)
+
+	// Saved Search Routes, named searches with optional alerts and the search history
+	r.GET("/searches", keyed(models.ScopeDocumentsRead), savedSearchHandler.List)
+	r.POST("/searches", keyed(models.ScopeDocumentsRead), savedSearchHandler.Create)
+	r.DELETE("/searches/history", keyed(models.ScopeDocumentsRead), savedSearchHandler.ClearHistory)
+	r.GET("/searches/:id", keyed(models.ScopeDocumentsRead), savedSearchHandler.Get)
+	r.PATCH("/searches/:id", keyed(models.ScopeDocumentsRead), savedSearchHandler.Update)
+	r.DELETE("/searches/:id", keyed(models.ScopeDocumentsRead), savedSearchHandler.Delete)
+
+	// Question Answering Route, streams the answer back as server-sent events
+	r.POST("/ask", keyed(models.ScopeDocumentsRead), askLimit, askHandler.Ask)
+
+	// Chunk Route, the passage a citation points at
+	r.GET("/chunks/:id", keyed(models.ScopeDocumentsRead), chunkHandler.Get)
+
+	// Model Route, what requests may pick instead of the configured models
+	r.GET("/models", keyed(models.ScopeDocumentsRead), modelHandler.List)
+
+	// Plan Route, the tiers users and organizations are on and their limits
+	r.GET("/plans", keyed(models.ScopeDocumentsRead), planHandler.List)
+
+	// Chat Routes, conversations that keep their history and answer like /ask
+	r.POST("/chats", keyed(models.ScopeDocumentsRead), chatHandler.Create)
+	r.GET("/chats", keyed(models.ScopeDocumentsRead), chatHandler.List)
+	r.GET("/chats/:id", keyed(models.ScopeDocumentsRead), chatHandler.Get)
+	r.DELETE("/chats/:id", keyed(models.ScopeDocumentsRead), chatHandler.Delete)
+	r.POST("/chats/:id/messages", keyed(models.ScopeDocumentsRead), askLimit, chatHandler.Send)
 
-	// Start Server
-	port := os.Getenv("API_GATEWAY_PORT")
-	if port == ""{
-		log.Fatalln("port is missing!")
+	// Protected Routes, everything here needs a valid Bearer token
+	protected := r.Group("/")
+	protected.Use(middleware.RequireAuth(store))
+
+	// Logout, ends the bearer token's session (and revokes the refresh token in the body)
+	protected.POST("/logout", authHandler.Logout)
+
+	// Profile Routes, the caller's own account
+	protected.GET("/me", profileHandler.Get)
+	protected.PATCH("/me", profileHandler.Update)
+	protected.PUT("/me/avatar", needs(objectStorage), profileHandler.UploadAvatar)
+	protected.GET("/me/avatar", needs(objectStorage), profileHandler.Avatar)
+	protected.DELETE("/me/avatar", profileHandler.DeleteAvatar)
+	protected.POST("/me/change-password", profileHandler.ChangePassword)
+	// Account Deletion, erases the account and purges its documents in the background
+	protected.DELETE("/me", accountHandler.Delete)
+	// Data Export, a zip of everything the account has for download
+	protected.POST("/me/export", needs(objectStorage), exportHandler.Create)
+	protected.GET("/me/exports", exportHandler.List)
+	protected.GET("/me/exports/:id", needs(objectStorage), exportHandler.Get)
+	// Usage, what the account consumed a day at a time, as billing sees it
+	protected.GET("/me/usage", usageHandler.Get)
+	// Billing, plans bought through Stripe for the account or an organization the caller owns
+	protected.POST("/billing/checkout", billingHandler.Checkout)
+	protected.GET("/billing/subscription", billingHandler.GetSubscription)
+	protected.PUT("/billing/subscription", billingHandler.ChangeSubscription)
+
+	// Session Routes, logins that can still be refreshed, one or all of them can be logged out
+	protected.GET("/me/sessions", sessionHandler.List)
+	protected.DELETE("/me/sessions", sessionHandler.RevokeAll)
+	protected.DELETE("/me/sessions/:id", sessionHandler.Revoke)
+
+	// Live Job Progress
+	protected.GET("/ws/jobs/:id", jobWatchHandler.Watch)
+
+	// API Key Routes, keys can't manage other keys
+	protected.POST("/apikeys", apiKeyHandler.Create)
+	protected.GET("/apikeys", apiKeyHandler.List)
+	protected.DELETE("/apikeys/:id", apiKeyHandler.Revoke)
+
+	// Organization Routes, documents uploaded with an org_id are shared with every member
+	protected.POST("/orgs", orgHandler.Create)
+	protected.GET("/orgs", orgHandler.List)
+	protected.GET("/orgs/:id/members", orgHandler.Members)
+	protected.PATCH("/orgs/:id/members/:user_id", orgHandler.UpdateMember)
+	protected.DELETE("/orgs/:id/members/:user_id", orgHandler.RemoveMember)
+	protected.POST("/orgs/:id/invitations", orgHandler.Invite)
+	protected.GET("/orgs/:id/invitations", orgHandler.ListInvitations)
+	protected.DELETE("/orgs/:id/invitations/:invitation_id", orgHandler.CancelInvitation)
+	protected.GET("/orgs/:id/retention", retentionHandler.Get)
+	protected.PUT("/orgs/:id/retention", retentionHandler.Set)
+	protected.GET("/invitations", orgHandler.MyInvitations)
+	protected.POST("/invitations/:id/accept", orgHandler.Accept)
+
+	// Legal holds are only for signed in owners, an API key that can delete can't lift one
+	protected.PUT("/documents/:id/legal-hold", retentionHandler.LegalHold)
+
+	// Inbound Email Routes, the address mail with attachments can be sent to
+	protected.GET("/inbox", inboxHandler.Get)
+	protected.POST("/inbox/rotate", inboxHandler.Rotate)
+
+	// Connector Routes, linked Drive and Dropbox folders synced into documents
+	protected.POST("/connectors", connectorHandler.Create)
+	protected.GET("/connectors", connectorHandler.List)
+	protected.GET("/connectors/:id", connectorHandler.Get)
+	protected.PATCH("/connectors/:id", connectorHandler.Update)
+	protected.DELETE("/connectors/:id", connectorHandler.Delete)
+	protected.POST("/connectors/:id/authorize", connectorHandler.Authorize)
+	protected.GET("/connectors/:id/folders", connectorHandler.Folders)
+	protected.POST("/connectors/:id/sync", needs(objectStorage, jobQueue), connectorHandler.Sync)
+
+	// Webhook Routes
+	protected.POST("/webhooks", webhookHandler.Create)
+	protected.GET("/webhooks", webhookHandler.List)
+	protected.DELETE("/webhooks/:id", webhookHandler.Delete)
+
+	// Admin Routes
+	admin := protected.Group("/admin")
+	admin.Use(middleware.RequireAdmin(store))
+	admin.GET("/dlq", adminHandler.ListDLQ)
+	admin.POST("/dlq/:job_id/requeue", needs(jobQueue), adminHandler.RequeueDLQ)
+	admin.GET("/stats", adminHandler.Stats)
+
+	// User management, suspensions and per-user rate limits
+	admin.GET("/users", adminHandler.ListUsers)
+	admin.GET("/users/:id", adminHandler.GetUser)
+	admin.POST("/users/:id/suspend", adminHandler.SuspendUser)
+	admin.POST("/users/:id/reactivate", adminHandler.ReactivateUser)
+	admin.PUT("/users/:id/quota", adminHandler.SetQuota)
+	admin.DELETE("/users/:id/quota", adminHandler.DeleteQuota)
+
+	// Model allowlist, with prices and limits
+	admin.GET("/models", adminHandler.ListModels)
+	admin.PUT("/models/:kind/*name", adminHandler.PutModel)
+	admin.DELETE("/models/:kind/*name", adminHandler.DeleteModel)
+
+	// Plans, what each allows and who is on which
+	admin.GET("/plans", adminHandler.ListPlans)
+	admin.PUT("/plans/:name", adminHandler.PutPlan)
+	admin.DELETE("/plans/:name", adminHandler.DeletePlan)
+	admin.PUT("/users/:id/plan", adminHandler.SetUserPlan)
+	admin.PUT("/orgs/:id/plan", adminHandler.SetOrgPlan)
+
+	// Embedding migrations, re-embedding everything with another model and switching searches over
+	admin.POST("/embedding-migrations", embeddingMigrationHandler.Start)
+	admin.GET("/embedding-migrations", embeddingMigrationHandler.List)
+	admin.GET("/embedding-migrations/:id", embeddingMigrationHandler.Get)
+	admin.POST("/embedding-migrations/:id/switch", embeddingMigrationHandler.Switch)
+	admin.POST("/embedding-migrations/:id/cancel", embeddingMigrationHandler.Cancel)
+
+	// Schedule Routes, the periodic tasks and when they run
+	admin.POST("/schedules", scheduleHandler.Create)
+	admin.GET("/schedules", scheduleHandler.List)
+	admin.GET("/schedules/:id", scheduleHandler.Get)
+	admin.PATCH("/schedules/:id", scheduleHandler.Update)
+	admin.DELETE("/schedules/:id", scheduleHandler.Delete)
+	admin.POST("/schedules/:id/run", scheduleHandler.Run)
+
+	// API Docs, an OpenAPI 3 spec built from the routes above and Swagger UI to try it in
+	spec := openapi.Build(openapi.Info{Title: "DocStream API", Version: "1.0.0", Description: "Upload documents, follow their processing and search them."}, r.Routes(), handlers.APIDocs)
+	r.GET("/openapi.json", spec.Handler())
+	r.GET("/docs", openapi.UI("DocStream API", "/openapi.json"))
+
+	// Optional SMTP listener uploading what's mailed to the inbox addresses, see INBOUND_EMAIL_ADDR
+	if cfg.Email.Addr != "" {
+		mailServer := mailin.New(cfg.Email, inboxHandler)
+		go func() {
+			log.Fatalln("Inbound email:", mailServer.ListenAndServe(cfg.Email.Addr))
+		}()
 	}
-	addr := ":" + port
-	log.Println("API Gateway running on port: ", port)
-	if err := r.Run(addr); err != nil {
+
+	// Prometheus scrapes its own listener, see METRICS_ADDR
+	if cfg.MetricsAddr != "" {
+		go func() {
+			log.Fatalln("Metrics:", metrics.ListenAndServe(cfg.MetricsAddr))
+		}()
+	}
+
+	// Optional gRPC API on a second port for backend services, see API_GATEWAY_GRPC_PORT
+	if cfg.GRPCPort != "" {
+		grpcBackend := handlers.NewGRPCBackend(authHandler, searchHandler, store, objects, keys, bus, virusScanner, backlog, cfg)
+		grpcRates := grpcapi.Rates{
+			IP:      rate("ip", cfg.RateLimits.IP),
+			Uploads: rate("uploads", cfg.RateLimits.Uploads),
+			Search:  rate("search", cfg.RateLimits.Search),
+		}
+		grpcServer := grpcapi.New(grpcBackend, store, limiter, grpcRates, quotas, int64(cfg.Documents.MaxUploadSize))
+		go func() {
+			log.Fatalln("gRPC API:", grpcServer.ListenAndServe(":"+cfg.GRPCPort))
+		}()
+	}
+
+	// Start the scheduled tasks, connector syncs and purges included
+	go taskScheduler.Run()
+
+	// Start Server, over HTTPS and HTTP/2 when TLS_CERT_FILE or TLS_AUTOCERT_DOMAINS is set
+	if err := server.ListenAndServe(r, cfg.Port, cfg.TLS); err != nil {
 		log.Fatalln("Failed to start server:", err)
 	}
 }
\ No newline at end of file
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+)
+
+const migrateUsage = `usage: gateway migrate [-config file] [-db-driver driver] [-database-url url] <command>
+
+commands:
+  up            apply every pending migration
+  down [n]      revert the last n migrations, 1 by default
+  to <version>  apply or revert migrations until the database is at version
+  status        list the migrations and when they were applied`
+
+// runMigrate is `gateway migrate`, for running migrations by hand or from a deploy job
+// before the gateways start with DB_AUTO_MIGRATE=false
+func runMigrate(args []string) {
+	db, rest, err := config.LoadDatabase(args)
+	if err != nil {
+		log.Fatalln("Config:", err)
+	}
+	if len(rest) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+
+	migrator, err := storage.OpenMigrator(db)
+	if err != nil {
+		log.Fatalln("Database:", err)
+	}
+	defer migrator.Close()
+	ctx := context.Background()
+
+	// n comes from the optional argument after the command
+	number := func(def int) int {
+		if len(rest) < 2 {
+			if def < 0 {
+				fmt.Fprintln(os.Stderr, migrateUsage)
+				os.Exit(2)
+			}
+			return def
+		}
+		n, err := strconv.Atoi(rest[1])
+		if err != nil || n < 0 {
+			log.Fatalf("%q isn't a number\n", rest[1])
+		}
+		return n
+	}
+
+	var n int
+	switch rest[0] {
+	case "up":
+		n, err = migrator.Up(ctx)
+	case "down":
+		n, err = migrator.Down(ctx, number(1))
+	case "to":
+		n, err = migrator.To(ctx, number(-1))
+	case "status":
+		printStatus(ctx, migrator)
+		return
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalln("Migrate:", err)
+	}
+	log.Printf("Done, %d migrations run\n", n)
+}
+
+func printStatus(ctx context.Context, migrator *storage.Migrator) {
+	status, err := migrator.Status(ctx)
+	if err != nil {
+		log.Fatalln("Migrate:", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+	for _, s := range status {
+		applied := "pending"
+		if s.AppliedAt != nil {
+			applied = s.AppliedAt.Local().Format(time.DateTime)
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+	}
+	w.Flush()
+}
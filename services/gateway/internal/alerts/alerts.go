@@ -0,0 +1,112 @@
+// Package alerts tells users when a document that was just processed matches one of their saved
+// searches, through their webhooks or by email.
+package alerts
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/mailout"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/notifier"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+)
+
+// matchTimeout bounds the searches run for one document, embeddings included
+const matchTimeout = 2 * time.Minute
+
+// Matcher runs a saved search restricted to one document, the search handler is one
+type Matcher interface {
+	Matches(ctx context.Context, search models.SavedSearch, documentID string, minScore float64) (bool, error)
+}
+
+// Alerts checks processed documents against the saved searches with notify set. Each search
+// alerts once per document, a reprocessed one doesn't send it again.
+type Alerts struct {
+	store  storage.Store
+	match  Matcher
+	notify *notifier.Notifier
+	// mail is nil when the gateway sends no mail, email alerts are dropped then
+	mail *mailout.Sender
+	// minScore is the similarity a vector search needs to alert
+	minScore float64
+}
+
+// New matches with match, a vector search needs a similarity of minScore to alert
+func New(store storage.Store, match Matcher, notify *notifier.Notifier, mail *mailout.Sender, minScore float64) *Alerts {
+	return &Alerts{store: store, match: match, notify: notify, mail: mail, minScore: minScore}
+}
+
+// DocumentProcessed checks job's document against the saved searches of everyone who can see it,
+// in the background. Call it once the job is recorded completed.
+func (a *Alerts) DocumentProcessed(job models.Job) {
+	if job.UserID == nil || job.DocumentID == "" {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), matchTimeout)
+		defer cancel()
+		if err := a.check(ctx, job, *job.UserID); err != nil {
+			log.Printf("Failed to check saved searches for document %s: %v\n", job.DocumentID, err)
+		}
+	}()
+}
+
+func (a *Alerts) check(ctx context.Context, job models.Job, uploaderID int) error {
+	doc, err := a.store.GetDocument(ctx, job.DocumentID, uploaderID)
+	if err != nil {
+		return err
+	}
+	searches, err := a.store.ListAlertingSearches(ctx, uploaderID, doc.OrgID)
+	if err != nil {
+		return err
+	}
+
+	for _, search := range searches {
+		// only documents that came in after the search was saved are news to its owner
+		if search.CreatedAt.After(doc.CreatedAt) {
+			continue
+		}
+		matched, err := a.match.Matches(ctx, search, doc.ID, a.minScore)
+		if err != nil {
+			log.Printf("Failed to match saved search %s: %v\n", search.ID, err)
+			continue
+		}
+		if !matched {
+			continue
+		}
+		claimed, err := a.store.ClaimSearchAlert(ctx, search.ID, doc.ID)
+		if err != nil || !claimed {
+			// another replica got it, or it alerted on an earlier run of the document
+			continue
+		}
+
+		if slices.Contains(search.Notify, models.SearchNotifyWebhook) {
+			a.notify.SearchMatched(search, job)
+		}
+		if slices.Contains(search.Notify, models.SearchNotifyEmail) {
+			a.email(ctx, search, doc)
+		}
+	}
+	return nil
+}
+
+// email is best effort, the alert counts as sent either way
+func (a *Alerts) email(ctx context.Context, search models.SavedSearch, doc models.Document) {
+	if a.mail == nil {
+		return
+	}
+	user, err := a.store.GetUserByID(ctx, search.UserID)
+	if err != nil {
+		log.Printf("Failed to load the owner of saved search %s: %v\n", search.ID, err)
+		return
+	}
+	body := fmt.Sprintf("A new document matches your saved search %q (%s):\n\n%s\nID: %s\n\nTurn these emails off by removing email from the search's notify at PATCH /searches/%s.\n",
+		search.Name, search.Query, doc.Filename, doc.ID, search.ID)
+	if err := a.mail.Send(ctx, user.Email, "New match for your saved search "+search.Name, body); err != nil {
+		log.Printf("Failed to email saved search %s: %v\n", search.ID, err)
+	}
+}
@@ -0,0 +1,123 @@
+// Package apierror is how the gateway answers a request it can't serve. Every error is the same
+// JSON object:
+//
+//	{"error": "email must be a valid email address", "code": "validation_failed",
+//	 "fields": [{"field": "email", "message": "email must be a valid email address"}],
+//	 "request_id": "6f1c..."}
+//
+// error is the message for people, it kept its name so clients reading it before the envelope
+// still work. code is for programs, fields only come with validation_failed and request_id is
+// the X-Request-ID the response carries, the one to quote when reporting a problem.
+package apierror
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Codes, most follow from the status
+const (
+	CodeInvalidRequest      = "invalid_request"
+	CodeValidationFailed    = "validation_failed"
+	CodeUnauthenticated     = "unauthenticated"
+	CodeForbidden           = "forbidden"
+	CodeNotFound            = "not_found"
+	CodeConflict            = "conflict"
+	CodeGone                = "gone"
+	CodeTooLarge            = "payload_too_large"
+	CodeUnsupportedMedia    = "unsupported_media_type"
+	CodeRangeNotSatisfiable = "range_not_satisfiable"
+	CodeRateLimited         = "rate_limited"
+	CodeInternal            = "internal_error"
+	CodeNotImplemented      = "not_implemented"
+	CodeUpstream            = "upstream_error"
+	CodeUnavailable         = "unavailable"
+	CodeUpstreamTimeout     = "upstream_timeout"
+)
+
+// Codes lists every code, for the API docs
+var Codes = []string{
+	CodeInvalidRequest, CodeValidationFailed, CodeUnauthenticated, CodeForbidden, CodeNotFound, CodeConflict, CodeGone,
+	CodeTooLarge, CodeUnsupportedMedia, CodeRangeNotSatisfiable, CodeRateLimited, CodeInternal, CodeNotImplemented,
+	CodeUpstream, CodeUnavailable, CodeUpstreamTimeout,
+}
+
+var statusCodes = map[int]string{
+	http.StatusBadRequest:                   CodeInvalidRequest,
+	http.StatusUnauthorized:                 CodeUnauthenticated,
+	http.StatusForbidden:                    CodeForbidden,
+	http.StatusNotFound:                     CodeNotFound,
+	http.StatusConflict:                     CodeConflict,
+	http.StatusGone:                         CodeGone,
+	http.StatusRequestEntityTooLarge:        CodeTooLarge,
+	http.StatusUnsupportedMediaType:         CodeUnsupportedMedia,
+	http.StatusRequestedRangeNotSatisfiable: CodeRangeNotSatisfiable,
+	http.StatusTooManyRequests:              CodeRateLimited,
+	http.StatusInternalServerError:          CodeInternal,
+	http.StatusNotImplemented:               CodeNotImplemented,
+	http.StatusBadGateway:                   CodeUpstream,
+	http.StatusServiceUnavailable:           CodeUnavailable,
+	http.StatusGatewayTimeout:               CodeUpstreamTimeout,
+}
+
+// CodeOf is the code an error of this status gets
+func CodeOf(status int) string {
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	if status >= http.StatusInternalServerError {
+		return CodeInternal
+	}
+	return CodeInvalidRequest
+}
+
+// FieldError is what is wrong with one field of the input, Message is a whole sentence
+// naming the field so it reads on its own
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Body is the error object, callers add what else the client needs to it (a job_id, say)
+func Body(c *gin.Context, status int, message string) gin.H {
+	return gin.H{"error": message, "code": CodeOf(status), "request_id": RequestIDOf(c)}
+}
+
+// Write answers with the error, the handler returns right after
+func Write(c *gin.Context, status int, message string) {
+	c.JSON(status, Body(c, status, message))
+}
+
+// Abort answers with the error and stops the handlers after this one, for middleware
+func Abort(c *gin.Context, status int, message string) {
+	c.AbortWithStatusJSON(status, Body(c, status, message))
+}
+
+// Fields answers 400 with what is wrong with each field, error sums them up
+func Fields(c *gin.Context, fields ...FieldError) {
+	messages := make([]string, len(fields))
+	for i, f := range fields {
+		messages[i] = f.Message
+	}
+	body := Body(c, http.StatusBadRequest, strings.Join(messages, "; "))
+	body["code"] = CodeValidationFailed
+	body["fields"] = fields
+	c.JSON(http.StatusBadRequest, body)
+}
+
+// Field answers 400 with what is wrong with one field
+func Field(c *gin.Context, field, message string) {
+	Fields(c, FieldError{Field: field, Message: message})
+}
+
+// NoRoute answers requests gin has no route for, instead of its plain text 404
+func NoRoute(c *gin.Context) {
+	Write(c, http.StatusNotFound, "No such route")
+}
+
+// Recovery turns a panic into a 500 like any other, gin's own recovery logs it first
+func Recovery(c *gin.Context, recovered any) {
+	Abort(c, http.StatusInternalServerError, "Internal server error")
+}
@@ -0,0 +1,46 @@
+package apierror
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries the request's ID both ways, a proxy in front may set it already
+const RequestIDHeader = "X-Request-ID"
+
+const (
+	requestIDKey = "request_id"
+	// IDs from the caller longer than this are replaced, they end up in logs and error bodies
+	maxRequestID = 128
+)
+
+// RequestID gives every request an ID, the caller's X-Request-ID when it sends a sane one,
+// and sends it back in the X-Request-ID response header
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		c.Set(requestIDKey, id)
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
+
+// RequestIDOf is the ID RequestID gave the request, "" when it didn't run
+func RequestIDOf(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestID {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
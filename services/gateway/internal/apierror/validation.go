@@ -0,0 +1,126 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// report fields by the names the client sent them under, not the Go ones
+func init() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		for _, tag := range []string{"json", "form", "uri"} {
+			if name, _, _ := strings.Cut(f.Tag.Get(tag), ","); name != "" && name != "-" {
+				return name
+			}
+		}
+		return f.Name
+	})
+}
+
+// Invalid answers a request whose input didn't bind, err is what ShouldBindJSON and friends
+// returned. The validator's and the JSON decoder's own messages name Go types and struct
+// fields, so they are turned into field errors rather than passed on.
+func Invalid(c *gin.Context, err error) {
+	var fieldErrs validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &fieldErrs):
+		fields := make([]FieldError, 0, len(fieldErrs))
+		for _, fe := range fieldErrs {
+			name := fieldName(fe)
+			fields = append(fields, FieldError{Field: name, Message: name + " " + describe(fe)})
+		}
+		Fields(c, fields...)
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		Field(c, typeErr.Field, typeErr.Field+" must be "+jsonType(typeErr.Type))
+	case errors.As(err, &tooLarge):
+		Write(c, http.StatusRequestEntityTooLarge, "Request body is too large")
+	case errors.Is(err, io.EOF):
+		Write(c, http.StatusBadRequest, "Request body is missing")
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF), errors.As(err, &typeErr):
+		Write(c, http.StatusBadRequest, "Request body isn't valid JSON")
+	default:
+		Write(c, http.StatusBadRequest, "Invalid request")
+	}
+}
+
+// fieldName is the field's path under the top level struct, "metadata.source" for nested ones
+func fieldName(fe validator.FieldError) string {
+	if _, path, ok := strings.Cut(fe.Namespace(), "."); ok {
+		return path
+	}
+	return fe.Field()
+}
+
+// describe says what the field's value must be, finishing a sentence that starts with its name
+func describe(fe validator.FieldError) string {
+	param := fe.Param()
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "url", "http_url":
+		return "must be a valid URL"
+	case "oneof":
+		return "must be one of " + strings.Join(strings.Fields(param), ", ")
+	case "min", "gte":
+		return bound("at least", fe.Kind(), param)
+	case "max", "lte":
+		return bound("at most", fe.Kind(), param)
+	case "len":
+		return bound("exactly", fe.Kind(), param)
+	case "gt":
+		return bound("more than", fe.Kind(), param)
+	case "lt":
+		return bound("less than", fe.Kind(), param)
+	}
+	return "failed the " + fe.Tag() + " check"
+}
+
+func bound(how string, kind reflect.Kind, n string) string {
+	switch kind {
+	case reflect.String:
+		return fmt.Sprintf("must be %s %s characters long", how, n)
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return fmt.Sprintf("must have %s %s items", how, n)
+	}
+	return fmt.Sprintf("must be %s %s", how, n)
+}
+
+// jsonType names a Go type the way the client wrote the JSON
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "a whole number"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	case reflect.Pointer:
+		return jsonType(t.Elem())
+	}
+	return "a different type"
+}
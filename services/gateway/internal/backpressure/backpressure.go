@@ -0,0 +1,142 @@
+// Package backpressure turns uploads away while the workers are behind, instead of letting the
+// ingestion queue grow without bound. The backlog is polled in the background so checking it
+// costs a request nothing.
+package backpressure
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+	"github.com/dhruvkshah75/docstream/gateway/internal/metrics"
+	"github.com/dhruvkshah75/docstream/gateway/internal/queue"
+	"github.com/gin-gonic/gin"
+)
+
+// staleAfter polls without an answer stop uploads from being refused, a broker that can't be
+// asked is Ready's business and shouldn't keep the gate shut forever
+const staleAfter = 3
+
+// Monitor keeps the length of the backlog, a nil Monitor never refuses anything
+type Monitor struct {
+	source queue.Backlog
+	cfg    config.Backpressure
+
+	mu     sync.RWMutex
+	depth  int
+	polled time.Time // the last poll that worked
+	err    error     // the last poll's error, nil once one works again
+}
+
+// Status is what /readyz reports about the backlog
+type Status struct {
+	Depth    int       `json:"depth"`
+	Limit    int       `json:"limit"`
+	Full     bool      `json:"full"`
+	PolledAt time.Time `json:"polled_at"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// New returns nil when cfg doesn't limit the backlog
+func New(source queue.Backlog, cfg config.Backpressure) *Monitor {
+	if cfg.MaxBacklog == 0 {
+		return nil
+	}
+	log.Printf("Refusing uploads while more than %d jobs wait for a worker\n", cfg.MaxBacklog)
+	return &Monitor{source: source, cfg: cfg}
+}
+
+// Run polls the backlog until ctx is done
+func (m *Monitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		m.poll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *Monitor) poll(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, m.cfg.PollInterval)
+	defer cancel()
+	depth, err := m.source.Backlog(ctx)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		if m.err == nil {
+			log.Println("Backlog Poll Error:", err)
+		}
+		m.err = err
+		return
+	}
+	full := depth > m.cfg.MaxBacklog
+	if full != m.fullLocked() {
+		if full {
+			log.Printf("Ingestion backlog at %d jobs, refusing uploads\n", depth)
+		} else {
+			log.Printf("Ingestion backlog down to %d jobs, accepting uploads again\n", depth)
+		}
+	}
+	m.depth, m.polled, m.err = depth, time.Now(), nil
+	metrics.IngestionBacklog.Set(float64(depth))
+}
+
+// Full reports whether the last poll found more jobs than the limit allows
+func (m *Monitor) Full() bool {
+	if m == nil {
+		return false
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.fullLocked()
+}
+
+func (m *Monitor) fullLocked() bool {
+	return m.depth > m.cfg.MaxBacklog && time.Since(m.polled) < staleAfter*m.cfg.PollInterval
+}
+
+// Status is nil for a nil Monitor
+func (m *Monitor) Status() *Status {
+	if m == nil {
+		return nil
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s := &Status{Depth: m.depth, Limit: m.cfg.MaxBacklog, Full: m.fullLocked(), PolledAt: m.polled}
+	if m.err != nil {
+		s.Error = m.err.Error()
+	}
+	return s
+}
+
+// RetryAfter is how long refused clients are told to wait
+func (m *Monitor) RetryAfter() time.Duration {
+	return m.cfg.RetryAfter
+}
+
+// Middleware answers 503 with a Retry-After while the backlog is full
+func (m *Monitor) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !m.Full() {
+			c.Next()
+			return
+		}
+		metrics.UploadsShed.Inc()
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(m.cfg.RetryAfter.Seconds()))))
+		apierror.Abort(c, http.StatusServiceUnavailable, Message)
+	}
+}
+
+// Message is what refused uploads are told
+const Message = "Too many documents are waiting to be processed, try again later"
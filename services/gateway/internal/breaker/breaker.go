@@ -0,0 +1,151 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/metrics"
+)
+
+// ErrOpen is returned without calling the dependency while the breaker is open
+var ErrOpen = errors.New("circuit breaker is open")
+
+type State int
+
+const (
+	// Closed lets every call through
+	Closed State = iota
+	// Open fails every call straight away until the cooldown is over
+	Open
+	// HalfOpen lets a single trial call through, its outcome closes or reopens the breaker
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// Breaker stops calling a dependency after threshold failures in a row, so requests
+// fail fast while it is down instead of each one waiting out its own timeouts and retries.
+// A nil Breaker never opens.
+type Breaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+}
+
+// New returns a closed breaker, name shows up in errors, logs and the docstream_circuit_open metric
+func New(name string, threshold int, cooldown time.Duration) *Breaker {
+	metrics.CircuitOpen.WithLabelValues(name).Set(0)
+	return &Breaker{name: name, threshold: threshold, cooldown: cooldown}
+}
+
+// Do calls fn unless the breaker is open, counting its outcome
+func (b *Breaker) Do(fn func() error) error {
+	if b == nil {
+		return fn()
+	}
+	if err := b.allow(); err != nil {
+		return err
+	}
+	err := fn()
+	b.record(err)
+	return err
+}
+
+// Err is non-nil while calls would be refused, without taking up the half-open trial
+func (b *Breaker) Err() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == Open && time.Since(b.openedAt) < b.cooldown {
+		return b.openError()
+	}
+	return nil
+}
+
+// Reset closes the breaker, for when the dependency is known to be back (say after a reconnect)
+func (b *Breaker) Reset() {
+	if b == nil {
+		return
+	}
+	b.record(nil)
+}
+
+func (b *Breaker) State() State {
+	if b == nil {
+		return Closed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *Breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case Open:
+		if time.Since(b.openedAt) < b.cooldown {
+			return b.openError()
+		}
+		// cooled down, this call gets to find out whether the dependency is back
+		b.state = HalfOpen
+		return nil
+	case HalfOpen:
+		// the trial call is still running
+		return b.openError()
+	}
+	return nil
+}
+
+func (b *Breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case err == nil:
+		if b.state != Closed {
+			log.Printf("Circuit breaker %s closed\n", b.name)
+			metrics.CircuitOpen.WithLabelValues(b.name).Set(0)
+		}
+		b.state, b.failures = Closed, 0
+	case errors.Is(err, context.Canceled):
+		// the caller gave up, that says nothing about the dependency
+		if b.state == HalfOpen {
+			b.state = Open
+		}
+	default:
+		b.failures++
+		if b.state == HalfOpen || b.failures >= b.threshold {
+			if b.state != Open {
+				log.Printf("Circuit breaker %s opened after %d failures: %v\n", b.name, b.failures, err)
+				metrics.CircuitOpen.WithLabelValues(b.name).Set(1)
+			}
+			b.state, b.openedAt = Open, time.Now()
+		}
+	}
+}
+
+func (b *Breaker) openError() error {
+	return fmt.Errorf("%s: %w", b.name, ErrOpen)
+}
@@ -0,0 +1,1014 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is everything the gateway can be configured with. Load fills it in from,
+// lowest precedence first: the defaults, an optional YAML file, the environment and flags.
+type Config struct {
+	Port        string      `yaml:"port"`
+	GRPCPort    string      `yaml:"grpc_port"`    // optional, serves the gRPC API next to the REST one
+	MetricsAddr string      `yaml:"metrics_addr"` // where Prometheus scrapes /metrics, never the API port, empty turns it off
+	TLS         TLS         `yaml:"tls"`
+	CORS        CORS        `yaml:"cors"`
+	Database    Database    `yaml:"database"`
+	Storage     Storage     `yaml:"storage"`
+	Encryption  Encryption  `yaml:"encryption"`
+	RabbitMQURL string      `yaml:"rabbitmq_url"`
+	Queue       Queue       `yaml:"queue"`
+	RedisURL    string      `yaml:"redis_url"` // optional, shares rate limit buckets between replicas
+	JWT         JWT         `yaml:"jwt"`
+	RateLimits  RateLimits  `yaml:"rate_limits"`
+	Login       Login       `yaml:"login"`
+	Passwords   Passwords   `yaml:"passwords"`
+	Accounts    Accounts    `yaml:"accounts"`
+	OAuth       OAuth       `yaml:"oauth"`
+	Documents   Documents   `yaml:"documents"`
+	URLIngest   URLIngest   `yaml:"url_ingest"`
+	Email       Email       `yaml:"email"`
+	SMTP        SMTP        `yaml:"smtp"`
+	Connectors  Connectors  `yaml:"connectors"`
+	ClamAV      ClamAV      `yaml:"clamav"`
+	Embeddings  Embeddings  `yaml:"embeddings"`
+	VectorStore VectorStore `yaml:"vector_store"`
+	LLM         LLM         `yaml:"llm"`
+	Rerank      Rerank      `yaml:"rerank"`
+	Providers   Providers   `yaml:"providers"`
+
+	// KeywordSearch ranks chunk text by BM25, on its own or fused with the vectors' ranking
+	KeywordSearch KeywordSearch `yaml:"keyword_search"`
+	// Searches is the search history kept for each user and the saved search alerts
+	Searches Searches `yaml:"searches"`
+	// Billing is where the daily usage of every user goes, for Stripe or a billing system of your own
+	Billing Billing `yaml:"billing"`
+	// Stripe sells the plans as subscriptions, without a secret key plans only change by admins
+	Stripe Stripe `yaml:"stripe"`
+	// BucketEvents ingests the files other tools put into the bucket, announced by its notifications
+	BucketEvents BucketEvents `yaml:"bucket_events"`
+
+	// TrustedProxies are the addresses or CIDRs of the load balancers in front of the gateway, only
+	// their X-Forwarded-For is believed for the client IP. Empty trusts none and uses the peer's address.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+// TLS has the gateway serve HTTPS itself, HTTP/2 included, with a certificate from files or
+// one Let's Encrypt issues for AutocertDomains. Port is the HTTPS port then. Neither set
+// serves plain HTTP, for a reverse proxy terminating TLS in front.
+type TLS struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// AutocertDomains are the names certificates are requested for, Let's Encrypt has to reach
+	// the gateway under them on port 443, or on 80 when RedirectPort is 80
+	AutocertDomains  []string `yaml:"autocert_domains"`
+	AutocertEmail    string   `yaml:"autocert_email"`     // optional, told about expiring certificates
+	AutocertCacheDir string   `yaml:"autocert_cache_dir"` // keeps certificates across restarts
+	// AutocertDirectoryURL is the ACME server, Let's Encrypt's production one when empty
+	AutocertDirectoryURL string `yaml:"autocert_directory_url"`
+	// RedirectPort also listens for plain HTTP and sends it to HTTPS, "" doesn't
+	RedirectPort string `yaml:"redirect_port"`
+}
+
+// Enabled reports whether the gateway serves HTTPS
+func (t TLS) Enabled() bool { return t.CertFile != "" || len(t.AutocertDomains) > 0 }
+
+// CORS is which browser origins may call the API, the job progress WebSocket checks the same ones
+type CORS struct {
+	// Origins like https://app.example.com, https://*.example.com for its subdomains, or * for any
+	Origins []string `yaml:"origins"`
+	Methods []string `yaml:"methods"`
+	// Headers browsers may send on top of Content-Type, Authorization and the ones the gateway reads
+	Headers []string      `yaml:"headers"`
+	MaxAge  time.Duration `yaml:"max_age"` // how long browsers may cache a preflight
+}
+
+type Database struct {
+	Driver string `yaml:"driver"` // sqlite or postgres
+	URL    string `yaml:"url"`    // the SQLite file path or a Postgres connection string
+	// AutoMigrate applies pending migrations on startup. Turn it off to run
+	// `gateway migrate up` yourself, the gateway then refuses to start on an outdated schema.
+	AutoMigrate bool `yaml:"auto_migrate"`
+}
+
+// Storage is where uploaded objects live
+type Storage struct {
+	Backend string `yaml:"backend"` // minio, s3, gcs, azure or local
+	Bucket  string `yaml:"bucket"`
+	Minio   Minio  `yaml:"minio"`
+	S3      S3     `yaml:"s3"`
+	GCS     GCS    `yaml:"gcs"`
+	Azure   Azure  `yaml:"azure"`
+	// LocalRoot is the directory the local backend keeps its buckets in, for tests and single machine setups
+	LocalRoot string `yaml:"local_root"`
+}
+
+type Minio struct {
+	Endpoint  string `yaml:"endpoint"`
+	AccessKey string `yaml:"access_key"`
+	SecretKey string `yaml:"secret_key"`
+	UseSSL    bool   `yaml:"use_ssl"`
+}
+
+// S3 takes its credentials from the AWS default chain: the AWS_* variables, the shared
+// config files or the IAM role of the instance or pod
+type S3 struct {
+	Region string `yaml:"region"` // empty leaves it to AWS_REGION or the shared config
+	// Endpoint is only needed for S3 compatible services other than AWS itself
+	Endpoint     string `yaml:"endpoint"`
+	UsePathStyle bool   `yaml:"use_path_style"`
+}
+
+// GCS uses Application Default Credentials: GOOGLE_APPLICATION_CREDENTIALS or the
+// service account of the VM or pod. Presigning needs a key or iam.serviceAccounts.signBlob.
+type GCS struct {
+	ProjectID string `yaml:"project_id"` // only needed to create the bucket
+	// Endpoint points the client at an emulator such as fake-gcs-server
+	Endpoint string `yaml:"endpoint"`
+}
+
+// Azure authenticates with the account key when there is one, otherwise with the default
+// Entra ID chain (environment, managed identity, az login). Buckets are containers.
+type Azure struct {
+	Account string `yaml:"account"`
+	Key     string `yaml:"key"`
+	// Endpoint defaults to https://<account>.blob.core.windows.net/, set it for Azurite
+	Endpoint string `yaml:"endpoint"`
+}
+
+// Encryption seals every stored object with a data key of its own, wrapped by a master key
+// and kept next to the document. Without any key objects are stored as they are.
+type Encryption struct {
+	// Keys is "<kid>:<base64 of 32 random bytes>,...", the first one wraps new data keys
+	Keys string `yaml:"keys"`
+	// KMSKeyID is an AWS KMS key (ID, ARN or alias) that wraps new data keys instead, Keys then
+	// only unwrap older ones. Credentials come from the AWS default chain like S3's.
+	KMSKeyID  string `yaml:"kms_key_id"`
+	KMSRegion string `yaml:"kms_region"` // empty leaves it to AWS_REGION or the shared config
+	// KMSEndpoint is only needed for something other than AWS itself, like LocalStack
+	KMSEndpoint string `yaml:"kms_endpoint"`
+}
+
+// Queue is the message bus between the gateway and the workers, both have to use the same one
+type Queue struct {
+	Backend string `yaml:"backend"` // rabbitmq (at RabbitMQURL) or kafka
+	Kafka   Kafka  `yaml:"kafka"`
+	// ManagementURL is RabbitMQ's management API, for the queue depths in GET /admin/stats.
+	// Without credentials in it those of RabbitMQURL are used.
+	ManagementURL string       `yaml:"management_url"`
+	Backpressure  Backpressure `yaml:"backpressure"`
+}
+
+// Backpressure turns uploads away while more than MaxBacklog jobs wait for a worker, 0
+// doesn't limit the backlog. Only RabbitMQ can tell how long it is.
+type Backpressure struct {
+	MaxBacklog   int           `yaml:"max_backlog"`
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// RetryAfter is how long refused clients are told to wait
+	RetryAfter time.Duration `yaml:"retry_after"`
+}
+
+type Kafka struct {
+	Brokers []string `yaml:"brokers"`
+	// TopicPrefix goes in front of every topic and consumer group, so several deployments can share a cluster
+	TopicPrefix string `yaml:"topic_prefix"`
+	// Partitions and ReplicationFactor are used for topics that don't exist yet, -1 is the broker's default
+	Partitions        int    `yaml:"partitions"`
+	ReplicationFactor int    `yaml:"replication_factor"`
+	TLS               bool   `yaml:"tls"`
+	SASLMechanism     string `yaml:"sasl_mechanism"` // plain, scram-sha-256 or scram-sha-512, empty for none
+	SASLUsername      string `yaml:"sasl_username"`
+	SASLPassword      string `yaml:"sasl_password"`
+}
+
+type JWT struct {
+	Algorithm string `yaml:"algorithm"` // HS256 or RS256
+	// Keys is "<kid>:<secret or PEM path>,...", the first one signs
+	Keys string `yaml:"keys"`
+	// Secret is a single HS256 key, only used when Keys is empty
+	Secret string `yaml:"secret"`
+}
+
+// RateLimits are written as <requests>/<s|m|h>, "off" disables one
+type RateLimits struct {
+	IP      string `yaml:"ip"`
+	Uploads string `yaml:"uploads"`
+	Search  string `yaml:"search"`
+	Ask     string `yaml:"ask"`
+}
+
+type Login struct {
+	// BackoffAfter is how many failures it takes before each attempt has to wait
+	BackoffAfter     int           `yaml:"backoff_after"`
+	LockoutThreshold int           `yaml:"lockout_threshold"`
+	LockoutDuration  time.Duration `yaml:"lockout_duration"`
+}
+
+// Passwords is what a new password has to be
+type Passwords struct {
+	MinLength     int  `yaml:"min_length"`
+	RequireUpper  bool `yaml:"require_upper"`
+	RequireLower  bool `yaml:"require_lower"`
+	RequireDigit  bool `yaml:"require_digit"`
+	RequireSymbol bool `yaml:"require_symbol"`
+	// CheckBreached looks passwords up in Have I Been Pwned's Pwned Passwords, only the first
+	// 5 characters of their SHA-1 hash are sent. Signups still go through when it can't be reached.
+	CheckBreached bool          `yaml:"check_breached"`
+	BreachedURL   string        `yaml:"breached_url"` // the range API, a mirror of it works too
+	BreachTimeout time.Duration `yaml:"breach_timeout"`
+}
+
+// What happens to a user's audit entries when they delete their account
+const (
+	DeletionAuditKeep      = "keep"      // left as they are, tied to the account that's now anonymized
+	DeletionAuditAnonymize = "anonymize" // kept for the security record, without the user, their IP or email
+	DeletionAuditDelete    = "delete"    // removed
+)
+
+type Accounts struct {
+	// DeletionAudit is one of the DeletionAudit* policies
+	DeletionAudit string `yaml:"deletion_audit"`
+	// ExportTTL is how long a data export can be downloaded, its link is valid for all of it
+	ExportTTL time.Duration `yaml:"export_ttl"`
+}
+
+// OAuth providers are enabled when both their client ID and secret are set
+type OAuth struct {
+	// RedirectBaseURL is where the callbacks go, http://localhost:<port> when empty, or https://
+	// and the first autocert domain with TLS. Download links of encrypted documents point there too.
+	RedirectBaseURL    string `yaml:"redirect_base_url"`
+	GoogleClientID     string `yaml:"google_client_id"`
+	GoogleClientSecret string `yaml:"google_client_secret"`
+	GitHubClientID     string `yaml:"github_client_id"`
+	GitHubClientSecret string `yaml:"github_client_secret"`
+}
+
+type Documents struct {
+	MaxUploadSize Size `yaml:"max_upload_size"`
+	// AllowedTypes is checked against the sniffed contents, out of pdf, docx, pptx, xlsx, html, txt and md
+	AllowedTypes   []string      `yaml:"allowed_types"`
+	DownloadURLTTL time.Duration `yaml:"download_url_ttl"`
+	// UploadURLTTL is how long a presigned URL of POST /uploads/presign takes files
+	UploadURLTTL time.Duration `yaml:"upload_url_ttl"`
+	// Retention is how long a deleted document stays in the trash and can be restored, 0 purges right away
+	Retention time.Duration `yaml:"retention"`
+	// MaxBatchSize caps a whole batch upload, MaxBatchFiles how many files it may hold
+	// once its zip archives are unpacked. Every file still has to fit MaxUploadSize.
+	MaxBatchSize  Size `yaml:"max_batch_size"`
+	MaxBatchFiles int  `yaml:"max_batch_files"`
+	// MaxArchiveRatio is how many times its own size an archive POST /upload expands may unpack
+	// to, beyond that it is taken for a zip bomb. The batch limits apply to what it holds as well.
+	MaxArchiveRatio int `yaml:"max_archive_ratio"`
+}
+
+// URLIngest is how POST /ingest/url downloads documents, they still have to pass the upload limits
+type URLIngest struct {
+	Timeout      time.Duration `yaml:"timeout"`
+	MaxRedirects int           `yaml:"max_redirects"`
+	// AllowPrivate lets URLs reach loopback and private networks, only for setups where every user is trusted
+	AllowPrivate bool `yaml:"allow_private"`
+}
+
+// Email is the inbound SMTP listener, every user gets an address under Domain whose
+// attachments are uploaded for them. An empty Addr turns it off.
+type Email struct {
+	Addr           string `yaml:"addr"`
+	Domain         string `yaml:"domain"`
+	MaxMessageSize Size   `yaml:"max_message_size"`
+}
+
+// BucketEvents turns files dropped into the bucket under Prefix into documents, as the bucket's
+// object created notifications announce them: <prefix><user's email>/<any folders>/<file>. MinIO
+// sends them to the webhook (authenticated with WebhookToken) or, with Queue, through the broker.
+// An empty Prefix turns it off.
+type BucketEvents struct {
+	Prefix       string `yaml:"prefix"`
+	WebhookToken string `yaml:"webhook_token"`
+	Queue        bool   `yaml:"queue"`
+}
+
+// SMTP is the relay outgoing mail is sent through, like the link to a finished data export.
+// STARTTLS is used when the server offers it. An empty Addr turns mail off.
+type SMTP struct {
+	Addr     string `yaml:"addr"` // host:port
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from"`
+}
+
+// Connectors sync linked Google Drive and Dropbox folders. Drive uses the Google OAuth
+// client of the login, Dropbox needs an app of its own. Either is off without credentials.
+type Connectors struct {
+	SyncInterval     time.Duration `yaml:"sync_interval"`
+	DropboxAppKey    string        `yaml:"dropbox_app_key"`
+	DropboxAppSecret string        `yaml:"dropbox_app_secret"`
+}
+
+type ClamAV struct {
+	// Addr is host:port or unix:/path/to/clamd.sock, empty turns scanning off
+	Addr    string        `yaml:"addr"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+type Embeddings struct {
+	Provider   string `yaml:"provider"` // openai, ollama or tei, empty turns search off
+	Model      string `yaml:"model"`
+	MaxRetries int    `yaml:"max_retries"`
+	// LanguageModels is the worker's list of per-language models. Documents embedded with one
+	// of them are only found by searches filtered to that one language, which embed with it too.
+	LanguageModels map[string]string `yaml:"language_models"`
+}
+
+type VectorStore struct {
+	Kind       string `yaml:"kind"` // qdrant, empty turns search off
+	QdrantHost string `yaml:"qdrant_host"`
+	QdrantPort string `yaml:"qdrant_port"`
+	Collection string `yaml:"collection"`
+	APIKey     string `yaml:"api_key"`
+}
+
+// KeywordSearch picks where the chunks the worker sends with KEYWORD_SEARCH_ENABLED are indexed.
+// OpenSearch speaks the same API as Elasticsearch, use elasticsearch for it too.
+type KeywordSearch struct {
+	Kind     string `yaml:"kind"` // database or elasticsearch, empty turns keyword search off
+	URL      string `yaml:"url"`  // the Elasticsearch or OpenSearch cluster
+	Index    string `yaml:"index"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	APIKey   string `yaml:"api_key"` // sent as "Authorization: ApiKey", instead of a username
+}
+
+type Searches struct {
+	History int `yaml:"history"` // how many recent queries are kept per user, 0 keeps none
+	// AlertMinScore is the similarity a new document needs for a saved vector search to alert on
+	// it, any keyword match does. Hybrid searches alert on either.
+	AlertMinScore float64 `yaml:"alert_min_score"`
+}
+
+// Billing gets a usage.reported event for every user and organization with usage on a closed
+// day, signed with WebhookSecret like webhooks are. An empty WebhookURL sends none.
+type Billing struct {
+	WebhookURL    string `yaml:"webhook_url"`
+	WebhookSecret string `yaml:"webhook_secret"`
+}
+
+// Stripe turns subscriptions into plans. Prices maps each plan sold to the recurring Stripe price
+// it is sold at, checkouts return to SuccessURL or CancelURL, and the webhook at
+// POST /billing/stripe/webhook is verified with WebhookSecret.
+type Stripe struct {
+	SecretKey     string            `yaml:"secret_key"`
+	WebhookSecret string            `yaml:"webhook_secret"`
+	Prices        map[string]string `yaml:"prices"`
+	SuccessURL    string            `yaml:"success_url"`
+	CancelURL     string            `yaml:"cancel_url"`
+	APIURL        string            `yaml:"api_url"`
+}
+
+// Enabled reports whether plans are sold through Stripe
+func (s Stripe) Enabled() bool { return s.SecretKey != "" }
+
+type LLM struct {
+	Provider string `yaml:"provider"` // openai or ollama, empty turns /ask off
+	Model    string `yaml:"model"`
+}
+
+// Rerank scores the best candidates of /search and /ask again with a cross-encoder
+type Rerank struct {
+	Provider string `yaml:"provider"` // cohere or tei, empty turns reranking off
+	Model    string `yaml:"model"`
+	// URL is the rerank API, Cohere's when empty, or the text-embeddings-inference serving the model
+	URL    string `yaml:"url"`
+	APIKey string `yaml:"api_key"`
+	// Candidates is how many of the best hits are reranked, at least twice what a search returns
+	Candidates int `yaml:"candidates"`
+	// Default reranks the searches that don't say whether to
+	Default bool `yaml:"default"`
+}
+
+// Providers are the endpoints embeddings and the LLM share
+type Providers struct {
+	OpenAIAPIKey  string `yaml:"openai_api_key"`
+	OpenAIBaseURL string `yaml:"openai_base_url"`
+	OllamaURL     string `yaml:"ollama_url"`
+	TEIURL        string `yaml:"tei_url"`
+}
+
+// Default is the configuration before anything is loaded on top of it
+func Default() *Config {
+	return &Config{
+		MetricsAddr: "localhost:9464",
+		TLS:         TLS{AutocertCacheDir: "./data/autocert"},
+		CORS: CORS{
+			Origins: []string{"http://localhost:3000"}, // the frontend in development
+			Methods: []string{"POST", "GET", "OPTIONS", "PUT", "PATCH", "DELETE"},
+			MaxAge:  12 * time.Hour,
+		},
+		Database: Database{Driver: "sqlite", AutoMigrate: true},
+		Storage:  Storage{Backend: "minio", Bucket: "documents", LocalRoot: "./data/objects"},
+		Queue: Queue{
+			Backend:      "rabbitmq",
+			Kafka:        Kafka{TopicPrefix: "docstream.", Partitions: 6, ReplicationFactor: -1},
+			Backpressure: Backpressure{PollInterval: 5 * time.Second, RetryAfter: 30 * time.Second},
+		},
+		JWT: JWT{Algorithm: "HS256"},
+		RateLimits: RateLimits{
+			IP:      "100/m",
+			Uploads: "10/m",
+			Search:  "30/m",
+			Ask:     "10/m",
+		},
+		Login: Login{BackoffAfter: 3, LockoutThreshold: 10, LockoutDuration: 15 * time.Minute},
+		Passwords: Passwords{
+			MinLength:     8,
+			BreachedURL:   "https://api.pwnedpasswords.com/range/",
+			BreachTimeout: 3 * time.Second,
+		},
+		Accounts: Accounts{DeletionAudit: DeletionAuditAnonymize, ExportTTL: 72 * time.Hour},
+		Documents: Documents{
+			MaxUploadSize:   100 << 20,
+			AllowedTypes:    []string{"pdf", "docx", "pptx", "xlsx", "html", "txt", "md"},
+			DownloadURLTTL:  15 * time.Minute,
+			UploadURLTTL:    time.Hour,
+			MaxBatchSize:    1 << 30,
+			MaxBatchFiles:   100,
+			MaxArchiveRatio: 100,
+		},
+		URLIngest:   URLIngest{Timeout: time.Minute, MaxRedirects: 5},
+		Email:       Email{MaxMessageSize: 25 << 20},
+		Connectors:  Connectors{SyncInterval: 15 * time.Minute},
+		ClamAV:      ClamAV{Timeout: 2 * time.Minute},
+		Embeddings:  Embeddings{MaxRetries: 5},
+		Rerank:      Rerank{Candidates: 50},
+		VectorStore: VectorStore{QdrantHost: "localhost", QdrantPort: "6333", Collection: "documents"},
+		Providers: Providers{
+			OpenAIBaseURL: "https://api.openai.com/v1",
+			OllamaURL:     "http://localhost:11434",
+			TEIURL:        "http://localhost:8081",
+		},
+		KeywordSearch: KeywordSearch{URL: "http://localhost:9200", Index: "docstream-chunks"},
+		Searches:      Searches{History: 50, AlertMinScore: 0.75},
+		Stripe:        Stripe{APIURL: "https://api.stripe.com/v1"},
+	}
+}
+
+// Load builds the configuration from args (usually os.Args[1:]). -config, or
+// CONFIG_FILE, names a YAML file laid out like Config. Environment variables keep
+// the names they have always had, an empty one counts as unset.
+func Load(args []string) (*Config, error) {
+	cfg, _, err := load(args)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, cfg.Validate()
+}
+
+// LoadDatabase is Load for commands that only need the database, like migrate. It takes
+// the same flags but only checks the database settings, whatever follows the flags is returned.
+func LoadDatabase(args []string) (Database, []string, error) {
+	cfg, rest, err := load(args)
+	if err != nil {
+		return Database{}, nil, err
+	}
+
+	var errs []error
+	cfg.Database.validate(func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	})
+	return cfg.Database, rest, errors.Join(errs...)
+}
+
+func load(args []string) (*Config, []string, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet("gateway", flag.ContinueOnError)
+	path := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML config file")
+	port := fs.String("port", "", "port to listen on (API_GATEWAY_PORT)")
+	driver := fs.String("db-driver", "", "sqlite or postgres (DB_DRIVER)")
+	dsn := fs.String("database-url", "", "SQLite file or Postgres URL (DATABASE_URL)")
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if *path != "" {
+		if err := cfg.loadFile(*path); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := cfg.loadEnv(); err != nil {
+		return nil, nil, err
+	}
+
+	// only flags that were actually passed override anything
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "port":
+			cfg.Port = *port
+		case "db-driver":
+			cfg.Database.Driver = *driver
+		case "database-url":
+			cfg.Database.URL = *dsn
+		}
+	})
+
+	if cfg.Database.URL == "" && isSQLite(cfg.Database.Driver) {
+		cfg.Database.URL = "./data/auth.db"
+	}
+	if cfg.OAuth.RedirectBaseURL == "" {
+		cfg.OAuth.RedirectBaseURL = cfg.TLS.baseURL(cfg.Port)
+	}
+	cfg.OAuth.RedirectBaseURL = strings.TrimSuffix(cfg.OAuth.RedirectBaseURL, "/")
+
+	return cfg, fs.Args(), nil
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Config) loadEnv() error {
+	var e env
+	e.str(&c.Port, "API_GATEWAY_PORT")
+	e.str(&c.GRPCPort, "API_GATEWAY_GRPC_PORT")
+	e.str(&c.MetricsAddr, "METRICS_ADDR")
+	e.str(&c.TLS.CertFile, "TLS_CERT_FILE")
+	e.str(&c.TLS.KeyFile, "TLS_KEY_FILE")
+	e.list(&c.TLS.AutocertDomains, "TLS_AUTOCERT_DOMAINS")
+	e.str(&c.TLS.AutocertEmail, "TLS_AUTOCERT_EMAIL")
+	e.str(&c.TLS.AutocertCacheDir, "TLS_AUTOCERT_CACHE_DIR")
+	e.str(&c.TLS.AutocertDirectoryURL, "TLS_AUTOCERT_DIRECTORY_URL")
+	e.str(&c.TLS.RedirectPort, "TLS_REDIRECT_PORT")
+	e.list(&c.CORS.Origins, "CORS_ORIGINS")
+	e.list(&c.CORS.Methods, "CORS_METHODS")
+	e.list(&c.CORS.Headers, "CORS_HEADERS")
+	e.duration(&c.CORS.MaxAge, "CORS_MAX_AGE")
+	e.list(&c.TrustedProxies, "TRUSTED_PROXIES")
+	e.str(&c.Database.Driver, "DB_DRIVER")
+	e.str(&c.Database.URL, "DATABASE_URL")
+	e.bool(&c.Database.AutoMigrate, "DB_AUTO_MIGRATE")
+	e.str(&c.Storage.Backend, "STORAGE_BACKEND")
+	e.str(&c.Storage.Bucket, "MINIO_BUCKET_NAME")
+	e.str(&c.Storage.Bucket, "STORAGE_BUCKET") // the backend neutral name wins
+	e.str(&c.Storage.Minio.Endpoint, "MINIO_ENDPOINT")
+	e.str(&c.Storage.Minio.AccessKey, "MINIO_ACCESS_KEY")
+	e.str(&c.Storage.Minio.SecretKey, "MINIO_SECRET_KEY")
+	e.bool(&c.Storage.Minio.UseSSL, "MINIO_USE_SSL")
+	e.str(&c.Storage.S3.Region, "S3_REGION")
+	e.str(&c.Storage.S3.Endpoint, "S3_ENDPOINT")
+	e.bool(&c.Storage.S3.UsePathStyle, "S3_USE_PATH_STYLE")
+	e.str(&c.Storage.GCS.ProjectID, "GCS_PROJECT_ID")
+	e.str(&c.Storage.GCS.Endpoint, "GCS_ENDPOINT")
+	e.str(&c.Storage.Azure.Account, "AZURE_STORAGE_ACCOUNT")
+	e.str(&c.Storage.Azure.Key, "AZURE_STORAGE_KEY")
+	e.str(&c.Storage.Azure.Endpoint, "AZURE_STORAGE_ENDPOINT")
+	e.str(&c.Storage.LocalRoot, "STORAGE_LOCAL_ROOT")
+	e.str(&c.Encryption.Keys, "ENCRYPTION_KEYS")
+	e.str(&c.Encryption.KMSKeyID, "ENCRYPTION_KMS_KEY_ID")
+	e.str(&c.Encryption.KMSRegion, "ENCRYPTION_KMS_REGION")
+	e.str(&c.Encryption.KMSEndpoint, "ENCRYPTION_KMS_ENDPOINT")
+	e.str(&c.RabbitMQURL, "RABBITMQ_URL")
+	e.str(&c.Queue.Backend, "QUEUE_BACKEND")
+	e.str(&c.Queue.ManagementURL, "RABBITMQ_MANAGEMENT_URL")
+	e.int(&c.Queue.Backpressure.MaxBacklog, "UPLOAD_MAX_BACKLOG")
+	e.duration(&c.Queue.Backpressure.PollInterval, "UPLOAD_BACKLOG_POLL_INTERVAL")
+	e.duration(&c.Queue.Backpressure.RetryAfter, "UPLOAD_BACKLOG_RETRY_AFTER")
+	e.list(&c.Queue.Kafka.Brokers, "KAFKA_BROKERS")
+	e.str(&c.Queue.Kafka.TopicPrefix, "KAFKA_TOPIC_PREFIX")
+	e.int(&c.Queue.Kafka.Partitions, "KAFKA_PARTITIONS")
+	e.int(&c.Queue.Kafka.ReplicationFactor, "KAFKA_REPLICATION_FACTOR")
+	e.bool(&c.Queue.Kafka.TLS, "KAFKA_TLS")
+	e.str(&c.Queue.Kafka.SASLMechanism, "KAFKA_SASL_MECHANISM")
+	e.str(&c.Queue.Kafka.SASLUsername, "KAFKA_SASL_USERNAME")
+	e.str(&c.Queue.Kafka.SASLPassword, "KAFKA_SASL_PASSWORD")
+	e.str(&c.RedisURL, "REDIS_URL")
+
+	e.str(&c.JWT.Algorithm, "JWT_ALGORITHM")
+	e.str(&c.JWT.Keys, "JWT_KEYS")
+	e.str(&c.JWT.Secret, "JWT_SECRET")
+
+	e.str(&c.RateLimits.IP, "RATE_LIMIT_IP")
+	e.str(&c.RateLimits.Uploads, "RATE_LIMIT_UPLOADS")
+	e.str(&c.RateLimits.Search, "RATE_LIMIT_SEARCH")
+	e.str(&c.RateLimits.Ask, "RATE_LIMIT_ASK")
+
+	e.int(&c.Login.BackoffAfter, "LOGIN_BACKOFF_AFTER")
+	e.int(&c.Login.LockoutThreshold, "LOGIN_LOCKOUT_THRESHOLD")
+	e.duration(&c.Login.LockoutDuration, "LOGIN_LOCKOUT_DURATION")
+	e.int(&c.Passwords.MinLength, "PASSWORD_MIN_LENGTH")
+	e.bool(&c.Passwords.RequireUpper, "PASSWORD_REQUIRE_UPPER")
+	e.bool(&c.Passwords.RequireLower, "PASSWORD_REQUIRE_LOWER")
+	e.bool(&c.Passwords.RequireDigit, "PASSWORD_REQUIRE_DIGIT")
+	e.bool(&c.Passwords.RequireSymbol, "PASSWORD_REQUIRE_SYMBOL")
+	e.bool(&c.Passwords.CheckBreached, "PASSWORD_CHECK_BREACHED")
+	e.str(&c.Passwords.BreachedURL, "PASSWORD_BREACHED_URL")
+	e.duration(&c.Passwords.BreachTimeout, "PASSWORD_BREACH_TIMEOUT")
+	e.str(&c.Accounts.DeletionAudit, "ACCOUNT_DELETION_AUDIT")
+	e.duration(&c.Accounts.ExportTTL, "ACCOUNT_EXPORT_TTL")
+
+	e.str(&c.OAuth.RedirectBaseURL, "OAUTH_REDIRECT_BASE_URL")
+	e.str(&c.OAuth.GoogleClientID, "GOOGLE_CLIENT_ID")
+	e.str(&c.OAuth.GoogleClientSecret, "GOOGLE_CLIENT_SECRET")
+	e.str(&c.OAuth.GitHubClientID, "GITHUB_CLIENT_ID")
+	e.str(&c.OAuth.GitHubClientSecret, "GITHUB_CLIENT_SECRET")
+
+	e.size(&c.Documents.MaxUploadSize, "MAX_UPLOAD_SIZE")
+	e.list(&c.Documents.AllowedTypes, "ALLOWED_UPLOAD_TYPES")
+	e.duration(&c.Documents.DownloadURLTTL, "DOWNLOAD_URL_TTL")
+	e.duration(&c.Documents.UploadURLTTL, "UPLOAD_URL_TTL")
+	e.duration(&c.Documents.Retention, "DOCUMENT_RETENTION")
+	e.size(&c.Documents.MaxBatchSize, "MAX_BATCH_SIZE")
+	e.int(&c.Documents.MaxBatchFiles, "MAX_BATCH_FILES")
+	e.int(&c.Documents.MaxArchiveRatio, "MAX_ARCHIVE_RATIO")
+
+	e.duration(&c.URLIngest.Timeout, "URL_INGEST_TIMEOUT")
+	e.int(&c.URLIngest.MaxRedirects, "URL_INGEST_MAX_REDIRECTS")
+	e.bool(&c.URLIngest.AllowPrivate, "URL_INGEST_ALLOW_PRIVATE")
+
+	e.str(&c.Email.Addr, "INBOUND_EMAIL_ADDR")
+	e.str(&c.Email.Domain, "INBOUND_EMAIL_DOMAIN")
+	e.size(&c.Email.MaxMessageSize, "INBOUND_EMAIL_MAX_SIZE")
+	e.str(&c.BucketEvents.Prefix, "BUCKET_EVENTS_PREFIX")
+	e.str(&c.BucketEvents.WebhookToken, "BUCKET_EVENTS_WEBHOOK_TOKEN")
+	e.bool(&c.BucketEvents.Queue, "BUCKET_EVENTS_QUEUE")
+	e.str(&c.SMTP.Addr, "SMTP_ADDR")
+	e.str(&c.SMTP.Username, "SMTP_USERNAME")
+	e.str(&c.SMTP.Password, "SMTP_PASSWORD")
+	e.str(&c.SMTP.From, "SMTP_FROM")
+
+	e.duration(&c.Connectors.SyncInterval, "CONNECTOR_SYNC_INTERVAL")
+	e.str(&c.Connectors.DropboxAppKey, "DROPBOX_APP_KEY")
+	e.str(&c.Connectors.DropboxAppSecret, "DROPBOX_APP_SECRET")
+
+	e.str(&c.ClamAV.Addr, "CLAMAV_ADDR")
+	e.duration(&c.ClamAV.Timeout, "CLAMAV_TIMEOUT")
+
+	e.str(&c.Embeddings.Provider, "EMBEDDING_PROVIDER")
+	e.str(&c.Embeddings.Model, "EMBEDDING_MODEL")
+	e.int(&c.Embeddings.MaxRetries, "EMBEDDING_MAX_RETRIES")
+	e.pairs(&c.Embeddings.LanguageModels, "LANGUAGE_EMBEDDING_MODELS")
+
+	e.str(&c.VectorStore.Kind, "VECTOR_STORE")
+	e.str(&c.VectorStore.QdrantHost, "QDRANT_HOST")
+	e.str(&c.VectorStore.QdrantPort, "QDRANT_PORT")
+	e.str(&c.VectorStore.Collection, "COLLECTION_NAME")
+	e.str(&c.VectorStore.APIKey, "QDRANT_API_KEY")
+
+	e.str(&c.KeywordSearch.Kind, "KEYWORD_SEARCH")
+	e.str(&c.KeywordSearch.URL, "KEYWORD_SEARCH_URL")
+	e.str(&c.KeywordSearch.Index, "KEYWORD_SEARCH_INDEX")
+	e.str(&c.KeywordSearch.Username, "KEYWORD_SEARCH_USERNAME")
+	e.str(&c.KeywordSearch.Password, "KEYWORD_SEARCH_PASSWORD")
+	e.str(&c.KeywordSearch.APIKey, "KEYWORD_SEARCH_API_KEY")
+
+	e.int(&c.Searches.History, "SEARCH_HISTORY_SIZE")
+	e.float(&c.Searches.AlertMinScore, "SEARCH_ALERT_MIN_SCORE")
+
+	e.str(&c.Billing.WebhookURL, "BILLING_WEBHOOK_URL")
+	e.str(&c.Billing.WebhookSecret, "BILLING_WEBHOOK_SECRET")
+	e.str(&c.Stripe.SecretKey, "STRIPE_SECRET_KEY")
+	e.str(&c.Stripe.WebhookSecret, "STRIPE_WEBHOOK_SECRET")
+	e.pairs(&c.Stripe.Prices, "STRIPE_PRICES")
+	e.str(&c.Stripe.SuccessURL, "STRIPE_SUCCESS_URL")
+	e.str(&c.Stripe.CancelURL, "STRIPE_CANCEL_URL")
+	e.str(&c.Stripe.APIURL, "STRIPE_API_URL")
+
+	e.str(&c.LLM.Provider, "LLM_PROVIDER")
+	e.str(&c.LLM.Model, "LLM_MODEL")
+
+	e.str(&c.Rerank.Provider, "RERANK_PROVIDER")
+	e.str(&c.Rerank.Model, "RERANK_MODEL")
+	e.str(&c.Rerank.URL, "RERANK_URL")
+	e.str(&c.Rerank.APIKey, "RERANK_API_KEY")
+	e.int(&c.Rerank.Candidates, "RERANK_CANDIDATES")
+	e.bool(&c.Rerank.Default, "RERANK_BY_DEFAULT")
+
+	e.str(&c.Providers.OpenAIAPIKey, "OPENAI_API_KEY")
+	e.str(&c.Providers.OpenAIBaseURL, "OPENAI_BASE_URL")
+	e.str(&c.Providers.OllamaURL, "OLLAMA_URL")
+	e.str(&c.Providers.TEIURL, "TEI_URL")
+	return errors.Join(e.errs...)
+}
+
+// Validate reports every problem at once instead of the first one
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Port != "", "port is required (API_GATEWAY_PORT)")
+	c.TLS.validate(check, c.Port)
+	check(len(c.CORS.Methods) > 0, "at least one cors method has to be allowed (CORS_METHODS)")
+	check(c.CORS.MaxAge >= 0, "cors max_age can't be negative")
+	c.Database.validate(check)
+	c.Storage.validate(check)
+	check(c.Storage.Bucket != "", "storage bucket is required (STORAGE_BUCKET)")
+	c.Queue.validate(check, c.RabbitMQURL)
+
+	check(c.Login.BackoffAfter > 0, "login backoff_after must be at least 1")
+	check(c.Login.LockoutThreshold > 0, "login lockout_threshold must be at least 1")
+	check(c.Login.LockoutDuration > 0, "login lockout_duration must be positive")
+	// bcrypt refuses passwords past 72 bytes, a longer minimum would refuse them all
+	check(c.Passwords.MinLength >= 1 && c.Passwords.MinLength <= 72, "passwords min_length must be between 1 and 72")
+	check(!c.Passwords.CheckBreached || c.Passwords.BreachedURL != "", "passwords breached_url is required when check_breached is on")
+	check(c.Passwords.BreachTimeout > 0, "passwords breach_timeout must be positive")
+	switch c.Accounts.DeletionAudit {
+	case DeletionAuditKeep, DeletionAuditAnonymize, DeletionAuditDelete:
+	default:
+		check(false, "unknown account deletion_audit policy %q, use keep, anonymize or delete", c.Accounts.DeletionAudit)
+	}
+	// the link is presigned for the export's whole lifetime, S3 and MinIO stop at a week
+	check(c.Accounts.ExportTTL >= time.Hour && c.Accounts.ExportTTL <= 7*24*time.Hour, "account export ttl must be between 1h and 7 days")
+
+	check(c.Documents.MaxUploadSize > 0, "max upload size must be positive")
+	check(len(c.Documents.AllowedTypes) > 0, "at least one upload type has to be allowed")
+	// S3 and MinIO refuse to presign for longer than a week
+	check(c.Documents.DownloadURLTTL > 0 && c.Documents.DownloadURLTTL <= 7*24*time.Hour, "download url ttl must be between 1s and 7 days")
+	check(c.Documents.UploadURLTTL > 0 && c.Documents.UploadURLTTL <= 7*24*time.Hour, "upload url ttl must be between 1s and 7 days")
+	check(c.Documents.Retention >= 0, "document retention can't be negative")
+	check(c.Documents.MaxBatchSize >= c.Documents.MaxUploadSize, "max batch size can't be smaller than the max upload size")
+	check(c.Documents.MaxBatchFiles > 0, "max batch files must be positive")
+	check(c.Documents.MaxArchiveRatio >= 1, "max archive ratio must be at least 1")
+	check(c.URLIngest.Timeout > 0, "url ingest timeout must be positive")
+	check(c.URLIngest.MaxRedirects >= 0, "url ingest max_redirects can't be negative")
+	check(c.Email.Addr == "" || c.Email.Domain != "", "inbound email domain is required with a listen address (INBOUND_EMAIL_DOMAIN)")
+	check(c.Email.MaxMessageSize > 0, "inbound email max message size must be positive")
+	if b := c.BucketEvents; b.Prefix != "" || b.WebhookToken != "" || b.Queue {
+		// the gateway's own objects announce themselves too, they must not be taken for dropped files
+		check(strings.HasSuffix(b.Prefix, "/") && strings.Trim(b.Prefix, "/") != "", "bucket events prefix must be a folder like inbox/ (BUCKET_EVENTS_PREFIX)")
+		check(b.WebhookToken != "" || b.Queue, "bucket events need a webhook token or the queue (BUCKET_EVENTS_WEBHOOK_TOKEN or BUCKET_EVENTS_QUEUE)")
+	}
+	check(c.SMTP.Addr == "" || c.SMTP.From != "", "smtp from address is required with an smtp server (SMTP_FROM)")
+	check(c.Connectors.SyncInterval >= time.Minute, "connector sync interval must be at least 1m")
+	check(c.ClamAV.Timeout > 0, "clamav timeout must be positive")
+	check(c.Embeddings.MaxRetries >= 0, "embedding max_retries can't be negative")
+	for code, model := range c.Embeddings.LanguageModels {
+		check(isLanguageCode(code), "embedding language_models are keyed by ISO 639-1 code, not %q", code)
+		check(model != "", "embedding language_models needs a model for %q", code)
+	}
+	check(c.Rerank.Candidates >= 1 && c.Rerank.Candidates <= 1000, "rerank candidates must be between 1 and 1000")
+	check(c.Rerank.Provider != "" || !c.Rerank.Default, "rerank by default needs a rerank provider (RERANK_PROVIDER)")
+	switch c.KeywordSearch.Kind {
+	case "", "database":
+	case "elasticsearch":
+		check(c.KeywordSearch.URL != "", "keyword search url is required for elasticsearch (KEYWORD_SEARCH_URL)")
+		check(c.KeywordSearch.Index != "", "keyword search index is required for elasticsearch (KEYWORD_SEARCH_INDEX)")
+	default:
+		check(false, "unknown keyword search %q, use database or elasticsearch", c.KeywordSearch.Kind)
+	}
+	check(c.Searches.History >= 0 && c.Searches.History <= 1000, "search history size must be between 0 and 1000")
+	check(c.Searches.AlertMinScore >= 0 && c.Searches.AlertMinScore <= 1, "search alert min score must be between 0 and 1")
+	if c.Billing.WebhookURL != "" {
+		u, err := url.Parse(c.Billing.WebhookURL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "billing webhook url must be an absolute http(s) URL (BILLING_WEBHOOK_URL)")
+		check(c.Billing.WebhookSecret != "", "billing webhook secret is required with a billing webhook url (BILLING_WEBHOOK_SECRET)")
+	}
+	if c.Stripe.Enabled() {
+		check(c.Stripe.WebhookSecret != "", "stripe webhook secret is required with a stripe secret key (STRIPE_WEBHOOK_SECRET)")
+		check(len(c.Stripe.Prices) > 0, "stripe prices are required with a stripe secret key, like pro=price_123 (STRIPE_PRICES)")
+		for plan, price := range c.Stripe.Prices {
+			check(price != "", "stripe prices needs a price for the %s plan", plan)
+		}
+		check(isAbsoluteURL(c.Stripe.SuccessURL), "stripe success url must be an absolute http(s) URL (STRIPE_SUCCESS_URL)")
+		check(isAbsoluteURL(c.Stripe.CancelURL), "stripe cancel url must be an absolute http(s) URL (STRIPE_CANCEL_URL)")
+		check(isAbsoluteURL(c.Stripe.APIURL), "stripe api url must be an absolute http(s) URL (STRIPE_API_URL)")
+	}
+
+	return errors.Join(errs...)
+}
+
+func isSQLite(driver string) bool   { return driver == "sqlite" || driver == "sqlite3" }
+func isPostgres(driver string) bool { return driver == "postgres" || driver == "postgresql" }
+
+// IsPostgres reports whether the database is PostgreSQL rather than SQLite
+func (d Database) IsPostgres() bool { return isPostgres(d.Driver) }
+
+func (d Database) validate(check func(ok bool, format string, args ...any)) {
+	check(isSQLite(d.Driver) || isPostgres(d.Driver), "unknown database driver %q, use sqlite or postgres", d.Driver)
+	check(d.URL != "", "database url is required for postgres (DATABASE_URL)")
+}
+
+// baseURL is where the gateway is reached when nobody said, its first autocert domain over
+// HTTPS or localhost
+func (t TLS) baseURL(port string) string {
+	if !t.Enabled() {
+		return "http://localhost:" + port
+	}
+	host := "localhost"
+	if len(t.AutocertDomains) > 0 {
+		host = t.AutocertDomains[0]
+	}
+	if port == "443" {
+		return "https://" + host
+	}
+	return "https://" + host + ":" + port
+}
+
+func (t TLS) validate(check func(ok bool, format string, args ...any), port string) {
+	check((t.CertFile == "") == (t.KeyFile == ""), "tls cert_file and key_file go together (TLS_CERT_FILE, TLS_KEY_FILE)")
+	check(t.CertFile == "" || len(t.AutocertDomains) == 0, "tls takes a cert_file or autocert_domains, not both")
+	check(len(t.AutocertDomains) == 0 || t.AutocertCacheDir != "", "tls autocert_cache_dir is required with autocert_domains, Let's Encrypt limits how often a certificate is issued")
+	check(t.RedirectPort == "" || t.Enabled(), "tls redirect_port needs a certificate to redirect to (TLS_CERT_FILE or TLS_AUTOCERT_DOMAINS)")
+	check(t.RedirectPort == "" || t.RedirectPort != port, "tls redirect_port has to differ from the port")
+}
+
+func (s Storage) validate(check func(ok bool, format string, args ...any)) {
+	switch s.Backend {
+	case "minio":
+		check(s.Minio.Endpoint != "", "minio endpoint is required (MINIO_ENDPOINT)")
+	case "s3", "gcs":
+	case "azure":
+		check(s.Azure.Account != "", "azure storage account is required (AZURE_STORAGE_ACCOUNT)")
+	case "local":
+		check(s.LocalRoot != "", "local storage root is required (STORAGE_LOCAL_ROOT)")
+	default:
+		check(false, "unknown storage backend %q, use minio, s3, gcs, azure or local", s.Backend)
+	}
+}
+
+func (q Queue) validate(check func(ok bool, format string, args ...any), rabbitURL string) {
+	switch q.Backend {
+	case "rabbitmq":
+		check(rabbitURL != "", "rabbitmq url is required (RABBITMQ_URL)")
+		if q.ManagementURL != "" {
+			u, err := url.Parse(q.ManagementURL)
+			check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "rabbitmq management url must be an http(s) URL like http://localhost:15672")
+		}
+	case "kafka":
+		k := q.Kafka
+		check(len(k.Brokers) > 0, "kafka brokers are required (KAFKA_BROKERS)")
+		check(k.Partitions > 0, "kafka partitions must be at least 1")
+		check(k.ReplicationFactor == -1 || k.ReplicationFactor > 0, "kafka replication factor must be -1 or at least 1")
+		switch k.SASLMechanism {
+		case "":
+		case "plain", "scram-sha-256", "scram-sha-512":
+			check(k.SASLUsername != "", "kafka sasl username is required (KAFKA_SASL_USERNAME)")
+		default:
+			check(false, "unknown kafka sasl mechanism %q, use plain, scram-sha-256 or scram-sha-512", k.SASLMechanism)
+		}
+	default:
+		check(false, "unknown queue backend %q, use rabbitmq or kafka", q.Backend)
+	}
+
+	b := q.Backpressure
+	check(b.MaxBacklog >= 0, "upload max backlog can't be negative")
+	if b.MaxBacklog > 0 {
+		check(q.Backend == "rabbitmq", "upload backpressure needs the rabbitmq queue backend, unset UPLOAD_MAX_BACKLOG")
+		check(b.PollInterval >= time.Second, "upload backlog poll interval must be at least 1s")
+		check(b.RetryAfter >= time.Second, "upload backlog retry after must be at least 1s")
+	}
+}
+
+// env copies environment variables over the config, collecting the ones that don't parse
+type env struct {
+	errs []error
+}
+
+func (e *env) str(dst *string, name string) {
+	if v := os.Getenv(name); v != "" {
+		*dst = v
+	}
+}
+
+func (e *env) int(dst *int, name string) {
+	e.parse(name, func(v string) error {
+		n, err := strconv.Atoi(v)
+		*dst = n
+		return err
+	})
+}
+
+func (e *env) bool(dst *bool, name string) {
+	e.parse(name, func(v string) error {
+		b, err := strconv.ParseBool(v)
+		*dst = b
+		return err
+	})
+}
+
+func (e *env) float(dst *float64, name string) {
+	e.parse(name, func(v string) error {
+		f, err := strconv.ParseFloat(v, 64)
+		*dst = f
+		return err
+	})
+}
+
+func (e *env) duration(dst *time.Duration, name string) {
+	e.parse(name, func(v string) error {
+		d, err := time.ParseDuration(v)
+		*dst = d
+		return err
+	})
+}
+
+func (e *env) size(dst *Size, name string) {
+	e.parse(name, func(v string) error {
+		return dst.UnmarshalText([]byte(v))
+	})
+}
+
+func (e *env) list(dst *[]string, name string) {
+	e.parse(name, func(v string) error {
+		*dst = nil
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*dst = append(*dst, item)
+			}
+		}
+		return nil
+	})
+}
+
+// pairs reads "key=value,key=value"
+func (e *env) pairs(dst *map[string]string, name string) {
+	e.parse(name, func(v string) error {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			key, value, ok := strings.Cut(item, "=")
+			if !ok {
+				return fmt.Errorf("%q has no =", item)
+			}
+			if *dst == nil {
+				*dst = map[string]string{}
+			}
+			(*dst)[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+		return nil
+	})
+}
+
+// isAbsoluteURL accepts http and https URLs with a host
+func isAbsoluteURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// isLanguageCode accepts the two letter, lower case codes language detection hands out
+func isLanguageCode(code string) bool {
+	return len(code) == 2 && code[0] >= 'a' && code[0] <= 'z' && code[1] >= 'a' && code[1] <= 'z'
+}
+
+func (e *env) parse(name string, set func(string) error) {
+	v := strings.TrimSpace(os.Getenv(name))
+	if v == "" {
+		return
+	}
+	if err := set(v); err != nil {
+		e.errs = append(e.errs, fmt.Errorf("invalid %s %q", name, v))
+	}
+}
+
+// Size is a byte count, written as plain bytes or with a KB, MB or GB suffix (powers of 1024)
+type Size int64
+
+// ParseSize reads "100MB", "512KB" or "1048576"
+func ParseSize(s string) (Size, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix))
+			multiplier = unit.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return Size(n * multiplier), nil
+}
+
+// UnmarshalText lets YAML files and the environment use the suffixes too
+func (s *Size) UnmarshalText(text []byte) error {
+	size, err := ParseSize(string(text))
+	if err != nil {
+		return err
+	}
+	*s = size
+	return nil
+}
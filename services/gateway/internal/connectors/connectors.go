@@ -0,0 +1,117 @@
+// Package connectors links Google Drive and Dropbox accounts and keeps picked folders of them
+// synced into documents. A Syncer walks the folders of every due connector, downloading new
+// and changed files and handing them to an Ingester, which runs the normal upload pipeline.
+package connectors
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"golang.org/x/oauth2"
+)
+
+// Provider names, as stored on the connector and used in the callback URL
+const (
+	GoogleDrive = "google_drive"
+	Dropbox     = "dropbox"
+)
+
+// RemoteFile is a file found in a synced folder
+type RemoteFile struct {
+	ID   string
+	Name string
+	// Revision changes whenever the content does, it is what tells a changed file apart
+	Revision string
+	// Size is 0 when the provider doesn't know it up front, like for exported Google Docs
+	Size int64
+	// export is the type a Google Docs file is converted to on download
+	export string
+}
+
+// Provider is one cloud storage API, every call takes a client that adds the account's token
+type Provider interface {
+	OAuth() *oauth2.Config
+	// AuthCodeURL is where the user approves access, asking for a refresh token since syncs happen offline
+	AuthCodeURL(state string) string
+	// Account names the linked account, usually its email
+	Account(ctx context.Context, client *http.Client) (string, error)
+	// Folders lists the folders directly inside parent, "" is the top
+	Folders(ctx context.Context, client *http.Client, parent string) ([]models.ConnectorFolder, error)
+	// Files lists every file under the folder, subfolders included
+	Files(ctx context.Context, client *http.Client, folder string) ([]RemoteFile, error)
+	Download(ctx context.Context, client *http.Client, file RemoteFile) (io.ReadCloser, error)
+}
+
+// NewProviders sets up the providers that have credentials, callbacks go to
+// the redirect base URL + /connectors/callback/<provider>
+func NewProviders(oauth config.OAuth, cfg config.Connectors) map[string]Provider {
+	providers := map[string]Provider{}
+	callback := oauth.RedirectBaseURL + "/connectors/callback/"
+	if oauth.GoogleClientID != "" && oauth.GoogleClientSecret != "" {
+		providers[GoogleDrive] = newDrive(oauth.GoogleClientID, oauth.GoogleClientSecret, callback+GoogleDrive)
+	}
+	if cfg.DropboxAppKey != "" && cfg.DropboxAppSecret != "" {
+		providers[Dropbox] = newDropbox(cfg.DropboxAppKey, cfg.DropboxAppSecret, callback+Dropbox)
+	}
+	return providers
+}
+
+// Token is the connector's stored OAuth token
+func Token(conn models.Connector) *oauth2.Token {
+	return &oauth2.Token{AccessToken: conn.AccessToken, RefreshToken: conn.RefreshToken, Expiry: conn.TokenExpiry, TokenType: "Bearer"}
+}
+
+// SetToken stores a (possibly refreshed) token on the connector
+func SetToken(conn *models.Connector, token *oauth2.Token) {
+	conn.AccessToken = token.AccessToken
+	if token.RefreshToken != "" {
+		conn.RefreshToken = token.RefreshToken
+	}
+	conn.TokenExpiry = token.Expiry
+}
+
+// ErrUnauthorized means the account's access is gone, revoked or expired for good
+var ErrUnauthorized = errors.New("access to the account was revoked, link it again")
+
+// apiError is any other response a provider API didn't like
+type apiError struct {
+	Status int
+	Body   string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("provider answered %d: %s", e.Status, e.Body)
+}
+
+// do sends a request and decodes the JSON answer into out, nil out leaves the body open for the caller
+func do(client *http.Client, req *http.Request, out any) (*http.Response, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		var retrieve *oauth2.RetrieveError
+		if errors.As(err, &retrieve) {
+			// refreshing the token failed, the user revoked it or it expired
+			return nil, ErrUnauthorized
+		}
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		resp.Body.Close()
+		return nil, ErrUnauthorized
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, &apiError{Status: resp.StatusCode, Body: string(body)}
+	}
+	if out == nil {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	return resp, json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,139 @@
+package connectors
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/endpoints"
+)
+
+const (
+	dropboxAPI     = "https://api.dropboxapi.com/2"
+	dropboxContent = "https://content.dropboxapi.com/2"
+)
+
+type dropbox struct {
+	config *oauth2.Config
+}
+
+func newDropbox(key, secret, redirectURL string) *dropbox {
+	return &dropbox{config: &oauth2.Config{
+		ClientID:     key,
+		ClientSecret: secret,
+		Endpoint:     endpoints.Dropbox,
+		RedirectURL:  redirectURL,
+	}}
+}
+
+func (d *dropbox) OAuth() *oauth2.Config { return d.config }
+
+func (d *dropbox) AuthCodeURL(state string) string {
+	// short-lived access tokens only come with a refresh token when asked for offline access
+	return d.config.AuthCodeURL(state, oauth2.SetAuthURLParam("token_access_type", "offline"))
+}
+
+// rpc calls one of the JSON endpoints, they all take a POST
+func (d *dropbox) rpc(ctx context.Context, client *http.Client, endpoint string, args, out any) error {
+	body, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dropboxAPI+endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	_, err = do(client, req, out)
+	return err
+}
+
+func (d *dropbox) Account(ctx context.Context, client *http.Client) (string, error) {
+	var account struct {
+		Email string `json:"email"`
+	}
+	err := d.rpc(ctx, client, "/users/get_current_account", nil, &account)
+	return account.Email, err
+}
+
+type dropboxEntry struct {
+	Tag            string `json:".tag"`
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	Rev            string `json:"rev"`
+	ContentHash    string `json:"content_hash"`
+	Size           int64  `json:"size"`
+	IsDownloadable *bool  `json:"is_downloadable"`
+}
+
+// list walks a folder listing through all of its pages
+func (d *dropbox) list(ctx context.Context, client *http.Client, folder string, recursive bool, each func(dropboxEntry) bool) error {
+	var page struct {
+		Entries []dropboxEntry `json:"entries"`
+		Cursor  string         `json:"cursor"`
+		HasMore bool           `json:"has_more"`
+	}
+	// folder IDs ("id:...") work wherever a path does, the root is ""
+	args := map[string]any{"path": folder, "recursive": recursive, "limit": 2000}
+	if err := d.rpc(ctx, client, "/files/list_folder", args, &page); err != nil {
+		return err
+	}
+	for {
+		for _, entry := range page.Entries {
+			if !each(entry) {
+				return nil
+			}
+		}
+		if !page.HasMore {
+			return nil
+		}
+		cursor := page.Cursor
+		page.Entries = nil
+		if err := d.rpc(ctx, client, "/files/list_folder/continue", map[string]string{"cursor": cursor}, &page); err != nil {
+			return err
+		}
+	}
+}
+
+func (d *dropbox) Folders(ctx context.Context, client *http.Client, parent string) ([]models.ConnectorFolder, error) {
+	folders := []models.ConnectorFolder{}
+	err := d.list(ctx, client, parent, false, func(e dropboxEntry) bool {
+		if e.Tag == "folder" {
+			folders = append(folders, models.ConnectorFolder{ID: e.ID, Name: e.Name})
+		}
+		return true
+	})
+	return folders, err
+}
+
+func (d *dropbox) Files(ctx context.Context, client *http.Client, folder string) ([]RemoteFile, error) {
+	var files []RemoteFile
+	err := d.list(ctx, client, folder, true, func(e dropboxEntry) bool {
+		// Paper docs and the like can only be exported, not downloaded
+		if e.Tag == "file" && (e.IsDownloadable == nil || *e.IsDownloadable) {
+			// the content hash ignores renames and moves, the rev doesn't
+			files = append(files, RemoteFile{ID: e.ID, Name: e.Name, Revision: cmp.Or(e.ContentHash, e.Rev), Size: e.Size})
+		}
+		return len(files) < maxListedFiles
+	})
+	return files, err
+}
+
+func (d *dropbox) Download(ctx context.Context, client *http.Client, file RemoteFile) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dropboxContent+"/files/download", nil)
+	if err != nil {
+		return nil, err
+	}
+	arg, _ := json.Marshal(map[string]string{"path": file.ID})
+	req.Header.Set("Dropbox-API-Arg", string(arg))
+	resp, err := do(client, req, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
@@ -0,0 +1,249 @@
+package connectors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"golang.org/x/oauth2"
+)
+
+const (
+	dueBatch = 50
+	// a first sync of a big folder is spread over several rounds
+	maxFilesPerSync = 500
+	syncTimeout     = 30 * time.Minute
+)
+
+// Ingester takes a downloaded file in as a document of the connector's owner
+type Ingester interface {
+	// Ingest returns the new document's ID. It is "" when the content already was a document,
+	// which then isn't the connector's to replace. Files refused for what they are give a *Rejected.
+	Ingest(ctx context.Context, conn models.Connector, filename string, src io.ReadSeeker, size int64) (documentID string, err error)
+}
+
+// Rejected is a file that won't become a document, like one of a type the pipeline doesn't
+// read. It is remembered and not tried again until it changes.
+type Rejected struct {
+	Reason string
+}
+
+func (r *Rejected) Error() string { return r.Reason }
+
+// Syncer brings the files of connectors' folders in as documents
+type Syncer struct {
+	store     storage.Store
+	providers map[string]Provider
+	ingester  Ingester
+	// Interval is how long a connector waits between syncs
+	Interval time.Duration
+	maxSize  int64
+	// connector IDs being synced right now by this replica
+	running sync.Map
+}
+
+// NewSyncer syncs every connector each interval, files over maxSize are rejected without downloading all of them
+func NewSyncer(store storage.Store, providers map[string]Provider, ingester Ingester, interval time.Duration, maxSize int64) *Syncer {
+	return &Syncer{store: store, providers: providers, ingester: ingester, Interval: interval, maxSize: maxSize}
+}
+
+// SyncDue syncs the connectors that haven't synced for the interval, one after the other,
+// it is the sync_connectors schedule. Replicas share the work, each connector is claimed by
+// one of them per round.
+func (s *Syncer) SyncDue(ctx context.Context) (string, error) {
+	if len(s.providers) == 0 {
+		return "no connector providers configured", nil
+	}
+	due := time.Now().Add(-s.Interval)
+	conns, err := s.store.ListDueConnectors(ctx, due, dueBatch)
+	if err != nil {
+		return "", fmt.Errorf("listing due connectors: %w", err)
+	}
+
+	synced := 0
+	for _, conn := range conns {
+		if s.providers[conn.Provider] == nil {
+			// another replica may have the credentials
+			continue
+		}
+		claimed, err := s.store.ClaimConnectorSync(ctx, conn.ID, due)
+		if err != nil {
+			return "", fmt.Errorf("claiming connector %s: %w", conn.ID, err)
+		}
+		if claimed && s.run(ctx, conn) {
+			synced++
+		}
+	}
+	return fmt.Sprintf("synced %d connectors", synced), nil
+}
+
+// Start syncs the connector in the background right away, false if it is already syncing
+func (s *Syncer) Start(conn models.Connector) bool {
+	if _, busy := s.running.LoadOrStore(conn.ID, true); busy {
+		return false
+	}
+	go func() {
+		defer s.running.Delete(conn.ID)
+		s.sync(context.Background(), conn)
+	}()
+	return true
+}
+
+// run syncs in the caller's goroutine, skipping connectors a manual sync is already on
+func (s *Syncer) run(ctx context.Context, conn models.Connector) bool {
+	if _, busy := s.running.LoadOrStore(conn.ID, true); busy {
+		return false
+	}
+	defer s.running.Delete(conn.ID)
+	s.sync(ctx, conn)
+	return true
+}
+
+func (s *Syncer) sync(ctx context.Context, conn models.Connector) {
+	ctx, cancel := context.WithTimeout(ctx, syncTimeout)
+	defer cancel()
+
+	provider := s.providers[conn.Provider]
+	if provider == nil {
+		return
+	}
+	// the token source refreshes the access token as needed, the new one is saved below
+	tokens := provider.OAuth().TokenSource(ctx, Token(conn))
+	client := oauth2.NewClient(ctx, tokens)
+
+	taken, syncErr := s.syncFolders(ctx, client, provider, conn)
+	if syncErr != nil {
+		log.Printf("Sync of connector %s failed: %v\n", conn.ID, syncErr)
+	} else {
+		log.Printf("Synced connector %s, %d new or changed files\n", conn.ID, taken)
+	}
+
+	// re-read it, the folders may have been changed while this ran. A sync that timed out still gets saved.
+	ctx = context.WithoutCancel(ctx)
+	current, err := s.store.GetConnector(ctx, conn.ID, conn.UserID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return
+	} else if err != nil {
+		log.Println("Connector Lookup Error:", err)
+		return
+	}
+	if token, err := tokens.Token(); err == nil {
+		SetToken(&current, token)
+	}
+	current.Error = ""
+	if syncErr != nil {
+		current.Error = syncErr.Error()
+	}
+	if errors.Is(syncErr, ErrUnauthorized) {
+		// nothing syncs until the account is linked again
+		current.Status = models.ConnectorStatusError
+	}
+	if err := s.store.UpdateConnector(ctx, current); err != nil {
+		log.Println("Connector Update Error:", err)
+	}
+}
+
+// syncFolders takes in what is new or changed in every folder, returning how many files that was
+func (s *Syncer) syncFolders(ctx context.Context, client *http.Client, provider Provider, conn models.Connector) (int, error) {
+	taken := 0
+	for _, folder := range conn.Folders {
+		files, err := provider.Files(ctx, client, folder.ID)
+		if err != nil {
+			return taken, fmt.Errorf("listing %s: %w", folder.Name, err)
+		}
+		for _, file := range files {
+			// the same file turns up again when picked folders are inside each other
+			prev, err := s.store.GetConnectorFile(ctx, conn.ID, file.ID)
+			if err != nil && !errors.Is(err, storage.ErrNotFound) {
+				return taken, err
+			}
+			if err == nil && prev.Revision == file.Revision {
+				continue
+			}
+			if taken == maxFilesPerSync {
+				// the rest comes next round
+				return taken, nil
+			}
+			taken++
+			if err := s.syncFile(ctx, client, provider, conn, file, prev); err != nil {
+				return taken, fmt.Errorf("%s: %w", file.Name, err)
+			}
+		}
+	}
+	return taken, nil
+}
+
+// syncFile takes in one new or changed file. An error stops the whole sync, it means the
+// account, the provider or our own storage is in trouble, not just this file.
+func (s *Syncer) syncFile(ctx context.Context, client *http.Client, provider Provider, conn models.Connector, file RemoteFile, prev models.ConnectorFile) error {
+	record := models.ConnectorFile{ConnectorID: conn.ID, RemoteID: file.ID, Revision: file.Revision, DocumentID: prev.DocumentID}
+
+	documentID, err := s.take(ctx, client, provider, conn, file)
+	var rejected *Rejected
+	var refused *apiError
+	switch {
+	case errors.As(err, &rejected):
+		log.Printf("Connector %s skipped %s: %s\n", conn.ID, file.Name, rejected.Reason)
+		record.Error = rejected.Reason
+	case errors.As(err, &refused) && refused.Status != http.StatusTooManyRequests && refused.Status < 500:
+		// the provider won't hand out just this file, it is tried again next sync
+		log.Printf("Connector %s couldn't download %s: %v\n", conn.ID, file.Name, err)
+		record.Revision = prev.Revision
+		record.Error = err.Error()
+	case err != nil:
+		return err
+	default:
+		if prev.DocumentID != "" && documentID != "" && prev.DocumentID != documentID {
+			// the file changed, the document of its old content goes
+			if _, err := s.store.SoftDeleteDocument(ctx, prev.DocumentID, conn.UserID); err != nil && !errors.Is(err, storage.ErrNotFound) {
+				log.Println("Document Delete Error:", err)
+			}
+		}
+		if documentID != "" {
+			record.DocumentID = documentID
+		}
+	}
+	return s.store.SaveConnectorFile(ctx, record)
+}
+
+// take downloads the file to a temp file and ingests it from there
+func (s *Syncer) take(ctx context.Context, client *http.Client, provider Provider, conn models.Connector, file RemoteFile) (string, error) {
+	tooLarge := &Rejected{Reason: fmt.Sprintf("File is too large, the limit is %d bytes", s.maxSize)}
+	if file.Size > s.maxSize {
+		return "", tooLarge
+	}
+
+	body, err := provider.Download(ctx, client, file)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	tmp, err := os.CreateTemp("", "docstream-connector-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	// the listed size can be missing or stale, the limit is on what actually arrives
+	size, err := io.Copy(tmp, io.LimitReader(body, s.maxSize+1))
+	if err != nil {
+		return "", err
+	}
+	if size > s.maxSize {
+		return "", tooLarge
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return s.ingester.Ingest(ctx, conn, file.Name, tmp, size)
+}
@@ -0,0 +1,228 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/alerts"
+	"github.com/dhruvkshah75/docstream/gateway/internal/digest"
+	"github.com/dhruvkshah75/docstream/gateway/internal/events"
+	"github.com/dhruvkshah75/docstream/gateway/internal/keyword"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/notifier"
+	"github.com/dhruvkshah75/docstream/gateway/internal/queue"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/dhruvkshah75/docstream/gateway/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const retryDelay = 2 * time.Second
+
+// result mirrors the message the worker publishes
+type result struct {
+	JobID     string `json:"job_id"`
+	Status    string `json:"status"`
+	Stage     string `json:"stage"`
+	StageDone string `json:"stage_done"`
+	Error     string `json:"error"`
+	Language  string `json:"language"`
+	Class     string `json:"class"`
+	// Entities is nil when the worker didn't look for any, empty when it found none
+	Entities  []models.Entity `json:"entities"`
+	Summary   string          `json:"summary"`
+	KeyPoints []string        `json:"key_points"`
+	// Keywords is a batch of chunk text for the keyword index, sent while the job runs
+	Keywords *keywords `json:"keywords"`
+	// Usage is what processing took, sent with completed
+	Usage *usage `json:"usage"`
+}
+
+// usage is what a completed job consumed
+type usage struct {
+	Pages           int64 `json:"pages"`
+	EmbeddingTokens int64 `json:"embedding_tokens"`
+	LLMInputTokens  int64 `json:"llm_input_tokens"`
+	LLMOutputTokens int64 `json:"llm_output_tokens"`
+}
+
+// Store is what the consumer records results in
+type Store interface {
+	storage.JobStore
+	storage.UsageStore
+	storage.AuditStore
+}
+
+// keywords is a batch of chunks, the last one a job sends has Final set and no chunks
+type keywords struct {
+	keyword.Batch
+	Final bool `json:"final"`
+	Total int  `json:"total"` // how many chunks the document has now, on the last batch
+}
+
+// ConsumeResults listens for worker status updates and writes them to the jobs table.
+// It blocks forever, consuming again if the connection drops, so run it in its own goroutine.
+// keywords is the keyword index the chunks the worker sends go to, nil drops them. Documents
+// that finish processing are checked against the saved searches with alerts, and what their
+// jobs consumed is metered against the documents' owners. Every finished job goes into its
+// document's activity feed, and to its uploader by email or in their digest if they asked.
+func ConsumeResults(consumer queue.Consumer, store Store, keywords keyword.Index, notify *notifier.Notifier, mail *digest.Digest, emit *events.Publisher, alert *alerts.Alerts) {
+	for {
+		if err := consumeResults(consumer, store, keywords, notify, mail, emit, alert); err != nil {
+			log.Println("Results consumer error:", err)
+		}
+		// the broker connection is busy reconnecting, give it a moment
+		time.Sleep(retryDelay)
+	}
+}
+
+func consumeResults(consumer queue.Consumer, store Store, keywords keyword.Index, notify *notifier.Notifier, mail *digest.Digest, emit *events.Publisher, alert *alerts.Alerts) error {
+	deliveries, err := consumer.ConsumeResults(context.Background())
+	if err != nil {
+		return err
+	}
+
+	for d := range deliveries {
+		var res result
+		if err := json.Unmarshal(d.Body, &res); err != nil || res.JobID == "" {
+			log.Println("Invalid result payload, dropping:", string(d.Body))
+			d.Ack()
+			continue
+		}
+
+		// continue the trace the worker started for this job
+		ctx, span := tracing.StartConsumer(context.Background(), d.Headers, "apply result",
+			attribute.String("job.id", res.JobID), attribute.String("job.status", res.Status))
+		err := applyResult(ctx, store, keywords, notify, mail, emit, alert, res)
+		tracing.End(span, err)
+
+		if err != nil {
+			// keep it on the queue, the DB might just be busy
+			log.Printf("Failed to record result for %s: %v\n", res.JobID, err)
+			d.Nack(true)
+			continue
+		}
+		d.Ack()
+	}
+	return errors.New("results channel closed")
+}
+
+func applyResult(ctx context.Context, store Store, index keyword.Index, notify *notifier.Notifier, mail *digest.Digest, emit *events.Publisher, alert *alerts.Alerts, res result) error {
+	// chunk text isn't a status update, the job's status stays as it is
+	if res.Keywords != nil {
+		return applyKeywords(ctx, index, res.JobID, *res.Keywords)
+	}
+	errMsg := res.Error
+	if res.Stage != "" && errMsg != "" {
+		errMsg = res.Stage + ": " + errMsg
+	}
+
+	// stages are recorded once per job however often the worker reports them, a job it runs
+	// again after a crash only bumps their runs
+	if res.StageDone != "" {
+		if err := store.RecordJobStage(ctx, res.JobID, res.StageDone, models.JobStatusCompleted, ""); err != nil {
+			return err
+		}
+	} else if res.Stage != "" && res.Error != "" {
+		if err := store.RecordJobStage(ctx, res.JobID, res.Stage, models.JobStatusFailed, res.Error); err != nil {
+			return err
+		}
+	}
+
+	// before the status, so a redelivery after a failed write still records it
+	if res.Status == models.JobStatusCompleted && res.Language != "" {
+		if err := store.SetDocumentLanguage(ctx, res.JobID, res.Language); err != nil {
+			return err
+		}
+	}
+	if res.Status == models.JobStatusCompleted && res.Class != "" {
+		if err := store.SetDocumentClass(ctx, res.JobID, res.Class); err != nil {
+			return err
+		}
+	}
+	if res.Status == models.JobStatusCompleted && res.Summary != "" {
+		if err := store.SetDocumentSummary(ctx, res.JobID, res.Summary, res.KeyPoints); err != nil {
+			return err
+		}
+	}
+	if res.Status == models.JobStatusCompleted && res.Entities != nil {
+		if err := store.SetDocumentEntities(ctx, res.JobID, res.Entities); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+	}
+
+	// a cancelled job takes back the chunks it got into the keyword index, like its vectors
+	if res.Status == models.JobStatusCancelled && index != nil {
+		job, err := store.GetJobByID(ctx, res.JobID)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+		if err == nil && job.DocumentID != "" {
+			if err := index.DeleteJob(ctx, job.DocumentID, res.JobID); err != nil {
+				return err
+			}
+		}
+	}
+
+	// the store ignores updates to completed/failed jobs, so a late "processing" can't undo them
+	changed, err := store.UpdateJobStatus(ctx, res.JobID, res.Status, errMsg)
+	if err != nil || !changed {
+		return err
+	}
+
+	// only once the status changed, a redelivered result doesn't bill twice. A failure to meter
+	// doesn't hold the result up, the job is done either way.
+	if res.Status == models.JobStatusCompleted && res.Usage != nil {
+		err := store.AddJobUsage(ctx, res.JobID, models.Usage{
+			models.MetricPages:           res.Usage.Pages,
+			models.MetricEmbeddingTokens: res.Usage.EmbeddingTokens,
+			models.MetricLLMInputTokens:  res.Usage.LLMInputTokens,
+			models.MetricLLMOutputTokens: res.Usage.LLMOutputTokens,
+		})
+		if err != nil {
+			log.Printf("Failed to meter the usage of job %s: %v\n", res.JobID, err)
+		}
+	}
+
+	if res.Status == models.JobStatusCompleted || res.Status == models.JobStatusFailed {
+		job, err := store.GetJobByID(ctx, res.JobID)
+		if err != nil {
+			log.Printf("Failed to load job %s for notifications: %v\n", res.JobID, err)
+			return nil
+		}
+		notify.JobFinished(job)
+		mail.JobFinished(job)
+		if job.DocumentID != "" {
+			detail := fmt.Sprintf("job %s %s", job.ID, job.Status)
+			if job.Error != "" {
+				detail += ": " + job.Error
+			}
+			entry := models.AuditEntry{Event: models.AuditDocumentProcessed, DocumentID: job.DocumentID, Detail: detail}
+			if err := store.CreateAuditEntry(ctx, entry); err != nil {
+				log.Println("Failed to write audit entry:", err)
+			}
+		}
+		// only now, a client refetching the document on this event sees it finished
+		if job.Status == models.JobStatusCompleted {
+			emit.DocumentProcessed(job)
+			alert.DocumentProcessed(job)
+		}
+	}
+	return nil
+}
+
+// applyKeywords writes a batch of chunks to the keyword index. The last batch drops the chunks
+// earlier runs left behind, a document being reprocessed stays searchable by its old text until then.
+func applyKeywords(ctx context.Context, index keyword.Index, jobID string, batch keywords) error {
+	if index == nil || batch.DocumentID == "" {
+		return nil
+	}
+	if batch.Final {
+		return index.DeleteStale(ctx, batch.DocumentID, jobID, batch.Total)
+	}
+	batch.JobID = jobID
+	return index.Upsert(ctx, batch.Batch)
+}
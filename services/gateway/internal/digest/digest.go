@@ -0,0 +1,169 @@
+// Package digest emails users about their uploads finishing processing, straight away or
+// batched into one email a day, as their notification preferences ask.
+package digest
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/mailout"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+)
+
+const (
+	// notifyTimeout bounds sending or queueing one job's notification
+	notifyTimeout = time.Minute
+	// userBatch is how many users' digests are looked up at a time
+	userBatch = 100
+	// maxLines caps the jobs one digest lists, the rest are only counted
+	maxLines = 200
+)
+
+// footer tells the reader how to turn the emails off
+const footer = "\nChange these emails with preferences.notifications at PATCH /me.\n"
+
+// Digest sends the processing emails. Users choose instant, digest or none separately for
+// completions and failures, none being the default.
+type Digest struct {
+	store storage.Store
+	// mail is nil when the gateway sends no mail, nothing is sent or queued then
+	mail *mailout.Sender
+}
+
+// New sends through mail, nil turns the emails off
+func New(store storage.Store, mail *mailout.Sender) *Digest {
+	return &Digest{store: store, mail: mail}
+}
+
+// JobFinished emails the uploader of a job that completed or failed, or queues it for their
+// digest, in the background. Call it once the job is recorded finished.
+func (d *Digest) JobFinished(job models.Job) {
+	if d.mail == nil || job.UserID == nil {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		defer cancel()
+		if err := d.jobFinished(ctx, job, *job.UserID); err != nil {
+			log.Printf("Failed to notify user %d of job %s: %v\n", *job.UserID, job.ID, err)
+		}
+	}()
+}
+
+func (d *Digest) jobFinished(ctx context.Context, job models.Job, userID int) error {
+	user, err := d.store.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.DeletedAt != nil {
+		return nil
+	}
+
+	switch user.Preferences.Notify(job.Status) {
+	case models.NotifyInstant:
+		subject := "Processed: " + job.Filename
+		body := fmt.Sprintf("Your document %s finished processing.\n\nDocument: %s\nJob: %s\n", job.Filename, job.DocumentID, job.ID)
+		if job.Status == models.JobStatusFailed {
+			subject = "Processing failed: " + job.Filename
+			body = fmt.Sprintf("Your document %s failed to process: %s\n\nDocument: %s\nJob: %s\n\nReprocess it at POST /documents/%s/reprocess.\n",
+				job.Filename, job.Error, job.DocumentID, job.ID, job.DocumentID)
+		}
+		return d.mail.Send(ctx, user.Email, subject, body+footer)
+	case models.NotifyDigest:
+		return d.store.AddDigestItem(ctx, models.DigestItem{
+			UserID:     userID,
+			JobID:      job.ID,
+			DocumentID: job.DocumentID,
+			Status:     job.Status,
+			Error:      job.Error,
+		})
+	}
+	return nil
+}
+
+// Send emails every user with jobs waiting their digest, it is the send_digests schedule. Jobs
+// a user has since stopped wanting in their digest are dropped, a digest that couldn't be sent
+// is tried again next run.
+func (d *Digest) Send(ctx context.Context) (string, error) {
+	if d.mail == nil {
+		return "mail is off", nil
+	}
+
+	sent, failed, after := 0, 0, 0
+	for {
+		users, err := d.store.ListDigestUsers(ctx, after, userBatch)
+		if err != nil {
+			return "", fmt.Errorf("listing users after sending %d digests: %w", sent, err)
+		}
+		for _, userID := range users {
+			after = userID
+			ok, err := d.send(ctx, userID)
+			if err != nil {
+				log.Printf("Failed to send the digest of user %d: %v\n", userID, err)
+				failed++
+				continue
+			}
+			if ok {
+				sent++
+			}
+		}
+		if len(users) < userBatch {
+			break
+		}
+	}
+	if failed > 0 {
+		return "", fmt.Errorf("sent %d digests, %d failed", sent, failed)
+	}
+	return fmt.Sprintf("sent %d digests", sent), nil
+}
+
+// send emails one user's digest and clears the jobs in it, reporting whether there was anything to send
+func (d *Digest) send(ctx context.Context, userID int) (bool, error) {
+	items, err := d.store.ListDigestItems(ctx, userID)
+	if err != nil || len(items) == 0 {
+		return false, err
+	}
+	user, err := d.store.GetUserByID(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	var lines []string
+	completed, failed := 0, 0
+	for _, item := range items {
+		if user.DeletedAt != nil || user.Preferences.Notify(item.Status) != models.NotifyDigest {
+			continue
+		}
+		line := fmt.Sprintf("%s (%s) completed", item.Filename, item.DocumentID)
+		if item.Status == models.JobStatusFailed {
+			line = fmt.Sprintf("%s (%s) failed: %s", item.Filename, item.DocumentID, item.Error)
+			failed++
+		} else {
+			completed++
+		}
+		if len(lines) < maxLines {
+			lines = append(lines, line)
+		}
+	}
+
+	if total := completed + failed; total > 0 {
+		if total > len(lines) {
+			lines = append(lines, fmt.Sprintf("and %d more", total-len(lines)))
+		}
+		subject := fmt.Sprintf("Your DocStream digest: %d processed, %d failed", completed, failed)
+		body := fmt.Sprintf("Since your last digest %d of your documents finished processing and %d failed.\n\n%s\n",
+			completed, failed, strings.Join(lines, "\n"))
+		if err := d.mail.Send(ctx, user.Email, subject, body+footer); err != nil {
+			return false, err
+		}
+	}
+	// the digest went out, or nobody wants it anymore
+	if err := d.store.DeleteDigestItems(ctx, userID, items[len(items)-1].ID); err != nil {
+		return false, err
+	}
+	return completed+failed > 0, nil
+}
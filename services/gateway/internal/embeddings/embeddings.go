@@ -0,0 +1,70 @@
+package embeddings
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+)
+
+const defaultBatchSize = 32
+
+// Provider turns texts into vectors, one per text and in the same order
+type Provider interface {
+	Name() string
+	// DefaultModel is used when no specific model is asked for
+	DefaultModel() string
+	Embed(ctx context.Context, model string, texts []string) ([][]float32, error)
+}
+
+// New picks the provider named by cfg.Provider: "openai", "ollama" or "tei"
+// (HuggingFace text-embeddings-inference). It returns nil when that is empty,
+// which turns search off. It's a copy of the worker's providers, used to embed queries, so it
+// has to be set to the same provider and EMBEDDING_MODEL as the worker or queries won't match the index.
+func New(cfg config.Embeddings, providers config.Providers) (Provider, error) {
+	retry := retrier{maxRetries: cfg.MaxRetries}
+
+	switch cfg.Provider {
+	case "":
+		return nil, nil
+	case "openai":
+		if providers.OpenAIAPIKey == "" {
+			return nil, fmt.Errorf("OPENAI_API_KEY is required for the openai embedding provider")
+		}
+		return newOpenAI(providers.OpenAIBaseURL, providers.OpenAIAPIKey, orDefault(cfg.Model, "text-embedding-3-small"), retry), nil
+	case "ollama":
+		return newOllama(providers.OllamaURL, orDefault(cfg.Model, "nomic-embed-text"), retry), nil
+	case "tei":
+		return newTEI(providers.TEIURL, orDefault(cfg.Model, "all-MiniLM-L6-v2"), retry), nil
+	default:
+		return nil, fmt.Errorf("unknown EMBEDDING_PROVIDER %q, use openai, ollama or tei", cfg.Provider)
+	}
+}
+
+// EmbedAll embeds texts in batches of batchSize, keeping the order
+func EmbedAll(ctx context.Context, p Provider, model string, texts []string, batchSize int) ([][]float32, error) {
+	if batchSize < 1 {
+		batchSize = defaultBatchSize
+	}
+
+	vectors := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += batchSize {
+		end := min(start+batchSize, len(texts))
+		batch, err := p.Embed(ctx, model, texts[start:end])
+		if err != nil {
+			return nil, fmt.Errorf("embedding texts %d-%d: %w", start, end-1, err)
+		}
+		if len(batch) != end-start {
+			return nil, fmt.Errorf("%s returned %d vectors for %d texts", p.Name(), len(batch), end-start)
+		}
+		vectors = append(vectors, batch...)
+	}
+	return vectors, nil
+}
+
+func orDefault(v, fallback string) string {
+	if v != "" {
+		return v
+	}
+	return fallback
+}
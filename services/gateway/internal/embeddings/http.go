@@ -0,0 +1,113 @@
+package embeddings
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	retryBaseDelay = time.Second
+	retryMaxDelay  = time.Minute
+)
+
+// HTTPError is a non-2xx answer from a provider
+type HTTPError struct {
+	Status     int
+	Body       string
+	RetryAfter time.Duration // from the Retry-After header, 0 when absent
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("provider returned %d: %s", e.Status, e.Body)
+}
+
+// Retryable reports whether trying again can help: rate limits and server side trouble
+func (e *HTTPError) Retryable() bool {
+	return e.Status == http.StatusTooManyRequests || e.Status >= 500
+}
+
+// ErrUnsupportedModel is returned when a provider can't serve the requested model
+var ErrUnsupportedModel = errors.New("model not supported by this provider")
+
+// IsRetryable reports whether err is worth another attempt later, a
+// bad request or wrong credentials won't go away by themselves
+func IsRetryable(err error) bool {
+	if errors.Is(err, ErrUnsupportedModel) {
+		return false
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Retryable()
+	}
+	return true
+}
+
+// retrier sends requests again after rate limits and server errors, honouring Retry-After
+type retrier struct {
+	maxRetries int
+}
+
+var httpClient = &http.Client{Timeout: 2 * time.Minute}
+
+// postJSON sends body to url and decodes the JSON answer into out, retrying what is worth retrying
+func (r retrier) postJSON(ctx context.Context, url string, headers map[string]string, body, out any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := doPost(ctx, url, headers, payload, out)
+		if err == nil || !IsRetryable(err) || attempt >= r.maxRetries {
+			return err
+		}
+
+		delay := min(retryBaseDelay<<attempt, retryMaxDelay)
+		var httpErr *HTTPError
+		if errors.As(err, &httpErr) && httpErr.RetryAfter > 0 {
+			delay = min(httpErr.RetryAfter, retryMaxDelay)
+		}
+		log.Printf("Embedding request failed (%v), retrying in %s\n", err, delay)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+func doPost(ctx context.Context, url string, headers map[string]string, payload []byte, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		httpErr := &HTTPError{Status: resp.StatusCode, Body: string(bytes.TrimSpace(body))}
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+			httpErr.RetryAfter = time.Duration(secs) * time.Second
+		}
+		return httpErr
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,270 @@
+package envelope
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// An encrypted object is one or more segments, numbered from 1, each sealed on its own so
+// the parts of a multipart upload can be encrypted as they arrive:
+//
+//	segment = magic "DSE1" | segment number (uint32) | random nonce prefix (7 bytes) | frame...
+//	frame   = plaintext length (uint32, top bit set on the segment's last frame) | AES-256-GCM ciphertext
+//
+// Frames hold 64 KiB of plaintext except for the last one. A frame's nonce is the prefix,
+// its index and whether it is the last, and the segment header and length are authenticated
+// with it, so frames can't be reordered, dropped or cut short without Decrypt noticing.
+const (
+	magic     = "DSE1"
+	prefixLen = 7
+	headerLen = len(magic) + 4 + prefixLen
+	lengthLen = 4
+	tagLen    = 16
+	frameSize = 64 << 10
+	lastFrame = 1 << 31
+)
+
+// ErrCorrupt means an encrypted object doesn't decrypt, it was changed or isn't one
+var ErrCorrupt = errors.New("encrypted object is corrupt")
+
+// SealedSize is how many bytes size bytes of plaintext take up as one segment
+func SealedSize(size int64) int64 {
+	frames := (size + frameSize - 1) / frameSize
+	if frames == 0 {
+		// even nothing gets a frame, to mark the end
+		frames = 1
+	}
+	return int64(headerLen) + size + frames*(lengthLen+tagLen)
+}
+
+// PlainSize is SealedSize the other way round, how much plaintext a single segment object holds
+func PlainSize(sealed int64) int64 {
+	payload := sealed - int64(headerLen)
+	frames := (payload + lengthLen + frameSize + tagLen - 1) / (lengthLen + frameSize + tagLen)
+	return payload - frames*(lengthLen+tagLen)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func frameNonce(header []byte, index uint32, last bool) []byte {
+	nonce := make([]byte, 0, 12)
+	nonce = append(nonce, header[len(magic)+4:headerLen]...)
+	nonce = binary.BigEndian.AppendUint32(nonce, index)
+	if last {
+		return append(nonce, 1)
+	}
+	return append(nonce, 0)
+}
+
+func frameAAD(header, length []byte) []byte {
+	return append(append(make([]byte, 0, headerLen+lengthLen), header...), length...)
+}
+
+// Encrypt reads r and returns it sealed with key as the given segment, SealedSize bytes of it
+func Encrypt(r io.Reader, key []byte, segment int) (io.Reader, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, headerLen)
+	copy(header, magic)
+	binary.BigEndian.PutUint32(header[len(magic):], uint32(segment))
+	if _, err := rand.Read(header[len(magic)+4:]); err != nil {
+		return nil, err
+	}
+	return &sealer{
+		aead:   aead,
+		src:    bufio.NewReaderSize(r, frameSize),
+		header: header,
+		plain:  make([]byte, frameSize),
+		frame:  make([]byte, 0, lengthLen+frameSize+tagLen),
+		out:    header,
+	}, nil
+}
+
+type sealer struct {
+	aead   cipher.AEAD
+	src    *bufio.Reader
+	header []byte
+	plain  []byte
+	frame  []byte
+	// out is what hasn't been read yet of the header or the current frame
+	out   []byte
+	index uint32
+	done  bool
+}
+
+func (s *sealer) Read(p []byte) (int, error) {
+	for len(s.out) == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		if err := s.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, s.out)
+	s.out = s.out[n:]
+	return n, nil
+}
+
+// next seals the following frame, it's the last once the source runs dry
+func (s *sealer) next() error {
+	n, err := io.ReadFull(s.src, s.plain)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	last := err != nil
+	if !last {
+		if _, err := s.src.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	length := uint32(n)
+	if last {
+		length |= lastFrame
+	}
+	s.frame = binary.BigEndian.AppendUint32(s.frame[:0], length)
+	s.out = s.aead.Seal(s.frame, frameNonce(s.header, s.index, last), s.plain[:n], frameAAD(s.header, s.frame[:lengthLen]))
+	s.index++
+	s.done = last
+	return nil
+}
+
+// Decrypt reads an object Encrypt produced, its segments have to follow each other from 1.
+// size is the plaintext length it must come to, which catches whole segments cut off the end.
+func Decrypt(r io.Reader, key []byte, size int64) (io.Reader, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &opener{aead: aead, src: bufio.NewReaderSize(r, frameSize), frame: make([]byte, frameSize+tagLen), size: size}, nil
+}
+
+// frameAt is the frame of a single segment object that holds plaintext offset, and where it starts
+func frameAt(offset int64) (index uint32, start int64) {
+	index = uint32(offset / frameSize)
+	return index, int64(headerLen) + int64(index)*(lengthLen+frameSize+tagLen)
+}
+
+// decryptFrom picks up a single segment object at frame index, header is the segment's and r starts
+// where frameAt says. Plaintext comes out from the start of that frame.
+func decryptFrom(header []byte, r io.Reader, key []byte, size int64, index uint32) (io.Reader, error) {
+	if len(header) != headerLen || string(header[:len(magic)]) != magic || binary.BigEndian.Uint32(header[len(magic):]) != 1 {
+		return nil, fmt.Errorf("%w: segment 1 has no header", ErrCorrupt)
+	}
+	plain, err := Decrypt(r, key, size)
+	if err != nil {
+		return nil, err
+	}
+	o := plain.(*opener)
+	o.header, o.segment, o.index, o.total = header, 1, index, int64(index)*frameSize
+	return o, nil
+}
+
+type opener struct {
+	aead cipher.AEAD
+	src  *bufio.Reader
+	// header is the segment being read, nil between segments
+	header  []byte
+	segment uint32
+	index   uint32
+	frame   []byte
+	out     []byte
+	total   int64
+	size    int64
+	err     error
+}
+
+func (o *opener) Read(p []byte) (int, error) {
+	for len(o.out) == 0 {
+		if o.err != nil {
+			return 0, o.err
+		}
+		o.err = o.next()
+	}
+	n := copy(p, o.out)
+	o.out = o.out[n:]
+	return n, nil
+}
+
+// truncated turns running out of input halfway into ErrCorrupt, other read errors stay what they are
+func truncated(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("%w: it is cut short", ErrCorrupt)
+	}
+	return err
+}
+
+func (o *opener) next() error {
+	if o.header == nil {
+		// the object may only end between segments
+		if _, err := o.src.Peek(1); err == io.EOF {
+			if o.segment == 0 {
+				return fmt.Errorf("%w: it is empty", ErrCorrupt)
+			}
+			if o.total != o.size {
+				return fmt.Errorf("%w: it holds %d bytes instead of %d", ErrCorrupt, o.total, o.size)
+			}
+			return io.EOF
+		} else if err != nil {
+			return err
+		}
+
+		header := make([]byte, headerLen)
+		if _, err := io.ReadFull(o.src, header); err != nil {
+			return truncated(err)
+		}
+		if string(header[:len(magic)]) != magic {
+			return fmt.Errorf("%w: segment %d has no header", ErrCorrupt, o.segment+1)
+		}
+		if segment := binary.BigEndian.Uint32(header[len(magic):]); segment != o.segment+1 {
+			return fmt.Errorf("%w: segment %d follows segment %d", ErrCorrupt, segment, o.segment)
+		}
+		o.header = header
+		o.segment++
+		o.index = 0
+	}
+
+	length := make([]byte, lengthLen)
+	if _, err := io.ReadFull(o.src, length); err != nil {
+		return truncated(err)
+	}
+	n := binary.BigEndian.Uint32(length)
+	last := n&lastFrame != 0
+	n &^= lastFrame
+	if n > frameSize || (!last && n != frameSize) {
+		return fmt.Errorf("%w: frame %d of segment %d has a bad length", ErrCorrupt, o.index, o.segment)
+	}
+
+	sealed := o.frame[:n+tagLen]
+	if _, err := io.ReadFull(o.src, sealed); err != nil {
+		return truncated(err)
+	}
+	plain, err := o.aead.Open(sealed[:0], frameNonce(o.header, o.index, last), sealed, frameAAD(o.header, length))
+	if err != nil {
+		return fmt.Errorf("%w: frame %d of segment %d doesn't authenticate", ErrCorrupt, o.index, o.segment)
+	}
+	o.out = plain
+	o.total += int64(len(plain))
+	o.index++
+	if last {
+		o.header = nil
+	}
+	return nil
+}
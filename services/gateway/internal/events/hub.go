@@ -0,0 +1,143 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/queue"
+)
+
+const (
+	retryDelay = 2 * time.Second
+	// a slow client just misses events instead of stalling everyone else
+	subscriberBuffer = 16
+)
+
+// Event types, status and stage come from the worker, the rest from the gateway
+const (
+	TypeStatus            = "status"
+	TypeStage             = "stage"
+	TypeDocumentProcessed = "document.processed"
+	TypeQuotaWarning      = "quota.warning"
+	TypeExportFinished    = "export.finished"
+)
+
+// Event mirrors what the worker publishes, with the fields of the gateway's own events
+type Event struct {
+	JobID      string `json:"job_id,omitempty"`
+	UserID     int    `json:"user_id"`
+	Type       string `json:"type"`
+	Status     string `json:"status,omitempty"`
+	Stage      string `json:"stage,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DocumentID string `json:"document_id,omitempty"`
+	// Limit is the rate limit a quota warning is about, uploads, search or ask
+	Limit string `json:"limit,omitempty"`
+	// RetryAfter is how many seconds until the limit lets requests through again
+	RetryAfter int `json:"retry_after,omitempty"`
+	// ExportID is the data export an export.finished event is about
+	ExportID  string `json:"export_id,omitempty"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// Hub receives job events from the queue and fans them out to local subscribers.
+// Every gateway replica consumes all of them, not a share.
+type Hub struct {
+	mu    sync.RWMutex
+	jobs  map[string]map[chan Event]struct{}
+	users map[int]map[chan Event]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{jobs: map[string]map[chan Event]struct{}{}, users: map[int]map[chan Event]struct{}{}}
+}
+
+// Subscribe returns a channel of events for one job and a func to stop listening
+func (h *Hub) Subscribe(jobID string) (<-chan Event, func()) {
+	return subscribe(h, h.jobs, jobID)
+}
+
+// SubscribeUser returns a channel of every event for the user's jobs and documents, and their quota warnings
+func (h *Hub) SubscribeUser(userID int) (<-chan Event, func()) {
+	return subscribe(h, h.users, userID)
+}
+
+func subscribe[K comparable](h *Hub, subscribers map[K]map[chan Event]struct{}, key K) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	h.mu.Lock()
+	if subscribers[key] == nil {
+		subscribers[key] = map[chan Event]struct{}{}
+	}
+	subscribers[key][ch] = struct{}{}
+	h.mu.Unlock()
+
+	unsubscribe := func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := subscribers[key][ch]; !ok {
+			return
+		}
+		delete(subscribers[key], ch)
+		if len(subscribers[key]) == 0 {
+			delete(subscribers, key)
+		}
+		close(ch)
+	}
+	return ch, unsubscribe
+}
+
+// Publish hands an event to everyone watching its job and everyone watching its user
+func (h *Hub) Publish(event Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for ch := range h.jobs[event.JobID] {
+		send(ch, event)
+	}
+	// anonymous uploads have user 0, nobody can subscribe as them
+	if event.UserID != 0 {
+		for ch := range h.users[event.UserID] {
+			send(ch, event)
+		}
+	}
+}
+
+func send(ch chan Event, event Event) {
+	select {
+	case ch <- event:
+	default:
+		log.Printf("Dropping %s event for slow subscriber of user %d, job %q\n", event.Type, event.UserID, event.JobID)
+	}
+}
+
+// Run consumes the events forever, starting over after connection drops.
+// Run it in its own goroutine.
+func (h *Hub) Run(consumer queue.Consumer) {
+	for {
+		if err := h.consume(consumer); err != nil {
+			log.Println("Events consumer error:", err)
+		}
+		time.Sleep(retryDelay)
+	}
+}
+
+func (h *Hub) consume(consumer queue.Consumer) error {
+	deliveries, err := consumer.ConsumeEvents(context.Background())
+	if err != nil {
+		return err
+	}
+
+	for d := range deliveries {
+		var event Event
+		if err := json.Unmarshal(d.Body, &event); err != nil || (event.JobID == "" && event.UserID == 0) {
+			continue
+		}
+		h.Publish(event)
+	}
+	return errors.New("events channel closed")
+}
@@ -0,0 +1,103 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/queue"
+)
+
+const (
+	publishTimeout = 5 * time.Second
+	// one warning per user and limit in this long, a client hammering a full bucket
+	// would otherwise get one for every request turned down
+	quotaWarningEvery = time.Minute
+	// past this many remembered warnings the stale ones are swept out
+	maxWarned = 1024
+)
+
+// Publisher sends the gateway's own events through the bus rather than straight to the Hub,
+// the user's event stream may be connected to another replica
+type Publisher struct {
+	bus queue.Publisher
+
+	mu     sync.Mutex
+	warned map[string]time.Time
+}
+
+func NewPublisher(bus queue.Publisher) *Publisher {
+	return &Publisher{bus: bus, warned: map[string]time.Time{}}
+}
+
+// DocumentProcessed announces that a job's document can be searched, call it once its status is recorded
+func (p *Publisher) DocumentProcessed(job models.Job) {
+	// anonymous uploads have nobody to tell
+	if job.UserID == nil {
+		return
+	}
+	p.publish("job."+job.ID, Event{
+		JobID:      job.ID,
+		UserID:     *job.UserID,
+		Type:       TypeDocumentProcessed,
+		Status:     job.Status,
+		DocumentID: job.DocumentID,
+	})
+}
+
+// QuotaWarning tells a user that one of their rate limits turned a request down
+func (p *Publisher) QuotaWarning(userID int, limit string, retryAfter time.Duration) {
+	key := strconv.Itoa(userID) + ":" + limit
+	now := time.Now()
+
+	p.mu.Lock()
+	if now.Sub(p.warned[key]) < quotaWarningEvery {
+		p.mu.Unlock()
+		return
+	}
+	if len(p.warned) >= maxWarned {
+		for k, at := range p.warned {
+			if now.Sub(at) >= quotaWarningEvery {
+				delete(p.warned, k)
+			}
+		}
+	}
+	p.warned[key] = now
+	p.mu.Unlock()
+
+	p.publish("user."+strconv.Itoa(userID), Event{
+		UserID:     userID,
+		Type:       TypeQuotaWarning,
+		Limit:      limit,
+		RetryAfter: int(math.Ceil(retryAfter.Seconds())),
+	})
+}
+
+// ExportFinished tells a user their data export is ready to download, or that building it failed
+func (p *Publisher) ExportFinished(exp models.Export) {
+	p.publish("user."+strconv.Itoa(exp.UserID), Event{
+		UserID:   exp.UserID,
+		Type:     TypeExportFinished,
+		Status:   exp.Status,
+		Error:    exp.Error,
+		ExportID: exp.ID,
+	})
+}
+
+// publish is best effort like the worker's events, the request that caused one doesn't wait on the broker
+func (p *Publisher) publish(key string, event Event) {
+	event.Timestamp = time.Now().Unix()
+	body, _ := json.Marshal(event)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+		defer cancel()
+		if err := p.bus.PublishEvent(ctx, key, body); err != nil {
+			log.Printf("Failed to publish %s event: %v\n", event.Type, err)
+		}
+	}()
+}
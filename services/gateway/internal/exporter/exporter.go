@@ -0,0 +1,420 @@
+// Package exporter builds the data exports of POST /me/export: one zip with the account's
+// profile, what it set up, the list of its documents, their original files and the text
+// extracted from them. The zip goes to the storage bucket and is removed again once the
+// link to it expires.
+package exporter
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/envelope"
+	"github.com/dhruvkshah75/docstream/gateway/internal/events"
+	"github.com/dhruvkshah75/docstream/gateway/internal/mailout"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/objectstore"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/dhruvkshah75/docstream/gateway/internal/vectorstore"
+)
+
+const (
+	batch = 100
+	// a build running this long is taken to have died with its gateway and started over
+	staleAfter = time.Hour
+	// exports live next to the documents, under their owner's ID
+	prefix = "exports/"
+)
+
+const readme = `This is everything DocStream keeps about your account.
+
+profile.json    your account, organizations, sessions, API keys, webhooks, connectors, inbox,
+                saved searches and search history
+documents.json  every document you uploaded, with its tags and metadata
+chats.json      your chats about your documents, with every question and answer
+files/          the documents as you uploaded them, the latest version of each
+text/           the text extracted from each document, where it was indexed for search
+avatar.*        your profile picture, if you set one
+
+Secrets like passwords, API keys and webhook signing secrets are never included.
+`
+
+// Exporter builds exports and cleans up after them
+type Exporter struct {
+	store   storage.Store
+	objects objectstore.Store
+	keys    *envelope.Keyring
+	// index is where the extracted text is recovered from, nil leaves text/ out
+	index vectorstore.Store
+	// mail sends the link once an export is ready, nil only announces it on the event stream
+	mail   *mailout.Sender
+	events *events.Publisher
+	bucket string
+	// TTL is how long a finished export can be downloaded
+	TTL time.Duration
+}
+
+func New(store storage.Store, objects objectstore.Store, keys *envelope.Keyring, index vectorstore.Store, mail *mailout.Sender, publisher *events.Publisher, bucket string, ttl time.Duration) *Exporter {
+	return &Exporter{store: store, objects: objects, keys: keys, index: index, mail: mail, events: publisher, bucket: bucket, TTL: ttl}
+}
+
+// Link is a presigned URL for a completed export, valid until it expires
+func (e *Exporter) Link(ctx context.Context, exp models.Export) (string, error) {
+	expiry := e.TTL
+	if exp.ExpiresAt != nil {
+		expiry = time.Until(*exp.ExpiresAt)
+	}
+	if expiry <= 0 {
+		return "", errors.New("export expired")
+	}
+	u, err := e.objects.Presign(ctx, e.bucket, exp.ObjectKey, expiry, "docstream-export-"+exp.ID+".zip")
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// Start builds an export in the background, the process_exports schedule picks it up if this
+// gateway goes away first
+func (e *Exporter) Start(exp models.Export) {
+	go func() {
+		if err := e.Run(context.Background(), exp); err != nil {
+			log.Printf("Failed to build export %s: %v\n", exp.ID, err)
+		}
+	}()
+}
+
+// Run claims an export and builds it. An export someone else is building already is left alone.
+func (e *Exporter) Run(ctx context.Context, exp models.Export) error {
+	ok, err := e.store.ClaimExport(ctx, exp.ID, time.Now().Add(-staleAfter))
+	if err != nil || !ok {
+		return err
+	}
+
+	size, key, buildErr := e.build(ctx, exp)
+	now := time.Now().UTC()
+	exp.FinishedAt = &now
+	if buildErr != nil {
+		exp.Status, exp.Error = models.ExportStatusFailed, buildErr.Error()
+	} else {
+		expires := now.Add(e.TTL)
+		exp.Status, exp.ObjectKey, exp.Size, exp.ExpiresAt = models.ExportStatusCompleted, key, size, &expires
+	}
+	if err := e.store.FinishExport(ctx, exp); err != nil {
+		if key != "" {
+			// the account was deleted while this was building, or the row can't be saved
+			e.objects.Delete(ctx, e.bucket, key)
+		}
+		return err
+	}
+	e.events.ExportFinished(exp)
+	if buildErr != nil {
+		return buildErr
+	}
+	e.notify(ctx, exp)
+	return nil
+}
+
+// notify emails the link, best effort: it can still be fetched at GET /me/exports/:id
+func (e *Exporter) notify(ctx context.Context, exp models.Export) {
+	if e.mail == nil {
+		return
+	}
+	user, err := e.store.GetUserByID(ctx, exp.UserID)
+	if err != nil {
+		log.Printf("Failed to load the owner of export %s: %v\n", exp.ID, err)
+		return
+	}
+	link, err := e.Link(ctx, exp)
+	if err != nil {
+		log.Printf("Failed to sign the link to export %s: %v\n", exp.ID, err)
+		return
+	}
+	body := fmt.Sprintf("Your DocStream data export is ready, %d bytes zipped.\n\nDownload it here until %s:\n%s\n\nIf you didn't ask for it, change your password and log out your other sessions.\n",
+		exp.Size, exp.ExpiresAt.Format(time.RFC1123), link)
+	if err := e.mail.Send(ctx, user.Email, "Your DocStream data export is ready", body); err != nil {
+		log.Printf("Failed to email export %s: %v\n", exp.ID, err)
+	}
+}
+
+// Process builds exports nobody has got to and removes expired ones, it is the process_exports
+// schedule. POST /me/export starts its export straight away, this retries those that didn't finish.
+func (e *Exporter) Process(ctx context.Context) (string, error) {
+	pending, err := e.store.ListPendingExports(ctx, time.Now().Add(-staleAfter), batch)
+	if err != nil {
+		return "", fmt.Errorf("listing pending exports: %w", err)
+	}
+	built, failed := 0, 0
+	for _, exp := range pending {
+		if err := e.Run(ctx, exp); err != nil {
+			log.Printf("Failed to build export %s: %v\n", exp.ID, err)
+			failed++
+			continue
+		}
+		built++
+	}
+
+	expired, err := e.store.ListExpiredExports(ctx, time.Now(), batch)
+	if err != nil {
+		return "", fmt.Errorf("listing expired exports: %w", err)
+	}
+	for _, exp := range expired {
+		if err := e.objects.Delete(ctx, e.bucket, exp.ObjectKey); err != nil {
+			log.Printf("Failed to remove export %s: %v\n", exp.ID, err)
+			failed++
+			continue
+		}
+		exp.Status, exp.ObjectKey = models.ExportStatusExpired, ""
+		if err := e.store.FinishExport(ctx, exp); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return "", err
+		}
+	}
+	if failed > 0 {
+		return "", fmt.Errorf("built %d exports and removed %d, %d failed", built, len(expired), failed)
+	}
+	return fmt.Sprintf("built %d exports and removed %d", built, len(expired)), nil
+}
+
+// build writes the zip to a temporary file and stores it, returning its size and key
+func (e *Exporter) build(ctx context.Context, exp models.Export) (int64, string, error) {
+	user, err := e.store.GetUserByID(ctx, exp.UserID)
+	if err != nil {
+		return 0, "", fmt.Errorf("loading user: %w", err)
+	}
+	if user.DeletedAt != nil {
+		return 0, "", errors.New("account deleted")
+	}
+
+	tmp, err := os.CreateTemp("", "export-*.zip")
+	if err != nil {
+		return 0, "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	z := zip.NewWriter(tmp)
+	if err := e.write(ctx, z, user); err != nil {
+		return 0, "", err
+	}
+	if err := z.Close(); err != nil {
+		return 0, "", err
+	}
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, "", err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return 0, "", err
+	}
+
+	key := prefix + strconv.Itoa(user.ID) + "/" + exp.ID + ".zip"
+	if _, err := e.objects.Put(ctx, e.bucket, key, tmp, size, "application/zip"); err != nil {
+		return 0, "", fmt.Errorf("storing export: %w", err)
+	}
+	return size, key, nil
+}
+
+// profile is profile.json, what the account is and what it set up
+type profile struct {
+	User          models.User           `json:"user"`
+	Organizations []models.Organization `json:"organizations"`
+	Collections   []models.Collection   `json:"collections"`
+	Sessions      []models.Session      `json:"sessions"`
+	APIKeys       []models.APIKey       `json:"api_keys"`
+	Webhooks      []models.Webhook      `json:"webhooks"`
+	Connectors    []models.Connector    `json:"connectors"`
+	Inbox         *models.Inbox         `json:"inbox,omitempty"`
+	SavedSearches []models.SavedSearch  `json:"saved_searches"`
+	SearchHistory []models.RecentSearch `json:"search_history"`
+}
+
+func (e *Exporter) write(ctx context.Context, z *zip.Writer, user models.User) error {
+	if err := writeFile(z, "README.txt", strings.NewReader(readme)); err != nil {
+		return err
+	}
+
+	p := profile{User: user}
+	var err error
+	if p.Organizations, err = e.store.ListOrgs(ctx, user.ID); err != nil {
+		return fmt.Errorf("listing organizations: %w", err)
+	}
+	if p.Collections, err = e.store.ListCollections(ctx, user.ID, ""); err != nil {
+		return fmt.Errorf("listing collections: %w", err)
+	}
+	if p.Sessions, err = e.store.ListSessions(ctx, user.ID); err != nil {
+		return fmt.Errorf("listing sessions: %w", err)
+	}
+	if p.APIKeys, err = e.store.ListAPIKeys(ctx, user.ID); err != nil {
+		return fmt.Errorf("listing API keys: %w", err)
+	}
+	if p.Webhooks, err = e.store.ListWebhooks(ctx, user.ID); err != nil {
+		return fmt.Errorf("listing webhooks: %w", err)
+	}
+	if p.Connectors, err = e.store.ListConnectors(ctx, user.ID); err != nil {
+		return fmt.Errorf("listing connectors: %w", err)
+	}
+	if p.SavedSearches, err = e.store.ListSavedSearches(ctx, user.ID); err != nil {
+		return fmt.Errorf("listing saved searches: %w", err)
+	}
+	if p.SearchHistory, err = e.store.ListRecentSearches(ctx, user.ID); err != nil {
+		return fmt.Errorf("listing search history: %w", err)
+	}
+	if inbox, err := e.store.GetInbox(ctx, user.ID); err == nil {
+		p.Inbox = &inbox
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("loading inbox: %w", err)
+	}
+	for i := range p.APIKeys {
+		p.APIKeys[i].Key = ""
+	}
+	for i := range p.Webhooks {
+		p.Webhooks[i].Secret = ""
+	}
+	if err := writeJSON(z, "profile.json", p); err != nil {
+		return err
+	}
+
+	chats, err := e.store.ListChats(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("listing chats: %w", err)
+	}
+	for i := range chats {
+		if chats[i].Messages, err = e.store.ListChatMessages(ctx, chats[i].ID, 0); err != nil {
+			return fmt.Errorf("listing messages of chat %s: %w", chats[i].ID, err)
+		}
+	}
+	if err := writeJSON(z, "chats.json", chats); err != nil {
+		return err
+	}
+
+	if user.AvatarKey != "" {
+		if err := e.copyObject(ctx, z, "avatar"+path.Ext(user.AvatarKey), e.bucket, user.AvatarKey, nil); err != nil {
+			return fmt.Errorf("adding avatar: %w", err)
+		}
+	}
+
+	docs := []models.Document{}
+	for after := ""; ; {
+		page, err := e.store.ListUploadedDocuments(ctx, user.ID, after, batch)
+		if err != nil {
+			return fmt.Errorf("listing documents: %w", err)
+		}
+		docs = append(docs, page...)
+		if len(page) < batch {
+			break
+		}
+		after = page[len(page)-1].ID
+	}
+	if err := writeJSON(z, "documents.json", docs); err != nil {
+		return err
+	}
+
+	for _, doc := range docs {
+		// quarantined files stay where they are
+		if doc.ScanStatus != models.ScanStatusInfected {
+			name := "files/" + doc.ID + "-" + fileName(doc.Filename)
+			if err := e.copyObject(ctx, z, name, doc.Bucket, doc.ObjectKey, &doc); err != nil {
+				return fmt.Errorf("adding document %s: %w", doc.ID, err)
+			}
+		}
+		if e.index == nil {
+			continue
+		}
+		text, err := e.text(ctx, doc)
+		if err != nil {
+			return fmt.Errorf("recovering the text of %s: %w", doc.ID, err)
+		}
+		if text != "" {
+			if err := writeFile(z, "text/"+doc.ID+".txt", strings.NewReader(text)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// copyObject adds a stored object to the zip, decrypted when it belongs to an encrypted document
+func (e *Exporter) copyObject(ctx context.Context, z *zip.Writer, name, bucket, key string, doc *models.Document) error {
+	obj, err := e.objects.Get(ctx, bucket, key)
+	if errors.Is(err, objectstore.ErrNotFound) {
+		// nothing to export, not a reason to fail the rest
+		log.Printf("Export skips missing object %s\n", key)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if doc != nil {
+		if obj, err = e.keys.Open(ctx, obj, doc.EncryptionKey, doc.Size); err != nil {
+			return err
+		}
+	}
+	defer obj.Close()
+	return writeFile(z, name, obj)
+}
+
+// text puts a document's extracted text back together from the chunks its latest job indexed
+func (e *Exporter) text(ctx context.Context, doc models.Document) (string, error) {
+	// the collection searches go to, the one the last embedding migration filled
+	index := e.index
+	if current, err := e.store.CurrentEmbeddingMigration(ctx); err == nil {
+		index = index.WithCollection(current.Collection)
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return "", err
+	}
+	chunks, err := index.Chunks(ctx, doc.ID)
+	if err != nil || len(chunks) == 0 {
+		return "", err
+	}
+	// a reprocessing in flight leaves chunks of two jobs, the latest one's win
+	if job, err := e.store.GetLatestJobForDocument(ctx, doc.ID); err == nil {
+		latest := chunks[:0:0]
+		for _, c := range chunks {
+			if c.JobID == job.ID {
+				latest = append(latest, c)
+			}
+		}
+		if len(latest) > 0 {
+			chunks = latest
+		}
+	}
+	joined := make([]models.Chunk, len(chunks))
+	for i, c := range chunks {
+		joined[i] = models.Chunk{Index: c.ChunkIndex, Start: c.Start, End: c.End, Text: c.Text}
+	}
+	return models.JoinChunks(joined), nil
+}
+
+func writeJSON(z *zip.Writer, name string, v any) error {
+	body, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(z, name, strings.NewReader(string(body)+"\n"))
+}
+
+func writeFile(z *zip.Writer, name string, r io.Reader) error {
+	w, err := z.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// fileName keeps an uploaded name from reaching outside files/ when the zip is extracted
+func fileName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" || name == ".." {
+		return "document"
+	}
+	return name
+}
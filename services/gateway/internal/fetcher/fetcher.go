@@ -0,0 +1,246 @@
+// Package fetcher downloads documents from URLs users hand us, and gives webhooks a client
+// held to the same rules. Every connection, redirects included, is checked against the address
+// it actually dials, so a hostname resolving to localhost, a private network or the cloud
+// metadata endpoint gets nowhere.
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+)
+
+var (
+	// ErrInvalidURL is a URL that isn't absolute http(s), or carries credentials
+	ErrInvalidURL = errors.New("url must be an absolute http(s) URL without credentials")
+	// ErrBlocked is a URL that leads to an address we don't fetch from
+	ErrBlocked = errors.New("url points to a private or reserved address")
+	// ErrTooLarge is a download over the size limit
+	ErrTooLarge = errors.New("download is too large")
+	// ErrTooManyRedirects is a URL that kept redirecting
+	ErrTooManyRedirects = errors.New("too many redirects")
+)
+
+// StatusError is a response that wasn't a 200
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("server answered %d %s", e.Code, http.StatusText(e.Code))
+}
+
+// Fetcher downloads to temp files, built once from the config
+type Fetcher struct {
+	client *http.Client
+}
+
+func New(cfg config.URLIngest) *Fetcher {
+	return &Fetcher{client: newClient(cfg.Timeout, cfg.MaxRedirects, cfg.AllowPrivate)}
+}
+
+// NewClient is an http.Client for sending to URLs users hand us, webhooks, held to the same
+// checks as downloads: only public addresses are dialed, and only maxRedirects redirects followed
+func NewClient(timeout time.Duration, maxRedirects int) *http.Client {
+	return newClient(timeout, maxRedirects, false)
+}
+
+func newClient(timeout time.Duration, maxRedirects int, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if !allowPrivate {
+		dialer.Control = checkDial
+	}
+	transport := &http.Transport{
+		// a proxy would be the one dialing, and the checks only see the proxy's address
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       90 * time.Second,
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirects {
+				return ErrTooManyRedirects
+			}
+			if err := checkURL(req.URL); err != nil {
+				return err
+			}
+			// the dialer checks again whatever the name resolves to by the time it connects
+			if !allowPrivate {
+				return CheckHost(req.Context(), req.URL.Hostname())
+			}
+			return nil
+		},
+	}
+}
+
+// File is a finished download, closing it removes the temp file
+type File struct {
+	*os.File
+	Size int64
+	// Filename comes from Content-Disposition, or else the last segment of the final URL
+	Filename string
+}
+
+func (f *File) Close() error {
+	err := f.File.Close()
+	os.Remove(f.Name())
+	return err
+}
+
+// Fetch downloads rawURL, refusing anything over maxSize bytes. The File is positioned at the start.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string, maxSize int64) (*File, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, ErrInvalidURL
+	}
+	if err := checkURL(u); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, ErrInvalidURL
+	}
+	req.Header.Set("User-Agent", "docstream-fetcher/1.0")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		// the client wraps what CheckRedirect and the dialer returned
+		for _, known := range []error{ErrBlocked, ErrTooManyRedirects, ErrInvalidURL} {
+			if errors.Is(err, known) {
+				return nil, known
+			}
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{Code: resp.StatusCode}
+	}
+	if resp.ContentLength > maxSize {
+		return nil, ErrTooLarge
+	}
+
+	tmp, err := os.CreateTemp("", "docstream-fetch-*")
+	if err != nil {
+		return nil, err
+	}
+	file := &File{File: tmp, Filename: filename(resp)}
+	file.Size, err = io.Copy(tmp, io.LimitReader(resp.Body, maxSize+1))
+	if err == nil && file.Size > maxSize {
+		err = ErrTooLarge
+	}
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+func checkURL(u *url.URL) error {
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+		return ErrInvalidURL
+	}
+	return nil
+}
+
+// CheckHost resolves host and returns ErrBlocked unless every address it has is public, for
+// refusing a URL up front. Whatever dials it later has to check again, DNS can change.
+func CheckHost(ctx context.Context, host string) error {
+	if ip, err := netip.ParseAddr(host); err == nil {
+		if !public(ip) {
+			return ErrBlocked
+		}
+		return nil
+	}
+	ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("resolving %s: %w", host, err)
+	}
+	for _, ip := range ips {
+		if !public(ip) {
+			return ErrBlocked
+		}
+	}
+	return nil
+}
+
+// checkDial runs after DNS, on the address about to be connected to, so rebinding a
+// name between a check and the request doesn't get around it
+func checkDial(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !public(ip) {
+		return ErrBlocked
+	}
+	return nil
+}
+
+// reserved are ranges netip doesn't flag but that aren't the public internet either
+var reserved = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"), // NAT64, could map onto a private IPv4
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+// public reports whether ip is an ordinary internet address, not loopback, private,
+// link-local (where cloud metadata lives), multicast or reserved
+func public(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	for _, prefix := range reserved {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// filename picks a name for the download, the ingest pipeline keeps only its base
+func filename(resp *http.Response) string {
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		if name := path.Base(strings.ReplaceAll(params["filename"], `\`, "/")); name != "." && name != "/" && name != "" {
+			return name
+		}
+	}
+	if name := path.Base(resp.Request.URL.Path); name != "." && name != "/" {
+		return name
+	}
+	return "download"
+}
@@ -0,0 +1,324 @@
+// Package grpcapi serves the gRPC API of proto/docstream/v1 next to the REST gateway, for
+// backend services that would rather not build multipart forms. It only translates: a Backend
+// does the work with the code the REST handlers run, callers sign in with the same access tokens
+// and API keys, and the rate limits share their buckets with the REST ones.
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/metrics"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/ratelimit"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	docstreamv1 "github.com/dhruvkshah75/docstream/gateway/proto/docstream/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Tokens is what signing in or refreshing hands back
+type Tokens struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int
+}
+
+// File is an uploaded file, Content reads it from the start and Size is its length
+type File struct {
+	UserID       int
+	OrgID        string
+	CollectionID string
+	Filename     string
+	Tags         []string
+	Metadata     map[string]string
+	Content      io.ReadSeeker
+	Size         int64
+}
+
+// Uploaded is where a file went, Duplicate means its content was there already
+type Uploaded struct {
+	DocumentID string
+	JobID      string
+	Duplicate  bool
+}
+
+// Query is a search, zero fields mean what they mean for POST /search
+type Query struct {
+	Text        string
+	Limit       int
+	OrgID       string
+	DocumentIDs []string
+	Tags        []string
+	Languages   []string
+}
+
+// Hit is one matching chunk
+type Hit struct {
+	DocumentID string
+	Filename   string
+	OrgID      string
+	ChunkIndex int
+	Page       int
+	Heading    string
+	Language   string
+	Score      float32
+	Snippet    string
+}
+
+// Backend does what the services are asked to. Errors it would answer a REST request with
+// come back as *Refused, anything else is logged and reported as an internal error.
+type Backend interface {
+	// Login signs in like POST /login, ip counts towards the same lockout and is recorded on
+	// the session along with the user agent
+	Login(ctx context.Context, email, password, ip, userAgent string) (Tokens, error)
+	Refresh(ctx context.Context, refreshToken string) (Tokens, error)
+	Upload(ctx context.Context, file File) (Uploaded, error)
+	Search(ctx context.Context, userID int, query Query) ([]Hit, error)
+}
+
+// Refused is a request the backend turned down, Status is the HTTP status REST answers with
+type Refused struct {
+	Status  int
+	Message string
+	// RetryAfter goes out as RetryInfo when set
+	RetryAfter time.Duration
+}
+
+func (r *Refused) Error() string {
+	return r.Message
+}
+
+// Store is where callers are authenticated and their jobs looked up
+type Store interface {
+	middleware.AuthStore
+	storage.JobStore
+}
+
+// Rates are the REST API's rate limits, a zero Rate is no limit
+type Rates struct {
+	IP      ratelimit.Rate
+	Uploads ratelimit.Rate
+	Search  ratelimit.Rate
+}
+
+// public are the methods callers use before they have a token
+var public = map[string]bool{
+	docstreamv1.AuthService_Login_FullMethodName:   true,
+	docstreamv1.AuthService_Refresh_FullMethodName: true,
+}
+
+// scopes are what an API key needs for each method, bearer tokens aren't limited by them
+var scopes = map[string]string{
+	docstreamv1.UploadService_Upload_FullMethodName: models.ScopeUpload,
+	docstreamv1.JobService_GetJob_FullMethodName:    models.ScopeJobsRead,
+	docstreamv1.JobService_ListJobs_FullMethodName:  models.ScopeJobsRead,
+	docstreamv1.SearchService_Search_FullMethodName: models.ScopeDocumentsRead,
+}
+
+type Server struct {
+	backend       Backend
+	store         Store
+	limiter       ratelimit.Limiter
+	rates         Rates
+	quotas        *ratelimit.Quotas
+	maxUploadSize int64
+	server        *grpc.Server
+}
+
+// New serves backend, quotas are the per-user overrides of rates and may be nil
+func New(backend Backend, store Store, limiter ratelimit.Limiter, rates Rates, quotas *ratelimit.Quotas, maxUploadSize int64) *Server {
+	s := &Server{backend: backend, store: store, limiter: limiter, rates: rates, quotas: quotas, maxUploadSize: maxUploadSize}
+	s.server = grpc.NewServer(grpc.UnaryInterceptor(s.unary), grpc.StreamInterceptor(s.stream))
+	docstreamv1.RegisterAuthServiceServer(s.server, authService{Server: s})
+	docstreamv1.RegisterUploadServiceServer(s.server, uploadService{Server: s})
+	docstreamv1.RegisterJobServiceServer(s.server, jobService{Server: s})
+	docstreamv1.RegisterSearchServiceServer(s.server, searchService{Server: s})
+	return s
+}
+
+// ListenAndServe serves gRPC on addr until the listener fails
+func (s *Server) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Println("gRPC API listening on", addr)
+	return s.server.Serve(ln)
+}
+
+// userKey holds the authenticated user's ID in the context of a call
+type userKey struct{}
+
+// UserID returns the authenticated user's ID, 0 for the public methods
+func UserID(ctx context.Context) int {
+	id, _ := ctx.Value(userKey{}).(int)
+	return id
+}
+
+func (s *Server) unary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := s.authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := handler(ctx, req)
+	return resp, grpcError(err)
+}
+
+// authedStream is a stream whose context carries the authenticated user
+type authedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s authedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *Server) stream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.authenticate(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return grpcError(handler(srv, authedStream{ServerStream: ss, ctx: ctx}))
+}
+
+// authenticate applies the rate limits and checks the "authorization: Bearer <token>" or
+// "x-api-key" metadata of a call, returning the context with the user in it
+func (s *Server) authenticate(ctx context.Context, method string) (context.Context, error) {
+	if err := s.allow(ctx, s.rates.IP, "ip:"+clientIP(ctx)); err != nil {
+		return ctx, err
+	}
+	if public[method] {
+		return ctx, nil
+	}
+
+	var id middleware.Identity
+	var rejected *middleware.Rejection
+	md, _ := metadata.FromIncomingContext(ctx)
+	if raw := first(md, "x-api-key"); raw != "" {
+		id, rejected = middleware.VerifyAPIKey(ctx, s.store, raw, scopes[method])
+	} else if token, found := strings.CutPrefix(first(md, "authorization"), "Bearer "); found && token != "" {
+		id, rejected = middleware.VerifyToken(ctx, s.store, token)
+	} else {
+		metrics.Auth("token", false)
+		rejected = &middleware.Rejection{Status: http.StatusUnauthorized, Message: "Missing or malformed authorization metadata"}
+	}
+	if rejected != nil {
+		return ctx, grpcError(&Refused{Status: rejected.Status, Message: rejected.Message})
+	}
+
+	// the same buckets as the REST routes, an upload is an upload whichever way it comes in
+	user := strconv.Itoa(id.UserID)
+	switch method {
+	case docstreamv1.UploadService_Upload_FullMethodName:
+		if err := s.allow(ctx, s.quotas.Rate(ctx, id.UserID, "uploads", s.rates.Uploads), "user:uploads:"+user); err != nil {
+			return ctx, err
+		}
+	case docstreamv1.SearchService_Search_FullMethodName:
+		if err := s.allow(ctx, s.quotas.Rate(ctx, id.UserID, "search", s.rates.Search), "user:search:"+user); err != nil {
+			return ctx, err
+		}
+	}
+	return context.WithValue(ctx, userKey{}, id.UserID), nil
+}
+
+// allow takes a token from key's bucket, like ratelimit's middleware a broken limiter lets the call through
+func (s *Server) allow(ctx context.Context, rate ratelimit.Rate, key string) error {
+	if rate.Requests == 0 {
+		return nil
+	}
+	ok, retryAfter, err := s.limiter.Allow(ctx, key, rate)
+	if err != nil {
+		log.Println("Rate Limiter Error:", err)
+		return nil
+	}
+	if !ok {
+		return grpcError(&Refused{Status: http.StatusTooManyRequests, Message: "Too many requests, slow down", RetryAfter: retryAfter})
+	}
+	return nil
+}
+
+func first(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// clientIP is the address the call came from, there is no X-Forwarded-For to trust here
+func clientIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// userAgent is what the client's gRPC library sent, "grpc-go/1.75.0" and the like
+func userAgent(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return first(md, "user-agent")
+}
+
+// grpcError turns a *Refused into the status with the closest code, errors that already
+// are a status pass through and the rest are logged and hidden behind Internal
+func grpcError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	var refused *Refused
+	if !errors.As(err, &refused) {
+		log.Println("gRPC Error:", err)
+		return status.Error(codes.Internal, "Internal error")
+	}
+
+	st := status.New(code(refused.Status), refused.Message)
+	if refused.RetryAfter > 0 {
+		if detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(refused.RetryAfter)}); err == nil {
+			st = detailed
+		}
+	}
+	return st.Err()
+}
+
+// code maps the REST API's HTTP statuses onto gRPC codes
+func code(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound, http.StatusGone:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.FailedPrecondition
+	case http.StatusRequestEntityTooLarge, http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return codes.Unavailable
+	}
+	return codes.Internal
+}
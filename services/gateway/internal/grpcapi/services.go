@@ -0,0 +1,234 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	docstreamv1 "github.com/dhruvkshah75/docstream/gateway/proto/docstream/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	defaultJobLimit = 20
+	maxJobLimit     = 100
+)
+
+type authService struct {
+	docstreamv1.UnimplementedAuthServiceServer
+	*Server
+}
+
+func (s authService) Login(ctx context.Context, req *docstreamv1.LoginRequest) (*docstreamv1.Tokens, error) {
+	if req.Email == "" || req.Password == "" {
+		return nil, status.Error(codes.InvalidArgument, "email and password are required")
+	}
+	tokens, err := s.backend.Login(ctx, req.Email, req.Password, clientIP(ctx), userAgent(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return tokensMessage(tokens), nil
+}
+
+func (s authService) Refresh(ctx context.Context, req *docstreamv1.RefreshRequest) (*docstreamv1.Tokens, error) {
+	if req.RefreshToken == "" {
+		return nil, status.Error(codes.InvalidArgument, "refresh_token is required")
+	}
+	tokens, err := s.backend.Refresh(ctx, req.RefreshToken)
+	if err != nil {
+		return nil, err
+	}
+	return tokensMessage(tokens), nil
+}
+
+func tokensMessage(t Tokens) *docstreamv1.Tokens {
+	return &docstreamv1.Tokens{AccessToken: t.AccessToken, RefreshToken: t.RefreshToken, ExpiresIn: int32(t.ExpiresIn)}
+}
+
+type uploadService struct {
+	docstreamv1.UnimplementedUploadServiceServer
+	*Server
+}
+
+// Upload spools the chunks to a temporary file, ingest needs to read the content more than once
+// (sniffing, hashing, scanning, storing) and a stream can only be read once
+func (s uploadService) Upload(stream docstreamv1.UploadService_UploadServer) error {
+	req, err := stream.Recv()
+	if errors.Is(err, io.EOF) {
+		return status.Error(codes.InvalidArgument, "the stream was closed before the upload's metadata")
+	} else if err != nil {
+		return err
+	}
+	meta := req.GetMetadata()
+	if meta == nil {
+		return status.Error(codes.InvalidArgument, "the first message must be the upload's metadata")
+	}
+	if meta.Filename == "" {
+		return status.Error(codes.InvalidArgument, "filename is required")
+	}
+	if meta.Size > s.maxUploadSize {
+		return s.tooLarge()
+	}
+
+	spool, err := os.CreateTemp("", "docstream-grpc-upload-*")
+	if err != nil {
+		return fmt.Errorf("creating the upload spool: %w", err)
+	}
+	defer func() {
+		spool.Close()
+		if err := os.Remove(spool.Name()); err != nil {
+			log.Println("Failed to remove upload spool:", err)
+		}
+	}()
+
+	var size int64
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return err
+		}
+		if req.GetMetadata() != nil {
+			return status.Error(codes.InvalidArgument, "metadata must only be sent once, before the content")
+		}
+		chunk := req.GetChunk()
+		size += int64(len(chunk))
+		if size > s.maxUploadSize {
+			return s.tooLarge()
+		}
+		if _, err := spool.Write(chunk); err != nil {
+			return fmt.Errorf("spooling the upload: %w", err)
+		}
+	}
+	if size == 0 {
+		return status.Error(codes.InvalidArgument, "No file uploaded")
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("rewinding the upload spool: %w", err)
+	}
+
+	ctx := stream.Context()
+	uploaded, err := s.backend.Upload(ctx, File{
+		UserID:       UserID(ctx),
+		OrgID:        meta.OrgId,
+		CollectionID: meta.CollectionId,
+		Filename:     meta.Filename,
+		Tags:         meta.Tags,
+		Metadata:     meta.Metadata,
+		Content:      spool,
+		Size:         size,
+	})
+	if err != nil {
+		return err
+	}
+	return stream.SendAndClose(&docstreamv1.UploadResponse{
+		DocumentId: uploaded.DocumentID,
+		JobId:      uploaded.JobID,
+		Duplicate:  uploaded.Duplicate,
+	})
+}
+
+func (s uploadService) tooLarge() error {
+	return status.Errorf(codes.ResourceExhausted, "File is too large, the limit is %d bytes", s.maxUploadSize)
+}
+
+type jobService struct {
+	docstreamv1.UnimplementedJobServiceServer
+	*Server
+}
+
+func (s jobService) GetJob(ctx context.Context, req *docstreamv1.GetJobRequest) (*docstreamv1.Job, error) {
+	job, err := s.store.GetJob(ctx, req.JobId, UserID(ctx))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, status.Error(codes.NotFound, "Job not found")
+	} else if err != nil {
+		log.Println("Job Lookup Error:", err)
+		return nil, status.Error(codes.Internal, "Database error")
+	}
+	return jobMessage(job), nil
+}
+
+func (s jobService) ListJobs(ctx context.Context, req *docstreamv1.ListJobsRequest) (*docstreamv1.ListJobsResponse, error) {
+	limit := int(req.Limit)
+	if limit == 0 {
+		limit = defaultJobLimit
+	}
+	if limit < 1 || limit > maxJobLimit {
+		return nil, status.Errorf(codes.InvalidArgument, "limit must be between 1 and %d", maxJobLimit)
+	}
+	if req.Offset < 0 {
+		return nil, status.Error(codes.InvalidArgument, "offset must be a positive number")
+	}
+
+	jobs, err := s.store.ListJobs(ctx, storage.JobFilter{
+		UserID: UserID(ctx),
+		Status: req.Status,
+		Limit:  limit,
+		Offset: int(req.Offset),
+	})
+	if err != nil {
+		log.Println("Job List Error:", err)
+		return nil, status.Error(codes.Internal, "Database error")
+	}
+
+	resp := &docstreamv1.ListJobsResponse{Jobs: make([]*docstreamv1.Job, 0, len(jobs))}
+	for _, job := range jobs {
+		resp.Jobs = append(resp.Jobs, jobMessage(job))
+	}
+	return resp, nil
+}
+
+func jobMessage(j models.Job) *docstreamv1.Job {
+	return &docstreamv1.Job{
+		JobId:      j.ID,
+		DocumentId: j.DocumentID,
+		Filename:   j.Filename,
+		Status:     j.Status,
+		Error:      j.Error,
+		CreatedAt:  timestamppb.New(j.CreatedAt),
+		UpdatedAt:  timestamppb.New(j.UpdatedAt),
+	}
+}
+
+type searchService struct {
+	docstreamv1.UnimplementedSearchServiceServer
+	*Server
+}
+
+func (s searchService) Search(ctx context.Context, req *docstreamv1.SearchRequest) (*docstreamv1.SearchResponse, error) {
+	hits, err := s.backend.Search(ctx, UserID(ctx), Query{
+		Text:        req.Query,
+		Limit:       int(req.Limit),
+		OrgID:       req.OrgId,
+		DocumentIDs: req.DocumentIds,
+		Tags:        req.Tags,
+		Languages:   req.Languages,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &docstreamv1.SearchResponse{Results: make([]*docstreamv1.SearchResult, 0, len(hits))}
+	for _, h := range hits {
+		resp.Results = append(resp.Results, &docstreamv1.SearchResult{
+			DocumentId: h.DocumentID,
+			Filename:   h.Filename,
+			OrgId:      h.OrgID,
+			ChunkIndex: int32(h.ChunkIndex),
+			Page:       int32(h.Page),
+			Heading:    h.Heading,
+			Language:   h.Language,
+			Score:      h.Score,
+			Snippet:    h.Snippet,
+		})
+	}
+	return resp, nil
+}
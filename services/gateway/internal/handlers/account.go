@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+	"github.com/dhruvkshah75/docstream/gateway/internal/metrics"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/purger"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type AccountHandler struct {
+	Store  storage.Store
+	Purger *purger.Purger
+	// what happens to the account's audit entries, one of the config.DeletionAudit* policies
+	auditPolicy string
+}
+
+// Constructor for deleting accounts
+func NewAccountHandler(store storage.Store, p *purger.Purger, cfg config.Accounts) *AccountHandler {
+	return &AccountHandler{Store: store, Purger: p, auditPolicy: cfg.DeletionAudit}
+}
+
+// DeleteAccountInput confirms the deletion, with the password or, for accounts that sign in
+// through Google or GitHub and have none, by typing the email address
+type DeleteAccountInput struct {
+	Password string `json:"password"`
+	Email    string `json:"email"`
+}
+
+// --- DELETE /me ---
+// Erases the account: it is signed out everywhere, its API keys, webhooks, connectors and inbox
+// are removed, its email and profile wiped and its documents moved to the trash, all at once.
+// The documents' objects, thumbnails and vectors are purged right after, whatever the trash's
+// usual retention. Documents under legal hold stay until it is lifted, and so do documents the
+// account uploaded to organizations that still have members, those belong to the team.
+func (h *AccountHandler) Delete(c *gin.Context) {
+	var input DeleteAccountInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Invalid(c, err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	user, err := h.Store.GetUserByID(ctx, middleware.UserID(c))
+	if errors.Is(err, storage.ErrNotFound) || err == nil && user.DeletedAt != nil {
+		apierror.Write(c, http.StatusNotFound, "User not found")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	if user.Password != "" {
+		if input.Password == "" {
+			apierror.Field(c, "password", "password is required to delete the account")
+			return
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
+			metrics.Auth("delete_account", false)
+			apierror.Field(c, "password", "password is incorrect")
+			return
+		}
+	} else if !strings.EqualFold(strings.TrimSpace(input.Email), user.Email) {
+		apierror.Field(c, "email", "email must be the account's email address to confirm deleting it")
+		return
+	}
+	if !h.leavesOwners(c, user.ID) {
+		return
+	}
+
+	deletion, err := h.Store.DeleteAccount(ctx, user.ID, h.auditPolicy)
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "User not found")
+		return
+	} else if err != nil {
+		log.Println("Account Deletion Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	// the bearer token ended with its session, one from before sessions goes on the denylist
+	if jti := middleware.TokenID(c); jti != "" && middleware.SessionID(c) == "" {
+		if err := h.Store.RevokeAccessToken(ctx, jti, user.ID, middleware.TokenExpiry(c)); err != nil {
+			log.Println("Token Revocation Error:", err)
+		}
+	}
+
+	entry := models.AuditEntry{
+		Event:  models.AuditAccountDeleted,
+		Detail: fmt.Sprintf("account %d deleted, %d documents to purge and %d on hold", user.ID, deletion.Documents, deletion.OnHold),
+	}
+	if h.auditPolicy == config.DeletionAuditKeep {
+		entry.UserID, entry.IP = &user.ID, c.ClientIP()
+	}
+	if err := h.Store.CreateAuditEntry(ctx, entry); err != nil {
+		log.Println("Failed to write audit entry:", err)
+	}
+	metrics.Auth("delete_account", true)
+
+	// the purge can take a while with many documents, the purge_accounts schedule retries it if this fails
+	go func() {
+		if err := h.Purger.PurgeAccount(context.Background(), user); err != nil {
+			log.Printf("Failed to purge account %d: %v\n", user.ID, err)
+		}
+	}()
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Account deleted, its documents are being purged", "deletion": deletion})
+}
+
+// leavesOwners keeps the deletion from taking the last owner from an organization others are
+// still in. Organizations where nobody else is left go with the account.
+func (h *AccountHandler) leavesOwners(c *gin.Context, userID int) bool {
+	orgs, err := h.Store.ListOrgs(c.Request.Context(), userID)
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return false
+	}
+	for _, org := range orgs {
+		if org.Role != models.RoleOwner {
+			continue
+		}
+		members, err := h.Store.ListMembers(c.Request.Context(), org.ID)
+		if err != nil {
+			apierror.Write(c, http.StatusInternalServerError, "Database error")
+			return false
+		}
+		others, owners := 0, 0
+		for _, m := range members {
+			if m.UserID == userID {
+				continue
+			}
+			others++
+			if m.Role == models.RoleOwner {
+				owners++
+			}
+		}
+		if others > 0 && owners == 0 {
+			apierror.Write(c, http.StatusConflict, fmt.Sprintf("You are the last owner of %s, make another member an owner before deleting your account", org.Name))
+			return false
+		}
+	}
+	return true
+}
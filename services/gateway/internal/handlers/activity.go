@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// ActivityHandler serves what happened to documents, as the audit log recorded it: uploads,
+// processing, shares, comments and reprocessing
+type ActivityHandler struct {
+	Store storage.Store
+}
+
+// Constructor for the activity feeds
+func NewActivityHandler(store storage.Store) *ActivityHandler {
+	return &ActivityHandler{Store: store}
+}
+
+// --- GET /documents/:id/activity ---
+// The document's activity, newest first, ?limit=<n> (default 50, max 200)&before=<next_before
+// from the previous page>. Only its uploader and its organization's members see it, not those it
+// was shared with, since the shares name who else has it.
+func (h *ActivityHandler) Document(c *gin.Context) {
+	doc, err := h.Store.GetDocument(c.Request.Context(), c.Param("id"), middleware.UserID(c))
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Document not found")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	h.page(c, storage.ActivityFilter{DocumentID: doc.ID})
+}
+
+// --- GET /orgs/:id/activity ---
+// The activity of every document of the organization and of its shared collections, paged like
+// a document's. Any member can read it.
+func (h *ActivityHandler) Org(c *gin.Context) {
+	if _, ok := orgRole(c, h.Store, c.Param("id")); !ok {
+		return
+	}
+	h.page(c, storage.ActivityFilter{OrgID: c.Param("id")})
+}
+
+// page writes one page of the filter's activity, next_before is null on the last one
+func (h *ActivityHandler) page(c *gin.Context, filter storage.ActivityFilter) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 200 {
+		apierror.Write(c, http.StatusBadRequest, "limit must be between 1 and 200")
+		return
+	}
+	before, err := strconv.Atoi(c.DefaultQuery("before", "0"))
+	if err != nil || before < 0 {
+		apierror.Write(c, http.StatusBadRequest, "before must be an activity ID")
+		return
+	}
+	filter.Before = before
+	// one extra row tells us whether there is another page
+	filter.Limit = limit + 1
+
+	activity, err := h.Store.ListActivity(c.Request.Context(), filter)
+	if err != nil {
+		log.Println("Activity List Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	var next *int
+	if len(activity) > limit {
+		activity = activity[:limit]
+		next = &activity[limit-1].ID
+	}
+	c.JSON(http.StatusOK, gin.H{"activity": activity, "next_before": next})
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/queue"
+	"github.com/dhruvkshah75/docstream/gateway/internal/ratelimit"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+type AdminHandler struct {
+	Store storage.Store
+	Queue queue.Publisher
+	// Management reads the queue depths, nil unless RABBITMQ_MANAGEMENT_URL is set
+	Management *queue.Management
+	// Quotas are told when an admin changes a user's overrides
+	Quotas *ratelimit.Quotas
+}
+
+// Constructor for the admin endpoints
+func NewAdminHandler(store storage.Store, publisher queue.Publisher, management *queue.Management, quotas *ratelimit.Quotas) *AdminHandler {
+	return &AdminHandler{Store: store, Queue: publisher, Management: management, Quotas: quotas}
+}
+
+type systemStats struct {
+	models.SystemStats
+	// Queues is null without the management API, QueueError says why they couldn't be read
+	Queues     []queue.QueueStats `json:"queues"`
+	QueueError string             `json:"queue_error,omitempty"`
+}
+
+// --- GET /admin/stats ---
+// Totals across the whole installation, with the depth of every RabbitMQ queue when the
+// management API is configured. A broker that doesn't answer leaves the queues out but
+// doesn't fail the rest.
+func (h *AdminHandler) Stats(c *gin.Context) {
+	counts, err := h.Store.SystemStats(c.Request.Context())
+	if err != nil {
+		log.Println("Admin Stats Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	stats := systemStats{SystemStats: counts}
+	if h.Management != nil {
+		if stats.Queues, err = h.Management.Queues(c.Request.Context()); err != nil {
+			log.Println("RabbitMQ Management Error:", err)
+			stats.QueueError = "Queue depths unavailable"
+		}
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+type dlqEntry struct {
+	JobID      string `json:"job_id"`
+	DocumentID string `json:"document_id"`
+	UserID     int    `json:"user_id"`
+	Filename   string `json:"filename"`
+	Attempts   int    `json:"attempts"`
+	Error      string `json:"error"` // the last error the worker reported, from the jobs table
+}
+
+// deadLetters is the queue's DLQ if it can be browsed, Kafka's dead letter topic is left to Kafka's own tooling
+func (h *AdminHandler) deadLetters(c *gin.Context) (queue.DeadLetters, bool) {
+	dlq, ok := h.Queue.(queue.DeadLetters)
+	if !ok {
+		apierror.Write(c, http.StatusNotImplemented, "The dead letter queue can't be browsed on this queue backend")
+	}
+	return dlq, ok
+}
+
+// --- GET /admin/dlq ---
+// Peeks at the dead letter queue without consuming it, ?limit=<n> (default 50, max 500)
+func (h *AdminHandler) ListDLQ(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 500 {
+		apierror.Write(c, http.StatusBadRequest, "limit must be between 1 and 500")
+		return
+	}
+	dlq, ok := h.deadLetters(c)
+	if !ok {
+		return
+	}
+
+	jobs, total, err := dlq.PeekDeadLetters(c.Request.Context(), limit)
+	if err != nil {
+		log.Println("DLQ Inspect Error:", err)
+		apierror.Write(c, http.StatusServiceUnavailable, "Queue unavailable")
+		return
+	}
+
+	entries := make([]dlqEntry, len(jobs))
+	for i, d := range jobs {
+		entries[i] = h.describe(c, d)
+	}
+	c.JSON(http.StatusOK, gin.H{"total": total, "jobs": entries})
+}
+
+// --- POST /admin/dlq/:job_id/requeue ---
+// Moves one job from the dead letter queue back onto the ingestion queue with a fresh attempt count
+func (h *AdminHandler) RequeueDLQ(c *gin.Context) {
+	jobID := c.Param("job_id")
+	dlq, ok := h.deadLetters(c)
+	if !ok {
+		return
+	}
+
+	found, err := dlq.RequeueDeadLetter(c.Request.Context(), jobID)
+	if err != nil {
+		log.Println("Queue Error: ", err)
+		if queueDown(err) {
+			middleware.Unavailable(c, "Queue")
+			return
+		}
+		apierror.Write(c, http.StatusInternalServerError, "Failed to requeue job")
+		return
+	}
+	if !found {
+		apierror.Write(c, http.StatusNotFound, "Job not found in the dead letter queue")
+		return
+	}
+
+	if err := h.Store.RequeueJob(c.Request.Context(), jobID); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		log.Printf("Failed to reset job %s: %v\n", jobID, err)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Job requeued", "job_id": jobID})
+}
+
+// describe turns a dead-lettered delivery into something readable, filling in the error from the jobs table
+func (h *AdminHandler) describe(c *gin.Context, d queue.Delivery) dlqEntry {
+	var entry dlqEntry
+	json.Unmarshal(d.Body, &entry)
+	entry.Attempts = d.Attempts
+
+	if job, err := h.Store.GetJobByID(c.Request.Context(), entry.JobID); err == nil {
+		entry.Error = job.Error
+	}
+	return entry
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+const maxModelNameLen = 200
+
+// AllowedModelInput prices and limits a model, prices are in USD per million tokens
+type AllowedModelInput struct {
+	Description     string  `json:"description"`
+	InputPrice      float64 `json:"input_price"`
+	OutputPrice     float64 `json:"output_price"`
+	MaxInputTokens  int     `json:"max_input_tokens"`
+	MaxOutputTokens int     `json:"max_output_tokens"`
+}
+
+// --- GET /admin/models ---
+func (h *AdminHandler) ListModels(c *gin.Context) {
+	list, err := h.Store.ListAllowedModels(c.Request.Context(), c.Query("kind"))
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"models": list})
+}
+
+// --- PUT /admin/models/:kind/*name ---
+// Lets callers pick a model, or changes its prices and limits. The name is the provider's and
+// may hold slashes, like BAAI/bge-m3. Whether the provider serves it isn't checked, a job
+// asking for one it doesn't fails in the worker.
+func (h *AdminHandler) PutModel(c *gin.Context) {
+	var input AllowedModelInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Invalid(c, err)
+		return
+	}
+	kind, name, ok := modelParams(c)
+	if !ok {
+		return
+	}
+	var invalid []apierror.FieldError
+	if input.InputPrice < 0 || input.OutputPrice < 0 {
+		invalid = append(invalid, apierror.FieldError{Field: "input_price", Message: "prices can't be negative"})
+	}
+	if input.MaxInputTokens < 0 || input.MaxOutputTokens < 0 {
+		invalid = append(invalid, apierror.FieldError{Field: "max_input_tokens", Message: "limits can't be negative, 0 is none"})
+	}
+	if kind == models.ModelKindEmbedding && (input.OutputPrice != 0 || input.MaxOutputTokens != 0) {
+		invalid = append(invalid, apierror.FieldError{Field: "max_output_tokens", Message: "embedding models have no output to price or limit"})
+	}
+	if len(invalid) > 0 {
+		apierror.Fields(c, invalid...)
+		return
+	}
+
+	ctx := c.Request.Context()
+	m := models.AllowedModel{
+		Kind:            kind,
+		Name:            name,
+		Description:     strings.TrimSpace(input.Description),
+		InputPrice:      input.InputPrice,
+		OutputPrice:     input.OutputPrice,
+		MaxInputTokens:  input.MaxInputTokens,
+		MaxOutputTokens: input.MaxOutputTokens,
+	}
+	if err := h.Store.PutAllowedModel(ctx, m); err != nil {
+		log.Println("Allowed Model Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	audit(c, h.Store, models.AuditModelChanged, fmt.Sprintf("allowed the %s model %q", kind, name))
+
+	m, _ = h.Store.GetAllowedModel(ctx, kind, name)
+	c.JSON(http.StatusOK, m)
+}
+
+// --- DELETE /admin/models/:kind/*name ---
+// Jobs already queued with the model keep it, new requests naming it are turned down
+func (h *AdminHandler) DeleteModel(c *gin.Context) {
+	kind, name, ok := modelParams(c)
+	if !ok {
+		return
+	}
+	err := h.Store.DeleteAllowedModel(c.Request.Context(), kind, name)
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Model is not on the allowlist")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	audit(c, h.Store, models.AuditModelChanged, fmt.Sprintf("removed the %s model %q", kind, name))
+	c.JSON(http.StatusOK, gin.H{"message": "Model removed from the allowlist"})
+}
+
+// modelParams reads the kind and name off the path, writing the error response when they are off
+func modelParams(c *gin.Context) (string, string, bool) {
+	kind := c.Param("kind")
+	if kind != models.ModelKindEmbedding && kind != models.ModelKindGeneration {
+		apierror.Write(c, http.StatusNotFound, "Model kind must be embedding or generation")
+		return "", "", false
+	}
+	name := strings.TrimPrefix(c.Param("name"), "/")
+	// anything a provider calls a model prints as itself
+	if name == "" || len(name) > maxModelNameLen || strconv.Quote(name) != `"`+name+`"` {
+		apierror.Write(c, http.StatusBadRequest, "Not a model name")
+		return "", "", false
+	}
+	return kind, name, true
+}
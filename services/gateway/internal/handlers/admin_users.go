@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/ratelimit"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// adminUser is a user as admins see them, with the limits they were given
+type adminUser struct {
+	models.User
+	Quota *models.Quota `json:"quota"` // null while the configured limits apply
+}
+
+// --- GET /admin/users ---
+// Pages through every account by ID, ?email=<part of the address>&status=active|suspended|deleted
+// &limit=<n> (default 50, max 200)&after=<next_after from the previous page>
+func (h *AdminHandler) ListUsers(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 200 {
+		apierror.Write(c, http.StatusBadRequest, "limit must be between 1 and 200")
+		return
+	}
+	after, err := strconv.Atoi(c.DefaultQuery("after", "0"))
+	if err != nil || after < 0 {
+		apierror.Write(c, http.StatusBadRequest, "after must be a user ID")
+		return
+	}
+	filter := storage.UserFilter{Email: c.Query("email"), Status: c.Query("status"), AfterID: after, Limit: limit + 1}
+	switch filter.Status {
+	case "", storage.UserStatusActive, storage.UserStatusSuspended, storage.UserStatusDeleted:
+	default:
+		apierror.Write(c, http.StatusBadRequest, "status must be active, suspended or deleted")
+		return
+	}
+
+	users, err := h.Store.ListUsers(c.Request.Context(), filter)
+	if err != nil {
+		log.Println("Admin User List Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	var next *int
+	if len(users) > limit {
+		users = users[:limit]
+		next = &users[limit-1].ID
+	}
+	c.JSON(http.StatusOK, gin.H{"users": users, "next_after": next})
+}
+
+// --- GET /admin/users/:id ---
+func (h *AdminHandler) GetUser(c *gin.Context) {
+	user, ok := h.user(c)
+	if !ok {
+		return
+	}
+	result := adminUser{User: user}
+	quota, err := h.Store.GetQuota(c.Request.Context(), user.ID)
+	if err == nil {
+		result.Quota = &quota
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+type SuspendInput struct {
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+// --- POST /admin/users/:id/suspend ---
+// The account can't sign in or use its API keys until it's reactivated, and its sessions end
+// right away. Its documents, schedules and connectors are left as they are.
+func (h *AdminHandler) SuspendUser(c *gin.Context) {
+	var input SuspendInput
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		apierror.Invalid(c, err)
+		return
+	}
+	user, ok := h.user(c)
+	if !ok {
+		return
+	}
+	if user.ID == middleware.UserID(c) {
+		apierror.Write(c, http.StatusBadRequest, "You can't suspend your own account")
+		return
+	}
+
+	sessions, err := h.Store.SuspendUser(c.Request.Context(), user.ID, input.Reason)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		apierror.Write(c, http.StatusNotFound, "User not found")
+		return
+	case errors.Is(err, storage.ErrSuspended):
+		apierror.Write(c, http.StatusConflict, "User is suspended already")
+		return
+	case err != nil:
+		log.Println("Suspend User Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	detail := fmt.Sprintf("suspended user %d, ending %d sessions", user.ID, sessions)
+	if input.Reason != "" {
+		detail += ": " + input.Reason
+	}
+	audit(c, h.Store, models.AuditUserSuspended, detail)
+	c.JSON(http.StatusOK, gin.H{"message": "User suspended", "sessions_revoked": sessions})
+}
+
+// --- POST /admin/users/:id/reactivate ---
+// The user has to sign in again, their API keys work again as they were
+func (h *AdminHandler) ReactivateUser(c *gin.Context) {
+	user, ok := h.user(c)
+	if !ok {
+		return
+	}
+	if err := h.Store.ReactivateUser(c.Request.Context(), user.ID); errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusConflict, "User isn't suspended")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	audit(c, h.Store, models.AuditUserReactivated, fmt.Sprintf("reactivated user %d", user.ID))
+	c.JSON(http.StatusOK, gin.H{"message": "User reactivated"})
+}
+
+type QuotaInput struct {
+	Uploads string `json:"uploads"`
+	Search  string `json:"search"`
+	Ask     string `json:"ask"`
+}
+
+// --- PUT /admin/users/:id/quota ---
+// Overrides the user's upload, search and ask rate limits, each written like RATE_LIMIT_UPLOADS
+// (10/m, 1000/h, off). Left out or empty keeps the configured one. Other replicas pick the
+// change up within half a minute.
+func (h *AdminHandler) SetQuota(c *gin.Context) {
+	var input QuotaInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Invalid(c, err)
+		return
+	}
+	var invalid []apierror.FieldError
+	for _, f := range []struct{ name, value string }{{"uploads", input.Uploads}, {"search", input.Search}, {"ask", input.Ask}} {
+		if f.value == "" {
+			continue
+		}
+		if _, err := ratelimit.ParseRate(f.value); err != nil {
+			invalid = append(invalid, apierror.FieldError{Field: f.name, Message: f.name + " must be a rate like 10/m, 1000/h or off"})
+		}
+	}
+	if len(invalid) > 0 {
+		apierror.Fields(c, invalid...)
+		return
+	}
+	user, ok := h.user(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	quota := models.Quota{UserID: user.ID, Uploads: input.Uploads, Search: input.Search, Ask: input.Ask}
+	if err := h.Store.SetQuota(ctx, quota); err != nil {
+		log.Println("Set Quota Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	h.Quotas.Forget(user.ID)
+	audit(c, h.Store, models.AuditQuotaChanged, fmt.Sprintf("set the limits of user %d to uploads %q, search %q, ask %q", user.ID, quota.Uploads, quota.Search, quota.Ask))
+
+	quota, _ = h.Store.GetQuota(ctx, user.ID)
+	c.JSON(http.StatusOK, quota)
+}
+
+// --- DELETE /admin/users/:id/quota ---
+// Puts the user back on the configured limits
+func (h *AdminHandler) DeleteQuota(c *gin.Context) {
+	user, ok := h.user(c)
+	if !ok {
+		return
+	}
+	if err := h.Store.DeleteQuota(c.Request.Context(), user.ID); errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "User has no quota overrides")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	h.Quotas.Forget(user.ID)
+	audit(c, h.Store, models.AuditQuotaChanged, fmt.Sprintf("reset the limits of user %d", user.ID))
+	c.JSON(http.StatusOK, gin.H{"message": "Quota overrides removed"})
+}
+
+// user loads the user named by :id, deleted accounts included
+func (h *AdminHandler) user(c *gin.Context) (models.User, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Write(c, http.StatusNotFound, "User not found")
+		return models.User{}, false
+	}
+	user, err := h.Store.GetUserByID(c.Request.Context(), id)
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "User not found")
+		return user, false
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return user, false
+	}
+	return user, true
+}
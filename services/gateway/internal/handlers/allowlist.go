@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/embeddings"
+	"github.com/dhruvkshah75/docstream/gateway/internal/llm"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/policy"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// charsPerToken is roughly what a token of English text comes to, for turning token limits into prompt sizes
+const charsPerToken = 4
+
+type ModelHandler struct {
+	Store    storage.Store
+	Embedder embeddings.Provider
+	LLM      llm.Provider
+}
+
+// Constructor for the model list, embedder and provider are nil when the gateway has none
+func NewModelHandler(store storage.Store, embedder embeddings.Provider, provider llm.Provider) *ModelHandler {
+	return &ModelHandler{Store: store, Embedder: embedder, LLM: provider}
+}
+
+// --- GET /models ---
+// The models requests may pick with embedding_model, summary_model and model, with their prices
+// and limits, and those the gateway uses when they pick none
+func (h *ModelHandler) List(c *gin.Context) {
+	list, err := h.Store.ListAllowedModels(c.Request.Context(), "")
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	defaults := gin.H{}
+	if h.Embedder != nil {
+		defaults[models.ModelKindEmbedding] = h.Embedder.DefaultModel()
+	}
+	if h.LLM != nil {
+		defaults[models.ModelKindGeneration] = h.LLM.Model()
+	}
+	c.JSON(http.StatusOK, gin.H{"models": list, "defaults": defaults})
+}
+
+// allowedModel looks up the model a request named in field, which its plan has to include.
+// "" leaves the configured one and always passes.
+func allowedModel(ctx context.Context, store storage.Store, plan models.Plan, kind, field, name string) (models.AllowedModel, *apiFailure) {
+	if name == "" {
+		return models.AllowedModel{}, nil
+	}
+	m, err := store.GetAllowedModel(ctx, kind, name)
+	if errors.Is(err, storage.ErrNotFound) {
+		return m, &apiFailure{Status: http.StatusBadRequest, Field: field, Message: fmt.Sprintf("%s is not an allowed %s model, GET /models lists them", name, kind)}
+	} else if err != nil {
+		return m, &apiFailure{Status: http.StatusInternalServerError, Message: "Database error"}
+	}
+	return m, planFailure(policy.CheckModel(plan, name))
+}
+
+// checkJobModels checks the models job options pick are allowed on the plan and that their
+// chunk size fits the embedding model, as well as the stages they pick. prefix is where the
+// options sit in the input, for the field errors.
+func checkJobModels(ctx context.Context, store storage.Store, plan models.Plan, options *models.JobOptions, prefix string) *apiFailure {
+	if options == nil {
+		return nil
+	}
+	if failure := planFailure(policy.CheckPipeline(plan, options.Pipeline)); failure != nil {
+		return failure
+	}
+	embedding, failure := allowedModel(ctx, store, plan, models.ModelKindEmbedding, prefix+"embedding_model", options.EmbeddingModel)
+	if failure != nil {
+		return failure
+	}
+	if embedding.MaxInputTokens > 0 && options.ChunkSize > embedding.MaxInputTokens {
+		return &apiFailure{Status: http.StatusBadRequest, Field: prefix + "chunk_size",
+			Message: fmt.Sprintf("chunk_size must be at most %d with %s", embedding.MaxInputTokens, embedding.Name)}
+	}
+	_, failure = allowedModel(ctx, store, plan, models.ModelKindGeneration, prefix+"summary_model", options.SummaryModel)
+	return failure
+}
+
+// generator is the provider a question is answered with: the configured model, or the allowed
+// one on the plan the request named in field. Either is held to the limits its allowlist entry sets.
+func generator(ctx context.Context, store storage.Store, plan models.Plan, provider llm.Provider, field, name string) (llm.Provider, models.AllowedModel, *apiFailure) {
+	if name == "" {
+		// the configured model needs no entry, it is only limited when it has one
+		m, err := store.GetAllowedModel(ctx, models.ModelKindGeneration, provider.Model())
+		if errors.Is(err, storage.ErrNotFound) {
+			return provider, models.AllowedModel{}, nil
+		} else if err != nil {
+			return nil, m, &apiFailure{Status: http.StatusInternalServerError, Message: "Database error"}
+		}
+		return provider.WithModel(m.Name, m.MaxOutputTokens), m, nil
+	}
+	m, failure := allowedModel(ctx, store, plan, models.ModelKindGeneration, field, name)
+	if failure != nil {
+		return nil, m, failure
+	}
+	return provider.WithModel(m.Name, m.MaxOutputTokens), m, nil
+}
+
+// sourceBudget is how many characters of sources a prompt for m takes, a quarter of its input
+// limit is left to the instructions, the conversation and the question
+func sourceBudget(m models.AllowedModel) int {
+	if m.MaxInputTokens == 0 {
+		return maxContextChars
+	}
+	return min(maxContextChars, m.MaxInputTokens*charsPerToken*3/4)
+}
@@ -0,0 +1,315 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	// maxAnnotationRange caps how much text one annotation covers, its quote included
+	maxAnnotationRange = 10000
+	// maxAnnotationBody caps a comment
+	maxAnnotationBody = 10000
+)
+
+var annotationKinds = map[string]bool{
+	models.AnnotationHighlight: true,
+	models.AnnotationComment:   true,
+}
+
+type AnnotationHandler struct {
+	Store  storage.Store
+	Chunks *ChunkHandler
+}
+
+// Constructor for the annotation endpoints, the quotes come from the chunks the way exports do
+func NewAnnotationHandler(store storage.Store, chunks *ChunkHandler) *AnnotationHandler {
+	return &AnnotationHandler{Store: store, Chunks: chunks}
+}
+
+// AnnotationInput anchors a highlight or comment to byte offsets into the document's extracted
+// text, the ones chunks, search results and citations carry
+type AnnotationInput struct {
+	// Kind is highlight, the default, or comment
+	Kind  string `json:"kind"`
+	Start *int   `json:"start" binding:"required"`
+	End   int    `json:"end" binding:"required"`
+	// Page is taken from the chunks when left out
+	Page int `json:"page"`
+	// Quote is only used while the document's text isn't indexed, otherwise it is read from there
+	Quote string `json:"quote"`
+	// Body is the comment, a highlight may have a note too
+	Body string `json:"body"`
+}
+
+// --- POST /documents/:id/annotations ---
+// Highlights or comments on a range of the text. Whoever may change the document may annotate
+// it, and so may users it was shared with to comment on. The words of the body and the quote
+// are found by keyword and hybrid searches.
+func (h *AnnotationHandler) Create(c *gin.Context) {
+	var input AnnotationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Invalid(c, err)
+		return
+	}
+	if input.Kind == "" {
+		input.Kind = models.AnnotationHighlight
+	}
+	input.Body = strings.TrimSpace(input.Body)
+	start, end := *input.Start, input.End
+	switch {
+	case !annotationKinds[input.Kind]:
+		apierror.Field(c, "kind", "kind must be highlight or comment")
+		return
+	case input.Kind == models.AnnotationComment && input.Body == "":
+		apierror.Field(c, "body", "A comment needs a body")
+		return
+	case len(input.Body) > maxAnnotationBody:
+		apierror.Field(c, "body", "body must be at most 10000 bytes")
+		return
+	case start < 0:
+		apierror.Field(c, "start", "start can't be negative")
+		return
+	case end <= start:
+		apierror.Field(c, "end", "end must be past start")
+		return
+	case end-start > maxAnnotationRange:
+		apierror.Field(c, "end", "An annotation can cover at most 10000 bytes")
+		return
+	case input.Page < 0:
+		apierror.Field(c, "page", "page can't be negative")
+		return
+	}
+
+	doc, ok := h.document(c, c.Param("id"))
+	if !ok || !h.annotate(c, doc) {
+		return
+	}
+
+	chunks, err := h.Chunks.chunks(c.Request.Context(), doc.ID)
+	if err != nil {
+		log.Println("Chunk Lookup Error:", err)
+		apierror.Write(c, http.StatusBadGateway, "Failed to load the document's chunks")
+		return
+	}
+	if quote, ok := models.TextBetween(chunks, start, end); ok {
+		input.Quote = quote
+	} else if len(chunks) > 0 && end > slices.MaxFunc(chunks, func(a, b models.Chunk) int { return a.End - b.End }).End {
+		apierror.Field(c, "end", "end is past the end of the document's text")
+		return
+	}
+	if input.Page == 0 {
+		for _, chunk := range chunks {
+			if chunk.Start <= start && start < chunk.End {
+				input.Page = chunk.Page
+				break
+			}
+		}
+	}
+	quote := strings.ToValidUTF8(input.Quote, "")
+	if len(quote) > maxAnnotationRange {
+		apierror.Field(c, "quote", "quote must be at most 10000 bytes")
+		return
+	}
+
+	annotation := models.Annotation{
+		ID:         "ann_" + uuid.NewString(),
+		DocumentID: doc.ID,
+		UserID:     middleware.UserID(c),
+		Kind:       input.Kind,
+		Page:       input.Page,
+		Start:      start,
+		End:        end,
+		Quote:      quote,
+		Body:       input.Body,
+	}
+	if err := h.Store.CreateAnnotation(c.Request.Context(), annotation); err != nil {
+		log.Println("Annotation Insert Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Failed to save the annotation")
+		return
+	}
+	if annotation.Kind == models.AnnotationComment {
+		auditDocument(c, h.Store, models.AuditDocumentCommented, doc.ID, fmt.Sprintf("comment %s on bytes %d to %d", annotation.ID, start, end))
+	}
+
+	created, err := h.Store.GetAnnotation(c.Request.Context(), annotation.ID)
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusCreated, created)
+}
+
+// --- GET /documents/:id/annotations ---
+// Everyone who can read a document sees all of its annotations, in the order of the text.
+// ?kind= lists only highlights or comments.
+func (h *AnnotationHandler) List(c *gin.Context) {
+	kind := c.Query("kind")
+	if kind != "" && !annotationKinds[kind] {
+		apierror.Field(c, "kind", "kind must be highlight or comment")
+		return
+	}
+	doc, ok := h.document(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	annotations, err := h.Store.ListAnnotations(c.Request.Context(), doc.ID, kind)
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"document_id": doc.ID, "annotations": annotations})
+}
+
+type AnnotationPatch struct {
+	Body string `json:"body"`
+}
+
+// --- PATCH /annotations/:id ---
+// Only the author can change the body, while they may still annotate the document
+func (h *AnnotationHandler) Update(c *gin.Context) {
+	var input AnnotationPatch
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Invalid(c, err)
+		return
+	}
+	input.Body = strings.TrimSpace(input.Body)
+	if len(input.Body) > maxAnnotationBody {
+		apierror.Field(c, "body", "body must be at most 10000 bytes")
+		return
+	}
+
+	annotation, doc, ok := h.find(c)
+	if !ok {
+		return
+	}
+	if annotation.UserID != middleware.UserID(c) {
+		apierror.Write(c, http.StatusForbidden, "Only its author can change an annotation")
+		return
+	}
+	if annotation.Kind == models.AnnotationComment && input.Body == "" {
+		apierror.Field(c, "body", "A comment needs a body")
+		return
+	}
+	if !h.annotate(c, doc) {
+		return
+	}
+
+	err := h.Store.UpdateAnnotation(c.Request.Context(), annotation.ID, input.Body)
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Annotation not found")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	updated, err := h.Store.GetAnnotation(c.Request.Context(), annotation.ID)
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// --- DELETE /annotations/:id ---
+// The author can delete an annotation, and so can whoever may change the document
+func (h *AnnotationHandler) Delete(c *gin.Context) {
+	annotation, doc, ok := h.find(c)
+	if !ok {
+		return
+	}
+	userID := middleware.UserID(c)
+	if annotation.UserID != userID {
+		if doc.SharedPermission != "" {
+			apierror.Write(c, http.StatusForbidden, "Only its author can delete this annotation")
+			return
+		}
+		if doc.UserID != userID {
+			role, ok := orgRole(c, h.Store, doc.OrgID)
+			if !ok {
+				return
+			}
+			if !canUpload(role) {
+				apierror.Write(c, http.StatusForbidden, "Only its author can delete this annotation")
+				return
+			}
+		}
+	}
+
+	err := h.Store.DeleteAnnotation(c.Request.Context(), annotation.ID)
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Annotation not found")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Annotation deleted"})
+}
+
+// document loads a document the caller can read, writing the error response when they can't
+func (h *AnnotationHandler) document(c *gin.Context, id string) (models.Document, bool) {
+	doc, err := h.Store.GetReadableDocument(c.Request.Context(), id, middleware.UserID(c))
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Document not found")
+		return doc, false
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return doc, false
+	}
+	return doc, true
+}
+
+// find loads the annotation of the request and its document, as though it didn't exist when
+// the caller can't read the document
+func (h *AnnotationHandler) find(c *gin.Context) (models.Annotation, models.Document, bool) {
+	var doc models.Document
+	annotation, err := h.Store.GetAnnotation(c.Request.Context(), c.Param("id"))
+	if err == nil {
+		doc, err = h.Store.GetReadableDocument(c.Request.Context(), annotation.DocumentID, middleware.UserID(c))
+	}
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Annotation not found")
+		return annotation, doc, false
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return annotation, doc, false
+	}
+	return annotation, doc, true
+}
+
+// annotate checks the caller may annotate a document they can read: its uploader, members of
+// its organization who aren't viewers and those it was shared with to comment on. It writes
+// the error response when they may not.
+func (h *AnnotationHandler) annotate(c *gin.Context, doc models.Document) bool {
+	switch doc.SharedPermission {
+	case models.PermissionComment:
+		return true
+	case models.PermissionRead:
+		apierror.Write(c, http.StatusForbidden, "This document was shared with you to read only")
+		return false
+	}
+	if doc.UserID == middleware.UserID(c) {
+		return true
+	}
+	role, ok := orgRole(c, h.Store, doc.OrgID)
+	if !ok {
+		return false
+	}
+	if !canUpload(role) {
+		apierror.Write(c, http.StatusForbidden, "Viewers can't annotate this organization's documents")
+		return false
+	}
+	return true
+}
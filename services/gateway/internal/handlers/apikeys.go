@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// keys look like "dsk_<43 random characters>", the prefix makes them easy to spot in leaked configs
+const (
+	apiKeyPrefix     = "dsk_"
+	apiKeyShownChars = 12
+	maxAPIKeyDays    = 365
+)
+
+var apiKeyScopes = map[string]bool{
+	models.ScopeUpload:          true,
+	models.ScopeDocumentsRead:   true,
+	models.ScopeDocumentsDelete: true,
+	models.ScopeJobsRead:        true,
+	models.ScopeJobsWrite:       true,
+}
+
+type APIKeyHandler struct {
+	Store storage.Store
+}
+
+// Constructor for the API key management endpoints
+func NewAPIKeyHandler(store storage.Store) *APIKeyHandler {
+	return &APIKeyHandler{Store: store}
+}
+
+type APIKeyInput struct {
+	Name          string   `json:"name" binding:"required"`
+	Scopes        []string `json:"scopes" binding:"required"`
+	ExpiresInDays int      `json:"expires_in_days"` // 0 means the key never expires
+}
+
+// --- POST /apikeys ---
+// The key itself is only returned here, it can't be recovered later
+func (h *APIKeyHandler) Create(c *gin.Context) {
+	var input APIKeyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Invalid(c, err)
+		return
+	}
+
+	if len(input.Scopes) == 0 {
+		apierror.Write(c, http.StatusBadRequest, "At least one scope is required")
+		return
+	}
+	for _, scope := range input.Scopes {
+		if !apiKeyScopes[scope] {
+			apierror.Write(c, http.StatusBadRequest, "Unknown scope: "+scope)
+			return
+		}
+	}
+	if input.ExpiresInDays < 0 || input.ExpiresInDays > maxAPIKeyDays {
+		apierror.Write(c, http.StatusBadRequest, "expires_in_days must be between 0 and 365")
+		return
+	}
+
+	raw := apiKeyPrefix + newOpaqueToken()
+	key := models.APIKey{
+		ID:        "key_" + uuid.NewString(),
+		UserID:    middleware.UserID(c),
+		Name:      input.Name,
+		Key:       raw,
+		Prefix:    raw[:apiKeyShownChars],
+		Scopes:    input.Scopes,
+		CreatedAt: time.Now().UTC(),
+	}
+	if input.ExpiresInDays > 0 {
+		expires := key.CreatedAt.Add(time.Duration(input.ExpiresInDays) * 24 * time.Hour)
+		key.ExpiresAt = &expires
+	}
+
+	if err := h.Store.CreateAPIKey(c.Request.Context(), key, middleware.HashAPIKey(raw)); err != nil {
+		log.Println("API Key Insert Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Failed to create API key")
+		return
+	}
+
+	c.JSON(http.StatusCreated, key)
+}
+
+// --- GET /apikeys ---
+// Revoked keys are listed too so there's a record of them
+func (h *APIKeyHandler) List(c *gin.Context) {
+	keys, err := h.Store.ListAPIKeys(c.Request.Context(), middleware.UserID(c))
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"api_keys": keys})
+}
+
+// --- DELETE /apikeys/:id ---
+func (h *APIKeyHandler) Revoke(c *gin.Context) {
+	err := h.Store.RevokeAPIKey(c.Request.Context(), c.Param("id"), middleware.UserID(c))
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "API key not found")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
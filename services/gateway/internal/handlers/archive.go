@@ -0,0 +1,351 @@
+package handlers
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Archive formats POST /upload can expand
+const (
+	archiveZip   = "zip"
+	archiveTar   = "tar"
+	archiveTarGz = "tar.gz"
+)
+
+// archiveFormat tells what kind of archive the file starting with head is, "" when it is none.
+// A gzip file is only taken for a tar.gz, the tar inside is checked when it is unpacked.
+func archiveFormat(head []byte, filename string) string {
+	switch {
+	case isArchive(head, filename):
+		return archiveZip
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return archiveTarGz
+	case len(head) >= 262 && string(head[257:262]) == "ustar":
+		return archiveTar
+	}
+	return ""
+}
+
+// archiveName is the archive's filename without its extension, what its collection is called
+func archiveName(filename string) string {
+	name := sanitizeFilename(filename)
+	lower := strings.ToLower(name)
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar", ".zip"} {
+		if strings.HasSuffix(lower, ext) {
+			name = name[:len(name)-len(ext)]
+			break
+		}
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "archive"
+	}
+	return truncate(name, maxCollectionNameLen)
+}
+
+// safeEntryName reports whether an entry's path stays inside the archive, no absolute path,
+// drive letter or .. leading out of it. Nothing is unpacked by name, but an archive that tries
+// is refused whole rather than trusted with the rest.
+func safeEntryName(name string) bool {
+	name = strings.ReplaceAll(name, `\`, "/")
+	if strings.HasPrefix(name, "/") || (len(name) >= 2 && name[1] == ':') {
+		return false
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// skippedEntry leaves out folders, hidden files and the resource forks macOS adds
+func skippedEntry(name string) bool {
+	name = strings.ReplaceAll(name, `\`, "/")
+	return strings.HasSuffix(name, "/") || strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(path.Base(name), ".")
+}
+
+// unpacker spools the files of one archive to temp files, stopping at the first sign of a
+// bomb: more files than a batch may hold, or more bytes than the batch limit or the archive's
+// size times MaxArchiveRatio, whichever is less. The sizes the archive claims are checked up
+// front where there are any, the bytes actually read are counted regardless.
+type unpacker struct {
+	h      *BatchHandler
+	budget int64 // bytes it may unpack to
+	read   int64
+	files  []batchFile
+}
+
+// unpack lists what the archive holds, ready for ingest. It fails without keeping anything
+// when the archive is unreadable or looks like a bomb.
+func (h *BatchHandler) unpack(src io.ReaderAt, size int64, format string) ([]batchFile, *apiFailure) {
+	u := &unpacker{h: h, budget: min(h.maxSize, size*int64(h.maxRatio))}
+	var failure *apiFailure
+	switch format {
+	case archiveZip:
+		failure = u.zip(src, size)
+	case archiveTar:
+		failure = u.tar(io.NewSectionReader(src, 0, size))
+	case archiveTarGz:
+		gz, err := gzip.NewReader(io.NewSectionReader(src, 0, size))
+		if err != nil {
+			failure = &apiFailure{Status: http.StatusBadRequest, Message: "Unable to read the archive"}
+			break
+		}
+		failure = u.tar(gz)
+	}
+	if failure == nil && len(u.files) == 0 {
+		failure = &apiFailure{Status: http.StatusBadRequest, Message: "The archive holds no files"}
+	}
+	if failure != nil {
+		u.discard()
+		return nil, failure
+	}
+	return u.files, nil
+}
+
+func (u *unpacker) zip(src io.ReaderAt, size int64) *apiFailure {
+	archive, err := zip.NewReader(src, size)
+	if err != nil {
+		return &apiFailure{Status: http.StatusBadRequest, Message: "Unable to read the archive"}
+	}
+	// what the entries claim goes first, a bomb is turned away before anything is inflated
+	var claimed uint64
+	var entries []*zip.File
+	for _, entry := range archive.File {
+		if !safeEntryName(entry.Name) {
+			return unsafeEntry(entry.Name)
+		}
+		if skippedEntry(entry.Name) || entry.FileInfo().IsDir() {
+			continue
+		}
+		entries = append(entries, entry)
+		if entry.UncompressedSize64 <= uint64(u.h.ingest.rules.maxSize) {
+			claimed += entry.UncompressedSize64
+		}
+	}
+	if len(entries) > u.h.maxFiles {
+		return u.tooManyFiles()
+	}
+	if claimed > uint64(u.budget) {
+		return u.tooLarge()
+	}
+
+	for _, entry := range entries {
+		name := strings.ReplaceAll(entry.Name, `\`, "/")
+		if entry.UncompressedSize64 > uint64(u.h.ingest.rules.maxSize) {
+			u.files = append(u.files, batchFile{name: name, err: u.h.ingest.rules.tooLargeError()})
+			continue
+		}
+		r, err := entry.Open()
+		if err != nil {
+			u.files = append(u.files, batchFile{name: name, err: "Unable to read file"})
+			continue
+		}
+		failure := u.spool(name, r)
+		r.Close()
+		if failure != nil {
+			return failure
+		}
+	}
+	return nil
+}
+
+func (u *unpacker) tar(src io.Reader) *apiFailure {
+	// headers and skipped entries count too, all of it has to be inflated to get through
+	limited := &io.LimitedReader{R: src, N: u.budget + 1}
+	archive := tar.NewReader(limited)
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if limited.N <= 0 {
+			return u.tooLarge()
+		}
+		if err != nil {
+			return &apiFailure{Status: http.StatusBadRequest, Message: "Unable to read the archive"}
+		}
+		if !safeEntryName(header.Name) || (header.Typeflag == tar.TypeLink && !safeEntryName(header.Linkname)) {
+			return unsafeEntry(header.Name)
+		}
+		// links and devices aren't documents, only regular files are taken
+		if header.Typeflag != tar.TypeReg || skippedEntry(header.Name) {
+			continue
+		}
+		if len(u.files) == u.h.maxFiles {
+			return u.tooManyFiles()
+		}
+		name := strings.ReplaceAll(header.Name, `\`, "/")
+		if header.Size > u.h.ingest.rules.maxSize {
+			u.files = append(u.files, batchFile{name: name, err: u.h.ingest.rules.tooLargeError()})
+			continue
+		}
+		if failure := u.spool(name, archive); failure != nil {
+			return failure
+		}
+		if limited.N <= 0 {
+			return u.tooLarge()
+		}
+	}
+}
+
+// spool copies one entry to a temp file, read through the limits in case the archive lied
+func (u *unpacker) spool(name string, r io.Reader) *apiFailure {
+	tmp, err := os.CreateTemp("", "docstream-archive-*")
+	if err != nil {
+		log.Println("Archive Spool Error:", err)
+		return &apiFailure{Status: http.StatusInternalServerError, Message: "Unable to unpack the archive"}
+	}
+	spooled := &tempFile{File: tmp}
+	limit := min(u.h.ingest.rules.maxSize, u.budget-u.read)
+	n, err := io.Copy(tmp, io.LimitReader(r, limit+1))
+	u.read += n
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	switch {
+	case err != nil:
+		spooled.Close()
+		u.files = append(u.files, batchFile{name: name, err: "Unable to read file"})
+	case u.read > u.budget:
+		spooled.Close()
+		return u.tooLarge()
+	case n > u.h.ingest.rules.maxSize:
+		spooled.Close()
+		u.files = append(u.files, batchFile{name: name, err: u.h.ingest.rules.tooLargeError()})
+	default:
+		u.files = append(u.files, batchFile{name: name, spooled: spooled, size: n})
+	}
+	return nil
+}
+
+// discard removes what was spooled so far
+func (u *unpacker) discard() {
+	for _, f := range u.files {
+		if f.spooled != nil {
+			f.spooled.Close()
+		}
+	}
+}
+
+func (u *unpacker) tooManyFiles() *apiFailure {
+	return &apiFailure{Status: http.StatusBadRequest, Message: fmt.Sprintf("An archive can hold at most %d files", u.h.maxFiles)}
+}
+
+func (u *unpacker) tooLarge() *apiFailure {
+	return &apiFailure{Status: http.StatusRequestEntityTooLarge, Message: fmt.Sprintf("The archive unpacks to more than %d bytes, the limit for this archive", u.budget)}
+}
+
+func unsafeEntry(name string) *apiFailure {
+	return &apiFailure{Status: http.StatusBadRequest, Message: fmt.Sprintf("The archive has an entry outside of it: %q", name)}
+}
+
+// expand answers POST /upload with expand set for an archive: every file in it becomes a document
+// in a new collection named after the archive, inside the collection the upload names if it
+// names one. The files are followed as a batch, a file that can't be taken has its error there.
+func (h *BatchHandler) expand(c *gin.Context, target uploadTarget, filename string, src io.ReaderAt, size int64, format string) {
+	files, failure := h.unpack(src, size, format)
+	if failure != nil {
+		failure.respond(c)
+		return
+	}
+	defer func() {
+		// h.upload closes what it ingests, this is whatever it never got to
+		for _, f := range files {
+			if f.spooled != nil {
+				f.spooled.Close()
+			}
+		}
+	}()
+
+	ctx := c.Request.Context()
+	col, failure := archiveCollection(ctx, h.Store, target, archiveName(filename))
+	if failure != nil {
+		failure.respond(c)
+		return
+	}
+	batch := models.Batch{ID: "bat_" + uuid.NewString(), UserID: target.UserID, OrgID: target.OrgID}
+	if err := h.Store.CreateBatch(ctx, batch); err != nil {
+		log.Println("Batch Insert Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Failed to record batch")
+		return
+	}
+
+	for i, f := range files {
+		fileTarget := target
+		fileTarget.CollectionID = col.ID
+		// where in the archive it was, folders included, the collection has them all side by side
+		fileTarget.Metadata = maps.Clone(target.Metadata)
+		if fileTarget.Metadata == nil {
+			fileTarget.Metadata = map[string]string{}
+		}
+		fileTarget.Metadata["archive_path"] = truncate(f.name, maxMetadataValueLength)
+
+		item := h.upload(ctx, fileTarget, f)
+		files[i].spooled = nil
+		item.Position = i
+		if err := h.Store.AddBatchItem(ctx, batch.ID, item); err != nil {
+			log.Printf("Failed to record item %d of batch %s: %v\n", i, batch.ID, err)
+		}
+	}
+
+	loaded, err := h.Store.GetBatch(ctx, batch.ID, target.UserID)
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	summarize(&loaded)
+	c.JSON(http.StatusOK, gin.H{
+		"message":    fmt.Sprintf("Archive expanded, %d of its files are processing", loaded.Counts[models.JobStatusQueued]+loaded.Counts[models.JobStatusPending]),
+		"collection": col,
+		"batch":      loaded,
+	})
+}
+
+// archiveCollection creates the collection an expanded archive's files go in, under parentID
+// when the upload names a collection
+func archiveCollection(ctx context.Context, store storage.Store, target uploadTarget, name string) (models.Collection, *apiFailure) {
+	col := models.Collection{ID: "col_" + uuid.NewString(), UserID: target.UserID, OrgID: target.OrgID, ParentID: target.CollectionID, Name: name}
+	if col.ParentID != "" {
+		// the upload's target was checked already, what is left is how deep the new one sits
+		n := 0
+		for id := col.ParentID; id != "" && n < maxCollectionDepth; n++ {
+			parent, err := store.GetCollectionByID(ctx, id)
+			if err != nil {
+				return col, &apiFailure{Status: http.StatusInternalServerError, Message: "Database error"}
+			}
+			id = parent.ParentID
+		}
+		if n >= maxCollectionDepth {
+			return col, &apiFailure{Status: http.StatusBadRequest, Message: fmt.Sprintf("collections can be nested at most %d deep, the archive's would be deeper", maxCollectionDepth)}
+		}
+	}
+	if err := store.CreateCollection(ctx, col); err != nil {
+		log.Println("Collection Insert Error:", err)
+		return col, &apiFailure{Status: http.StatusInternalServerError, Message: "Failed to create collection"}
+	}
+	created, err := store.GetCollectionByID(ctx, col.ID)
+	if err != nil {
+		return col, &apiFailure{Status: http.StatusInternalServerError, Message: "Database error"}
+	}
+	return created, nil
+}
@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestSafeEntryName(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"report.pdf", true},
+		{"2024/q1/report.pdf", true},
+		{"a..b.pdf", true},
+		{"notes/..hidden.txt", true},
+		{"./report.pdf", true},
+
+		{"../report.pdf", false},
+		{"docs/../../report.pdf", false},
+		{"docs/..", false},
+		{"/etc/passwd", false},
+		{`..\report.pdf`, false},
+		{`docs\..\..\report.pdf`, false},
+		{`\windows\system.ini`, false},
+		{`C:\report.pdf`, false},
+		{"c:/report.pdf", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := safeEntryName(tt.name); got != tt.want {
+				t.Errorf("safeEntryName(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+type entry struct {
+	name     string
+	body     []byte
+	typeflag byte   // tar only, a regular file when zero
+	linkname string // tar only
+}
+
+func zipArchive(t *testing.T, entries ...entry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, e := range entries {
+		f, err := w.Create(e.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write(e.body)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func tarArchive(t *testing.T, gzipped bool, entries ...entry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var gz *gzip.Writer
+	w := tar.NewWriter(&buf)
+	if gzipped {
+		gz = gzip.NewWriter(&buf)
+		w = tar.NewWriter(gz)
+	}
+	for _, e := range entries {
+		header := &tar.Header{Name: e.name, Mode: 0o644, Size: int64(len(e.body)), Typeflag: e.typeflag, Linkname: e.linkname}
+		if header.Typeflag == 0 {
+			header.Typeflag = tar.TypeReg
+		} else {
+			header.Size = 0
+		}
+		if err := w.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		w.Write(e.body)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if gz != nil {
+		gz.Close()
+	}
+	return buf.Bytes()
+}
+
+func testBatchHandler() *BatchHandler {
+	return &BatchHandler{
+		ingest:   ingester{rules: uploadRules{maxSize: 1 << 20}},
+		maxSize:  4 << 20,
+		maxFiles: 3,
+		maxRatio: 100,
+	}
+}
+
+func TestUnpack(t *testing.T) {
+	small := []byte("%PDF-1.7 hello")
+	zeros := make([]byte, 2<<20) // compresses to almost nothing, unpacks over the per-file limit
+
+	tests := []struct {
+		name       string
+		format     string
+		archive    func(t *testing.T) []byte
+		wantStatus int      // 0 when it unpacks
+		wantFiles  []string // what was spooled
+		wantErrors []string // files listed with an error instead
+	}{
+		{
+			name:   "zip",
+			format: archiveZip,
+			archive: func(t *testing.T) []byte {
+				return zipArchive(t, entry{name: "a.pdf", body: small}, entry{name: "dir/b.txt", body: small})
+			},
+			wantFiles: []string{"a.pdf", "dir/b.txt"},
+		},
+		{
+			name:   "zip skips folders and hidden files",
+			format: archiveZip,
+			archive: func(t *testing.T) []byte {
+				return zipArchive(t, entry{name: "dir/"}, entry{name: "__MACOSX/._a.pdf", body: small}, entry{name: ".DS_Store", body: small}, entry{name: "dir/a.pdf", body: small})
+			},
+			wantFiles: []string{"dir/a.pdf"},
+		},
+		{
+			name:   "zip slip",
+			format: archiveZip,
+			archive: func(t *testing.T) []byte {
+				return zipArchive(t, entry{name: "a.pdf", body: small}, entry{name: "../../etc/cron.d/evil", body: small})
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "zip absolute path",
+			format:     archiveZip,
+			archive:    func(t *testing.T) []byte { return zipArchive(t, entry{name: "/etc/passwd", body: small}) },
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "zip with backslashes",
+			format:     archiveZip,
+			archive:    func(t *testing.T) []byte { return zipArchive(t, entry{name: `docs\..\..\evil.pdf`, body: small}) },
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "zip with too many files",
+			format: archiveZip,
+			archive: func(t *testing.T) []byte {
+				return zipArchive(t, entry{name: "1.pdf", body: small}, entry{name: "2.pdf", body: small}, entry{name: "3.pdf", body: small}, entry{name: "4.pdf", body: small})
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "zip bomb",
+			format: archiveZip,
+			archive: func(t *testing.T) []byte {
+				return zipArchive(t, entry{name: "1.bin", body: zeros[:1<<20]}, entry{name: "2.bin", body: zeros[:1<<20]})
+			},
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:   "zip file over the upload limit",
+			format: archiveZip,
+			archive: func(t *testing.T) []byte {
+				return zipArchive(t, entry{name: "a.pdf", body: small}, entry{name: "big.bin", body: zeros})
+			},
+			wantFiles:  []string{"a.pdf"},
+			wantErrors: []string{"big.bin"},
+		},
+		{
+			name:       "empty zip",
+			format:     archiveZip,
+			archive:    func(t *testing.T) []byte { return zipArchive(t, entry{name: "dir/"}) },
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "tar",
+			format: archiveTar,
+			archive: func(t *testing.T) []byte {
+				return tarArchive(t, false, entry{name: "a.pdf", body: small}, entry{name: "b.pdf", body: small})
+			},
+			wantFiles: []string{"a.pdf", "b.pdf"},
+		},
+		{
+			name:       "tar slip",
+			format:     archiveTar,
+			archive:    func(t *testing.T) []byte { return tarArchive(t, false, entry{name: "../evil.pdf", body: small}) },
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "tar hard link out of the archive",
+			format: archiveTar,
+			archive: func(t *testing.T) []byte {
+				return tarArchive(t, false, entry{name: "passwd", typeflag: tar.TypeLink, linkname: "../../../etc/passwd"})
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "tar symlinks are left out",
+			format: archiveTar,
+			archive: func(t *testing.T) []byte {
+				return tarArchive(t, false, entry{name: "link", typeflag: tar.TypeSymlink, linkname: "/etc/passwd"}, entry{name: "a.pdf", body: small})
+			},
+			wantFiles: []string{"a.pdf"},
+		},
+		{
+			name:   "tar with too many files",
+			format: archiveTar,
+			archive: func(t *testing.T) []byte {
+				return tarArchive(t, false, entry{name: "1.pdf", body: small}, entry{name: "2.pdf", body: small}, entry{name: "3.pdf", body: small}, entry{name: "4.pdf", body: small})
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "tar.gz bomb",
+			format: archiveTarGz,
+			archive: func(t *testing.T) []byte {
+				return tarArchive(t, true, entry{name: "1.bin", body: zeros[:1<<20]}, entry{name: "2.bin", body: zeros[:1<<20]})
+			},
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:      "tar.gz",
+			format:    archiveTarGz,
+			archive:   func(t *testing.T) []byte { return tarArchive(t, true, entry{name: "a.pdf", body: small}) },
+			wantFiles: []string{"a.pdf"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := tt.archive(t)
+			files, failure := testBatchHandler().unpack(bytes.NewReader(archive), int64(len(archive)), tt.format)
+			if tt.wantStatus != 0 {
+				if failure == nil {
+					t.Fatalf("unpack = %d files, want a %d", len(files), tt.wantStatus)
+				}
+				if failure.Status != tt.wantStatus {
+					t.Errorf("unpack = %d %s, want %d", failure.Status, failure.Message, tt.wantStatus)
+				}
+				return
+			}
+			if failure != nil {
+				t.Fatalf("unpack = %d %s", failure.Status, failure.Message)
+			}
+			var spooled, failed []string
+			for _, f := range files {
+				if f.err != "" {
+					failed = append(failed, f.name)
+					continue
+				}
+				spooled = append(spooled, f.name)
+				if _, err := os.Stat(f.spooled.Name()); err != nil {
+					t.Errorf("%s wasn't spooled: %v", f.name, err)
+				}
+				f.spooled.Close()
+			}
+			if !slices.Equal(spooled, tt.wantFiles) || !slices.Equal(failed, tt.wantErrors) {
+				t.Errorf("unpack spooled %q and failed %q, want %q and %q", spooled, failed, tt.wantFiles, tt.wantErrors)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/llm"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultAskTopK = 5
+	maxAskTopK     = 20
+	// maxContextChars keeps the retrieved chunks from outgrowing the model's context window, a
+	// model's max_input_tokens can only lower it
+	maxContextChars = 16000
+	// askTimeout bounds the whole answer, retrieval has its own timeout
+	askTimeout = 2 * time.Minute
+)
+
+const askSystemPrompt = `You answer questions about the user's documents using only the numbered sources below.
+Cite the sources you use inline as [1], [2] and so on.
+If the sources don't contain the answer, say you don't know instead of guessing.`
+
+type AskHandler struct {
+	Search *SearchHandler
+	LLM    llm.Provider
+}
+
+// Constructor for the question answering endpoint, a nil provider turns it off
+func NewAskHandler(search *SearchHandler, provider llm.Provider) *AskHandler {
+	return &AskHandler{Search: search, LLM: provider}
+}
+
+type AskInput struct {
+	Question    string   `json:"question" binding:"required"`
+	TopK        int      `json:"top_k"`
+	Mode        string   `json:"mode"` // how the sources are retrieved, as for /search
+	Rerank      *bool    `json:"rerank"`
+	OrgID       string   `json:"org_id"`
+	DocumentIDs []string `json:"document_ids"`
+	Tags        []string `json:"tags"`
+	Languages   []string `json:"languages"`
+	Entities    []string `json:"entities"`
+	// Model answers with an allowed generation model, EmbeddingModel retrieves with an allowed
+	// embedding model, see GET /models
+	Model          string `json:"model"`
+	EmbeddingModel string `json:"embedding_model"`
+}
+
+var citationPattern = regexp.MustCompile(`\[(\d+)\]`)
+
+// --- POST /ask ---
+// Retrieves the chunks closest to the question, hands them to the LLM and streams
+// the answer back as server-sent events:
+//
+//	event: token  data: {"text": "..."}       a piece of the answer, in order
+//	event: done   data: {"answer", "model", "sources", "citations"}
+//	event: error  data: {"error": "..."}      the answer broke off
+//
+// Each citation ties a sentence of the answer that cites [n] to the passage of source n it rests
+// on, with its offsets in the document's text and the chunk_id GET /chunks/:id shows it by.
+// Bad input is still answered with a plain JSON error before the stream starts.
+func (h *AskHandler) Ask(c *gin.Context) {
+	if h.LLM == nil {
+		apierror.Write(c, http.StatusServiceUnavailable, "Question answering is not enabled on this server")
+		return
+	}
+
+	var input AskInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Invalid(c, err)
+		return
+	}
+	if input.TopK == 0 {
+		input.TopK = defaultAskTopK
+	}
+	if input.TopK < 1 || input.TopK > maxAskTopK {
+		apierror.Write(c, http.StatusBadRequest, "top_k must be between 1 and "+strconv.Itoa(maxAskTopK))
+		return
+	}
+
+	results, ok := h.Search.search(c, SearchInput{
+		Query:          input.Question,
+		Mode:           input.Mode,
+		Rerank:         input.Rerank,
+		EmbeddingModel: input.EmbeddingModel,
+		Limit:          input.TopK,
+		OrgID:          input.OrgID,
+		DocumentIDs:    input.DocumentIDs,
+		Tags:           input.Tags,
+		Languages:      input.Languages,
+		Entities:       input.Entities,
+	})
+	if !ok {
+		return
+	}
+
+	// the search checked the caller is in the organization whose plan this goes by
+	ctx := c.Request.Context()
+	plan, failure := accountPlan(ctx, h.Search.Store, middleware.UserID(c), input.OrgID)
+	if failure != nil {
+		failure.respond(c)
+		return
+	}
+	provider, model, failure := generator(ctx, h.Search.Store, plan, h.LLM, "model", input.Model)
+	if failure != nil {
+		failure.respond(c)
+		return
+	}
+
+	messages, sources := buildPrompt(input.Question, nil, results, sourceBudget(model))
+	answer, ok := h.answer(c, provider, input.OrgID, messages, sources)
+	if !ok {
+		return
+	}
+	citations := cite(answer, sources, results)
+	c.SSEvent("done", gin.H{"answer": answer, "model": provider.Model(), "sources": sources, "citations": citations})
+	c.Writer.Flush()
+}
+
+// answer starts the event stream and streams provider's answer to messages as token events,
+// returning all of it and marking the sources it cites. It reports false after writing an error
+// event, or when the client went away. The done event is up to the caller. The tokens are
+// metered against the caller in orgID, an answer cut short included.
+func (h *AskHandler) answer(c *gin.Context, provider llm.Provider, orgID string, messages []llm.Message, sources []models.Source) (string, bool) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // keep nginx from holding the stream back
+	c.Status(http.StatusOK)
+
+	if len(sources) == 0 {
+		return "I couldn't find anything in your documents about that.", true
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), askTimeout)
+	defer cancel()
+
+	var answer strings.Builder
+	usage, err := provider.Stream(ctx, messages, func(token string) error {
+		answer.WriteString(token)
+		c.SSEvent("token", gin.H{"text": token})
+		c.Writer.Flush()
+		// stop generating once the client has gone
+		return c.Request.Context().Err()
+	})
+	meterLLM(c, h.Search.Store, orgID, usage, messages, answer.String())
+	if err != nil {
+		if c.Request.Context().Err() == nil {
+			log.Println("LLM Error:", err)
+			c.SSEvent("error", gin.H{"error": "Failed to generate an answer"})
+			c.Writer.Flush()
+		}
+		return "", false
+	}
+
+	markCited(sources, answer.String())
+	return answer.String(), true
+}
+
+// buildPrompt numbers the retrieved chunks and puts them in front of the question, leaving out
+// whatever doesn't fit into budget characters. history is the conversation so far, it goes between
+// the instructions and the question.
+func buildPrompt(question string, history []llm.Message, results []SearchResult, budget int) ([]llm.Message, []models.Source) {
+	var sourcesText strings.Builder
+	sources := []models.Source{}
+	for _, r := range results {
+		n := len(sources) + 1
+		header := fmt.Sprintf("[%d] %s", n, r.Filename)
+		if r.Page > 0 {
+			header += fmt.Sprintf(", page %d", r.Page)
+		}
+		entry := header + "\n" + strings.TrimSpace(r.text) + "\n\n"
+		if sourcesText.Len()+len(entry) > budget && len(sources) > 0 {
+			break
+		}
+		sourcesText.WriteString(entry)
+		sources = append(sources, models.Source{
+			N:          n,
+			DocumentID: r.DocumentID,
+			Filename:   r.Filename,
+			Page:       r.Page,
+			ChunkIndex: r.ChunkIndex,
+			ChunkID:    r.ChunkID,
+			Score:      r.Score,
+		})
+	}
+
+	messages := []llm.Message{{Role: llm.RoleSystem, Content: askSystemPrompt}}
+	messages = append(messages, history...)
+	messages = append(messages, llm.Message{Role: llm.RoleUser, Content: "Sources:\n\n" + sourcesText.String() + "Question: " + question})
+	return messages, sources
+}
+
+// markCited flags the sources the answer refers to as [n]
+func markCited(sources []models.Source, answer string) {
+	for _, m := range citationPattern.FindAllStringSubmatch(answer, -1) {
+		n, _ := strconv.Atoi(m[1])
+		if n >= 1 && n <= len(sources) {
+			sources[n-1].Cited = true
+		}
+	}
+}
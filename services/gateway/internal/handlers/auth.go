@@ -1,52 +1,81 @@
 package handlers
 
 import (
-	"database/sql"
+	"context"
+	"errors"
+	"io"
+	"log"
 	"net/http"
-	"os"
-	"time"
-
+	"sync"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+	"github.com/dhruvkshah75/docstream/gateway/internal/metrics"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/passwords"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type AuthHandler struct {
-	DB *sql.DB
+	Store     storage.Store
+	guard     *loginGuard
+	passwords *passwords.Policy
 }
 
 // Constructor to create a DB connection 
-func NewAuthHandler(db *sql.DB) *AuthHandler {
-	return &AuthHandler{DB: db}
+func NewAuthHandler(store storage.Store, login config.Login, policy *passwords.Policy) *AuthHandler {
+	return &AuthHandler{Store: store, guard: newLoginGuard(store, login), passwords: policy}
 }
 
+// dummyHash is compared against for emails without an account, at the cost real hashes have
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, err := bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+})
+
 type AuthInput struct {
 	Email    string `json:"email" binding:"required"`
 	Password string `json:"password" binding:"required"`
 }
 
+// SignupInput is checked harder than AuthInput, accounts from before the checks still have to sign in
+type SignupInput struct {
+	Email    string `json:"email" binding:"required,email,max=254"`
+	Password string `json:"password" binding:"required"`
+}
+
 // --- SIGNUP ---
 func (h *AuthHandler) Signup(c *gin.Context) {
-	var input AuthInput
+	var input SignupInput
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apierror.Invalid(c, err)
+		return
+	}
+	if problem := h.passwords.Check(c.Request.Context(), input.Password); problem != "" {
+		apierror.Field(c, "password", "password "+problem)
 		return
 	}
 
 	// Hash the password (Never store plain text!)
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		apierror.Write(c, http.StatusInternalServerError, "Failed to hash password")
 		return
 	}
 
 	// Insert into DB
-	query := `INSERT INTO users (email, password) VALUES (?, ?)`
-	_, err = h.DB.Exec(query, input.Email, string(hashedPassword))
-	
-	if err != nil {
-		// This likely means the email already exists (UNIQUE constraint)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "User already exists"})
+	_, err = h.Store.CreateUser(c.Request.Context(), input.Email, string(hashedPassword))
+	if errors.Is(err, storage.ErrDuplicate) {
+		apierror.Write(c, http.StatusBadRequest, "User already exists")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
 		return
 	}
 
@@ -57,48 +86,156 @@ func (h *AuthHandler) Signup(c *gin.Context) {
 func (h *AuthHandler) Login(c *gin.Context) {
 	var input AuthInput
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apierror.Invalid(c, err)
 		return
 	}
 
-	// Find user by email
-	var storedHash string
-	var userID int
-	
-	query := `SELECT id, password FROM users WHERE email = ?`
-	err := h.DB.QueryRow(query, input.Email).Scan(&userID, &storedHash)
-
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+	pair, failure := h.login(c.Request.Context(), input.Email, input.Password, c.ClientIP(), c.Request.UserAgent())
+	if failure != nil {
+		failure.respond(c)
 		return
+	}
+	c.JSON(http.StatusOK, pair)
+}
+
+// login checks the password of a sign in from ip, the gRPC Login goes through it too
+func (h *AuthHandler) login(ctx context.Context, email, password, ip, userAgent string) (tokenPair, *apiFailure) {
+	// Too many failures for this email or IP, make them wait before even checking the password
+	wait, locked, err := h.guard.wait(ctx, email, ip)
+	if err != nil {
+		return tokenPair{}, &apiFailure{Status: http.StatusInternalServerError, Message: "Database error"}
+	}
+	if wait > 0 {
+		metrics.Auth("login", false)
+		msg := "Too many failed login attempts, try again later"
+		if locked {
+			msg = "Account temporarily locked after too many failed login attempts"
+		}
+		return tokenPair{}, &apiFailure{Status: http.StatusTooManyRequests, Message: msg, RetryAfter: wait}
+	}
+
+	// Find user by email
+	user, err := h.Store.GetUserByEmail(ctx, email)
+	if errors.Is(err, storage.ErrNotFound) {
+		// as slow as a wrong password, or the response time tells which emails have accounts
+		bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+		metrics.Auth("login", false)
+		h.guard.fail(ctx, email, ip, nil)
+		return tokenPair{}, &apiFailure{Status: http.StatusUnauthorized, Message: "Invalid email or password"}
 	} else if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
-		return
+		return tokenPair{}, &apiFailure{Status: http.StatusInternalServerError, Message: "Database error"}
 	}
 
 	// Compare the provided password with the stored hash
-	if err := bcrypt.CompareHashAndPassword([]byte(storedHash), []byte(input.Password)); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		metrics.Auth("login", false)
+		h.guard.fail(ctx, email, ip, &user.ID)
+		return tokenPair{}, &apiFailure{Status: http.StatusUnauthorized, Message: "Invalid email or password"}
+	}
+	// only tell those who know the password that an admin suspended the account
+	if user.SuspendedAt != nil {
+		metrics.Auth("login", false)
+		return tokenPair{}, &apiFailure{Status: http.StatusForbidden, Message: "Account suspended"}
+	}
+
+	// Generate a short-lived access token plus a refresh token to renew it
+	pair, err := issueTokens(ctx, h.Store, user.ID, userAgent, ip)
+	if err != nil {
+		return tokenPair{}, &apiFailure{Status: http.StatusInternalServerError, Message: "Failed to generate token"}
+	}
+
+	h.guard.succeed(ctx, email)
+	metrics.Auth("login", true)
+	return pair, nil
+}
+
+type RefreshInput struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// --- REFRESH ---
+// Every refresh token works exactly once, the response carries its replacement
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var input RefreshInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Invalid(c, err)
 		return
 	}
 
-	// Generate JWT Token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub": userID,
-		"exp": time.Now().Add(time.Hour * 24 * 7).Unix(), // 7 days
-	})
+	pair, failure := h.refresh(c.Request.Context(), input.RefreshToken)
+	if failure != nil {
+		failure.respond(c)
+		return
+	}
+	c.JSON(http.StatusOK, pair)
+}
 
-	// Sign the token with a secret key
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		secret = "default_secret_dont_use_in_prod" 
+// refresh swaps a refresh token for a new pair, shared with the gRPC Refresh
+func (h *AuthHandler) refresh(ctx context.Context, token string) (tokenPair, *apiFailure) {
+	pair, err := rotateRefreshToken(ctx, h.Store, token)
+	switch {
+	case errors.Is(err, storage.ErrTokenReused):
+		metrics.Auth("refresh", false)
+		log.Println("Refresh token reuse detected, revoked token family")
+		return tokenPair{}, &apiFailure{Status: http.StatusUnauthorized, Message: "Refresh token already used, please log in again"}
+	case errors.Is(err, storage.ErrSessionRevoked):
+		metrics.Auth("refresh", false)
+		return tokenPair{}, &apiFailure{Status: http.StatusUnauthorized, Message: "Session was logged out, please log in again"}
+	case errors.Is(err, storage.ErrNotFound), errors.Is(err, storage.ErrTokenExpired):
+		metrics.Auth("refresh", false)
+		return tokenPair{}, &apiFailure{Status: http.StatusUnauthorized, Message: "Invalid or expired refresh token"}
+	case err != nil:
+		return tokenPair{}, &apiFailure{Status: http.StatusInternalServerError, Message: "Failed to refresh token"}
 	}
-	
-	tokenString, err := token.SignedString([]byte(secret))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+
+	metrics.Auth("refresh", true)
+	return pair, nil
+}
+
+type LogoutInput struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// --- LOGOUT ---
+// Ends the bearer token's session, its access and refresh tokens stop working right away.
+// Tokens from before sessions only revoke themselves, plus the refresh token family from
+// the body when there is one, so the session can't be renewed
+func (h *AuthHandler) Logout(c *gin.Context) {
+	var input LogoutInput
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		apierror.Invalid(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"token": tokenString})
-}
\ No newline at end of file
+	userID := middleware.UserID(c)
+	if jti := middleware.TokenID(c); jti != "" {
+		if err := h.Store.RevokeAccessToken(c.Request.Context(), jti, userID, middleware.TokenExpiry(c)); err != nil {
+			log.Println("Token Revocation Error:", err)
+			apierror.Write(c, http.StatusInternalServerError, "Failed to revoke token")
+			return
+		}
+	}
+	if sid := middleware.SessionID(c); sid != "" {
+		// ErrNotFound is a session that ended already, logging out twice is fine
+		if err := h.Store.RevokeSession(c.Request.Context(), sid, userID); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			log.Println("Session Revocation Error:", err)
+			apierror.Write(c, http.StatusInternalServerError, "Failed to end session")
+			return
+		}
+	}
+	if input.RefreshToken != "" {
+		if err := h.Store.RevokeRefreshToken(c.Request.Context(), userID, hashToken(input.RefreshToken)); err != nil {
+			log.Println("Refresh Token Revocation Error:", err)
+			apierror.Write(c, http.StatusInternalServerError, "Failed to revoke refresh token")
+			return
+		}
+	}
+
+	entry := models.AuditEntry{UserID: &userID, Event: models.AuditLogout, IP: c.ClientIP()}
+	if err := h.Store.CreateAuditEntry(c.Request.Context(), entry); err != nil {
+		log.Println("Failed to write audit entry:", err)
+	}
+
+	metrics.Auth("logout", true)
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
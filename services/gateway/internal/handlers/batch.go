@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+	"github.com/dhruvkshah75/docstream/gateway/internal/envelope"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/objectstore"
+	"github.com/dhruvkshah75/docstream/gateway/internal/queue"
+	"github.com/dhruvkshah75/docstream/gateway/internal/scanner"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// BatchHandler takes many files in one request, each becomes a document and a job of its own
+type BatchHandler struct {
+	Store    storage.Store
+	ingest   ingester
+	maxSize  int64
+	maxFiles int
+	maxRatio int
+}
+
+// Constructor for the batch upload endpoints
+func NewBatchHandler(store storage.Store, objects objectstore.Store, keys *envelope.Keyring, publisher queue.Publisher, virusScanner *scanner.Scanner, cfg *config.Config) *BatchHandler {
+	return &BatchHandler{
+		Store:    store,
+		ingest:   ingester{store: store, objects: objects, keys: keys, publisher: publisher, scanner: virusScanner, rules: newUploadRules(cfg), kind: "batch"},
+		maxSize:  int64(cfg.Documents.MaxBatchSize),
+		maxFiles: cfg.Documents.MaxBatchFiles,
+		maxRatio: cfg.Documents.MaxArchiveRatio,
+	}
+}
+
+// batchFile is one file of a batch before it is ingested, either a part of the form, an
+// entry of a zip archive in it or a file of an expanded archive spooled to disk already.
+// A file already known to be unusable only has an error.
+type batchFile struct {
+	name    string
+	part    *multipart.FileHeader
+	entry   *zip.File
+	spooled *tempFile
+	size    int64
+	err     string
+}
+
+// isArchive tells a zip to unpack from an Office file, which is a zip as well
+func isArchive(head []byte, filename string) bool {
+	_, office := officeFolders[sniffType(head, filename)]
+	return http.DetectContentType(head) == "application/zip" && !office
+}
+
+// files lists what the form holds with its zip archives unpacked, checking the batch
+// limits before anything is stored. It writes the error response when they're broken.
+func (h *BatchHandler) files(c *gin.Context, parts []*multipart.FileHeader) ([]batchFile, bool) {
+	var files []batchFile
+	var total int64
+	for _, part := range parts {
+		src, err := part.Open()
+		if err != nil {
+			apierror.Write(c, http.StatusInternalServerError, "Unable to open file")
+			return nil, false
+		}
+		head := make([]byte, sniffLen)
+		n, _ := io.ReadFull(src, head)
+
+		if !isArchive(head[:n], part.Filename) {
+			src.Close()
+			f := batchFile{name: part.Filename, part: part}
+			if part.Size > h.ingest.rules.maxSize {
+				f.err = h.ingest.rules.tooLargeError()
+			}
+			files = append(files, f)
+			total += part.Size
+			continue
+		}
+
+		// multipart files are always io.ReaderAt, spooled to disk or held in memory
+		archive, err := zip.NewReader(src.(io.ReaderAt), part.Size)
+		if err != nil {
+			src.Close()
+			files = append(files, batchFile{name: part.Filename, err: "Unable to read zip archive"})
+			continue
+		}
+		for _, entry := range archive.File {
+			name := strings.ReplaceAll(entry.Name, `\`, "/")
+			// folders and the resource forks macOS adds aren't documents
+			if entry.FileInfo().IsDir() || strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(path.Base(name), ".") {
+				continue
+			}
+			f := batchFile{name: part.Filename + "/" + name, entry: entry}
+			if entry.UncompressedSize64 > uint64(h.ingest.rules.maxSize) {
+				f.err = h.ingest.rules.tooLargeError()
+			} else {
+				total += int64(entry.UncompressedSize64)
+			}
+			files = append(files, f)
+		}
+		// the entries are read from the part later, the parser removes its temp file at the end of the request
+		src.Close()
+	}
+
+	if len(files) == 0 {
+		apierror.Write(c, http.StatusBadRequest, "No files uploaded")
+		return nil, false
+	}
+	if len(files) > h.maxFiles {
+		apierror.Write(c, http.StatusBadRequest, fmt.Sprintf("A batch can hold at most %d files, zip archives count by their contents", h.maxFiles))
+		return nil, false
+	}
+	if total > h.maxSize {
+		apierror.Write(c, http.StatusRequestEntityTooLarge, h.tooLargeError())
+		return nil, false
+	}
+	return files, true
+}
+
+func (h *BatchHandler) tooLargeError() string {
+	return fmt.Sprintf("Batch is too large, the limit is %d bytes unpacked", h.maxSize)
+}
+
+// open gives the file as something ingest can seek in. Zip entries are spooled to a temp
+// file, read through a limit in case the archive lied about their size.
+func (h *BatchHandler) open(f batchFile) (io.ReadSeekCloser, int64, error) {
+	if f.part != nil {
+		src, err := f.part.Open()
+		return src, f.part.Size, err
+	}
+	if f.spooled != nil {
+		return f.spooled, f.size, nil
+	}
+
+	r, err := f.entry.Open()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer r.Close()
+	tmp, err := os.CreateTemp("", "docstream-batch-*")
+	if err != nil {
+		return nil, 0, err
+	}
+	spooled := &tempFile{File: tmp}
+	size, err := io.Copy(tmp, io.LimitReader(r, h.ingest.rules.maxSize+1))
+	if err == nil && size > h.ingest.rules.maxSize {
+		err = errTooLarge
+	}
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		spooled.Close()
+		return nil, 0, err
+	}
+	return spooled, size, nil
+}
+
+var errTooLarge = errors.New("too large")
+
+// tempFile removes itself once closed
+type tempFile struct {
+	*os.File
+}
+
+func (t *tempFile) Close() error {
+	err := t.File.Close()
+	os.Remove(t.Name())
+	return err
+}
+
+// --- POST /upload/batch ---
+// Takes any number of "file" fields, a zip archive among them is unpacked and each file in it
+// uploaded on its own. org_id, collection_id, tags and metadata work like on POST /upload and
+// apply to every file. A file that can't be taken doesn't fail the batch, its item has the error.
+func (h *BatchHandler) Upload(c *gin.Context) {
+	if c.Request.ContentLength > h.maxSize+multipartOverhead {
+		apierror.Write(c, http.StatusRequestEntityTooLarge, h.tooLargeError())
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.maxSize+multipartOverhead)
+
+	form, err := c.MultipartForm()
+	if isTooLarge(err) {
+		apierror.Write(c, http.StatusRequestEntityTooLarge, h.tooLargeError())
+		return
+	}
+	if err != nil || len(form.File["file"]) == 0 {
+		apierror.Write(c, http.StatusBadRequest, "No files uploaded")
+		return
+	}
+
+	target, ok := formTarget(c, h.Store)
+	if !ok {
+		return
+	}
+	files, ok := h.files(c, form.File["file"])
+	if !ok {
+		return
+	}
+
+	batch := models.Batch{ID: "bat_" + uuid.NewString(), UserID: target.UserID, OrgID: target.OrgID}
+	if err := h.Store.CreateBatch(c.Request.Context(), batch); err != nil {
+		log.Println("Batch Insert Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Failed to record batch")
+		return
+	}
+
+	for i, f := range files {
+		item := h.upload(c.Request.Context(), target, f)
+		item.Position = i
+		if err := h.Store.AddBatchItem(c.Request.Context(), batch.ID, item); err != nil {
+			log.Printf("Failed to record item %d of batch %s: %v\n", i, batch.ID, err)
+		}
+	}
+
+	h.respond(c, http.StatusOK, batch.ID)
+}
+
+// upload ingests one file of the batch, whatever happens ends up on the item
+func (h *BatchHandler) upload(ctx context.Context, target uploadTarget, f batchFile) models.BatchItem {
+	item := models.BatchItem{Filename: f.name, Error: f.err}
+	if f.err != "" {
+		return item
+	}
+
+	src, size, err := h.open(f)
+	if errors.Is(err, errTooLarge) {
+		item.Error = h.ingest.rules.tooLargeError()
+		return item
+	} else if err != nil {
+		log.Printf("Failed to open %s: %v\n", f.name, err)
+		item.Error = "Unable to read file"
+		return item
+	}
+	defer src.Close()
+
+	result, failure := h.ingest.ingest(ctx, target, path.Base(f.name), src, size)
+	if failure != nil {
+		if failure.queueErr != nil {
+			log.Println("Queue Error: ", failure.queueErr)
+		}
+		item.Error = failure.Message
+		item.DocumentID = failure.DocumentID
+		return item
+	}
+	item.DocumentID = result.Document.ID
+	item.JobID = result.JobID
+	item.Duplicate = result.Duplicate
+	return item
+}
+
+// --- GET /batches/:id ---
+// The batch with every file's job status, and counts by status. The batch is processing
+// while any job is still going, then completed, failed, or partial when only some completed.
+func (h *BatchHandler) Get(c *gin.Context) {
+	h.respond(c, http.StatusOK, c.Param("id"))
+}
+
+func (h *BatchHandler) respond(c *gin.Context, status int, id string) {
+	batch, err := h.Store.GetBatch(c.Request.Context(), id, middleware.UserID(c))
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Batch not found")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	summarize(&batch)
+	c.JSON(status, batch)
+}
+
+// summarize works out the batch status from its items
+func summarize(batch *models.Batch) {
+	batch.Counts = map[string]int{}
+	running := false
+	for _, item := range batch.Items {
+		batch.Counts[item.Status]++
+		if item.Status != models.BatchItemRejected && !models.IsFinal(item.Status) {
+			running = true
+		}
+	}
+
+	completed := batch.Counts[models.JobStatusCompleted]
+	switch {
+	case running:
+		batch.Status = models.BatchStatusProcessing
+	case completed == len(batch.Items):
+		batch.Status = models.BatchStatusCompleted
+	case completed == 0:
+		batch.Status = models.BatchStatusFailed
+	default:
+		batch.Status = models.BatchStatusPartial
+	}
+}
@@ -0,0 +1,379 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/policy"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/dhruvkshah75/docstream/gateway/internal/stripe"
+	"github.com/gin-gonic/gin"
+)
+
+// maxStripeEvent caps the body of a Stripe webhook request, events are a few kilobytes
+const maxStripeEvent = 1 << 20
+
+// liveStatuses are the subscription statuses an account is paying, or about to, in
+var liveStatuses = []string{stripe.StatusActive, stripe.StatusTrialing, stripe.StatusPastDue, stripe.StatusIncomplete}
+
+type BillingHandler struct {
+	Store  storage.Store
+	Stripe *stripe.Client // nil when Stripe isn't configured
+	Config config.Stripe
+}
+
+// Constructor for the billing endpoints
+func NewBillingHandler(store storage.Store, client *stripe.Client, cfg config.Stripe) *BillingHandler {
+	return &BillingHandler{Store: store, Stripe: client, Config: cfg}
+}
+
+type CheckoutInput struct {
+	Plan  string `json:"plan" binding:"required"`
+	OrgID string `json:"org_id"`
+}
+
+// --- POST /billing/checkout ---
+// Starts a Stripe checkout for a subscription to the plan, for the caller's own account or, with
+// org_id, an organization they own. The account moves to the plan once Stripe reports the
+// subscription paid; an account that already has one changes it with PUT /billing/subscription.
+func (h *BillingHandler) Checkout(c *gin.Context) {
+	if !h.enabled(c) {
+		return
+	}
+	var input CheckoutInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Invalid(c, err)
+		return
+	}
+	price, ok := h.price(c, input.Plan)
+	if !ok {
+		return
+	}
+	userID := middleware.UserID(c)
+	if input.OrgID != "" && !requireOrgOwner(c, h.Store, input.OrgID) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	params := stripe.CheckoutParams{
+		Price:           price,
+		ClientReference: fmt.Sprintf("user_%d", userID),
+		SuccessURL:      h.Config.SuccessURL,
+		CancelURL:       h.Config.CancelURL,
+		Metadata:        map[string]string{"user_id": strconv.Itoa(userID), "org_id": input.OrgID, "plan": input.Plan},
+	}
+	if input.OrgID != "" {
+		params.ClientReference = input.OrgID
+	}
+	sub, err := h.Store.GetAccountSubscription(ctx, userID, input.OrgID)
+	switch {
+	case err == nil && slices.Contains(liveStatuses, sub.Status):
+		apierror.Write(c, http.StatusConflict, "The account already has a subscription, change its plan with PUT /billing/subscription")
+		return
+	case err == nil:
+		// paid before, the new subscription goes on the same customer
+		params.Customer = sub.CustomerID
+	case errors.Is(err, storage.ErrNotFound):
+		user, err := h.Store.GetUserByID(ctx, userID)
+		if err != nil {
+			apierror.Write(c, http.StatusInternalServerError, "Database error")
+			return
+		}
+		params.CustomerEmail = user.Email
+	default:
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	session, err := h.Stripe.CreateCheckoutSession(ctx, params)
+	if err != nil {
+		log.Println("Stripe Error:", err)
+		apierror.Write(c, http.StatusBadGateway, "Stripe could not start the checkout")
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"id": session.ID, "url": session.URL})
+}
+
+// --- GET /billing/subscription ---
+// The subscription of the caller's own account or, with ?org_id, of an organization they own
+func (h *BillingHandler) GetSubscription(c *gin.Context) {
+	orgID := c.Query("org_id")
+	if orgID != "" && !requireOrgOwner(c, h.Store, orgID) {
+		return
+	}
+	sub, err := h.Store.GetAccountSubscription(c.Request.Context(), middleware.UserID(c), orgID)
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "The account has no subscription")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusOK, sub)
+}
+
+// --- PUT /billing/subscription ---
+// Moves the account's subscription to another plan. Stripe prorates the rest of the period and
+// invoices it right away, the account changes plan when the webhook confirms it. read_only in the
+// answer says whether the account holds more than the new plan stores, it can only read then
+// until documents are deleted.
+func (h *BillingHandler) ChangeSubscription(c *gin.Context) {
+	if !h.enabled(c) {
+		return
+	}
+	var input CheckoutInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Invalid(c, err)
+		return
+	}
+	userID := middleware.UserID(c)
+	if input.OrgID != "" && !requireOrgOwner(c, h.Store, input.OrgID) {
+		return
+	}
+	ctx := c.Request.Context()
+	sub, err := h.Store.GetAccountSubscription(ctx, userID, input.OrgID)
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && !slices.Contains(liveStatuses, sub.Status)) {
+		apierror.Write(c, http.StatusNotFound, "The account has no subscription, start one with POST /billing/checkout")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	price, ok := h.price(c, input.Plan)
+	if !ok {
+		return
+	}
+	plan, err := h.Store.GetPlan(ctx, input.Plan)
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Field(c, "plan", "plan must be one of the plans, GET /plans lists them")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if sub.Plan == input.Plan {
+		c.JSON(http.StatusOK, gin.H{"subscription": sub, "message": "The subscription is on that plan already"})
+		return
+	}
+
+	readOnly := false
+	if plan.MaxStorage > 0 {
+		used, err := h.Store.StorageUsed(ctx, userID, input.OrgID)
+		if err != nil {
+			apierror.Write(c, http.StatusInternalServerError, "Database error")
+			return
+		}
+		readOnly = used > plan.MaxStorage
+	}
+	if _, err := h.Stripe.ChangePrice(ctx, sub.ID, sub.ItemID, price); err != nil {
+		log.Println("Stripe Error:", err)
+		apierror.Write(c, http.StatusBadGateway, "Stripe could not change the subscription")
+		return
+	}
+	audit(c, h.Store, models.AuditSubscription, fmt.Sprintf("asked Stripe to move subscription %s from the %s plan to %s", sub.ID, sub.Plan, input.Plan))
+	c.JSON(http.StatusAccepted, gin.H{"subscription_id": sub.ID, "plan": input.Plan, "read_only": readOnly})
+}
+
+// --- POST /billing/stripe/webhook ---
+// Where Stripe sends subscription events, signed with STRIPE_WEBHOOK_SECRET. A paying
+// subscription puts the account on its price's plan, one that ended or went unpaid back on free.
+// Events may come late and out of order, one older than what the subscription is at is ignored.
+func (h *BillingHandler) Webhook(c *gin.Context) {
+	if !h.enabled(c) {
+		return
+	}
+	payload, err := io.ReadAll(io.LimitReader(c.Request.Body, maxStripeEvent))
+	if err != nil {
+		apierror.Write(c, http.StatusBadRequest, "Could not read the event")
+		return
+	}
+	event, err := stripe.ConstructEvent(payload, c.GetHeader("Stripe-Signature"), h.Config.WebhookSecret, time.Now())
+	if err != nil {
+		apierror.Write(c, http.StatusBadRequest, "Invalid Stripe signature")
+		return
+	}
+
+	switch event.Type {
+	case stripe.EventSubscriptionCreated, stripe.EventSubscriptionUpdated, stripe.EventSubscriptionDeleted:
+	default:
+		// the endpoint may be subscribed to more than it needs
+		c.JSON(http.StatusOK, gin.H{"received": true})
+		return
+	}
+	var sub stripe.Subscription
+	if err := json.Unmarshal(event.Data.Object, &sub); err != nil || sub.ID == "" {
+		apierror.Write(c, http.StatusBadRequest, "The event holds no subscription")
+		return
+	}
+	if event.Type == stripe.EventSubscriptionDeleted {
+		sub.Status = stripe.StatusCanceled
+	}
+	// Stripe gives up on an event after days of errors, the rest is logged and acknowledged
+	if err := h.applySubscription(c.Request.Context(), event, sub); err != nil {
+		log.Printf("Stripe event %s: %v\n", event.ID, err)
+		if !errors.Is(err, errStripeIgnored) {
+			apierror.Write(c, http.StatusInternalServerError, "Database error")
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"received": true})
+}
+
+// errStripeIgnored is an event about something the gateway can't place, answering it with an
+// error would only have Stripe send it again
+var errStripeIgnored = errors.New("ignored")
+
+// applySubscription records what the event says of the subscription and moves the account to
+// the plan it pays for
+func (h *BillingHandler) applySubscription(ctx context.Context, event stripe.Event, sub stripe.Subscription) error {
+	itemID, price := sub.Item()
+	record := models.Subscription{
+		ID: sub.ID, CustomerID: sub.Customer, ItemID: itemID, Status: sub.Status,
+		CancelAtPeriodEnd: sub.CancelAtPeriodEnd, EventAt: event.Created,
+	}
+	if end := sub.PeriodEnd(); !end.IsZero() {
+		record.CurrentPeriodEnd = &end
+	}
+	for plan, p := range h.Config.Prices {
+		if p == price {
+			record.Plan = plan
+		}
+	}
+
+	// the checkout's metadata says whose it is, the stored subscription for those made elsewhere
+	stored, err := h.Store.GetSubscription(ctx, sub.ID)
+	switch {
+	case err == nil:
+		record.UserID, record.OrgID = stored.UserID, stored.OrgID
+		if record.Plan == "" {
+			record.Plan = stored.Plan
+		}
+	case errors.Is(err, storage.ErrNotFound):
+		userID, err := strconv.Atoi(sub.Metadata["user_id"])
+		if err != nil {
+			return fmt.Errorf("%w: subscription %s is for no user", errStripeIgnored, sub.ID)
+		}
+		if _, err := h.Store.GetUserByID(ctx, userID); errors.Is(err, storage.ErrNotFound) {
+			return fmt.Errorf("%w: user %d of subscription %s is gone", errStripeIgnored, userID, sub.ID)
+		} else if err != nil {
+			return err
+		}
+		record.UserID, record.OrgID = userID, sub.Metadata["org_id"]
+	default:
+		return err
+	}
+	if record.Plan == "" {
+		return fmt.Errorf("%w: price %q of subscription %s is in no plan of STRIPE_PRICES", errStripeIgnored, price, sub.ID)
+	}
+
+	applied, err := h.Store.PutSubscription(ctx, record)
+	if err != nil || !applied {
+		return err
+	}
+
+	plan := ""
+	switch record.Status {
+	case stripe.StatusActive, stripe.StatusTrialing, stripe.StatusPastDue:
+		plan = record.Plan
+	case stripe.StatusCanceled, stripe.StatusUnpaid, stripe.StatusIncompleteExpired:
+		plan = models.PlanFree
+	}
+	// an incomplete subscription isn't paid yet, and an account that subscribed again since goes by the newer one
+	if plan == "" {
+		return nil
+	}
+	latest, err := h.Store.GetAccountSubscription(ctx, record.UserID, record.OrgID)
+	if err != nil {
+		return err
+	}
+	if latest.ID != record.ID {
+		return nil
+	}
+	readOnly, err := movePlan(ctx, h.Store, record.UserID, record.OrgID, plan)
+	if errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("%w: the account of subscription %s is gone", errStripeIgnored, sub.ID)
+	} else if err != nil {
+		return err
+	}
+
+	detail := fmt.Sprintf("subscription %s is %s, the account is on the %s plan", sub.ID, record.Status, plan)
+	if readOnly {
+		detail += " and read-only"
+	}
+	entry := models.AuditEntry{UserID: &record.UserID, Event: models.AuditSubscription, Detail: detail}
+	if err := h.Store.CreateAuditEntry(ctx, entry); err != nil {
+		log.Println("Failed to write audit entry:", err)
+	}
+	return nil
+}
+
+// enabled writes the error response when Stripe isn't configured
+func (h *BillingHandler) enabled(c *gin.Context) bool {
+	if h.Stripe == nil {
+		apierror.Write(c, http.StatusServiceUnavailable, "Billing is not enabled on this server")
+		return false
+	}
+	return true
+}
+
+// price is the Stripe price of the plan, writing the error response when it isn't for sale
+func (h *BillingHandler) price(c *gin.Context, plan string) (string, bool) {
+	price, ok := h.Config.Prices[plan]
+	if !ok {
+		apierror.Field(c, "plan", "plan must be one of the plans for sale: "+strings.Join(slices.Sorted(maps.Keys(h.Config.Prices)), ", "))
+	}
+	return price, ok
+}
+
+// StorageTask is the check_storage schedule. Accounts made read-only by a downgrade are
+// writable again once deleting documents brought them within their plan.
+type StorageTask struct {
+	Store storage.Store
+}
+
+// Constructor for the storage check task
+func NewStorageTask(store storage.Store) *StorageTask {
+	return &StorageTask{Store: store}
+}
+
+// Run checks every read-only account against its plan
+func (t *StorageTask) Run(ctx context.Context) (string, error) {
+	accounts, err := t.Store.ListReadOnly(ctx)
+	if err != nil {
+		return "", err
+	}
+	lifted := 0
+	for i, a := range accounts {
+		readOnly, changed, err := policy.Enforce(ctx, t.Store, a.UserID, a.OrgID)
+		if err != nil {
+			return "", fmt.Errorf("checked %d of %d accounts: %w", i, len(accounts), err)
+		}
+		if !changed || readOnly {
+			continue
+		}
+		lifted++
+		entry := models.AuditEntry{Event: models.AuditReadOnly, Detail: fmt.Sprintf("organization %s fits its plan and is writable again", a.OrgID)}
+		if a.OrgID == "" {
+			entry.UserID = &a.UserID
+			entry.Detail = fmt.Sprintf("user %d fits their plan and is writable again", a.UserID)
+		}
+		if err := t.Store.CreateAuditEntry(ctx, entry); err != nil {
+			log.Println("Failed to write audit entry:", err)
+		}
+	}
+	return fmt.Sprintf("%d of %d read-only accounts are writable again", lifted, len(accounts)), nil
+}
@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+	"github.com/dhruvkshah75/docstream/gateway/internal/envelope"
+	"github.com/dhruvkshah75/docstream/gateway/internal/objectstore"
+	"github.com/dhruvkshah75/docstream/gateway/internal/queue"
+	"github.com/dhruvkshah75/docstream/gateway/internal/scanner"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxBucketEvent caps the notification bodies the webhook reads
+	maxBucketEvent = 1 << 20
+	// bucketEventRetryDelay is how long a failed notification waits before it's delivered again
+	bucketEventRetryDelay = 5 * time.Second
+)
+
+// BucketEventHandler ingests the files other tools drop into the bucket, without /upload. The
+// bucket's object created notifications name them, MinIO sends those to the webhook or through
+// the broker. A file goes under <prefix><owner's email>/ and is deleted from there once it is a
+// document, the document keeps a copy of its own like any upload.
+type BucketEventHandler struct {
+	Store   storage.Store
+	Objects objectstore.Store
+	bucket  string
+	prefix  string
+	token   string
+	ingest  ingester
+}
+
+// Constructor for the bucket notification webhook and consumer
+func NewBucketEventHandler(store storage.Store, objects objectstore.Store, keys *envelope.Keyring, publisher queue.Publisher, virusScanner *scanner.Scanner, cfg *config.Config) *BucketEventHandler {
+	return &BucketEventHandler{
+		Store:   store,
+		Objects: objects,
+		bucket:  cfg.Storage.Bucket,
+		prefix:  cfg.BucketEvents.Prefix,
+		token:   cfg.BucketEvents.WebhookToken,
+		ingest:  ingester{store: store, objects: objects, keys: keys, publisher: publisher, scanner: virusScanner, rules: newUploadRules(cfg), kind: "bucket"},
+	}
+}
+
+// bucketEvent is the part of an S3 event notification ingestion needs, MinIO sends the same shape
+type bucketEvent struct {
+	Records []struct {
+		EventName string `json:"eventName"`
+		S3        struct {
+			Bucket struct {
+				Name string `json:"name"`
+			} `json:"bucket"`
+			Object struct {
+				Key  string `json:"key"` // URL encoded
+				Size int64  `json:"size"`
+			} `json:"object"`
+		} `json:"s3"`
+	} `json:"Records"`
+}
+
+// --- POST /storage/events ---
+// MinIO's webhook target, authenticated with BUCKET_EVENTS_WEBHOOK_TOKEN as a bearer token.
+// Answering with an error makes MinIO send the event again later.
+func (h *BucketEventHandler) Webhook(c *gin.Context) {
+	if h.prefix == "" || h.token == "" {
+		apierror.Write(c, http.StatusNotFound, "Bucket notifications are not enabled")
+		return
+	}
+	token, _ := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+		apierror.Write(c, http.StatusUnauthorized, "Invalid bucket notification token")
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxBucketEvent))
+	if err != nil {
+		apierror.Write(c, http.StatusBadRequest, "Could not read the event")
+		return
+	}
+	if err := h.Handle(c.Request.Context(), body); err != nil {
+		log.Println("Bucket Event Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Failed to ingest the files, send the event again")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"received": true})
+}
+
+// Consume ingests the notifications MinIO publishes to the bucket_events queue or topic.
+// It blocks forever, consuming again if the connection drops, so run it in its own goroutine.
+func (h *BucketEventHandler) Consume(consumer queue.Consumer) {
+	for {
+		if err := h.consume(consumer); err != nil {
+			log.Println("Bucket events consumer error:", err)
+		}
+		// the broker connection is busy reconnecting, give it a moment
+		time.Sleep(bucketEventRetryDelay)
+	}
+}
+
+func (h *BucketEventHandler) consume(consumer queue.Consumer) error {
+	deliveries, err := consumer.ConsumeBucketEvents(context.Background())
+	if err != nil {
+		return err
+	}
+	for d := range deliveries {
+		if err := h.Handle(context.Background(), d.Body); err != nil {
+			// storage or the queue is down, the files wait in the bucket until it's back
+			log.Println("Bucket Event Error:", err)
+			time.Sleep(bucketEventRetryDelay)
+			d.Nack(true)
+			continue
+		}
+		d.Ack()
+	}
+	return errors.New("bucket events channel closed")
+}
+
+// Handle ingests the files an event announces for their owners. Files that are refused, of a
+// type that isn't allowed or too large, are logged and left in the bucket. Failures on our side
+// fail the event so it is delivered again, which the duplicate check makes safe for the files
+// that did go through.
+func (h *BucketEventHandler) Handle(ctx context.Context, body []byte) error {
+	var event bucketEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		// MinIO won't send it any differently, dropping it is all there is to do
+		log.Println("Invalid bucket event, dropping:", string(body))
+		return nil
+	}
+
+	var failed error
+	for _, record := range event.Records {
+		if !strings.Contains(record.EventName, "ObjectCreated:") || record.S3.Bucket.Name != h.bucket {
+			continue
+		}
+		key, err := url.QueryUnescape(record.S3.Object.Key)
+		if err != nil {
+			log.Println("Invalid object key in bucket event:", record.S3.Object.Key)
+			continue
+		}
+		if err := h.ingestObject(ctx, key); err != nil {
+			failed = errors.Join(failed, fmt.Errorf("%s: %w", key, err))
+		}
+	}
+	return failed
+}
+
+// ingestObject turns the dropped file at key into a document of its owner
+func (h *BucketEventHandler) ingestObject(ctx context.Context, key string) error {
+	// the gateway's own objects are outside the prefix, as are folders
+	rest, ok := strings.CutPrefix(key, h.prefix)
+	if !ok || strings.HasSuffix(rest, "/") {
+		return nil
+	}
+	email, name, ok := strings.Cut(rest, "/")
+	if !ok || name == "" {
+		log.Printf("Skipping %s dropped into the bucket: it goes under %s<owner's email>/\n", key, h.prefix)
+		return nil
+	}
+	user, err := h.Store.GetUserByEmail(ctx, email)
+	if errors.Is(err, storage.ErrNotFound) {
+		log.Printf("Skipping %s dropped into the bucket: there is no user %s\n", key, email)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	tmpPath, err := objectstore.DownloadToTemp(ctx, h.Objects, h.bucket, key)
+	if errors.Is(err, objectstore.ErrNotFound) {
+		// an earlier delivery of the event ingested it already
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+	file, err := os.Open(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() > h.ingest.rules.maxSize {
+		log.Printf("Skipping %s dropped into the bucket: %s\n", key, h.ingest.rules.tooLargeError())
+		return nil
+	}
+
+	target := uploadTarget{UserID: user.ID, Metadata: map[string]string{"source": "bucket", "bucket_key": truncate(key, maxMetadataValueLength)}}
+	result, failure := h.ingest.ingest(ctx, target, path.Base(name), file, info.Size())
+	if failure != nil && failure.DocumentID == "" {
+		if failure.Status >= http.StatusInternalServerError {
+			return errors.New(failure.Message)
+		}
+		log.Printf("Skipping %s dropped into the bucket: %s\n", key, failure.Message)
+		return nil
+	}
+	switch {
+	case failure != nil:
+		log.Printf("Dropped %s was recorded as document %s for user %d but refused: %s\n", key, failure.DocumentID, user.ID, failure.Message)
+	case result.Duplicate:
+		log.Printf("Dropped %s was already document %s for user %d\n", key, result.Document.ID, user.ID)
+	default:
+		log.Printf("Dropped %s became document %s (job %s) for user %d\n", key, result.Document.ID, result.JobID, user.ID)
+	}
+
+	// the document has its own copy now, this one would only be ingested again
+	if err := h.Objects.Delete(ctx, h.bucket, key); err != nil {
+		log.Println("Storage Delete Error:", err)
+	}
+	return nil
+}
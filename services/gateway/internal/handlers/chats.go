@@ -0,0 +1,362 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/llm"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	maxChatTitleLen = 200
+	// chatHistory is how many earlier messages a question is asked with, at most
+	chatHistory = 20
+	// maxHistoryChars leaves most of the context window to the sources, the oldest messages go first
+	maxHistoryChars = 8000
+	// maxChatDocuments caps how many documents of a collection a chat searches
+	maxChatDocuments = 1000
+	// rewriteTimeout bounds turning a follow-up into a query of its own
+	rewriteTimeout = 30 * time.Second
+)
+
+const rewritePrompt = `Rewrite the user's last message as a search query that can be understood without the conversation before it.
+Keep the names, numbers and terms it refers to. Answer with the query only.`
+
+type ChatHandler struct {
+	Store storage.Store
+	Ask   *AskHandler
+}
+
+// Constructor for the chat endpoints, chats answer the way /ask does
+func NewChatHandler(store storage.Store, ask *AskHandler) *ChatHandler {
+	return &ChatHandler{Store: store, Ask: ask}
+}
+
+// ChatInput starts a chat, at most one of OrgID, CollectionID and DocumentID narrows it down
+type ChatInput struct {
+	Title        string `json:"title"`
+	OrgID        string `json:"org_id"`
+	CollectionID string `json:"collection_id"`
+	DocumentID   string `json:"document_id"`
+	Mode         string `json:"mode"` // how sources are retrieved, as for /search
+}
+
+// ChatMessageInput is the next question of a chat
+type ChatMessageInput struct {
+	Content string `json:"content" binding:"required"`
+	TopK    int    `json:"top_k"`
+	// Model and EmbeddingModel pick allowed models for this question, as for /ask
+	Model          string `json:"model"`
+	EmbeddingModel string `json:"embedding_model"`
+}
+
+// --- POST /chats ---
+func (h *ChatHandler) Create(c *gin.Context) {
+	if h.Ask.LLM == nil {
+		apierror.Write(c, http.StatusServiceUnavailable, "Question answering is not enabled on this server")
+		return
+	}
+
+	var input ChatInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Invalid(c, err)
+		return
+	}
+
+	userID := middleware.UserID(c)
+	title := strings.TrimSpace(input.Title)
+	if len(title) > maxChatTitleLen {
+		apierror.Field(c, "title", fmt.Sprintf("title must be at most %d characters", maxChatTitleLen))
+		return
+	}
+	switch input.Mode {
+	case "", SearchModeVector, SearchModeKeyword, SearchModeHybrid:
+	default:
+		apierror.Field(c, "mode", "mode must be vector, keyword or hybrid")
+		return
+	}
+	scopes := 0
+	for _, id := range []string{input.OrgID, input.CollectionID, input.DocumentID} {
+		if id != "" {
+			scopes++
+		}
+	}
+	if scopes > 1 {
+		apierror.Write(c, http.StatusBadRequest, "Give at most one of org_id, collection_id and document_id")
+		return
+	}
+
+	ctx := c.Request.Context()
+	chat := models.Chat{
+		ID:           "chat_" + uuid.NewString(),
+		UserID:       userID,
+		Title:        title,
+		OrgID:        input.OrgID,
+		CollectionID: input.CollectionID,
+		DocumentID:   input.DocumentID,
+		Mode:         input.Mode,
+	}
+	switch {
+	case chat.OrgID != "":
+		if _, ok := orgRole(c, h.Store, chat.OrgID); !ok {
+			return
+		}
+	case chat.CollectionID != "":
+		col, ok := getCollection(c, h.Store, chat.CollectionID, false)
+		if !ok {
+			return
+		}
+		// a chat about something shared with the caller goes by their own plan
+		if col.SharedPermission == "" {
+			chat.OrgID = col.OrgID
+		}
+	case chat.DocumentID != "":
+		doc, err := h.Store.GetReadableDocument(ctx, chat.DocumentID, userID)
+		if errors.Is(err, storage.ErrNotFound) {
+			apierror.Write(c, http.StatusNotFound, "Document not found")
+			return
+		} else if err != nil {
+			apierror.Write(c, http.StatusInternalServerError, "Database error")
+			return
+		}
+		if doc.SharedPermission == "" {
+			chat.OrgID = doc.OrgID
+		}
+	}
+
+	if err := h.Store.CreateChat(ctx, chat); err != nil {
+		log.Println("Chat Insert Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Failed to create chat")
+		return
+	}
+	chat.CreatedAt = time.Now().UTC()
+	chat.UpdatedAt = chat.CreatedAt
+	c.JSON(http.StatusCreated, chat)
+}
+
+// --- GET /chats ---
+func (h *ChatHandler) List(c *gin.Context) {
+	chats, err := h.Store.ListChats(c.Request.Context(), middleware.UserID(c))
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"chats": chats})
+}
+
+// --- GET /chats/:id ---
+// The chat with all its messages, oldest first
+func (h *ChatHandler) Get(c *gin.Context) {
+	chat, ok := h.get(c)
+	if !ok {
+		return
+	}
+	messages, err := h.Store.ListChatMessages(c.Request.Context(), chat.ID, 0)
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	chat.Messages = messages
+	c.JSON(http.StatusOK, chat)
+}
+
+// --- DELETE /chats/:id ---
+func (h *ChatHandler) Delete(c *gin.Context) {
+	err := h.Store.DeleteChat(c.Request.Context(), c.Param("id"), middleware.UserID(c))
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Chat not found")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Chat deleted"})
+}
+
+// --- POST /chats/:id/messages ---
+// Answers the next question of a chat, streamed like /ask. A follow-up is first rewritten into a
+// query of its own from the conversation, that is what the sources are searched by. The model
+// then gets the recent messages along with the sources, as many as fit. The question and its
+// answer are kept once the answer is complete, the done event says what was searched for:
+//
+//	event: done   data: {"answer", "model", "sources", "citations", "query"}
+func (h *ChatHandler) Send(c *gin.Context) {
+	if h.Ask.LLM == nil {
+		apierror.Write(c, http.StatusServiceUnavailable, "Question answering is not enabled on this server")
+		return
+	}
+
+	var input ChatMessageInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Invalid(c, err)
+		return
+	}
+	input.Content = strings.TrimSpace(input.Content)
+	if input.Content == "" {
+		apierror.Field(c, "content", "content is required")
+		return
+	}
+	if input.TopK == 0 {
+		input.TopK = defaultAskTopK
+	}
+	if input.TopK < 1 || input.TopK > maxAskTopK {
+		apierror.Write(c, http.StatusBadRequest, "top_k must be between 1 and "+strconv.Itoa(maxAskTopK))
+		return
+	}
+
+	chat, ok := h.get(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	plan, failure := accountPlan(ctx, h.Store, chat.UserID, chat.OrgID)
+	if failure != nil {
+		failure.respond(c)
+		return
+	}
+	provider, model, failure := generator(ctx, h.Store, plan, h.Ask.LLM, "model", input.Model)
+	if failure != nil {
+		failure.respond(c)
+		return
+	}
+	earlier, err := h.Store.ListChatMessages(ctx, chat.ID, chatHistory)
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	history := fitHistory(earlier)
+
+	search := SearchInput{Query: h.rewrite(c, provider, chat.OrgID, history, input.Content), Mode: chat.Mode, EmbeddingModel: input.EmbeddingModel, Limit: input.TopK, OrgID: chat.OrgID}
+	switch {
+	case chat.DocumentID != "":
+		search.DocumentIDs = []string{chat.DocumentID}
+	case chat.CollectionID != "":
+		// the collection may have been deleted or taken out of the caller's reach since
+		if _, ok := getCollection(c, h.Store, chat.CollectionID, false); !ok {
+			return
+		}
+		ids, err := h.Store.ListCollectionDocumentIDs(ctx, chat.CollectionID, maxChatDocuments)
+		if err != nil {
+			apierror.Write(c, http.StatusInternalServerError, "Database error")
+			return
+		}
+		search.DocumentIDs = ids
+	}
+
+	var results []SearchResult
+	// an empty collection has nothing to search, DocumentIDs being empty would search everything
+	if chat.CollectionID == "" || len(search.DocumentIDs) > 0 {
+		if results, ok = h.Ask.Search.search(c, search); !ok {
+			return
+		}
+	}
+
+	messages, sources := buildPrompt(input.Content, history, results, sourceBudget(model))
+	answer, ok := h.Ask.answer(c, provider, chat.OrgID, messages, sources)
+	if !ok {
+		return
+	}
+
+	citations := cite(answer, sources, results)
+	now := time.Now().UTC()
+	turn := []models.ChatMessage{
+		{Role: llm.RoleUser, Content: input.Content, Query: search.Query, CreatedAt: now},
+		{Role: llm.RoleAssistant, Content: answer, Sources: sources, Citations: citations, CreatedAt: now},
+	}
+	if err := h.Store.AddChatMessages(ctx, chat.ID, turn); err != nil {
+		// the answer is out already, it just won't be part of the conversation
+		log.Println("Chat Message Insert Error:", err)
+		c.SSEvent("error", gin.H{"error": "Failed to save the messages"})
+		c.Writer.Flush()
+		return
+	}
+	if chat.Title == "" {
+		if err := h.Store.SetChatTitle(ctx, chat.ID, snippet(input.Content, 80)); err != nil {
+			log.Println("Chat Title Error:", err)
+		}
+	}
+
+	c.SSEvent("done", gin.H{"answer": answer, "model": provider.Model(), "sources": sources, "citations": citations, "query": search.Query})
+	c.Writer.Flush()
+}
+
+func (h *ChatHandler) get(c *gin.Context) (models.Chat, bool) {
+	chat, err := h.Store.GetChat(c.Request.Context(), c.Param("id"), middleware.UserID(c))
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Chat not found")
+		return chat, false
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return chat, false
+	}
+	return chat, true
+}
+
+// fitHistory turns the latest messages into prompt turns, dropping the oldest ones until the
+// rest fit into maxHistoryChars. The sources of earlier answers aren't repeated.
+func fitHistory(messages []models.ChatMessage) []llm.Message {
+	size := 0
+	start := len(messages)
+	for start > 0 && size+len(messages[start-1].Content) <= maxHistoryChars {
+		start--
+		size += len(messages[start].Content)
+	}
+	// a conversation the model gets starts with a question
+	for start < len(messages) && messages[start].Role != llm.RoleUser {
+		start++
+	}
+
+	history := make([]llm.Message, 0, len(messages)-start)
+	for _, m := range messages[start:] {
+		history = append(history, llm.Message{Role: m.Role, Content: m.Content})
+	}
+	return history
+}
+
+// rewrite turns a follow-up like "and in 2023?" into a query that finds the sources on its own.
+// The first question of a chat needs none, and when the model fails the message is searched as is.
+// The tokens count towards the caller's usage in orgID like the answer's.
+func (h *ChatHandler) rewrite(c *gin.Context, provider llm.Provider, orgID string, history []llm.Message, content string) string {
+	if len(history) == 0 {
+		return content
+	}
+	var conversation strings.Builder
+	for _, m := range history {
+		conversation.WriteString(m.Role + ": " + m.Content + "\n\n")
+	}
+	conversation.WriteString("user: " + content)
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), rewriteTimeout)
+	defer cancel()
+	messages := []llm.Message{
+		{Role: llm.RoleSystem, Content: rewritePrompt},
+		{Role: llm.RoleUser, Content: conversation.String()},
+	}
+	var query strings.Builder
+	usage, err := provider.Stream(ctx, messages, func(token string) error {
+		query.WriteString(token)
+		return nil
+	})
+	meterLLM(c, h.Store, orgID, usage, messages, query.String())
+	if err != nil {
+		log.Println("Query Rewrite Error:", err)
+		return content
+	}
+	rewritten := strings.Trim(strings.TrimSpace(query.String()), `"`)
+	if rewritten == "" {
+		return content
+	}
+	return rewritten
+}
@@ -0,0 +1,494 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+	"github.com/dhruvkshah75/docstream/gateway/internal/envelope"
+	"github.com/dhruvkshah75/docstream/gateway/internal/metrics"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/objectstore"
+	"github.com/dhruvkshah75/docstream/gateway/internal/policy"
+	"github.com/dhruvkshah75/docstream/gateway/internal/queue"
+	"github.com/dhruvkshah75/docstream/gateway/internal/scanner"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/dhruvkshah75/docstream/gateway/internal/tracing"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// S3 (and MinIO) rejects parts under 5 MiB, except for the last one
+	minPartSize = 5 << 20
+	maxPartSize = 512 << 20
+	maxParts    = 10000
+)
+
+// ChunkedUploadHandler implements a resumable upload protocol on top of object storage multipart uploads:
+//
+//	POST   /upload/init          start a session
+//	PATCH  /upload/:id?part=N    send one part (raw bytes in the body), re-sending a part replaces it
+//	GET    /upload/:id           list the parts received so far, used to resume
+//	POST   /upload/:id/complete  assemble the parts and enqueue the job
+//	DELETE /upload/:id           abort and discard the parts
+type ChunkedUploadHandler struct {
+	Store   storage.Store
+	Objects objectstore.Store
+	Keys    *envelope.Keyring
+	Queue   queue.Publisher
+	Scanner *scanner.Scanner
+	rules   uploadRules
+}
+
+// Constructor for the chunked upload endpoints
+func NewChunkedUploadHandler(store storage.Store, objects objectstore.Store, keys *envelope.Keyring, publisher queue.Publisher, virusScanner *scanner.Scanner, cfg *config.Config) *ChunkedUploadHandler {
+	return &ChunkedUploadHandler{Store: store, Objects: objects, Keys: keys, Queue: publisher, Scanner: virusScanner, rules: newUploadRules(cfg)}
+}
+
+type InitUploadInput struct {
+	Filename string `json:"filename" binding:"required"`
+	OrgID    string `json:"org_id"` // optional, the organization the document goes into
+	// CollectionID optionally files the document in a collection of the same organization
+	CollectionID string            `json:"collection_id"`
+	Size         int64             `json:"size"`     // optional total size, lets an oversized file be refused up front
+	Tags         []string          `json:"tags"`     // optional, like the tags field of a single upload
+	Metadata     map[string]string `json:"metadata"` // optional
+}
+
+// --- POST /upload/init ---
+func (h *ChunkedUploadHandler) Init(c *gin.Context) {
+	var input InitUploadInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Invalid(c, err)
+		return
+	}
+	input.Filename = sanitizeFilename(input.Filename)
+
+	if input.Size > h.rules.maxSize {
+		apierror.Write(c, http.StatusRequestEntityTooLarge, h.rules.tooLargeError())
+		return
+	}
+
+	// the extension decides the expected type here, the first part is sniffed against it
+	fileType := typeFromExtension(input.Filename)
+	if !h.rules.allowed[fileType] {
+		apierror.Write(c, http.StatusUnsupportedMediaType, h.rules.unsupportedTypeError())
+		return
+	}
+
+	if input.OrgID != "" {
+		role, ok := orgRole(c, h.Store, input.OrgID)
+		if !ok {
+			return
+		}
+		if !canUpload(role) {
+			apierror.Write(c, http.StatusForbidden, "Viewers can't upload to this organization")
+			return
+		}
+	}
+
+	if !fileableCollection(c, h.Store, input.CollectionID, middleware.UserID(c), input.OrgID) {
+		return
+	}
+	// a size left out is checked against the plan as the parts come in
+	if f := checkUploadPlan(c.Request.Context(), h.Store, uploadTarget{UserID: middleware.UserID(c), OrgID: input.OrgID}, input.Size); f != nil {
+		f.respond(c)
+		return
+	}
+
+	tags, err := normalizeTags(input.Tags)
+	if err != nil {
+		apierror.Field(c, "tags", err.Error())
+		return
+	}
+	if err := validateMetadata(input.Metadata); err != nil {
+		apierror.Field(c, "metadata", err.Error())
+		return
+	}
+
+	session := models.UploadSession{
+		ID:           "upl_" + uuid.NewString(),
+		UserID:       middleware.UserID(c),
+		OrgID:        input.OrgID,
+		CollectionID: input.CollectionID,
+		Bucket:       h.rules.bucket,
+		ObjectKey:    fmt.Sprintf("%d_%s", time.Now().Unix(), input.Filename),
+		Filename:     input.Filename,
+		ContentType:  fileTypes[fileType],
+		Status:       models.UploadStatusInProgress,
+		Tags:         tags,
+		Metadata:     input.Metadata,
+	}
+
+	// every part is encrypted with the same data key as it arrives, each as a segment of its own
+	if h.Keys.Enabled() {
+		_, wrapped, err := h.Keys.NewDataKey(c.Request.Context())
+		if err != nil {
+			log.Println("Encryption Error:", err)
+			apierror.Write(c, http.StatusInternalServerError, "Failed to start upload")
+			return
+		}
+		session.EncryptionKey = wrapped
+	}
+
+	ctx, span := tracing.Start(c.Request.Context(), "objectstore.CreateMultipart", attribute.String("object.key", session.ObjectKey))
+	uploadID, err := h.Objects.CreateMultipart(ctx, session.Bucket, session.ObjectKey, session.ContentType)
+	tracing.End(span, err)
+	if err != nil {
+		log.Println("Storage Multipart Init Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Failed to start upload")
+		return
+	}
+	session.MinioUploadID = uploadID
+
+	if err := h.Store.CreateUploadSession(c.Request.Context(), session); err != nil {
+		log.Println("Upload Session Insert Error:", err)
+		h.Objects.AbortMultipart(c.Request.Context(), session.Bucket, session.ObjectKey, uploadID)
+		apierror.Write(c, http.StatusInternalServerError, "Failed to start upload")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"upload_id":     session.ID,
+		"min_part_size": minPartSize,
+		"max_part_size": maxPartSize,
+	})
+}
+
+// --- PATCH /upload/:id?part=N ---
+func (h *ChunkedUploadHandler) UploadPart(c *gin.Context) {
+	session, ok := h.activeSession(c)
+	if !ok {
+		return
+	}
+
+	partNumber, err := strconv.Atoi(c.Query("part"))
+	if err != nil || partNumber < 1 || partNumber > maxParts {
+		apierror.Write(c, http.StatusBadRequest, fmt.Sprintf("part must be between 1 and %d", maxParts))
+		return
+	}
+
+	size := c.Request.ContentLength
+	if size <= 0 {
+		apierror.Write(c, http.StatusLengthRequired, "Content-Length is required")
+		return
+	}
+	if size > maxPartSize {
+		apierror.Write(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("parts can be at most %d bytes", maxPartSize))
+		return
+	}
+
+	// the parts together can't go over the upload limit either, a re-sent part replaces its old size
+	parts, err := h.Store.ListUploadParts(c.Request.Context(), session.ID)
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	total := size
+	for _, p := range parts {
+		if p.PartNumber != partNumber {
+			total += p.Size
+		}
+	}
+	if total > h.rules.maxSize {
+		apierror.Write(c, http.StatusRequestEntityTooLarge, h.rules.tooLargeError())
+		return
+	}
+	plan, f := accountPlan(c.Request.Context(), h.Store, session.UserID, session.OrgID)
+	if f == nil {
+		f = planFailure(policy.CheckFileSize(plan, total))
+	}
+	if f != nil {
+		f.respond(c)
+		return
+	}
+	if !h.rules.limitBody(c, size) {
+		return
+	}
+
+	var body io.Reader = c.Request.Body
+	if partNumber == 1 {
+		// the first part holds the magic bytes, make sure they match what Init was told
+		buffered := bufio.NewReaderSize(c.Request.Body, sniffLen)
+		head, _ := buffered.Peek(sniffLen)
+		if contentType, ok := h.rules.checkFileType(head, session.Filename); !ok || contentType != session.ContentType {
+			apierror.Write(c, http.StatusUnsupportedMediaType, h.rules.unsupportedTypeError())
+			return
+		}
+		body = buffered
+	}
+
+	// hash the content on its way through while parts arrive in order, a re-sent part
+	// means the running hash no longer matches what storage holds, so stop hashing then
+	var hasher hash.Hash
+	switch {
+	case session.HashedParts >= 0 && partNumber == session.HashedParts+1:
+		if hasher, err = resumeHash(session.HashState); err != nil {
+			log.Println("Upload Hash Restore Error:", err)
+		} else {
+			body = io.TeeReader(body, hasher)
+		}
+	case session.HashedParts >= 0 && partNumber <= session.HashedParts:
+		if err := h.Store.SaveUploadHash(c.Request.Context(), session.ID, -1, nil); err != nil {
+			log.Println("Upload Hash Update Error:", err)
+		}
+	}
+
+	stored := size
+	if session.EncryptionKey != "" {
+		key, err := h.Keys.Unwrap(c.Request.Context(), session.EncryptionKey)
+		if err == nil {
+			body, err = envelope.Encrypt(body, key, partNumber)
+		}
+		if err != nil {
+			log.Println("Encryption Error:", err)
+			apierror.Write(c, http.StatusInternalServerError, "Failed to encrypt part")
+			return
+		}
+		stored = envelope.SealedSize(size)
+	}
+
+	start := time.Now()
+	ctx, span := tracing.Start(c.Request.Context(), "objectstore.PutPart", attribute.String("object.key", session.ObjectKey), attribute.Int("object.part", partNumber))
+	part, err := h.Objects.PutPart(ctx, session.Bucket, session.ObjectKey, session.MinioUploadID, partNumber, body, stored)
+	tracing.End(span, err)
+	metrics.ObserveMinioPut("put_part", start, err)
+	if err != nil {
+		log.Println("Storage Part Upload Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Failed to store part")
+		return
+	}
+
+	metrics.UploadBytes.WithLabelValues("chunked").Add(float64(size))
+
+	if hasher != nil {
+		state, err := saveHash(hasher)
+		if err == nil {
+			err = h.Store.SaveUploadHash(c.Request.Context(), session.ID, partNumber, state)
+		}
+		if err != nil {
+			log.Println("Upload Hash Update Error:", err)
+		}
+	}
+
+	// re-sending a part number overwrites it, same as S3 does. The size is the client's,
+	// the stored part is a little bigger when it is encrypted.
+	saved := models.UploadPart{PartNumber: partNumber, ETag: part.ETag, Size: size}
+	if err := h.Store.SaveUploadPart(c.Request.Context(), session.ID, saved); err != nil {
+		log.Println("Upload Part Insert Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Failed to record part")
+		return
+	}
+
+	c.JSON(http.StatusOK, saved)
+}
+
+// --- GET /upload/:id ---
+func (h *ChunkedUploadHandler) Status(c *gin.Context) {
+	session, err := h.Store.GetUploadSession(c.Request.Context(), c.Param("id"), middleware.UserID(c))
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Upload not found")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	parts, err := h.Store.ListUploadParts(c.Request.Context(), session.ID)
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	var received int64
+	for _, p := range parts {
+		received += p.Size
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"upload_id":      session.ID,
+		"status":         session.Status,
+		"parts":          parts,
+		"bytes_received": received,
+	})
+}
+
+// --- POST /upload/:id/complete ---
+func (h *ChunkedUploadHandler) Complete(c *gin.Context) {
+	session, ok := h.activeSession(c)
+	if !ok {
+		return
+	}
+
+	parts, err := h.Store.ListUploadParts(c.Request.Context(), session.ID)
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if len(parts) == 0 {
+		apierror.Write(c, http.StatusBadRequest, "No parts uploaded")
+		return
+	}
+
+	// parts must be contiguous from 1, a gap means the client still owes us a chunk
+	completed := make([]objectstore.Part, len(parts))
+	var size int64
+	for i, p := range parts {
+		if p.PartNumber != i+1 {
+			apierror.Write(c, http.StatusBadRequest, fmt.Sprintf("Part %d is missing", i+1))
+			return
+		}
+		completed[i] = objectstore.Part{Number: p.PartNumber, ETag: p.ETag, Size: p.Size}
+		size += p.Size
+	}
+
+	// when every part went through the running hash we know the content before assembling it,
+	// a duplicate is dropped by aborting the multipart upload so the parts are never stored as an object
+	var sum string
+	if session.HashedParts == len(parts) {
+		if hasher, err := resumeHash(session.HashState); err == nil {
+			sum = hex.EncodeToString(hasher.Sum(nil))
+		}
+	}
+	if sum != "" {
+		existing, found, err := findDuplicate(c.Request.Context(), h.Store, session.UserID, session.OrgID, sum)
+		if err != nil {
+			apierror.Write(c, http.StatusInternalServerError, "Database error")
+			return
+		}
+		if found {
+			if err := h.Objects.AbortMultipart(c.Request.Context(), session.Bucket, session.ObjectKey, session.MinioUploadID); err != nil {
+				log.Println("Storage Multipart Abort Error:", err)
+			}
+			if err := h.Store.UpdateUploadSession(c.Request.Context(), session.ID, models.UploadStatusCompleted, existing.ID); err != nil {
+				log.Println("Upload Session Update Error:", err)
+			}
+			if err := h.Store.DeleteUploadParts(c.Request.Context(), session.ID); err != nil {
+				log.Println("Upload Parts Delete Error:", err)
+			}
+			respondDuplicate(c, existing, latestJobID(c.Request.Context(), h.Store, existing.ID))
+			return
+		}
+	}
+
+	start := time.Now()
+	ctx, span := tracing.Start(c.Request.Context(), "objectstore.CompleteMultipart", attribute.String("object.key", session.ObjectKey), attribute.Int("object.parts", len(completed)))
+	info, err := h.Objects.CompleteMultipart(ctx, session.Bucket, session.ObjectKey, session.MinioUploadID, completed)
+	tracing.End(span, err)
+	metrics.ObserveMinioPut("complete_multipart", start, err)
+	if err != nil {
+		log.Println("Storage Multipart Complete Error:", err)
+		// most likely a non-final part under the 5 MiB minimum, the session stays open to fix it
+		var rejected *objectstore.RejectedError
+		if errors.As(err, &rejected) {
+			apierror.Write(c, http.StatusBadRequest, "Failed to assemble upload: "+rejected.Message)
+			return
+		}
+		apierror.Write(c, http.StatusInternalServerError, "Failed to assemble upload")
+		return
+	}
+
+	doc := models.Document{
+		ID:            "doc_" + uuid.NewString(),
+		UserID:        session.UserID,
+		OrgID:         session.OrgID,
+		CollectionID:  session.CollectionID,
+		Bucket:        session.Bucket,
+		ObjectKey:     info.Key,
+		Filename:      session.Filename,
+		ContentType:   session.ContentType,
+		Size:          size,
+		SHA256:        sum,
+		Tags:          session.Tags,
+		Metadata:      session.Metadata,
+		EncryptionKey: session.EncryptionKey,
+	}
+	if err := h.Store.CreateDocument(c.Request.Context(), doc); err != nil {
+		log.Println("Document Insert Error: ", err)
+		apierror.Write(c, http.StatusInternalServerError, "Failed to record document")
+		return
+	}
+
+	// a scan that didn't finish deleted the document, and with the parts assembled the upload
+	// can't be completed again, it has to start over
+	failure := scanDocument(c.Request.Context(), h.Store, h.Scanner, doc)
+	status, documentID := models.UploadStatusCompleted, doc.ID
+	if failure != nil && failure.DocumentID == "" {
+		status, documentID = models.UploadStatusFailed, ""
+	}
+	if err := h.Store.UpdateUploadSession(c.Request.Context(), session.ID, status, documentID); err != nil {
+		log.Println("Upload Session Update Error:", err)
+	}
+	if failure != nil {
+		failure.respond(c)
+		return
+	}
+
+	// the job only goes out once the whole object exists in storage
+	jobID, err := enqueueJob(c.Request.Context(), h.Store, h.Queue, doc, nil)
+	if err != nil {
+		respondQueueError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "File uploaded and processing started",
+		"job_id":      jobID,
+		"document_id": doc.ID,
+		"file_id":     info.Key,
+	})
+}
+
+// --- DELETE /upload/:id ---
+func (h *ChunkedUploadHandler) Abort(c *gin.Context) {
+	session, ok := h.activeSession(c)
+	if !ok {
+		return
+	}
+
+	if err := h.Objects.AbortMultipart(c.Request.Context(), session.Bucket, session.ObjectKey, session.MinioUploadID); err != nil {
+		log.Println("Storage Multipart Abort Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Failed to abort upload")
+		return
+	}
+
+	if err := h.Store.UpdateUploadSession(c.Request.Context(), session.ID, models.UploadStatusAborted, ""); err != nil {
+		log.Println("Upload Session Update Error:", err)
+	}
+	if err := h.Store.DeleteUploadParts(c.Request.Context(), session.ID); err != nil {
+		log.Println("Upload Parts Delete Error:", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Upload aborted"})
+}
+
+// activeSession loads the caller's session and makes sure it can still take parts.
+// It writes the error response itself, callers just return when ok is false.
+func (h *ChunkedUploadHandler) activeSession(c *gin.Context) (models.UploadSession, bool) {
+	session, err := h.Store.GetUploadSession(c.Request.Context(), c.Param("id"), middleware.UserID(c))
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Upload not found")
+		return session, false
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return session, false
+	}
+
+	if session.Status != models.UploadStatusInProgress {
+		apierror.Write(c, http.StatusConflict, "Upload is already "+session.Status)
+		return session, false
+	}
+	return session, true
+}
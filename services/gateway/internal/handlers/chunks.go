@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/keyword"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/dhruvkshah75/docstream/gateway/internal/vectorstore"
+	"github.com/gin-gonic/gin"
+)
+
+type ChunkHandler struct {
+	Store    storage.Store
+	Index    vectorstore.Store
+	Keywords keyword.Index
+}
+
+// Constructor for the chunk endpoint, chunks are read from whichever of the indexes is on
+func NewChunkHandler(store storage.Store, index vectorstore.Store, keywords keyword.Index) *ChunkHandler {
+	return &ChunkHandler{Store: store, Index: index, Keywords: keywords}
+}
+
+// ChunkDetail is a chunk with all its text, Start and End are byte offsets into the document's
+// extracted text. Both are 0 for chunks indexed before offsets were kept.
+type ChunkDetail struct {
+	ID         string `json:"id"`
+	DocumentID string `json:"document_id"`
+	Filename   string `json:"filename"`
+	ChunkIndex int    `json:"chunk_index"`
+	Page       int    `json:"page,omitempty"`
+	Heading    string `json:"heading,omitempty"`
+	Start      int    `json:"start"`
+	End        int    `json:"end"`
+	Text       string `json:"text"`
+}
+
+// chunkID is how search results, sources and citations name a chunk: "<document_id>:<index>"
+func chunkID(documentID string, index int) string {
+	return documentID + ":" + strconv.Itoa(index)
+}
+
+func parseChunkID(id string) (string, int, bool) {
+	cut := strings.LastIndexByte(id, ':')
+	if cut <= 0 {
+		return "", 0, false
+	}
+	index, err := strconv.Atoi(id[cut+1:])
+	if err != nil || index < 0 {
+		return "", 0, false
+	}
+	return id[:cut], index, true
+}
+
+// --- GET /chunks/:id ---
+// The text of a chunk of a document the caller can read, to show the passage a citation points at
+func (h *ChunkHandler) Get(c *gin.Context) {
+	if h.Index == nil && h.Keywords == nil {
+		apierror.Write(c, http.StatusServiceUnavailable, "Search is not enabled on this server")
+		return
+	}
+	documentID, index, ok := parseChunkID(c.Param("id"))
+	if !ok {
+		apierror.Write(c, http.StatusNotFound, "Chunk not found")
+		return
+	}
+
+	ctx := c.Request.Context()
+	doc, err := h.Store.GetReadableDocument(ctx, documentID, middleware.UserID(c))
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && doc.ScanStatus == models.ScanStatusInfected) {
+		apierror.Write(c, http.StatusNotFound, "Chunk not found")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	chunk, found, err := h.chunk(ctx, documentID, index)
+	if err != nil {
+		log.Println("Chunk Lookup Error:", err)
+		apierror.Write(c, http.StatusBadGateway, "Failed to load the chunk")
+		return
+	}
+	if !found {
+		apierror.Write(c, http.StatusNotFound, "Chunk not found")
+		return
+	}
+	c.JSON(http.StatusOK, ChunkDetail{
+		ID:         chunkID(documentID, index),
+		DocumentID: documentID,
+		Filename:   doc.Filename,
+		ChunkIndex: index,
+		Page:       chunk.Page,
+		Heading:    chunk.Heading,
+		Start:      chunk.Start,
+		End:        chunk.End,
+		Text:       chunk.Text,
+	})
+}
+
+// chunk looks in the vector store first and the keyword index after, a worker without
+// embeddings only fills the latter
+func (h *ChunkHandler) chunk(ctx context.Context, documentID string, index int) (models.Chunk, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, searchTimeout)
+	defer cancel()
+
+	if h.Index != nil {
+		live, _, err := liveIndex(ctx, h.Store, h.Index)
+		if err != nil {
+			return models.Chunk{}, false, err
+		}
+		p, err := live.Chunk(ctx, documentID, index)
+		if err == nil {
+			return models.Chunk{Index: p.ChunkIndex, Page: p.Page, Start: p.Start, End: p.End, Heading: p.Heading, Text: p.Text}, true, nil
+		}
+		if !errors.Is(err, vectorstore.ErrNotFound) {
+			return models.Chunk{}, false, err
+		}
+	}
+	if h.Keywords != nil {
+		chunk, err := h.Keywords.Chunk(ctx, documentID, index)
+		if err == nil {
+			return chunk, true, nil
+		}
+		if !errors.Is(err, storage.ErrNotFound) {
+			return models.Chunk{}, false, err
+		}
+	}
+	return models.Chunk{}, false, nil
+}
+
+// documentExport is the json format of GET /documents/:id/export
+type documentExport struct {
+	Document models.Document `json:"document"`
+	Text     string          `json:"text"`
+	Chunks   []ChunkDetail   `json:"chunks"`
+}
+
+// --- GET /documents/:id/export?format=txt|md|json ---
+// The processed document as a file to download: the extracted text alone (txt), the text under
+// the document's metadata and followed by a table of its chunks (md), or all three as json with
+// each chunk's text. The text is put back together from the indexed chunks.
+func (h *ChunkHandler) Export(c *gin.Context) {
+	if h.Index == nil && h.Keywords == nil {
+		apierror.Write(c, http.StatusServiceUnavailable, "Search is not enabled on this server, there is no extracted text to export")
+		return
+	}
+	format := c.DefaultQuery("format", "txt")
+	if format != "txt" && format != "md" && format != "json" {
+		apierror.Field(c, "format", "format must be txt, md or json")
+		return
+	}
+
+	ctx := c.Request.Context()
+	doc, err := h.Store.GetReadableDocument(ctx, c.Param("id"), middleware.UserID(c))
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Document not found")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if doc.ScanStatus == models.ScanStatusInfected {
+		apierror.Write(c, http.StatusForbidden, "Document is quarantined, malware detected: "+doc.ScanResult)
+		return
+	}
+	if doc.Entities, err = h.Store.ListDocumentEntities(ctx, doc.ID); err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	chunks, err := h.chunks(ctx, doc.ID)
+	if err != nil {
+		log.Println("Chunk Lookup Error:", err)
+		apierror.Write(c, http.StatusBadGateway, "Failed to load the document's chunks")
+		return
+	}
+	if len(chunks) == 0 && doc.Status != models.JobStatusCompleted {
+		apierror.Write(c, http.StatusConflict, "Document is "+doc.Status+", it can be exported once it is processed")
+		return
+	}
+	text := models.JoinChunks(chunks)
+
+	name := strings.TrimSuffix(doc.Filename, path.Ext(doc.Filename))
+	if name == "" {
+		name = doc.ID
+	}
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + "." + format}))
+	switch format {
+	case "txt":
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(text))
+	case "md":
+		c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(exportMarkdown(doc, text, chunks)))
+	case "json":
+		details := make([]ChunkDetail, len(chunks))
+		for i, chunk := range chunks {
+			details[i] = ChunkDetail{
+				ID:         chunkID(doc.ID, chunk.Index),
+				DocumentID: doc.ID,
+				Filename:   doc.Filename,
+				ChunkIndex: chunk.Index,
+				Page:       chunk.Page,
+				Heading:    chunk.Heading,
+				Start:      chunk.Start,
+				End:        chunk.End,
+				Text:       chunk.Text,
+			}
+		}
+		c.JSON(http.StatusOK, documentExport{Document: doc, Text: text, Chunks: details})
+	}
+}
+
+// chunks returns every chunk of a document by index, from the vector store's live collection or
+// else the keyword index. A reprocessing in flight leaves chunks of two jobs in the vector store,
+// only the latest job's are kept.
+func (h *ChunkHandler) chunks(ctx context.Context, documentID string) ([]models.Chunk, error) {
+	ctx, cancel := context.WithTimeout(ctx, searchTimeout)
+	defer cancel()
+
+	if h.Index != nil {
+		live, _, err := liveIndex(ctx, h.Store, h.Index)
+		if err != nil {
+			return nil, err
+		}
+		payloads, err := live.Chunks(ctx, documentID)
+		if err != nil {
+			return nil, err
+		}
+		if job, err := h.Store.GetLatestJobForDocument(ctx, documentID); err == nil && slices.ContainsFunc(payloads, func(p vectorstore.Payload) bool { return p.JobID == job.ID }) {
+			payloads = slices.DeleteFunc(payloads, func(p vectorstore.Payload) bool { return p.JobID != job.ID })
+		}
+		if len(payloads) > 0 {
+			chunks := make([]models.Chunk, len(payloads))
+			for i, p := range payloads {
+				chunks[i] = models.Chunk{Index: p.ChunkIndex, Page: p.Page, Start: p.Start, End: p.End, Heading: p.Heading, Text: p.Text}
+			}
+			slices.SortFunc(chunks, func(a, b models.Chunk) int { return a.Index - b.Index })
+			return chunks, nil
+		}
+	}
+	if h.Keywords != nil {
+		return h.Keywords.Chunks(ctx, documentID)
+	}
+	return nil, nil
+}
+
+// exportMarkdown lays a document out as Markdown: its metadata as a list, the summary, the text
+// and a table of the chunks with their offsets into the text
+func exportMarkdown(doc models.Document, text string, chunks []models.Chunk) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", doc.Filename)
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "- **%s:** %s\n", name, value)
+		}
+	}
+	field("Document ID", doc.ID)
+	field("Content type", doc.ContentType)
+	field("Size", strconv.FormatInt(doc.Size, 10)+" bytes")
+	field("SHA-256", doc.SHA256)
+	field("Version", strconv.Itoa(doc.Version))
+	field("Uploaded", doc.CreatedAt.UTC().Format(time.RFC3339))
+	field("Language", doc.Language)
+	field("Class", doc.Class)
+	field("Tags", strings.Join(doc.Tags, ", "))
+	for _, key := range slices.Sorted(maps.Keys(doc.Metadata)) {
+		field(key, doc.Metadata[key])
+	}
+
+	if doc.Summary != "" {
+		fmt.Fprintf(&b, "\n## Summary\n\n%s\n", doc.Summary)
+		if len(doc.KeyPoints) > 0 {
+			b.WriteString("\n")
+			for _, point := range doc.KeyPoints {
+				fmt.Fprintf(&b, "- %s\n", point)
+			}
+		}
+	}
+
+	fmt.Fprintf(&b, "\n## Text\n\n%s\n", strings.TrimRight(text, "\n"))
+
+	if len(chunks) > 0 {
+		b.WriteString("\n## Chunks\n\n| # | Page | Start | End | Heading |\n|---|---|---|---|---|\n")
+		cell := strings.NewReplacer("|", `\|`, "\n", " ", "\r", "")
+		for _, chunk := range chunks {
+			page := ""
+			if chunk.Page > 0 {
+				page = strconv.Itoa(chunk.Page)
+			}
+			fmt.Fprintf(&b, "| %d | %s | %d | %d | %s |\n", chunk.Index, page, chunk.Start, chunk.End, cell.Replace(chunk.Heading))
+		}
+	}
+	return b.String()
+}
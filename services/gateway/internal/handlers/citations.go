@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+)
+
+// citationTail is the markers a model puts right after a sentence's full stop, "it grew.[2]"
+var citationTail = regexp.MustCompile(`^(\s*\[\d+\])+`)
+
+// stopWords say nothing about what a sentence is about, they are left out when matching it to a passage
+var stopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "are": true, "was": true, "were": true, "that": true,
+	"this": true, "with": true, "from": true, "has": true, "have": true, "had": true, "not": true,
+	"but": true, "its": true, "which": true, "their": true, "they": true, "there": true, "been": true,
+	"also": true, "into": true, "than": true, "according": true, "source": true, "sources": true,
+}
+
+// span is a byte range of a text
+type span struct {
+	start, end int
+}
+
+// cite traces every sentence of the answer that cites [n] to the sentence of source n's chunk
+// sharing most of its words. sources are those buildPrompt numbered results by.
+func cite(answer string, sources []models.Source, results []SearchResult) []models.Citation {
+	citations := []models.Citation{}
+	for _, s := range sentences(answer) {
+		sentence := answer[s.start:s.end]
+		claim := contentWords(citationPattern.ReplaceAllString(sentence, " "))
+		cited := map[int]bool{}
+		for _, m := range citationPattern.FindAllStringSubmatch(sentence, -1) {
+			n, _ := strconv.Atoi(m[1])
+			if n < 1 || n > len(sources) || cited[n] {
+				continue
+			}
+			cited[n] = true
+
+			r := results[n-1]
+			passage, confidence := bestPassage(claim, r.text)
+			citations = append(citations, models.Citation{
+				N:           n,
+				DocumentID:  r.DocumentID,
+				ChunkID:     r.ChunkID,
+				Page:        r.Page,
+				Start:       r.Start + passage.start,
+				End:         r.Start + passage.end,
+				Confidence:  confidence,
+				AnswerStart: s.start,
+				AnswerEnd:   s.end,
+			})
+		}
+	}
+	return citations
+}
+
+// bestPassage picks the sentence of text that holds the biggest share of claim's words, the
+// whole text when it holds none of them
+func bestPassage(claim map[string]bool, text string) (span, float64) {
+	best, score := span{0, len(text)}, 0.0
+	if len(claim) == 0 {
+		return best, 0
+	}
+	for _, s := range sentences(text) {
+		words := contentWords(text[s.start:s.end])
+		found := 0
+		for w := range claim {
+			if words[w] {
+				found++
+			}
+		}
+		if share := float64(found) / float64(len(claim)); share > score {
+			best, score = s, share
+		}
+	}
+	return best, math.Round(score*100) / 100
+}
+
+// sentences splits text at full stops, question and exclamation marks followed by a space and at
+// line breaks, leaving the space around each sentence out. Citation markers right after a full
+// stop belong to the sentence before it.
+func sentences(text string) []span {
+	var spans []span
+	add := func(start, end int) {
+		for start < end && isSpace(text[start]) {
+			start++
+		}
+		for end > start && isSpace(text[end-1]) {
+			end--
+		}
+		if start < end {
+			spans = append(spans, span{start, end})
+		}
+	}
+
+	start := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\n':
+			add(start, i)
+			start = i + 1
+		case '.', '!', '?':
+			// "3.5" and "..." go on
+			if i+1 < len(text) && !isSpace(text[i+1]) && text[i+1] != '[' {
+				continue
+			}
+			end := i + 1 + len(citationTail.FindString(text[i+1:]))
+			add(start, end)
+			start = end
+			i = end - 1
+		}
+	}
+	add(start, len(text))
+	return spans
+}
+
+// contentWords are the lower case words of text that say what it is about: numbers, and words
+// of three letters or more that aren't stop words
+func contentWords(text string) map[string]bool {
+	words := map[string]bool{}
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if stopWords[w] {
+			continue
+		}
+		if len(w) > 2 || unicode.IsDigit(rune(w[0])) {
+			words[w] = true
+		}
+	}
+	return words
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\n' || b == '\t' || b == '\r'
+}
@@ -0,0 +1,479 @@
+package handlers
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/policy"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	// maxCollectionDepth keeps trees shallow, every upload walks up to the top for its defaults
+	maxCollectionDepth   = 10
+	maxCollectionNameLen = 255
+)
+
+type CollectionHandler struct {
+	Store storage.Store
+}
+
+// Constructor for the collection endpoints
+func NewCollectionHandler(store storage.Store) *CollectionHandler {
+	return &CollectionHandler{Store: store}
+}
+
+// sameScope reports whether a document of userID in orgID can be filed in col,
+// personal documents only go in their owner's personal collections
+func sameScope(col models.Collection, userID int, orgID string) bool {
+	if col.OrgID != "" || orgID != "" {
+		return col.OrgID == orgID
+	}
+	return col.UserID == userID
+}
+
+// getCollection loads a collection the caller can see, writing the error response when it can't.
+// With write set, org collections also need a role that may upload, unless the caller created them.
+func getCollection(c *gin.Context, store storage.Store, id string, write bool) (models.Collection, bool) {
+	col, failure := findCollection(c.Request.Context(), store, id, middleware.UserID(c), write)
+	if failure != nil {
+		failure.respond(c)
+		return col, false
+	}
+	return col, true
+}
+
+// findCollection is getCollection for userID without gin. Collections shared with them can be
+// read but not changed.
+func findCollection(ctx context.Context, store storage.Store, id string, userID int, write bool) (models.Collection, *apiFailure) {
+	lookup := store.GetReadableCollection
+	if write {
+		lookup = store.GetCollection
+	}
+	col, err := lookup(ctx, id, userID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return col, &apiFailure{Status: http.StatusNotFound, Message: "Collection not found"}
+	} else if err != nil {
+		return col, &apiFailure{Status: http.StatusInternalServerError, Message: "Database error"}
+	}
+	if write && col.UserID != userID {
+		role, failure := memberRole(ctx, store, col.OrgID, userID)
+		if failure != nil {
+			return col, failure
+		}
+		if !canUpload(role) {
+			return col, &apiFailure{Status: http.StatusForbidden, Message: "Viewers can't change this organization's collections"}
+		}
+	}
+	return col, nil
+}
+
+// fileableCollection checks that a new or moved document of userID in orgID may go into
+// collectionID, writing the error response when it may not. "" is always fine.
+func fileableCollection(c *gin.Context, store storage.Store, collectionID string, userID int, orgID string) bool {
+	if failure := checkCollection(c.Request.Context(), store, collectionID, userID, orgID); failure != nil {
+		failure.respond(c)
+		return false
+	}
+	return true
+}
+
+// checkCollection is fileableCollection without gin
+func checkCollection(ctx context.Context, store storage.Store, collectionID string, userID int, orgID string) *apiFailure {
+	if collectionID == "" {
+		return nil
+	}
+	col, failure := findCollection(ctx, store, collectionID, userID, true)
+	if failure != nil {
+		return failure
+	}
+	if !sameScope(col, userID, orgID) {
+		return &apiFailure{Status: http.StatusBadRequest, Message: "collection_id must be a collection of the same organization as the document, or a personal one for personal documents"}
+	}
+	return nil
+}
+
+func validateCollectionName(name string) error {
+	if name == "" {
+		return fmt.Errorf("name must not be empty")
+	}
+	if len(name) > maxCollectionNameLen {
+		return fmt.Errorf("name must be at most %d characters", maxCollectionNameLen)
+	}
+	return nil
+}
+
+// validateOptions checks collection defaults with the same rules as a reprocess
+func validateOptions(options *models.JobOptions) error {
+	if options == nil {
+		return nil
+	}
+	return ReprocessInput{
+		ChunkStrategy:  options.ChunkStrategy,
+		ChunkSize:      options.ChunkSize,
+		ChunkOverlap:   options.ChunkOverlap,
+		EmbeddingModel: options.EmbeddingModel,
+		SummaryModel:   options.SummaryModel,
+		Pipeline:       options.Pipeline,
+	}.validate()
+}
+
+// checkCollectionModels checks options may be col's defaults on its plan, see checkJobModels
+func checkCollectionModels(ctx context.Context, store storage.Store, col models.Collection, options *models.JobOptions) *apiFailure {
+	plan, failure := accountPlan(ctx, store, col.UserID, col.OrgID)
+	if failure != nil {
+		return failure
+	}
+	return checkJobModels(ctx, store, plan, options, "options.")
+}
+
+// collectionTree is every collection of one owner, by parent, for checking depth and cycles
+type collectionTree struct {
+	parent   map[string]string
+	children map[string][]string
+}
+
+func (h *CollectionHandler) tree(c *gin.Context, col models.Collection) (collectionTree, bool) {
+	cols, err := h.Store.ListCollections(c.Request.Context(), col.UserID, col.OrgID)
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return collectionTree{}, false
+	}
+	t := collectionTree{parent: map[string]string{}, children: map[string][]string{}}
+	for _, other := range cols {
+		t.parent[other.ID] = other.ParentID
+		t.children[other.ParentID] = append(t.children[other.ParentID], other.ID)
+	}
+	return t, true
+}
+
+// depth counts id and its parents, a top level collection has depth 1
+func (t collectionTree) depth(id string) int {
+	n := 0
+	for ; id != "" && n <= maxCollectionDepth; id = t.parent[id] {
+		n++
+	}
+	return n
+}
+
+// height counts the levels from id down to its deepest sub-collection, id itself included
+func (t collectionTree) height(id string) int {
+	h := 0
+	for _, child := range t.children[id] {
+		h = max(h, t.height(child))
+	}
+	return h + 1
+}
+
+// isBelow reports whether id is ancestor or one of its sub-collections
+func (t collectionTree) isBelow(id, ancestor string) bool {
+	for n := 0; id != "" && n <= maxCollectionDepth; id, n = t.parent[id], n+1 {
+		if id == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+type CollectionInput struct {
+	Name string `json:"name" binding:"required"`
+	// ParentID nests it, the new collection belongs to the parent's organization then
+	ParentID string `json:"parent_id"`
+	OrgID    string `json:"org_id"`
+	// Options are the pipeline defaults for documents uploaded into it
+	Options *models.JobOptions `json:"options"`
+}
+
+// --- POST /collections ---
+func (h *CollectionHandler) Create(c *gin.Context) {
+	var input CollectionInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Invalid(c, err)
+		return
+	}
+	col := models.Collection{
+		ID:       "col_" + uuid.NewString(),
+		UserID:   middleware.UserID(c),
+		OrgID:    input.OrgID,
+		ParentID: input.ParentID,
+		Name:     strings.TrimSpace(input.Name),
+		Options:  input.Options,
+	}
+	if err := validateCollectionName(col.Name); err != nil {
+		apierror.Field(c, "name", err.Error())
+		return
+	}
+	if err := validateOptions(col.Options); err != nil {
+		apierror.Field(c, "options", err.Error())
+		return
+	}
+	if col.ParentID != "" {
+		parent, ok := getCollection(c, h.Store, col.ParentID, true)
+		if !ok {
+			return
+		}
+		if input.OrgID != "" && input.OrgID != parent.OrgID {
+			apierror.Write(c, http.StatusBadRequest, "parent_id must be a collection of the same organization")
+			return
+		}
+		// a sub-collection of someone else's org collection still belongs to the org
+		col.OrgID = parent.OrgID
+		tree, ok := h.tree(c, parent)
+		if !ok {
+			return
+		}
+		if tree.depth(parent.ID) >= maxCollectionDepth {
+			apierror.Write(c, http.StatusBadRequest, fmt.Sprintf("collections can be nested at most %d deep", maxCollectionDepth))
+			return
+		}
+	} else if col.OrgID != "" {
+		role, ok := orgRole(c, h.Store, col.OrgID)
+		if !ok {
+			return
+		}
+		if !canUpload(role) {
+			apierror.Write(c, http.StatusForbidden, "Viewers can't add collections to this organization")
+			return
+		}
+	}
+	// the models are those of the plan of where the collection ended up
+	if f := checkCollectionModels(c.Request.Context(), h.Store, col, col.Options); f != nil {
+		f.respond(c)
+		return
+	}
+
+	if err := h.Store.CreateCollection(c.Request.Context(), col); err != nil {
+		log.Println("Collection Insert Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Failed to create collection")
+		return
+	}
+	created, err := h.Store.GetCollectionByID(c.Request.Context(), col.ID)
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusCreated, created)
+}
+
+// --- GET /collections ---
+// Every personal collection of the caller, or an organization's with ?org_id=, as one flat
+// list sorted by name. parent_id is what puts them together into a tree.
+func (h *CollectionHandler) List(c *gin.Context) {
+	orgID := c.Query("org_id")
+	if orgID != "" {
+		if _, ok := orgRole(c, h.Store, orgID); !ok {
+			return
+		}
+	}
+
+	cols, err := h.Store.ListCollections(c.Request.Context(), middleware.UserID(c), orgID)
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"collections": cols})
+}
+
+// --- GET /collections/:id ---
+// The documents in it are under GET /documents?collection_id=
+func (h *CollectionHandler) Get(c *gin.Context) {
+	col, ok := getCollection(c, h.Store, c.Param("id"), false)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, col)
+}
+
+// CollectionPatch renames, moves or re-configures a collection, whatever is left out stays
+type CollectionPatch struct {
+	Name *string `json:"name"`
+	// ParentID moves it under another collection of the same owner, "" moves it to the top level
+	ParentID *string `json:"parent_id"`
+	// Options replace the defaults, {} clears them. Documents already processed keep their settings.
+	Options *models.JobOptions `json:"options"`
+}
+
+// --- PATCH /collections/:id ---
+func (h *CollectionHandler) Update(c *gin.Context) {
+	var input CollectionPatch
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Invalid(c, err)
+		return
+	}
+
+	col, ok := getCollection(c, h.Store, c.Param("id"), true)
+	if !ok {
+		return
+	}
+
+	if input.Name != nil {
+		col.Name = strings.TrimSpace(*input.Name)
+		if err := validateCollectionName(col.Name); err != nil {
+			apierror.Field(c, "name", err.Error())
+			return
+		}
+	}
+	if input.Options != nil {
+		if err := validateOptions(input.Options); err != nil {
+			apierror.Field(c, "options", err.Error())
+			return
+		}
+		if f := checkCollectionModels(c.Request.Context(), h.Store, col, input.Options); f != nil {
+			f.respond(c)
+			return
+		}
+		col.Options = input.Options
+	}
+
+	if input.ParentID != nil && *input.ParentID != col.ParentID {
+		if parentID := *input.ParentID; parentID != "" {
+			parent, ok := getCollection(c, h.Store, parentID, true)
+			if !ok {
+				return
+			}
+			if !sameScope(parent, col.UserID, col.OrgID) {
+				apierror.Write(c, http.StatusBadRequest, "parent_id must be a collection of the same organization")
+				return
+			}
+			tree, ok := h.tree(c, col)
+			if !ok {
+				return
+			}
+			if tree.isBelow(parentID, col.ID) {
+				apierror.Write(c, http.StatusBadRequest, "A collection can't be moved into itself or one of its sub-collections")
+				return
+			}
+			if tree.depth(parentID)+tree.height(col.ID) > maxCollectionDepth {
+				apierror.Write(c, http.StatusBadRequest, fmt.Sprintf("collections can be nested at most %d deep", maxCollectionDepth))
+				return
+			}
+		}
+		col.ParentID = *input.ParentID
+	}
+
+	err := h.Store.UpdateCollection(c.Request.Context(), col)
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Collection not found")
+		return
+	} else if err != nil {
+		log.Println("Collection Update Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	updated, err := h.Store.GetCollectionByID(c.Request.Context(), col.ID)
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// --- DELETE /collections/:id ---
+// Only empty collections can be deleted, by whoever created them or an owner of their organization
+func (h *CollectionHandler) Delete(c *gin.Context) {
+	col, ok := getCollection(c, h.Store, c.Param("id"), true)
+	if !ok {
+		return
+	}
+	if col.UserID != middleware.UserID(c) {
+		role, ok := orgRole(c, h.Store, col.OrgID)
+		if !ok {
+			return
+		}
+		if role != models.RoleOwner {
+			apierror.Write(c, http.StatusForbidden, "Only the creator or an organization owner can delete this collection")
+			return
+		}
+	}
+
+	err := h.Store.DeleteCollection(c.Request.Context(), col.ID)
+	switch {
+	case errors.Is(err, storage.ErrNotEmpty):
+		apierror.Write(c, http.StatusConflict, "Collection isn't empty, move its documents and sub-collections out first")
+		return
+	case errors.Is(err, storage.ErrNotFound):
+		apierror.Write(c, http.StatusNotFound, "Collection not found")
+		return
+	case err != nil:
+		log.Println("Collection Delete Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Collection deleted"})
+}
+
+// defaultOptions fills in what options leave unset from the document's collection and
+// then its parents, the nearest one winning, and last from the uploader's preferences.
+// Models of those the document's plan doesn't include are left out, and on a plan without OCR
+// the job skips it. nil still means the worker's defaults.
+func defaultOptions(ctx context.Context, store storage.Store, doc models.Document, options *models.JobOptions) (*models.JobOptions, error) {
+	var merged models.JobOptions
+	if options != nil {
+		merged = *options
+	}
+	plan, err := policy.For(ctx, store, doc.UserID, doc.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	collectionID := doc.CollectionID
+	for n := 0; collectionID != "" && n < maxCollectionDepth; n++ {
+		col, err := store.GetCollectionByID(ctx, collectionID)
+		if errors.Is(err, storage.ErrNotFound) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		fillOptions(&merged, policy.Defaults(plan, col.Options))
+		collectionID = col.ParentID
+	}
+
+	user, err := store.GetUserByID(ctx, doc.UserID)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return nil, err
+	}
+	if user.Preferences != nil {
+		fillOptions(&merged, policy.Defaults(plan, user.Preferences.Options))
+	}
+
+	// neither may a size and the embedding model's limit, the limit wins
+	if merged.EmbeddingModel != "" {
+		m, err := store.GetAllowedModel(ctx, models.ModelKindEmbedding, merged.EmbeddingModel)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return nil, err
+		}
+		if m.MaxInputTokens > 0 && merged.ChunkSize > m.MaxInputTokens {
+			merged.ChunkSize = m.MaxInputTokens
+		}
+	}
+	// a size and an overlap picked at different levels may not fit together, the worker picks an overlap then
+	if merged.ChunkSize > 0 && merged.ChunkOverlap >= merged.ChunkSize {
+		merged.ChunkOverlap = 0
+	}
+	if merged == (models.JobOptions{}) {
+		return policy.Apply(plan, nil), nil
+	}
+	return policy.Apply(plan, &merged), nil
+}
+
+// fillOptions sets what merged leaves unset from defaults, which may be nil
+func fillOptions(merged, defaults *models.JobOptions) {
+	if defaults == nil {
+		return
+	}
+	merged.ChunkStrategy = cmp.Or(merged.ChunkStrategy, defaults.ChunkStrategy)
+	merged.ChunkSize = cmp.Or(merged.ChunkSize, defaults.ChunkSize)
+	merged.ChunkOverlap = cmp.Or(merged.ChunkOverlap, defaults.ChunkOverlap)
+	merged.EmbeddingModel = cmp.Or(merged.EmbeddingModel, defaults.EmbeddingModel)
+	merged.SummaryModel = cmp.Or(merged.SummaryModel, defaults.SummaryModel)
+	merged.Pipeline = cmp.Or(merged.Pipeline, defaults.Pipeline)
+}
@@ -0,0 +1,389 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+	"github.com/dhruvkshah75/docstream/gateway/internal/connectors"
+	"github.com/dhruvkshah75/docstream/gateway/internal/envelope"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/objectstore"
+	"github.com/dhruvkshah75/docstream/gateway/internal/queue"
+	"github.com/dhruvkshah75/docstream/gateway/internal/scanner"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	// how long an authorize URL stays good
+	connectorStateTTL   = 10 * time.Minute
+	maxConnectorFolders = 20
+)
+
+// ConnectorHandler links Google Drive and Dropbox accounts and, as a connectors.Ingester,
+// uploads what the syncer brings in from their folders
+type ConnectorHandler struct {
+	Store     storage.Store
+	Syncer    *connectors.Syncer
+	providers map[string]connectors.Provider
+	ingest    ingester
+}
+
+// Constructor for the connector endpoints, the syncer still has to be started with Syncer.Run
+func NewConnectorHandler(store storage.Store, objects objectstore.Store, keys *envelope.Keyring, publisher queue.Publisher, virusScanner *scanner.Scanner, cfg *config.Config) *ConnectorHandler {
+	h := &ConnectorHandler{
+		Store:     store,
+		providers: connectors.NewProviders(cfg.OAuth, cfg.Connectors),
+		ingest:    ingester{store: store, objects: objects, keys: keys, publisher: publisher, scanner: virusScanner, rules: newUploadRules(cfg), kind: "connector"},
+	}
+	h.Syncer = connectors.NewSyncer(store, h.providers, h, cfg.Connectors.SyncInterval, h.ingest.rules.maxSize)
+
+	for name := range h.providers {
+		log.Println("Connector enabled for", name)
+	}
+	return h
+}
+
+// getConnector loads the caller's connector from the :id param, writing the error response
+func (h *ConnectorHandler) getConnector(c *gin.Context) (models.Connector, bool) {
+	conn, err := h.Store.GetConnector(c.Request.Context(), c.Param("id"), middleware.UserID(c))
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Connector not found")
+		return conn, false
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return conn, false
+	}
+	return conn, true
+}
+
+// provider is the connector's provider, which can go away when its credentials are removed from the config
+func (h *ConnectorHandler) provider(c *gin.Context, conn models.Connector) (connectors.Provider, bool) {
+	provider, ok := h.providers[conn.Provider]
+	if !ok {
+		apierror.Write(c, http.StatusServiceUnavailable, "The "+conn.Provider+" connector is not configured")
+	}
+	return provider, ok
+}
+
+// authorize hands out a new state for linking the connector's account and the URL to do it at
+func (h *ConnectorHandler) authorize(c *gin.Context, conn models.Connector, provider connectors.Provider, status int) {
+	conn.OAuthState = newOpaqueToken()
+	if err := h.Store.UpdateConnector(c.Request.Context(), conn); err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(status, gin.H{
+		"connector":     conn,
+		"authorize_url": provider.AuthCodeURL(conn.OAuthState),
+	})
+}
+
+type ConnectorInput struct {
+	Provider string `json:"provider" binding:"required"`
+	// the documents it brings in go to this organization and collection, like with POST /upload
+	OrgID        string `json:"org_id"`
+	CollectionID string `json:"collection_id"`
+}
+
+// --- POST /connectors ---
+// Starts linking an account, the user opens authorize_url to approve access
+func (h *ConnectorHandler) Create(c *gin.Context) {
+	var input ConnectorInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Invalid(c, err)
+		return
+	}
+	provider, ok := h.providers[input.Provider]
+	if !ok {
+		names := make([]string, 0, len(h.providers))
+		for name := range h.providers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		apierror.Write(c, http.StatusBadRequest, fmt.Sprintf("provider must be one of the configured connectors: [%s]", strings.Join(names, ", ")))
+		return
+	}
+
+	target := uploadTarget{UserID: middleware.UserID(c), OrgID: input.OrgID, CollectionID: input.CollectionID}
+	if !target.allowed(c, h.Store) {
+		return
+	}
+
+	now := time.Now().UTC()
+	conn := models.Connector{
+		ID:           "con_" + uuid.NewString(),
+		UserID:       target.UserID,
+		OrgID:        target.OrgID,
+		CollectionID: target.CollectionID,
+		Provider:     input.Provider,
+		Status:       models.ConnectorStatusPending,
+		Folders:      []models.ConnectorFolder{},
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if err := h.Store.CreateConnector(c.Request.Context(), conn); err != nil {
+		log.Println("Connector Insert Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Failed to create connector")
+		return
+	}
+	h.authorize(c, conn, provider, http.StatusCreated)
+}
+
+// --- POST /connectors/:id/authorize ---
+// A new authorize URL, for a link that timed out or an account whose access was revoked
+func (h *ConnectorHandler) Authorize(c *gin.Context) {
+	conn, ok := h.getConnector(c)
+	if !ok {
+		return
+	}
+	provider, ok := h.provider(c, conn)
+	if !ok {
+		return
+	}
+	h.authorize(c, conn, provider, http.StatusOK)
+}
+
+// --- GET /connectors/callback/:provider ---
+// Where the provider sends the browser back to. There is no bearer token on a redirect,
+// the state alone says which connector it is, so it is single use and expires quickly.
+func (h *ConnectorHandler) Callback(c *gin.Context) {
+	provider, ok := h.providers[c.Param("provider")]
+	if !ok {
+		apierror.Write(c, http.StatusNotFound, "Unknown connector provider")
+		return
+	}
+
+	ctx := c.Request.Context()
+	conn, err := h.Store.GetConnectorByState(ctx, c.Query("state"))
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && (conn.Provider != c.Param("provider") || time.Since(conn.UpdatedAt) > connectorStateTTL)) {
+		apierror.Write(c, http.StatusBadRequest, "Invalid or expired link state, please start again")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	// one use only
+	conn.OAuthState = ""
+
+	if reason := c.Query("error"); reason != "" {
+		if err := h.Store.UpdateConnector(ctx, conn); err != nil {
+			log.Println("Connector Update Error:", err)
+		}
+		apierror.Write(c, http.StatusUnauthorized, "Access was not approved: "+reason)
+		return
+	}
+
+	token, err := provider.OAuth().Exchange(ctx, c.Query("code"))
+	if err != nil {
+		log.Println("Connector Code Exchange Error:", err)
+		apierror.Write(c, http.StatusUnauthorized, "Failed to link the account")
+		return
+	}
+	if token.RefreshToken == "" && conn.RefreshToken == "" {
+		// without one, syncing stops when the access token runs out in an hour or so
+		apierror.Write(c, http.StatusBadGateway, "The provider did not grant offline access, remove the app's access in your account settings and try again")
+		return
+	}
+	account, err := provider.Account(ctx, provider.OAuth().Client(ctx, token))
+	if err != nil {
+		log.Println("Connector Account Lookup Error:", err)
+		apierror.Write(c, http.StatusBadGateway, "Could not read the account from the provider")
+		return
+	}
+
+	connectors.SetToken(&conn, token)
+	conn.Account = account
+	conn.Status = models.ConnectorStatusActive
+	conn.Error = ""
+	if err := h.Store.UpdateConnector(ctx, conn); err != nil {
+		log.Println("Connector Update Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	log.Printf("Linked %s account %s for user %d\n", conn.Provider, account, conn.UserID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account linked, pick the folders to sync with PATCH /connectors/" + conn.ID, "connector": conn})
+}
+
+// --- GET /connectors ---
+func (h *ConnectorHandler) List(c *gin.Context) {
+	conns, err := h.Store.ListConnectors(c.Request.Context(), middleware.UserID(c))
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"connectors": conns})
+}
+
+// --- GET /connectors/:id ---
+func (h *ConnectorHandler) Get(c *gin.Context) {
+	conn, ok := h.getConnector(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, conn)
+}
+
+// linked is getConnector for the endpoints that talk to the account
+func (h *ConnectorHandler) linked(c *gin.Context) (models.Connector, connectors.Provider, bool) {
+	conn, ok := h.getConnector(c)
+	if !ok {
+		return conn, nil, false
+	}
+	if conn.Status != models.ConnectorStatusActive {
+		apierror.Write(c, http.StatusConflict, "The account is not linked, authorize it first")
+		return conn, nil, false
+	}
+	provider, ok := h.provider(c, conn)
+	return conn, provider, ok
+}
+
+// --- GET /connectors/:id/folders?parent= ---
+// Browses the account's folders to pick from, parent is a folder ID and defaults to the top
+func (h *ConnectorHandler) Folders(c *gin.Context) {
+	conn, provider, ok := h.linked(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	folders, err := provider.Folders(ctx, provider.OAuth().Client(ctx, connectors.Token(conn)), c.Query("parent"))
+	if errors.Is(err, connectors.ErrUnauthorized) {
+		apierror.Write(c, http.StatusConflict, err.Error())
+		return
+	} else if err != nil {
+		log.Println("Connector Folder Listing Error:", err)
+		apierror.Write(c, http.StatusBadGateway, "Failed to list folders")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"folders": folders})
+}
+
+type UpdateConnectorInput struct {
+	// Folders replaces the synced folders, files of folders that are dropped stay documents
+	Folders *[]models.ConnectorFolder `json:"folders"`
+	// CollectionID is where files synced from now on go, "" for no collection
+	CollectionID *string `json:"collection_id"`
+}
+
+// --- PATCH /connectors/:id ---
+func (h *ConnectorHandler) Update(c *gin.Context) {
+	var input UpdateConnectorInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Invalid(c, err)
+		return
+	}
+	conn, ok := h.getConnector(c)
+	if !ok {
+		return
+	}
+
+	if input.Folders != nil {
+		if len(*input.Folders) > maxConnectorFolders {
+			apierror.Write(c, http.StatusBadRequest, fmt.Sprintf("at most %d folders can be synced", maxConnectorFolders))
+			return
+		}
+		folders := []models.ConnectorFolder{}
+		seen := map[string]bool{}
+		for _, folder := range *input.Folders {
+			folder.ID = strings.TrimSpace(folder.ID)
+			if folder.ID == "" {
+				apierror.Write(c, http.StatusBadRequest, "every folder needs an id")
+				return
+			}
+			if !seen[folder.ID] {
+				seen[folder.ID] = true
+				folders = append(folders, models.ConnectorFolder{ID: folder.ID, Name: truncate(folder.Name, maxMetadataValueLength)})
+			}
+		}
+		conn.Folders = folders
+	}
+	if input.CollectionID != nil {
+		if !fileableCollection(c, h.Store, *input.CollectionID, conn.UserID, conn.OrgID) {
+			return
+		}
+		conn.CollectionID = *input.CollectionID
+	}
+
+	if err := h.Store.UpdateConnector(c.Request.Context(), conn); err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusOK, conn)
+}
+
+// --- POST /connectors/:id/sync ---
+// Syncs now instead of waiting for the schedule, the result shows on the connector afterwards
+func (h *ConnectorHandler) Sync(c *gin.Context) {
+	conn, _, ok := h.linked(c)
+	if !ok {
+		return
+	}
+	if len(conn.Folders) == 0 {
+		apierror.Write(c, http.StatusConflict, "No folders picked to sync")
+		return
+	}
+	// counts as this round's sync, the schedule doesn't run it again right after
+	if _, err := h.Store.ClaimConnectorSync(c.Request.Context(), conn.ID, time.Now()); err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if !h.Syncer.Start(conn) {
+		apierror.Write(c, http.StatusConflict, "A sync is already running")
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "Sync started"})
+}
+
+// --- DELETE /connectors/:id ---
+// Unlinks the account, the documents it brought in stay
+func (h *ConnectorHandler) Delete(c *gin.Context) {
+	err := h.Store.DeleteConnector(c.Request.Context(), c.Param("id"), middleware.UserID(c))
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Connector not found")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Connector deleted"})
+}
+
+// Ingest implements connectors.Ingester, uploading a synced file for the connector's owner
+func (h *ConnectorHandler) Ingest(ctx context.Context, conn models.Connector, filename string, src io.ReadSeeker, size int64) (string, error) {
+	if conn.OrgID != "" {
+		// the owner may have lost upload rights since linking, that stops the whole sync
+		m, err := h.Store.GetMembership(ctx, conn.OrgID, conn.UserID)
+		if errors.Is(err, storage.ErrNotFound) || (err == nil && !canUpload(m.Role)) {
+			return "", errors.New("the connector's owner can no longer upload to its organization")
+		} else if err != nil {
+			return "", err
+		}
+	}
+
+	target := uploadTarget{UserID: conn.UserID, OrgID: conn.OrgID, CollectionID: conn.CollectionID, Metadata: map[string]string{"source": conn.Provider}}
+	result, failure := h.ingest.ingest(ctx, target, filename, src, size)
+	if failure != nil {
+		if failure.Status < http.StatusInternalServerError {
+			return "", &connectors.Rejected{Reason: failure.Message}
+		}
+		return "", errors.New(failure.Message)
+	}
+	if result.Duplicate {
+		log.Printf("Synced %s was already document %s for user %d\n", filename, result.Document.ID, conn.UserID)
+		return "", nil
+	}
+	log.Printf("Synced %s became document %s (job %s) for user %d\n", filename, result.Document.ID, result.JobID, conn.UserID)
+	return result.Document.ID, nil
+}
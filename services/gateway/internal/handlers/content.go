@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/envelope"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/objectstore"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/dhruvkshah75/docstream/gateway/internal/tracing"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// objectReader is a stored object as the io.ReadSeeker http.ServeContent wants. Seeking is free,
+// the read after it opens the object from there on, so a range request only fetches its range.
+type objectReader struct {
+	ctx  context.Context
+	open func(ctx context.Context, offset int64) (io.ReadCloser, error)
+	size int64
+	pos  int64
+	body io.ReadCloser
+	// err is the last read failure, by then the response is already on its way
+	err error
+}
+
+func (r *objectReader) Read(p []byte) (int, error) {
+	if r.body == nil {
+		if r.pos >= r.size {
+			return 0, io.EOF
+		}
+		body, err := r.open(r.ctx, r.pos)
+		if err != nil {
+			r.err = err
+			return 0, err
+		}
+		r.body = body
+	}
+	n, err := r.body.Read(p)
+	r.pos += int64(n)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+func (r *objectReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.pos
+	case io.SeekEnd:
+		offset += r.size
+	}
+	if offset < 0 {
+		return 0, errors.New("seek before the start of the object")
+	}
+	if offset != r.pos {
+		r.Close()
+		r.pos = offset
+	}
+	return offset, nil
+}
+
+func (r *objectReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
+
+// --- GET /documents/:id/content ---
+// Streams a document through the gateway, with Range requests for viewers that seek around large
+// files (PDF.js does) and an ETag to revalidate against. It takes the usual credentials or the
+// token of a download link, access is checked again either way so a link stops working once its
+// user loses access to the document.
+//
+//	?disposition=attachment|inline, inline shows it in the browser instead of saving it
+func (h *DocumentHandler) Content(c *gin.Context) {
+	userID := middleware.UserID(c)
+	if token := c.Query("token"); token != "" {
+		claims, err := middleware.ParseSignedToken(token, jwt.WithAudience(downloadAudience))
+		docID, _ := claims["doc"].(string)
+		uid, _ := claims["uid"].(float64)
+		if err != nil || docID != c.Param("id") || uid <= 0 {
+			apierror.Write(c, http.StatusUnauthorized, "Invalid or expired download link")
+			return
+		}
+		userID = int(uid)
+	}
+
+	disposition := c.DefaultQuery("disposition", "attachment")
+	if disposition != "attachment" && disposition != "inline" {
+		apierror.Write(c, http.StatusBadRequest, "disposition must be attachment or inline")
+		return
+	}
+
+	doc, err := h.Store.GetReadableDocument(c.Request.Context(), c.Param("id"), userID)
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Document not found")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if doc.ScanStatus == models.ScanStatusInfected {
+		apierror.Write(c, http.StatusForbidden, "Document is quarantined, malware detected: "+doc.ScanResult)
+		return
+	}
+
+	// Stat finds a missing object before any headers go out, and an encrypted one's stored size
+	ctx, span := tracing.Start(c.Request.Context(), "objectstore.Stat", attribute.String("object.key", doc.ObjectKey))
+	info, err := h.Objects.Stat(ctx, doc.Bucket, doc.ObjectKey)
+	tracing.End(span, err)
+	if err != nil {
+		log.Println("Storage Download Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Failed to read document")
+		return
+	}
+	info.Key = doc.ObjectKey
+
+	size := info.Size
+	if doc.EncryptionKey != "" {
+		size = doc.Size
+	}
+	c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": doc.Filename}))
+	if doc.ContentType != "" {
+		c.Header("Content-Type", doc.ContentType)
+	}
+	if doc.SHA256 != "" {
+		c.Header("ETag", `"`+doc.SHA256+`"`)
+	}
+	h.serveObject(c, doc, info, size, doc.CreatedAt)
+}
+
+// serveObject streams info.Key, the document's object or one derived from it, with http.ServeContent.
+// Encrypted documents have everything derived from them sealed with the same data key, size is
+// the plaintext's. The caller sets Content-Type and ETag.
+func (h *DocumentHandler) serveObject(c *gin.Context, doc models.Document, info objectstore.ObjectInfo, size int64, modtime time.Time) {
+	getRange := func(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+		ctx, span := tracing.Start(ctx, "objectstore.GetRange", attribute.String("object.key", info.Key), attribute.Int64("object.offset", offset))
+		obj, err := h.Objects.GetRange(ctx, doc.Bucket, info.Key, offset, length)
+		tracing.End(span, err)
+		return obj, err
+	}
+	content := &objectReader{ctx: c.Request.Context(), size: size}
+	content.open = func(ctx context.Context, offset int64) (io.ReadCloser, error) {
+		return getRange(ctx, offset, info.Size-offset)
+	}
+	if doc.EncryptionKey != "" {
+		content.open = func(ctx context.Context, offset int64) (io.ReadCloser, error) {
+			return h.Keys.OpenAt(ctx, getRange, doc.EncryptionKey, size, info.Size, offset)
+		}
+	}
+	defer content.Close()
+
+	c.Header("X-Content-Type-Options", "nosniff")
+	// an HTML document opened inline mustn't run its scripts on the gateway's origin
+	c.Header("Content-Security-Policy", "sandbox")
+	c.Header("Cache-Control", "private, no-cache")
+	// ServeContent answers Range, If-Range, If-None-Match and HEAD. A read failing past the
+	// headers can only cut the response short, so it is logged.
+	http.ServeContent(c.Writer, c.Request, "", modtime, content)
+	if content.err != nil {
+		log.Println("Storage Download Error:", content.err)
+	}
+}
+
+// --- GET /documents/:id/thumbnail ---
+// The worker's PNG of the first page, for a grid of documents. 404 until it has rendered one.
+//
+//	?size=thumbnail|preview, the preview is larger
+func (h *DocumentHandler) Thumbnail(c *gin.Context) {
+	file := models.ThumbnailFile
+	switch c.DefaultQuery("size", "thumbnail") {
+	case "thumbnail":
+	case "preview":
+		file = models.PreviewFile
+	default:
+		apierror.Write(c, http.StatusBadRequest, "size must be thumbnail or preview")
+		return
+	}
+
+	doc, err := h.Store.GetReadableDocument(c.Request.Context(), c.Param("id"), middleware.UserID(c))
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Document not found")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	key := models.DerivedKey(doc.ID, file)
+	ctx, span := tracing.Start(c.Request.Context(), "objectstore.Stat", attribute.String("object.key", key))
+	info, err := h.Objects.Stat(ctx, doc.Bucket, key)
+	tracing.End(span, err)
+	if errors.Is(err, objectstore.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "No thumbnail yet")
+		return
+	} else if err != nil {
+		log.Println("Storage Thumbnail Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Failed to read thumbnail")
+		return
+	}
+	info.Key = key
+
+	size := info.Size
+	if doc.EncryptionKey != "" {
+		size = envelope.PlainSize(info.Size)
+	}
+	c.Header("Content-Type", "image/png")
+	if info.ETag != "" {
+		c.Header("ETag", `"`+strings.Trim(info.ETag, `"`)+`"`)
+	}
+	h.serveObject(c, doc, info, size, info.LastModified)
+}
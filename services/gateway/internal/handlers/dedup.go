@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// hashContent streams r through SHA-256, r is rewound afterwards so it can be uploaded
+func hashContent(r io.ReadSeeker) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// resumeHash picks a running hash back up from the state saved after the previous part
+func resumeHash(state []byte) (hash.Hash, error) {
+	h := sha256.New()
+	if len(state) == 0 {
+		return h, nil
+	}
+	err := h.(encoding.BinaryUnmarshaler).UnmarshalBinary(state)
+	return h, err
+}
+
+func saveHash(h hash.Hash) ([]byte, error) {
+	return h.(encoding.BinaryMarshaler).MarshalBinary()
+}
+
+// findDuplicate returns the existing document with the same content, found is false when there is none
+func findDuplicate(ctx context.Context, store storage.Store, userID int, orgID, sum string) (models.Document, bool, error) {
+	doc, err := store.FindDocumentByHash(ctx, userID, orgID, sum)
+	if errors.Is(err, storage.ErrNotFound) {
+		return doc, false, nil
+	}
+	return doc, err == nil, err
+}
+
+// respondDuplicate answers an upload with the document (and its latest job) that already has the content
+func respondDuplicate(c *gin.Context, doc models.Document, jobID string) {
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "File was already uploaded, reusing the existing document",
+		"job_id":      jobID,
+		"document_id": doc.ID,
+		"file_id":     doc.ObjectKey,
+		"duplicate":   true,
+	})
+}
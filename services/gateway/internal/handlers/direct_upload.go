@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+	"github.com/dhruvkshah75/docstream/gateway/internal/envelope"
+	"github.com/dhruvkshah75/docstream/gateway/internal/metrics"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/objectstore"
+	"github.com/dhruvkshah75/docstream/gateway/internal/queue"
+	"github.com/dhruvkshah75/docstream/gateway/internal/scanner"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/dhruvkshah75/docstream/gateway/internal/tracing"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// DirectUploadHandler lets clients send a file straight to object storage, the gateway never
+// sees its bytes:
+//
+//	POST /uploads/presign        check the upload against the limits and hand out a presigned URL
+//	(the client sends the file to that URL)
+//	POST /uploads/:id/complete   once storage has it, copy it to the document's key, record the
+//	                             document and enqueue the job
+//
+// Uploads that are never completed are discarded by the expire_uploads schedule, which also
+// deletes anything sent to the URL of a finished one before it expired.
+type DirectUploadHandler struct {
+	Store   storage.Store
+	Objects objectstore.Store
+	Keys    *envelope.Keyring
+	Queue   queue.Publisher
+	Scanner *scanner.Scanner
+	ttl     time.Duration
+	rules   uploadRules
+}
+
+// Constructor for the direct upload endpoints
+func NewDirectUploadHandler(store storage.Store, objects objectstore.Store, keys *envelope.Keyring, publisher queue.Publisher, virusScanner *scanner.Scanner, cfg *config.Config) *DirectUploadHandler {
+	return &DirectUploadHandler{Store: store, Objects: objects, Keys: keys, Queue: publisher, Scanner: virusScanner, ttl: cfg.Documents.UploadURLTTL, rules: newUploadRules(cfg)}
+}
+
+type PresignUploadInput struct {
+	Filename string `json:"filename" binding:"required"`
+	// Size is required, the limits are checked against it and the stored file has to match it
+	Size         int64             `json:"size" binding:"required"`
+	OrgID        string            `json:"org_id"`
+	CollectionID string            `json:"collection_id"`
+	Tags         []string          `json:"tags"`
+	Metadata     map[string]string `json:"metadata"`
+}
+
+// --- POST /uploads/presign ---
+func (h *DirectUploadHandler) Presign(c *gin.Context) {
+	var input PresignUploadInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Invalid(c, err)
+		return
+	}
+	input.Filename = sanitizeFilename(input.Filename)
+
+	// storage has to hold ciphertext, only the gateway can encrypt it on the way in
+	if h.Keys.Enabled() {
+		apierror.Write(c, http.StatusServiceUnavailable, "Direct uploads are not available while documents are encrypted at rest, use /upload/init")
+		return
+	}
+	if input.Size < 0 {
+		apierror.Field(c, "size", "size can't be negative")
+		return
+	}
+	if input.Size > h.rules.maxSize {
+		apierror.Write(c, http.StatusRequestEntityTooLarge, h.rules.tooLargeError())
+		return
+	}
+	// the extension decides the expected type here, the stored file is sniffed against it on completion
+	fileType := typeFromExtension(input.Filename)
+	if !h.rules.allowed[fileType] {
+		apierror.Write(c, http.StatusUnsupportedMediaType, h.rules.unsupportedTypeError())
+		return
+	}
+
+	userID := middleware.UserID(c)
+	if input.OrgID != "" {
+		role, ok := orgRole(c, h.Store, input.OrgID)
+		if !ok {
+			return
+		}
+		if !canUpload(role) {
+			apierror.Write(c, http.StatusForbidden, "Viewers can't upload to this organization")
+			return
+		}
+	}
+	if !fileableCollection(c, h.Store, input.CollectionID, userID, input.OrgID) {
+		return
+	}
+	if f := checkUploadPlan(c.Request.Context(), h.Store, uploadTarget{UserID: userID, OrgID: input.OrgID}, input.Size); f != nil {
+		f.respond(c)
+		return
+	}
+
+	tags, err := normalizeTags(input.Tags)
+	if err != nil {
+		apierror.Field(c, "tags", err.Error())
+		return
+	}
+	if err := validateMetadata(input.Metadata); err != nil {
+		apierror.Field(c, "metadata", err.Error())
+		return
+	}
+
+	expiresAt := time.Now().Add(h.ttl).UTC()
+	session := models.UploadSession{
+		ID:           "upl_" + uuid.NewString(),
+		UserID:       userID,
+		OrgID:        input.OrgID,
+		CollectionID: input.CollectionID,
+		Bucket:       h.rules.bucket,
+		Filename:     input.Filename,
+		ContentType:  fileTypes[fileType],
+		Status:       models.UploadStatusInProgress,
+		Tags:         tags,
+		Metadata:     input.Metadata,
+		Direct:       true,
+		Size:         input.Size,
+		ExpiresAt:    &expiresAt,
+	}
+	// the URL can be written to until it expires, the document never lives under it
+	session.ObjectKey = models.DirectUploadPrefix + session.ID + "/" + session.Filename
+
+	ctx, span := tracing.Start(c.Request.Context(), "objectstore.PresignUpload", attribute.String("object.key", session.ObjectKey))
+	upload, err := h.Objects.PresignUpload(ctx, session.Bucket, session.ObjectKey, h.ttl, session.ContentType)
+	tracing.End(span, err)
+	if errors.Is(err, objectstore.ErrUnsupported) {
+		apierror.Write(c, http.StatusServiceUnavailable, "Direct uploads are not available with this storage backend, use /upload/init")
+		return
+	} else if err != nil {
+		log.Println("Storage Presign Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Failed to start upload")
+		return
+	}
+
+	if err := h.Store.CreateUploadSession(c.Request.Context(), session); err != nil {
+		log.Println("Upload Session Insert Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Failed to start upload")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"upload_id":    session.ID,
+		"method":       upload.Method,
+		"url":          upload.URL.String(),
+		"headers":      upload.Headers,
+		"expires_at":   expiresAt,
+		"complete_url": "/uploads/" + session.ID + "/complete",
+	})
+}
+
+// --- POST /uploads/:id/complete ---
+// Called once the file was sent to the presigned URL. Only a stored file of the size and type
+// the upload was started with becomes a document, anything else is deleted from storage.
+// The document gets a copy of its own, so what it was checked as is what gets processed.
+func (h *DirectUploadHandler) Complete(c *gin.Context) {
+	ctx := c.Request.Context()
+	session, err := h.Store.GetUploadSession(ctx, c.Param("id"), middleware.UserID(c))
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && !session.Direct) {
+		apierror.Write(c, http.StatusNotFound, "Upload not found")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if session.Status != models.UploadStatusInProgress {
+		apierror.Write(c, http.StatusConflict, "Upload is already "+session.Status)
+		return
+	}
+	if session.ExpiresAt != nil && time.Now().After(session.ExpiresAt.Add(models.DirectUploadGrace)) {
+		apierror.Write(c, http.StatusGone, "Upload expired, start another one")
+		return
+	}
+
+	// two completions racing each other would make two documents, only the one that claims it goes on
+	claimed, err := h.Store.ClaimUploadSession(ctx, session.ID)
+	if err != nil {
+		log.Println("Upload Session Update Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if !claimed {
+		apierror.Write(c, http.StatusConflict, "Upload is already being completed")
+		return
+	}
+
+	key := fmt.Sprintf("%d_%s", time.Now().Unix(), session.Filename)
+	err = h.Objects.Copy(ctx, session.Bucket, session.ObjectKey, key)
+	if errors.Is(err, objectstore.ErrNotFound) {
+		h.reopen(ctx, session)
+		apierror.Write(c, http.StatusConflict, "The file isn't in storage yet, send it to the upload URL first")
+		return
+	} else if err != nil {
+		log.Println("Storage Copy Error:", err)
+		h.remove(ctx, session.Bucket, key)
+		h.reopen(ctx, session)
+		apierror.Write(c, http.StatusInternalServerError, "Failed to check upload")
+		return
+	}
+
+	info, err := h.Objects.Stat(ctx, session.Bucket, key)
+	if err != nil {
+		log.Println("Storage Stat Error:", err)
+		h.remove(ctx, session.Bucket, key)
+		h.reopen(ctx, session)
+		apierror.Write(c, http.StatusInternalServerError, "Failed to check upload")
+		return
+	}
+	if info.Size != session.Size {
+		h.discard(ctx, session, key)
+		apierror.Write(c, http.StatusBadRequest, fmt.Sprintf("Storage holds %d bytes, the upload was started for %d", info.Size, session.Size))
+		return
+	}
+
+	// the magic bytes have to match the extension the upload was started with
+	head, err := h.head(ctx, session, key)
+	if err != nil {
+		log.Println("Storage Read Error:", err)
+		h.remove(ctx, session.Bucket, key)
+		h.reopen(ctx, session)
+		apierror.Write(c, http.StatusInternalServerError, "Failed to check upload")
+		return
+	}
+	if contentType, ok := h.rules.checkFileType(head, session.Filename); !ok || contentType != session.ContentType {
+		h.discard(ctx, session, key)
+		apierror.Write(c, http.StatusUnsupportedMediaType, h.rules.unsupportedTypeError())
+		return
+	}
+	// the account may have filled up since, the file stays until the upload expires
+	if f := checkUploadPlan(ctx, h.Store, uploadTarget{UserID: session.UserID, OrgID: session.OrgID}, info.Size); f != nil {
+		h.remove(ctx, session.Bucket, key)
+		h.reopen(ctx, session)
+		f.respond(c)
+		return
+	}
+
+	doc := models.Document{
+		ID:           "doc_" + uuid.NewString(),
+		UserID:       session.UserID,
+		OrgID:        session.OrgID,
+		CollectionID: session.CollectionID,
+		Bucket:       session.Bucket,
+		ObjectKey:    key,
+		Filename:     session.Filename,
+		ContentType:  session.ContentType,
+		Size:         info.Size,
+		Tags:         session.Tags,
+		Metadata:     session.Metadata,
+	}
+	if err := h.Store.CreateDocument(ctx, doc); err != nil {
+		log.Println("Document Insert Error: ", err)
+		h.remove(ctx, session.Bucket, key)
+		h.reopen(ctx, session)
+		apierror.Write(c, http.StatusInternalServerError, "Failed to record document")
+		return
+	}
+	h.remove(ctx, session.Bucket, session.ObjectKey)
+	metrics.UploadBytes.WithLabelValues("direct").Add(float64(info.Size))
+
+	failure := scanDocument(ctx, h.Store, h.Scanner, doc)
+	status, documentID := models.UploadStatusCompleted, doc.ID
+	if failure != nil && failure.DocumentID == "" {
+		status, documentID = models.UploadStatusFailed, ""
+	}
+	if err := h.Store.UpdateUploadSession(ctx, session.ID, status, documentID); err != nil {
+		log.Println("Upload Session Update Error:", err)
+	}
+	if failure != nil {
+		failure.respond(c)
+		return
+	}
+
+	jobID, err := enqueueJob(ctx, h.Store, h.Queue, doc, nil)
+	if err != nil {
+		respondQueueError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "File uploaded and processing started",
+		"job_id":      jobID,
+		"document_id": doc.ID,
+		"file_id":     doc.ObjectKey,
+	})
+}
+
+// head reads the first bytes of the stored file, as many as sniffing looks at
+func (h *DirectUploadHandler) head(ctx context.Context, session models.UploadSession, key string) ([]byte, error) {
+	obj, err := h.Objects.GetRange(ctx, session.Bucket, key, 0, min(session.Size, sniffLen))
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+	return io.ReadAll(obj)
+}
+
+// reopen puts a claimed upload back in progress when completing it failed on our side, so the client can retry
+func (h *DirectUploadHandler) reopen(ctx context.Context, session models.UploadSession) {
+	if err := h.Store.UpdateUploadSession(ctx, session.ID, models.UploadStatusInProgress, ""); err != nil {
+		log.Println("Upload Session Update Error:", err)
+	}
+}
+
+// discard deletes a stored file that can't become a document, with its copy, and ends its upload
+func (h *DirectUploadHandler) discard(ctx context.Context, session models.UploadSession, key string) {
+	h.remove(ctx, session.Bucket, key)
+	h.remove(ctx, session.Bucket, session.ObjectKey)
+	if err := h.Store.UpdateUploadSession(ctx, session.ID, models.UploadStatusAborted, ""); err != nil {
+		log.Println("Upload Session Update Error:", err)
+	}
+}
+
+// remove deletes an object the upload doesn't need any more, a leftover is only logged
+func (h *DirectUploadHandler) remove(ctx context.Context, bucket, key string) {
+	if err := h.Objects.Delete(ctx, bucket, key); err != nil {
+		log.Println("Storage Delete Error:", err)
+	}
+}
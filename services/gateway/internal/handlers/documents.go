@@ -0,0 +1,662 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+	"github.com/dhruvkshah75/docstream/gateway/internal/envelope"
+	"github.com/dhruvkshah75/docstream/gateway/internal/keyword"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/objectstore"
+	"github.com/dhruvkshah75/docstream/gateway/internal/policy"
+	"github.com/dhruvkshah75/docstream/gateway/internal/purger"
+	"github.com/dhruvkshah75/docstream/gateway/internal/queue"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/dhruvkshah75/docstream/gateway/internal/tracing"
+	"github.com/dhruvkshah75/docstream/gateway/internal/vectorstore"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type DocumentHandler struct {
+	Store   storage.Store
+	Objects objectstore.Store
+	Keys    *envelope.Keyring
+	Queue   queue.Publisher
+	Purger  *purger.Purger
+	// Index gets tag and metadata changes onto already indexed vectors, nil when search is off
+	Index vectorstore.Store
+	// Keywords gets tag changes onto the keyword index, nil when keyword search is off
+	Keywords keyword.Index
+	// DownloadURLTTL is how long a presigned download link works, MinIO and S3 cap it at 7 days
+	DownloadURLTTL time.Duration
+	// BaseURL is the gateway's public address, encrypted documents are downloaded through it
+	BaseURL string
+}
+
+// Constructor for the document endpoints
+func NewDocumentHandler(store storage.Store, objects objectstore.Store, keys *envelope.Keyring, publisher queue.Publisher, documentPurger *purger.Purger, index vectorstore.Store, keywords keyword.Index, cfg config.Documents, baseURL string) *DocumentHandler {
+	return &DocumentHandler{Store: store, Objects: objects, Keys: keys, Queue: publisher, Purger: documentPurger, Index: index, Keywords: keywords, DownloadURLTTL: cfg.DownloadURLTTL, BaseURL: baseURL}
+}
+
+// downloadAudience marks download tokens, without a subject they are no good as access tokens
+const downloadAudience = "document_download"
+
+// downloadLink is a link to GET /documents/:id/content that works without credentials until expiry,
+// the stand-in for a presigned URL when storage only holds ciphertext
+func (h *DocumentHandler) downloadLink(doc models.Document, userID int, expiry time.Duration) (string, error) {
+	token, err := middleware.SignToken(jwt.MapClaims{
+		"aud": downloadAudience,
+		"doc": doc.ID,
+		"uid": userID,
+		"exp": time.Now().Add(expiry).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	return h.BaseURL + "/documents/" + url.PathEscape(doc.ID) + "/content?token=" + url.QueryEscape(token), nil
+}
+
+// documentCursor is the position after the last document of a page, handed to clients as an opaque string
+type documentCursor struct {
+	Sort      string    `json:"s"`
+	Desc      bool      `json:"d"`
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"c"`
+	Filename  string    `json:"f"`
+	Size      int64     `json:"z"`
+}
+
+func encodeCursor(sort string, desc bool, doc models.Document) string {
+	raw, _ := json.Marshal(documentCursor{Sort: sort, Desc: desc, ID: doc.ID, CreatedAt: doc.CreatedAt, Filename: doc.Filename, Size: doc.Size})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(s string) (documentCursor, error) {
+	var cursor documentCursor
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, err
+	}
+	err = json.Unmarshal(raw, &cursor)
+	return cursor, err
+}
+
+// parseDate accepts either a full RFC 3339 timestamp or just a day (2006-01-02, UTC)
+func parseDate(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, s)
+}
+
+// --- GET /documents ---
+// Lists the caller's personal documents, or an organization's with ?org_id=, one page at a time:
+//
+//	?org_id=<org>&collection_id=<collection>&status=<status>&type=pdf|docx|pptx|xlsx|html|txt|md&tag=<tag>
+//	&language=<ISO 639-1 code>&class=<class>&entity=<type>:<value>&uploaded_after=<date>&uploaded_before=<date>
+//	&sort=created_at|filename|size&order=asc|desc
+//	&limit=<n>&cursor=<next_cursor from the previous page>&deleted=true&shared=true
+//
+// tag and entity can be repeated, only documents with all of them are listed. An entity is a
+// person, organization, date or amount the worker found, like entity=organization:acme inc.
+// collection_id only lists what is directly in that collection, not in its sub-collections.
+// deleted=true lists the trash instead, with when each document there will be purged (unless
+// it is under legal hold). shared=true lists what others shared with the caller instead, on its
+// own or through a collection, with collection_id to look inside a shared collection.
+// Newest first by default. next_cursor is null on the last page.
+func (h *DocumentHandler) ListDocuments(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		apierror.Write(c, http.StatusBadRequest, "limit must be between 1 and 100")
+		return
+	}
+
+	filter := storage.DocumentFilter{
+		UserID:       middleware.UserID(c),
+		Status:       c.Query("status"),
+		CollectionID: c.Query("collection_id"),
+		Class:        c.Query("class"),
+		Sort:         c.DefaultQuery("sort", storage.SortCreatedAt),
+		Deleted:      c.Query("deleted") == "true",
+		Shared:       c.Query("shared") == "true",
+		// one extra row tells us whether there is another page
+		Limit: limit + 1,
+	}
+
+	if filter.Shared && (c.Query("org_id") != "" || filter.Deleted) {
+		apierror.Write(c, http.StatusBadRequest, "shared=true can't be combined with org_id or deleted=true")
+		return
+	}
+	if orgID := c.Query("org_id"); orgID != "" {
+		// any role can read the shared corpus
+		if _, ok := orgRole(c, h.Store, orgID); !ok {
+			return
+		}
+		filter.OrgID = orgID
+	}
+
+	switch filter.Sort {
+	case storage.SortCreatedAt, storage.SortFilename, storage.SortSize:
+	default:
+		apierror.Write(c, http.StatusBadRequest, "sort must be one of created_at, filename, size")
+		return
+	}
+
+	// dates read best newest first, names and sizes smallest first
+	order := c.Query("order")
+	if order == "" {
+		order = "asc"
+		if filter.Sort == storage.SortCreatedAt {
+			order = "desc"
+		}
+	}
+	if order != "asc" && order != "desc" {
+		apierror.Write(c, http.StatusBadRequest, "order must be asc or desc")
+		return
+	}
+	filter.Desc = order == "desc"
+
+	if fileType := c.Query("type"); fileType != "" {
+		mime, ok := fileTypes[fileType]
+		if !ok {
+			apierror.Write(c, http.StatusBadRequest, "type must be one of "+strings.Join(typeNames, ", "))
+			return
+		}
+		filter.ContentType = mime
+	}
+
+	if filter.Tags, err = normalizeTags(c.QueryArray("tag")); err != nil {
+		apierror.Field(c, "tag", err.Error())
+		return
+	}
+
+	if filter.Entities, err = normalizeEntities(c.QueryArray("entity")); err != nil {
+		apierror.Field(c, "entity", err.Error())
+		return
+	}
+
+	if language := c.Query("language"); language != "" {
+		languages, err := normalizeLanguages([]string{language})
+		if err != nil {
+			apierror.Field(c, "language", err.Error())
+			return
+		}
+		filter.Language = languages[0]
+	}
+
+	if after := c.Query("uploaded_after"); after != "" {
+		if filter.CreatedAfter, err = parseDate(after); err != nil {
+			apierror.Write(c, http.StatusBadRequest, "uploaded_after must be a date (2006-01-02) or an RFC 3339 timestamp")
+			return
+		}
+	}
+	if before := c.Query("uploaded_before"); before != "" {
+		if filter.CreatedBefore, err = parseDate(before); err != nil {
+			apierror.Write(c, http.StatusBadRequest, "uploaded_before must be a date (2006-01-02) or an RFC 3339 timestamp")
+			return
+		}
+	}
+
+	if raw := c.Query("cursor"); raw != "" {
+		cursor, err := decodeCursor(raw)
+		// a cursor from a different sort would skip or repeat rows
+		if err != nil || cursor.Sort != filter.Sort || cursor.Desc != filter.Desc {
+			apierror.Write(c, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+		filter.After = &models.Document{ID: cursor.ID, CreatedAt: cursor.CreatedAt, Filename: cursor.Filename, Size: cursor.Size}
+	}
+
+	docs, err := h.Store.ListDocuments(c.Request.Context(), filter)
+	if err != nil {
+		log.Println("Document List Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	var next *string
+	if len(docs) > limit {
+		docs = docs[:limit]
+		cursor := encodeCursor(filter.Sort, filter.Desc, docs[limit-1])
+		next = &cursor
+	}
+	for i, doc := range docs {
+		// a hold keeps it in the trash until it is lifted
+		if doc.DeletedAt != nil && !doc.LegalHold {
+			purgeAt := h.Purger.PurgeAt(*doc.DeletedAt)
+			docs[i].PurgeAt = &purgeAt
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"documents": docs, "next_cursor": next})
+}
+
+// --- GET /documents/:id ---
+// Returns a document with its summary and key points and the people, organizations, dates and
+// amounts the worker found in it
+func (h *DocumentHandler) Get(c *gin.Context) {
+	doc, err := h.Store.GetReadableDocument(c.Request.Context(), c.Param("id"), middleware.UserID(c))
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Document not found")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if doc.Entities, err = h.Store.ListDocumentEntities(c.Request.Context(), doc.ID); err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusOK, doc)
+}
+
+// --- GET /documents/:id/download ---
+// Hands out a short-lived presigned storage URL so the file never streams through the gateway
+func (h *DocumentHandler) Download(c *gin.Context) {
+	doc, err := h.Store.GetReadableDocument(c.Request.Context(), c.Param("id"), middleware.UserID(c))
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Document not found")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	if doc.ScanStatus == models.ScanStatusInfected {
+		apierror.Write(c, http.StatusForbidden, "Document is quarantined, malware detected: "+doc.ScanResult)
+		return
+	}
+
+	link, err := h.downloadURL(c.Request.Context(), doc, middleware.UserID(c))
+	if err != nil {
+		log.Println("Download Link Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Failed to generate download link")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"url":        link,
+		"expires_at": time.Now().Add(h.DownloadURLTTL).UTC(),
+	})
+}
+
+// downloadURL is a presigned storage URL for the document that expires after DownloadURLTTL, or
+// a download link for userID when storage only holds ciphertext
+func (h *DocumentHandler) downloadURL(ctx context.Context, doc models.Document, userID int) (string, error) {
+	if doc.EncryptionKey != "" {
+		return h.downloadLink(doc, userID, h.DownloadURLTTL)
+	}
+	// passing the filename makes the browser save it under the name the user uploaded
+	ctx, span := tracing.Start(ctx, "objectstore.Presign", attribute.String("object.key", doc.ObjectKey))
+	presigned, err := h.Objects.Presign(ctx, doc.Bucket, doc.ObjectKey, h.DownloadURLTTL, doc.Filename)
+	tracing.End(span, err)
+	if err != nil {
+		return "", err
+	}
+	return presigned.String(), nil
+}
+
+// DocumentPatch changes a document's tags, metadata or collection, whatever is left out stays as it is.
+// tags replaces the whole list, metadata is merged in and a key set to null is removed.
+type DocumentPatch struct {
+	Tags     *[]string          `json:"tags"`
+	Metadata map[string]*string `json:"metadata"`
+	// CollectionID moves the document into another collection, "" takes it out of its current one
+	CollectionID *string `json:"collection_id"`
+}
+
+// --- PATCH /documents/:id ---
+// Only the uploader or a member of the document's organization may change it (viewers can't).
+// The vectors pick the change up straight away, reprocessing isn't needed.
+func (h *DocumentHandler) Update(c *gin.Context) {
+	var input DocumentPatch
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Invalid(c, err)
+		return
+	}
+
+	userID := middleware.UserID(c)
+	doc, err := h.Store.GetDocument(c.Request.Context(), c.Param("id"), userID)
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Document not found")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if doc.UserID != userID {
+		role, ok := orgRole(c, h.Store, doc.OrgID)
+		if !ok {
+			return
+		}
+		if !canUpload(role) {
+			apierror.Write(c, http.StatusForbidden, "Viewers can't change this organization's documents")
+			return
+		}
+	}
+
+	if input.Tags != nil {
+		if doc.Tags, err = normalizeTags(*input.Tags); err != nil {
+			apierror.Field(c, "tags", err.Error())
+			return
+		}
+	}
+	if len(input.Metadata) > 0 && doc.Metadata == nil {
+		doc.Metadata = map[string]string{}
+	}
+	for k, v := range input.Metadata {
+		if v == nil {
+			delete(doc.Metadata, k)
+		} else {
+			doc.Metadata[k] = *v
+		}
+	}
+	if err := validateMetadata(doc.Metadata); err != nil {
+		apierror.Field(c, "metadata", err.Error())
+		return
+	}
+
+	if input.CollectionID != nil && *input.CollectionID != doc.CollectionID {
+		if !fileableCollection(c, h.Store, *input.CollectionID, doc.UserID, doc.OrgID) {
+			return
+		}
+		err := h.Store.MoveDocument(c.Request.Context(), doc.ID, *input.CollectionID)
+		if errors.Is(err, storage.ErrNotFound) {
+			apierror.Write(c, http.StatusNotFound, "Document not found")
+			return
+		} else if err != nil {
+			log.Println("Document Move Error:", err)
+			apierror.Write(c, http.StatusInternalServerError, "Database error")
+			return
+		}
+		doc.CollectionID = *input.CollectionID
+	}
+	if input.Tags == nil && input.Metadata == nil {
+		c.JSON(http.StatusOK, doc)
+		return
+	}
+
+	err = h.Store.UpdateDocumentMetadata(c.Request.Context(), doc.ID, doc.Tags, doc.Metadata)
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Document not found")
+		return
+	} else if err != nil {
+		log.Println("Document Update Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	// a job that is still running indexes with the old values, the next reprocess fixes that
+	if h.Index != nil {
+		ctx, span := tracing.Start(c.Request.Context(), "vectorstore.SetDocumentMetadata", attribute.String("document.id", doc.ID))
+		// every collection an embedding migration filled, searches may go back to an earlier one
+		collections, err := embeddingCollections(ctx, h.Store)
+		for i := 0; err == nil && i < len(collections); i++ {
+			err = h.Index.WithCollection(collections[i]).SetDocumentMetadata(ctx, doc.ID, doc.Tags, doc.Metadata)
+		}
+		tracing.End(span, err)
+		if err != nil {
+			// the database has the change, the next reprocess brings the vectors in line
+			log.Printf("Failed to update the vectors of %s: %v\n", doc.ID, err)
+		}
+	}
+	if h.Keywords != nil && input.Tags != nil {
+		if err := h.Keywords.SetDocumentTags(c.Request.Context(), doc.ID, doc.Tags); err != nil {
+			log.Printf("Failed to update the keyword index of %s: %v\n", doc.ID, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, doc)
+}
+
+// --- DELETE /documents/:id ---
+// Moves the document to the trash straight away, the object and derived data are purged
+// once DOCUMENT_RETENTION has passed (immediately when it isn't set). Until then
+// POST /documents/:id/restore brings it back.
+// Only the uploader or an owner of the document's organization may delete it, and nobody while it is under legal hold.
+func (h *DocumentHandler) Delete(c *gin.Context) {
+	userID := middleware.UserID(c)
+	doc, err := h.Store.GetDocument(c.Request.Context(), c.Param("id"), userID)
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Document not found")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if doc.UserID != userID {
+		role, ok := orgRole(c, h.Store, doc.OrgID)
+		if !ok {
+			return
+		}
+		if role != models.RoleOwner {
+			apierror.Write(c, http.StatusForbidden, "Only the uploader or an organization owner can delete this document")
+			return
+		}
+	}
+
+	doc, err = h.Store.SoftDeleteDocument(c.Request.Context(), doc.ID, userID)
+	if errors.Is(err, storage.ErrLegalHold) {
+		auditDocument(c, h.Store, models.AuditDeleteBlocked, doc.ID, fmt.Sprintf("deleting document %s refused, it is under legal hold", doc.ID))
+		apierror.Write(c, http.StatusConflict, "Document is under legal hold and can't be deleted")
+		return
+	} else if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Document not found")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	if h.Purger.Retention == 0 {
+		// the document is already hidden, if this fails the reaper retries it
+		if err := h.Purger.Purge(c.Request.Context(), doc); err != nil {
+			log.Printf("Failed to purge document %s: %v\n", doc.ID, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Document deleted",
+		"deleted_at": doc.DeletedAt,
+		"purge_at":   h.Purger.PurgeAt(*doc.DeletedAt),
+	})
+}
+
+// --- POST /documents/:id/restore ---
+// Takes a document back out of the trash, whoever may delete it may restore it. Its vectors stay
+// in the index until the purge, so it is searchable again straight away.
+func (h *DocumentHandler) Restore(c *gin.Context) {
+	userID := middleware.UserID(c)
+	doc, err := h.Store.GetDeletedDocument(c.Request.Context(), c.Param("id"), userID)
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Document not found in the trash")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if doc.UserID != userID {
+		role, ok := orgRole(c, h.Store, doc.OrgID)
+		if !ok {
+			return
+		}
+		if role != models.RoleOwner {
+			apierror.Write(c, http.StatusForbidden, "Only the uploader or an organization owner can restore this document")
+			return
+		}
+	}
+
+	// past its retention the reaper may already be deleting the object, unless it is held
+	cutoff := time.Now().Add(-h.Purger.Retention)
+	if doc.LegalHold {
+		cutoff = time.Time{}
+	}
+	if !doc.DeletedAt.After(cutoff) {
+		apierror.Write(c, http.StatusGone, "Document is past its retention and is being purged")
+		return
+	}
+	err = h.Store.RestoreDocument(c.Request.Context(), doc.ID, cutoff)
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Document not found in the trash")
+		return
+	} else if err != nil {
+		log.Println("Document Restore Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	doc.DeletedAt = nil
+	c.JSON(http.StatusOK, gin.H{"message": "Document restored", "document": doc})
+}
+
+// ReprocessInput picks fresh pipeline settings, anything left out uses the worker's defaults
+type ReprocessInput struct {
+	ChunkStrategy  string `json:"chunk_strategy"`
+	ChunkSize      int    `json:"chunk_size"`
+	ChunkOverlap   int    `json:"chunk_overlap"`
+	EmbeddingModel string `json:"embedding_model"`
+	SummaryModel   string `json:"summary_model"`
+	// Pipeline lists the worker stages to run, in order, e.g. "extract,chunk,embed,index"
+	Pipeline string `json:"pipeline"`
+}
+
+// maxChunkSize keeps a single chunk inside what embedding models accept
+const maxChunkSize = 8192
+
+func (in ReprocessInput) validate() error {
+	switch in.ChunkStrategy {
+	case "", "tokens", "sentences", "markdown":
+	default:
+		return fmt.Errorf("chunk_strategy must be tokens, sentences or markdown")
+	}
+	if in.ChunkSize < 0 || in.ChunkSize > maxChunkSize {
+		return fmt.Errorf("chunk_size must be between 1 and %d", maxChunkSize)
+	}
+	if in.ChunkOverlap < 0 {
+		return fmt.Errorf("chunk_overlap can't be negative")
+	}
+	if in.ChunkSize > 0 && in.ChunkOverlap >= in.ChunkSize {
+		return fmt.Errorf("chunk_overlap must be smaller than chunk_size")
+	}
+	// which stages exist is up to the workers, a job naming one they don't have fails there
+	if in.Pipeline != "" {
+		seen := map[string]bool{}
+		for _, stage := range strings.Split(in.Pipeline, ",") {
+			stage = strings.TrimSpace(stage)
+			if stage == "" || seen[stage] {
+				return fmt.Errorf("pipeline must list each stage once, comma separated")
+			}
+			seen[stage] = true
+		}
+	}
+	return nil
+}
+
+// --- POST /documents/:id/reprocess ---
+// Runs the stored object through the pipeline again, as a new job, without re-uploading it.
+// The body is optional; with settings in it they replace the defaults for this run only.
+func (h *DocumentHandler) Reprocess(c *gin.Context) {
+	var input ReprocessInput
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			apierror.Invalid(c, err)
+			return
+		}
+	}
+	if err := input.validate(); err != nil {
+		apierror.Write(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	userID := middleware.UserID(c)
+	doc, err := h.Store.GetDocument(c.Request.Context(), c.Param("id"), userID)
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Document not found")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if doc.UserID != userID {
+		role, ok := orgRole(c, h.Store, doc.OrgID)
+		if !ok {
+			return
+		}
+		if !canUpload(role) {
+			apierror.Write(c, http.StatusForbidden, "Viewers can't reprocess this organization's documents")
+			return
+		}
+	}
+	if doc.ScanStatus == models.ScanStatusInfected {
+		apierror.Write(c, http.StatusForbidden, "This file was flagged as malware and can't be processed")
+		return
+	}
+
+	// one job per document at a time, cancel the running one first
+	latest, err := h.Store.GetLatestJobForDocument(c.Request.Context(), doc.ID)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if err == nil && !models.IsFinal(latest.Status) {
+		body := apierror.Body(c, http.StatusConflict, "Document is already being processed")
+		body["job_id"] = latest.ID
+		c.JSON(http.StatusConflict, body)
+		return
+	}
+
+	var options *models.JobOptions
+	if input != (ReprocessInput{}) {
+		options = &models.JobOptions{
+			ChunkStrategy:  input.ChunkStrategy,
+			ChunkSize:      input.ChunkSize,
+			ChunkOverlap:   input.ChunkOverlap,
+			EmbeddingModel: input.EmbeddingModel,
+			SummaryModel:   input.SummaryModel,
+			Pipeline:       input.Pipeline,
+		}
+	}
+	// a reprocess is held to the plan like an upload, pages included
+	ctx := c.Request.Context()
+	plan, f := accountPlan(ctx, h.Store, doc.UserID, doc.OrgID)
+	if f == nil {
+		f = checkJobModels(ctx, h.Store, plan, options, "")
+	}
+	if f == nil {
+		f = planFailure(policy.CheckStorage(ctx, h.Store, plan, doc.UserID, doc.OrgID, 0))
+	}
+	if f == nil {
+		f = planFailure(policy.CheckPages(ctx, h.Store, plan, doc.UserID, doc.OrgID))
+	}
+	if f != nil {
+		f.respond(c)
+		return
+	}
+
+	jobID, err := enqueueJob(c.Request.Context(), h.Store, h.Queue, doc, options)
+	if err != nil {
+		respondQueueError(c, err)
+		return
+	}
+	auditDocument(c, h.Store, models.AuditDocumentReprocessed, doc.ID, "job "+jobID)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":     "Reprocessing started",
+		"job_id":      jobID,
+		"document_id": doc.ID,
+		"options":     options,
+	})
+}
@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/embeddings"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/queue"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/dhruvkshah75/docstream/gateway/internal/vectorstore"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultMigrationBatch = 100
+	maxMigrationBatch     = 1000
+	// embedProbeTimeout bounds trying the new model out before a migration starts
+	embedProbeTimeout = 30 * time.Second
+)
+
+// EmbeddingMigrationHandler is the admin API for moving the corpus to another embedding model
+type EmbeddingMigrationHandler struct {
+	Store    storage.Store
+	Embedder embeddings.Provider
+	Index    vectorstore.Store
+	// Collection is COLLECTION_NAME, the collections of migrations are named after it
+	Collection string
+}
+
+// Constructor for the embedding migration endpoints, embedder and index are nil when semantic search is off
+func NewEmbeddingMigrationHandler(store storage.Store, embedder embeddings.Provider, index vectorstore.Store, collection string) *EmbeddingMigrationHandler {
+	return &EmbeddingMigrationHandler{Store: store, Embedder: embedder, Index: index, Collection: collection}
+}
+
+// EmbeddingMigrationInput starts a migration, BatchSize is how many documents are queued at a time
+type EmbeddingMigrationInput struct {
+	EmbeddingModel string `json:"embedding_model" binding:"required"`
+	BatchSize      int    `json:"batch_size"`
+}
+
+// --- POST /admin/embedding-migrations ---
+// Re-embeds every document with another model into a new collection. The migrate_embeddings
+// schedule queues a batch at a time and switches searches and new jobs over once every document
+// is in, until then searches keep going to the current collection.
+func (h *EmbeddingMigrationHandler) Start(c *gin.Context) {
+	if h.Embedder == nil || h.Index == nil {
+		apierror.Write(c, http.StatusServiceUnavailable, "Semantic search is not enabled on this server")
+		return
+	}
+	var input EmbeddingMigrationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Invalid(c, err)
+		return
+	}
+	if input.BatchSize == 0 {
+		input.BatchSize = defaultMigrationBatch
+	}
+	model := input.EmbeddingModel
+	if len(model) > maxModelNameLen || strconv.Quote(model) != `"`+model+`"` {
+		apierror.Field(c, "embedding_model", "embedding_model is not a model name")
+		return
+	}
+	if input.BatchSize < 1 || input.BatchSize > maxMigrationBatch {
+		apierror.Field(c, "batch_size", fmt.Sprintf("batch_size must be between 1 and %d", maxMigrationBatch))
+		return
+	}
+
+	ctx := c.Request.Context()
+	current, err := h.Store.CurrentEmbeddingMigration(ctx)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if model == current.EmbeddingModel || (current.EmbeddingModel == "" && model == h.Embedder.DefaultModel()) {
+		apierror.Field(c, "embedding_model", "searches use "+model+" already")
+		return
+	}
+	// a model the provider doesn't serve would fail every job
+	probeCtx, cancel := context.WithTimeout(ctx, embedProbeTimeout)
+	_, err = h.Embedder.Embed(probeCtx, model, []string{"embedding migration"})
+	cancel()
+	if err != nil {
+		log.Println("Embedding Probe Error:", err)
+		apierror.Field(c, "embedding_model", fmt.Sprintf("%s failed to embed with %s", h.Embedder.Name(), model))
+		return
+	}
+
+	m := models.EmbeddingMigration{
+		ID:             "emb_" + uuid.NewString(),
+		EmbeddingModel: model,
+		Collection:     migrationCollection(h.Collection, model),
+		FromModel:      current.EmbeddingModel,
+		FromCollection: current.Collection,
+		Status:         models.EmbeddingMigrationRunning,
+		BatchSize:      input.BatchSize,
+		CreatedBy:      middleware.UserID(c),
+	}
+	err = h.Store.CreateEmbeddingMigration(ctx, m)
+	if errors.Is(err, storage.ErrDuplicate) {
+		apierror.Write(c, http.StatusConflict, "An embedding migration is running already, cancel it first")
+		return
+	} else if err != nil {
+		log.Println("Embedding Migration Insert Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	audit(c, h.Store, models.AuditEmbeddingMigration, fmt.Sprintf("started re-embedding with %q into %s", model, m.Collection))
+
+	m, _ = h.Store.GetEmbeddingMigration(ctx, m.ID)
+	c.JSON(http.StatusAccepted, m)
+}
+
+// --- GET /admin/embedding-migrations ---
+// Every migration, the newest first, and the collection and model searches use now
+func (h *EmbeddingMigrationHandler) List(c *gin.Context) {
+	ctx := c.Request.Context()
+	list, err := h.Store.ListEmbeddingMigrations(ctx)
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	current, err := h.Store.CurrentEmbeddingMigration(ctx)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	live := gin.H{"collection": cmp.Or(current.Collection, h.Collection), "embedding_model": current.EmbeddingModel, "migration_id": current.ID}
+	if current.ID == "" && h.Embedder != nil {
+		live["embedding_model"] = h.Embedder.DefaultModel()
+	}
+	c.JSON(http.StatusOK, gin.H{"migrations": list, "current": live})
+}
+
+// --- GET /admin/embedding-migrations/:id ---
+func (h *EmbeddingMigrationHandler) Get(c *gin.Context) {
+	m, ok := h.get(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, m)
+}
+
+// --- POST /admin/embedding-migrations/:id/switch ---
+// Switches over without waiting for the documents that failed to re-embed, they drop out of
+// semantic search until they are reprocessed. Documents still to be re-embedded hold it up.
+func (h *EmbeddingMigrationHandler) Switch(c *gin.Context) {
+	m, ok := h.get(c)
+	if !ok {
+		return
+	}
+	if m.Status != models.EmbeddingMigrationRunning {
+		apierror.Write(c, http.StatusConflict, "Migration is "+m.Status)
+		return
+	}
+	ctx := c.Request.Context()
+	p, err := h.Store.EmbeddingProgress(ctx, m.Collection)
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if pending := p.Pending(); pending > 0 {
+		apierror.Write(c, http.StatusConflict, fmt.Sprintf("%d documents are still to be re-embedded", pending))
+		return
+	}
+	message := fmt.Sprintf("switched over with %d of %d documents, %d failed", p.Migrated, p.Total, p.Failed)
+	err = h.Store.SwitchEmbeddingMigration(ctx, m.ID, p, message)
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusConflict, "Migration is no longer running")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	audit(c, h.Store, models.AuditEmbeddingMigration, fmt.Sprintf("switched searches to %s, leaving %d failed documents out", m.Collection, p.Failed))
+
+	m, _ = h.Store.GetEmbeddingMigration(ctx, m.ID)
+	c.JSON(http.StatusOK, m)
+}
+
+// --- POST /admin/embedding-migrations/:id/cancel ---
+// Searches stay where they are. Jobs already queued still finish into the collection, which is
+// left in the vector store to drop by hand.
+func (h *EmbeddingMigrationHandler) Cancel(c *gin.Context) {
+	m, ok := h.get(c)
+	if !ok {
+		return
+	}
+	err := h.Store.CancelEmbeddingMigration(c.Request.Context(), m.ID)
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusConflict, "Migration is "+m.Status)
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	audit(c, h.Store, models.AuditEmbeddingMigration, fmt.Sprintf("cancelled re-embedding into %s", m.Collection))
+	c.JSON(http.StatusOK, gin.H{"message": "Migration cancelled"})
+}
+
+func (h *EmbeddingMigrationHandler) get(c *gin.Context) (models.EmbeddingMigration, bool) {
+	m, err := h.Store.GetEmbeddingMigration(c.Request.Context(), c.Param("id"))
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Migration not found")
+		return m, false
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return m, false
+	}
+	return m, true
+}
+
+// migrationCollection names a migration's collection after the configured one and the model,
+// "documents_text_embedding_3_large_20261015093000"
+func migrationCollection(base, model string) string {
+	slug := strings.Trim(strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, strings.ToLower(model)), "_")
+	if len(slug) > 60 {
+		slug = slug[:60]
+	}
+	return base + "_" + slug + "_" + time.Now().UTC().Format("20060102150405")
+}
+
+// liveIndex is the collection searches go to, the one the embedding migration that completed
+// last filled along with the model it embedded with. Before any did it is index and "".
+func liveIndex(ctx context.Context, store storage.Store, index vectorstore.Store) (vectorstore.Store, string, error) {
+	current, err := store.CurrentEmbeddingMigration(ctx)
+	if errors.Is(err, storage.ErrNotFound) {
+		return index, "", nil
+	} else if err != nil {
+		return nil, "", err
+	}
+	return index.WithCollection(current.Collection), current.EmbeddingModel, nil
+}
+
+// embeddingCollections are the collections a document may have points in: the configured one,
+// "", and those of every embedding migration
+func embeddingCollections(ctx context.Context, store storage.Store) ([]string, error) {
+	migrations, err := store.ListEmbeddingMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	collections := []string{""}
+	for _, m := range migrations {
+		collections = append(collections, m.Collection)
+	}
+	return collections, nil
+}
+
+// EmbeddingMigrationTask is the migrate_embeddings schedule. Every run queues the documents of
+// the running migration that still need re-embedding, no more than its batch size in flight so
+// uploads aren't stuck behind it, and switches over once every document is in.
+type EmbeddingMigrationTask struct {
+	Store storage.Store
+	Queue queue.Publisher
+}
+
+// Constructor for the migration task
+func NewEmbeddingMigrationTask(store storage.Store, publisher queue.Publisher) *EmbeddingMigrationTask {
+	return &EmbeddingMigrationTask{Store: store, Queue: publisher}
+}
+
+// Run advances the running migration, if there is one
+func (t *EmbeddingMigrationTask) Run(ctx context.Context) (string, error) {
+	m, err := t.Store.RunningEmbeddingMigration(ctx)
+	if errors.Is(err, storage.ErrNotFound) {
+		return "no embedding migration is running", nil
+	} else if err != nil {
+		return "", err
+	}
+	p, err := t.Store.EmbeddingProgress(ctx, m.Collection)
+	if err != nil {
+		return "", fmt.Errorf("counting documents: %w", err)
+	}
+
+	if p.Pending() == 0 && p.Failed == 0 {
+		message := fmt.Sprintf("switched searches to %s after re-embedding %d documents with %s", m.Collection, p.Migrated, m.EmbeddingModel)
+		if err := t.Store.SwitchEmbeddingMigration(ctx, m.ID, p, message); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return "", err
+		}
+		return message, nil
+	}
+
+	queued := 0
+	if room := m.BatchSize - p.Queued; room > 0 {
+		docs, err := t.Store.ListDocumentsToMigrate(ctx, m.Collection, room)
+		if err != nil {
+			return "", fmt.Errorf("listing documents: %w", err)
+		}
+		// only the model is forced, the collections' other processing defaults still apply
+		options := &models.JobOptions{EmbeddingModel: m.EmbeddingModel}
+		for _, doc := range docs {
+			if _, err := queueJob(ctx, t.Store, t.Queue, doc, options, m); err != nil {
+				return "", fmt.Errorf("queued %d documents, then %s failed: %w", queued, doc.ID, err)
+			}
+			queued++
+		}
+	}
+
+	message := fmt.Sprintf("%d of %d documents re-embedded, %d queued", p.Migrated, p.Total, p.Queued+queued)
+	if p.Failed > 0 {
+		message += fmt.Sprintf(", %d failed", p.Failed)
+		if p.Pending() == 0 {
+			message += ": reprocess them or switch over without them"
+		}
+	}
+	if err := t.Store.UpdateEmbeddingMigration(ctx, m.ID, p, message); errors.Is(err, storage.ErrNotFound) {
+		return "the embedding migration was cancelled", nil
+	} else if err != nil {
+		return "", err
+	}
+	return message, nil
+}
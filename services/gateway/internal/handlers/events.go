@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/events"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+// sseHeartbeat keeps proxies and load balancers from closing a quiet stream
+const sseHeartbeat = 25 * time.Second
+
+type EventStreamHandler struct {
+	Hub *events.Hub
+}
+
+// Constructor for the user's live event stream
+func NewEventStreamHandler(hub *events.Hub) *EventStreamHandler {
+	return &EventStreamHandler{Hub: hub}
+}
+
+// --- GET /events ---
+// Streams the user's job status changes, pipeline stages, processed documents and quota warnings
+// as Server-Sent Events until they disconnect. Nothing is replayed, a client that reconnects
+// should fetch /jobs again for what it missed.
+func (h *EventStreamHandler) Stream(c *gin.Context) {
+	updates, unsubscribe := h.Hub.SubscribeUser(middleware.UserID(c))
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // keep nginx from holding the stream back
+	c.Status(http.StatusOK)
+	// a comment, so the client knows it is connected before the first event
+	io.WriteString(c.Writer, ": connected\n\n")
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := io.WriteString(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-updates:
+			if !ok {
+				return
+			}
+			c.SSEvent(eventName(event), event)
+		}
+		c.Writer.Flush()
+	}
+}
+
+// eventName is what a browser's EventSource listens for: job.status, job.stage,
+// document.processed or quota.warning
+func eventName(event events.Event) string {
+	if !strings.Contains(event.Type, ".") {
+		return "job." + event.Type
+	}
+	return event.Type
+}
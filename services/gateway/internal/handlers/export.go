@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/exporter"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type ExportHandler struct {
+	Store    storage.Store
+	Exporter *exporter.Exporter
+}
+
+// Constructor for data exports
+func NewExportHandler(store storage.Store, e *exporter.Exporter) *ExportHandler {
+	return &ExportHandler{Store: store, Exporter: e}
+}
+
+// --- POST /me/export ---
+// Starts building a zip of everything the account has: its profile, what it set up, the list
+// of its documents, their files and extracted text. Answers 202 right away, the export's
+// status is at GET /me/exports/:id and an export.finished event goes out on /events once it's
+// done, along with an email with the download link when mail is configured.
+func (h *ExportHandler) Create(c *gin.Context) {
+	ctx := c.Request.Context()
+	userID := middleware.UserID(c)
+	exports, err := h.Store.ListExports(ctx, userID)
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	for _, exp := range exports {
+		if exp.Status == models.ExportStatusPending || exp.Status == models.ExportStatusRunning {
+			apierror.Write(c, http.StatusConflict, "An export is being built already, wait for it to finish")
+			return
+		}
+	}
+
+	exp := models.Export{ID: uuid.NewString(), UserID: userID, Status: models.ExportStatusPending}
+	if err := h.Store.CreateExport(ctx, exp); err != nil {
+		log.Println("Export Create Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	audit(c, h.Store, models.AuditAccountExported, "data export "+exp.ID+" requested")
+	h.Exporter.Start(exp)
+
+	exp, _ = h.Store.GetExport(ctx, exp.ID, userID)
+	c.JSON(http.StatusAccepted, exp)
+}
+
+// --- GET /me/exports ---
+func (h *ExportHandler) List(c *gin.Context) {
+	exports, err := h.Store.ListExports(c.Request.Context(), middleware.UserID(c))
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"exports": exports})
+}
+
+// --- GET /me/exports/:id ---
+// A completed export comes with a download_url, a fresh presigned link every time
+func (h *ExportHandler) Get(c *gin.Context) {
+	ctx := c.Request.Context()
+	exp, err := h.Store.GetExport(ctx, c.Param("id"), middleware.UserID(c))
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Export not found")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if exp.Status == models.ExportStatusCompleted {
+		if exp.DownloadURL, err = h.Exporter.Link(ctx, exp); err != nil {
+			log.Println("Storage Presign Error:", err)
+			apierror.Write(c, http.StatusInternalServerError, "Failed to create download link")
+			return
+		}
+	}
+	c.JSON(http.StatusOK, exp)
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// sniffLen is how much of the file http.DetectContentType looks at
+const sniffLen = 512
+
+// the file types we know how to recognise, keyed by the name used in the allowed upload types
+var fileTypes = map[string]string{
+	"pdf":  "application/pdf",
+	"docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	"pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	"xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	"html": "text/html",
+	"txt":  "text/plain",
+	"md":   "text/markdown",
+}
+
+// typeNames is fileTypes in the order messages list them
+var typeNames = []string{"pdf", "docx", "pptx", "xlsx", "html", "txt", "md"}
+
+// officeFolders is the folder each OOXML format keeps its parts in
+var officeFolders = map[string]string{"docx": "word/", "pptx": "ppt/", "xlsx": "xl/"}
+
+// allowedTypeNames lists the allowlist for error messages
+func (r uploadRules) allowedTypeNames() string {
+	var names []string
+	for _, name := range typeNames {
+		if r.allowed[name] {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// typeFromExtension is what the filename claims to be, "" if we don't know the extension
+func typeFromExtension(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".pdf":
+		return "pdf"
+	case ".docx":
+		return "docx"
+	case ".pptx":
+		return "pptx"
+	case ".xlsx":
+		return "xlsx"
+	case ".html", ".htm":
+		return "html"
+	case ".txt":
+		return "txt"
+	case ".md", ".markdown":
+		return "md"
+	}
+	return ""
+}
+
+// sniffType works out the real type from the first bytes of the file.
+// The extension only breaks ties the bytes can't (plain text vs markdown, zip vs docx or pptx),
+// it never turns a binary into an allowed type.
+func sniffType(head []byte, filename string) string {
+	detected := http.DetectContentType(head)
+	ext := typeFromExtension(filename)
+
+	switch {
+	case strings.HasPrefix(detected, "application/pdf"):
+		return "pdf"
+	case detected == "application/zip":
+		// an Office file is a zip whose first entries are the OOXML manifest or its format's folder
+		if folder, ok := officeFolders[ext]; ok && (bytes.Contains(head, []byte("[Content_Types].xml")) || bytes.Contains(head, []byte(folder))) {
+			return ext
+		}
+	case strings.HasPrefix(detected, "text/html"):
+		// markdown may open with raw HTML
+		if ext == "md" {
+			return "md"
+		}
+		return "html"
+	case strings.HasPrefix(detected, "text/plain"):
+		if ext == "md" {
+			return "md"
+		}
+		return "txt"
+	}
+	return ""
+}
+
+// checkFileType sniffs the head of an upload and returns its MIME type,
+// ok is false when the type is unknown or not on the allowlist
+func (r uploadRules) checkFileType(head []byte, filename string) (mime string, ok bool) {
+	name := sniffType(head, filename)
+	if name == "" || !r.allowed[name] {
+		return "", false
+	}
+	return fileTypes[name], true
+}
+
+func (r uploadRules) unsupportedTypeError() string {
+	return "Unsupported file type, allowed types are: " + r.allowedTypeNames()
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/backpressure"
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+	"github.com/dhruvkshah75/docstream/gateway/internal/envelope"
+	"github.com/dhruvkshah75/docstream/gateway/internal/grpcapi"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/objectstore"
+	"github.com/dhruvkshah75/docstream/gateway/internal/queue"
+	"github.com/dhruvkshah75/docstream/gateway/internal/scanner"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+)
+
+// GRPCBackend implements grpcapi.Backend with the same code the REST endpoints run, an upload
+// over gRPC is checked, stored, scanned and queued exactly like one to POST /upload
+type GRPCBackend struct {
+	Accounts *AuthHandler
+	Searcher *SearchHandler
+	Store    storage.Store
+	Objects  objectstore.Store
+	Queue    queue.Publisher
+	Backlog  *backpressure.Monitor
+	ingest   ingester
+}
+
+// Constructor for the gRPC API's backend
+func NewGRPCBackend(auth *AuthHandler, search *SearchHandler, store storage.Store, objects objectstore.Store, keys *envelope.Keyring, publisher queue.Publisher, virusScanner *scanner.Scanner, backlog *backpressure.Monitor, cfg *config.Config) *GRPCBackend {
+	return &GRPCBackend{
+		Accounts: auth,
+		Searcher: search,
+		Store:    store,
+		Objects:  objects,
+		Queue:    publisher,
+		Backlog:  backlog,
+		ingest:   ingester{store: store, objects: objects, keys: keys, publisher: publisher, scanner: virusScanner, rules: newUploadRules(cfg), kind: "grpc"},
+	}
+}
+
+// refused is the failure the way the gRPC server reports it
+func (f *apiFailure) refused() *grpcapi.Refused {
+	if f.queueErr != nil {
+		log.Println("Queue Error: ", f.queueErr)
+	}
+	return &grpcapi.Refused{Status: f.Status, Message: f.Message, RetryAfter: f.RetryAfter}
+}
+
+func (b *GRPCBackend) Login(ctx context.Context, email, password, ip, userAgent string) (grpcapi.Tokens, error) {
+	pair, failure := b.Accounts.login(ctx, email, password, ip, userAgent)
+	if failure != nil {
+		return grpcapi.Tokens{}, failure.refused()
+	}
+	return grpcapi.Tokens(pair), nil
+}
+
+func (b *GRPCBackend) Refresh(ctx context.Context, refreshToken string) (grpcapi.Tokens, error) {
+	pair, failure := b.Accounts.refresh(ctx, refreshToken)
+	if failure != nil {
+		return grpcapi.Tokens{}, failure.refused()
+	}
+	return grpcapi.Tokens(pair), nil
+}
+
+func (b *GRPCBackend) Upload(ctx context.Context, file grpcapi.File) (grpcapi.Uploaded, error) {
+	// what needs(objectStorage, jobQueue) does for the REST route
+	for _, dep := range []middleware.Dependency{{Name: "Storage", Check: b.Objects.Available}, {Name: "Queue", Check: b.Queue.Ready}} {
+		if dep.Check() != nil {
+			return grpcapi.Uploaded{}, &grpcapi.Refused{Status: http.StatusServiceUnavailable, Message: dep.Name + " is unavailable, try again shortly"}
+		}
+	}
+	if b.Backlog.Full() {
+		return grpcapi.Uploaded{}, &grpcapi.Refused{Status: http.StatusServiceUnavailable, Message: backpressure.Message, RetryAfter: b.Backlog.RetryAfter()}
+	}
+	if file.Size > b.ingest.rules.maxSize {
+		return grpcapi.Uploaded{}, &grpcapi.Refused{Status: http.StatusRequestEntityTooLarge, Message: b.ingest.rules.tooLargeError()}
+	}
+
+	tags, err := normalizeTags(file.Tags)
+	if err != nil {
+		return grpcapi.Uploaded{}, &grpcapi.Refused{Status: http.StatusBadRequest, Message: err.Error()}
+	}
+	if err := validateMetadata(file.Metadata); err != nil {
+		return grpcapi.Uploaded{}, &grpcapi.Refused{Status: http.StatusBadRequest, Message: err.Error()}
+	}
+	target := uploadTarget{UserID: file.UserID, OrgID: file.OrgID, CollectionID: file.CollectionID, Tags: tags, Metadata: file.Metadata}
+	if failure := target.check(ctx, b.Store); failure != nil {
+		return grpcapi.Uploaded{}, failure.refused()
+	}
+
+	result, failure := b.ingest.ingest(ctx, target, file.Filename, file.Content, file.Size)
+	if failure != nil {
+		return grpcapi.Uploaded{}, failure.refused()
+	}
+	return grpcapi.Uploaded{DocumentID: result.Document.ID, JobID: result.JobID, Duplicate: result.Duplicate}, nil
+}
+
+func (b *GRPCBackend) Search(ctx context.Context, userID int, query grpcapi.Query) ([]grpcapi.Hit, error) {
+	results, failure := b.Searcher.run(ctx, userID, SearchInput{
+		Query:       query.Text,
+		Limit:       query.Limit,
+		OrgID:       query.OrgID,
+		DocumentIDs: query.DocumentIDs,
+		Tags:        query.Tags,
+		Languages:   query.Languages,
+	})
+	if failure != nil {
+		return nil, failure.refused()
+	}
+
+	hits := make([]grpcapi.Hit, 0, len(results))
+	for _, r := range results {
+		hits = append(hits, grpcapi.Hit{
+			DocumentID: r.DocumentID,
+			Filename:   r.Filename,
+			OrgID:      r.OrgID,
+			ChunkIndex: r.ChunkIndex,
+			Page:       r.Page,
+			Heading:    r.Heading,
+			Language:   r.Language,
+			Score:      r.Score,
+			Snippet:    r.Snippet,
+		})
+	}
+	return hits, nil
+}
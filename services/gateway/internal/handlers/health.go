@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/backpressure"
+	"github.com/dhruvkshah75/docstream/gateway/internal/objectstore"
+	"github.com/dhruvkshah75/docstream/gateway/internal/queue"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// readyTimeout bounds every dependency check, a probe that hangs is as bad as one that fails
+const readyTimeout = 2 * time.Second
+
+type HealthHandler struct {
+	Store   storage.Store
+	Objects objectstore.Store
+	Bucket  string
+	Queue   queue.Publisher
+	Backlog *backpressure.Monitor
+}
+
+// Constructor for the liveness and readiness probes
+func NewHealthHandler(store storage.Store, objects objectstore.Store, bucket string, publisher queue.Publisher, backlog *backpressure.Monitor) *HealthHandler {
+	return &HealthHandler{Store: store, Objects: objects, Bucket: bucket, Queue: publisher, Backlog: backlog}
+}
+
+// dependencyStatus is one entry of the readiness report
+type dependencyStatus struct {
+	Status    string `json:"status"` // ok or down
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// --- GET /healthz ---
+// Liveness, only says the process is serving. It deliberately checks nothing else,
+// a broker outage shouldn't get every gateway restarted.
+func (h *HealthHandler) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// --- GET /readyz ---
+// Readiness, checks the database, object storage and the message queue in parallel and
+// answers 503 if any of them is down so traffic goes to another instance. With backpressure
+// on the ingestion backlog is reported too, a full one only turns uploads away so it doesn't
+// take the instance out of rotation.
+//
+//	{"status": "ok", "checks": {"database": {"status": "ok", "latency_ms": 1}, ...}, "backlog": {"depth": 12, "limit": 1000, ...}}
+func (h *HealthHandler) Ready(c *gin.Context) {
+	checks := map[string]func(ctx context.Context) error{
+		"database": h.Store.Ping,
+		"storage": func(ctx context.Context) error {
+			// a bucket lookup needs working credentials too, not just a reachable host
+			exists, err := h.Objects.BucketExists(ctx, h.Bucket)
+			if err == nil && !exists {
+				err = fmt.Errorf("bucket %s does not exist", h.Bucket)
+			}
+			return err
+		},
+		"queue": func(ctx context.Context) error {
+			return h.Queue.Ready()
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readyTimeout)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := map[string]dependencyStatus{}
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			err := check(ctx)
+			result := dependencyStatus{Status: "ok", LatencyMS: time.Since(start).Milliseconds()}
+			if err != nil {
+				log.Printf("Readiness check %s failed: %v\n", name, err)
+				result.Status, result.Error = "down", err.Error()
+			}
+			mu.Lock()
+			results[name] = result
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	status, code := "ok", http.StatusOK
+	for _, result := range results {
+		if result.Status != "ok" {
+			status, code = "unavailable", http.StatusServiceUnavailable
+		}
+	}
+	report := gin.H{"status": status, "checks": results}
+	if backlog := h.Backlog.Status(); backlog != nil {
+		report["backlog"] = backlog
+	}
+	c.JSON(code, report)
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Highlight is where a word of the query is in a snippet, in characters (Unicode code points)
+// from the snippet's start, End exclusive
+type Highlight struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// highlight cuts a snippet of about n bytes out of text around where the words of terms are
+// thickest, and says where in it they are. Words match whole and in any case, the way keyword
+// search matches them. A vector hit might not contain any, it is snippeted from its start then.
+func highlight(text string, terms []string, n int) (string, []Highlight) {
+	text = strings.Join(strings.Fields(text), " ")
+	matches := findTerms(text, terms)
+	if len(text) <= n {
+		return text, toChars(text, 0, matches, "")
+	}
+
+	// the window starting at the match that has the most others fitting in after it
+	from := 0
+	if len(matches) > 0 {
+		best, count := 0, 0
+		for i, m := range matches {
+			j := i
+			for j < len(matches) && matches[j][1] <= m[0]+n {
+				j++
+			}
+			if j-i > count {
+				best, count = i, j-i
+			}
+		}
+		// some words ahead of the first match, as long as the last one still fits
+		first, last := matches[best][0], matches[best+count-1][1]
+		from = max(0, first-n/4, last-n)
+		// start at a word
+		if from > 0 && text[from-1] != ' ' {
+			if space := strings.IndexByte(text[from:first], ' '); space >= 0 {
+				from += space + 1
+			} else {
+				from = first
+			}
+		}
+	}
+
+	cut := snippet(text[from:], n)
+	end := len(text)
+	if len(text)-from > n {
+		end = from + len(cut) - len("…")
+	}
+	prefix := ""
+	if from > 0 {
+		prefix = "…"
+	}
+	var inside [][2]int
+	for _, m := range matches {
+		if m[0] >= from && m[1] <= end {
+			inside = append(inside, m)
+		}
+	}
+	return prefix + cut, toChars(text, from, inside, prefix)
+}
+
+// findTerms returns the byte ranges of the words of text that are one of terms
+func findTerms(text string, terms []string) [][2]int {
+	want := map[string]bool{}
+	for _, t := range terms {
+		want[t] = true
+	}
+	var matches [][2]int
+	start := -1
+	for i, r := range text + " " {
+		word := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case word && start < 0:
+			start = i
+		case !word && start >= 0:
+			if want[strings.ToLower(text[start:i])] {
+				matches = append(matches, [2]int{start, i})
+			}
+			start = -1
+		}
+	}
+	return matches
+}
+
+// toChars turns byte ranges into text into character ranges into the snippet cut from it at
+// from, behind prefix
+func toChars(text string, from int, matches [][2]int, prefix string) []Highlight {
+	highlights := []Highlight{}
+	base := utf8.RuneCountInString(prefix)
+	for _, m := range matches {
+		start := base + utf8.RuneCountInString(text[from:m[0]])
+		highlights = append(highlights, Highlight{Start: start, End: start + utf8.RuneCountInString(text[m[0]:m[1]])})
+	}
+	return highlights
+}
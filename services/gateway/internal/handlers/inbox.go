@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+	"github.com/dhruvkshah75/docstream/gateway/internal/envelope"
+	"github.com/dhruvkshah75/docstream/gateway/internal/mailin"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/objectstore"
+	"github.com/dhruvkshah75/docstream/gateway/internal/queue"
+	"github.com/dhruvkshah75/docstream/gateway/internal/scanner"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// InboxHandler hands out the per-user inbound email addresses and, as a mailin.Mailbox,
+// uploads the attachments of what arrives at them
+type InboxHandler struct {
+	Store  storage.Store
+	domain string
+	ingest ingester
+}
+
+// Constructor for the inbound email endpoints and mailbox
+func NewInboxHandler(store storage.Store, objects objectstore.Store, keys *envelope.Keyring, publisher queue.Publisher, virusScanner *scanner.Scanner, cfg *config.Config) *InboxHandler {
+	return &InboxHandler{
+		Store:  store,
+		domain: strings.ToLower(cfg.Email.Domain),
+		ingest: ingester{store: store, objects: objects, keys: keys, publisher: publisher, scanner: virusScanner, rules: newUploadRules(cfg), kind: "email"},
+	}
+}
+
+// newInboxToken is lowercase, mail servers don't all keep the case of a local part
+func newInboxToken() string {
+	b := make([]byte, 20)
+	rand.Read(b)
+	return strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))
+}
+
+func (h *InboxHandler) address(inbox models.Inbox) models.Inbox {
+	inbox.Address = inbox.Token + "@" + h.domain
+	return inbox
+}
+
+// --- GET /inbox ---
+// The caller's inbound address, created on first use
+func (h *InboxHandler) Get(c *gin.Context) {
+	if h.domain == "" {
+		apierror.Write(c, http.StatusNotFound, "Inbound email is not enabled")
+		return
+	}
+
+	userID := middleware.UserID(c)
+	inbox, err := h.Store.GetInbox(c.Request.Context(), userID)
+	if errors.Is(err, storage.ErrNotFound) {
+		h.rotate(c, userID)
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusOK, h.address(inbox))
+}
+
+// --- POST /inbox/rotate ---
+// A new address for when the old one leaked, mail to the old one bounces from now on
+func (h *InboxHandler) Rotate(c *gin.Context) {
+	if h.domain == "" {
+		apierror.Write(c, http.StatusNotFound, "Inbound email is not enabled")
+		return
+	}
+	h.rotate(c, middleware.UserID(c))
+}
+
+func (h *InboxHandler) rotate(c *gin.Context, userID int) {
+	if err := h.Store.SetInboxToken(c.Request.Context(), userID, newInboxToken()); err != nil {
+		log.Println("Inbox Update Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Failed to create inbox")
+		return
+	}
+	inbox, err := h.Store.GetInbox(c.Request.Context(), userID)
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusOK, h.address(inbox))
+}
+
+// Accepts implements mailin.Mailbox, only addresses that were handed out get mail
+func (h *InboxHandler) Accepts(ctx context.Context, local string) bool {
+	_, err := h.Store.GetInboxByToken(ctx, local)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		log.Println("Inbox Lookup Error:", err)
+	}
+	return err == nil
+}
+
+// Deliver implements mailin.Mailbox, uploading every attachment for the inbox's owner.
+// Files that are refused are only logged, there is nobody to answer. Failures on our
+// side, storage or the queue being down, fail the delivery so the sender retries, which
+// the duplicate check makes safe for the attachments that did go through.
+func (h *InboxHandler) Deliver(ctx context.Context, local string, msg *mailin.Message) error {
+	inbox, err := h.Store.GetInboxByToken(ctx, local)
+	if err != nil {
+		return err
+	}
+
+	// where it came from goes along as metadata, so forwarded invoices can be found by sender
+	target := uploadTarget{UserID: inbox.UserID, Metadata: map[string]string{"source": "email"}}
+	if msg.From != "" {
+		target.Metadata["email_from"] = truncate(msg.From, maxMetadataValueLength)
+	}
+	if msg.Subject != "" {
+		target.Metadata["email_subject"] = truncate(msg.Subject, maxMetadataValueLength)
+	}
+
+	if len(msg.Attachments) == 0 {
+		log.Printf("Mail from %s for user %d has no attachments\n", msg.Sender, inbox.UserID)
+	}
+	var failed error
+	for _, att := range msg.Attachments {
+		if int64(len(att.Data)) > h.ingest.rules.maxSize {
+			log.Printf("Skipping %s mailed to user %d: %s\n", att.Filename, inbox.UserID, h.ingest.rules.tooLargeError())
+			continue
+		}
+		result, failure := h.ingest.ingest(ctx, target, att.Filename, bytes.NewReader(att.Data), int64(len(att.Data)))
+		if failure != nil {
+			log.Printf("Skipping %s mailed to user %d: %s\n", att.Filename, inbox.UserID, failure.Message)
+			if failure.Status >= http.StatusInternalServerError {
+				failed = errors.Join(failed, errors.New(att.Filename+": "+failure.Message))
+			}
+			continue
+		}
+		if result.Duplicate {
+			log.Printf("Mailed %s was already document %s for user %d\n", att.Filename, result.Document.ID, inbox.UserID)
+			continue
+		}
+		log.Printf("Mailed %s became document %s (job %s) for user %d\n", att.Filename, result.Document.ID, result.JobID, inbox.UserID)
+	}
+	return failed
+}
+
+// truncate cuts s to at most n bytes without splitting a UTF-8 sequence
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	s = s[:n]
+	for len(s) > 0 && !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+	return s
+}
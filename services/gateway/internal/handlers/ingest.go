@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/envelope"
+	"github.com/dhruvkshah75/docstream/gateway/internal/metrics"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/objectstore"
+	"github.com/dhruvkshah75/docstream/gateway/internal/queue"
+	"github.com/dhruvkshah75/docstream/gateway/internal/scanner"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/dhruvkshah75/docstream/gateway/internal/tracing"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// uploadTarget is where uploaded files go and what they carry, every file of a batch shares one
+type uploadTarget struct {
+	UserID       int
+	OrgID        string
+	CollectionID string
+	Tags         []string
+	Metadata     map[string]string
+	// Options are the models the uploader picked, nil for the defaults
+	Options *models.JobOptions
+}
+
+// formTarget reads org_id, collection_id, embedding_model, summary_model, tags and metadata off an
+// upload form, checking the caller may upload there. It writes the error response when they can't.
+func formTarget(c *gin.Context, store storage.Store) (uploadTarget, bool) {
+	target := uploadTarget{UserID: middleware.UserID(c), OrgID: c.PostForm("org_id"), CollectionID: c.PostForm("collection_id")}
+	target.Options = pickedModels(c.PostForm("embedding_model"), c.PostForm("summary_model"))
+	if !target.allowed(c, store) {
+		return target, false
+	}
+
+	// Tags and metadata are optional, they travel with the document all the way into the vector store
+	var ok bool
+	target.Tags, target.Metadata, ok = formMetadata(c)
+	return target, ok
+}
+
+// allowed checks the caller may upload into the target's organization and collection,
+// writing the error response when they can't
+func (t uploadTarget) allowed(c *gin.Context, store storage.Store) bool {
+	if f := t.check(c.Request.Context(), store); f != nil {
+		f.respond(c)
+		return false
+	}
+	return true
+}
+
+// check is allowed without gin, for the gRPC upload
+func (t uploadTarget) check(ctx context.Context, store storage.Store) *apiFailure {
+	// Optionally file it under an organization the caller can upload to
+	if t.OrgID != "" {
+		role, failure := memberRole(ctx, store, t.OrgID, t.UserID)
+		if failure != nil {
+			return failure
+		}
+		if !canUpload(role) {
+			return &apiFailure{Status: http.StatusForbidden, Message: "Viewers can't upload to this organization"}
+		}
+	}
+
+	// and in a collection, whose processing defaults then apply
+	if failure := checkCollection(ctx, store, t.CollectionID, t.UserID, t.OrgID); failure != nil {
+		return failure
+	}
+	plan, failure := accountPlan(ctx, store, t.UserID, t.OrgID)
+	if failure != nil {
+		return failure
+	}
+	return checkJobModels(ctx, store, plan, t.Options, "")
+}
+
+// pickedModels are the job options of an upload that named models, nil when it named none
+func pickedModels(embeddingModel, summaryModel string) *models.JobOptions {
+	if embeddingModel == "" && summaryModel == "" {
+		return nil
+	}
+	return &models.JobOptions{EmbeddingModel: embeddingModel, SummaryModel: summaryModel}
+}
+
+// apiFailure is why a request didn't go through, with the status to answer it with.
+// The cores shared with the gRPC server return one instead of writing a gin response.
+type apiFailure struct {
+	Status  int
+	Message string
+	// Field is the input a 400 is about, it goes out as a field error
+	Field string
+	// DocumentID is set when the document was recorded anyway, like an infected one
+	DocumentID string
+	// RetryAfter goes out as the Retry-After header when set
+	RetryAfter time.Duration
+	// queueErr is the publish error when only queueing the job failed
+	queueErr error
+}
+
+// respond writes the failure the way the single file endpoints always have
+func (f *apiFailure) respond(c *gin.Context) {
+	if f.queueErr != nil {
+		respondQueueError(c, f.queueErr)
+		return
+	}
+	if f.Field != "" {
+		apierror.Field(c, f.Field, f.Message)
+		return
+	}
+	if f.RetryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(f.RetryAfter.Seconds()))))
+	}
+	body := apierror.Body(c, f.Status, f.Message)
+	if f.DocumentID != "" {
+		body["document_id"] = f.DocumentID
+	}
+	c.JSON(f.Status, body)
+}
+
+// ingested is a file that made it, Duplicate means the content was there already and
+// Document and JobID are the existing ones
+type ingested struct {
+	Document  models.Document
+	JobID     string
+	Duplicate bool
+}
+
+// ingester takes whole files into storage, the database and the queue. The chunked upload
+// assembles its object differently and only shares the scan and enqueue steps.
+type ingester struct {
+	store     storage.Store
+	objects   objectstore.Store
+	keys      *envelope.Keyring
+	publisher queue.Publisher
+	scanner   *scanner.Scanner
+	rules     uploadRules
+	// kind labels the uploaded bytes in metrics.UploadBytes
+	kind string
+}
+
+// ingest checks, stores and queues one file. src must be readable from the start and size its length.
+func (in ingester) ingest(ctx context.Context, target uploadTarget, filename string, src io.ReadSeeker, size int64) (ingested, *apiFailure) {
+	filename = sanitizeFilename(filename)
+
+	contentType, failure := in.sniff(src, filename)
+	if failure != nil {
+		return ingested{}, failure
+	}
+
+	// Hash it first so a re-upload never reaches storage. Big files are spooled to a
+	// temp file by the multipart parser, so this streams from disk without buffering it all
+	sum, err := hashContent(src)
+	if err != nil {
+		return ingested{}, &apiFailure{Status: http.StatusInternalServerError, Message: "Unable to read file"}
+	}
+	existing, found, err := findDuplicate(ctx, in.store, target.UserID, target.OrgID, sum)
+	if err != nil {
+		return ingested{}, &apiFailure{Status: http.StatusInternalServerError, Message: "Database error"}
+	}
+	if found {
+		return ingested{Document: existing, JobID: latestJobID(ctx, in.store, existing.ID), Duplicate: true}, nil
+	}
+	// a duplicate takes nothing more, anything else has to fit the plan
+	if failure := checkUploadPlan(ctx, in.store, target, size); failure != nil {
+		return ingested{}, failure
+	}
+
+	// Create a unique filename: timestamp_originalName.pdf
+	objectKey, wrappedKey, failure := in.put(ctx, fmt.Sprintf("%d_%s", time.Now().Unix(), filename), src, size, contentType)
+	if failure != nil {
+		return ingested{}, failure
+	}
+
+	// Record the document so it can be looked up (and downloaded) later
+	doc := models.Document{
+		ID:            "doc_" + uuid.NewString(),
+		UserID:        target.UserID,
+		OrgID:         target.OrgID,
+		CollectionID:  target.CollectionID,
+		Bucket:        in.rules.bucket,
+		ObjectKey:     objectKey,
+		Filename:      filename,
+		ContentType:   contentType,
+		Size:          size,
+		SHA256:        sum,
+		Tags:          target.Tags,
+		Metadata:      target.Metadata,
+		EncryptionKey: wrappedKey,
+	}
+	if err := in.store.CreateDocument(ctx, doc); err != nil {
+		log.Println("Document Insert Error: ", err)
+		return ingested{}, &apiFailure{Status: http.StatusInternalServerError, Message: "Failed to record document"}
+	}
+
+	// Infected files stop here, they never reach the worker
+	if f := scanDocument(ctx, in.store, in.scanner, doc); f != nil {
+		return ingested{}, f
+	}
+
+	jobID, err := enqueueJob(ctx, in.store, in.publisher, doc, target.Options)
+	if err != nil {
+		return ingested{}, queueFailure(err)
+	}
+	return ingested{Document: doc, JobID: jobID}, nil
+}
+
+// sniff checks what the file really is before it gets anywhere near storage, src is rewound afterwards
+func (in ingester) sniff(src io.ReadSeeker, filename string) (string, *apiFailure) {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(src, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", &apiFailure{Status: http.StatusBadRequest, Message: "Unable to read file"}
+	}
+	contentType, ok := in.rules.checkFileType(head[:n], filename)
+	if !ok {
+		return "", &apiFailure{Status: http.StatusUnsupportedMediaType, Message: in.rules.unsupportedTypeError()}
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return "", &apiFailure{Status: http.StatusInternalServerError, Message: "Unable to read file"}
+	}
+	return contentType, nil
+}
+
+// put uploads the file to object storage (MinIO, S3 or a local directory), returning the key
+// it was stored under and the wrapped data key it was encrypted with, if any
+func (in ingester) put(ctx context.Context, objectKey string, src io.Reader, size int64, contentType string) (string, string, *apiFailure) {
+	// with encryption on, storage only ever sees the file sealed with a data key of its own
+	body := src
+	stored, wrappedKey := size, ""
+	if in.keys.Enabled() {
+		key, wrapped, err := in.keys.NewDataKey(ctx)
+		if err == nil {
+			body, err = envelope.Encrypt(src, key, 1)
+		}
+		if err != nil {
+			log.Println("Encryption Error:", err)
+			return "", "", &apiFailure{Status: http.StatusInternalServerError, Message: "Failed to encrypt file"}
+		}
+		stored, wrappedKey = envelope.SealedSize(size), wrapped
+	}
+
+	// Stream directly to storage (effiecient for large files)
+	start := time.Now()
+	putCtx, span := tracing.Start(ctx, "objectstore.Put", attribute.String("object.bucket", in.rules.bucket), attribute.String("object.key", objectKey))
+	info, err := in.objects.Put(putCtx, in.rules.bucket, objectKey, body, stored, contentType)
+	tracing.End(span, err)
+	metrics.ObserveMinioPut("put_object", start, err)
+	if err != nil {
+		log.Println("Storage Upload Error:", err)
+		return "", "", &apiFailure{Status: http.StatusInternalServerError, Message: "Failed to upload to storage"}
+	}
+
+	metrics.UploadBytes.WithLabelValues(in.kind).Add(float64(size))
+	return info.Key, wrappedKey, nil
+}
+
+// scanDocument runs the virus scan on a freshly stored document, returning why it doesn't pass.
+// A failed scan hides the document again so the purger cleans up its object.
+func scanDocument(ctx context.Context, store storage.DocumentStore, virusScanner *scanner.Scanner, doc models.Document) *apiFailure {
+	verdict, err := virusScanner.Check(ctx, doc)
+	if err != nil {
+		log.Printf("Virus scan of %s failed: %v\n", doc.ID, err)
+		if _, err := store.SoftDeleteDocument(ctx, doc.ID, doc.UserID); err != nil {
+			log.Println("Document Delete Error:", err)
+		}
+		return &apiFailure{Status: http.StatusServiceUnavailable, Message: "Virus scan failed, try again later"}
+	}
+	if verdict.Infected {
+		return &apiFailure{Status: http.StatusUnprocessableEntity, Message: "File rejected, malware detected: " + verdict.Signature, DocumentID: doc.ID}
+	}
+	return nil
+}
+
+// queueFailure describes a failed enqueueJob, the message is what a batch item shows
+func queueFailure(err error) *apiFailure {
+	if queueDown(err) {
+		return &apiFailure{Status: http.StatusServiceUnavailable, Message: "Queue is unavailable, try again shortly", queueErr: err}
+	}
+	return &apiFailure{Status: http.StatusInternalServerError, Message: "Failed to queue job", queueErr: err}
+}
+
+// latestJobID is the ID of the document's most recent job, "" when it has none
+func latestJobID(ctx context.Context, store storage.JobStore, documentID string) string {
+	job, err := store.GetLatestJobForDocument(ctx, documentID)
+	if err == nil {
+		return job.ID
+	}
+	if !errors.Is(err, storage.ErrNotFound) {
+		log.Println("Job Lookup Error:", err)
+	}
+	return ""
+}
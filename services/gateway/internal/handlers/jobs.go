@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/queue"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+type JobHandler struct {
+	Store storage.Store
+	Queue queue.Publisher
+}
+
+// Constructor for the job status endpoints
+func NewJobHandler(store storage.Store, publisher queue.Publisher) *JobHandler {
+	return &JobHandler{Store: store, Queue: publisher}
+}
+
+// --- GET /jobs/:id ---
+// Jobs belonging to other users are reported as not found so IDs can't be probed
+func (h *JobHandler) GetJob(c *gin.Context) {
+	job, err := h.Store.GetJob(c.Request.Context(), c.Param("id"), middleware.UserID(c))
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Job not found")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if job.Stages, err = h.Store.ListJobStages(c.Request.Context(), job.ID); err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// --- GET /jobs ---
+// Lists the caller's jobs, supports ?status=<status>&limit=<n>&offset=<n>, newest first
+func (h *JobHandler) ListJobs(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		apierror.Write(c, http.StatusBadRequest, "limit must be between 1 and 100")
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		apierror.Write(c, http.StatusBadRequest, "offset must be a positive number")
+		return
+	}
+
+	jobs, err := h.Store.ListJobs(c.Request.Context(), storage.JobFilter{
+		UserID: middleware.UserID(c),
+		Status: c.Query("status"),
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"jobs": jobs, "limit": limit, "offset": offset})
+}
+
+// --- POST /jobs/:id/cancel ---
+// Marks the job cancelled and tells the workers. The worker running it stops after
+// the stage it is in and cleans up, anything it reports afterwards is ignored.
+func (h *JobHandler) Cancel(c *gin.Context) {
+	job, err := h.Store.GetJob(c.Request.Context(), c.Param("id"), middleware.UserID(c))
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Job not found")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if models.IsFinal(job.Status) {
+		apierror.Write(c, http.StatusConflict, "Job is already "+job.Status)
+		return
+	}
+
+	changed, err := h.Store.UpdateJobStatus(c.Request.Context(), job.ID, models.JobStatusCancelled, "cancelled by user")
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if !changed {
+		// it finished while we were looking
+		apierror.Write(c, http.StatusConflict, "Job has already finished")
+		return
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"job_id":      job.ID,
+		"document_id": job.DocumentID,
+		"timestamp":   time.Now().Unix(),
+	})
+	if err := h.Queue.PublishCancellation(c.Request.Context(), job.DocumentID, body); err != nil {
+		// the job is cancelled either way, a worker that misses this just does the work for nothing
+		log.Printf("Failed to publish cancellation for %s: %v\n", job.ID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Job cancelled", "job_id": job.ID, "status": models.JobStatusCancelled})
+}
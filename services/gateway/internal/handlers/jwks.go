@@ -0,0 +1,16 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+// --- GET /.well-known/jwks.json ---
+// Publishes the public keys access tokens can be verified with, so other services don't need
+// a shared secret. Only RS256 keys are listed, with HS256 the set is empty.
+func JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": middleware.PublicJWKs()})
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// room for the multipart boundaries and headers around the file itself
+	multipartOverhead = 1 << 20
+	// MultipartMemory is how much of a multipart form is kept in memory, the rest is spooled to a temp file
+	MultipartMemory = 8 << 20
+)
+
+// uploadRules are what every upload is checked against and where it ends up, built once from the config
+type uploadRules struct {
+	bucket  string
+	maxSize int64
+	// allowed is keyed by the names in fileTypes
+	allowed map[string]bool
+}
+
+func newUploadRules(cfg *config.Config) uploadRules {
+	rules := uploadRules{
+		bucket:  cfg.Storage.Bucket,
+		maxSize: int64(cfg.Documents.MaxUploadSize),
+		allowed: map[string]bool{},
+	}
+	for _, name := range cfg.Documents.AllowedTypes {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := fileTypes[name]; ok {
+			rules.allowed[name] = true
+		}
+	}
+	return rules
+}
+
+func (r uploadRules) tooLargeError() string {
+	return fmt.Sprintf("File is too large, the limit is %d bytes", r.maxSize)
+}
+
+// limitBody rejects a request whose declared length is already over limit, and caps
+// the body at limit for clients that don't declare one (or lie about it)
+func (r uploadRules) limitBody(c *gin.Context, limit int64) bool {
+	if c.Request.ContentLength > limit {
+		apierror.Write(c, http.StatusRequestEntityTooLarge, r.tooLargeError())
+		return false
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+	return true
+}
+
+// isTooLarge reports whether reading the body stopped at the MaxBytesReader limit
+func isTooLarge(err error) bool {
+	var maxErr *http.MaxBytesError
+	return errors.As(err, &maxErr)
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+)
+
+const (
+	maxLoginBackoff = time.Minute
+	// one IP can be behind a NAT with many honest users, so it gets more room than a single email
+	ipThresholdFactor = 5
+)
+
+// loginGuard slows down repeated failed logins and locks accounts that keep failing.
+// Failures are counted per email and per client IP, so neither spraying one
+// password across accounts nor hammering one account from many IPs gets far.
+// The passwords of share links are guarded the same way, counted per link.
+type loginGuard struct {
+	store storage.AuditStore
+	// backoffAfter is the number of failures allowed before every attempt has to wait, LOGIN_BACKOFF_AFTER
+	backoffAfter int
+	// lockoutThreshold is the number of failures that locks the key, LOGIN_LOCKOUT_THRESHOLD
+	lockoutThreshold int
+	// lockoutDuration is how long a lock lasts and how long failures are remembered, LOGIN_LOCKOUT_DURATION
+	lockoutDuration time.Duration
+}
+
+func newLoginGuard(store storage.AuditStore, cfg config.Login) *loginGuard {
+	return &loginGuard{
+		store:            store,
+		backoffAfter:     cfg.BackoffAfter,
+		lockoutThreshold: cfg.LockoutThreshold,
+		lockoutDuration:  cfg.LockoutDuration,
+	}
+}
+
+func emailKey(email string) string { return "email:" + strings.ToLower(strings.TrimSpace(email)) }
+func ipKey(ip string) string       { return "ip:" + ip }
+func linkKey(linkID string) string { return "share:" + linkID }
+
+// limits returns the backoff and lockout thresholds for a key
+func (g *loginGuard) limits(key string) (int, int) {
+	if strings.HasPrefix(key, "ip:") {
+		return g.backoffAfter * ipThresholdFactor, g.lockoutThreshold * ipThresholdFactor
+	}
+	return g.backoffAfter, g.lockoutThreshold
+}
+
+// load returns the throttle state for a key, starting over once the last failure is old enough
+func (g *loginGuard) load(ctx context.Context, key string, now time.Time) (models.LoginThrottle, error) {
+	t, err := g.store.GetLoginThrottle(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && now.Sub(t.LastFailedAt) > g.lockoutDuration && now.After(t.LockedUntil)) {
+		return models.LoginThrottle{Key: key}, nil
+	}
+	return t, err
+}
+
+// wait says how long the caller has to hold off before another attempt, zero when it may go ahead
+func (g *loginGuard) wait(ctx context.Context, email, ip string) (time.Duration, bool, error) {
+	return g.waitKeys(ctx, emailKey(email), ipKey(ip))
+}
+
+// waitLink is wait for the password of a share link
+func (g *loginGuard) waitLink(ctx context.Context, linkID string) (time.Duration, bool, error) {
+	return g.waitKeys(ctx, linkKey(linkID))
+}
+
+func (g *loginGuard) waitKeys(ctx context.Context, keys ...string) (time.Duration, bool, error) {
+	now := time.Now()
+	var longest time.Duration
+	locked := false
+	for _, key := range keys {
+		t, err := g.load(ctx, key, now)
+		if err != nil {
+			return 0, false, err
+		}
+
+		if now.Before(t.LockedUntil) {
+			locked = true
+			longest = max(longest, t.LockedUntil.Sub(now))
+			continue
+		}
+
+		backoffAfter, _ := g.limits(key)
+		if t.Failures >= backoffAfter {
+			next := t.LastFailedAt.Add(backoff(t.Failures - backoffAfter))
+			longest = max(longest, next.Sub(now))
+		}
+	}
+	return longest, locked, nil
+}
+
+// backoff doubles from one second with every failure past the free ones
+func backoff(n int) time.Duration {
+	if n >= 6 {
+		return maxLoginBackoff
+	}
+	return min(time.Second<<n, maxLoginBackoff)
+}
+
+// fail records a failed attempt against the email and the IP, locking whichever crossed its threshold
+func (g *loginGuard) fail(ctx context.Context, email, ip string, userID *int) {
+	g.failKeys(ctx, ip, userID, emailKey(email), ipKey(ip))
+}
+
+// failLink records a wrong password for a share link from ip, userID is the link's creator
+func (g *loginGuard) failLink(ctx context.Context, linkID, ip string, userID int) {
+	g.failKeys(ctx, ip, &userID, linkKey(linkID))
+}
+
+func (g *loginGuard) failKeys(ctx context.Context, ip string, userID *int, keys ...string) {
+	now := time.Now()
+	for _, key := range keys {
+		t, err := g.load(ctx, key, now)
+		if err != nil {
+			log.Printf("Failed to load login throttle for %s: %v\n", key, err)
+			continue
+		}
+
+		t.Failures++
+		t.LastFailedAt = now
+
+		_, threshold := g.limits(key)
+		if t.Failures >= threshold {
+			t.LockedUntil = now.Add(g.lockoutDuration)
+			// start counting from zero again once the lock runs out
+			t.Failures = 0
+
+			failures := "failed logins"
+			if strings.HasPrefix(key, "share:") {
+				failures = "wrong passwords"
+			}
+			entry := models.AuditEntry{
+				Event:  models.AuditLoginLockout,
+				IP:     ip,
+				Detail: fmt.Sprintf("%s locked for %s after %d %s", key, g.lockoutDuration, threshold, failures),
+			}
+			if !strings.HasPrefix(key, "ip:") {
+				entry.UserID = userID
+			}
+			if err := g.store.CreateAuditEntry(ctx, entry); err != nil {
+				log.Println("Failed to write audit entry:", err)
+			}
+			log.Printf("Login lockout: %s\n", entry.Detail)
+		}
+
+		if err := g.store.SaveLoginThrottle(ctx, t); err != nil {
+			log.Printf("Failed to save login throttle for %s: %v\n", key, err)
+		}
+	}
+}
+
+// succeed forgets the failures for an email, the IP keeps its count so one good account can't launder it
+func (g *loginGuard) succeed(ctx context.Context, email string) {
+	g.clear(ctx, emailKey(email))
+}
+
+// succeedLink forgets the failures for a share link once someone got its password right
+func (g *loginGuard) succeedLink(ctx context.Context, linkID string) {
+	g.clear(ctx, linkKey(linkID))
+}
+
+func (g *loginGuard) clear(ctx context.Context, key string) {
+	if err := g.store.ClearLoginThrottle(ctx, key); err != nil {
+		log.Println("Failed to clear login throttle:", err)
+	}
+}
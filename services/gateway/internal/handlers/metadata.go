@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// Limits on what can be attached to a document, it all gets copied onto every one of its vectors
+const (
+	maxTags                = 20
+	maxTagLength           = 64
+	maxMetadataKeys        = 32
+	maxMetadataKeyLength   = 64
+	maxMetadataValueLength = 1024
+)
+
+var (
+	tagPattern         = regexp.MustCompile(`^[a-z0-9][a-z0-9_.:/-]*$`)
+	metadataKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+	languagePattern    = regexp.MustCompile(`^[a-z]{2}$`)
+)
+
+// normalizeTags lowercases, dedupes and sorts tags so "Invoice" and "invoice" are the same tag
+func normalizeTags(tags []string) ([]string, error) {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > maxTagLength || !tagPattern.MatchString(tag) {
+			return nil, fmt.Errorf("tag %q must be up to %d letters, digits or _ . : / - characters", tag, maxTagLength)
+		}
+		seen[tag] = true
+		out = append(out, tag)
+	}
+	if len(out) > maxTags {
+		return nil, fmt.Errorf("a document can have at most %d tags", maxTags)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// normalizeLanguages lowercases and dedupes ISO 639-1 codes, the form the worker stores them in
+func normalizeLanguages(codes []string) ([]string, error) {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, code := range codes {
+		code = strings.ToLower(strings.TrimSpace(code))
+		if code == "" || seen[code] {
+			continue
+		}
+		if !languagePattern.MatchString(code) {
+			return nil, fmt.Errorf("language %q must be an ISO 639-1 code like en", code)
+		}
+		seen[code] = true
+		out = append(out, code)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// entityTypes are the types of entity the worker finds
+var entityTypes = []string{models.EntityPerson, models.EntityOrganization, models.EntityDate, models.EntityAmount}
+
+// normalizeEntities turns "type:value" filters into the keys the worker's entities are matched by
+func normalizeEntities(entities []string) ([]string, error) {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, entity := range entities {
+		entityType, value, _ := strings.Cut(strings.TrimSpace(entity), ":")
+		if !slices.Contains(entityTypes, entityType) || strings.TrimSpace(value) == "" {
+			return nil, fmt.Errorf("entity %q must be type:value, the type one of %s", entity, strings.Join(entityTypes, ", "))
+		}
+		key := models.EntityKey(entityType, value)
+		if !seen[key] {
+			seen[key] = true
+			out = append(out, key)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func validateMetadata(metadata map[string]string) error {
+	if len(metadata) > maxMetadataKeys {
+		return fmt.Errorf("metadata can have at most %d keys", maxMetadataKeys)
+	}
+	for k, v := range metadata {
+		if len(k) > maxMetadataKeyLength || !metadataKeyPattern.MatchString(k) {
+			return fmt.Errorf("metadata key %q must be up to %d letters, digits or _ . - characters", k, maxMetadataKeyLength)
+		}
+		if len(v) > maxMetadataValueLength {
+			return fmt.Errorf("metadata value for %q is longer than %d bytes", k, maxMetadataValueLength)
+		}
+	}
+	return nil
+}
+
+// formMetadata reads the optional tags and metadata fields of a multipart upload, writing the
+// error response when they're invalid. tags may be repeated or comma separated, metadata is a JSON object.
+func formMetadata(c *gin.Context) ([]string, map[string]string, bool) {
+	var raw []string
+	for _, field := range c.PostFormArray("tags") {
+		raw = append(raw, strings.Split(field, ",")...)
+	}
+	tags, err := normalizeTags(raw)
+	if err != nil {
+		apierror.Field(c, "tags", err.Error())
+		return nil, nil, false
+	}
+
+	var metadata map[string]string
+	if field := c.PostForm("metadata"); field != "" {
+		if err := json.Unmarshal([]byte(field), &metadata); err != nil {
+			apierror.Write(c, http.StatusBadRequest, "metadata must be a JSON object of strings")
+			return nil, nil, false
+		}
+	}
+	if err := validateMetadata(metadata); err != nil {
+		apierror.Field(c, "metadata", err.Error())
+		return nil, nil, false
+	}
+	return tags, metadata, true
+}
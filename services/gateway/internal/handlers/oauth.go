@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+	"github.com/dhruvkshah75/docstream/gateway/internal/metrics"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/endpoints"
+)
+
+const (
+	oauthStateCookie = "oauth_state"
+	oauthStateTTL    = 10 * 60 // seconds
+)
+
+// oauthProvider is one configured login provider
+type oauthProvider struct {
+	config *oauth2.Config
+	// email returns the user's verified email address using an authorized client
+	email func(ctx context.Context, client *http.Client) (string, error)
+}
+
+// OAuthHandler runs the authorization code flow for Google and GitHub and
+// logs the user in with the same tokens the password login hands out
+type OAuthHandler struct {
+	Store     storage.Store
+	providers map[string]oauthProvider
+}
+
+// Constructor for the OAuth login endpoints. A provider is only enabled when both its
+// client ID and secret are set, callbacks go to the redirect base URL + /auth/<provider>/callback.
+func NewOAuthHandler(store storage.Store, cfg config.OAuth) *OAuthHandler {
+	base := cfg.RedirectBaseURL
+
+	h := &OAuthHandler{Store: store, providers: map[string]oauthProvider{}}
+
+	if oc := oauthConfig(cfg.GoogleClientID, cfg.GoogleClientSecret, base+"/auth/google/callback", endpoints.Google, "openid", "email"); oc != nil {
+		h.providers["google"] = oauthProvider{config: oc, email: googleEmail}
+	}
+	if oc := oauthConfig(cfg.GitHubClientID, cfg.GitHubClientSecret, base+"/auth/github/callback", endpoints.GitHub, "user:email"); oc != nil {
+		h.providers["github"] = oauthProvider{config: oc, email: githubEmail}
+	}
+
+	for name := range h.providers {
+		log.Println("OAuth login enabled for", name)
+	}
+	return h
+}
+
+func oauthConfig(id, secret, redirectURL string, endpoint oauth2.Endpoint, scopes ...string) *oauth2.Config {
+	if id == "" || secret == "" {
+		return nil
+	}
+	return &oauth2.Config{
+		ClientID:     id,
+		ClientSecret: secret,
+		Endpoint:     endpoint,
+		RedirectURL:  redirectURL,
+		Scopes:       scopes,
+	}
+}
+
+// --- GET /auth/:provider ---
+// Sends the browser off to the provider's consent screen
+func (h *OAuthHandler) Start(c *gin.Context) {
+	provider, ok := h.providers[c.Param("provider")]
+	if !ok {
+		apierror.Write(c, http.StatusNotFound, "Unknown login provider")
+		return
+	}
+
+	// the state ties the callback to this browser, which stops login CSRF
+	state := newOpaqueToken()
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oauthStateCookie, state, oauthStateTTL, "/auth", "", c.Request.TLS != nil, true)
+
+	c.Redirect(http.StatusFound, provider.config.AuthCodeURL(state))
+}
+
+// --- GET /auth/:provider/callback ---
+func (h *OAuthHandler) Callback(c *gin.Context) {
+	provider, ok := h.providers[c.Param("provider")]
+	if !ok {
+		apierror.Write(c, http.StatusNotFound, "Unknown login provider")
+		return
+	}
+
+	if reason := c.Query("error"); reason != "" {
+		metrics.Auth("oauth", false)
+		apierror.Write(c, http.StatusUnauthorized, "Login was not approved: "+reason)
+		return
+	}
+
+	state, err := c.Cookie(oauthStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(state), []byte(c.Query("state"))) != 1 {
+		metrics.Auth("oauth", false)
+		apierror.Write(c, http.StatusBadRequest, "Invalid login state, please try again")
+		return
+	}
+	// one use only
+	c.SetCookie(oauthStateCookie, "", -1, "/auth", "", c.Request.TLS != nil, true)
+
+	ctx := c.Request.Context()
+	token, err := provider.config.Exchange(ctx, c.Query("code"))
+	if err != nil {
+		log.Println("OAuth Code Exchange Error:", err)
+		metrics.Auth("oauth", false)
+		apierror.Write(c, http.StatusUnauthorized, "Failed to complete login")
+		return
+	}
+
+	email, err := provider.email(ctx, provider.config.Client(ctx, token))
+	if err != nil {
+		log.Println("OAuth Email Lookup Error:", err)
+		metrics.Auth("oauth", false)
+		apierror.Write(c, http.StatusUnauthorized, "Could not get a verified email address from the provider")
+		return
+	}
+
+	user, err := h.findOrCreateUser(ctx, email)
+	if err != nil {
+		log.Println("OAuth User Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if user.SuspendedAt != nil {
+		metrics.Auth("oauth", false)
+		apierror.Write(c, http.StatusForbidden, "Account suspended")
+		return
+	}
+
+	pair, err := issueTokens(ctx, h.Store, user.ID, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+
+	metrics.Auth("oauth", true)
+	c.JSON(http.StatusOK, pair)
+}
+
+// findOrCreateUser links the login to the local account with the same email, or creates one.
+// Accounts created here have no password, so they can only log in through a provider.
+func (h *OAuthHandler) findOrCreateUser(ctx context.Context, email string) (models.User, error) {
+	user, err := h.Store.GetUserByEmail(ctx, email)
+	if !errors.Is(err, storage.ErrNotFound) {
+		return user, err
+	}
+
+	_, err = h.Store.CreateUser(ctx, email, "")
+	if err != nil && !errors.Is(err, storage.ErrDuplicate) {
+		return user, err
+	}
+	// on ErrDuplicate a parallel login just created it
+	return h.Store.GetUserByEmail(ctx, email)
+}
+
+// googleEmail reads the OpenID Connect userinfo, only verified addresses count
+func googleEmail(ctx context.Context, client *http.Client) (string, error) {
+	var info struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+	}
+	if err := getJSON(ctx, client, "https://openidconnect.googleapis.com/v1/userinfo", &info); err != nil {
+		return "", err
+	}
+	if info.Email == "" || !info.EmailVerified {
+		return "", errors.New("google account has no verified email")
+	}
+	return info.Email, nil
+}
+
+// githubEmail picks the primary verified address, the profile email can be hidden or unverified
+func githubEmail(ctx context.Context, client *http.Client) (string, error) {
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := getJSON(ctx, client, "https://api.github.com/user/emails", &emails); err != nil {
+		return "", err
+	}
+	for _, e := range emails {
+		if e.Primary && e.Verified {
+			return e.Email, nil
+		}
+	}
+	return "", errors.New("github account has no primary verified email")
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
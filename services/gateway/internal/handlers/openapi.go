@@ -0,0 +1,495 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/backpressure"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/openapi"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// the usual ways a route fails, on top of what openapi adds for its auth and the rate limit
+var (
+	notFound    = []int{http.StatusNotFound}
+	unavailable = http.StatusServiceUnavailable
+)
+
+// targetForm are the fields every multipart upload takes besides its file(s)
+var targetForm = []openapi.Param{
+	{Name: "org_id", Description: "Share the document with this organization's members"},
+	{Name: "collection_id", Description: "File it in this collection, its processing defaults apply"},
+	{Name: "tags", Description: "Repeated or comma separated", Array: true},
+	{Name: "metadata", Description: "A JSON object of strings"},
+}
+
+var uploaded = gin.H{"message": "", "job_id": "", "document_id": "", "file_id": "", "duplicate": false}
+
+var mine = []openapi.Param{{Name: "org_id", Description: "An organization's instead of the caller's own"}}
+
+// activityPage pages through an activity feed
+var activityPage = []openapi.Param{
+	{Name: "limit", Type: "integer", Description: "1 to 200, 50 by default"},
+	{Name: "before", Type: "integer", Description: "next_before from the previous page"},
+}
+
+// APIDocs describes the routes for the OpenAPI spec at /openapi.json, keyed like gin's routes.
+// The success bodies are sample values of what the handlers answer with.
+var APIDocs = map[string]openapi.Operation{
+	// --- health ---
+	"GET /healthz": {Tag: "health", Summary: "Liveness probe", Auth: openapi.Public, Unlimited: true, Response: gin.H{"status": "ok"}},
+	"GET /readyz": {Tag: "health", Summary: "Readiness probe",
+		Description: "Checks the database, object storage and the queue, 503 while any of them is down. backlog is only there with `UPLOAD_MAX_BACKLOG` set, a full one refuses uploads without failing the probe.",
+		Auth:        openapi.Public, Unlimited: true, Errors: []int{unavailable},
+		Response: gin.H{"status": "ok", "checks": map[string]struct {
+			Status    string `json:"status"`
+			LatencyMS int64  `json:"latency_ms"`
+			Error     string `json:"error,omitempty"`
+		}{}, "backlog": backpressure.Status{}}},
+
+	// --- auth ---
+	"POST /signup":  {Tag: "auth", Summary: "Create an account", Description: "The password needs at least 8 characters (PASSWORD_MIN_LENGTH) and at most 72 bytes, plus whatever character classes are configured. With PASSWORD_CHECK_BREACHED passwords seen in known data breaches are refused too. A refused password is a validation_failed saying what to change.", Auth: openapi.Public, Body: SignupInput{}, Status: http.StatusCreated, Response: gin.H{"message": ""}},
+	"POST /login":   {Tag: "auth", Summary: "Sign in with email and password", Description: "Repeated failures lock the email and IP out for a while, with a Retry-After.", Auth: openapi.Public, Body: AuthInput{}, Response: tokenPair{}},
+	"POST /refresh": {Tag: "auth", Summary: "Swap a refresh token for a new pair", Description: "Every refresh token works once, using one twice revokes its whole family.", Auth: openapi.Public, Body: RefreshInput{}, Response: tokenPair{}},
+	"POST /logout":  {Tag: "auth", Summary: "End the bearer token's session", Description: "Its access and refresh tokens stop working. Tokens from before sessions only revoke themselves and the refresh token in the body, when there is one.", Auth: openapi.Bearer, Body: LogoutInput{}, BodyOptional: true, Response: gin.H{"message": ""}},
+	"GET /.well-known/jwks.json": {Tag: "auth", Summary: "Public keys that verify access tokens", Description: "Empty unless tokens are signed with RS256.", Auth: openapi.Public,
+		Response: gin.H{"keys": []middleware.JWK{}}},
+	"GET /auth/:provider": {Tag: "auth", Summary: "Start an OAuth login", Auth: openapi.Public, Status: http.StatusFound, Errors: notFound,
+		Path: []openapi.Param{{Name: "provider", Enum: []string{"google", "github"}}}},
+	"GET /auth/:provider/callback": {Tag: "auth", Summary: "Finish an OAuth login", Auth: openapi.Public, Response: tokenPair{},
+		Path:   []openapi.Param{{Name: "provider", Enum: []string{"google", "github"}}},
+		Query:  []openapi.Param{{Name: "state", Required: true}, {Name: "code", Required: true}, {Name: "error", Description: "Set by the provider when the login wasn't approved"}},
+		Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound}},
+
+	// --- account ---
+	"GET /me": {Tag: "account", Summary: "Get your profile", Description: "avatar_url is only there once a picture was uploaded.", Auth: openapi.Bearer, Response: models.User{}},
+	"PATCH /me": {Tag: "account", Summary: "Change your profile", Description: "Fields left out stay as they are. preferences replaces all of them, its options are the pipeline defaults for your uploads, below a collection's, " +
+		"and its notifications say whether you are emailed as your uploads complete or fail: instant, in the daily digest or none, the default.",
+		Auth: openapi.Bearer, Body: ProfilePatch{}, Response: models.User{}},
+	"DELETE /me": {Tag: "account", Summary: "Delete your account", Description: "Confirm with your password, or your email when you sign in through Google or GitHub. " +
+		"You are logged out everywhere and your documents are purged in the background, along with their vectors. Documents under legal hold " +
+		"and those in organizations that still have members stay. The last owner of such an organization has to hand it on first.",
+		Auth: openapi.Bearer, Body: DeleteAccountInput{}, Status: http.StatusAccepted, Response: gin.H{"message": "", "deletion": models.AccountDeletion{}},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict}},
+	"POST /me/export": {Tag: "account", Summary: "Export your data", Description: "Starts building a zip of your profile, what you set up, your documents' list, their files and extracted text. " +
+		"Follow it at GET /me/exports/:id, an export.finished event goes out on /events when it's done, and an email with the link when the gateway sends mail.",
+		Auth: openapi.Bearer, Status: http.StatusAccepted, Response: models.Export{}, Errors: []int{http.StatusConflict, unavailable}},
+	"GET /me/exports": {Tag: "account", Summary: "List data exports", Auth: openapi.Bearer, Response: gin.H{"exports": []models.Export{}}},
+	"GET /me/usage": {Tag: "account", Summary: "Your usage", Description: "What you consumed each day (UTC) from from to to, both included and the current month by default, with the totals of those days. " +
+		"A day comes once per organization the usage was in. storage_bytes is the most your documents' versions took up that day and isn't totalled. " +
+		"Pages and embedding tokens count when a job completes, LLM tokens for summaries, answers and chat messages. Today's numbers grow until the day is over, " +
+		"closed days go to billing as usage.reported events. With org_id it is every member's usage in that organization, for its owners.",
+		Auth: openapi.Bearer, Query: []openapi.Param{{Name: "from", Description: "YYYY-MM-DD"}, {Name: "to", Description: "YYYY-MM-DD, at most 365 days after from"}, {Name: "org_id", Description: "An organization you own"}},
+		Response: gin.H{"from": "", "to": "", "org_id": "", "days": []models.UsageDay{{Usage: models.Usage{models.MetricPages: 0}}}, "total": models.Usage{models.MetricPages: 0}},
+		Errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound}},
+	"GET /me/exports/:id": {Tag: "account", Summary: "A data export", Description: "Once completed it has a download_url, valid until expires_at when the zip is removed.",
+		Auth: openapi.Bearer, Response: models.Export{}, Errors: []int{http.StatusNotFound, unavailable}},
+	"PUT /me/avatar": {Tag: "account", Summary: "Upload your picture", Description: "A PNG, JPEG, GIF or WebP image of at most 2 MiB, replacing the last one.",
+		Auth: openapi.Bearer, Form: []openapi.Param{{Name: "avatar", Type: "file", Required: true}}, Response: models.User{},
+		Errors: []int{http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, unavailable}},
+	"GET /me/avatar":    {Tag: "account", Summary: "Your picture", Auth: openapi.Bearer, Produces: []string{"image/png", "image/jpeg", "image/gif", "image/webp"}, Errors: []int{http.StatusNotFound, unavailable}},
+	"DELETE /me/avatar": {Tag: "account", Summary: "Remove your picture", Auth: openapi.Bearer, Errors: notFound, Response: gin.H{"message": ""}},
+	"POST /me/change-password": {Tag: "account", Summary: "Change your password", Description: "The new password has to pass the same policy as at signup. Your other sessions are logged out.",
+		Auth: openapi.Bearer, Body: ChangePasswordInput{}, Response: gin.H{"message": "", "sessions_ended": 0}},
+	"GET /me/sessions": {Tag: "account", Summary: "List sessions", Description: "Every login that can still be refreshed, with the user agent and IP it came from. current marks the caller's.",
+		Auth: openapi.Bearer, Response: gin.H{"sessions": []models.Session{}}},
+	"DELETE /me/sessions/:id": {Tag: "account", Summary: "Log a session out", Description: "Its access and refresh tokens stop working right away.", Auth: openapi.Bearer, Errors: notFound, Response: gin.H{"message": ""}},
+	"DELETE /me/sessions":     {Tag: "account", Summary: "Log out everywhere", Description: "Ends every session, the caller's included.", Auth: openapi.Bearer, Response: gin.H{"message": "", "sessions": 0}},
+
+	// --- API keys ---
+	"POST /apikeys": {Tag: "apikeys", Summary: "Create an API key", Description: "The key itself is only in this response.",
+		Auth: openapi.Bearer, Body: APIKeyInput{}, Status: http.StatusCreated, Response: models.APIKey{}},
+	"GET /apikeys":        {Tag: "apikeys", Summary: "List API keys", Auth: openapi.Bearer, Response: gin.H{"api_keys": []models.APIKey{}}},
+	"DELETE /apikeys/:id": {Tag: "apikeys", Summary: "Revoke an API key", Auth: openapi.Bearer, Errors: notFound, Response: gin.H{"message": ""}},
+
+	// --- uploads ---
+	"POST /upload": {Tag: "uploads", Summary: "Upload a document",
+		Description: "Content that was uploaded before reuses its document, with duplicate set. With expand a zip, tar or tar.gz archive is unpacked instead: its files become documents " +
+			"in a new collection named after it, inside collection_id if given, and the answer is that collection and the batch of its files (see GET /batches/:id). " +
+			"Archives with paths leading out of them, more than MAX_BATCH_FILES files or unpacking to more than MAX_BATCH_SIZE or MAX_ARCHIVE_RATIO times their size are refused.",
+		Auth: openapi.Keyed(models.ScopeUpload), Form: append([]openapi.Param{{Name: "file", Type: "file", Required: true}, {Name: "expand", Type: "boolean", Description: "Unpack an archive into a collection of its files"}}, targetForm...),
+		Response: uploaded, Errors: []int{http.StatusBadRequest, http.StatusPaymentRequired, http.StatusForbidden, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity, unavailable}},
+	"POST /upload/init": {Tag: "uploads", Summary: "Start a resumable upload", Auth: openapi.Keyed(models.ScopeUpload), Body: InitUploadInput{}, Status: http.StatusCreated,
+		Response: gin.H{"upload_id": "", "min_part_size": int64(0), "max_part_size": int64(0)}, Errors: []int{http.StatusPaymentRequired, http.StatusRequestEntityTooLarge, unavailable}},
+	"PATCH /upload/:id": {Tag: "uploads", Summary: "Upload one part", Description: "Parts may come in any order and be sent again, the last one wins.",
+		Auth: openapi.Keyed(models.ScopeUpload), Consumes: "application/octet-stream", Response: models.UploadPart{},
+		Query:  []openapi.Param{{Name: "part", Type: "integer", Required: true}},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusLengthRequired, http.StatusRequestEntityTooLarge, unavailable}},
+	"GET /upload/:id": {Tag: "uploads", Summary: "Get a resumable upload's progress", Auth: openapi.Keyed(models.ScopeUpload), Errors: notFound,
+		Response: gin.H{"upload_id": "", "status": "", "parts": []models.UploadPart{}, "bytes_received": int64(0)}},
+	"POST /upload/:id/complete": {Tag: "uploads", Summary: "Assemble the parts and start processing", Auth: openapi.Keyed(models.ScopeUpload), Response: uploaded,
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity, unavailable}},
+	"DELETE /upload/:id": {Tag: "uploads", Summary: "Abort a resumable upload", Auth: openapi.Keyed(models.ScopeUpload), Errors: []int{http.StatusNotFound, http.StatusConflict, unavailable}, Response: gin.H{"message": ""}},
+	"POST /uploads/presign": {Tag: "uploads", Summary: "Start a direct upload to storage",
+		Description: "Checks the upload against the limits and returns a presigned URL to send the file to with method and headers, so it never goes through the gateway. " +
+			"Then call complete_url. Not available with local storage or encryption at rest, use /upload/init there.",
+		Auth: openapi.Keyed(models.ScopeUpload), Body: PresignUploadInput{}, Status: http.StatusCreated,
+		Response: gin.H{"upload_id": "", "method": "", "url": "", "headers": map[string]string{}, "expires_at": "", "complete_url": ""},
+		Errors:   []int{http.StatusBadRequest, http.StatusPaymentRequired, http.StatusForbidden, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, unavailable}},
+	"POST /uploads/:id/complete": {Tag: "uploads", Summary: "Finish a direct upload and start processing",
+		Description: "The stored file has to have the size the upload was started with and a type matching its extension, otherwise it is deleted. " +
+			"409 while storage doesn't have it yet, 410 an hour after the URL expired.",
+		Auth: openapi.Keyed(models.ScopeUpload), Response: uploaded,
+		Errors: []int{http.StatusBadRequest, http.StatusPaymentRequired, http.StatusNotFound, http.StatusConflict, http.StatusGone, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity, unavailable}},
+	"POST /storage/events": {Tag: "uploads", Summary: "Bucket notifications",
+		Description: "Where MinIO sends the bucket's object created events, with BUCKET_EVENTS_WEBHOOK_TOKEN as a bearer token. A file under BUCKET_EVENTS_PREFIX/<email>/ becomes a document of " +
+			"the user with that email and is deleted from there, files that are refused stay. A 500 asks MinIO to send the event again.",
+		Auth: openapi.Public, Response: gin.H{"received": true}, Errors: []int{http.StatusUnauthorized, http.StatusNotFound, unavailable}},
+	"POST /upload/batch": {Tag: "uploads", Summary: "Upload many files at once", Description: "Zip archives are unpacked, every file gets its own document and job.",
+		Auth: openapi.Keyed(models.ScopeUpload), Form: append([]openapi.Param{{Name: "file", Type: "file", Required: true, Array: true}}, targetForm...),
+		Response: models.Batch{}, Errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusRequestEntityTooLarge, unavailable}},
+	"GET /batches/:id": {Tag: "uploads", Summary: "Get a batch and its items", Auth: openapi.Keyed(models.ScopeJobsRead), Errors: notFound, Response: models.Batch{}},
+	"POST /ingest/url": {Tag: "uploads", Summary: "Ingest a document from a URL", Description: "The gateway downloads it, URLs on private networks are refused unless the server allows them.",
+		Auth: openapi.Keyed(models.ScopeUpload), Body: IngestURLInput{},
+		Response: gin.H{"message": "", "job_id": "", "document_id": "", "file_id": "", "filename": "", "duplicate": false},
+		Errors:   []int{http.StatusPaymentRequired, http.StatusForbidden, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity, http.StatusBadGateway, unavailable}},
+
+	// --- jobs ---
+	"GET /jobs": {Tag: "jobs", Summary: "List jobs, newest first", Auth: openapi.Keyed(models.ScopeJobsRead), Errors: []int{http.StatusBadRequest},
+		Query: []openapi.Param{
+			{Name: "status", Enum: []string{models.JobStatusPending, models.JobStatusQueued, models.JobStatusProcessing, models.JobStatusCompleted, models.JobStatusFailed, models.JobStatusCancelled}},
+			{Name: "limit", Type: "integer", Description: "1 to 100, 20 by default"},
+			{Name: "offset", Type: "integer"},
+		},
+		Response: gin.H{"jobs": []models.Job{}, "limit": 0, "offset": 0}},
+	"GET /jobs/:id": {Tag: "jobs", Summary: "Get a job", Auth: openapi.Keyed(models.ScopeJobsRead), Errors: notFound, Response: models.Job{}},
+	"POST /jobs/:id/cancel": {Tag: "jobs", Summary: "Cancel a job", Auth: openapi.Keyed(models.ScopeJobsWrite), Errors: []int{http.StatusNotFound, http.StatusConflict},
+		Response: gin.H{"message": "", "job_id": "", "status": models.JobStatusCancelled}},
+	"GET /events": {Tag: "jobs", Summary: "Stream the caller's events",
+		Description: "Server-sent events for every job of the caller until they disconnect: job.status and job.stage as the worker reports them, " +
+			"document.processed once a document can be searched and quota.warning when a rate limit turns a request down, at most once a minute per limit. " +
+			"Each data line is a JSON event like the WebSocket sends. Nothing is replayed on reconnect, fetch /jobs again for what was missed.",
+		Auth: openapi.Keyed(models.ScopeJobsRead), Produces: []string{"text/event-stream"}},
+	"GET /ws/jobs/:id": {Tag: "jobs", Summary: "Follow a job's progress over a WebSocket", Description: "Sends the current status first, then every event until the job finishes.",
+		Auth: openapi.Bearer, Status: http.StatusSwitchingProtocols, Errors: notFound},
+
+	// --- documents ---
+	"GET /documents": {Tag: "documents", Summary: "List documents, a page at a time", Auth: openapi.Keyed(models.ScopeDocumentsRead), Errors: []int{http.StatusBadRequest, http.StatusForbidden},
+		Query: []openapi.Param{
+			mine[0],
+			{Name: "collection_id", Description: "Only what is directly in this collection"},
+			{Name: "status"},
+			{Name: "type", Enum: []string{"pdf", "docx", "pptx", "xlsx", "html", "txt", "md"}},
+			{Name: "tag", Description: "Only documents with all of the tags", Array: true},
+			{Name: "language", Description: "ISO 639-1 code"},
+			{Name: "class", Description: "The class the worker labelled documents with, like invoice"},
+			{Name: "entity", Description: "type:value, like organization:acme inc., only documents mentioning all of them", Array: true},
+			{Name: "uploaded_after", Description: "RFC 3339 time or YYYY-MM-DD"},
+			{Name: "uploaded_before", Description: "RFC 3339 time or YYYY-MM-DD"},
+			{Name: "sort", Enum: []string{"created_at", "filename", "size"}},
+			{Name: "order", Enum: []string{"asc", "desc"}},
+			{Name: "limit", Type: "integer"},
+			{Name: "cursor", Description: "next_cursor from the previous page"},
+			{Name: "deleted", Type: "boolean", Description: "List the trash instead"},
+			{Name: "shared", Type: "boolean", Description: "List what other users shared with the caller instead"},
+		},
+		Response: gin.H{"documents": []models.Document{}, "next_cursor": (*string)(nil)}},
+	"GET /documents/:id": {Tag: "documents", Summary: "Get a document with its summary and the entities found in it", Auth: openapi.Keyed(models.ScopeDocumentsRead), Errors: notFound,
+		Response: models.Document{}},
+	"GET /documents/:id/download": {Tag: "documents", Summary: "Get a short-lived download link", Auth: openapi.Keyed(models.ScopeDocumentsRead), Errors: []int{http.StatusNotFound, unavailable},
+		Response: gin.H{"url": "", "expires_at": time.Time{}}},
+	"GET /documents/:id/content": {Tag: "documents", Summary: "Stream a document", Description: "Supports Range requests. The token of a download link takes the place of the usual credentials.",
+		Auth:     openapi.Keyed(models.ScopeDocumentsRead),
+		Query:    []openapi.Param{{Name: "token", Description: "From a download link"}, {Name: "disposition", Enum: []string{"attachment", "inline"}}},
+		Produces: []string{"application/octet-stream"}, Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusRequestedRangeNotSatisfiable, unavailable}},
+	"GET /documents/:id/thumbnail": {Tag: "documents", Summary: "Get the first page as a PNG", Description: "404 until the worker has rendered it.", Auth: openapi.Keyed(models.ScopeDocumentsRead),
+		Query:    []openapi.Param{{Name: "size", Enum: []string{"thumbnail", "preview"}}},
+		Produces: []string{"image/png"}, Errors: []int{http.StatusBadRequest, http.StatusNotFound, unavailable}},
+	"GET /documents/:id/export": {Tag: "documents", Summary: "Download the processed document",
+		Description: "The text extracted from the document as an attachment, put back together from its indexed chunks. txt is the text alone, md adds the metadata, summary and a table " +
+			"of the chunks with their byte offsets into the text, json is {document, text, chunks} with each chunk's text. 409 while the document is still being processed.",
+		Auth:     openapi.Keyed(models.ScopeDocumentsRead),
+		Query:    []openapi.Param{{Name: "format", Enum: []string{"txt", "md", "json"}}},
+		Produces: []string{"text/plain", "text/markdown", "application/json"}, Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusBadGateway, unavailable}},
+	"PATCH /documents/:id": {Tag: "documents", Summary: "Change tags, metadata or collection", Description: "tags replaces the list, metadata is merged in and a key set to null is removed.",
+		Auth: openapi.Keyed(models.ScopeUpload), Body: DocumentPatch{}, Errors: []int{http.StatusForbidden, http.StatusNotFound}, Response: models.Document{}},
+	"DELETE /documents/:id": {Tag: "documents", Summary: "Move a document to the trash", Auth: openapi.Keyed(models.ScopeDocumentsDelete), Errors: []int{http.StatusNotFound, http.StatusConflict},
+		Response: gin.H{"message": "", "deleted_at": time.Time{}, "purge_at": time.Time{}}},
+	"POST /documents/:id/restore": {Tag: "documents", Summary: "Take a document out of the trash", Auth: openapi.Keyed(models.ScopeDocumentsDelete), Errors: []int{http.StatusNotFound, http.StatusConflict},
+		Response: gin.H{"message": "", "document": models.Document{}}},
+	"POST /documents/:id/reprocess": {Tag: "documents", Summary: "Process a document again", Description: "Options left out come from its collection or the defaults.",
+		Auth: openapi.Keyed(models.ScopeUpload), Body: ReprocessInput{}, BodyOptional: true, Status: http.StatusAccepted, Errors: []int{http.StatusPaymentRequired, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, unavailable},
+		Response: gin.H{"message": "", "job_id": "", "document_id": "", "options": models.JobOptions{}}},
+	"PUT /documents/:id/legal-hold": {Tag: "documents", Summary: "Put a legal hold on a document or lift it", Description: "Held documents are never purged or expired. Needs a signed in owner.",
+		Auth: openapi.Bearer, Body: LegalHoldInput{}, Errors: []int{http.StatusForbidden, http.StatusNotFound}, Response: gin.H{"document_id": "", "legal_hold": false}},
+
+	// --- versions ---
+	"POST /documents/:id/versions": {Tag: "versions", Summary: "Upload a new version", Description: "Content identical to the current version doesn't make a new one.",
+		Auth: openapi.Keyed(models.ScopeUpload), Form: []openapi.Param{{Name: "file", Type: "file", Required: true}},
+		Response: gin.H{"message": "", "job_id": "", "document_id": "", "version": 0, "duplicate": false},
+		Errors:   []int{http.StatusBadRequest, http.StatusPaymentRequired, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, unavailable}},
+	"GET /documents/:id/versions": {Tag: "versions", Summary: "List a document's versions", Auth: openapi.Keyed(models.ScopeDocumentsRead), Errors: notFound,
+		Response: gin.H{"document_id": "", "version": 0, "versions": []models.DocumentVersion{}}},
+	"POST /documents/:id/versions/:version/restore": {Tag: "versions", Summary: "Make an earlier version current", Auth: openapi.Keyed(models.ScopeUpload), Status: http.StatusAccepted,
+		Path:     []openapi.Param{{Name: "version", Type: "integer"}},
+		Response: gin.H{"message": "", "job_id": "", "document_id": "", "version": 0},
+		Errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, unavailable}},
+
+	// --- annotations ---
+	"POST /documents/:id/annotations": {Tag: "annotations", Summary: "Highlight or comment on a range of the text",
+		Description: "start and end are byte offsets into the extracted text, like a chunk's. Once the document is indexed the quote and page are taken from its text. " +
+			"The uploader, members who aren't viewers and users it was shared with to comment on may annotate. Keyword and hybrid searches match the body and quote.",
+		Auth: openapi.Keyed(models.ScopeUpload), Body: AnnotationInput{}, Status: http.StatusCreated,
+		Errors: []int{http.StatusForbidden, http.StatusNotFound, http.StatusBadGateway}, Response: models.Annotation{}},
+	"GET /documents/:id/annotations": {Tag: "annotations", Summary: "List a document's annotations in the order of the text", Auth: openapi.Keyed(models.ScopeDocumentsRead),
+		Query:  []openapi.Param{{Name: "kind", Enum: []string{models.AnnotationHighlight, models.AnnotationComment}}},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound}, Response: gin.H{"document_id": "", "annotations": []models.Annotation{}}},
+	"GET /documents/:id/activity": {Tag: "activity", Summary: "List what happened to a document, newest first",
+		Description: "Uploads, processing, shares, comments and reprocessing. Only the uploader and the organization's members can read it, not those it was shared with.",
+		Auth:        openapi.Keyed(models.ScopeDocumentsRead), Query: activityPage,
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound}, Response: gin.H{"activity": []models.Activity{}, "next_before": (*int)(nil)}},
+	"GET /orgs/:id/activity": {Tag: "activity", Summary: "List what happened to an organization's documents, newest first",
+		Description: "The activity of every document of the organization and the shares of its collections, for any member.",
+		Auth:        openapi.Keyed(models.ScopeDocumentsRead), Query: activityPage,
+		Errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound}, Response: gin.H{"activity": []models.Activity{}, "next_before": (*int)(nil)}},
+	"PATCH /annotations/:id": {Tag: "annotations", Summary: "Change an annotation's body", Description: "Only its author can.",
+		Auth: openapi.Keyed(models.ScopeUpload), Body: AnnotationPatch{}, Errors: []int{http.StatusForbidden, http.StatusNotFound}, Response: models.Annotation{}},
+	"DELETE /annotations/:id": {Tag: "annotations", Summary: "Delete an annotation", Description: "Its author can, and so can whoever may change the document.",
+		Auth: openapi.Keyed(models.ScopeUpload), Errors: []int{http.StatusForbidden, http.StatusNotFound}, Response: gin.H{"message": ""}},
+
+	// --- collections ---
+	"POST /collections": {Tag: "collections", Summary: "Create a collection", Auth: openapi.Keyed(models.ScopeUpload), Body: CollectionInput{}, Status: http.StatusCreated,
+		Errors: []int{http.StatusForbidden, http.StatusNotFound, http.StatusConflict}, Response: models.Collection{}},
+	"GET /collections": {Tag: "collections", Summary: "List collections", Auth: openapi.Keyed(models.ScopeDocumentsRead), Query: mine, Errors: []int{http.StatusForbidden},
+		Response: gin.H{"collections": []models.Collection{}}},
+	"GET /collections/:id": {Tag: "collections", Summary: "Get a collection", Auth: openapi.Keyed(models.ScopeDocumentsRead), Errors: notFound, Response: models.Collection{}},
+	"PATCH /collections/:id": {Tag: "collections", Summary: "Rename, move or change a collection's defaults", Auth: openapi.Keyed(models.ScopeUpload), Body: CollectionPatch{},
+		Errors: []int{http.StatusForbidden, http.StatusNotFound, http.StatusConflict}, Response: models.Collection{}},
+	"DELETE /collections/:id": {Tag: "collections", Summary: "Delete an empty collection", Auth: openapi.Keyed(models.ScopeDocumentsDelete),
+		Errors: []int{http.StatusForbidden, http.StatusNotFound, http.StatusConflict}, Response: gin.H{"message": ""}},
+
+	// --- sharing ---
+	"POST /shares": {Tag: "sharing", Summary: "Share a document or collection with a user", Description: "Give one of document_id and collection_id. They can then read, download, search and chat with it, " +
+		"a collection with everything in it and under it. Sharing again changes the permission. Who may change it may share it.",
+		Auth: openapi.Keyed(models.ScopeUpload), Body: ShareInput{}, Status: http.StatusCreated, Errors: []int{http.StatusForbidden, http.StatusNotFound}, Response: models.Share{}},
+	"GET /shares": {Tag: "sharing", Summary: "List shares", Description: "What others shared with the caller, or who a document or collection is shared with.",
+		Auth:  openapi.Keyed(models.ScopeDocumentsRead),
+		Query: []openapi.Param{{Name: "document_id"}, {Name: "collection_id"}}, Errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound},
+		Response: gin.H{"shares": []models.Share{}}},
+	"DELETE /shares/:id": {Tag: "sharing", Summary: "Take back or give up a share", Auth: openapi.Keyed(models.ScopeUpload), Errors: []int{http.StatusForbidden, http.StatusNotFound},
+		Response: gin.H{"message": ""}},
+	"POST /share-links": {Tag: "sharing", Summary: "Make a public link to a document or collection", Description: "The link works without an account until it expires, a week by default. " +
+		"The token is only returned here. With a password the link needs it in X-Share-Password. It stops working once its creator can't read what it points at.",
+		Auth: openapi.Keyed(models.ScopeUpload), Body: ShareLinkInput{}, Status: http.StatusCreated, Errors: []int{http.StatusForbidden, http.StatusNotFound}, Response: models.ShareLink{}},
+	"GET /share-links": {Tag: "sharing", Summary: "List the links to a document or collection", Auth: openapi.Keyed(models.ScopeDocumentsRead),
+		Query: []openapi.Param{{Name: "document_id"}, {Name: "collection_id"}}, Errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound},
+		Response: gin.H{"share_links": []models.ShareLink{}}},
+	"DELETE /share-links/:id": {Tag: "sharing", Summary: "Revoke a share link", Auth: openapi.Keyed(models.ScopeUpload), Errors: []int{http.StatusForbidden, http.StatusNotFound},
+		Response: gin.H{"message": ""}},
+	"GET /shared/:token": {Tag: "sharing", Summary: "Open a share link", Description: "The document, or the collection with the documents in it. Send the link's password in X-Share-Password, repeated wrong ones lock the link for a while with a Retry-After.",
+		Auth: openapi.Public, Errors: []int{http.StatusUnauthorized, http.StatusNotFound, http.StatusGone, http.StatusTooManyRequests},
+		Response: gin.H{"expires_at": time.Time{}, "document": SharedDocument{}, "collection": gin.H{"id": "", "name": ""}, "documents": []SharedDocument{}}},
+	"GET /shared/:token/download": {Tag: "sharing", Summary: "Get a download link through a share link", Description: "A link to a collection needs the document_id of one of its documents.",
+		Auth:  openapi.Public,
+		Query: []openapi.Param{{Name: "document_id"}}, Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusGone, http.StatusTooManyRequests, unavailable},
+		Response: gin.H{"url": "", "expires_at": time.Time{}}},
+
+	// --- search ---
+	"GET /search": {Tag: "search", Summary: "Semantic, keyword or hybrid search", Auth: openapi.Keyed(models.ScopeDocumentsRead), Errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusBadGateway, unavailable},
+		Description: "mode=keyword ranks chunks and annotations by BM25 over their words, a hit on an annotation has its annotation_id instead of a chunk_id. mode=hybrid merges that ranking with the vector one by reciprocal rank fusion. " +
+			"rerank=true has a cross-encoder put the best candidates in order again, the scores are its relevance then. " +
+			"Snippets are cut around the words of the query, highlights are where they are in the snippet in characters.",
+		Query: []openapi.Param{
+			{Name: "q", Required: true},
+			{Name: "mode", Enum: []string{SearchModeVector, SearchModeKeyword, SearchModeHybrid}},
+			{Name: "rerank", Type: "boolean", Description: "Left out, RERANK_BY_DEFAULT decides"},
+			mine[0],
+			{Name: "limit", Type: "integer"},
+			{Name: "document_id", Array: true},
+			{Name: "tag", Array: true},
+			{Name: "language", Array: true},
+			{Name: "entity", Description: "type:value, only documents mentioning all of them", Array: true},
+		},
+		Response: gin.H{"query": "", "results": []SearchResult{}}},
+	"POST /search": {Tag: "search", Summary: "Semantic, keyword or hybrid search", Auth: openapi.Keyed(models.ScopeDocumentsRead), Body: SearchInput{}, Errors: []int{http.StatusForbidden, http.StatusBadGateway, unavailable},
+		Response: gin.H{"query": "", "results": []SearchResult{}}},
+	"GET /searches": {Tag: "search", Summary: "List saved searches and recent queries",
+		Description: "recent holds the last SEARCH_HISTORY_SIZE queries run through /search, the newest first.",
+		Auth:        openapi.Keyed(models.ScopeDocumentsRead), Response: gin.H{"saved": []models.SavedSearch{}, "recent": []models.RecentSearch{}}},
+	"POST /searches": {Tag: "search", Summary: "Save a search",
+		Description: "With notify set, documents processed from now on that match the search are announced: a search.matched webhook, an email, or both. Each document alerts once per search. " +
+			"Vector searches only alert on a similarity of at least SEARCH_ALERT_MIN_SCORE, keyword ones on any match.",
+		Auth: openapi.Keyed(models.ScopeDocumentsRead), Body: SavedSearchInput{}, Status: http.StatusCreated, Response: models.SavedSearch{},
+		Errors: []int{http.StatusNotFound, http.StatusConflict}},
+	"DELETE /searches/history": {Tag: "search", Summary: "Clear your search history", Auth: openapi.Keyed(models.ScopeDocumentsRead), Response: gin.H{"message": ""}},
+	"GET /searches/:id":        {Tag: "search", Summary: "A saved search", Auth: openapi.Keyed(models.ScopeDocumentsRead), Errors: notFound, Response: models.SavedSearch{}},
+	"PATCH /searches/:id": {Tag: "search", Summary: "Change a saved search", Description: "Fields left out stay as they are, filters replaces all of them.",
+		Auth: openapi.Keyed(models.ScopeDocumentsRead), Body: SavedSearchPatch{}, Errors: []int{http.StatusNotFound, http.StatusConflict}, Response: models.SavedSearch{}},
+	"DELETE /searches/:id": {Tag: "search", Summary: "Delete a saved search", Auth: openapi.Keyed(models.ScopeDocumentsRead), Errors: notFound, Response: gin.H{"message": ""}},
+	"POST /ask": {Tag: "search", Summary: "Answer a question from the documents",
+		Description: "Streams server-sent events: token events with the answer as it is written, then a done event with the whole answer, its sources and citations. " +
+			"A citation points a sentence of the answer at the passage of the source it cites, by chunk_id and byte offsets into the document's text.",
+		Auth: openapi.Keyed(models.ScopeDocumentsRead), Body: AskInput{}, Produces: []string{"text/event-stream"},
+		Errors: []int{http.StatusForbidden, http.StatusBadGateway, unavailable}},
+	"GET /models": {Tag: "search", Summary: "Models you can pick",
+		Description: "The embedding and generation models requests may name with embedding_model, summary_model and model, with their prices and limits, and the defaults used otherwise.",
+		Auth:        openapi.Keyed(models.ScopeDocumentsRead), Response: gin.H{"models": []models.AllowedModel{}, "defaults": gin.H{"embedding": "", "generation": ""}}},
+	"GET /plans": {Tag: "account", Summary: "Plans and their limits",
+		Description: "What each plan allows. Your own documents go by your plan (plan on GET /me), an organization's by the organization's. max_file_size 0 is the server's upload limit, " +
+			"monthly_pages and max_storage 0 are no limit, and models lists the allowed models requests may pick, * for all of them. Over a limit a request is refused with 413 for the file size, " +
+			"402 once the month's pages are used up or storage is full and 403 for a model or OCR the plan doesn't include. An account holding more than its plan stores after a downgrade " +
+			"is read-only (read_only_at on GET /me and organizations), uploads and reprocessing get 402 until deleting documents brought it within the plan.",
+		Auth: openapi.Keyed(models.ScopeDocumentsRead), Response: gin.H{"plans": []models.Plan{}}},
+	"POST /billing/checkout": {Tag: "account", Summary: "Buy a plan",
+		Description: "Starts a Stripe checkout for a subscription to plan, for your own account or with org_id an organization you own. Send the buyer to url, " +
+			"the account moves to the plan when Stripe reports the subscription paid. An account with a subscription changes it with PUT /billing/subscription instead.",
+		Auth: openapi.Bearer, Body: CheckoutInput{}, Status: http.StatusCreated, Response: gin.H{"id": "", "url": ""},
+		Errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusConflict, http.StatusBadGateway, unavailable}},
+	"GET /billing/subscription": {Tag: "account", Summary: "Your subscription", Auth: openapi.Bearer,
+		Query: []openapi.Param{{Name: "org_id", Description: "An organization you own"}}, Errors: []int{http.StatusForbidden, http.StatusNotFound}, Response: models.Subscription{}},
+	"PUT /billing/subscription": {Tag: "account", Summary: "Change the plan of your subscription",
+		Description: "Moves the subscription to another plan. Stripe prorates what is left of the period and invoices it right away, the account changes plan when its webhook confirms. " +
+			"read_only says whether the account holds more than the new plan stores, it is read-only then until documents are deleted.",
+		Auth: openapi.Bearer, Body: CheckoutInput{}, Status: http.StatusAccepted, Response: gin.H{"subscription_id": "", "plan": "", "read_only": false},
+		Errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusBadGateway, unavailable}},
+	"POST /billing/stripe/webhook": {Tag: "account", Summary: "Stripe events",
+		Description: "Where Stripe sends customer.subscription.created, updated and deleted, verified by the Stripe-Signature header. A paying subscription puts its account on the plan " +
+			"of its price in STRIPE_PRICES, an ended or unpaid one back on free. Older events than the subscription was last updated with are ignored.",
+		Auth: openapi.Public, Response: gin.H{"received": true}, Errors: []int{http.StatusBadRequest, unavailable}},
+	"GET /chunks/:id": {Tag: "search", Summary: "A chunk of a document",
+		Description: "The whole text of a chunk that search results, sources and citations name by chunk_id, with its byte offsets into the document's extracted text.",
+		Auth:        openapi.Keyed(models.ScopeDocumentsRead), Response: ChunkDetail{}, Errors: []int{http.StatusNotFound, http.StatusBadGateway, unavailable}},
+	"POST /chats": {Tag: "search", Summary: "Start a chat about your documents",
+		Description: "A chat searches everything you can read, or only an organization's documents, a collection and its sub-collections, or a single document.",
+		Auth:        openapi.Keyed(models.ScopeDocumentsRead), Body: ChatInput{}, Status: http.StatusCreated, Response: models.Chat{},
+		Errors: []int{http.StatusForbidden, http.StatusNotFound, unavailable}},
+	"GET /chats": {Tag: "search", Summary: "List chats", Description: "The chat talked to last comes first.", Auth: openapi.Keyed(models.ScopeDocumentsRead), Response: gin.H{"chats": []models.Chat{}}},
+	"GET /chats/:id": {Tag: "search", Summary: "A chat with its messages", Auth: openapi.Keyed(models.ScopeDocumentsRead), Errors: notFound,
+		Response: models.Chat{Messages: []models.ChatMessage{{Sources: []models.Source{}, Citations: []models.Citation{}}}}},
+	"DELETE /chats/:id": {Tag: "search", Summary: "Delete a chat", Auth: openapi.Keyed(models.ScopeDocumentsRead), Errors: notFound, Response: gin.H{"message": ""}},
+	"POST /chats/:id/messages": {Tag: "search", Summary: "Ask the next question of a chat",
+		Description: "Streams server-sent events like /ask. Follow-ups are rewritten into a query of their own from the conversation before the sources are searched, " +
+			"the done event also carries that query. The question and answer are saved once the answer is complete.",
+		Auth: openapi.Keyed(models.ScopeDocumentsRead), Body: ChatMessageInput{}, Produces: []string{"text/event-stream"},
+		Errors: []int{http.StatusForbidden, http.StatusNotFound, http.StatusBadGateway, unavailable}},
+
+	// --- organizations ---
+	"POST /orgs": {Tag: "orgs", Summary: "Create an organization", Auth: openapi.Bearer, Body: OrgInput{}, Status: http.StatusCreated, Response: models.Organization{}},
+	"GET /orgs":  {Tag: "orgs", Summary: "List the caller's organizations", Auth: openapi.Bearer, Response: gin.H{"organizations": []models.Organization{}}},
+	"GET /orgs/:id/members": {Tag: "orgs", Summary: "List members", Auth: openapi.Bearer, Errors: []int{http.StatusForbidden, http.StatusNotFound},
+		Response: gin.H{"members": []models.Membership{}}},
+	"PATCH /orgs/:id/members/:user_id": {Tag: "orgs", Summary: "Change a member's role", Description: "Owners only, an organization keeps at least one owner.",
+		Auth: openapi.Bearer, Body: MemberRoleInput{}, Errors: []int{http.StatusForbidden, http.StatusNotFound, http.StatusConflict}, Response: models.Membership{}},
+	"DELETE /orgs/:id/members/:user_id": {Tag: "orgs", Summary: "Remove a member, or leave", Auth: openapi.Bearer,
+		Errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict}, Response: gin.H{"message": ""}},
+	"POST /orgs/:id/invitations": {Tag: "orgs", Summary: "Invite someone by email", Auth: openapi.Bearer, Body: InvitationInput{}, Status: http.StatusCreated,
+		Errors: []int{http.StatusForbidden, http.StatusNotFound, http.StatusConflict}, Response: models.Invitation{}},
+	"GET /orgs/:id/invitations": {Tag: "orgs", Summary: "List pending invitations", Auth: openapi.Bearer, Errors: []int{http.StatusForbidden, http.StatusNotFound},
+		Response: gin.H{"invitations": []models.Invitation{}}},
+	"DELETE /orgs/:id/invitations/:invitation_id": {Tag: "orgs", Summary: "Cancel an invitation", Auth: openapi.Bearer, Errors: []int{http.StatusForbidden, http.StatusNotFound},
+		Response: gin.H{"message": ""}},
+	"GET /orgs/:id/retention": {Tag: "orgs", Summary: "Get the retention rule", Auth: openapi.Bearer, Errors: []int{http.StatusForbidden, http.StatusNotFound},
+		Response: gin.H{"org_id": "", "retention_days": (*int)(nil)}},
+	"PUT /orgs/:id/retention": {Tag: "orgs", Summary: "Set or clear the retention rule", Description: "Documents older than this many days are moved to the trash, null keeps them forever.",
+		Auth: openapi.Bearer, Body: RetentionInput{}, Errors: []int{http.StatusForbidden, http.StatusNotFound}, Response: gin.H{"org_id": "", "retention_days": (*int)(nil)}},
+	"GET /invitations": {Tag: "orgs", Summary: "List invitations to the caller's email", Auth: openapi.Bearer, Response: gin.H{"invitations": []models.Invitation{}}},
+	"POST /invitations/:id/accept": {Tag: "orgs", Summary: "Accept an invitation", Auth: openapi.Bearer, Errors: []int{http.StatusNotFound, http.StatusConflict, http.StatusGone},
+		Response: gin.H{"message": "", "org_id": "", "org_name": "", "role": ""}},
+
+	// --- inbox ---
+	"GET /inbox":         {Tag: "inbox", Summary: "Get the caller's inbound email address", Description: "Attachments mailed to it are uploaded.", Auth: openapi.Bearer, Errors: notFound, Response: models.Inbox{}},
+	"POST /inbox/rotate": {Tag: "inbox", Summary: "Replace the inbound email address", Auth: openapi.Bearer, Errors: notFound, Response: models.Inbox{}},
+
+	// --- connectors ---
+	"POST /connectors": {Tag: "connectors", Summary: "Link a Drive or Dropbox account", Description: "Send the user to authorize_url, they come back to the callback.",
+		Auth: openapi.Bearer, Body: ConnectorInput{}, Status: http.StatusCreated, Errors: []int{http.StatusForbidden, http.StatusNotFound},
+		Response: gin.H{"connector": models.Connector{}, "authorize_url": ""}},
+	"GET /connectors":     {Tag: "connectors", Summary: "List connectors", Auth: openapi.Bearer, Response: gin.H{"connectors": []models.Connector{}}},
+	"GET /connectors/:id": {Tag: "connectors", Summary: "Get a connector", Auth: openapi.Bearer, Errors: notFound, Response: models.Connector{}},
+	"PATCH /connectors/:id": {Tag: "connectors", Summary: "Pick the folders to sync", Auth: openapi.Bearer, Body: UpdateConnectorInput{},
+		Errors: []int{http.StatusNotFound, http.StatusConflict}, Response: models.Connector{}},
+	"DELETE /connectors/:id": {Tag: "connectors", Summary: "Unlink a connector", Description: "The documents it brought in stay.", Auth: openapi.Bearer, Errors: notFound, Response: gin.H{"message": ""}},
+	"POST /connectors/:id/authorize": {Tag: "connectors", Summary: "Get a new authorize URL", Auth: openapi.Bearer, Errors: notFound,
+		Response: gin.H{"connector": models.Connector{}, "authorize_url": ""}},
+	"GET /connectors/:id/folders": {Tag: "connectors", Summary: "Browse the linked account's folders", Auth: openapi.Bearer,
+		Query:  []openapi.Param{{Name: "parent", Description: "The folder to list, the root when left out"}},
+		Errors: []int{http.StatusNotFound, http.StatusConflict, http.StatusBadGateway}, Response: gin.H{"folders": []models.ConnectorFolder{}}},
+	"POST /connectors/:id/sync": {Tag: "connectors", Summary: "Sync now", Auth: openapi.Bearer, Status: http.StatusAccepted,
+		Errors: []int{http.StatusNotFound, http.StatusConflict, unavailable}, Response: gin.H{"message": ""}},
+	"GET /connectors/callback/:provider": {Tag: "connectors", Summary: "Where the provider sends the browser back to", Auth: openapi.Public,
+		Query:    []openapi.Param{{Name: "state", Required: true}, {Name: "code", Required: true}, {Name: "error"}},
+		Errors:   []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusBadGateway},
+		Response: gin.H{"message": "", "connector": models.Connector{}}},
+
+	// --- webhooks ---
+	"POST /webhooks": {Tag: "webhooks", Summary: "Register a webhook", Description: "Deliveries are signed with the secret in this response. The url has to resolve to a public address, deliveries and their redirects never go to private ones. " +
+		"events defaults to all of job.completed, job.failed, search.matched and usage.reported, the last one sent for every closed day you had usage on (see GET /me/usage).",
+		Auth: openapi.Bearer, Body: WebhookInput{}, Status: http.StatusCreated, Response: models.Webhook{}},
+	"GET /webhooks":        {Tag: "webhooks", Summary: "List webhooks", Auth: openapi.Bearer, Response: gin.H{"webhooks": []models.Webhook{}}},
+	"DELETE /webhooks/:id": {Tag: "webhooks", Summary: "Delete a webhook", Auth: openapi.Bearer, Errors: notFound, Response: gin.H{"message": ""}},
+
+	// --- admin ---
+	"GET /admin/dlq": {Tag: "admin", Summary: "Peek at the dead letter queue", Auth: openapi.Admin,
+		Query:    []openapi.Param{{Name: "limit", Type: "integer", Description: "1 to 500, 50 by default"}},
+		Errors:   []int{http.StatusBadRequest, http.StatusNotImplemented},
+		Response: gin.H{"total": 0, "jobs": []dlqEntry{}}},
+	"POST /admin/dlq/:job_id/requeue": {Tag: "admin", Summary: "Send a dead letter back to the worker", Auth: openapi.Admin,
+		Errors: []int{http.StatusNotFound, http.StatusNotImplemented, unavailable}, Response: gin.H{"message": "", "job_id": ""}},
+	"GET /admin/stats": {Tag: "admin", Summary: "Totals across the installation",
+		Description: "Users, documents, storage and jobs by status, plus the RabbitMQ queue depths when `RABBITMQ_MANAGEMENT_URL` is set.",
+		Auth:        openapi.Admin, Response: systemStats{}},
+	"GET /admin/users": {Tag: "admin", Summary: "List users", Auth: openapi.Admin,
+		Query: []openapi.Param{
+			{Name: "email", Description: "Part of the address, any case"},
+			{Name: "status", Enum: []string{storage.UserStatusActive, storage.UserStatusSuspended, storage.UserStatusDeleted}},
+			{Name: "limit", Type: "integer", Description: "1 to 200, 50 by default"},
+			{Name: "after", Type: "integer", Description: "next_after from the previous page"},
+		},
+		Errors: []int{http.StatusBadRequest}, Response: gin.H{"users": []models.User{}, "next_after": 0}},
+	"GET /admin/users/:id": {Tag: "admin", Summary: "Get a user with their quota overrides", Auth: openapi.Admin, Errors: notFound, Response: adminUser{}},
+	"POST /admin/users/:id/suspend": {Tag: "admin", Summary: "Suspend a user",
+		Description: "They can't sign in or use their API keys until reactivated, their sessions end at once.",
+		Auth:        openapi.Admin, Body: SuspendInput{}, BodyOptional: true,
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict}, Response: gin.H{"message": "", "sessions_revoked": 0}},
+	"POST /admin/users/:id/reactivate": {Tag: "admin", Summary: "Lift a suspension", Auth: openapi.Admin,
+		Errors: []int{http.StatusNotFound, http.StatusConflict}, Response: gin.H{"message": ""}},
+	"PUT /admin/users/:id/quota": {Tag: "admin", Summary: "Override a user's rate limits",
+		Description: "Rates are written like `RATE_LIMIT_UPLOADS` (`10/m`, `off`), empty ones keep the configured limit.",
+		Auth:        openapi.Admin, Body: QuotaInput{}, Errors: []int{http.StatusBadRequest, http.StatusNotFound}, Response: models.Quota{}},
+	"DELETE /admin/users/:id/quota": {Tag: "admin", Summary: "Put a user back on the configured rate limits", Auth: openapi.Admin,
+		Errors: notFound, Response: gin.H{"message": ""}},
+	"GET /admin/models": {Tag: "admin", Summary: "List the models callers may pick", Auth: openapi.Admin,
+		Query:    []openapi.Param{{Name: "kind", Enum: []string{models.ModelKindEmbedding, models.ModelKindGeneration}}},
+		Response: gin.H{"models": []models.AllowedModel{}}},
+	"PUT /admin/models/:kind/*name": {Tag: "admin", Summary: "Allow a model, or change its prices and limits",
+		Description: "Prices are in USD per million tokens. max_input_tokens caps the chunk size of jobs embedding with an embedding model and the prompt of a generation model, " +
+			"max_output_tokens what a generation model writes, 0 is no limit. The name may hold slashes.",
+		Auth: openapi.Admin, Body: AllowedModelInput{}, Errors: []int{http.StatusBadRequest, http.StatusNotFound}, Response: models.AllowedModel{}},
+	"DELETE /admin/models/:kind/*name": {Tag: "admin", Summary: "Stop callers from picking a model", Auth: openapi.Admin, Errors: notFound, Response: gin.H{"message": ""}},
+	"GET /admin/plans":                 {Tag: "admin", Summary: "List the plans", Auth: openapi.Admin, Response: gin.H{"plans": []models.Plan{}}},
+	"PUT /admin/plans/:name": {Tag: "admin", Summary: "Create a plan or change what it allows",
+		Description: "max_file_size 0 is the server's upload limit, monthly_pages and max_storage 0 are no limit. models are allowed models the plan may pick, [\"*\"] for all of them, " +
+			"none leaves it the configured ones. Without ocr jobs skip the ocr stage. Requests are held to the change right away, queued jobs keep their options.",
+		Auth: openapi.Admin, Body: PlanInput{}, Errors: []int{http.StatusBadRequest}, Response: models.Plan{}},
+	"DELETE /admin/plans/:name": {Tag: "admin", Summary: "Delete a plan nobody is on", Auth: openapi.Admin,
+		Errors: []int{http.StatusNotFound, http.StatusConflict}, Response: gin.H{"message": ""}},
+	"PUT /admin/users/:id/plan": {Tag: "admin", Summary: "Move a user to another plan", Auth: openapi.Admin, Body: SetPlanInput{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound}, Response: gin.H{"user_id": 0, "plan": "", "read_only": false}},
+	"PUT /admin/orgs/:id/plan": {Tag: "admin", Summary: "Move an organization to another plan", Auth: openapi.Admin, Body: SetPlanInput{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound}, Response: gin.H{"org_id": "", "plan": "", "read_only": false}},
+	"POST /admin/embedding-migrations": {Tag: "admin", Summary: "Re-embed every document with another model",
+		Description: "Every document is re-embedded into a new vector collection while searches keep going to the current one. The migrate_embeddings schedule queues batch_size documents at a time " +
+			"and switches searches and new jobs over once every document is in. The model is tried out first. One migration runs at a time.",
+		Auth: openapi.Admin, Body: EmbeddingMigrationInput{}, Status: http.StatusAccepted, Errors: []int{http.StatusBadRequest, http.StatusConflict, unavailable}, Response: models.EmbeddingMigration{}},
+	"GET /admin/embedding-migrations": {Tag: "admin", Summary: "List embedding migrations and what searches use now", Auth: openapi.Admin,
+		Response: gin.H{"migrations": []models.EmbeddingMigration{}, "current": gin.H{"collection": "", "embedding_model": "", "migration_id": ""}}},
+	"GET /admin/embedding-migrations/:id": {Tag: "admin", Summary: "Get an embedding migration and its progress", Auth: openapi.Admin, Errors: notFound, Response: models.EmbeddingMigration{}},
+	"POST /admin/embedding-migrations/:id/switch": {Tag: "admin", Summary: "Switch over without the documents that failed",
+		Description: "Documents that failed to re-embed drop out of semantic search until they are reprocessed. It is refused while documents are still to be re-embedded.",
+		Auth:        openapi.Admin, Errors: []int{http.StatusNotFound, http.StatusConflict}, Response: models.EmbeddingMigration{}},
+	"POST /admin/embedding-migrations/:id/cancel": {Tag: "admin", Summary: "Cancel a running embedding migration",
+		Description: "Searches stay on the current collection. The migration's collection is left in the vector store.",
+		Auth:        openapi.Admin, Errors: []int{http.StatusNotFound, http.StatusConflict}, Response: gin.H{"message": ""}},
+	"POST /admin/schedules": {Tag: "admin", Summary: "Create a schedule", Auth: openapi.Admin, Body: ScheduleInput{}, Status: http.StatusCreated,
+		Errors: []int{http.StatusConflict}, Response: models.Schedule{}},
+	"GET /admin/schedules":     {Tag: "admin", Summary: "List schedules and the tasks they can run", Auth: openapi.Admin, Response: gin.H{"schedules": []models.Schedule{}, "tasks": []string{}}},
+	"GET /admin/schedules/:id": {Tag: "admin", Summary: "Get a schedule", Auth: openapi.Admin, Errors: notFound, Response: models.Schedule{}},
+	"PATCH /admin/schedules/:id": {Tag: "admin", Summary: "Change a schedule", Auth: openapi.Admin, Body: UpdateScheduleInput{},
+		Errors: notFound, Response: models.Schedule{}},
+	"DELETE /admin/schedules/:id": {Tag: "admin", Summary: "Delete a schedule", Auth: openapi.Admin, Errors: notFound, Response: gin.H{"message": ""}},
+	"POST /admin/schedules/:id/run": {Tag: "admin", Summary: "Run a schedule's task now", Auth: openapi.Admin, Status: http.StatusAccepted,
+		Errors: []int{http.StatusNotFound, http.StatusConflict}, Response: gin.H{"message": "", "schedule_id": ""}},
+}
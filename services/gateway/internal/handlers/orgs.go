@@ -0,0 +1,376 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const invitationTTL = 7 * 24 * time.Hour
+
+var orgRoles = map[string]bool{
+	models.RoleOwner:  true,
+	models.RoleMember: true,
+	models.RoleViewer: true,
+}
+
+type OrgHandler struct {
+	Store storage.Store
+}
+
+// Constructor for the organization endpoints
+func NewOrgHandler(store storage.Store) *OrgHandler {
+	return &OrgHandler{Store: store}
+}
+
+// orgRole looks up the caller's role in an organization, responding with 404 when they aren't in it
+// so outsiders can't probe which organization IDs exist
+func orgRole(c *gin.Context, store storage.OrgStore, orgID string) (string, bool) {
+	role, failure := memberRole(c.Request.Context(), store, orgID, middleware.UserID(c))
+	if failure != nil {
+		failure.respond(c)
+		return "", false
+	}
+	return role, true
+}
+
+// memberRole is orgRole for userID without gin
+func memberRole(ctx context.Context, store storage.OrgStore, orgID string, userID int) (string, *apiFailure) {
+	m, err := store.GetMembership(ctx, orgID, userID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return "", &apiFailure{Status: http.StatusNotFound, Message: "Organization not found"}
+	} else if err != nil {
+		return "", &apiFailure{Status: http.StatusInternalServerError, Message: "Database error"}
+	}
+	return m.Role, nil
+}
+
+// requireOrgOwner is orgRole for the endpoints only owners may use
+func requireOrgOwner(c *gin.Context, store storage.OrgStore, orgID string) bool {
+	role, ok := orgRole(c, store, orgID)
+	if ok && role != models.RoleOwner {
+		apierror.Write(c, http.StatusForbidden, "Only organization owners can do that")
+		return false
+	}
+	return ok
+}
+
+// canUpload reports whether a role may add documents to the organization
+func canUpload(role string) bool {
+	return role == models.RoleOwner || role == models.RoleMember
+}
+
+type OrgInput struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// --- POST /orgs ---
+// The creator becomes the first owner
+func (h *OrgHandler) Create(c *gin.Context) {
+	var input OrgInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Invalid(c, err)
+		return
+	}
+
+	org := models.Organization{
+		ID:        "org_" + uuid.NewString(),
+		Name:      strings.TrimSpace(input.Name),
+		CreatedAt: time.Now().UTC(),
+		Role:      models.RoleOwner,
+		Plan:      models.PlanFree,
+	}
+	if org.Name == "" {
+		apierror.Write(c, http.StatusBadRequest, "name must not be empty")
+		return
+	}
+
+	if err := h.Store.CreateOrg(c.Request.Context(), org, middleware.UserID(c)); err != nil {
+		log.Println("Organization Insert Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Failed to create organization")
+		return
+	}
+	c.JSON(http.StatusCreated, org)
+}
+
+// --- GET /orgs ---
+func (h *OrgHandler) List(c *gin.Context) {
+	orgs, err := h.Store.ListOrgs(c.Request.Context(), middleware.UserID(c))
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"organizations": orgs})
+}
+
+// --- GET /orgs/:id/members ---
+func (h *OrgHandler) Members(c *gin.Context) {
+	if _, ok := orgRole(c, h.Store, c.Param("id")); !ok {
+		return
+	}
+
+	members, err := h.Store.ListMembers(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"members": members})
+}
+
+type MemberRoleInput struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// --- PATCH /orgs/:id/members/:user_id ---
+func (h *OrgHandler) UpdateMember(c *gin.Context) {
+	orgID := c.Param("id")
+	if !requireOrgOwner(c, h.Store, orgID) {
+		return
+	}
+
+	var input MemberRoleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Invalid(c, err)
+		return
+	}
+	if !orgRoles[input.Role] {
+		apierror.Write(c, http.StatusBadRequest, "role must be one of owner, member, viewer")
+		return
+	}
+
+	target, ok := h.member(c, orgID)
+	if !ok {
+		return
+	}
+	if target.Role == models.RoleOwner && input.Role != models.RoleOwner && !h.hasOtherOwner(c, orgID, target.UserID) {
+		return
+	}
+
+	if err := h.Store.UpdateMemberRole(c.Request.Context(), orgID, target.UserID, input.Role); err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	target.Role = input.Role
+	c.JSON(http.StatusOK, target)
+}
+
+// --- DELETE /orgs/:id/members/:user_id ---
+// Owners can remove anyone, everyone else can only remove themselves (leave)
+func (h *OrgHandler) RemoveMember(c *gin.Context) {
+	orgID := c.Param("id")
+	role, ok := orgRole(c, h.Store, orgID)
+	if !ok {
+		return
+	}
+
+	target, ok := h.member(c, orgID)
+	if !ok {
+		return
+	}
+	if role != models.RoleOwner && target.UserID != middleware.UserID(c) {
+		apierror.Write(c, http.StatusForbidden, "Only organization owners can do that")
+		return
+	}
+	if target.Role == models.RoleOwner && !h.hasOtherOwner(c, orgID, target.UserID) {
+		return
+	}
+
+	if err := h.Store.RemoveMember(c.Request.Context(), orgID, target.UserID); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed"})
+}
+
+// member loads the membership named by :user_id
+func (h *OrgHandler) member(c *gin.Context, orgID string) (models.Membership, bool) {
+	userID, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		apierror.Write(c, http.StatusNotFound, "Member not found")
+		return models.Membership{}, false
+	}
+
+	m, err := h.Store.GetMembership(c.Request.Context(), orgID, userID)
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Member not found")
+		return m, false
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return m, false
+	}
+	return m, true
+}
+
+// hasOtherOwner keeps an organization from ending up without an owner
+func (h *OrgHandler) hasOtherOwner(c *gin.Context, orgID string, userID int) bool {
+	members, err := h.Store.ListMembers(c.Request.Context(), orgID)
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return false
+	}
+	for _, m := range members {
+		if m.Role == models.RoleOwner && m.UserID != userID {
+			return true
+		}
+	}
+	apierror.Write(c, http.StatusConflict, "An organization needs at least one owner")
+	return false
+}
+
+type InvitationInput struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role"` // member by default
+}
+
+// --- POST /orgs/:id/invitations ---
+// There is no mailer yet, the invitee finds the invitation under GET /invitations
+// once they sign in (or sign up) with the invited address
+func (h *OrgHandler) Invite(c *gin.Context) {
+	orgID := c.Param("id")
+	if !requireOrgOwner(c, h.Store, orgID) {
+		return
+	}
+
+	var input InvitationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Invalid(c, err)
+		return
+	}
+	addr, err := mail.ParseAddress(input.Email)
+	if err != nil {
+		apierror.Write(c, http.StatusBadRequest, "email must be a valid email address")
+		return
+	}
+	if input.Role == "" {
+		input.Role = models.RoleMember
+	}
+	if !orgRoles[input.Role] {
+		apierror.Write(c, http.StatusBadRequest, "role must be one of owner, member, viewer")
+		return
+	}
+
+	now := time.Now().UTC()
+	inv := models.Invitation{
+		ID:        "inv_" + uuid.NewString(),
+		OrgID:     orgID,
+		Email:     strings.ToLower(addr.Address),
+		Role:      input.Role,
+		InvitedBy: middleware.UserID(c),
+		CreatedAt: now,
+		ExpiresAt: now.Add(invitationTTL),
+	}
+	if err := h.Store.CreateInvitation(c.Request.Context(), inv); err != nil {
+		log.Println("Invitation Insert Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Failed to create invitation")
+		return
+	}
+
+	log.Printf("Invited %s to organization %s as %s\n", inv.Email, orgID, inv.Role)
+	c.JSON(http.StatusCreated, inv)
+}
+
+// --- GET /orgs/:id/invitations ---
+func (h *OrgHandler) ListInvitations(c *gin.Context) {
+	if !requireOrgOwner(c, h.Store, c.Param("id")) {
+		return
+	}
+
+	invs, err := h.Store.ListOrgInvitations(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"invitations": invs})
+}
+
+// --- DELETE /orgs/:id/invitations/:invitation_id ---
+func (h *OrgHandler) CancelInvitation(c *gin.Context) {
+	if !requireOrgOwner(c, h.Store, c.Param("id")) {
+		return
+	}
+
+	err := h.Store.DeleteInvitation(c.Request.Context(), c.Param("invitation_id"), c.Param("id"))
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Invitation not found")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation cancelled"})
+}
+
+// --- GET /invitations ---
+// Pending invitations addressed to the caller's email
+func (h *OrgHandler) MyInvitations(c *gin.Context) {
+	user, err := h.Store.GetUserByID(c.Request.Context(), middleware.UserID(c))
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	invs, err := h.Store.ListInvitationsForEmail(c.Request.Context(), user.Email)
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	pending := []models.Invitation{}
+	for _, inv := range invs {
+		if time.Now().Before(inv.ExpiresAt) {
+			pending = append(pending, inv)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"invitations": pending})
+}
+
+// --- POST /invitations/:id/accept ---
+func (h *OrgHandler) Accept(c *gin.Context) {
+	userID := middleware.UserID(c)
+	user, err := h.Store.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	inv, err := h.Store.GetInvitation(c.Request.Context(), c.Param("id"))
+	// someone else's invitation looks the same as a missing one
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && !strings.EqualFold(inv.Email, user.Email)) {
+		apierror.Write(c, http.StatusNotFound, "Invitation not found")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if inv.AcceptedAt != nil || time.Now().After(inv.ExpiresAt) {
+		apierror.Write(c, http.StatusGone, "Invitation has expired or was already used")
+		return
+	}
+
+	err = h.Store.AcceptInvitation(c.Request.Context(), inv, userID)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		apierror.Write(c, http.StatusGone, "Invitation has expired or was already used")
+		return
+	case errors.Is(err, storage.ErrDuplicate):
+		apierror.Write(c, http.StatusConflict, "You are already a member of this organization")
+		return
+	case err != nil:
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Joined organization", "org_id": inv.OrgID, "org_name": inv.OrgName, "role": inv.Role})
+}
@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/policy"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// planName is what plans may be called, it ends up in URLs and error messages
+var planName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,49}$`)
+
+type PlanHandler struct {
+	Store storage.Store
+}
+
+// Constructor for the plan list
+func NewPlanHandler(store storage.Store) *PlanHandler {
+	return &PlanHandler{Store: store}
+}
+
+// --- GET /plans ---
+// The plans there are and what each allows, GET /me and GET /orgs/:id say which one applies
+func (h *PlanHandler) List(c *gin.Context) {
+	plans, err := h.Store.ListPlans(c.Request.Context())
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"plans": plans})
+}
+
+// accountPlan is the plan userID goes by in orgID, see policy.For
+func accountPlan(ctx context.Context, store storage.Store, userID int, orgID string) (models.Plan, *apiFailure) {
+	plan, err := policy.For(ctx, store, userID, orgID)
+	if err != nil {
+		log.Println("Plan Error:", err)
+		return plan, &apiFailure{Status: http.StatusInternalServerError, Message: "Database error"}
+	}
+	return plan, nil
+}
+
+// planFailure answers a policy check that didn't pass, nil when it did
+func planFailure(err error) *apiFailure {
+	if err == nil {
+		return nil
+	}
+	var denied *policy.Denied
+	if !errors.As(err, &denied) {
+		log.Println("Plan Error:", err)
+		return &apiFailure{Status: http.StatusInternalServerError, Message: "Database error"}
+	}
+	switch denied.Limit {
+	case policy.LimitFileSize:
+		return &apiFailure{Status: http.StatusRequestEntityTooLarge, Message: denied.Message}
+	case policy.LimitMonthlyPages, policy.LimitStorage:
+		return &apiFailure{Status: http.StatusPaymentRequired, Message: denied.Message}
+	}
+	return &apiFailure{Status: http.StatusForbidden, Message: denied.Message}
+}
+
+// checkUploadPlan checks a file of size bytes may go into target under its plan, with the
+// storage to keep it and the month's pages left to process it
+func checkUploadPlan(ctx context.Context, store storage.Store, target uploadTarget, size int64) *apiFailure {
+	plan, failure := accountPlan(ctx, store, target.UserID, target.OrgID)
+	if failure != nil {
+		return failure
+	}
+	if err := policy.CheckFileSize(plan, size); err != nil {
+		return planFailure(err)
+	}
+	if err := policy.CheckStorage(ctx, store, plan, target.UserID, target.OrgID, size); err != nil {
+		return planFailure(err)
+	}
+	return planFailure(policy.CheckPages(ctx, store, plan, target.UserID, target.OrgID))
+}
+
+// movePlan puts an account on plan and then holds it to the plan's storage, see policy.Enforce.
+// Going read-only or back is audited, the rest is up to the caller.
+func movePlan(ctx context.Context, store storage.Store, userID int, orgID, plan string) (bool, error) {
+	var err error
+	if orgID != "" {
+		err = store.SetOrgPlan(ctx, orgID, plan)
+	} else {
+		err = store.SetUserPlan(ctx, userID, plan)
+	}
+	if err != nil {
+		return false, err
+	}
+	readOnly, changed, err := policy.Enforce(ctx, store, userID, orgID)
+	if err != nil || !changed {
+		return readOnly, err
+	}
+
+	account := fmt.Sprintf("user %d", userID)
+	if orgID != "" {
+		account = "organization " + orgID
+	}
+	detail := fmt.Sprintf("%s is read-only, it holds more than the %s plan stores", account, plan)
+	if !readOnly {
+		detail = fmt.Sprintf("%s fits the %s plan and is writable again", account, plan)
+	}
+	entry := models.AuditEntry{Event: models.AuditReadOnly, Detail: detail}
+	if orgID == "" {
+		entry.UserID = &userID
+	}
+	if err := store.CreateAuditEntry(ctx, entry); err != nil {
+		log.Println("Failed to write audit entry:", err)
+	}
+	return readOnly, nil
+}
+
+// PlanInput is what a plan allows, limits of 0 are none
+type PlanInput struct {
+	Description  string   `json:"description"`
+	MaxFileSize  int64    `json:"max_file_size"`
+	MonthlyPages int64    `json:"monthly_pages"`
+	MaxStorage   int64    `json:"max_storage"`
+	OCR          bool     `json:"ocr"`
+	Models       []string `json:"models"`
+}
+
+// --- GET /admin/plans ---
+func (h *AdminHandler) ListPlans(c *gin.Context) {
+	plans, err := h.Store.ListPlans(c.Request.Context())
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"plans": plans})
+}
+
+// --- PUT /admin/plans/:name ---
+// Creates a plan or changes what it allows. Requests are held to the change right away, jobs
+// already queued keep the options they were queued with. models lists the allowed models the
+// plan may pick, ["*"] for all of them, none leaves it the configured ones.
+func (h *AdminHandler) PutPlan(c *gin.Context) {
+	var input PlanInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Invalid(c, err)
+		return
+	}
+	name := c.Param("name")
+	if !planName.MatchString(name) {
+		apierror.Write(c, http.StatusBadRequest, "Plan names are lowercase letters, digits, - and _, at most 50 of them")
+		return
+	}
+	var invalid []apierror.FieldError
+	if input.MaxFileSize < 0 {
+		invalid = append(invalid, apierror.FieldError{Field: "max_file_size", Message: "max_file_size can't be negative, 0 is the server's limit"})
+	}
+	if input.MonthlyPages < 0 {
+		invalid = append(invalid, apierror.FieldError{Field: "monthly_pages", Message: "monthly_pages can't be negative, 0 is none"})
+	}
+	if input.MaxStorage < 0 {
+		invalid = append(invalid, apierror.FieldError{Field: "max_storage", Message: "max_storage can't be negative, 0 is none"})
+	}
+	list := []string{}
+	for _, m := range input.Models {
+		m = strings.TrimSpace(m)
+		// the names are stored comma separated
+		if m == "" || len(m) > maxModelNameLen || strings.Contains(m, ",") {
+			invalid = append(invalid, apierror.FieldError{Field: "models", Message: "models must be model names or *"})
+			break
+		}
+		if !slices.Contains(list, m) {
+			list = append(list, m)
+		}
+	}
+	if len(invalid) > 0 {
+		apierror.Fields(c, invalid...)
+		return
+	}
+
+	ctx := c.Request.Context()
+	plan := models.Plan{
+		Name:         name,
+		Description:  strings.TrimSpace(input.Description),
+		MaxFileSize:  input.MaxFileSize,
+		MonthlyPages: input.MonthlyPages,
+		MaxStorage:   input.MaxStorage,
+		OCR:          input.OCR,
+		Models:       list,
+	}
+	if err := h.Store.PutPlan(ctx, plan); err != nil {
+		log.Println("Plan Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	audit(c, h.Store, models.AuditPlanChanged, fmt.Sprintf("set the %s plan to max_file_size %d, monthly_pages %d, max_storage %d, ocr %t, models %q",
+		name, plan.MaxFileSize, plan.MonthlyPages, plan.MaxStorage, plan.OCR, strings.Join(plan.Models, ",")))
+
+	plan, _ = h.Store.GetPlan(ctx, name)
+	c.JSON(http.StatusOK, plan)
+}
+
+// --- DELETE /admin/plans/:name ---
+// Only a plan nobody is on can go, move its users and organizations to another one first
+func (h *AdminHandler) DeletePlan(c *gin.Context) {
+	name := c.Param("name")
+	if name == models.PlanFree {
+		apierror.Write(c, http.StatusConflict, "The free plan is where new accounts start, it can't be deleted")
+		return
+	}
+	err := h.Store.DeletePlan(c.Request.Context(), name)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		apierror.Write(c, http.StatusNotFound, "Plan not found")
+		return
+	case errors.Is(err, storage.ErrNotEmpty):
+		apierror.Write(c, http.StatusConflict, "Users or organizations are still on this plan")
+		return
+	case err != nil:
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	audit(c, h.Store, models.AuditPlanChanged, fmt.Sprintf("deleted the %s plan", name))
+	c.JSON(http.StatusOK, gin.H{"message": "Plan deleted"})
+}
+
+type SetPlanInput struct {
+	Plan string `json:"plan" binding:"required"`
+}
+
+// --- PUT /admin/users/:id/plan ---
+// Moves the user to another plan, their documents outside organizations go by it from now on.
+// Holding more than it stores makes the account read-only until it fits.
+func (h *AdminHandler) SetUserPlan(c *gin.Context) {
+	var input SetPlanInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Invalid(c, err)
+		return
+	}
+	user, ok := h.user(c)
+	if !ok || !h.planExists(c, input.Plan) {
+		return
+	}
+	readOnly, err := movePlan(c.Request.Context(), h.Store, user.ID, "", input.Plan)
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "User not found")
+		return
+	} else if err != nil {
+		log.Println("Plan Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	audit(c, h.Store, models.AuditPlanChanged, fmt.Sprintf("moved user %d from the %s plan to %s", user.ID, user.Plan, input.Plan))
+	c.JSON(http.StatusOK, gin.H{"user_id": user.ID, "plan": input.Plan, "read_only": readOnly})
+}
+
+// --- PUT /admin/orgs/:id/plan ---
+// Moves the organization to another plan, its documents and members' requests in it go by it from now on.
+// Holding more than it stores makes the organization read-only until it fits.
+func (h *AdminHandler) SetOrgPlan(c *gin.Context) {
+	var input SetPlanInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Invalid(c, err)
+		return
+	}
+	ctx := c.Request.Context()
+	org, err := h.Store.GetOrg(ctx, c.Param("id"))
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Organization not found")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if !h.planExists(c, input.Plan) {
+		return
+	}
+	readOnly, err := movePlan(ctx, h.Store, 0, org.ID, input.Plan)
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Organization not found")
+		return
+	} else if err != nil {
+		log.Println("Plan Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	audit(c, h.Store, models.AuditPlanChanged, fmt.Sprintf("moved organization %s from the %s plan to %s", org.ID, org.Plan, input.Plan))
+	c.JSON(http.StatusOK, gin.H{"org_id": org.ID, "plan": input.Plan, "read_only": readOnly})
+}
+
+// planExists writes the error response when there is no plan called name
+func (h *AdminHandler) planExists(c *gin.Context, name string) bool {
+	_, err := h.Store.GetPlan(c.Request.Context(), name)
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Field(c, "plan", "plan must be one of the plans, GET /admin/plans lists them")
+		return false
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,370 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/metrics"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/objectstore"
+	"github.com/dhruvkshah75/docstream/gateway/internal/passwords"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	maxDisplayName = 100
+	maxAvatarSize  = 2 << 20
+	// avatars live next to the documents, under their owner's ID
+	avatarPrefix = "avatars/"
+	avatarURL    = "/me/avatar"
+)
+
+// avatarTypes are the images browsers show everywhere, by sniffed type, with the extension they're stored under
+var avatarTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+type ProfileHandler struct {
+	Store     storage.Store
+	Objects   objectstore.Store
+	Bucket    string
+	passwords *passwords.Policy
+}
+
+// Constructor for the profile endpoints
+func NewProfileHandler(store storage.Store, objects objectstore.Store, bucket string, policy *passwords.Policy) *ProfileHandler {
+	return &ProfileHandler{Store: store, Objects: objects, Bucket: bucket, passwords: policy}
+}
+
+// user loads the caller, writing the error response when that fails
+func (h *ProfileHandler) user(c *gin.Context) (models.User, bool) {
+	user, err := h.Store.GetUserByID(c.Request.Context(), middleware.UserID(c))
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "User not found")
+		return user, false
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return user, false
+	}
+	if user.AvatarKey != "" {
+		user.AvatarURL = avatarURL
+	}
+	return user, true
+}
+
+// --- GET /me ---
+func (h *ProfileHandler) Get(c *gin.Context) {
+	user, ok := h.user(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// notifySettings are how a user can hear about their uploads finishing, "" is none
+var notifySettings = map[string]bool{
+	"":                   true,
+	models.NotifyInstant: true,
+	models.NotifyDigest:  true,
+	models.NotifyNone:    true,
+}
+
+// ProfilePatch changes the caller's profile, whatever is left out stays as it is.
+// preferences replaces all of them, {} clears them.
+type ProfilePatch struct {
+	DisplayName *string             `json:"display_name"`
+	Preferences *models.Preferences `json:"preferences"`
+}
+
+// --- PATCH /me ---
+func (h *ProfileHandler) Update(c *gin.Context) {
+	var input ProfilePatch
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Invalid(c, err)
+		return
+	}
+
+	user, ok := h.user(c)
+	if !ok {
+		return
+	}
+	if input.DisplayName != nil {
+		name := strings.TrimSpace(*input.DisplayName)
+		if problem := displayNameProblem(name); problem != "" {
+			apierror.Field(c, "display_name", "display_name "+problem)
+			return
+		}
+		user.DisplayName = name
+	}
+	if input.Preferences != nil {
+		if err := validateOptions(input.Preferences.Options); err != nil {
+			apierror.Field(c, "preferences.options", err.Error())
+			return
+		}
+		plan, f := accountPlan(c.Request.Context(), h.Store, user.ID, "")
+		if f == nil {
+			f = checkJobModels(c.Request.Context(), h.Store, plan, input.Preferences.Options, "preferences.options.")
+		}
+		if f != nil {
+			f.respond(c)
+			return
+		}
+		if n := input.Preferences.Notifications; n != nil {
+			if !notifySettings[n.Completed] {
+				apierror.Field(c, "preferences.notifications.completed", "completed must be instant, digest or none")
+				return
+			}
+			if !notifySettings[n.Failed] {
+				apierror.Field(c, "preferences.notifications.failed", "failed must be instant, digest or none")
+				return
+			}
+			if *n == (models.NotificationPreferences{}) {
+				input.Preferences.Notifications = nil
+			}
+		}
+		user.Preferences = input.Preferences
+	}
+
+	if err := h.Store.UpdateProfile(c.Request.Context(), user); err != nil {
+		log.Println("Profile Update Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if user.Preferences != nil && *user.Preferences == (models.Preferences{}) {
+		user.Preferences = nil
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// displayNameProblem finishes a sentence about what is wrong with a display name, "" when nothing is
+func displayNameProblem(name string) string {
+	if !utf8.ValidString(name) {
+		return "must be valid UTF-8"
+	}
+	if utf8.RuneCountInString(name) > maxDisplayName {
+		return "must be at most " + strconv.Itoa(maxDisplayName) + " characters long"
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) || unicode.Is(unicode.Cf, r) {
+			return "can't contain control or formatting characters"
+		}
+	}
+	return ""
+}
+
+// --- PUT /me/avatar ---
+// Takes the picture as the "avatar" field of a multipart form, replacing the last one
+func (h *ProfileHandler) UploadAvatar(c *gin.Context) {
+	if c.Request.ContentLength > maxAvatarSize+multipartOverhead {
+		apierror.Write(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("Avatar is too large, the limit is %d bytes", maxAvatarSize))
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxAvatarSize+multipartOverhead)
+
+	header, err := c.FormFile("avatar")
+	if isTooLarge(err) || err == nil && header.Size > maxAvatarSize {
+		apierror.Write(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("Avatar is too large, the limit is %d bytes", maxAvatarSize))
+		return
+	} else if err != nil {
+		apierror.Field(c, "avatar", "avatar is required")
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Failed to read avatar")
+		return
+	}
+	defer file.Close()
+
+	head := make([]byte, sniffLen)
+	n, _ := io.ReadFull(file, head)
+	ext, ok := avatarTypes[http.DetectContentType(head[:n])]
+	if !ok {
+		apierror.Write(c, http.StatusUnsupportedMediaType, "avatar must be a PNG, JPEG, GIF or WebP image")
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Failed to read avatar")
+		return
+	}
+
+	user, ok := h.user(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	key := avatarPrefix + strconv.Itoa(user.ID) + "/" + uuid.NewString() + ext
+	if _, err := h.Objects.Put(ctx, h.Bucket, key, file, header.Size, mimeOf(key)); err != nil {
+		log.Println("Storage Avatar Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Failed to store avatar")
+		return
+	}
+
+	old := user.AvatarKey
+	user.AvatarKey = key
+	if err := h.Store.UpdateProfile(ctx, user); err != nil {
+		log.Println("Profile Update Error:", err)
+		h.Objects.Delete(ctx, h.Bucket, key)
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	h.deleteAvatar(c, old)
+
+	user.AvatarURL = avatarURL
+	c.JSON(http.StatusOK, user)
+}
+
+// --- GET /me/avatar ---
+func (h *ProfileHandler) Avatar(c *gin.Context) {
+	user, ok := h.user(c)
+	if !ok {
+		return
+	}
+	if user.AvatarKey == "" {
+		apierror.Write(c, http.StatusNotFound, "No avatar")
+		return
+	}
+
+	ctx := c.Request.Context()
+	info, err := h.Objects.Stat(ctx, h.Bucket, user.AvatarKey)
+	if errors.Is(err, objectstore.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "No avatar")
+		return
+	} else if err != nil {
+		log.Println("Storage Avatar Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Failed to read avatar")
+		return
+	}
+	body, err := h.Objects.Get(ctx, h.Bucket, user.AvatarKey)
+	if err != nil {
+		log.Println("Storage Avatar Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Failed to read avatar")
+		return
+	}
+	defer body.Close()
+
+	// a new picture gets a new key, so the old one can be cached for as long as it's served
+	c.DataFromReader(http.StatusOK, info.Size, mimeOf(user.AvatarKey), body, map[string]string{
+		"Cache-Control":          "private, max-age=3600",
+		"X-Content-Type-Options": "nosniff",
+		"ETag":                   `"` + path.Base(user.AvatarKey) + `"`,
+	})
+}
+
+// --- DELETE /me/avatar ---
+func (h *ProfileHandler) DeleteAvatar(c *gin.Context) {
+	user, ok := h.user(c)
+	if !ok {
+		return
+	}
+	if user.AvatarKey == "" {
+		apierror.Write(c, http.StatusNotFound, "No avatar")
+		return
+	}
+
+	old := user.AvatarKey
+	user.AvatarKey = ""
+	if err := h.Store.UpdateProfile(c.Request.Context(), user); err != nil {
+		log.Println("Profile Update Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	h.deleteAvatar(c, old)
+	c.JSON(http.StatusOK, gin.H{"message": "Avatar removed"})
+}
+
+// deleteAvatar is best effort, the profile no longer points at the object either way
+func (h *ProfileHandler) deleteAvatar(c *gin.Context, key string) {
+	if key == "" {
+		return
+	}
+	if err := h.Objects.Delete(c.Request.Context(), h.Bucket, key); err != nil {
+		log.Printf("Failed to delete old avatar %s: %v\n", key, err)
+	}
+}
+
+// mimeOf is an avatar's content type by the extension it was stored under
+func mimeOf(key string) string {
+	ext := path.Ext(key)
+	for mime, e := range avatarTypes {
+		if e == ext {
+			return mime
+		}
+	}
+	return "application/octet-stream"
+}
+
+type ChangePasswordInput struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// --- POST /me/change-password ---
+// The new password goes through the same policy as at signup. Every other session is logged
+// out, whoever knew the old password shouldn't stay signed in with it.
+func (h *ProfileHandler) ChangePassword(c *gin.Context) {
+	var input ChangePasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Invalid(c, err)
+		return
+	}
+
+	user, ok := h.user(c)
+	if !ok {
+		return
+	}
+	if user.Password == "" {
+		apierror.Write(c, http.StatusBadRequest, "This account signs in through Google or GitHub and has no password to change")
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.CurrentPassword)); err != nil {
+		metrics.Auth("change_password", false)
+		apierror.Field(c, "current_password", "current_password is incorrect")
+		return
+	}
+	if input.NewPassword == input.CurrentPassword {
+		apierror.Field(c, "new_password", "new_password must differ from the current one")
+		return
+	}
+	if problem := h.passwords.Check(c.Request.Context(), input.NewPassword); problem != "" {
+		apierror.Field(c, "new_password", "new_password "+problem)
+		return
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(input.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Failed to hash password")
+		return
+	}
+	ctx := c.Request.Context()
+	if err := h.Store.UpdatePassword(ctx, user.ID, string(hashed)); err != nil {
+		log.Println("Password Update Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	ended, err := h.Store.RevokeAllSessions(ctx, user.ID, middleware.SessionID(c))
+	if err != nil {
+		// the password did change, the sessions can still be ended at DELETE /me/sessions
+		log.Println("Session Revocation Error:", err)
+	}
+
+	audit(c, h.Store, models.AuditPasswordChanged, fmt.Sprintf("%d other sessions logged out", ended))
+	metrics.Auth("change_password", true)
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed", "sessions_ended": ended})
+}
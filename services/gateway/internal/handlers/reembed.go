@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/queue"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+)
+
+const (
+	defaultReembedBatch = 100
+	maxReembedBatch     = 1000
+)
+
+// ReembedTask is the reembed_documents schedule. After an embedding model upgrade it reprocesses
+// every document that wasn't embedded with the new model yet, a batch per run so the workers
+// aren't swamped. Once everything is done runs find nothing to do and the schedule can go.
+type ReembedTask struct {
+	Store storage.Store
+	Queue queue.Publisher
+}
+
+// Constructor for the re-embedding task
+func NewReembedTask(store storage.Store, publisher queue.Publisher) *ReembedTask {
+	return &ReembedTask{Store: store, Queue: publisher}
+}
+
+type reembedParams struct {
+	EmbeddingModel string `json:"embedding_model"`
+	BatchSize      int    `json:"batch_size"`
+}
+
+func parseReembedParams(raw json.RawMessage) (reembedParams, error) {
+	params := reembedParams{BatchSize: defaultReembedBatch}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&params); err != nil {
+		// the decoder's own message names Go types
+		return params, errors.New(`params must be {"embedding_model": "...", "batch_size": 100}`)
+	}
+	if params.EmbeddingModel == "" {
+		return params, fmt.Errorf("params: embedding_model is required")
+	}
+	// the model is looked for in the jobs' options as JSON, it has to come out as itself
+	if strconv.Quote(params.EmbeddingModel) != `"`+params.EmbeddingModel+`"` || len(params.EmbeddingModel) > 200 {
+		return params, fmt.Errorf("params: embedding_model is not a model name")
+	}
+	if params.BatchSize < 1 || params.BatchSize > maxReembedBatch {
+		return params, fmt.Errorf("params: batch_size must be between 1 and %d", maxReembedBatch)
+	}
+	return params, nil
+}
+
+// Check implements scheduler.Task, the params are {"embedding_model": "...", "batch_size": 100}
+func (t *ReembedTask) Check(raw json.RawMessage) error {
+	_, err := parseReembedParams(raw)
+	return err
+}
+
+// Run implements scheduler.Task
+func (t *ReembedTask) Run(ctx context.Context, raw json.RawMessage) (string, error) {
+	params, err := parseReembedParams(raw)
+	if err != nil {
+		return "", err
+	}
+	docs, err := t.Store.ListDocumentsToReembed(ctx, params.EmbeddingModel, params.BatchSize)
+	if err != nil {
+		return "", fmt.Errorf("listing documents: %w", err)
+	}
+	if len(docs) == 0 {
+		return "every document is embedded with " + params.EmbeddingModel, nil
+	}
+
+	// only the model is forced, the collection's other processing defaults still apply
+	options := &models.JobOptions{EmbeddingModel: params.EmbeddingModel}
+	for i, doc := range docs {
+		if _, err := enqueueJob(ctx, t.Store, t.Queue, doc, options); err != nil {
+			return "", fmt.Errorf("queued %d documents, then %s failed: %w", i, doc.ID, err)
+		}
+	}
+	return fmt.Sprintf("queued %d documents for re-embedding with %s", len(docs), params.EmbeddingModel), nil
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// maxRetentionDays is a hundred years, past that "never" is the honest setting
+const maxRetentionDays = 36500
+
+// RetentionHandler manages how long organizations keep documents and which ones are under legal hold.
+// Every change is written to the audit log, and so is every deletion a hold refuses.
+type RetentionHandler struct {
+	Store storage.Store
+}
+
+// Constructor for the retention and legal hold endpoints
+func NewRetentionHandler(store storage.Store) *RetentionHandler {
+	return &RetentionHandler{Store: store}
+}
+
+// audit records a retention or account action taken by the caller
+func audit(c *gin.Context, store storage.AuditStore, event, detail string) {
+	auditDocument(c, store, event, "", detail)
+}
+
+// auditDocument is audit for what the caller did to a document, it shows in the document's and
+// its organization's activity
+func auditDocument(c *gin.Context, store storage.AuditStore, event, documentID, detail string) {
+	userID := middleware.UserID(c)
+	entry := models.AuditEntry{UserID: &userID, Event: event, IP: c.ClientIP(), Detail: detail, DocumentID: documentID}
+	if err := store.CreateAuditEntry(c.Request.Context(), entry); err != nil {
+		log.Println("Failed to write audit entry:", err)
+	}
+}
+
+// --- GET /orgs/:id/retention ---
+func (h *RetentionHandler) Get(c *gin.Context) {
+	if _, ok := orgRole(c, h.Store, c.Param("id")); !ok {
+		return
+	}
+
+	org, err := h.Store.GetOrg(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"org_id": org.ID, "retention_days": org.RetentionDays})
+}
+
+type RetentionInput struct {
+	// RetentionDays left out or null keeps documents until someone deletes them
+	RetentionDays *int `json:"retention_days"`
+}
+
+// --- PUT /orgs/:id/retention ---
+// Documents older than retention_days go to the trash on the next expire_documents run and are
+// purged after DOCUMENT_RETENTION like any other deleted document. Only owners can change it.
+func (h *RetentionHandler) Set(c *gin.Context) {
+	orgID := c.Param("id")
+	if !requireOrgOwner(c, h.Store, orgID) {
+		return
+	}
+
+	var input RetentionInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Invalid(c, err)
+		return
+	}
+	if days := input.RetentionDays; days != nil && (*days < 1 || *days > maxRetentionDays) {
+		apierror.Write(c, http.StatusBadRequest, fmt.Sprintf("retention_days must be between 1 and %d, or null to keep documents forever", maxRetentionDays))
+		return
+	}
+
+	err := h.Store.SetOrgRetention(c.Request.Context(), orgID, input.RetentionDays)
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Organization not found")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	detail := fmt.Sprintf("organization %s keeps documents forever", orgID)
+	if input.RetentionDays != nil {
+		detail = fmt.Sprintf("organization %s keeps documents for %d days", orgID, *input.RetentionDays)
+	}
+	audit(c, h.Store, models.AuditRetentionPolicy, detail)
+	c.JSON(http.StatusOK, gin.H{"org_id": orgID, "retention_days": input.RetentionDays})
+}
+
+type LegalHoldInput struct {
+	Hold *bool `json:"hold" binding:"required"`
+	// Reason goes into the audit log, like a case number
+	Reason string `json:"reason"`
+}
+
+// --- PUT /documents/:id/legal-hold ---
+// Owners of the document's organization put it under legal hold or lift it. While held it can't
+// be deleted and its retention rule skips it, a held document in the trash stays there unpurged.
+func (h *RetentionHandler) LegalHold(c *gin.Context) {
+	var input LegalHoldInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Invalid(c, err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	userID := middleware.UserID(c)
+	doc, err := h.Store.GetDocument(ctx, c.Param("id"), userID)
+	if errors.Is(err, storage.ErrNotFound) {
+		doc, err = h.Store.GetDeletedDocument(ctx, c.Param("id"), userID)
+	}
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Document not found")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if doc.OrgID == "" {
+		apierror.Write(c, http.StatusForbidden, "Legal holds are for organization documents, this one is personal")
+		return
+	}
+	if !requireOrgOwner(c, h.Store, doc.OrgID) {
+		return
+	}
+
+	if err := h.Store.SetLegalHold(ctx, doc.ID, *input.Hold); errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Document not found")
+		return
+	} else if err != nil {
+		log.Println("Legal Hold Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	event, detail := models.AuditLegalHold, fmt.Sprintf("document %s put under legal hold", doc.ID)
+	if !*input.Hold {
+		event, detail = models.AuditLegalHoldRelease, fmt.Sprintf("legal hold on document %s lifted", doc.ID)
+	}
+	if input.Reason != "" {
+		detail += ": " + input.Reason
+	}
+	auditDocument(c, h.Store, event, doc.ID, detail)
+	c.JSON(http.StatusOK, gin.H{"document_id": doc.ID, "legal_hold": *input.Hold})
+}
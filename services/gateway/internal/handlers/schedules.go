@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/scheduler"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const maxScheduleNameLen = 100
+
+// ScheduleHandler is the admin API for the periodic tasks the scheduler runs
+type ScheduleHandler struct {
+	Store     storage.Store
+	Scheduler *scheduler.Scheduler
+}
+
+// Constructor for the schedule endpoints
+func NewScheduleHandler(store storage.Store, sched *scheduler.Scheduler) *ScheduleHandler {
+	return &ScheduleHandler{Store: store, Scheduler: sched}
+}
+
+// plan works out the schedule's next run from now, none while it is disabled
+func plan(sch *models.Schedule) error {
+	cron, err := scheduler.ParseCron(sch.Cron)
+	if err != nil {
+		return err
+	}
+	sch.NextRunAt = nil
+	if sch.Enabled {
+		next := cron.Next(time.Now())
+		sch.NextRunAt = &next
+	}
+	return nil
+}
+
+// checkParams validates the params for the schedule's task and stores them compacted, none is {}
+func (h *ScheduleHandler) checkParams(sch *models.Schedule, params json.RawMessage) error {
+	if len(params) == 0 || string(params) == "null" {
+		params = json.RawMessage("{}")
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, params); err != nil {
+		return errors.New("params must be a JSON object")
+	}
+	task, ok := h.Scheduler.Task(sch.Task)
+	if !ok {
+		return fmt.Errorf("task must be one of [%s]", strings.Join(h.Scheduler.Tasks(), ", "))
+	}
+	if err := task.Check(compact.Bytes()); err != nil {
+		return err
+	}
+	sch.Params = compact.Bytes()
+	return nil
+}
+
+func validateScheduleName(name string) error {
+	if name == "" {
+		return fmt.Errorf("name must not be empty")
+	}
+	if len(name) > maxScheduleNameLen {
+		return fmt.Errorf("name must be at most %d characters", maxScheduleNameLen)
+	}
+	return nil
+}
+
+func (h *ScheduleHandler) getSchedule(c *gin.Context) (models.Schedule, bool) {
+	sch, err := h.Store.GetSchedule(c.Request.Context(), c.Param("id"))
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Schedule not found")
+		return sch, false
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return sch, false
+	}
+	return sch, true
+}
+
+type ScheduleInput struct {
+	Name string `json:"name" binding:"required"`
+	Task string `json:"task" binding:"required"`
+	// Cron is five fields in UTC, like "0 3 * * *", or @hourly, @daily, @weekly, @monthly
+	Cron   string          `json:"cron" binding:"required"`
+	Params json.RawMessage `json:"params"`
+	// Enabled defaults to true
+	Enabled *bool `json:"enabled"`
+}
+
+// --- POST /admin/schedules ---
+func (h *ScheduleHandler) Create(c *gin.Context) {
+	var input ScheduleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Invalid(c, err)
+		return
+	}
+
+	now := time.Now().UTC()
+	sch := models.Schedule{
+		ID:        "sch_" + uuid.NewString(),
+		Name:      strings.TrimSpace(input.Name),
+		Task:      input.Task,
+		Cron:      strings.TrimSpace(input.Cron),
+		Enabled:   input.Enabled == nil || *input.Enabled,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := validateScheduleName(sch.Name); err != nil {
+		apierror.Field(c, "name", err.Error())
+		return
+	}
+	if err := h.checkParams(&sch, input.Params); err != nil {
+		apierror.Write(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := plan(&sch); err != nil {
+		apierror.Field(c, "cron", err.Error())
+		return
+	}
+
+	if err := h.Store.CreateSchedule(c.Request.Context(), sch); err != nil {
+		log.Println("Schedule Insert Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Failed to create schedule")
+		return
+	}
+	c.JSON(http.StatusCreated, sch)
+}
+
+// --- GET /admin/schedules ---
+// Every schedule, and the tasks there are to schedule
+func (h *ScheduleHandler) List(c *gin.Context) {
+	schedules, err := h.Store.ListSchedules(c.Request.Context())
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"schedules": schedules, "tasks": h.Scheduler.Tasks()})
+}
+
+// --- GET /admin/schedules/:id ---
+func (h *ScheduleHandler) Get(c *gin.Context) {
+	sch, ok := h.getSchedule(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, sch)
+}
+
+// UpdateScheduleInput changes what is set, the task stays what it is
+type UpdateScheduleInput struct {
+	Name    *string          `json:"name"`
+	Cron    *string          `json:"cron"`
+	Params  *json.RawMessage `json:"params"`
+	Enabled *bool            `json:"enabled"`
+}
+
+// --- PATCH /admin/schedules/:id ---
+func (h *ScheduleHandler) Update(c *gin.Context) {
+	var input UpdateScheduleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Invalid(c, err)
+		return
+	}
+	sch, ok := h.getSchedule(c)
+	if !ok {
+		return
+	}
+
+	if input.Name != nil {
+		sch.Name = strings.TrimSpace(*input.Name)
+		if err := validateScheduleName(sch.Name); err != nil {
+			apierror.Field(c, "name", err.Error())
+			return
+		}
+	}
+	if input.Params != nil {
+		if err := h.checkParams(&sch, *input.Params); err != nil {
+			apierror.Write(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	// an overdue run stays due unless the timing itself changes
+	replan := false
+	if input.Cron != nil {
+		sch.Cron = strings.TrimSpace(*input.Cron)
+		replan = true
+	}
+	if input.Enabled != nil && *input.Enabled != sch.Enabled {
+		sch.Enabled = *input.Enabled
+		replan = true
+	}
+	if replan {
+		if err := plan(&sch); err != nil {
+			apierror.Field(c, "cron", err.Error())
+			return
+		}
+	}
+
+	if err := h.Store.UpdateSchedule(c.Request.Context(), sch); errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Schedule not found")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	h.Get(c)
+}
+
+// --- DELETE /admin/schedules/:id ---
+// A run in progress finishes, deleting a built-in schedule stops that task until one is created again
+func (h *ScheduleHandler) Delete(c *gin.Context) {
+	err := h.Store.DeleteSchedule(c.Request.Context(), c.Param("id"))
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Schedule not found")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Schedule deleted"})
+}
+
+// --- POST /admin/schedules/:id/run ---
+// Runs the task now, disabled schedules too. The next scheduled run stays as it was.
+func (h *ScheduleHandler) Run(c *gin.Context) {
+	sch, ok := h.getSchedule(c)
+	if !ok {
+		return
+	}
+	started, err := h.Scheduler.Start(c.Request.Context(), sch)
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if !started {
+		apierror.Write(c, http.StatusConflict, "The schedule is already running")
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "Run started", "schedule_id": sch.ID})
+}
@@ -0,0 +1,582 @@
+package handlers
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+	"github.com/dhruvkshah75/docstream/gateway/internal/embeddings"
+	"github.com/dhruvkshah75/docstream/gateway/internal/keyword"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/rerank"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/dhruvkshah75/docstream/gateway/internal/vectorstore"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultSearchLimit = 10
+	maxSearchLimit     = 50
+	snippetLength      = 300
+	// searchTimeout bounds the embedding call and the index lookups together
+	searchTimeout = 20 * time.Second
+	// rrfK damps how much the first few ranks of either ranking decide a hybrid one, 60 is
+	// what reciprocal rank fusion is usually run with
+	rrfK = 60
+	// maxSharedDocuments caps how many of the documents shared with the caller a search covers
+	maxSharedDocuments = 1000
+)
+
+// Search modes
+const (
+	SearchModeVector  = "vector"  // closest embeddings
+	SearchModeKeyword = "keyword" // BM25 over the words of the chunks
+	SearchModeHybrid  = "hybrid"  // both, fused by rank
+)
+
+type SearchHandler struct {
+	Store    storage.Store
+	Embedder embeddings.Provider
+	Index    vectorstore.Store
+	Keywords keyword.Index
+	// Reranker scores the best hits again, nil when reranking is off
+	Reranker rerank.Provider
+	Rerank   config.Rerank
+	// LanguageModels are the models the worker embeds some languages with, by ISO 639-1 code
+	LanguageModels map[string]string
+	// Searches is how much search history to keep
+	Searches config.Searches
+}
+
+// Constructor for the search endpoint, either of embedder or index being nil turns vector search
+// off, keywords being nil keyword search and reranker being nil reranking
+func NewSearchHandler(store storage.Store, embedder embeddings.Provider, index vectorstore.Store, keywords keyword.Index, reranker rerank.Provider, rerankCfg config.Rerank, languageModels map[string]string, searches config.Searches) *SearchHandler {
+	return &SearchHandler{Store: store, Embedder: embedder, Index: index, Keywords: keywords, Reranker: reranker, Rerank: rerankCfg, LanguageModels: languageModels, Searches: searches}
+}
+
+// SearchInput is the POST body, GET takes the same fields as ?q=&mode=&rerank=&limit=&org_id=&document_id=&tag=&language=&entity=&embedding_model=
+type SearchInput struct {
+	Query string `json:"query" binding:"required"`
+	// Mode is one of the SearchMode* values, vector unless only keyword search is on
+	Mode string `json:"mode"`
+	// Rerank has the reranker score the best hits again, left out it does when RERANK_BY_DEFAULT is set
+	Rerank      *bool    `json:"rerank"`
+	Limit       int      `json:"limit"`
+	OrgID       string   `json:"org_id"`
+	DocumentIDs []string `json:"document_ids"`
+	// Tags only searches documents that carry all of them
+	Tags []string `json:"tags"`
+	// Languages only searches documents detected as one of them, by ISO 639-1 code
+	Languages []string `json:"languages"`
+	// Entities only searches documents that mention all of them, as "organization:acme inc."
+	Entities []string `json:"entities"`
+	// EmbeddingModel embeds the query with an allowed model instead, for documents embedded with it
+	EmbeddingModel string `json:"embedding_model"`
+
+	// annotations has keyword searches match the annotations on documents too, /search's do
+	annotations bool
+}
+
+// SearchResult is one matching chunk, or annotation
+type SearchResult struct {
+	DocumentID string `json:"document_id"`
+	Filename   string `json:"filename"`
+	OrgID      string `json:"org_id,omitempty"`
+	ChunkIndex int    `json:"chunk_index"`
+	ChunkID    string `json:"chunk_id,omitempty"` // for GET /chunks/:id
+	// AnnotationID is set instead of ChunkID when an annotation on the document matched, the
+	// offsets and snippet are then the annotation's
+	AnnotationID string  `json:"annotation_id,omitempty"`
+	Page         int     `json:"page,omitempty"`
+	Start        int     `json:"start"` // byte offsets of the chunk in the document's extracted text
+	End          int     `json:"end"`
+	Heading      string  `json:"heading,omitempty"`
+	Language     string  `json:"language,omitempty"`
+	Score        float32 `json:"score"` // similarity, BM25, for hybrid the fused reciprocal ranks, or the reranker's relevance
+	Snippet      string  `json:"snippet"`
+	// Highlights are where the words of the query are in the snippet, none for a vector hit
+	// that matched by meaning alone
+	Highlights []Highlight `json:"highlights"`
+	// text is the whole chunk, /ask puts it into the prompt
+	text string
+}
+
+// --- GET /search, POST /search ---
+// Returns the chunks from documents the caller can read that match the query best, best match
+// first: those closest to its embedding, those its words rank highest for by BM25 with
+// mode=keyword, or both merged by reciprocal rank fusion with mode=hybrid. Keyword matches take
+// in the documents' annotations too. With org_id only that organization's documents are
+// searched, otherwise the caller's personal documents, every organization they are in and what
+// was shared with them. Each result's snippet is cut from its chunk around the words of the
+// query, highlights say where they are in it. With rerank=true the best RERANK_CANDIDATES hits are put in order
+// again by the reranker, a cross-encoder that reads the query and each chunk together.
+func (h *SearchHandler) Search(c *gin.Context) {
+	input := SearchInput{annotations: true}
+	if c.Request.Method == http.MethodGet {
+		input.Query = c.Query("q")
+		input.Mode = c.Query("mode")
+		if raw := c.Query("rerank"); raw != "" {
+			rerank, err := strconv.ParseBool(raw)
+			if err != nil {
+				apierror.Field(c, "rerank", "rerank must be true or false")
+				return
+			}
+			input.Rerank = &rerank
+		}
+		input.EmbeddingModel = c.Query("embedding_model")
+		input.OrgID = c.Query("org_id")
+		input.DocumentIDs = c.QueryArray("document_id")
+		input.Tags = c.QueryArray("tag")
+		input.Languages = c.QueryArray("language")
+		input.Entities = c.QueryArray("entity")
+		if limit := c.Query("limit"); limit != "" {
+			n, err := strconv.Atoi(limit)
+			if err != nil {
+				apierror.Write(c, http.StatusBadRequest, "limit must be a number")
+				return
+			}
+			input.Limit = n
+		}
+	} else if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Invalid(c, err)
+		return
+	}
+
+	results, ok := h.search(c, input)
+	if !ok {
+		return
+	}
+	h.remember(c, input)
+	c.JSON(http.StatusOK, gin.H{"query": input.Query, "results": results})
+}
+
+// remember adds a search that ran to the caller's history, the results go out either way
+func (h *SearchHandler) remember(c *gin.Context, input SearchInput) {
+	if h.Searches.History <= 0 {
+		return
+	}
+	filters := models.SearchFilters{
+		Mode:        input.Mode,
+		OrgID:       input.OrgID,
+		DocumentIDs: input.DocumentIDs,
+		Tags:        input.Tags,
+		Languages:   input.Languages,
+		Entities:    input.Entities,
+	}
+	err := h.Store.RecordSearch(c.Request.Context(), middleware.UserID(c), strings.TrimSpace(input.Query), filters, h.Searches.History)
+	if err != nil {
+		log.Println("Search History Error:", err)
+	}
+}
+
+// search runs a query for the caller, writing the error response when it can't
+func (h *SearchHandler) search(c *gin.Context, input SearchInput) ([]SearchResult, bool) {
+	results, failure := h.run(c.Request.Context(), middleware.UserID(c), input)
+	if failure != nil {
+		failure.respond(c)
+		return nil, false
+	}
+	return results, true
+}
+
+// run is search for userID without gin, the gRPC search calls it too
+func (h *SearchHandler) run(ctx context.Context, userID int, input SearchInput) ([]SearchResult, *apiFailure) {
+	vectors := h.vectors()
+	if !vectors && h.Keywords == nil {
+		return nil, &apiFailure{Status: http.StatusServiceUnavailable, Message: "Search is not enabled on this server"}
+	}
+	input.Mode = cmp.Or(input.Mode, h.defaultMode())
+	switch input.Mode {
+	case SearchModeVector, SearchModeKeyword, SearchModeHybrid:
+	default:
+		return nil, &apiFailure{Status: http.StatusBadRequest, Field: "mode", Message: "mode must be vector, keyword or hybrid"}
+	}
+	if input.Mode != SearchModeKeyword && !vectors {
+		return nil, &apiFailure{Status: http.StatusServiceUnavailable, Message: "Vector search is not enabled on this server"}
+	}
+	if input.Mode != SearchModeVector && h.Keywords == nil {
+		return nil, &apiFailure{Status: http.StatusServiceUnavailable, Message: "Keyword search is not enabled on this server"}
+	}
+	rerank := h.Rerank.Default
+	if input.Rerank != nil {
+		rerank = *input.Rerank
+	}
+	if rerank && h.Reranker == nil {
+		return nil, &apiFailure{Status: http.StatusServiceUnavailable, Message: "Reranking is not enabled on this server"}
+	}
+
+	input.Query = strings.TrimSpace(input.Query)
+	if input.Query == "" {
+		return nil, &apiFailure{Status: http.StatusBadRequest, Field: "query", Message: "query is required"}
+	}
+	if input.Limit == 0 {
+		input.Limit = defaultSearchLimit
+	}
+	if input.Limit < 1 || input.Limit > maxSearchLimit {
+		return nil, &apiFailure{Status: http.StatusBadRequest, Field: "limit", Message: "limit must be between 1 and " + strconv.Itoa(maxSearchLimit)}
+	}
+
+	tags, err := normalizeTags(input.Tags)
+	if err != nil {
+		return nil, &apiFailure{Status: http.StatusBadRequest, Field: "tags", Message: err.Error()}
+	}
+	input.Tags = tags
+	if input.Languages, err = normalizeLanguages(input.Languages); err != nil {
+		return nil, &apiFailure{Status: http.StatusBadRequest, Field: "languages", Message: err.Error()}
+	}
+	if input.Entities, err = normalizeEntities(input.Entities); err != nil {
+		return nil, &apiFailure{Status: http.StatusBadRequest, Field: "entities", Message: err.Error()}
+	}
+
+	filter, failure := h.searchFilter(ctx, userID, input)
+	if failure != nil {
+		return nil, failure
+	}
+	// searchFilter checked the caller is in the organization whose plan this goes by
+	plan, failure := accountPlan(ctx, h.Store, userID, input.OrgID)
+	if failure != nil {
+		return nil, failure
+	}
+	if _, failure := allowedModel(ctx, h.Store, plan, models.ModelKindEmbedding, "embedding_model", input.EmbeddingModel); failure != nil {
+		return nil, failure
+	}
+
+	searchCtx, cancel := context.WithTimeout(ctx, searchTimeout)
+	defer cancel()
+
+	// ask for extra, some hits may belong to documents deleted since they were indexed. The
+	// reranker gets to pick from its candidates.
+	candidates := input.Limit * 2
+	if rerank {
+		candidates = max(candidates, h.Rerank.Candidates)
+	}
+	var rankings [][]hit
+	if input.Mode != SearchModeKeyword {
+		hits, failure := h.vectorHits(searchCtx, input, filter, candidates)
+		if failure != nil {
+			return nil, failure
+		}
+		rankings = append(rankings, hits)
+	}
+	if input.Mode != SearchModeVector {
+		matches, err := h.Keywords.Search(searchCtx, input.Query, filter, candidates)
+		if err != nil {
+			log.Println("Keyword Search Error:", err)
+			return nil, &apiFailure{Status: http.StatusBadGateway, Message: "Search failed"}
+		}
+		hits := make([]hit, len(matches))
+		for i, m := range matches {
+			c := m.Chunk
+			hits[i] = hit{DocumentID: m.DocumentID, ChunkIndex: c.Index, Page: c.Page, Start: c.Start, End: c.End, Heading: c.Heading, Text: c.Text, Score: float32(m.Score)}
+		}
+		if input.annotations {
+			notes, failure := h.annotationHits(searchCtx, input, filter, input.Limit*2)
+			if failure != nil {
+				return nil, failure
+			}
+			// both are ranked by BM25, the better of either go first
+			hits = append(hits, notes...)
+			slices.SortStableFunc(hits, func(a, b hit) int { return cmp.Compare(b.Score, a.Score) })
+		}
+		rankings = append(rankings, hits)
+	}
+	hits := rankings[0]
+	if len(rankings) > 1 {
+		hits = fuse(rankings...)
+	}
+	if rerank {
+		if hits, err = h.rerank(searchCtx, input.Query, hits, input.Limit*2); err != nil {
+			log.Println("Rerank Error:", err)
+			return nil, &apiFailure{Status: http.StatusBadGateway, Message: "Failed to rerank the results"}
+		}
+	}
+
+	results, err := h.resolve(ctx, userID, hits, input.Limit)
+	if err != nil {
+		log.Println("Search Lookup Error:", err)
+		return nil, &apiFailure{Status: http.StatusInternalServerError, Message: "Database error"}
+	}
+	terms := keyword.Terms(input.Query)
+	for i := range results {
+		results[i].Snippet, results[i].Highlights = highlight(results[i].text, terms, snippetLength)
+	}
+	return results, nil
+}
+
+func (h *SearchHandler) vectors() bool { return h.Embedder != nil && h.Index != nil }
+
+// defaultMode is vector unless only keyword search is on
+func (h *SearchHandler) defaultMode() string {
+	if !h.vectors() {
+		return SearchModeKeyword
+	}
+	return SearchModeVector
+}
+
+// Matches reports whether a document matches a saved search, for its alerts. Any keyword hit
+// counts, a vector one needs a similarity of minScore, a hybrid search takes either.
+func (h *SearchHandler) Matches(ctx context.Context, search models.SavedSearch, documentID string, minScore float64) (bool, error) {
+	f := search.Filters
+	if len(f.DocumentIDs) > 0 && !slices.Contains(f.DocumentIDs, documentID) {
+		return false, nil
+	}
+	input := SearchInput{
+		Query:       search.Query,
+		Limit:       1,
+		OrgID:       f.OrgID,
+		DocumentIDs: []string{documentID},
+		Tags:        f.Tags,
+		Languages:   f.Languages,
+		Entities:    f.Entities,
+	}
+
+	// the rank fused scores of hybrid say nothing on their own, each half is tried by itself
+	modes := []string{cmp.Or(f.Mode, h.defaultMode())}
+	if modes[0] == SearchModeHybrid {
+		modes = nil
+		if h.Keywords != nil {
+			modes = append(modes, SearchModeKeyword)
+		}
+		if h.vectors() {
+			modes = append(modes, SearchModeVector)
+		}
+	}
+	for _, mode := range modes {
+		input.Mode = mode
+		results, failure := h.run(ctx, search.UserID, input)
+		if failure != nil {
+			return false, fmt.Errorf("%d: %s", failure.Status, failure.Message)
+		}
+		if len(results) > 0 && (mode == SearchModeKeyword || float64(results[0].Score) >= minScore) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// vectorHits embeds the query and returns the limit closest chunks
+func (h *SearchHandler) vectorHits(ctx context.Context, input SearchInput, filter vectorstore.Filter, limit int) ([]hit, *apiFailure) {
+	index, model, err := liveIndex(ctx, h.Store, h.Index)
+	if err != nil {
+		return nil, &apiFailure{Status: http.StatusInternalServerError, Message: "Database error"}
+	}
+	// a language with a model of its own was indexed with it, the query has to be embedded the
+	// same way. An embedding migration re-embedded every language with its model.
+	if model == "" {
+		model = h.Embedder.DefaultModel()
+		if len(input.Languages) == 1 {
+			model = cmp.Or(h.LanguageModels[input.Languages[0]], model)
+		}
+	}
+	model = cmp.Or(input.EmbeddingModel, model)
+	vectors, err := h.Embedder.Embed(ctx, model, []string{input.Query})
+	if err != nil || len(vectors) != 1 {
+		log.Println("Query Embedding Error:", err)
+		return nil, &apiFailure{Status: http.StatusBadGateway, Message: "Failed to embed the query"}
+	}
+
+	matches, err := index.Search(ctx, vectors[0], filter, limit)
+	if err != nil {
+		log.Println("Vector Search Error:", err)
+		return nil, &apiFailure{Status: http.StatusBadGateway, Message: "Search failed"}
+	}
+	hits := make([]hit, len(matches))
+	for i, m := range matches {
+		p := m.Payload
+		hits[i] = hit{DocumentID: p.DocumentID, ChunkIndex: p.ChunkIndex, Page: p.Page, Start: p.Start, End: p.End, Heading: p.Heading, Language: p.Language, Text: p.Text, Score: m.Score}
+	}
+	return hits, nil
+}
+
+// rerank orders the first Rerank.Candidates hits, or limit when that is more, by the
+// reranker's scores. Those after them aren't scored and are dropped.
+func (h *SearchHandler) rerank(ctx context.Context, query string, hits []hit, limit int) ([]hit, error) {
+	hits = hits[:min(len(hits), max(h.Rerank.Candidates, limit))]
+	if len(hits) == 0 {
+		return hits, nil
+	}
+	texts := make([]string, len(hits))
+	for i, m := range hits {
+		texts[i] = m.Text
+	}
+	scores, err := h.Reranker.Rerank(ctx, query, texts)
+	if err != nil {
+		return nil, err
+	}
+	for i := range hits {
+		hits[i].Score = scores[i]
+	}
+	slices.SortStableFunc(hits, func(a, b hit) int { return cmp.Compare(b.Score, a.Score) })
+	return hits, nil
+}
+
+// annotationHits returns the limit annotations whose words match the query best
+func (h *SearchHandler) annotationHits(ctx context.Context, input SearchInput, filter vectorstore.Filter, limit int) ([]hit, *apiFailure) {
+	matches, err := h.Store.SearchAnnotations(ctx, keyword.Terms(input.Query), storage.ChunkFilter{
+		UserID:      filter.UserID,
+		OrgIDs:      filter.OrgIDs,
+		Shared:      filter.Shared,
+		DocumentIDs: filter.DocumentIDs,
+		Tags:        filter.Tags,
+		Languages:   filter.Languages,
+		Entities:    filter.Entities,
+	}, limit)
+	if err != nil {
+		log.Println("Annotation Search Error:", err)
+		return nil, &apiFailure{Status: http.StatusInternalServerError, Message: "Database error"}
+	}
+	hits := make([]hit, len(matches))
+	for i, m := range matches {
+		a := m.Annotation
+		hits[i] = hit{DocumentID: a.DocumentID, AnnotationID: a.ID, Page: a.Page, Start: a.Start, End: a.End, Text: cmp.Or(a.Body, a.Quote), Score: float32(m.Score)}
+	}
+	return hits, nil
+}
+
+// hit is a chunk one of the indexes found, or an annotation, not yet checked against the database
+type hit struct {
+	DocumentID   string
+	AnnotationID string
+	ChunkIndex   int
+	Page         int
+	Start        int
+	End          int
+	Heading      string
+	Language     string
+	Text         string
+	Score        float32
+}
+
+// fuse merges rankings by reciprocal rank fusion: a chunk gets 1/(rrfK+rank) from each ranking
+// it is in, summed. Cosine similarities and BM25 scores don't compare, their ranks do.
+func fuse(rankings ...[]hit) []hit {
+	type chunk struct {
+		documentID string
+		index      int
+		annotation string
+	}
+	fused := map[chunk]*hit{}
+	var order []chunk
+	for _, ranking := range rankings {
+		for rank, h := range ranking {
+			key := chunk{h.DocumentID, h.ChunkIndex, h.AnnotationID}
+			score := float32(1 / float64(rrfK+rank+1))
+			if f, ok := fused[key]; ok {
+				f.Score += score
+				f.Language = cmp.Or(f.Language, h.Language)
+				continue
+			}
+			h.Score = score
+			fused[key] = &h
+			order = append(order, key)
+		}
+	}
+
+	hits := make([]hit, len(order))
+	for i, key := range order {
+		hits[i] = *fused[key]
+	}
+	slices.SortStableFunc(hits, func(a, b hit) int { return cmp.Compare(b.Score, a.Score) })
+	return hits
+}
+
+// searchFilter works out which documents the caller may search. Those shared with them count
+// unless the search is narrowed to an organization.
+func (h *SearchHandler) searchFilter(ctx context.Context, userID int, input SearchInput) (vectorstore.Filter, *apiFailure) {
+	filter := vectorstore.Filter{DocumentIDs: input.DocumentIDs, Tags: input.Tags, Languages: input.Languages, Entities: input.Entities}
+
+	if input.OrgID != "" {
+		if _, failure := memberRole(ctx, h.Store, input.OrgID, userID); failure != nil {
+			return filter, failure
+		}
+		filter.OrgIDs = []string{input.OrgID}
+		return filter, nil
+	}
+
+	orgs, err := h.Store.ListOrgs(ctx, userID)
+	if err != nil {
+		return filter, &apiFailure{Status: http.StatusInternalServerError, Message: "Database error"}
+	}
+	filter.UserID = userID
+	for _, org := range orgs {
+		filter.OrgIDs = append(filter.OrgIDs, org.ID)
+	}
+	if filter.Shared, err = h.Store.ListSharedDocumentIDs(ctx, userID, maxSharedDocuments); err != nil {
+		return filter, &apiFailure{Status: http.StatusInternalServerError, Message: "Database error"}
+	}
+	return filter, nil
+}
+
+// resolve drops hits on documents the caller can no longer see and fills in their filenames
+func (h *SearchHandler) resolve(ctx context.Context, userID int, hits []hit, limit int) ([]SearchResult, error) {
+	docs := map[string]*models.Document{}
+	results := []SearchResult{}
+	for _, m := range hits {
+		if len(results) == limit {
+			break
+		}
+
+		id := m.DocumentID
+		doc, seen := docs[id]
+		if !seen {
+			found, err := h.Store.GetReadableDocument(ctx, id, userID)
+			if err != nil && !errors.Is(err, storage.ErrNotFound) {
+				return nil, err
+			}
+			if err == nil && found.ScanStatus != models.ScanStatusInfected {
+				doc = &found
+			}
+			docs[id] = doc
+		}
+		if doc == nil {
+			continue
+		}
+
+		result := SearchResult{
+			DocumentID:   id,
+			Filename:     doc.Filename,
+			OrgID:        doc.OrgID,
+			ChunkIndex:   m.ChunkIndex,
+			AnnotationID: m.AnnotationID,
+			Page:         m.Page,
+			Start:        m.Start,
+			End:          m.End,
+			Heading:      m.Heading,
+			Language:     cmp.Or(m.Language, doc.Language),
+			Score:        m.Score,
+			text:         m.Text,
+		}
+		if m.AnnotationID == "" {
+			result.ChunkID = chunkID(id, m.ChunkIndex)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// snippet shortens text to about n bytes, cutting at a space
+func snippet(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if len(text) <= n {
+		return text
+	}
+	cut := strings.LastIndexByte(text[:n], ' ')
+	if cut <= 0 {
+		cut = n
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+	}
+	return text[:cut] + "…"
+}
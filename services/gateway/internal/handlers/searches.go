@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const maxSearchNameLen = 100
+
+type SavedSearchHandler struct {
+	Store storage.Store
+}
+
+// Constructor for the saved search and search history endpoints
+func NewSavedSearchHandler(store storage.Store) *SavedSearchHandler {
+	return &SavedSearchHandler{Store: store}
+}
+
+// SavedSearchInput names a search to run again, filters are those POST /search takes
+type SavedSearchInput struct {
+	Name    string               `json:"name" binding:"required"`
+	Query   string               `json:"query" binding:"required"`
+	Filters models.SearchFilters `json:"filters"`
+	// Notify turns on alerts for documents processed from now on that match, by webhook
+	// (those subscribed to search.matched) and/or email
+	Notify []string `json:"notify"`
+}
+
+// SavedSearchPatch changes a saved search, whatever is left out stays
+type SavedSearchPatch struct {
+	Name    *string               `json:"name"`
+	Query   *string               `json:"query"`
+	Filters *models.SearchFilters `json:"filters"` // replaces all of them
+	Notify  *[]string             `json:"notify"`  // [] turns alerts off
+}
+
+var searchNotify = map[string]bool{
+	models.SearchNotifyWebhook: true,
+	models.SearchNotifyEmail:   true,
+}
+
+// --- GET /searches ---
+// The caller's saved searches by name and their recent queries, the newest first
+func (h *SavedSearchHandler) List(c *gin.Context) {
+	userID := middleware.UserID(c)
+	saved, err := h.Store.ListSavedSearches(c.Request.Context(), userID)
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	recent, err := h.Store.ListRecentSearches(c.Request.Context(), userID)
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"saved": saved, "recent": recent})
+}
+
+// --- POST /searches ---
+func (h *SavedSearchHandler) Create(c *gin.Context) {
+	var input SavedSearchInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Invalid(c, err)
+		return
+	}
+
+	now := time.Now().UTC()
+	search := models.SavedSearch{
+		ID:        "ss_" + uuid.NewString(),
+		UserID:    middleware.UserID(c),
+		Name:      input.Name,
+		Query:     input.Query,
+		Filters:   input.Filters,
+		Notify:    input.Notify,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if !h.validate(c, &search) {
+		return
+	}
+
+	err := h.Store.CreateSavedSearch(c.Request.Context(), search)
+	if errors.Is(err, storage.ErrDuplicate) {
+		apierror.Write(c, http.StatusConflict, "You already have a saved search with this name")
+		return
+	} else if err != nil {
+		log.Println("Saved Search Insert Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Failed to save the search")
+		return
+	}
+	c.JSON(http.StatusCreated, search)
+}
+
+// --- GET /searches/:id ---
+func (h *SavedSearchHandler) Get(c *gin.Context) {
+	search, ok := h.get(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, search)
+}
+
+// --- PATCH /searches/:id ---
+func (h *SavedSearchHandler) Update(c *gin.Context) {
+	var input SavedSearchPatch
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Invalid(c, err)
+		return
+	}
+	search, ok := h.get(c)
+	if !ok {
+		return
+	}
+
+	if input.Name != nil {
+		search.Name = *input.Name
+	}
+	if input.Query != nil {
+		search.Query = *input.Query
+	}
+	if input.Filters != nil {
+		search.Filters = *input.Filters
+	}
+	if input.Notify != nil {
+		search.Notify = *input.Notify
+	}
+	if !h.validate(c, &search) {
+		return
+	}
+
+	err := h.Store.UpdateSavedSearch(c.Request.Context(), search)
+	switch {
+	case errors.Is(err, storage.ErrDuplicate):
+		apierror.Write(c, http.StatusConflict, "You already have a saved search with this name")
+		return
+	case errors.Is(err, storage.ErrNotFound):
+		apierror.Write(c, http.StatusNotFound, "Saved search not found")
+		return
+	case err != nil:
+		log.Println("Saved Search Update Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	search.UpdatedAt = time.Now().UTC()
+	c.JSON(http.StatusOK, search)
+}
+
+// --- DELETE /searches/:id ---
+func (h *SavedSearchHandler) Delete(c *gin.Context) {
+	err := h.Store.DeleteSavedSearch(c.Request.Context(), c.Param("id"), middleware.UserID(c))
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Saved search not found")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Saved search deleted"})
+}
+
+// --- DELETE /searches/history ---
+func (h *SavedSearchHandler) ClearHistory(c *gin.Context) {
+	if err := h.Store.ClearSearchHistory(c.Request.Context(), middleware.UserID(c)); err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Search history cleared"})
+}
+
+func (h *SavedSearchHandler) get(c *gin.Context) (models.SavedSearch, bool) {
+	search, err := h.Store.GetSavedSearch(c.Request.Context(), c.Param("id"), middleware.UserID(c))
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Saved search not found")
+		return search, false
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return search, false
+	}
+	return search, true
+}
+
+// validate normalizes a saved search the way /search would its query and filters, writing the
+// error response when one of them is off
+func (h *SavedSearchHandler) validate(c *gin.Context, search *models.SavedSearch) bool {
+	search.Name = strings.TrimSpace(search.Name)
+	if search.Name == "" || len(search.Name) > maxSearchNameLen {
+		apierror.Field(c, "name", fmt.Sprintf("name must be 1 to %d characters", maxSearchNameLen))
+		return false
+	}
+	search.Query = strings.TrimSpace(search.Query)
+	if search.Query == "" {
+		apierror.Field(c, "query", "query is required")
+		return false
+	}
+
+	f := &search.Filters
+	switch f.Mode {
+	case "", SearchModeVector, SearchModeKeyword, SearchModeHybrid:
+	default:
+		apierror.Field(c, "filters.mode", "mode must be vector, keyword or hybrid")
+		return false
+	}
+	if f.OrgID != "" {
+		if _, failure := memberRole(c.Request.Context(), h.Store, f.OrgID, search.UserID); failure != nil {
+			failure.respond(c)
+			return false
+		}
+	}
+	var err error
+	if f.Tags, err = normalizeTags(f.Tags); err != nil {
+		apierror.Field(c, "filters.tags", err.Error())
+		return false
+	}
+	if f.Languages, err = normalizeLanguages(f.Languages); err != nil {
+		apierror.Field(c, "filters.languages", err.Error())
+		return false
+	}
+	if f.Entities, err = normalizeEntities(f.Entities); err != nil {
+		apierror.Field(c, "filters.entities", err.Error())
+		return false
+	}
+
+	notify := []string{}
+	for _, channel := range search.Notify {
+		if !searchNotify[channel] {
+			apierror.Field(c, "notify", "notify takes webhook and email, not "+channel)
+			return false
+		}
+		if !slices.Contains(notify, channel) {
+			notify = append(notify, channel)
+		}
+	}
+	search.Notify = notify
+	return true
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/metrics"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+type SessionHandler struct {
+	Store storage.Store
+}
+
+// Constructor for the session management endpoints
+func NewSessionHandler(store storage.Store) *SessionHandler {
+	return &SessionHandler{Store: store}
+}
+
+// --- GET /me/sessions ---
+// Every login that can still be refreshed, the one making the request marked current
+func (h *SessionHandler) List(c *gin.Context) {
+	sessions, err := h.Store.ListSessions(c.Request.Context(), middleware.UserID(c))
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	current := middleware.SessionID(c)
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// --- DELETE /me/sessions/:id ---
+// Logs one session out, its access and refresh tokens stop working right away
+func (h *SessionHandler) Revoke(c *gin.Context) {
+	id := c.Param("id")
+	err := h.Store.RevokeSession(c.Request.Context(), id, middleware.UserID(c))
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Session not found")
+		return
+	} else if err != nil {
+		log.Println("Session Revocation Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	audit(c, h.Store, models.AuditSessionRevoked, "session "+id)
+	metrics.Auth("logout", true)
+	c.JSON(http.StatusOK, gin.H{"message": "Session logged out"})
+}
+
+// --- DELETE /me/sessions ---
+// Logs out everywhere, the session making the request included
+func (h *SessionHandler) RevokeAll(c *gin.Context) {
+	n, err := h.Store.RevokeAllSessions(c.Request.Context(), middleware.UserID(c), "")
+	if err != nil {
+		log.Println("Session Revocation Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	audit(c, h.Store, models.AuditSessionRevoked, fmt.Sprintf("all %d sessions", n))
+	metrics.Auth("logout", true)
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out everywhere", "sessions": n})
+}
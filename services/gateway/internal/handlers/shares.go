@@ -0,0 +1,486 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// share links work for a week unless asked otherwise, three months at most
+	defaultShareLinkHours = 7 * 24
+	maxShareLinkHours     = 90 * 24
+	// bcrypt only looks at the first 72 bytes of a password
+	maxShareLinkPassword = 72
+	// maxSharedListing caps how many documents of a collection GET /shared/:token lists
+	maxSharedListing = 1000
+	// sharePasswordHeader carries the password of a share link that has one
+	sharePasswordHeader = "X-Share-Password"
+)
+
+var sharePermissions = map[string]bool{
+	models.PermissionRead:    true,
+	models.PermissionComment: true,
+}
+
+type ShareHandler struct {
+	Store     storage.Store
+	Documents *DocumentHandler
+	// guard throttles guessing the passwords of share links, like it does logins
+	guard *loginGuard
+}
+
+// Constructor for the sharing endpoints, share links hand out downloads the way the document endpoints do
+func NewShareHandler(store storage.Store, documents *DocumentHandler, login config.Login) *ShareHandler {
+	return &ShareHandler{Store: store, Documents: documents, guard: newLoginGuard(store, login)}
+}
+
+// ShareInput shares a document or a collection, one of DocumentID and CollectionID, with the
+// user whose account is Email
+type ShareInput struct {
+	DocumentID   string `json:"document_id"`
+	CollectionID string `json:"collection_id"`
+	Email        string `json:"email" binding:"required"`
+	// Permission is read, the default, or comment
+	Permission string `json:"permission"`
+}
+
+// --- POST /shares ---
+// Shares a document or collection with another user, who can then read, download, search and
+// chat with it. Sharing it with them again changes the permission. Whoever may change the
+// document or collection may share it: its uploader or creator, and its organization's members
+// who aren't viewers.
+func (h *ShareHandler) Create(c *gin.Context) {
+	var input ShareInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Invalid(c, err)
+		return
+	}
+	if input.Permission == "" {
+		input.Permission = models.PermissionRead
+	}
+	if !sharePermissions[input.Permission] {
+		apierror.Field(c, "permission", "permission must be read or comment")
+		return
+	}
+	addr, err := mail.ParseAddress(input.Email)
+	if err != nil {
+		apierror.Field(c, "email", "email must be a valid email address")
+		return
+	}
+	if !h.manage(c, input.DocumentID, input.CollectionID) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	user, err := h.Store.GetUserByEmail(ctx, strings.ToLower(addr.Address))
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && user.DeletedAt != nil) {
+		apierror.Write(c, http.StatusNotFound, "There is no user with that email, they have to sign up first")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	userID := middleware.UserID(c)
+	if user.ID == userID {
+		apierror.Write(c, http.StatusBadRequest, "You can't share with yourself")
+		return
+	}
+
+	share, err := h.Store.SaveShare(ctx, models.Share{
+		ID:           "shr_" + uuid.NewString(),
+		DocumentID:   input.DocumentID,
+		CollectionID: input.CollectionID,
+		UserID:       user.ID,
+		Permission:   input.Permission,
+		CreatedBy:    userID,
+	})
+	if err != nil {
+		log.Println("Share Insert Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Failed to share")
+		return
+	}
+	h.audit(c, share.DocumentID, share.CollectionID, fmt.Sprintf("shared with %s to %s", share.Email, share.Permission))
+	c.JSON(http.StatusCreated, share)
+}
+
+// --- GET /shares ---
+// What others shared with the caller, or with ?document_id= or ?collection_id= who a document or
+// collection the caller may share is shared with
+func (h *ShareHandler) List(c *gin.Context) {
+	documentID, collectionID := c.Query("document_id"), c.Query("collection_id")
+	var shares []models.Share
+	var err error
+	if documentID == "" && collectionID == "" {
+		shares, err = h.Store.ListReceivedShares(c.Request.Context(), middleware.UserID(c))
+	} else {
+		if !h.manage(c, documentID, collectionID) {
+			return
+		}
+		shares, err = h.Store.ListShares(c.Request.Context(), documentID, collectionID)
+	}
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"shares": shares})
+}
+
+// --- DELETE /shares/:id ---
+// Whoever may share the document or collection can take the share back, and whoever it was
+// shared with can give it up
+func (h *ShareHandler) Delete(c *gin.Context) {
+	share, err := h.Store.GetShare(c.Request.Context(), c.Param("id"))
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Share not found")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if share.UserID != middleware.UserID(c) && !h.manage(c, share.DocumentID, share.CollectionID) {
+		return
+	}
+
+	err = h.Store.DeleteShare(c.Request.Context(), share.ID)
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Share not found")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Share deleted"})
+}
+
+// ShareLinkInput makes a public link to a document or a collection, one of DocumentID and CollectionID
+type ShareLinkInput struct {
+	DocumentID   string `json:"document_id"`
+	CollectionID string `json:"collection_id"`
+	// ExpiresInHours is how long the link works, a week by default
+	ExpiresInHours int `json:"expires_in_hours"`
+	// Password has to be sent along to open the link when it is set
+	Password string `json:"password"`
+}
+
+// --- POST /share-links ---
+// A link anyone can open without an account until it expires, with the password if it has one.
+// The token is only returned here. Who may make one is who may share, and a link stops working
+// once its creator can no longer read what it points at.
+func (h *ShareHandler) CreateLink(c *gin.Context) {
+	var input ShareLinkInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Invalid(c, err)
+		return
+	}
+	if input.ExpiresInHours == 0 {
+		input.ExpiresInHours = defaultShareLinkHours
+	}
+	if input.ExpiresInHours < 1 || input.ExpiresInHours > maxShareLinkHours {
+		apierror.Field(c, "expires_in_hours", "expires_in_hours must be between 1 and 2160")
+		return
+	}
+	if len(input.Password) > maxShareLinkPassword {
+		apierror.Field(c, "password", "password must be at most 72 bytes")
+		return
+	}
+	if !h.manage(c, input.DocumentID, input.CollectionID) {
+		return
+	}
+
+	token := newOpaqueToken()
+	now := time.Now().UTC().Truncate(time.Second)
+	link := models.ShareLink{
+		ID:           "lnk_" + uuid.NewString(),
+		DocumentID:   input.DocumentID,
+		CollectionID: input.CollectionID,
+		Token:        token,
+		URL:          h.Documents.BaseURL + "/shared/" + url.PathEscape(token),
+		HasPassword:  input.Password != "",
+		ExpiresAt:    now.Add(time.Duration(input.ExpiresInHours) * time.Hour),
+		CreatedBy:    middleware.UserID(c),
+		CreatedAt:    now,
+	}
+	if link.HasPassword {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+		if err != nil {
+			apierror.Write(c, http.StatusInternalServerError, "Failed to create share link")
+			return
+		}
+		link.PasswordHash = string(hashed)
+	}
+
+	if err := h.Store.CreateShareLink(c.Request.Context(), link, middleware.HashAPIKey(token)); err != nil {
+		log.Println("Share Link Insert Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Failed to create share link")
+		return
+	}
+	h.audit(c, link.DocumentID, link.CollectionID, fmt.Sprintf("share link %s made, expiring %s", link.ID, link.ExpiresAt.Format(time.RFC3339)))
+	c.JSON(http.StatusCreated, link)
+}
+
+// --- GET /share-links?document_id=|collection_id= ---
+// The links to a document or collection, expired ones too, without their tokens
+func (h *ShareHandler) ListLinks(c *gin.Context) {
+	documentID, collectionID := c.Query("document_id"), c.Query("collection_id")
+	if !h.manage(c, documentID, collectionID) {
+		return
+	}
+	links, err := h.Store.ListShareLinks(c.Request.Context(), documentID, collectionID)
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"share_links": links})
+}
+
+// --- DELETE /share-links/:id ---
+func (h *ShareHandler) DeleteLink(c *gin.Context) {
+	link, err := h.Store.GetShareLink(c.Request.Context(), c.Param("id"))
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Share link not found")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if !h.manage(c, link.DocumentID, link.CollectionID) {
+		return
+	}
+
+	err = h.Store.DeleteShareLink(c.Request.Context(), link.ID)
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Share link not found")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Share link deleted"})
+}
+
+// SharedDocument is what a share link shows of a document
+type SharedDocument struct {
+	ID          string    `json:"id"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func sharedDocument(doc models.Document) SharedDocument {
+	return SharedDocument{ID: doc.ID, Filename: doc.Filename, ContentType: doc.ContentType, Size: doc.Size, CreatedAt: doc.CreatedAt}
+}
+
+// --- GET /shared/:token ---
+// What a share link points at, without credentials: the document, or the collection with the
+// documents in it and its sub-collections. A link with a password needs it in X-Share-Password.
+func (h *ShareHandler) Open(c *gin.Context) {
+	link, doc, ok := h.openLink(c)
+	if !ok {
+		return
+	}
+	if link.DocumentID != "" {
+		c.JSON(http.StatusOK, gin.H{"expires_at": link.ExpiresAt, "document": sharedDocument(doc)})
+		return
+	}
+
+	col, err := h.Store.GetCollectionByID(c.Request.Context(), link.CollectionID)
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	docs, err := h.Store.ListCollectionDocuments(c.Request.Context(), link.CollectionID, maxSharedListing)
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	listed := []SharedDocument{}
+	for _, d := range docs {
+		if d.ScanStatus != models.ScanStatusInfected {
+			listed = append(listed, sharedDocument(d))
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"expires_at": link.ExpiresAt,
+		"collection": gin.H{"id": col.ID, "name": col.Name},
+		"documents":  listed,
+	})
+}
+
+// --- GET /shared/:token/download ---
+// A short-lived download URL for the linked document, or with ?document_id= for one in the
+// linked collection, the same kind GET /documents/:id/download hands out
+func (h *ShareHandler) Download(c *gin.Context) {
+	link, doc, ok := h.openLink(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	if link.CollectionID != "" {
+		documentID := c.Query("document_id")
+		if documentID == "" {
+			apierror.Field(c, "document_id", "document_id is required for a link to a collection")
+			return
+		}
+		in, err := h.Store.InCollection(ctx, documentID, link.CollectionID)
+		if err != nil {
+			apierror.Write(c, http.StatusInternalServerError, "Database error")
+			return
+		}
+		if in {
+			doc, err = h.Store.GetDocument(ctx, documentID, link.CreatedBy)
+		}
+		if !in || errors.Is(err, storage.ErrNotFound) {
+			apierror.Write(c, http.StatusNotFound, "Document not found")
+			return
+		} else if err != nil {
+			apierror.Write(c, http.StatusInternalServerError, "Database error")
+			return
+		}
+	}
+	if doc.ScanStatus == models.ScanStatusInfected {
+		apierror.Write(c, http.StatusForbidden, "Document is quarantined, malware detected: "+doc.ScanResult)
+		return
+	}
+
+	// an encrypted document's link streams it for the creator, whose access is checked again then
+	downloadURL, err := h.Documents.downloadURL(ctx, doc, link.CreatedBy)
+	if err != nil {
+		log.Println("Download Link Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Failed to generate download link")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"url":        downloadURL,
+		"expires_at": time.Now().Add(h.Documents.DownloadURLTTL).UTC(),
+	})
+}
+
+// openLink finds the share link of the request and checks its password, writing the error
+// response when it can't be opened. A link to a document comes with the document.
+func (h *ShareHandler) openLink(c *gin.Context) (models.ShareLink, models.Document, bool) {
+	var doc models.Document
+	ctx := c.Request.Context()
+	link, err := h.Store.GetShareLinkByHash(ctx, middleware.HashAPIKey(c.Param("token")))
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Share link not found")
+		return link, doc, false
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return link, doc, false
+	}
+	if time.Now().After(link.ExpiresAt) {
+		apierror.Write(c, http.StatusGone, "Share link expired")
+		return link, doc, false
+	}
+	if link.HasPassword {
+		password := c.GetHeader(sharePasswordHeader)
+		if password == "" {
+			apierror.Write(c, http.StatusUnauthorized, "This share link needs its password in "+sharePasswordHeader)
+			return link, doc, false
+		}
+		// too many wrong passwords for this link, make them wait before even checking this one
+		wait, locked, err := h.guard.waitLink(ctx, link.ID)
+		if err != nil {
+			apierror.Write(c, http.StatusInternalServerError, "Database error")
+			return link, doc, false
+		}
+		if wait > 0 {
+			msg := "Too many wrong share link passwords, try again later"
+			if locked {
+				msg = "Share link temporarily locked after too many wrong passwords"
+			}
+			f := &apiFailure{Status: http.StatusTooManyRequests, Message: msg, RetryAfter: wait}
+			f.respond(c)
+			return link, doc, false
+		}
+		if bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(password)) != nil {
+			h.guard.failLink(ctx, link.ID, c.ClientIP(), link.CreatedBy)
+			apierror.Write(c, http.StatusUnauthorized, "Wrong share link password")
+			return link, doc, false
+		}
+		h.guard.succeedLink(ctx, link.ID)
+	}
+
+	// the link goes as far as its creator's access, one who left the organization took it along
+	if link.DocumentID != "" {
+		doc, err = h.Store.GetDocument(ctx, link.DocumentID, link.CreatedBy)
+	} else {
+		_, err = h.Store.GetCollection(ctx, link.CollectionID, link.CreatedBy)
+	}
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Share link not found")
+		return link, doc, false
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return link, doc, false
+	}
+	return link, doc, true
+}
+
+// audit records a share in the activity of the document, or of the collection's organization
+func (h *ShareHandler) audit(c *gin.Context, documentID, collectionID, detail string) {
+	if documentID != "" {
+		auditDocument(c, h.Store, models.AuditDocumentShared, documentID, detail)
+		return
+	}
+	col, err := h.Store.GetCollectionByID(c.Request.Context(), collectionID)
+	if err != nil {
+		log.Println("Failed to write audit entry:", err)
+		return
+	}
+	userID := middleware.UserID(c)
+	entry := models.AuditEntry{UserID: &userID, Event: models.AuditCollectionShared, IP: c.ClientIP(), Detail: "collection " + col.ID + " " + detail, OrgID: col.OrgID}
+	if err := h.Store.CreateAuditEntry(c.Request.Context(), entry); err != nil {
+		log.Println("Failed to write audit entry:", err)
+	}
+}
+
+// manage checks the caller may share the document or collection, exactly one of the IDs, and
+// writes the error response when they may not
+func (h *ShareHandler) manage(c *gin.Context, documentID, collectionID string) bool {
+	if (documentID == "") == (collectionID == "") {
+		apierror.Write(c, http.StatusBadRequest, "Give one of document_id and collection_id")
+		return false
+	}
+	if collectionID != "" {
+		_, ok := getCollection(c, h.Store, collectionID, true)
+		return ok
+	}
+
+	userID := middleware.UserID(c)
+	doc, err := h.Store.GetDocument(c.Request.Context(), documentID, userID)
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Document not found")
+		return false
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return false
+	}
+	if doc.UserID != userID {
+		role, ok := orgRole(c, h.Store, doc.OrgID)
+		if !ok {
+			return false
+		}
+		if !canUpload(role) {
+			apierror.Write(c, http.StatusForbidden, "Viewers can't share this organization's documents")
+			return false
+		}
+	}
+	return true
+}
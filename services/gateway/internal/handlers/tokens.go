@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour
+	// user agents longer than this are cut, they are only there to tell sessions apart
+	maxUserAgent = 512
+)
+
+// tokenPair is what login and refresh hand back to the client
+type tokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"` // seconds until the access token expires
+}
+
+// signAccessToken gives every token its own jti so a single one can be revoked on logout,
+// and the sid of its session so logging that out revokes them all
+func signAccessToken(userID int, sessionID string) (string, error) {
+	return middleware.SignToken(jwt.MapClaims{
+		"sub": userID,
+		"jti": uuid.NewString(),
+		"sid": sessionID,
+		"exp": time.Now().Add(accessTokenTTL).Unix(),
+	})
+}
+
+// hashToken is used so a leaked DB doesn't leak usable refresh tokens
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newOpaqueToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// issueTokens starts a new session, the user agent and IP tell it apart from the others in
+// GET /me/sessions. Used on login.
+func issueTokens(ctx context.Context, store storage.TokenStore, userID int, userAgent, ip string) (tokenPair, error) {
+	userAgent = strings.ToValidUTF8(userAgent, "")
+	if len(userAgent) > maxUserAgent {
+		userAgent = strings.ToValidUTF8(userAgent[:maxUserAgent], "")
+	}
+	session := models.Session{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		UserAgent: userAgent,
+		IP:        ip,
+		ExpiresAt: time.Now().Add(refreshTokenTTL),
+	}
+
+	access, err := signAccessToken(userID, session.ID)
+	if err != nil {
+		return tokenPair{}, err
+	}
+
+	refresh := newOpaqueToken()
+	if err := store.CreateSession(ctx, session, hashToken(refresh)); err != nil {
+		return tokenPair{}, err
+	}
+
+	return tokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		ExpiresIn:    int(accessTokenTTL.Seconds()),
+	}, nil
+}
+
+// rotateRefreshToken swaps a valid refresh token for a new pair.
+// Presenting a token that was already rotated means someone else has a copy,
+// so the store revokes the whole family and both parties have to log in again.
+func rotateRefreshToken(ctx context.Context, store storage.TokenStore, refresh string) (tokenPair, error) {
+	next := newOpaqueToken()
+	userID, sessionID, err := store.RotateRefreshToken(ctx, hashToken(refresh), hashToken(next), time.Now().Add(refreshTokenTTL))
+	if err != nil {
+		return tokenPair{}, err
+	}
+
+	access, err := signAccessToken(userID, sessionID)
+	if err != nil {
+		return tokenPair{}, err
+	}
+
+	return tokenPair{
+		AccessToken:  access,
+		RefreshToken: next,
+		ExpiresIn:    int(accessTokenTTL.Seconds()),
+	}, nil
+}
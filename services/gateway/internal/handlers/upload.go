@@ -1,82 +1,237 @@
 package handlers
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
-	"os"
-	"path/filepath"
+	"strconv"
 	"time"
 
-	"github.com/dhruvkshah75/docstream/gateway/internal/producer"
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/breaker"
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+	"github.com/dhruvkshah75/docstream/gateway/internal/envelope"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/objectstore"
+	"github.com/dhruvkshah75/docstream/gateway/internal/queue"
+	"github.com/dhruvkshah75/docstream/gateway/internal/scanner"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
 	"github.com/gin-gonic/gin"
-	"github.com/minio/minio-go/v7"
-	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/google/uuid"
 )
 
 
 
-func UploadHandler(minioClient *minio.Client, ch *amqp.Channel, q amqp.Queue) gin.HandlerFunc {
+func UploadHandler(store storage.Store, objects objectstore.Store, keys *envelope.Keyring, publisher queue.Publisher, virusScanner *scanner.Scanner, cfg *config.Config) gin.HandlerFunc {
+	rules := newUploadRules(cfg)
+	in := ingester{store: store, objects: objects, keys: keys, publisher: publisher, scanner: virusScanner, rules: rules, kind: "single"}
+	// archives that are expanded go in as a batch of their files
+	archives := NewBatchHandler(store, objects, keys, publisher, virusScanner, cfg)
+	archives.ingest.kind = "archive"
+
 	// gin.HandlerFunc handles HTTP request
 	return func(c *gin.Context) {
+		// Refuse oversized uploads before reading the body, not after it has been streamed to storage
+		if !rules.limitBody(c, rules.maxSize+multipartOverhead) {
+			return
+		}
+
 		// check if the file exists or not in request 
 		file, err := c.FormFile("file")
+		if isTooLarge(err) {
+			apierror.Write(c, http.StatusRequestEntityTooLarge, rules.tooLargeError())
+			return
+		}
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+			apierror.Write(c, http.StatusBadRequest, "No file uploaded")
 			return;
 		}
+		if file.Size > rules.maxSize {
+			apierror.Write(c, http.StatusRequestEntityTooLarge, rules.tooLargeError())
+			return
+		}
 
 		// Open the file stream
 		src, err := file.Open()
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to open file"})
+			apierror.Write(c, http.StatusInternalServerError, "Unable to open file")
+			return
 		}
 		defer src.Close()
 
-		// Upload to MinIO which is Object Storage Server 
-		// Create a unique filename: timestamp_originalName.pdf
-		fileName := fmt.Sprintf("%d_%s", time.Now().Unix(), filepath.Base(file.Filename))
-		bucketName := os.Getenv("MINIO_BUCKET_NAME")
-
-		// Stream directly to MinIO (effiecient for large files)
-		info, err := minioClient.PutObject(context.Background(), bucketName, fileName, src, file.Size, minio.PutObjectOptions{
-				ContentType: "application/pdf",
-		})
-		if err != nil {
-			log.Println("MinIO Upload Error:", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload to MinIO storage server"})
+		target, ok := formTarget(c, store)
+		if !ok {
 			return
 		}
 
-		// Create Job Payload 
-		// This is the "Ticket" we send to the Worker
-		jobPayload := map[string]interface{}{
-			"job_id": fmt.Sprintf("job_%d", time.Now().Unix()),
-			"filename": fileName,
-			"bucket": bucketName,
-			"file_size": info.Size,
-			"status": "pending",
-			"timestamp": time.Now().Unix(),
+		// With expand a zip or tar(.gz) becomes a collection of the files in it
+		if expand, _ := strconv.ParseBool(c.PostForm("expand")); expand {
+			head := make([]byte, sniffLen)
+			n, _ := io.ReadFull(src, head)
+			if format := archiveFormat(head[:n], file.Filename); format != "" {
+				archives.expand(c, target, file.Filename, src, file.Size, format)
+				return
+			}
+			if _, err := src.Seek(0, io.SeekStart); err != nil {
+				apierror.Write(c, http.StatusInternalServerError, "Unable to read file")
+				return
+			}
 		}
 
-		body, _ := json.Marshal(jobPayload)
-
-		// Publish to RabbitMQ using the helper func made 
-		err = producer.PublishJob(ch, q, body)
-		if err != nil {
-			log.Println("Queue Error: ", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue job"})
+		// Sniff, hash, store, scan and queue it
+		result, failure := in.ingest(c.Request.Context(), target, file.Filename, src, file.Size)
+		if failure != nil {
+			failure.respond(c)
+			return
+		}
+		if result.Duplicate {
+			respondDuplicate(c, result.Document, result.JobID)
 			return
 		}
 
 		// Success response 
 		c.JSON(http.StatusOK, gin.H{
-			"message": "File uploaded and processing started",
-			"job_id":  jobPayload["job_id"],
-			"file_id": info.Key,
+			"message":     "File uploaded and processing started",
+			"job_id":      result.JobID,
+			"document_id": result.Document.ID,
+			"file_id":     result.Document.ObjectKey,
 		})
 
 	}
 }
+
+// scanUpload runs the virus scan on a freshly stored document, writing the error response when it doesn't pass
+func scanUpload(c *gin.Context, store storage.DocumentStore, virusScanner *scanner.Scanner, doc models.Document) bool {
+	if f := scanDocument(c.Request.Context(), store, virusScanner, doc); f != nil {
+		f.respond(c)
+		return false
+	}
+	return true
+}
+
+// enqueueJob creates a job for a stored document and hands it to the worker, options may be nil for the defaults.
+// Whatever options leave unset comes from the document's collection when it is in one, then the uploader's preferences.
+func enqueueJob(ctx context.Context, store storage.Store, publisher queue.Publisher, doc models.Document, options *models.JobOptions) (string, error) {
+	// once an embedding migration completed, jobs index into its collection
+	current, err := store.CurrentEmbeddingMigration(ctx)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return "", fmt.Errorf("loading the embedding migration: %w", err)
+	}
+	return queueJob(ctx, store, publisher, doc, options, current)
+}
+
+// queueJob queues doc into target's collection, embedded with its model unless the options pick
+// another. The zero target is the worker's configured collection and model.
+func queueJob(ctx context.Context, store storage.Store, publisher queue.Publisher, doc models.Document, options *models.JobOptions, target models.EmbeddingMigration) (string, error) {
+	options, err := defaultOptions(ctx, store, doc, options)
+	if err != nil {
+		return "", fmt.Errorf("loading default options: %w", err)
+	}
+	if target.Collection != "" {
+		if options == nil {
+			options = &models.JobOptions{}
+		}
+		options.EmbeddingModel = cmp.Or(options.EmbeddingModel, target.EmbeddingModel)
+	}
+
+	// Create Job Payload 
+	// This is the "Ticket" we send to the Worker
+	jobID := "job_" + uuid.NewString()
+	jobPayload := map[string]interface{}{
+		"job_id":      jobID,
+		"document_id": doc.ID,
+		"user_id":     doc.UserID,
+		"filename":    doc.ObjectKey,
+		"bucket":      doc.Bucket,
+		"file_size":   doc.Size,
+		"status":      models.JobStatusPending,
+		"timestamp":   time.Now().Unix(),
+	}
+	if doc.OrgID != "" {
+		jobPayload["org_id"] = doc.OrgID
+	}
+	// the worker copies these onto the vectors so searches can filter on them
+	if len(doc.Tags) > 0 {
+		jobPayload["tags"] = doc.Tags
+	}
+	if len(doc.Metadata) > 0 {
+		jobPayload["metadata"] = doc.Metadata
+	}
+	if options != nil {
+		jobPayload["options"] = options
+	}
+	if target.Collection != "" {
+		jobPayload["collection"] = target.Collection
+	}
+	// the worker unwraps it to decrypt the object, without a master key it is no use to anyone
+	if doc.EncryptionKey != "" {
+		jobPayload["encryption_key"] = doc.EncryptionKey
+	}
+	// its points take the place of the indexed ones as it goes, cancelling it mustn't delete them
+	indexed, err := store.HasCompletedJob(ctx, doc.ID, target.Collection)
+	if err != nil {
+		return "", fmt.Errorf("looking up earlier jobs: %w", err)
+	}
+	if indexed {
+		jobPayload["replaces_index"] = true
+	}
+	// the worker checks what it downloads against it, a corrupted object fails the job
+	// instead of being embedded
+	if doc.SHA256 != "" {
+		jobPayload["sha256"] = doc.SHA256
+	}
+
+	// Persist the job before publishing so the worker can never report on a job we don't know about
+	job := models.Job{
+		ID:         jobID,
+		UserID:     &doc.UserID,
+		DocumentID: doc.ID,
+		Filename:   doc.ObjectKey,
+		Bucket:     doc.Bucket,
+		SHA256:     doc.SHA256,
+		Status:     models.JobStatusPending,
+		Options:    options,
+		Collection: target.Collection,
+	}
+	if err := store.CreateJob(ctx, job); err != nil {
+		return "", fmt.Errorf("recording job: %w", err)
+	}
+
+	body, _ := json.Marshal(jobPayload)
+
+	// Publish to the queue, this waits for the broker to confirm
+	if err := publisher.PublishJob(ctx, doc.ID, body); err != nil {
+		setJobStatus(ctx, store, jobID, models.JobStatusFailed, "failed to queue job")
+		return "", err
+	}
+	setJobStatus(ctx, store, jobID, models.JobStatusQueued, "")
+	return jobID, nil
+}
+
+// respondQueueError answers a failed enqueueJob, with a 503 while the queue is down so the client knows to retry
+func respondQueueError(c *gin.Context, err error) {
+	log.Println("Queue Error: ", err)
+	if queueDown(err) {
+		middleware.Unavailable(c, "Queue")
+		return
+	}
+	apierror.Write(c, http.StatusInternalServerError, "Failed to queue job")
+}
+
+// queueDown tells a publish that failed because the broker is unreachable from one it rejected
+func queueDown(err error) bool {
+	return errors.Is(err, queue.ErrNotConnected) || errors.Is(err, breaker.ErrOpen)
+}
+
+// setJobStatus moves a job (and its document) to a new status, only logging on failure since the caller has already responded or is about to
+func setJobStatus(ctx context.Context, store storage.JobStore, jobID, status, errMsg string) {
+	if _, err := store.UpdateJobStatus(ctx, jobID, status, errMsg); err != nil {
+		log.Printf("Failed to update job %s to %s: %v\n", jobID, status, err)
+	}
+}
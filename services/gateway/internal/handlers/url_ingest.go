@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+	"github.com/dhruvkshah75/docstream/gateway/internal/envelope"
+	"github.com/dhruvkshah75/docstream/gateway/internal/fetcher"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/objectstore"
+	"github.com/dhruvkshah75/docstream/gateway/internal/queue"
+	"github.com/dhruvkshah75/docstream/gateway/internal/scanner"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// URLIngestHandler downloads documents server-side, so a public PDF doesn't have to pass through the client
+type URLIngestHandler struct {
+	Store   storage.Store
+	Fetcher *fetcher.Fetcher
+	ingest  ingester
+}
+
+// Constructor for the URL ingest endpoint
+func NewURLIngestHandler(store storage.Store, objects objectstore.Store, keys *envelope.Keyring, publisher queue.Publisher, virusScanner *scanner.Scanner, cfg *config.Config) *URLIngestHandler {
+	return &URLIngestHandler{
+		Store:   store,
+		Fetcher: fetcher.New(cfg.URLIngest),
+		ingest:  ingester{store: store, objects: objects, keys: keys, publisher: publisher, scanner: virusScanner, rules: newUploadRules(cfg), kind: "url"},
+	}
+}
+
+type IngestURLInput struct {
+	URL string `json:"url" binding:"required"`
+	// the rest works like the fields of POST /upload
+	OrgID        string            `json:"org_id"`
+	CollectionID string            `json:"collection_id"`
+	Tags         []string          `json:"tags"`
+	Metadata     map[string]string `json:"metadata"`
+	// EmbeddingModel and SummaryModel pick allowed models over the defaults, see GET /models
+	EmbeddingModel string `json:"embedding_model"`
+	SummaryModel   string `json:"summary_model"`
+}
+
+// --- POST /ingest/url ---
+// Downloads the URL and takes it in like an upload, under the same size and type limits.
+// Only public addresses are fetched, redirects included.
+func (h *URLIngestHandler) Ingest(c *gin.Context) {
+	var input IngestURLInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Invalid(c, err)
+		return
+	}
+
+	target := uploadTarget{UserID: middleware.UserID(c), OrgID: input.OrgID, CollectionID: input.CollectionID, Metadata: input.Metadata,
+		Options: pickedModels(input.EmbeddingModel, input.SummaryModel)}
+	if !target.allowed(c, h.Store) {
+		return
+	}
+	tags, err := normalizeTags(input.Tags)
+	if err != nil {
+		apierror.Field(c, "tags", err.Error())
+		return
+	}
+	target.Tags = tags
+	if err := validateMetadata(input.Metadata); err != nil {
+		apierror.Field(c, "metadata", err.Error())
+		return
+	}
+
+	file, err := h.Fetcher.Fetch(c.Request.Context(), input.URL, h.ingest.rules.maxSize)
+	if err != nil {
+		h.respondFetchError(c, input.URL, err)
+		return
+	}
+	defer file.Close()
+
+	// Sniff, hash, store, scan and queue it
+	result, failure := h.ingest.ingest(c.Request.Context(), target, file.Filename, file, file.Size)
+	if failure != nil {
+		failure.respond(c)
+		return
+	}
+	if result.Duplicate {
+		respondDuplicate(c, result.Document, result.JobID)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "URL downloaded and processing started",
+		"job_id":      result.JobID,
+		"document_id": result.Document.ID,
+		"file_id":     result.Document.ObjectKey,
+		"filename":    result.Document.Filename,
+	})
+}
+
+// respondFetchError tells the caller's mistakes apart from the remote server's
+func (h *URLIngestHandler) respondFetchError(c *gin.Context, rawURL string, err error) {
+	var status *fetcher.StatusError
+	switch {
+	// the HTTP client wraps these in a *url.Error, only the reason is for the caller
+	case errors.Is(err, fetcher.ErrInvalidURL):
+		apierror.Field(c, "url", fetcher.ErrInvalidURL.Error())
+	case errors.Is(err, fetcher.ErrBlocked):
+		apierror.Field(c, "url", fetcher.ErrBlocked.Error())
+	case errors.Is(err, fetcher.ErrTooManyRedirects):
+		apierror.Field(c, "url", "url redirects too many times")
+	case errors.Is(err, fetcher.ErrTooLarge):
+		apierror.Write(c, http.StatusRequestEntityTooLarge, h.ingest.rules.tooLargeError())
+	case errors.As(err, &status):
+		apierror.Write(c, http.StatusBadGateway, "Unable to download the URL, "+status.Error())
+	default:
+		log.Printf("Fetching %s failed: %v\n", rawURL, err)
+		apierror.Write(c, http.StatusBadGateway, "Unable to download the URL")
+	}
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/llm"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/notifier"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxUsageDays caps the range GET /me/usage covers
+	maxUsageDays = 366
+	// usageReportBatch is how many days report_usage loads at a time
+	usageReportBatch = 500
+)
+
+type UsageHandler struct {
+	Store storage.Store
+}
+
+// Constructor for the usage endpoint
+func NewUsageHandler(store storage.Store) *UsageHandler {
+	return &UsageHandler{Store: store}
+}
+
+// --- GET /me/usage ---
+// What the caller consumed a day at a time from ?from to ?to (YYYY-MM-DD in UTC, both included),
+// the current month by default, and the totals of those days. Each day comes once per
+// organization the usage was in. With ?org_id it is every member's usage in that organization
+// instead, which only its owners may see. Today's numbers keep growing until the day is over.
+func (h *UsageHandler) Get(c *gin.Context) {
+	now := time.Now().UTC()
+	from, to := c.DefaultQuery("from", now.Format("2006-01")+"-01"), c.DefaultQuery("to", now.Format(time.DateOnly))
+	start, err := time.Parse(time.DateOnly, from)
+	if err != nil {
+		apierror.Field(c, "from", "from must be a date like 2024-01-31")
+		return
+	}
+	end, err := time.Parse(time.DateOnly, to)
+	if err != nil {
+		apierror.Field(c, "to", "to must be a date like 2024-01-31")
+		return
+	}
+	if end.Before(start) || end.Sub(start) >= maxUsageDays*24*time.Hour {
+		apierror.Field(c, "to", fmt.Sprintf("to must be on or after from and at most %d days later", maxUsageDays-1))
+		return
+	}
+
+	filter := storage.UsageFilter{UserID: middleware.UserID(c), OrgID: c.Query("org_id"), From: from, To: to}
+	if filter.OrgID != "" && !requireOrgOwner(c, h.Store, filter.OrgID) {
+		return
+	}
+	days, err := h.Store.ListUsage(c.Request.Context(), filter)
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	total := models.Usage{}
+	for _, d := range days {
+		total.Add(d.Usage)
+	}
+	// storage is a level rather than an amount, adding it up over the days means nothing
+	delete(total, models.MetricStorageBytes)
+	c.JSON(http.StatusOK, gin.H{"from": from, "to": to, "org_id": filter.OrgID, "days": days, "total": total})
+}
+
+// meterLLM adds the tokens of a completion to the caller's usage in orgID. What the provider
+// didn't count, an answer cut short or a provider that never says, is estimated from the text.
+func meterLLM(c *gin.Context, store storage.UsageStore, orgID string, usage llm.Usage, messages []llm.Message, output string) {
+	if usage.InputTokens == 0 {
+		for _, m := range messages {
+			usage.InputTokens += len(m.Content)
+		}
+		usage.InputTokens /= charsPerToken
+	}
+	if usage.OutputTokens == 0 {
+		usage.OutputTokens = len(output) / charsPerToken
+	}
+	// the client may be gone, the tokens were spent all the same
+	ctx := context.WithoutCancel(c.Request.Context())
+	err := store.AddUsage(ctx, middleware.UserID(c), orgID, models.Usage{
+		models.MetricLLMInputTokens:  int64(usage.InputTokens),
+		models.MetricLLMOutputTokens: int64(usage.OutputTokens),
+	})
+	if err != nil {
+		log.Println("Usage Error:", err)
+	}
+}
+
+// UsageTask is the report_usage schedule. Every run records what the users' documents take up
+// in storage now, then sends each closed day that wasn't yet to billing and to the webhooks
+// subscribed to usage.reported. A day the billing endpoint refused is sent again next run.
+type UsageTask struct {
+	Store   storage.UsageStore
+	Notify  *notifier.Notifier
+	Billing *notifier.Billing // nil when no billing endpoint is configured
+}
+
+// Constructor for the usage reporting task
+func NewUsageTask(store storage.UsageStore, notify *notifier.Notifier, billing *notifier.Billing) *UsageTask {
+	return &UsageTask{Store: store, Notify: notify, Billing: billing}
+}
+
+// Run records storage and reports the closed days
+func (t *UsageTask) Run(ctx context.Context) (string, error) {
+	holders, err := t.Store.RecordStorageUsage(ctx)
+	if err != nil {
+		return "", fmt.Errorf("recording storage: %w", err)
+	}
+
+	today := time.Now().UTC().Format(time.DateOnly)
+	reported := 0
+	for {
+		days, err := t.Store.ListUnreportedUsage(ctx, today, usageReportBatch)
+		if err != nil {
+			return "", fmt.Errorf("listing usage after reporting %d days: %w", reported, err)
+		}
+		for _, day := range days {
+			payload := notifier.NewUsagePayload(day)
+			if t.Billing != nil {
+				if err := t.Billing.Send(ctx, payload); err != nil {
+					return "", fmt.Errorf("reported %d days, then %s failed: %w", reported, payload.ID, err)
+				}
+			}
+			if err := t.Store.MarkUsageReported(ctx, day); err != nil {
+				return "", err
+			}
+			t.Notify.UsageReported(payload)
+			reported++
+		}
+		if len(days) < usageReportBatch {
+			break
+		}
+	}
+	return fmt.Sprintf("recorded the storage of %d users and organizations, reported %d days of usage", holders, reported), nil
+}
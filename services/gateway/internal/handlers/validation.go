@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// what most filesystems and object stores take in one path element
+	maxFilenameBytes = 255
+	// longer "extensions" are just part of the name
+	maxExtensionBytes = 16
+	// what a file name that sanitizes to nothing is stored under
+	fallbackFilename = "upload"
+)
+
+// sanitizeFilename makes a client's file name safe to store, list and send back in a
+// Content-Disposition. Only the last path element counts, whichever slash the client's OS uses,
+// and control and formatting characters go (a right-to-left override can make evil.exe look
+// like exe.pdf). Leading dots and trailing dots and spaces go too, so nothing comes out hidden
+// or as "..". Long names are cut to fit, keeping the extension the file type is checked by.
+func sanitizeFilename(name string) string {
+	name = strings.ToValidUTF8(name, "")
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || unicode.Is(unicode.Cf, r) {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimLeft(name, ". ")
+	name = strings.TrimRight(name, ". ")
+
+	if len(name) > maxFilenameBytes {
+		ext := filepath.Ext(name)
+		if len(ext) > maxExtensionBytes {
+			ext = ""
+		}
+		base := name[:maxFilenameBytes-len(ext)]
+		// don't cut a character in half
+		for !utf8.ValidString(base) {
+			base = base[:len(base)-1]
+		}
+		name = base + ext
+	}
+	if name == "" {
+		return fallbackFilename
+	}
+	return name
+}
@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+	"github.com/dhruvkshah75/docstream/gateway/internal/envelope"
+	"github.com/dhruvkshah75/docstream/gateway/internal/metrics"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/objectstore"
+	"github.com/dhruvkshah75/docstream/gateway/internal/queue"
+	"github.com/dhruvkshah75/docstream/gateway/internal/scanner"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// VersionHandler keeps every upload of a document's content:
+//
+//	POST /documents/:id/versions                    upload new content, it becomes the current version
+//	GET  /documents/:id/versions                    list the versions, newest first
+//	POST /documents/:id/versions/:version/restore   make an older version current again
+//
+// Either way the document is processed again as a new job. Its vectors are replaced once that
+// job has indexed the new content, until then search still finds the previous version.
+type VersionHandler struct {
+	Store   storage.Store
+	Objects objectstore.Store
+	Queue   queue.Publisher
+	Scanner *scanner.Scanner
+	ingest  ingester
+}
+
+// Constructor for the document version endpoints
+func NewVersionHandler(store storage.Store, objects objectstore.Store, keys *envelope.Keyring, publisher queue.Publisher, virusScanner *scanner.Scanner, cfg *config.Config) *VersionHandler {
+	return &VersionHandler{
+		Store:   store,
+		Objects: objects,
+		Queue:   publisher,
+		Scanner: virusScanner,
+		ingest:  ingester{store: store, objects: objects, keys: keys, publisher: publisher, scanner: virusScanner, rules: newUploadRules(cfg), kind: "version"},
+	}
+}
+
+// --- POST /documents/:id/versions ---
+// Takes a multipart "file" like POST /upload. The name and type may differ from the current
+// version's, content identical to it doesn't make a new version.
+func (h *VersionHandler) Upload(c *gin.Context) {
+	rules := h.ingest.rules
+	if !rules.limitBody(c, rules.maxSize+multipartOverhead) {
+		return
+	}
+	file, err := c.FormFile("file")
+	if isTooLarge(err) {
+		apierror.Write(c, http.StatusRequestEntityTooLarge, rules.tooLargeError())
+		return
+	}
+	if err != nil {
+		apierror.Write(c, http.StatusBadRequest, "No file uploaded")
+		return
+	}
+	if file.Size > rules.maxSize {
+		apierror.Write(c, http.StatusRequestEntityTooLarge, rules.tooLargeError())
+		return
+	}
+
+	doc, ok := h.changeableDocument(c)
+	if !ok {
+		return
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Unable to open file")
+		return
+	}
+	defer src.Close()
+
+	ctx := c.Request.Context()
+	filename := sanitizeFilename(file.Filename)
+	contentType, failure := h.ingest.sniff(src, filename)
+	if failure != nil {
+		failure.respond(c)
+		return
+	}
+	sum, err := hashContent(src)
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Unable to read file")
+		return
+	}
+	if sum == doc.SHA256 {
+		c.JSON(http.StatusOK, gin.H{
+			"message":     "File is the same as the current version, no new version was made",
+			"document_id": doc.ID,
+			"version":     doc.Version,
+			"duplicate":   true,
+		})
+		return
+	}
+	// the version goes by the plan of the document's owner or organization, like its first upload
+	if failure := checkUploadPlan(ctx, h.Store, uploadTarget{UserID: doc.UserID, OrgID: doc.OrgID}, file.Size); failure != nil {
+		failure.respond(c)
+		return
+	}
+
+	// scanned before it is stored, an infected file never gets near the document
+	if failure := h.scan(ctx, src); failure != nil {
+		failure.respond(c)
+		return
+	}
+
+	// versions of one document are often uploaded under the same name, seconds apart
+	key := fmt.Sprintf("%s_%d_%s", doc.ID, time.Now().UnixNano(), filename)
+	objectKey, wrappedKey, failure := h.ingest.put(ctx, key, src, file.Size, contentType)
+	if failure != nil {
+		failure.respond(c)
+		return
+	}
+	v := models.DocumentVersion{
+		DocumentID:    doc.ID,
+		ObjectKey:     objectKey,
+		Filename:      filename,
+		ContentType:   contentType,
+		Size:          file.Size,
+		SHA256:        sum,
+		EncryptionKey: wrappedKey,
+		UserID:        middleware.UserID(c),
+	}
+	v.Version, err = h.Store.AddDocumentVersion(ctx, v)
+	if err != nil {
+		if err := h.Objects.Delete(ctx, doc.Bucket, objectKey); err != nil {
+			log.Println("Storage Delete Error:", err)
+		}
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			apierror.Write(c, http.StatusNotFound, "Document not found")
+		case errors.Is(err, storage.ErrDuplicate):
+			apierror.Write(c, http.StatusConflict, "Another version was uploaded at the same time, try again")
+		default:
+			log.Println("Version Insert Error:", err)
+			apierror.Write(c, http.StatusInternalServerError, "Failed to record version")
+		}
+		return
+	}
+	if h.Scanner.Enabled() {
+		if err := h.Store.SetDocumentScan(ctx, doc.ID, models.ScanStatusClean, ""); err != nil {
+			log.Printf("Failed to record scan result for %s: %v\n", doc.ID, err)
+		}
+	}
+
+	jobID, ok := h.process(c, doc, v)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "New version uploaded and processing started",
+		"job_id":      jobID,
+		"document_id": doc.ID,
+		"version":     v.Version,
+	})
+}
+
+// --- GET /documents/:id/versions ---
+// Anyone who can read the document can see its history
+func (h *VersionHandler) List(c *gin.Context) {
+	doc, err := h.Store.GetReadableDocument(c.Request.Context(), c.Param("id"), middleware.UserID(c))
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Document not found")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	versions, err := h.Store.ListDocumentVersions(c.Request.Context(), doc.ID)
+	if err != nil {
+		log.Println("Version List Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	for i := range versions {
+		versions[i].Current = versions[i].Version == doc.Version
+	}
+	c.JSON(http.StatusOK, gin.H{"document_id": doc.ID, "version": doc.Version, "versions": versions})
+}
+
+// --- POST /documents/:id/versions/:version/restore ---
+// The document goes back to that version's file, name and type. The versions after it stay,
+// restoring one of them goes forward again and the next upload still gets a new number.
+func (h *VersionHandler) Restore(c *gin.Context) {
+	number, err := strconv.Atoi(c.Param("version"))
+	if err != nil || number < 1 {
+		apierror.Write(c, http.StatusBadRequest, "version must be a positive number")
+		return
+	}
+
+	doc, ok := h.changeableDocument(c)
+	if !ok {
+		return
+	}
+	if number == doc.Version {
+		apierror.Write(c, http.StatusConflict, fmt.Sprintf("Version %d is already the current one", number))
+		return
+	}
+
+	v, err := h.Store.RestoreDocumentVersion(c.Request.Context(), doc.ID, number)
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Version not found")
+		return
+	} else if err != nil {
+		log.Println("Version Restore Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	jobID, ok := h.process(c, doc, v)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":     "Version restored and processing started",
+		"job_id":      jobID,
+		"document_id": doc.ID,
+		"version":     v.Version,
+	})
+}
+
+// changeableDocument loads the document for a new or restored version, writing the error response
+// when the caller can't have one: viewers can't, and neither can anyone while it is being processed.
+func (h *VersionHandler) changeableDocument(c *gin.Context) (models.Document, bool) {
+	userID := middleware.UserID(c)
+	doc, err := h.Store.GetDocument(c.Request.Context(), c.Param("id"), userID)
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Document not found")
+		return doc, false
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return doc, false
+	}
+	if doc.UserID != userID {
+		role, ok := orgRole(c, h.Store, doc.OrgID)
+		if !ok {
+			return doc, false
+		}
+		if !canUpload(role) {
+			apierror.Write(c, http.StatusForbidden, "Viewers can't change this organization's documents")
+			return doc, false
+		}
+	}
+	if doc.ScanStatus == models.ScanStatusInfected {
+		apierror.Write(c, http.StatusForbidden, "This file was flagged as malware, upload it as a new document instead")
+		return doc, false
+	}
+
+	// the job running now would index the content it started with after the new version's job
+	latest, err := h.Store.GetLatestJobForDocument(c.Request.Context(), doc.ID)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return doc, false
+	}
+	if err == nil && !models.IsFinal(latest.Status) {
+		body := apierror.Body(c, http.StatusConflict, "Document is still being processed")
+		body["job_id"] = latest.ID
+		c.JSON(http.StatusConflict, body)
+		return doc, false
+	}
+	return doc, true
+}
+
+// scan checks the file with clamd before it is stored, src is rewound afterwards
+func (h *VersionHandler) scan(ctx context.Context, src io.ReadSeeker) *apiFailure {
+	if !h.Scanner.Enabled() {
+		return nil
+	}
+	verdict, err := h.Scanner.Scan(ctx, src)
+	if err == nil {
+		_, err = src.Seek(0, io.SeekStart)
+	}
+	switch {
+	case err != nil:
+		metrics.VirusScans.WithLabelValues(models.ScanStatusError).Inc()
+		log.Println("Virus Scan Error:", err)
+		return &apiFailure{Status: http.StatusServiceUnavailable, Message: "Virus scan failed, try again later"}
+	case verdict.Infected:
+		metrics.VirusScans.WithLabelValues(models.ScanStatusInfected).Inc()
+		return &apiFailure{Status: http.StatusUnprocessableEntity, Message: "File rejected, malware detected: " + verdict.Signature}
+	}
+	metrics.VirusScans.WithLabelValues(models.ScanStatusClean).Inc()
+	return nil
+}
+
+// process queues the document at version v, writing the error response when it can't.
+// The thumbnails were rendered from the previous version, the job renders new ones.
+func (h *VersionHandler) process(c *gin.Context, doc models.Document, v models.DocumentVersion) (string, bool) {
+	ctx := c.Request.Context()
+	for _, file := range models.DerivedFiles {
+		if err := h.Objects.Delete(ctx, doc.Bucket, models.DerivedKey(doc.ID, file)); err != nil {
+			log.Printf("Failed to remove the %s of %s: %v\n", file, doc.ID, err)
+		}
+	}
+
+	doc.Version, doc.ObjectKey, doc.Filename, doc.ContentType = v.Version, v.ObjectKey, v.Filename, v.ContentType
+	doc.Size, doc.SHA256, doc.EncryptionKey = v.Size, v.SHA256, v.EncryptionKey
+	jobID, err := enqueueJob(ctx, h.Store, h.Queue, doc, nil)
+	if err != nil {
+		// the version is recorded, POST /documents/:id/reprocess picks it up
+		respondQueueError(c, err)
+		return "", false
+	}
+	return jobID, true
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/fetcher"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type WebhookHandler struct {
+	Store storage.Store
+}
+
+// Constructor for the webhook management endpoints
+func NewWebhookHandler(store storage.Store) *WebhookHandler {
+	return &WebhookHandler{Store: store}
+}
+
+type WebhookInput struct {
+	URL    string   `json:"url" binding:"required"`
+	Events []string `json:"events"` // defaults to every event
+}
+
+var webhookEvents = map[string]bool{
+	models.EventJobCompleted: true,
+	models.EventJobFailed:    true,
+	// only sent for saved searches with webhook alerts on
+	models.EventSearchMatched: true,
+	// a day's usage once it is over, see the report_usage schedule
+	models.EventUsageReported: true,
+}
+
+// --- POST /webhooks ---
+// The signing secret is only returned here, store it on the receiving side
+func (h *WebhookHandler) Create(c *gin.Context) {
+	var input WebhookInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Invalid(c, err)
+		return
+	}
+
+	u, err := url.Parse(input.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		apierror.Write(c, http.StatusBadRequest, "url must be an absolute http(s) URL")
+		return
+	}
+	// deliveries can't reach them either, this only saves registering one that never works
+	if err := fetcher.CheckHost(c.Request.Context(), u.Hostname()); errors.Is(err, fetcher.ErrBlocked) {
+		apierror.Write(c, http.StatusBadRequest, fetcher.ErrBlocked.Error())
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusBadRequest, "url host could not be resolved")
+		return
+	}
+
+	if len(input.Events) == 0 {
+		input.Events = []string{models.EventJobCompleted, models.EventJobFailed, models.EventSearchMatched, models.EventUsageReported}
+	}
+	for _, event := range input.Events {
+		if !webhookEvents[event] {
+			apierror.Write(c, http.StatusBadRequest, "Unknown event: "+event)
+			return
+		}
+	}
+
+	hook := models.Webhook{
+		ID:        "wh_" + uuid.NewString(),
+		UserID:    middleware.UserID(c),
+		URL:       u.String(),
+		Secret:    newOpaqueToken(),
+		Events:    input.Events,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := h.Store.CreateWebhook(c.Request.Context(), hook); err != nil {
+		log.Println("Webhook Insert Error:", err)
+		apierror.Write(c, http.StatusInternalServerError, "Failed to create webhook")
+		return
+	}
+
+	c.JSON(http.StatusCreated, hook)
+}
+
+// --- GET /webhooks ---
+func (h *WebhookHandler) List(c *gin.Context) {
+	hooks, err := h.Store.ListWebhooks(c.Request.Context(), middleware.UserID(c))
+	if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"webhooks": hooks})
+}
+
+// --- DELETE /webhooks/:id ---
+func (h *WebhookHandler) Delete(c *gin.Context) {
+	err := h.Store.DeleteWebhook(c.Request.Context(), c.Param("id"), middleware.UserID(c))
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Webhook not found")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted"})
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/events"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsWriteTimeout = 10 * time.Second
+	wsPingInterval = 30 * time.Second
+	wsPongTimeout  = 60 * time.Second
+)
+
+type JobWatchHandler struct {
+	Store    storage.Store
+	Hub      *events.Hub
+	upgrader websocket.Upgrader
+}
+
+// Constructor for the live job progress endpoint, origins are the browser origins allowed to connect
+func NewJobWatchHandler(store storage.Store, hub *events.Hub, origins *middleware.Origins) *JobWatchHandler {
+	return &JobWatchHandler{
+		Store: store,
+		Hub:   hub,
+		upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool {
+				origin := r.Header.Get("Origin")
+				// non-browser clients don't send an Origin
+				return origin == "" || origins.Allowed(origin)
+			},
+		},
+	}
+}
+
+// --- GET /ws/jobs/:id ---
+// Sends the current status first, then every event until the job finishes
+func (h *JobWatchHandler) Watch(c *gin.Context) {
+	jobID := c.Param("id")
+	job, err := h.Store.GetJob(c.Request.Context(), jobID, middleware.UserID(c))
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(c, http.StatusNotFound, "Job not found")
+		return
+	} else if err != nil {
+		apierror.Write(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade already wrote the error response
+		log.Println("WebSocket Upgrade Error:", err)
+		return
+	}
+	defer conn.Close()
+
+	// subscribe before reading the status again so nothing slips in between
+	updates, unsubscribe := h.Hub.Subscribe(jobID)
+	defer unsubscribe()
+
+	if job, err = h.Store.GetJob(c.Request.Context(), jobID, middleware.UserID(c)); err != nil {
+		return
+	}
+	snapshot := events.Event{JobID: job.ID, Type: events.TypeStatus, Status: job.Status, Error: job.Error, Timestamp: time.Now().Unix()}
+	if !h.send(conn, snapshot) || models.IsFinal(job.Status) {
+		h.closeNormal(conn)
+		return
+	}
+
+	// the read loop only exists to notice the client going away and to handle pongs
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+		})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-gone:
+			return
+		case <-ping.C:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case event, ok := <-updates:
+			if !ok || !h.send(conn, event) {
+				return
+			}
+			if event.Type == events.TypeStatus && models.IsFinal(event.Status) {
+				h.closeNormal(conn)
+				return
+			}
+		}
+	}
+}
+
+func (h *JobWatchHandler) send(conn *websocket.Conn, event events.Event) bool {
+	conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return conn.WriteJSON(event) == nil
+}
+
+func (h *JobWatchHandler) closeNormal(conn *websocket.Conn) {
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "job finished")
+	conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(wsWriteTimeout))
+}
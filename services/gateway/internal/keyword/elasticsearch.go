@@ -0,0 +1,407 @@
+package keyword
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/dhruvkshah75/docstream/gateway/internal/vectorstore"
+)
+
+// esPageSize is how many chunks Chunks asks for at a time
+const esPageSize = 1000
+
+// HTTPError is a non-2xx answer from the cluster
+type HTTPError struct {
+	Status int
+	Body   string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("keyword index returned %d: %s", e.Status, e.Body)
+}
+
+// elasticsearch talks to the REST API Elasticsearch and OpenSearch share. The index is created
+// on the first upsert, text and headings are analyzed with the standard analyzer and ranked by
+// BM25, everything searches filter on is a keyword field.
+type elasticsearch struct {
+	baseURL  string
+	index    string
+	username string
+	password string
+	apiKey   string
+	client   *http.Client
+
+	mu    sync.Mutex
+	ready bool
+}
+
+func newElasticsearch(cfg config.KeywordSearch, timeout time.Duration) *elasticsearch {
+	return &elasticsearch{
+		baseURL:  strings.TrimRight(cfg.URL, "/"),
+		index:    cfg.Index,
+		username: cfg.Username,
+		password: cfg.Password,
+		apiKey:   cfg.APIKey,
+		client:   &http.Client{Timeout: timeout},
+	}
+}
+
+func (e *elasticsearch) Name() string { return "elasticsearch" }
+
+// esChunk is a chunk as it is stored in the index
+type esChunk struct {
+	DocumentID string   `json:"document_id"`
+	JobID      string   `json:"job_id"`
+	Owner      string   `json:"owner"`
+	ChunkIndex int      `json:"chunk_index"`
+	Page       int      `json:"page,omitempty"`
+	Start      int      `json:"start"`
+	End        int      `json:"end"`
+	Heading    string   `json:"heading,omitempty"`
+	Text       string   `json:"text"`
+	Language   string   `json:"language,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+	Entities   []string `json:"entities,omitempty"`
+}
+
+func (c esChunk) chunk() models.Chunk {
+	return models.Chunk{Index: c.ChunkIndex, Page: c.Page, Start: c.Start, End: c.End, Heading: c.Heading, Text: c.Text}
+}
+
+// esID is a chunk's document ID in the index
+func esID(documentID string, index int) string {
+	return documentID + "/" + strconv.Itoa(index)
+}
+
+func (e *elasticsearch) Upsert(ctx context.Context, batch Batch) error {
+	if len(batch.Chunks) == 0 {
+		return nil
+	}
+	if err := e.ensureIndex(ctx); err != nil {
+		return err
+	}
+
+	// the bulk API takes an action line and a document line for each chunk
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, c := range batch.Chunks {
+		action := map[string]any{"index": map[string]string{"_id": esID(batch.DocumentID, c.Index)}}
+		doc := esChunk{
+			DocumentID: batch.DocumentID,
+			JobID:      batch.JobID,
+			Owner:      vectorstore.OwnerKey(batch.UserID, batch.OrgID),
+			ChunkIndex: c.Index,
+			Page:       c.Page,
+			Start:      c.Start,
+			End:        c.End,
+			Heading:    c.Heading,
+			Text:       c.Text,
+			Language:   batch.Language,
+			Tags:       batch.Tags,
+			Entities:   batch.Entities,
+		}
+		if err := enc.Encode(action); err != nil {
+			return err
+		}
+		if err := enc.Encode(doc); err != nil {
+			return err
+		}
+	}
+
+	var out struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Error json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := e.do(ctx, http.MethodPost, e.path("_bulk"), "application/x-ndjson", &body, &out); err != nil {
+		return err
+	}
+	if out.Errors {
+		for _, item := range out.Items {
+			for _, result := range item {
+				if len(result.Error) > 0 {
+					return fmt.Errorf("indexing chunks: %s", result.Error)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (e *elasticsearch) DeleteStale(ctx context.Context, documentID, jobID string, chunks int) error {
+	return e.deleteWhere(ctx, map[string]any{"bool": map[string]any{
+		"filter": []any{term("document_id", documentID)},
+		"should": []any{
+			map[string]any{"bool": map[string]any{"must_not": term("job_id", jobID)}},
+			map[string]any{"range": map[string]any{"chunk_index": map[string]int{"gte": chunks}}},
+		},
+		"minimum_should_match": 1,
+	}})
+}
+
+func (e *elasticsearch) DeleteJob(ctx context.Context, documentID, jobID string) error {
+	return e.deleteWhere(ctx, map[string]any{"bool": map[string]any{
+		"filter": []any{term("document_id", documentID), term("job_id", jobID)},
+	}})
+}
+
+func (e *elasticsearch) DeleteDocument(ctx context.Context, documentID string) error {
+	return e.deleteWhere(ctx, map[string]any{"bool": map[string]any{
+		"filter": []any{term("document_id", documentID)},
+	}})
+}
+
+func (e *elasticsearch) SetDocumentTags(ctx context.Context, documentID string, tags []string) error {
+	if tags == nil {
+		tags = []string{}
+	}
+	body := map[string]any{
+		"query": map[string]any{"bool": map[string]any{"filter": []any{term("document_id", documentID)}}},
+		"script": map[string]any{
+			"source": "ctx._source.tags = params.tags",
+			"params": map[string]any{"tags": tags},
+		},
+	}
+	err := e.doJSON(ctx, http.MethodPost, e.path("_update_by_query")+"?conflicts=proceed&refresh=true", body, nil)
+	if isNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func (e *elasticsearch) Chunk(ctx context.Context, documentID string, index int) (models.Chunk, error) {
+	var out struct {
+		Source esChunk `json:"_source"`
+	}
+	err := e.do(ctx, http.MethodGet, e.path("_doc/"+url.PathEscape(esID(documentID, index))), "application/json", nil, &out)
+	if isNotFound(err) {
+		// a missing chunk and a missing index both answer 404
+		return models.Chunk{}, storage.ErrNotFound
+	}
+	if err != nil {
+		return models.Chunk{}, err
+	}
+	return out.Source.chunk(), nil
+}
+
+// Chunks pages through the document's chunks by index, search_after goes past the 10000 hits
+// one search may return
+func (e *elasticsearch) Chunks(ctx context.Context, documentID string) ([]models.Chunk, error) {
+	chunks := []models.Chunk{}
+	var after []any
+	for {
+		body := map[string]any{
+			"size":  esPageSize,
+			"query": term("document_id", documentID),
+			"sort":  []any{map[string]string{"chunk_index": "asc"}},
+		}
+		if after != nil {
+			body["search_after"] = after
+		}
+		var out struct {
+			Hits struct {
+				Hits []struct {
+					Source esChunk `json:"_source"`
+					Sort   []any   `json:"sort"`
+				} `json:"hits"`
+			} `json:"hits"`
+		}
+		err := e.doJSON(ctx, http.MethodPost, e.path("_search"), body, &out)
+		if isNotFound(err) {
+			return chunks, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, hit := range out.Hits.Hits {
+			chunks = append(chunks, hit.Source.chunk())
+		}
+		if len(out.Hits.Hits) < esPageSize {
+			return chunks, nil
+		}
+		after = out.Hits.Hits[len(out.Hits.Hits)-1].Sort
+	}
+}
+
+func (e *elasticsearch) Search(ctx context.Context, query string, filter vectorstore.Filter, limit int) ([]models.ChunkMatch, error) {
+	owners := []string{}
+	if filter.UserID != 0 {
+		owners = append(owners, vectorstore.OwnerKey(filter.UserID, ""))
+	}
+	for _, org := range filter.OrgIDs {
+		owners = append(owners, vectorstore.OwnerKey(0, org))
+	}
+	terms := Terms(query)
+	if (len(owners) == 0 && len(filter.Shared) == 0) || len(terms) == 0 {
+		return []models.ChunkMatch{}, nil
+	}
+
+	readable := []any{map[string]any{"terms": map[string]any{"owner": owners}}}
+	if len(filter.Shared) > 0 {
+		readable = append(readable, map[string]any{"terms": map[string]any{"document_id": filter.Shared}})
+	}
+	filters := []any{map[string]any{"bool": map[string]any{"should": readable, "minimum_should_match": 1}}}
+	if len(filter.DocumentIDs) > 0 {
+		filters = append(filters, map[string]any{"terms": map[string]any{"document_id": filter.DocumentIDs}})
+	}
+	if len(filter.Languages) > 0 {
+		filters = append(filters, map[string]any{"terms": map[string]any{"language": filter.Languages}})
+	}
+	// a term on an array field looks for the value among its elements, one per tag makes it all of them
+	for _, tag := range filter.Tags {
+		filters = append(filters, term("tags", tag))
+	}
+	for _, entity := range filter.Entities {
+		filters = append(filters, term("entities", entity))
+	}
+
+	body := map[string]any{
+		"size": limit,
+		"query": map[string]any{"bool": map[string]any{
+			"must": map[string]any{"multi_match": map[string]any{
+				"query":  strings.Join(terms, " "),
+				"fields": []string{"heading^2", "text"},
+			}},
+			"filter": filters,
+		}},
+	}
+	var out struct {
+		Hits struct {
+			Hits []struct {
+				Score  float64 `json:"_score"`
+				Source esChunk `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	err := e.doJSON(ctx, http.MethodPost, e.path("_search"), body, &out)
+	if isNotFound(err) {
+		// no index yet means nothing was ever indexed
+		return []models.ChunkMatch{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]models.ChunkMatch, len(out.Hits.Hits))
+	for i, hit := range out.Hits.Hits {
+		c := hit.Source
+		matches[i] = models.ChunkMatch{
+			DocumentID: c.DocumentID,
+			Chunk:      c.chunk(),
+			Score:      hit.Score,
+		}
+	}
+	return matches, nil
+}
+
+func (e *elasticsearch) deleteWhere(ctx context.Context, query map[string]any) error {
+	err := e.doJSON(ctx, http.MethodPost, e.path("_delete_by_query")+"?conflicts=proceed&refresh=true", map[string]any{"query": query}, nil)
+	if isNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// ensureIndex creates the index with its mapping unless it exists
+func (e *elasticsearch) ensureIndex(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.ready {
+		return nil
+	}
+
+	keyword := map[string]string{"type": "keyword"}
+	body := map[string]any{
+		"mappings": map[string]any{"properties": map[string]any{
+			"document_id": keyword,
+			"job_id":      keyword,
+			"owner":       keyword,
+			"chunk_index": map[string]string{"type": "integer"},
+			"page":        map[string]string{"type": "integer"},
+			"start":       map[string]string{"type": "integer"},
+			"end":         map[string]string{"type": "integer"},
+			"heading":     map[string]string{"type": "text"},
+			"text":        map[string]string{"type": "text"},
+			"language":    keyword,
+			"tags":        keyword,
+			"entities":    keyword,
+		}},
+	}
+	err := e.doJSON(ctx, http.MethodPut, e.path(""), body, nil)
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && httpErr.Status == http.StatusBadRequest && strings.Contains(httpErr.Body, "already_exists") {
+		err = nil
+	}
+	if err != nil {
+		return fmt.Errorf("creating index %s: %w", e.index, err)
+	}
+	e.ready = true
+	return nil
+}
+
+func term(field, value string) map[string]any {
+	return map[string]any{"term": map[string]string{field: value}}
+}
+
+func (e *elasticsearch) path(rest string) string {
+	p := e.baseURL + "/" + url.PathEscape(e.index)
+	if rest != "" {
+		p += "/" + rest
+	}
+	return p
+}
+
+func (e *elasticsearch) doJSON(ctx context.Context, method, target string, body, out any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	return e.do(ctx, method, target, "application/json", bytes.NewReader(payload), out)
+}
+
+func (e *elasticsearch) do(ctx context.Context, method, target, contentType string, body io.Reader, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+e.apiKey)
+	} else if e.username != "" {
+		req.SetBasicAuth(e.username, e.password)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &HTTPError{Status: resp.StatusCode, Body: string(bytes.TrimSpace(msg))}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func isNotFound(err error) bool {
+	var httpErr *HTTPError
+	return errors.As(err, &httpErr) && httpErr.Status == http.StatusNotFound
+}
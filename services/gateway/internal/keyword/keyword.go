@@ -0,0 +1,130 @@
+package keyword
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/dhruvkshah75/docstream/gateway/internal/vectorstore"
+)
+
+// Index keeps chunk text searchable by the words in it. The worker sends the chunks over the
+// results queue, unlike the vectors it writes itself, so a database index works as well.
+type Index interface {
+	Name() string
+	// Upsert writes a batch of chunks, replacing any of the document's with the same index
+	Upsert(ctx context.Context, batch Batch) error
+	// DeleteStale removes a document's chunks that weren't written by jobID and those of
+	// jobID's past its last chunk, left over when reprocessing produced fewer chunks than before
+	DeleteStale(ctx context.Context, documentID, jobID string, chunks int) error
+	// DeleteJob removes the chunks jobID wrote for a document, undoing a cancelled job
+	DeleteJob(ctx context.Context, documentID, jobID string) error
+	// DeleteDocument removes every chunk of a document
+	DeleteDocument(ctx context.Context, documentID string) error
+	// SetDocumentTags overwrites the tags on every chunk of a document
+	SetDocumentTags(ctx context.Context, documentID string, tags []string) error
+	// Chunk returns chunk index of a document, storage.ErrNotFound when it isn't indexed
+	Chunk(ctx context.Context, documentID string, index int) (models.Chunk, error)
+	// Chunks returns every chunk of a document in order, none when it isn't indexed
+	Chunks(ctx context.Context, documentID string) ([]models.Chunk, error)
+	// Search returns the limit chunks that match any word of query best and match filter, best first
+	Search(ctx context.Context, query string, filter vectorstore.Filter, limit int) ([]models.ChunkMatch, error)
+}
+
+// Batch is chunks of one document a job made, with what searches filter on
+type Batch struct {
+	DocumentID string         `json:"document_id"`
+	JobID      string         `json:"-"`
+	UserID     int            `json:"user_id"`
+	OrgID      string         `json:"org_id"`
+	Language   string         `json:"language"`
+	Tags       []string       `json:"tags"`
+	Entities   []string       `json:"entities"`
+	Chunks     []models.Chunk `json:"chunks"`
+}
+
+// New picks the index named by cfg.Kind: "database" keeps it in the gateway's own database,
+// "elasticsearch" in an Elasticsearch or OpenSearch cluster. It returns nil when that is
+// empty, which turns keyword search off.
+func New(cfg config.KeywordSearch, store storage.KeywordStore) (Index, error) {
+	switch cfg.Kind {
+	case "":
+		return nil, nil
+	case "database":
+		return database{store: store}, nil
+	case "elasticsearch":
+		return newElasticsearch(cfg, 30*time.Second), nil
+	default:
+		return nil, fmt.Errorf("unknown KEYWORD_SEARCH %q, use database or elasticsearch", cfg.Kind)
+	}
+}
+
+// maxTerms is how many words of a query are searched for, the rest are left out
+const maxTerms = 32
+
+// Terms splits a query into the lower case words it is searched by, each once. Anything
+// but letters and digits separates words, so nothing in a term means anything to a backend.
+func Terms(query string) []string {
+	var terms []string
+	seen := map[string]bool{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if !seen[word] && len(terms) < maxTerms {
+			seen[word] = true
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+// database is the keyword index in the gateway's own tables, searches join the documents for
+// their owner, tags, language and entities so it needs none of them on the chunks
+type database struct {
+	store storage.KeywordStore
+}
+
+func (database) Name() string { return "database" }
+
+func (d database) Upsert(ctx context.Context, batch Batch) error {
+	return d.store.IndexChunks(ctx, batch.DocumentID, batch.JobID, batch.Chunks)
+}
+
+func (d database) DeleteStale(ctx context.Context, documentID, jobID string, chunks int) error {
+	return d.store.DeleteStaleChunks(ctx, documentID, jobID, chunks)
+}
+
+func (d database) DeleteJob(ctx context.Context, documentID, jobID string) error {
+	return d.store.DeleteJobChunks(ctx, documentID, jobID)
+}
+
+func (d database) DeleteDocument(ctx context.Context, documentID string) error {
+	return d.store.DeleteDocumentChunks(ctx, documentID)
+}
+
+func (d database) Chunk(ctx context.Context, documentID string, index int) (models.Chunk, error) {
+	return d.store.GetChunk(ctx, documentID, index)
+}
+
+func (d database) Chunks(ctx context.Context, documentID string) ([]models.Chunk, error) {
+	return d.store.ListChunks(ctx, documentID)
+}
+
+func (database) SetDocumentTags(context.Context, string, []string) error { return nil }
+
+func (d database) Search(ctx context.Context, query string, filter vectorstore.Filter, limit int) ([]models.ChunkMatch, error) {
+	return d.store.SearchChunks(ctx, Terms(query), storage.ChunkFilter{
+		UserID:      filter.UserID,
+		OrgIDs:      filter.OrgIDs,
+		Shared:      filter.Shared,
+		DocumentIDs: filter.DocumentIDs,
+		Tags:        filter.Tags,
+		Languages:   filter.Languages,
+		Entities:    filter.Entities,
+	}, limit)
+}
@@ -0,0 +1,237 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+)
+
+// Message is one turn of a chat
+type Message struct {
+	Role    string `json:"role"` // system, user or assistant
+	Content string `json:"content"`
+}
+
+// Chat roles
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// Usage is the tokens a completion took as the provider counted them, zero when it didn't say
+type Usage struct {
+	InputTokens  int
+	OutputTokens int
+}
+
+// Provider generates a chat completion, handing it over piece by piece as it is produced
+type Provider interface {
+	Name() string
+	Model() string
+	// Stream calls onToken with every piece of the answer, stopping early if onToken returns an
+	// error. The usage comes at the end of the stream, an answer cut short has none.
+	Stream(ctx context.Context, messages []Message, onToken func(string) error) (Usage, error)
+	// WithModel is the same provider generating with model, writing at most maxTokens unless that is 0
+	WithModel(model string, maxTokens int) Provider
+}
+
+// New picks the provider named by cfg.Provider: "openai" (or anything speaking its
+// chat completions API through the OpenAI base URL) or "ollama". It returns nil when
+// that is empty, which turns question answering off.
+func New(cfg config.LLM, providers config.Providers) (Provider, error) {
+	switch cfg.Provider {
+	case "":
+		return nil, nil
+	case "openai":
+		if providers.OpenAIAPIKey == "" {
+			return nil, fmt.Errorf("OPENAI_API_KEY is required for the openai LLM provider")
+		}
+		return &openAI{baseURL: strings.TrimRight(providers.OpenAIBaseURL, "/"), apiKey: providers.OpenAIAPIKey, model: orDefault(cfg.Model, "gpt-4o-mini")}, nil
+	case "ollama":
+		return &ollama{baseURL: strings.TrimRight(providers.OllamaURL, "/"), model: orDefault(cfg.Model, "llama3.1")}, nil
+	default:
+		return nil, fmt.Errorf("unknown LLM_PROVIDER %q, use openai or ollama", cfg.Provider)
+	}
+}
+
+// HTTPError is a non-2xx answer from a provider
+type HTTPError struct {
+	Status int
+	Body   string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("provider returned %d: %s", e.Status, e.Body)
+}
+
+// openAI streams /chat/completions, which answers with server-sent events
+type openAI struct {
+	baseURL   string
+	apiKey    string
+	model     string
+	maxTokens int
+}
+
+func (p *openAI) Name() string  { return "openai" }
+func (p *openAI) Model() string { return p.model }
+
+func (p *openAI) WithModel(model string, maxTokens int) Provider {
+	other := *p
+	other.model, other.maxTokens = model, maxTokens
+	return &other
+}
+
+func (p *openAI) Stream(ctx context.Context, messages []Message, onToken func(string) error) (Usage, error) {
+	// the usage comes in a chunk of its own without choices, right before [DONE]
+	body := map[string]any{"model": p.model, "messages": messages, "stream": true, "stream_options": map[string]any{"include_usage": true}}
+	if p.maxTokens > 0 {
+		body["max_tokens"] = p.maxTokens
+	}
+	headers := map[string]string{"Authorization": "Bearer " + p.apiKey}
+
+	var usage Usage
+	err := post(ctx, p.baseURL+"/chat/completions", headers, body, func(line []byte) (bool, error) {
+		data, ok := bytes.CutPrefix(line, []byte("data:"))
+		if !ok {
+			return false, nil // blank separators and comments
+		}
+		data = bytes.TrimSpace(data)
+		if string(data) == "[DONE]" {
+			return true, nil
+		}
+
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+			Usage *struct {
+				PromptTokens     int `json:"prompt_tokens"`
+				CompletionTokens int `json:"completion_tokens"`
+			} `json:"usage"`
+		}
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return false, fmt.Errorf("decoding stream: %w", err)
+		}
+		if chunk.Usage != nil {
+			usage = Usage{InputTokens: chunk.Usage.PromptTokens, OutputTokens: chunk.Usage.CompletionTokens}
+		}
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			return false, nil
+		}
+		return false, onToken(chunk.Choices[0].Delta.Content)
+	})
+	return usage, err
+}
+
+// ollama streams /api/chat, one JSON object per line
+type ollama struct {
+	baseURL   string
+	model     string
+	maxTokens int
+}
+
+func (p *ollama) Name() string  { return "ollama" }
+func (p *ollama) Model() string { return p.model }
+
+func (p *ollama) WithModel(model string, maxTokens int) Provider {
+	other := *p
+	other.model, other.maxTokens = model, maxTokens
+	return &other
+}
+
+func (p *ollama) Stream(ctx context.Context, messages []Message, onToken func(string) error) (Usage, error) {
+	body := map[string]any{"model": p.model, "messages": messages, "stream": true}
+	if p.maxTokens > 0 {
+		body["options"] = map[string]any{"num_predict": p.maxTokens}
+	}
+
+	var usage Usage
+	err := post(ctx, p.baseURL+"/api/chat", nil, body, func(line []byte) (bool, error) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			return false, nil
+		}
+
+		// the counts come with the last line, the one that is done
+		var chunk struct {
+			Message         Message `json:"message"`
+			Done            bool    `json:"done"`
+			Error           string  `json:"error"`
+			PromptEvalCount int     `json:"prompt_eval_count"`
+			EvalCount       int     `json:"eval_count"`
+		}
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return false, fmt.Errorf("decoding stream: %w", err)
+		}
+		if chunk.Error != "" {
+			return false, fmt.Errorf("ollama: %s", chunk.Error)
+		}
+		if chunk.Message.Content != "" {
+			if err := onToken(chunk.Message.Content); err != nil {
+				return false, err
+			}
+		}
+		if chunk.Done {
+			usage = Usage{InputTokens: chunk.PromptEvalCount, OutputTokens: chunk.EvalCount}
+		}
+		return chunk.Done, nil
+	})
+	return usage, err
+}
+
+// post sends body and feeds the streamed answer to onLine a line at a time until it says it's done
+func post(ctx context.Context, url string, headers map[string]string, body any, onLine func([]byte) (bool, error)) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	// no client timeout, a long answer can take a while, the caller's context bounds it
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &HTTPError{Status: resp.StatusCode, Body: string(bytes.TrimSpace(msg))}
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		done, err := onLine(scanner.Bytes())
+		if err != nil || done {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("stream ended before the answer was done: %w", io.ErrUnexpectedEOF)
+}
+
+func orDefault(v, fallback string) string {
+	if v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,142 @@
+package mailin
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"path/filepath"
+	"strings"
+)
+
+// a forwarded message nests one level per forward, past this it is someone being creative
+const maxDepth = 8
+
+// Message is what arrived, reduced to what uploading the attachments needs
+type Message struct {
+	// Sender is the envelope sender (MAIL FROM), From and Subject come from the headers
+	Sender      string
+	From        string
+	Subject     string
+	Attachments []Attachment
+}
+
+type Attachment struct {
+	Filename string
+	Data     []byte
+}
+
+var decoder = &mime.WordDecoder{}
+
+// Parse reads a raw RFC 5322 message. Attachments of messages forwarded as attachments
+// count too, "forward as attachment" is how a lot of clients forward.
+func Parse(raw []byte) (*Message, error) {
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	msg := &Message{From: m.Header.Get("From"), Subject: m.Header.Get("Subject")}
+	if subject, err := decoder.DecodeHeader(msg.Subject); err == nil {
+		msg.Subject = subject
+	}
+	if from, err := mail.ParseAddress(msg.From); err == nil {
+		msg.From = from.Address
+	}
+	if err := msg.walk(m.Header, m.Body, 0); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// header is the part of a MIME header walk needs, both mail.Header and textproto.MIMEHeader have it
+type header interface {
+	Get(key string) string
+}
+
+// walk collects the attachments of one MIME entity and everything under it
+func (msg *Message) walk(h header, body io.Reader, depth int) error {
+	if depth > maxDepth {
+		return errors.New("message nests too deep")
+	}
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		// no or a broken Content-Type is plain text by RFC 2045
+		mediaType = "text/plain"
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/"):
+		if params["boundary"] == "" {
+			return errors.New("multipart without a boundary")
+		}
+		parts := multipart.NewReader(body, params["boundary"])
+		for {
+			// NextRawPart leaves the transfer encoding to decode, and the part's own headers intact
+			part, err := parts.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := msg.walk(part.Header, part, depth+1); err != nil {
+				return err
+			}
+		}
+
+	case mediaType == "message/rfc822":
+		inner, err := mail.ReadMessage(decode(h, body))
+		if err != nil {
+			return err
+		}
+		return msg.walk(inner.Header, inner.Body, depth+1)
+	}
+
+	name := filename(h, params)
+	if name == "" {
+		// a body, not an attachment
+		return nil
+	}
+	data, err := io.ReadAll(decode(h, body))
+	if err != nil {
+		return err
+	}
+	msg.Attachments = append(msg.Attachments, Attachment{Filename: name, Data: data})
+	return nil
+}
+
+// filename is the attachment's name, "" for parts that aren't attachments. Inline parts
+// with a name count, phones like to send scans that way.
+func filename(h header, contentParams map[string]string) string {
+	disposition, params, err := mime.ParseMediaType(h.Get("Content-Disposition"))
+	name := params["filename"]
+	if name == "" {
+		name = contentParams["name"]
+	}
+	if name == "" || (err == nil && disposition != "attachment" && disposition != "inline") {
+		return ""
+	}
+	if decoded, err := decoder.DecodeHeader(name); err == nil {
+		name = decoded
+	}
+	name = filepath.Base(strings.ReplaceAll(strings.TrimSpace(name), `\`, "/"))
+	if name == "." || name == "/" {
+		return ""
+	}
+	return name
+}
+
+func decode(h header, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(h.Get("Content-Transfer-Encoding"))) {
+	case "base64":
+		// the decoder skips the line breaks
+		return base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	}
+	return body
+}
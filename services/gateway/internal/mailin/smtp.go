@@ -0,0 +1,248 @@
+// Package mailin is a small inbound-only SMTP server. It takes mail for one domain, hands
+// every accepted recipient to a Mailbox and never relays anything. There is no STARTTLS,
+// put it behind an MX that terminates TLS when it faces the internet.
+package mailin
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+)
+
+const (
+	maxRecipients = 20
+	// RFC 5321 says servers should wait at least 5 minutes for each command
+	commandTimeout = 5 * time.Minute
+	// how long the mailbox gets to take a message before the sender is told to retry
+	deliverTimeout = 10 * time.Minute
+)
+
+// Mailbox is where accepted mail goes, addresses are given by their local part only
+type Mailbox interface {
+	// Accepts reports whether there is anyone at the address, checked at RCPT TO
+	Accepts(ctx context.Context, local string) bool
+	// Deliver takes a message for one recipient. An error tells the sender to retry later.
+	Deliver(ctx context.Context, local string, msg *Message) error
+}
+
+type Server struct {
+	domain  string
+	maxSize int64
+	mailbox Mailbox
+}
+
+func New(cfg config.Email, mailbox Mailbox) *Server {
+	return &Server{domain: strings.ToLower(cfg.Domain), maxSize: int64(cfg.MaxMessageSize), mailbox: mailbox}
+}
+
+// ListenAndServe accepts SMTP connections on addr until the listener fails
+func (s *Server) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+	log.Println("Inbound email listening on", addr, "for", s.domain)
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			return err
+		}
+		go s.serve(conn)
+	}
+}
+
+// session is the state of one SMTP conversation
+type session struct {
+	*Server
+	conn  net.Conn
+	text  *textproto.Conn
+	from  string
+	rcpts []string
+}
+
+func (s *Server) serve(conn net.Conn) {
+	defer conn.Close()
+	sess := &session{Server: s, conn: conn, text: textproto.NewConn(conn)}
+	sess.reply(220, s.domain+" docstream ESMTP ready")
+
+	for {
+		conn.SetDeadline(time.Now().Add(commandTimeout))
+		line, err := sess.text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "HELO":
+			sess.reset()
+			sess.reply(250, s.domain)
+		case "EHLO":
+			sess.reset()
+			sess.reply(250, s.domain, "8BITMIME", "SIZE "+strconv.FormatInt(s.maxSize, 10))
+		case "MAIL":
+			sess.mail(arg)
+		case "RCPT":
+			sess.rcpt(arg)
+		case "DATA":
+			sess.data()
+		case "RSET":
+			sess.reset()
+			sess.reply(250, "OK")
+		case "NOOP":
+			sess.reply(250, "OK")
+		case "VRFY":
+			sess.reply(252, "Send some mail and see")
+		case "QUIT":
+			sess.reply(221, "Bye")
+			return
+		default:
+			sess.reply(502, "Command not implemented")
+		}
+	}
+}
+
+// reply writes a possibly multi-line response, the first line is the main text
+func (s *session) reply(code int, lines ...string) {
+	for i, line := range lines {
+		sep := "-"
+		if i == len(lines)-1 {
+			sep = " "
+		}
+		s.text.PrintfLine("%d%s%s", code, sep, line)
+	}
+}
+
+func (s *session) reset() {
+	s.from = ""
+	s.rcpts = nil
+}
+
+// path reads the <address> out of "FROM:<a@b> SIZE=123" style arguments
+func path(arg, prefix string) (string, []string, bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", nil, false
+	}
+	fields := strings.Fields(strings.TrimSpace(arg[len(prefix):]))
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "<") || !strings.HasSuffix(fields[0], ">") {
+		return "", nil, false
+	}
+	return strings.Trim(fields[0], "<>"), fields[1:], true
+}
+
+func (s *session) mail(arg string) {
+	if s.from != "" {
+		s.reply(503, "Sender already given")
+		return
+	}
+	from, params, ok := path(arg, "FROM:")
+	if !ok {
+		s.reply(501, "Syntax: MAIL FROM:<address>")
+		return
+	}
+	for _, param := range params {
+		if size, ok := strings.CutPrefix(strings.ToUpper(param), "SIZE="); ok {
+			if n, err := strconv.ParseInt(size, 10, 64); err == nil && n > s.maxSize {
+				s.reply(552, "Message is too large")
+				return
+			}
+		}
+	}
+	// the null sender of bounces is "<>", keep something to tell it was given
+	s.from = cmp.Or(from, "<>")
+	s.reply(250, "OK")
+}
+
+func (s *session) rcpt(arg string) {
+	if s.from == "" {
+		s.reply(503, "Need MAIL first")
+		return
+	}
+	to, _, ok := path(arg, "TO:")
+	if !ok {
+		s.reply(501, "Syntax: RCPT TO:<address>")
+		return
+	}
+	if len(s.rcpts) >= maxRecipients {
+		s.reply(452, "Too many recipients")
+		return
+	}
+
+	local, domain, ok := strings.Cut(to, "@")
+	if !ok || !strings.EqualFold(domain, s.domain) {
+		s.reply(550, "Relaying not allowed")
+		return
+	}
+	local = strings.ToLower(local)
+	if !s.mailbox.Accepts(context.Background(), local) {
+		s.reply(550, "No such user")
+		return
+	}
+	s.rcpts = append(s.rcpts, local)
+	s.reply(250, "OK")
+}
+
+func (s *session) data() {
+	if len(s.rcpts) == 0 {
+		s.reply(503, "Need RCPT first")
+		return
+	}
+	s.reply(354, "End data with <CR><LF>.<CR><LF>")
+
+	// read one byte past the limit to tell a message that fits from one that doesn't,
+	// the rest is drained so the conversation can carry on
+	body := s.text.DotReader()
+	raw, err := io.ReadAll(io.LimitReader(body, s.maxSize+1))
+	if err == nil && int64(len(raw)) > s.maxSize {
+		_, err = io.Copy(io.Discard, body)
+		if err == nil {
+			s.reset()
+			s.reply(552, "Message is too large")
+			return
+		}
+	}
+	if err != nil {
+		s.conn.Close()
+		return
+	}
+
+	msg, err := Parse(raw)
+	if err != nil {
+		s.reset()
+		s.reply(554, "Unable to parse message: "+err.Error())
+		return
+	}
+	msg.Sender = s.from
+
+	ctx, cancel := context.WithTimeout(context.Background(), deliverTimeout)
+	defer cancel()
+	s.conn.SetDeadline(time.Now().Add(deliverTimeout))
+	var failed error
+	for _, rcpt := range s.rcpts {
+		if err := s.mailbox.Deliver(ctx, rcpt, msg); err != nil {
+			log.Printf("Delivering mail from %s to %s failed: %v\n", s.from, rcpt, err)
+			failed = err
+		}
+	}
+	s.reset()
+	if failed != nil {
+		s.reply(451, "Temporary failure, try again later")
+		return
+	}
+	s.reply(250, fmt.Sprintf("OK, %d attachments", len(msg.Attachments)))
+}
@@ -0,0 +1,98 @@
+// Package mailout sends the gateway's few emails, plain text through one SMTP relay. The
+// counterpart of mailin, which only ever receives.
+package mailout
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+)
+
+const sendTimeout = 30 * time.Second
+
+// Sender delivers mail to the relay, a nil Sender has mail turned off
+type Sender struct {
+	cfg config.SMTP
+}
+
+// New returns nil when no relay is configured
+func New(cfg config.SMTP) *Sender {
+	if cfg.Addr == "" {
+		return nil
+	}
+	log.Printf("Sending mail through %s as %s\n", cfg.Addr, cfg.From)
+	return &Sender{cfg: cfg}
+}
+
+// Send hands one message to the relay, body is plain text
+func (s *Sender) Send(ctx context.Context, to, subject, body string) error {
+	if strings.ContainsAny(to, "\r\n") {
+		return fmt.Errorf("bad recipient %q", to)
+	}
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	host, _, _ := net.SplitHostPort(s.cfg.Addr)
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if s.cfg.Username != "" {
+		// PlainAuth refuses to send the password without TLS, unless the relay is on localhost
+		if err := client.Auth(smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(s.cfg.From); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	headers := []string{
+		"From: " + s.cfg.From,
+		"To: " + to,
+		"Subject: " + mime.QEncoding.Encode("utf-8", subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+		"Content-Transfer-Encoding: 8bit",
+	}
+	// SMTP wants CRLF line endings, a lone dot would end the message but the writer escapes those
+	message := strings.Join(headers, "\r\n") + "\r\n\r\n" + strings.ReplaceAll(body, "\n", "\r\n")
+	if _, err := w.Write([]byte(message)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "docstream_http_requests_total",
+		Help: "HTTP requests handled, by route and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "docstream_http_request_duration_seconds",
+		Help:    "HTTP request latency by route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	// UploadBytes counts bytes accepted into MinIO, by how they arrived
+	UploadBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "docstream_upload_bytes_total",
+		Help: "Bytes uploaded to object storage.",
+	}, []string{"kind"}) // "single", "chunked", "batch", "url", "email", "connector", "version" or "grpc"
+
+	// MinioPutDuration times writes to MinIO
+	MinioPutDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "docstream_minio_put_duration_seconds",
+		Help: "Time spent writing objects to MinIO.",
+		// uploads can take a while, go up to ~10 minutes
+		Buckets: prometheus.ExponentialBuckets(0.01, 4, 9),
+	}, []string{"operation", "result"})
+
+	// PublishFailures counts queue publishes that gave up after every retry, on Kafka the
+	// exchange label is the topic. The name is from when RabbitMQ was the only queue.
+	PublishFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "docstream_rabbitmq_publish_failures_total",
+		Help: "Queue publishes that failed after all retries.",
+	}, []string{"exchange", "routing_key"})
+
+	// CircuitOpen is 1 while the circuit breaker in front of a dependency is open
+	CircuitOpen = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "docstream_circuit_open",
+		Help: "Whether the circuit breaker in front of a dependency is open.",
+	}, []string{"dependency"})
+
+	// VirusScans counts ClamAV verdicts on uploads
+	VirusScans = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "docstream_virus_scans_total",
+		Help: "Uploads scanned by ClamAV, by result.",
+	}, []string{"result"}) // "clean", "infected" or "error"
+
+	// IngestionBacklog is how many jobs waited for a worker at the last backpressure poll
+	IngestionBacklog = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "docstream_ingestion_backlog",
+		Help: "Jobs in the ingestion queue no worker has taken yet.",
+	})
+
+	// UploadsShed counts uploads turned away because the backlog was full
+	UploadsShed = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "docstream_uploads_shed_total",
+		Help: "Uploads refused while the ingestion backlog was over its limit.",
+	})
+
+	// AuthAttempts counts authentication outcomes, action is "login", "refresh", "oauth", "token" or "apikey"
+	AuthAttempts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "docstream_auth_attempts_total",
+		Help: "Authentication attempts by action and result.",
+	}, []string{"action", "result"})
+)
+
+// Auth records one authentication outcome
+func Auth(action string, ok bool) {
+	result := "success"
+	if !ok {
+		result = "failure"
+	}
+	AuthAttempts.WithLabelValues(action, result).Inc()
+}
+
+// ObserveMinioPut records how long a MinIO write started at start took
+func ObserveMinioPut(operation string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	MinioPutDuration.WithLabelValues(operation, result).Observe(time.Since(start).Seconds())
+}
+
+// Middleware records latency and status for every request.
+// Routes are labelled by their pattern (/jobs/:id) so IDs don't blow up the label count.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+
+		httpRequests.WithLabelValues(c.Request.Method, route, status).Inc()
+		httpDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// ListenAndServe serves the Prometheus scrape endpoint at /metrics on addr, a listener apart
+// from the API so it never ends up on the public port
+func ListenAndServe(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	return srv.ListenAndServe()
+}
@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// RequireAdmin only lets admins through, it must run after RequireAuth.
+// The flag is read from the database on every request so revoking it takes effect immediately.
+func RequireAdmin(store storage.UserStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := store.GetUserByID(c.Request.Context(), UserID(c))
+		if err != nil || !user.IsAdmin {
+			apierror.Abort(c, http.StatusForbidden, "Admin access required")
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/gin-gonic/gin"
+)
+
+// retryAfterSeconds is what clients are told to wait while a dependency is down
+const retryAfterSeconds = 5
+
+// Dependency is something a route can't work without. Check must be cheap (no network
+// round trip, it runs on every request) and return nil while the dependency is usable.
+type Dependency struct {
+	Name  string
+	Check func() error
+}
+
+// RequireAvailable answers 503 with a Retry-After straight away while any of deps is down,
+// instead of letting the request hang on timeouts and retries only to fail anyway
+func RequireAvailable(deps ...Dependency) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, dep := range deps {
+			if dep.Check() != nil {
+				Unavailable(c, dep.Name)
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// Unavailable aborts with the 503 RequireAvailable sends, for handlers finding out mid-request
+func Unavailable(c *gin.Context, name string) {
+	c.Header("Retry-After", strconv.Itoa(retryAfterSeconds))
+	apierror.Abort(c, http.StatusServiceUnavailable, name+" is unavailable, try again shortly")
+}
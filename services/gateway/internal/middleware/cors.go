@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+)
+
+// corsHeaders are the request headers the gateway reads itself, browsers may always send them
+var corsHeaders = []string{"Origin", "Content-Type", "Authorization", APIKeyHeader, apierror.RequestIDHeader}
+
+// Origins are the browser origins allowed to call the API and open its WebSockets
+type Origins struct {
+	any     bool
+	exact   map[string]bool
+	domains []origin // *.example.com patterns, host holds the part after the *
+}
+
+type origin struct {
+	scheme, host, port string
+}
+
+// NewOrigins parses origins like https://app.example.com, https://*.example.com for any of
+// its subdomains (but not example.com itself) or *, which allows every origin
+func NewOrigins(patterns []string) (*Origins, error) {
+	o := &Origins{exact: map[string]bool{}}
+	for _, p := range patterns {
+		if p == "*" {
+			o.any = true
+			continue
+		}
+		u, err := url.Parse(p)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" || u.RawQuery != "" || u.User != nil {
+			return nil, fmt.Errorf("invalid cors origin %q, expected something like https://app.example.com or https://*.example.com", p)
+		}
+		host := strings.ToLower(u.Hostname())
+		if rest, ok := strings.CutPrefix(host, "*."); ok {
+			if rest == "" || strings.Contains(rest, "*") {
+				return nil, fmt.Errorf("invalid cors origin %q, * only stands for the leftmost labels", p)
+			}
+			o.domains = append(o.domains, origin{scheme: u.Scheme, host: "." + rest, port: u.Port()})
+			continue
+		}
+		if strings.Contains(host, "*") {
+			return nil, fmt.Errorf("invalid cors origin %q, * only stands for the leftmost labels", p)
+		}
+		o.exact[u.Scheme+"://"+strings.ToLower(u.Host)] = true
+	}
+	return o, nil
+}
+
+// Allowed reports whether a browser at origin may make requests, an Origin header's value
+func (o *Origins) Allowed(value string) bool {
+	if o.any {
+		return true
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if o.exact[u.Scheme+"://"+strings.ToLower(u.Host)] {
+		return true
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, d := range o.domains {
+		if u.Scheme == d.scheme && u.Port() == d.port && strings.HasSuffix(host, d.host) {
+			return true
+		}
+	}
+	return false
+}
+
+// CORS answers preflights and sets the CORS headers for the allowed origins. cfg.Headers come
+// on top of the ones the gateway reads itself.
+func CORS(origins *Origins, cfg config.CORS) gin.HandlerFunc {
+	return cors.New(cors.Config{
+		AllowOriginFunc:  origins.Allowed,
+		AllowMethods:     cfg.Methods,
+		AllowHeaders:     append(append([]string{}, corsHeaders...), cfg.Headers...),
+		ExposeHeaders:    []string{"Content-Length", apierror.RequestIDHeader},
+		AllowCredentials: true,
+		MaxAge:           cfg.MaxAge,
+	})
+}
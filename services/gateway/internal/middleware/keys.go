@@ -0,0 +1,238 @@
+package middleware
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minSecretLength is the shortest HS256 secret accepted, anything shorter can be brute forced
+const minSecretLength = 32
+
+// legacyKID is what a bare JWT_SECRET is known as, tokens signed before key IDs existed carry no kid and map to it
+const legacyKID = "default"
+
+// signingKey is one entry of the keyring. verify is the HMAC secret or the RSA public key,
+// sign is only set for the key new tokens are signed with.
+type signingKey struct {
+	kid    string
+	method jwt.SigningMethod
+	sign   any
+	verify any
+}
+
+// keyring holds every key tokens may be signed with. The first configured key signs new
+// tokens, the rest only verify, which is what makes rotation possible without logging everyone out.
+type keyring struct {
+	signer  *signingKey
+	byKID   map[string]*signingKey
+	methods []string
+}
+
+// loadedKeys is set once by LoadKeys at startup, before anything is served
+var loadedKeys *keyring
+
+// LoadKeys checks the signing key configuration and loads it, call it before serving anything.
+//
+//	JWT_ALGORITHM=HS256 (default): JWT_KEYS=<kid>:<secret>,<kid>:<secret>,... or just JWT_SECRET
+//	JWT_ALGORITHM=RS256:           JWT_KEYS=<kid>:<path to PEM>,...
+//
+// The first key signs, the others are still accepted until they are removed. For RS256
+// the first PEM must be a private key, older ones can be public keys only.
+func LoadKeys(cfg config.JWT) error {
+	loaded, err := loadKeyring(cfg)
+	if err != nil {
+		return err
+	}
+	loadedKeys = loaded
+	return nil
+}
+
+func keys() (*keyring, error) {
+	if loadedKeys == nil {
+		return nil, errors.New("JWT keys are not loaded")
+	}
+	return loadedKeys, nil
+}
+
+func loadKeyring(cfg config.JWT) (*keyring, error) {
+	alg := cfg.Algorithm
+	if alg == "" {
+		alg = jwt.SigningMethodHS256.Alg()
+	}
+
+	entries := splitKeys(cfg.Keys)
+	if len(entries) == 0 && alg == jwt.SigningMethodHS256.Alg() {
+		if secret := cfg.Secret; secret != "" {
+			entries = [][2]string{{legacyKID, secret}}
+		}
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("no JWT signing key configured, set JWT_KEYS or JWT_SECRET")
+	}
+
+	ring := &keyring{byKID: map[string]*signingKey{}, methods: []string{alg}}
+	for i, entry := range entries {
+		kid, value := entry[0], entry[1]
+		if _, dup := ring.byKID[kid]; dup {
+			return nil, fmt.Errorf("JWT key id %q is used twice", kid)
+		}
+
+		var key *signingKey
+		var err error
+		switch alg {
+		case jwt.SigningMethodHS256.Alg():
+			key, err = hmacKey(kid, value)
+		case jwt.SigningMethodRS256.Alg():
+			key, err = rsaKey(kid, value, i == 0)
+		default:
+			err = fmt.Errorf("unsupported JWT_ALGORITHM %q, use HS256 or RS256", alg)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		ring.byKID[kid] = key
+		if i == 0 {
+			ring.signer = key
+		}
+	}
+	return ring, nil
+}
+
+// splitKeys parses "kid:value,kid:value", values may contain colons themselves
+func splitKeys(s string) [][2]string {
+	var entries [][2]string
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kid, value, ok := strings.Cut(part, ":")
+		if !ok {
+			// a bare value gets the legacy id, so JWT_KEYS=<secret> works too
+			kid, value = legacyKID, part
+		}
+		entries = append(entries, [2]string{strings.TrimSpace(kid), strings.TrimSpace(value)})
+	}
+	return entries
+}
+
+func hmacKey(kid, secret string) (*signingKey, error) {
+	if len(secret) < minSecretLength {
+		return nil, fmt.Errorf("JWT key %q is too short, use at least %d characters", kid, minSecretLength)
+	}
+	return &signingKey{kid: kid, method: jwt.SigningMethodHS256, sign: []byte(secret), verify: []byte(secret)}, nil
+}
+
+func rsaKey(kid, path string, mustSign bool) (*signingKey, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading JWT key %q: %w", kid, err)
+	}
+
+	if private, err := jwt.ParseRSAPrivateKeyFromPEM(pem); err == nil {
+		return &signingKey{kid: kid, method: jwt.SigningMethodRS256, sign: private, verify: &private.PublicKey}, nil
+	}
+	if mustSign {
+		return nil, fmt.Errorf("JWT key %q must be an RSA private key, it signs new tokens", kid)
+	}
+	public, err := jwt.ParseRSAPublicKeyFromPEM(pem)
+	if err != nil {
+		return nil, fmt.Errorf("JWT key %q is neither an RSA private nor public key", kid)
+	}
+	return &signingKey{kid: kid, method: jwt.SigningMethodRS256, verify: public}, nil
+}
+
+// SignToken signs claims with the current key, putting its id in the kid header
+func SignToken(claims jwt.Claims) (string, error) {
+	ring, err := keys()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(ring.signer.method, claims)
+	token.Header["kid"] = ring.signer.kid
+	return token.SignedString(ring.signer.sign)
+}
+
+// ParseSignedToken checks a token SignToken made, its signature and expiry, and returns its claims
+func ParseSignedToken(tokenString string, opts ...jwt.ParserOption) (jwt.MapClaims, error) {
+	opts = append(opts, jwt.WithValidMethods(validMethods()), jwt.WithExpirationRequired())
+	token, err := jwt.Parse(tokenString, verificationKey, opts...)
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("unexpected claims type")
+	}
+	return claims, nil
+}
+
+// verificationKey finds the key a token says it was signed with
+func verificationKey(t *jwt.Token) (any, error) {
+	ring, err := keys()
+	if err != nil {
+		return nil, err
+	}
+	kid, _ := t.Header["kid"].(string)
+	if kid == "" {
+		kid = legacyKID
+	}
+	key, ok := ring.byKID[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key.verify, nil
+}
+
+func validMethods() []string {
+	ring, err := keys()
+	if err != nil {
+		return nil
+	}
+	return ring.methods
+}
+
+// JWK is a public key in JSON Web Key form
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// PublicJWKs lists the RSA public keys tokens may be verified with, empty with HS256 since those secrets can't be shared
+func PublicJWKs() []JWK {
+	jwks := []JWK{}
+	ring, err := keys()
+	if err != nil {
+		return jwks
+	}
+	for _, key := range ring.byKID {
+		public, ok := key.verify.(*rsa.PublicKey)
+		if !ok {
+			continue
+		}
+		jwks = append(jwks, JWK{
+			Kty: "RSA",
+			Kid: key.kid,
+			Use: "sig",
+			Alg: key.method.Alg(),
+			N:   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+		})
+	}
+	sort.Slice(jwks, func(i, j int) bool { return jwks[i].Kid < jwks[j].Kid })
+	return jwks
+}
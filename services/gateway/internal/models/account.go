@@ -0,0 +1,10 @@
+package models
+
+// AccountDeletion is what DELETE /me did straight away, the purge_accounts schedule removes
+// the trashed documents' objects and vectors after it
+type AccountDeletion struct {
+	Documents int `json:"documents"`         // moved to the trash to be purged
+	OnHold    int `json:"documents_on_hold"` // under legal hold, they stay until it is lifted
+	Sessions  int `json:"sessions_ended"`
+	APIKeys   int `json:"api_keys_revoked"`
+}
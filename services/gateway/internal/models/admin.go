@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// Quota overrides the configured per-user rate limits for one user. Each is a rate like 10/m
+// or "off", empty keeps the configured one.
+type Quota struct {
+	UserID    int       `json:"user_id"`
+	Uploads   string    `json:"uploads"`
+	Search    string    `json:"search"`
+	Ask       string    `json:"ask"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Rate is the override of the limit called name, uploads, search or ask
+func (q Quota) Rate(name string) string {
+	switch name {
+	case "uploads":
+		return q.Uploads
+	case "search":
+		return q.Search
+	case "ask":
+		return q.Ask
+	}
+	return ""
+}
+
+// SystemStats are the totals GET /admin/stats reports
+type SystemStats struct {
+	Users     UserCounts     `json:"users"`
+	Documents DocumentCounts `json:"documents"`
+	// StorageBytes is what every version of the documents that aren't purged takes up
+	StorageBytes int64          `json:"storage_bytes"`
+	JobsByStatus map[string]int `json:"jobs_by_status"`
+}
+
+type UserCounts struct {
+	Total     int `json:"total"` // deleted accounts aren't counted
+	Admins    int `json:"admins"`
+	Suspended int `json:"suspended"`
+	Deleted   int `json:"deleted"`
+}
+
+type DocumentCounts struct {
+	Total   int `json:"total"` // live documents, the trash isn't counted
+	Trashed int `json:"trashed"`
+}
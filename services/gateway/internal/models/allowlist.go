@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// AllowedModel is a model callers may pick for a request over the configured one, an admin
+// keeps the list. Prices are informational, in USD per million tokens.
+type AllowedModel struct {
+	Kind        string  `json:"kind"` // ModelKind*
+	Name        string  `json:"name"` // as the provider knows it
+	Description string  `json:"description,omitempty"`
+	InputPrice  float64 `json:"input_price"`
+	OutputPrice float64 `json:"output_price"`
+	// MaxInputTokens is the largest chunk_size jobs embedding with the model may use, for a
+	// generation model how big the prompt may get. 0 leaves it to the provider.
+	MaxInputTokens int `json:"max_input_tokens"`
+	// MaxOutputTokens caps what a generation model writes, 0 leaves it to the provider
+	MaxOutputTokens int       `json:"max_output_tokens"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// Model kinds
+const (
+	ModelKindEmbedding  = "embedding"  // documents and queries are embedded with it
+	ModelKindGeneration = "generation" // answers and summaries are written by it
+)
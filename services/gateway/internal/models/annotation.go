@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Annotation is a highlight or comment on a range of a document's text. Start and End are byte
+// offsets into the extracted text like a chunk's, Page is where the range starts when known.
+type Annotation struct {
+	ID         string    `json:"id"`
+	DocumentID string    `json:"document_id"`
+	UserID     int       `json:"user_id"` // who made it
+	Email      string    `json:"email"`
+	Kind       string    `json:"kind"`
+	Page       int       `json:"page,omitempty"`
+	Start      int       `json:"start"`
+	End        int       `json:"end"`
+	Quote      string    `json:"quote"` // the text between Start and End
+	Body       string    `json:"body,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Annotation kinds, a comment has a body and a highlight may have one
+const (
+	AnnotationHighlight = "highlight"
+	AnnotationComment   = "comment"
+)
+
+// AnnotationMatch is an annotation a search found, scored like a ChunkMatch
+type AnnotationMatch struct {
+	Annotation Annotation
+	Score      float64
+}
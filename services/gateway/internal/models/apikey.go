@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// APIKey lets scripts and CI authenticate with X-API-Key instead of logging in.
+// Only a hash of the key is stored, Key is filled in once when it is minted.
+type APIKey struct {
+	ID         string     `json:"id"`
+	UserID     int        `json:"user_id"`
+	Name       string     `json:"name"`
+	Key        string     `json:"key,omitempty"`
+	Prefix     string     `json:"prefix"` // the first few characters, to tell keys apart in listings
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	// OwnerSuspended is only filled in by GetAPIKeyByHash, keys stop working while it's true
+	OwnerSuspended bool `json:"-"`
+}
+
+// API key scopes
+const (
+	ScopeUpload          = "upload"
+	ScopeDocumentsRead   = "documents:read"
+	ScopeDocumentsDelete = "documents:delete"
+	ScopeJobsRead        = "jobs:read"
+	ScopeJobsWrite       = "jobs:write"
+)
+
+// HasScope reports whether the key was minted with scope
+func (k APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package models
+
+import "time"
+
+// AuditEntry records a security relevant event, like an account being locked, or something
+// done to a document, which its activity feed shows
+type AuditEntry struct {
+	ID     int    `json:"id"`
+	UserID *int   `json:"user_id"` // nil when the event isn't tied to a known user
+	Event  string `json:"event"`
+	IP     string `json:"ip"`
+	Detail string `json:"detail"`
+	// DocumentID is the document the event happened to, OrgID its organization. The store
+	// fills OrgID in from the document when it is left out.
+	DocumentID string    `json:"document_id,omitempty"`
+	OrgID      string    `json:"org_id,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Activity is an audit entry the way the activity feeds show it, who did it by email instead
+// of where from
+type Activity struct {
+	ID         int       `json:"id"`
+	Event      string    `json:"event"`
+	UserID     *int      `json:"user_id"` // nil for what happened on its own, like processing
+	Email      string    `json:"email,omitempty"`
+	DocumentID string    `json:"document_id,omitempty"`
+	Detail     string    `json:"detail"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Audit events
+const (
+	AuditLoginLockout = "login.lockout"
+	AuditLogout       = "logout"
+	// sessions logged out through /me/sessions, one or all of them
+	AuditSessionRevoked  = "session.revoke"
+	AuditPasswordChanged = "password.change"
+	// DELETE /me, and the purge_accounts schedule finishing what it started
+	AuditAccountDeleted = "account.delete"
+	AuditAccountPurged  = "account.purge"
+	// POST /me/export, someone holding the account's token could take all of it
+	AuditAccountExported = "account.export"
+	// what admins do to other accounts under /admin/users
+	AuditUserSuspended   = "admin.suspend"
+	AuditUserReactivated = "admin.reactivate"
+	AuditQuotaChanged    = "admin.quota"
+	// the models callers may pick, under /admin/models
+	AuditModelChanged = "admin.model"
+	// plans changing under /admin/plans, and users and organizations moved to another one
+	AuditPlanChanged = "admin.plan"
+	// a subscription moving an account to another plan, and accounts going read-only or back
+	AuditSubscription = "billing.subscription"
+	AuditReadOnly     = "billing.read_only"
+	// starting, switching over and cancelling embedding migrations
+	AuditEmbeddingMigration = "admin.embeddings"
+
+	// retention: rules changing, holds, and documents deleted or purged by them
+	AuditRetentionPolicy  = "retention.policy"
+	AuditLegalHold        = "retention.hold"
+	AuditLegalHoldRelease = "retention.release"
+	AuditDeleteBlocked    = "retention.blocked"
+	AuditDocumentExpired  = "retention.expire"
+	AuditDocumentPurged   = "retention.purge"
+
+	// activity on documents: uploads, each job finishing, shares with users or by link, comments
+	// and reprocessing. A share of a collection names the collection in the detail.
+	AuditDocumentUploaded    = "document.upload"
+	AuditDocumentProcessed   = "document.process"
+	AuditDocumentShared      = "document.share"
+	AuditCollectionShared    = "collection.share"
+	AuditDocumentCommented   = "document.comment"
+	AuditDocumentReprocessed = "document.reprocess"
+)
+
+// LoginThrottle tracks failed logins for one key, "email:<address>" or "ip:<address>"
+type LoginThrottle struct {
+	Key          string
+	Failures     int
+	LastFailedAt time.Time
+	LockedUntil  time.Time // zero when not locked
+}
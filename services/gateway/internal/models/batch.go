@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// Batch groups the documents of one multi-file upload so their progress can be followed together
+type Batch struct {
+	ID        string    `json:"batch_id"`
+	UserID    int       `json:"user_id"`
+	OrgID     string    `json:"org_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Status and Counts are worked out from the items' jobs when the batch is loaded
+	Status string         `json:"status"`
+	Counts map[string]int `json:"counts"`
+	Items  []BatchItem    `json:"items"`
+}
+
+// BatchItem is one file of a batch. A rejected file has an Error and no document,
+// a duplicate points at the document that already had its content.
+type BatchItem struct {
+	Position   int    `json:"-"`
+	Filename   string `json:"filename"` // the name in the request, or the path inside a zip archive
+	DocumentID string `json:"document_id,omitempty"`
+	JobID      string `json:"job_id,omitempty"`
+	Duplicate  bool   `json:"duplicate,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Status     string `json:"status"` // the job's status, or rejected
+}
+
+// Batch statuses. partial means everything is done but only some of it completed.
+const (
+	BatchStatusProcessing = "processing"
+	BatchStatusCompleted  = "completed"
+	BatchStatusPartial    = "partial"
+	BatchStatusFailed     = "failed"
+)
+
+// BatchItemRejected is the status of a file that never became a job
+const BatchItemRejected = "rejected"
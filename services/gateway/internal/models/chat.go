@@ -0,0 +1,66 @@
+package models
+
+import "time"
+
+// Chat is a conversation with the LLM about a user's documents. Every question is answered from
+// the documents in its scope: one document, the documents of a collection and its
+// sub-collections, an organization's, or without any of those everything the user can read.
+type Chat struct {
+	ID           string    `json:"id"`
+	UserID       int       `json:"user_id"`
+	Title        string    `json:"title"` // the first question unless one was given
+	OrgID        string    `json:"org_id,omitempty"`
+	CollectionID string    `json:"collection_id,omitempty"`
+	DocumentID   string    `json:"document_id,omitempty"`
+	Mode         string    `json:"mode,omitempty"` // how sources are retrieved, as for /search
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"` // when the last message was added
+
+	// Messages are only filled in when a single chat is fetched
+	Messages []ChatMessage `json:"messages,omitempty"`
+}
+
+// ChatMessage is one turn of a chat, a question or the answer to it
+type ChatMessage struct {
+	ID      int    `json:"id"`
+	Role    string `json:"role"` // user or assistant
+	Content string `json:"content"`
+	// Query is what a question was searched as, rewritten to stand on its own
+	Query string `json:"query,omitempty"`
+	// Sources are the chunks an answer was built from
+	Sources []Source `json:"sources,omitempty"`
+	// Citations are the passages of the sources an answer's sentences rest on
+	Citations []Citation `json:"citations,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Source is a chunk an answer was built from, N is the number the model cites it by
+type Source struct {
+	N          int     `json:"n"`
+	DocumentID string  `json:"document_id"`
+	Filename   string  `json:"filename"`
+	Page       int     `json:"page,omitempty"`
+	ChunkIndex int     `json:"chunk_index"`
+	ChunkID    string  `json:"chunk_id"` // for GET /chunks/:id
+	Score      float32 `json:"score"`
+	// Cited says whether the answer actually refers to this source
+	Cited bool `json:"cited"`
+}
+
+// Citation traces a sentence of an answer to the passage of the source it cites. Start and End are
+// byte offsets into the document's extracted text, like those of the chunk GET /chunks/:id returns,
+// so the passage is the chunk's text from Start-chunk.start to End-chunk.start.
+type Citation struct {
+	N          int    `json:"n"` // the source cited, as [n]
+	DocumentID string `json:"document_id"`
+	ChunkID    string `json:"chunk_id"`
+	Page       int    `json:"page,omitempty"`
+	Start      int    `json:"start"`
+	End        int    `json:"end"`
+	// Confidence is the share of the sentence's words found in the passage, 0 to 1. With 0
+	// nothing matched and the passage is the whole chunk.
+	Confidence float64 `json:"confidence"`
+	// AnswerStart and AnswerEnd are the byte offsets of the citing sentence in the answer
+	AnswerStart int `json:"answer_start"`
+	AnswerEnd   int `json:"answer_end"`
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"slices"
+	"strings"
+)
+
+// Chunk is a piece of a document's text the way the worker split it off, keyword search matches them
+type Chunk struct {
+	Index   int    `json:"index"`
+	Page    int    `json:"page,omitempty"` // 1-based PDF page, slide or sheet
+	Start   int    `json:"start"`          // byte offsets into the document's extracted text
+	End     int    `json:"end"`
+	Heading string `json:"heading,omitempty"`
+	Text    string `json:"text"`
+}
+
+// ChunkMatch is a keyword search hit, higher scores match better
+type ChunkMatch struct {
+	DocumentID string
+	Chunk      Chunk
+	Score      float64
+}
+
+// JoinChunks puts a document's extracted text back together from its chunks. Chunks overlap,
+// each one's Start and End say where it was in the text, so only the part past what was
+// already written is added. Gaps, text that was never indexed, become a line break.
+func JoinChunks(chunks []Chunk) string {
+	chunks = slices.Clone(chunks)
+	slices.SortStableFunc(chunks, func(a, b Chunk) int { return a.Start - b.Start })
+
+	var b strings.Builder
+	covered := -1
+	for _, c := range chunks {
+		if c.End <= covered {
+			continue
+		}
+		text := c.Text
+		if covered > c.Start {
+			skip := covered - c.Start
+			if skip >= len(text) {
+				continue
+			}
+			text = text[skip:]
+		} else if covered >= 0 && c.Start > covered {
+			b.WriteString("\n")
+		}
+		b.WriteString(text)
+		covered = c.End
+	}
+	return b.String()
+}
+
+// TextBetween returns the part of a document's extracted text between byte offsets start and
+// end, taken from its chunks. It is false when the chunks don't cover all of it.
+func TextBetween(chunks []Chunk, start, end int) (string, bool) {
+	chunks = slices.Clone(chunks)
+	slices.SortStableFunc(chunks, func(a, b Chunk) int { return a.Start - b.Start })
+
+	var b strings.Builder
+	covered := start
+	for _, c := range chunks {
+		if covered >= end {
+			break
+		}
+		if c.End <= covered {
+			continue
+		}
+		if c.Start > covered || c.End-c.Start != len(c.Text) {
+			return "", false
+		}
+		b.WriteString(c.Text[covered-c.Start : min(end, c.End)-c.Start])
+		covered = min(end, c.End)
+	}
+	return b.String(), covered >= end
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Collection is a folder of documents. Like a document it is personal or belongs to an
+// organization, and it can sit inside another collection of the same owner.
+type Collection struct {
+	ID        string    `json:"id"`
+	UserID    int       `json:"user_id"`             // who created it
+	OrgID     string    `json:"org_id,omitempty"`    // empty for personal collections
+	ParentID  string    `json:"parent_id,omitempty"` // empty at the top level
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Options are the pipeline defaults for documents filed in here, fields left unset
+	// come from the parent collection and then the worker
+	Options *JobOptions `json:"options,omitempty"`
+
+	// SharedPermission is read or comment when the caller only sees it because it was shared with them
+	SharedPermission string `json:"shared_permission,omitempty"`
+}
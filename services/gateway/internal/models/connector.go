@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// Connector is a linked cloud storage account. Its folders are synced on a schedule, new and
+// changed files become documents of the connector's owner, in its organization and collection.
+type Connector struct {
+	ID           string            `json:"id"`
+	UserID       int               `json:"user_id"`
+	OrgID        string            `json:"org_id,omitempty"`
+	CollectionID string            `json:"collection_id,omitempty"`
+	Provider     string            `json:"provider"` // google_drive or dropbox
+	Account      string            `json:"account,omitempty"`
+	Status       string            `json:"status"`
+	Error        string            `json:"error,omitempty"` // why the last sync failed
+	Folders      []ConnectorFolder `json:"folders"`
+	LastSyncedAt *time.Time        `json:"last_synced_at,omitempty"`
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+
+	// the OAuth state while the account is being linked, then the provider's tokens
+	OAuthState   string    `json:"-"`
+	AccessToken  string    `json:"-"`
+	RefreshToken string    `json:"-"`
+	TokenExpiry  time.Time `json:"-"`
+}
+
+// ConnectorFolder is a remote folder to sync, by the provider's ID. Name is just for display.
+type ConnectorFolder struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// ConnectorFile remembers which revision of a remote file was last taken in
+type ConnectorFile struct {
+	ConnectorID string
+	RemoteID    string
+	Revision    string
+	DocumentID  string
+	Error       string
+}
+
+// Connector statuses, an errored connector needs linking again
+const (
+	ConnectorStatusPending = "pending"
+	ConnectorStatusActive  = "active"
+	ConnectorStatusError   = "error"
+)
@@ -0,0 +1,15 @@
+package models
+
+// Files the worker renders for a document, these must match the worker's models
+const (
+	ThumbnailFile = "thumbnail.png"
+	PreviewFile   = "preview.png"
+)
+
+// DerivedFiles is everything the worker may have rendered for a document
+var DerivedFiles = []string{ThumbnailFile, PreviewFile}
+
+// DerivedKey is where a file rendered from a document is stored, in the document's bucket
+func DerivedKey(documentID, file string) string {
+	return "derived/" + documentID + "/" + file
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Document is a stored object owned by a user, optionally shared with an organization
+type Document struct {
+	ID          string     `json:"id"`
+	UserID      int        `json:"user_id"`          // who uploaded it
+	OrgID       string     `json:"org_id,omitempty"` // empty for personal documents
+	Bucket      string     `json:"bucket"`
+	ObjectKey   string     `json:"object_key"`
+	Filename    string     `json:"filename"` // the original name the user uploaded
+	ContentType string     `json:"content_type"`
+	Size        int64      `json:"size"`
+	SHA256      string     `json:"sha256,omitempty"` // hex digest of the content, used to spot re-uploads
+	Status      string     `json:"status"` // mirrors the status of its latest job
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"` // set once soft-deleted, hidden from the API after that
+	ScanStatus  string     `json:"scan_status,omitempty"` // empty when virus scanning is off
+	ScanResult  string     `json:"scan_result,omitempty"` // the signature found, or why the scan failed
+	ScannedAt   *time.Time `json:"scanned_at,omitempty"`
+	// Tags and Metadata are whatever the uploader attached, they also end up next to the vectors
+	Tags     []string          `json:"tags,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// CollectionID is empty when it isn't filed in any collection
+	CollectionID string `json:"collection_id,omitempty"`
+	// Language is the ISO 639-1 code the worker detected, empty until processed or if it couldn't tell
+	Language string `json:"language,omitempty"`
+	// Class is what the worker's classify stage labelled it, like invoice, empty if it fits none
+	Class string `json:"class,omitempty"`
+	// Summary and KeyPoints are what an LLM wrote about it once processed, if summaries are on
+	Summary   string   `json:"summary,omitempty"`
+	KeyPoints []string `json:"key_points,omitempty"`
+	// Entities are only filled in when a single document is fetched
+	Entities []Entity `json:"entities,omitempty"`
+	// Version is the number of the current version, whose object, name, type, size and hash these are
+	Version int `json:"version"`
+	// LegalHold keeps the document from being deleted or purged until the hold is lifted
+	LegalHold bool `json:"legal_hold"`
+	// PurgeAt is when a document in the trash goes for good, it is only filled in on the trash listing
+	PurgeAt *time.Time `json:"purge_at,omitempty"`
+	// SharedPermission is read or comment when the caller only sees it because it was shared with them
+	SharedPermission string `json:"shared_permission,omitempty"`
+	// EncryptionKey is the wrapped data key the object is encrypted with, empty when it is stored in plain
+	EncryptionKey string `json:"-"`
+}
+
+// Virus scan outcomes
+const (
+	ScanStatusClean    = "clean"
+	ScanStatusInfected = "infected"
+	ScanStatusError    = "error"
+)
+
+// DocumentStatusQuarantined marks an infected document, it never gets a job
+const DocumentStatusQuarantined = "quarantined"
+
+// Entity types the worker finds
+const (
+	EntityPerson       = "person"
+	EntityOrganization = "organization"
+	EntityDate         = "date"
+	EntityAmount       = "amount"
+)
+
+// Entity is a person, organization, date or amount a document's text mentions
+type Entity struct {
+	Type  string `json:"type"`
+	Value string `json:"value"` // as the document first wrote it
+	Count int    `json:"count"` // how often it comes up
+}
+
+// EntityKey is what entities are matched by, "organization:acme inc." for any way of writing it
+func EntityKey(entityType, value string) string {
+	return entityType + ":" + strings.ToLower(strings.Join(strings.Fields(value), " "))
+}
@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// EmbeddingMigration moves the corpus to another embedding model. Every document is re-embedded
+// with EmbeddingModel into Collection, a vector collection of its own, while searches keep going
+// to FromCollection. Once every document is in, searches and new jobs switch over at once.
+type EmbeddingMigration struct {
+	ID             string `json:"id"`
+	EmbeddingModel string `json:"embedding_model"`
+	Collection     string `json:"collection"`
+	// FromModel and FromCollection are what searches used before, "" for the configured ones
+	FromModel      string `json:"from_model,omitempty"`
+	FromCollection string `json:"from_collection,omitempty"`
+	Status         string `json:"status"` // running -> completed / cancelled
+	// BatchSize is how many documents are queued at a time
+	BatchSize int `json:"batch_size"`
+	// Total, Migrated and Failed are the documents as of the last run of the migrate_embeddings
+	// schedule. Failed ones hold the switch up until they are reprocessed or it is forced.
+	Total      int        `json:"total"`
+	Migrated   int        `json:"migrated"`
+	Failed     int        `json:"failed"`
+	Message    string     `json:"message,omitempty"` // what the last run did
+	CreatedBy  int        `json:"created_by,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	SwitchedAt *time.Time `json:"switched_at,omitempty"`
+}
+
+// Statuses of an embedding migration
+const (
+	EmbeddingMigrationRunning   = "running"
+	EmbeddingMigrationCompleted = "completed"
+	EmbeddingMigrationCancelled = "cancelled"
+)
+
+// EmbeddingProgress counts the live documents by where their latest job left them
+type EmbeddingProgress struct {
+	Total    int
+	Migrated int // the latest job re-embedded it into the collection
+	Failed   int // the latest job tried and failed or was cancelled
+	Queued   int // the latest job is on its way there
+}
+
+// Pending is what still has to be re-embedded, counting what is queued
+func (p EmbeddingProgress) Pending() int {
+	return p.Total - p.Migrated - p.Failed
+}
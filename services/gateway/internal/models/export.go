@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// Export is a zip of everything an account has, built in the background after POST /me/export
+type Export struct {
+	ID         string     `json:"id"`
+	UserID     int        `json:"user_id"`
+	Status     string     `json:"status"` // pending -> running -> completed / failed, completed -> expired
+	ObjectKey  string     `json:"-"`
+	Size       int64      `json:"size,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"` // the zip is removed then
+	// DownloadURL is a presigned link to the zip while it's completed, filled in by the handler
+	DownloadURL string `json:"download_url,omitempty"`
+}
+
+// Export statuses
+const (
+	ExportStatusPending   = "pending"
+	ExportStatusRunning   = "running"
+	ExportStatusCompleted = "completed"
+	ExportStatusFailed    = "failed"
+	ExportStatusExpired   = "expired"
+)
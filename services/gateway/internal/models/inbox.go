@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// Inbox is a user's inbound email address, mail sent to it has its attachments uploaded for them
+type Inbox struct {
+	UserID int `json:"user_id"`
+	// Token is the local part of the address, anyone who knows it can mail documents in
+	Token     string    `json:"-"`
+	Address   string    `json:"address"`
+	CreatedAt time.Time `json:"created_at"`
+}
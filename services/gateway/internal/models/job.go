@@ -0,0 +1,64 @@
+package models
+
+import "time"
+
+// Job tracks a single ingestion request from upload until the worker is done with it
+type Job struct {
+	ID         string    `json:"job_id"`
+	UserID     *int      `json:"user_id,omitempty"` // nil when the upload was anonymous
+	DocumentID string    `json:"document_id,omitempty"`
+	Filename   string    `json:"filename"`
+	Bucket     string    `json:"bucket"`
+	SHA256     string    `json:"sha256,omitempty"` // hex digest of the content the worker has to find in the bucket
+	Status     string    `json:"status"`           // pending -> queued -> processing -> completed / failed / cancelled
+	Error      string    `json:"error,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+
+	// Options are the pipeline settings the job was queued with, nil means the worker's defaults
+	Options *JobOptions `json:"options,omitempty"`
+	// Collection is the vector collection the job indexes into, "" for the worker's COLLECTION_NAME.
+	// Jobs of an embedding migration and those queued after one completed name theirs.
+	Collection string `json:"collection,omitempty"`
+	// Stages are how far the worker got, only filled in when a single job is fetched
+	Stages []JobStage `json:"stages,omitempty"`
+}
+
+// JobStage is one pipeline stage of a job as the worker last reported it
+type JobStage struct {
+	Stage  string `json:"stage"`
+	Status string `json:"status"` // completed or failed
+	Error  string `json:"error,omitempty"`
+	// Runs is how often the stage was reported, more than once when the job was retried or
+	// redelivered after a worker crashed
+	Runs      int       `json:"runs"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// JobOptions override the worker's pipeline settings for one job, zero values mean "use the default".
+// These must match the worker's models.
+type JobOptions struct {
+	ChunkStrategy  string `json:"chunk_strategy,omitempty"` // tokens, sentences or markdown
+	ChunkSize      int    `json:"chunk_size,omitempty"`     // in tokens
+	ChunkOverlap   int    `json:"chunk_overlap,omitempty"`  // in tokens
+	EmbeddingModel string `json:"embedding_model,omitempty"`
+	SummaryModel   string `json:"summary_model,omitempty"` // writes the summary with the worker's summary provider
+	Pipeline       string `json:"pipeline,omitempty"`      // worker stages to run, comma separated
+	// Skip are stages the worker leaves out, comma separated, set from the plan when the job is queued
+	Skip string `json:"skip,omitempty"`
+}
+
+// Job statuses
+const (
+	JobStatusPending    = "pending"
+	JobStatusQueued     = "queued"
+	JobStatusProcessing = "processing"
+	JobStatusCompleted  = "completed"
+	JobStatusFailed     = "failed"
+	JobStatusCancelled  = "cancelled"
+)
+
+// IsFinal reports whether a job in this status is done for good
+func IsFinal(status string) bool {
+	return status == JobStatusCompleted || status == JobStatusFailed || status == JobStatusCancelled
+}
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// NotificationPreferences say how a user hears about their uploads finishing processing, by
+// email straight away, in a daily digest or not at all. Left out is none.
+type NotificationPreferences struct {
+	Completed string `json:"completed,omitempty"`
+	Failed    string `json:"failed,omitempty"`
+}
+
+// How a user is notified of a finished job
+const (
+	NotifyInstant = "instant"
+	NotifyDigest  = "digest"
+	NotifyNone    = "none"
+)
+
+// Notify is how the user wants to hear about a job that finished with status, NotifyNone unless
+// they asked for something else
+func (p *Preferences) Notify(status string) string {
+	if p == nil || p.Notifications == nil {
+		return NotifyNone
+	}
+	setting := p.Notifications.Completed
+	if status == JobStatusFailed {
+		setting = p.Notifications.Failed
+	}
+	if setting == "" {
+		return NotifyNone
+	}
+	return setting
+}
+
+// DigestItem is a finished job waiting for its uploader's daily digest
+type DigestItem struct {
+	ID         int
+	UserID     int
+	JobID      string
+	DocumentID string
+	Filename   string // of the document, "" when the job had none
+	Status     string // completed or failed
+	Error      string
+	CreatedAt  time.Time
+}
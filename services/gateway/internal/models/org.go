@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// Organization is a team sharing one document corpus
+type Organization struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	Role      string    `json:"role,omitempty"` // the caller's role, set when listing their orgs
+	// RetentionDays is how long documents are kept before they go to the trash, nil keeps them forever
+	RetentionDays *int `json:"retention_days"`
+	// Plan is the tier the organization is on, its documents go by it rather than their owners'
+	Plan string `json:"plan"`
+	// ReadOnlyAt is set while the organization holds more than its plan's storage
+	ReadOnlyAt *time.Time `json:"read_only_at,omitempty"`
+}
+
+// Membership puts a user in an organization with a role
+type Membership struct {
+	OrgID     string    `json:"org_id"`
+	UserID    int       `json:"user_id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Organization roles, from most to least powerful:
+// owners manage members and can delete any document, members upload and delete their own,
+// viewers can only read
+const (
+	RoleOwner  = "owner"
+	RoleMember = "member"
+	RoleViewer = "viewer"
+)
+
+// Invitation offers a role in an organization to whoever owns the email address
+type Invitation struct {
+	ID         string     `json:"id"`
+	OrgID      string     `json:"org_id"`
+	OrgName    string     `json:"org_name,omitempty"`
+	Email      string     `json:"email"`
+	Role       string     `json:"role"`
+	InvitedBy  int        `json:"invited_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// Plan is a tier users and organizations are on, with what it allows. A document in an
+// organization goes by the organization's plan, any other by its owner's. Admins keep the list.
+type Plan struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// MaxFileSize is the largest upload in bytes, 0 is the server's MAX_UPLOAD_SIZE
+	MaxFileSize int64 `json:"max_file_size"`
+	// MonthlyPages is how many pages jobs may process a calendar month (UTC), 0 is no limit
+	MonthlyPages int64 `json:"monthly_pages"`
+	// MaxStorage is how many bytes the stored versions of the account's documents may take
+	// up, 0 is no limit. An account over it after a downgrade is read-only until it fits.
+	MaxStorage int64 `json:"max_storage"`
+	// OCR lets documents go through the ocr stage, jobs leave it out otherwise
+	OCR bool `json:"ocr"`
+	// Models are the allowed models requests may pick, "*" for all of them. Without any only
+	// the configured models are used.
+	Models    []string  `json:"models"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// The plans every install starts with, an account without another one is on PlanFree
+const (
+	PlanFree       = "free"
+	PlanPro        = "pro"
+	PlanEnterprise = "enterprise"
+)
+
+// StageOCR is the worker stage OCR runs as, a plugin a plan without OCR skips
+const StageOCR = "ocr"
+
+// AllowsModel reports whether requests on the plan may pick name
+func (p Plan) AllowsModel(name string) bool {
+	return slices.Contains(p.Models, "*") || slices.Contains(p.Models, name)
+}
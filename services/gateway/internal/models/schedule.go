@@ -0,0 +1,31 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Schedule runs a task periodically, on a cron expression evaluated in UTC
+type Schedule struct {
+	ID      string          `json:"id"`
+	Name    string          `json:"name"`
+	Task    string          `json:"task"` // sync_connectors, purge_documents, expire_documents, reembed_documents, migrate_embeddings, ...
+	Cron    string          `json:"cron"` // "*/15 * * * *", or @hourly, @daily, @weekly, @monthly
+	Params  json.RawMessage `json:"params"`
+	Enabled bool            `json:"enabled"`
+	// NextRunAt is nil while the schedule is disabled
+	NextRunAt  *time.Time `json:"next_run_at,omitempty"`
+	LastRunAt  *time.Time `json:"last_run_at,omitempty"`
+	LastStatus string     `json:"last_status,omitempty"`
+	// LastResult is what the last run did, or why it failed
+	LastResult string    `json:"last_result,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Statuses of a schedule's last run
+const (
+	ScheduleStatusRunning   = "running"
+	ScheduleStatusSucceeded = "succeeded"
+	ScheduleStatusFailed    = "failed"
+)
@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// SearchFilters is everything about a search but its query, as POST /search takes it
+type SearchFilters struct {
+	Mode        string   `json:"mode,omitempty"`
+	OrgID       string   `json:"org_id,omitempty"`
+	DocumentIDs []string `json:"document_ids,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Languages   []string `json:"languages,omitempty"`
+	Entities    []string `json:"entities,omitempty"`
+}
+
+// SavedSearch is a search a user named to run again. With Notify set, documents processed
+// after it was saved that match it are announced by webhook or email.
+type SavedSearch struct {
+	ID        string        `json:"id"`
+	UserID    int           `json:"user_id"`
+	Name      string        `json:"name"`
+	Query     string        `json:"query"`
+	Filters   SearchFilters `json:"filters"`
+	Notify    []string      `json:"notify"` // SearchNotify* channels, empty sends no alerts
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+// Channels a saved search alerts through
+const (
+	SearchNotifyWebhook = "webhook" // the user's webhooks subscribed to search.matched
+	SearchNotifyEmail   = "email"   // the account's address
+)
+
+// RecentSearch is one entry of a user's search history
+type RecentSearch struct {
+	ID         int           `json:"id"`
+	Query      string        `json:"query"`
+	Filters    SearchFilters `json:"filters"`
+	SearchedAt time.Time     `json:"searched_at"`
+}
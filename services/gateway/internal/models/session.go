@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Session is one login, kept going by refreshing until it is logged out or its refresh token
+// runs out. Every access token issued in it carries ID as its sid claim.
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     int       `json:"user_id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"` // where the login came from
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"` // the last refresh
+	ExpiresAt  time.Time `json:"expires_at"`
+	// Current is set on the session the request listing them was made in
+	Current bool `json:"current"`
+}
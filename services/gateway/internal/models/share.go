@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// Share gives a user outside a document's or collection's organization access to it. One on a
+// collection reaches its sub-collections and the documents filed in any of them.
+type Share struct {
+	ID           string    `json:"id"`
+	DocumentID   string    `json:"document_id,omitempty"`
+	CollectionID string    `json:"collection_id,omitempty"`
+	UserID       int       `json:"user_id"` // who it is shared with
+	Email        string    `json:"email"`
+	Permission   string    `json:"permission"`
+	CreatedBy    int       `json:"created_by"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Share permissions. Both let the user read, search and chat with what was shared, comment lets
+// them annotate its documents too. Only the uploader and the organization's members can change it.
+const (
+	PermissionRead    = "read"
+	PermissionComment = "comment"
+)
+
+// ShareLink is a public link to a document or collection that works without an account until it
+// expires. Only a hash of its token is stored, Token and URL are filled in once when it is made.
+type ShareLink struct {
+	ID           string    `json:"id"`
+	DocumentID   string    `json:"document_id,omitempty"`
+	CollectionID string    `json:"collection_id,omitempty"`
+	Token        string    `json:"token,omitempty"`
+	URL          string    `json:"url,omitempty"`
+	HasPassword  bool      `json:"has_password"`
+	PasswordHash string    `json:"-"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	CreatedBy    int       `json:"created_by"`
+	CreatedAt    time.Time `json:"created_at"`
+}
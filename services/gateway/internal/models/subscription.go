@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Subscription is a Stripe subscription a plan was bought with, for a user's own account or,
+// with OrgID, an organization. UserID is who checked out.
+type Subscription struct {
+	ID                string     `json:"id"`
+	CustomerID        string     `json:"customer_id"`
+	ItemID            string     `json:"-"`
+	UserID            int        `json:"user_id"`
+	OrgID             string     `json:"org_id,omitempty"`
+	Plan              string     `json:"plan"`
+	Status            string     `json:"status"`
+	CancelAtPeriodEnd bool       `json:"cancel_at_period_end"`
+	CurrentPeriodEnd  *time.Time `json:"current_period_end"`
+	// EventAt is the creation time (unix) of the Stripe event last applied
+	EventAt   int64     `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
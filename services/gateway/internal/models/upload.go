@@ -0,0 +1,57 @@
+package models
+
+import "time"
+
+// UploadSession wraps one object storage multipart upload of the chunked upload flow, or with
+// Direct a file the client sends to storage itself through a presigned URL
+type UploadSession struct {
+	ID            string `json:"upload_id"`
+	UserID        int    `json:"user_id"`
+	OrgID         string `json:"org_id,omitempty"`        // the finished document goes into this organization
+	CollectionID  string `json:"collection_id,omitempty"` // and is filed in this collection
+	Bucket        string `json:"bucket"`
+	ObjectKey     string `json:"object_key"`
+	Filename      string `json:"filename"`
+	ContentType   string `json:"content_type"`
+	MinioUploadID string `json:"-"`
+	Status        string `json:"status"` // in_progress -> completed / aborted / failed
+	DocumentID    string `json:"document_id,omitempty"`
+	// HashState is the SHA-256 state after the first HashedParts parts, kept while parts arrive in order.
+	// HashedParts is -1 once a part was re-sent and the content can no longer be hashed on the fly.
+	HashState   []byte `json:"-"`
+	HashedParts int    `json:"-"`
+	// Tags and Metadata are copied onto the document once the upload completes
+	Tags     []string          `json:"tags,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// EncryptionKey is the wrapped data key every part is encrypted with, empty without encryption
+	EncryptionKey string `json:"-"`
+	// Direct uploads have no multipart upload, Size is what the client said it sends and
+	// ExpiresAt when the presigned URL stops taking it
+	Direct    bool       `json:"direct,omitempty"`
+	Size      int64      `json:"size,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// UploadPart is one chunk storage has accepted for a session
+type UploadPart struct {
+	PartNumber int    `json:"part"`
+	ETag       string `json:"etag"`
+	Size       int64  `json:"size"`
+}
+
+// DirectUploadGrace is how long after its URL expired a direct upload can still be completed,
+// a file that went in at the last moment may take a while to be confirmed
+const DirectUploadGrace = time.Hour
+
+// DirectUploadPrefix is where direct uploads are sent, completing one copies the file out to the
+// document's own key
+const DirectUploadPrefix = "direct-uploads/"
+
+// Upload session statuses
+const (
+	UploadStatusInProgress = "in_progress"
+	UploadStatusCompleted  = "completed"
+	UploadStatusAborted    = "aborted"
+	// UploadStatusFailed is an assembled upload whose document didn't make it, it has to be uploaded again
+	UploadStatusFailed = "failed"
+)
@@ -0,0 +1,31 @@
+package models
+
+// Usage metrics
+const (
+	// MetricStorageBytes is the most the user's stored versions of documents took up that day
+	MetricStorageBytes = "storage_bytes"
+	// MetricPages are the PDF pages, slides and sheets of completed jobs, 1 for other documents
+	MetricPages           = "pages"
+	MetricEmbeddingTokens = "embedding_tokens"
+	// MetricLLMInputTokens and MetricLLMOutputTokens count summaries, answers and chat messages
+	MetricLLMInputTokens  = "llm_input_tokens"
+	MetricLLMOutputTokens = "llm_output_tokens"
+)
+
+// Usage is a quantity per metric, metrics without any are left out
+type Usage map[string]int64
+
+// Add adds other to u
+func (u Usage) Add(other Usage) {
+	for metric, n := range other {
+		u[metric] += n
+	}
+}
+
+// UsageDay is what a user consumed on a day in one organization, "" for their own documents
+type UsageDay struct {
+	Day    string `json:"day"` // YYYY-MM-DD in UTC
+	UserID int    `json:"user_id"`
+	OrgID  string `json:"org_id,omitempty"`
+	Usage  Usage  `json:"usage"`
+}
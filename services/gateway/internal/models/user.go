@@ -4,8 +4,31 @@ import "time"
 
 // `..` these are struct tags so when they are converted to json they are tagged by these 
 type User struct {
-	ID        int       `json:"id"`
-	Email     string    `json:"email"`
-	Password  string    `json:"-"` // "-" means never send password in JSON response
-	CreatedAt time.Time `json:"created_at"`
+	ID          int          `json:"id"`
+	Email       string       `json:"email"`
+	Password    string       `json:"-"` // "-" means never send password in JSON response
+	IsAdmin     bool         `json:"is_admin"`
+	CreatedAt   time.Time    `json:"created_at"`
+	DisplayName string       `json:"display_name"`
+	AvatarKey   string       `json:"-"`                    // the picture's object, "" without one
+	AvatarURL   string       `json:"avatar_url,omitempty"` // where to fetch it, filled in by the handler
+	Preferences *Preferences `json:"preferences,omitempty"`
+	DeletedAt   *time.Time   `json:"deleted_at,omitempty"` // set by DELETE /me, the row stays behind anonymized
+
+	// set while an admin has the account suspended, it can't sign in or use its API keys then
+	SuspendedAt      *time.Time `json:"suspended_at,omitempty"`
+	SuspensionReason string     `json:"suspension_reason,omitempty"`
+
+	// Plan is the tier the account is on, see GET /plans
+	Plan string `json:"plan"`
+	// ReadOnlyAt is set while the account holds more than its plan's storage, see models.Plan
+	ReadOnlyAt *time.Time `json:"read_only_at,omitempty"`
+}
+
+// Preferences are a user's own defaults
+type Preferences struct {
+	// Options are the pipeline settings for their uploads, a collection's defaults come first
+	Options *JobOptions `json:"options,omitempty"`
+	// Notifications is how they are emailed about their uploads finishing processing
+	Notifications *NotificationPreferences `json:"notifications,omitempty"`
 }
\ No newline at end of file
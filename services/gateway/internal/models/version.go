@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// DocumentVersion is one upload of a document's content. The document itself shows the
+// current version, older ones keep their object so they can be restored.
+type DocumentVersion struct {
+	DocumentID  string    `json:"document_id"`
+	Version     int       `json:"version"` // numbered from 1 per document
+	ObjectKey   string    `json:"object_key"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256,omitempty"`
+	UserID      int       `json:"user_id"` // who uploaded it
+	CreatedAt   time.Time `json:"created_at"`
+	// Current is set on the version the document is at, it isn't stored
+	Current bool `json:"current"`
+	// EncryptionKey is the wrapped data key of this version's object, each version has its own
+	EncryptionKey string `json:"-"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Webhook is a user registered URL that gets POSTed to when their jobs finish
+type Webhook struct {
+	ID        string    `json:"id"`
+	UserID    int       `json:"user_id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"` // only shown once, when the webhook is created
+	Events    []string  `json:"events"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Webhook event names
+const (
+	EventJobCompleted = "job.completed"
+	EventJobFailed    = "job.failed"
+	// EventSearchMatched is sent when a newly processed document matches a saved search
+	EventSearchMatched = "search.matched"
+	// EventUsageReported carries what a user consumed on a day once it is over, it goes to the
+	// billing endpoint as well
+	EventUsageReported = "usage.reported"
+)
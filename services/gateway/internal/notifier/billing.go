@@ -0,0 +1,100 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+)
+
+// UsagePayload is the body of a usage.reported event, what a user consumed on a closed day
+type UsagePayload struct {
+	Event string `json:"event"`
+	// ID is the same every time a day is sent, receivers can drop the repeats
+	ID        string       `json:"id"`
+	Day       string       `json:"day"`
+	UserID    int          `json:"user_id"`
+	OrgID     string       `json:"org_id,omitempty"`
+	Usage     models.Usage `json:"usage"`
+	Timestamp int64        `json:"timestamp"`
+}
+
+// NewUsagePayload is the usage.reported event for day
+func NewUsagePayload(day models.UsageDay) UsagePayload {
+	return UsagePayload{
+		Event:     models.EventUsageReported,
+		ID:        fmt.Sprintf("usage_%s_%d_%s", day.Day, day.UserID, day.OrgID),
+		Day:       day.Day,
+		UserID:    day.UserID,
+		OrgID:     day.OrgID,
+		Usage:     day.Usage,
+		Timestamp: time.Now().Unix(),
+	}
+}
+
+// UsageReported hands a user's usage.reported event to the webhooks they subscribed to it
+func (n *Notifier) UsageReported(payload UsagePayload) {
+	hooks, err := n.store.ListWebhooksForEvent(context.Background(), payload.UserID, models.EventUsageReported)
+	if err != nil {
+		log.Printf("Failed to load webhooks for the usage of user %d: %v\n", payload.UserID, err)
+		return
+	}
+	if len(hooks) == 0 {
+		return
+	}
+
+	body, _ := json.Marshal(payload)
+	for _, hook := range hooks {
+		go n.deliver(hook, models.EventUsageReported, body)
+	}
+}
+
+// Billing posts usage.reported events to the billing endpoint, signed the way webhooks are.
+// Unlike a webhook it is tried once, the report_usage schedule sends a day again until it got through.
+type Billing struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+// NewBilling returns nil when no billing endpoint is configured
+func NewBilling(cfg config.Billing) *Billing {
+	if cfg.WebhookURL == "" {
+		return nil
+	}
+	return &Billing{url: cfg.WebhookURL, secret: cfg.WebhookSecret, client: &http.Client{Timeout: requestTimeout}}
+}
+
+// Send posts payload, reporting an error unless the endpoint answered 2xx
+func (b *Billing) Send(ctx context.Context, payload UsagePayload) error {
+	body, _ := json.Marshal(payload)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "docstream-webhooks/1.0")
+	req.Header.Set("X-Docstream-Event", payload.Event)
+	req.Header.Set("X-Docstream-Timestamp", timestamp)
+	req.Header.Set("X-Docstream-Signature", "sha256="+Sign(b.secret, timestamp, body))
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("billing endpoint answered %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/fetcher"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+)
+
+const (
+	maxAttempts    = 6
+	initialBackoff = time.Second
+	requestTimeout = 10 * time.Second
+	maxRedirects   = 5
+)
+
+// Payload is the JSON body every webhook receives
+type Payload struct {
+	Event      string `json:"event"`
+	JobID      string `json:"job_id"`
+	DocumentID string `json:"document_id,omitempty"`
+	SHA256     string `json:"sha256,omitempty"` // of the content the job processed
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	// SearchID and SearchName are the saved search a search.matched is about
+	SearchID   string `json:"search_id,omitempty"`
+	SearchName string `json:"search_name,omitempty"`
+	Timestamp  int64  `json:"timestamp"`
+}
+
+// Notifier delivers job events to the webhooks users have registered.
+// Deliveries run in the background and retry with exponential backoff.
+type Notifier struct {
+	store  storage.WebhookStore
+	client *http.Client
+}
+
+func New(store storage.WebhookStore) *Notifier {
+	return &Notifier{
+		store: store,
+		// webhook URLs are the users', they only get to reach public addresses
+		client: fetcher.NewClient(requestTimeout, maxRedirects),
+	}
+}
+
+// JobFinished fires the matching event for a job that reached completed or failed
+func (n *Notifier) JobFinished(job models.Job) {
+	if job.UserID == nil {
+		return
+	}
+
+	event := models.EventJobCompleted
+	if job.Status == models.JobStatusFailed {
+		event = models.EventJobFailed
+	}
+
+	hooks, err := n.store.ListWebhooksForEvent(context.Background(), *job.UserID, event)
+	if err != nil {
+		log.Printf("Failed to load webhooks for job %s: %v\n", job.ID, err)
+		return
+	}
+	if len(hooks) == 0 {
+		return
+	}
+
+	body, _ := json.Marshal(Payload{
+		Event:      event,
+		JobID:      job.ID,
+		DocumentID: job.DocumentID,
+		SHA256:     job.SHA256,
+		Status:     job.Status,
+		Error:      job.Error,
+		Timestamp:  time.Now().Unix(),
+	})
+
+	for _, hook := range hooks {
+		go n.deliver(hook, event, body)
+	}
+}
+
+// SearchMatched tells the owner of a saved search that job's document matches it
+func (n *Notifier) SearchMatched(search models.SavedSearch, job models.Job) {
+	hooks, err := n.store.ListWebhooksForEvent(context.Background(), search.UserID, models.EventSearchMatched)
+	if err != nil {
+		log.Printf("Failed to load webhooks for saved search %s: %v\n", search.ID, err)
+		return
+	}
+	if len(hooks) == 0 {
+		return
+	}
+
+	body, _ := json.Marshal(Payload{
+		Event:      models.EventSearchMatched,
+		JobID:      job.ID,
+		DocumentID: job.DocumentID,
+		SHA256:     job.SHA256,
+		Status:     job.Status,
+		SearchID:   search.ID,
+		SearchName: search.Name,
+		Timestamp:  time.Now().Unix(),
+	})
+
+	for _, hook := range hooks {
+		go n.deliver(hook, models.EventSearchMatched, body)
+	}
+}
+
+// deliver keeps trying until the endpoint answers 2xx or we run out of attempts
+func (n *Notifier) deliver(hook models.Webhook, event string, body []byte) {
+	backoff := initialBackoff
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		err := n.send(hook, event, body)
+		if err == nil {
+			return
+		}
+		log.Printf("Webhook %s delivery attempt %d/%d failed: %v\n", hook.ID, attempt, maxAttempts, err)
+		if errors.Is(err, fetcher.ErrBlocked) {
+			// it will resolve to the same place on the next attempt
+			break
+		}
+
+		if attempt < maxAttempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	log.Printf("Giving up on webhook %s for %s\n", hook.ID, event)
+}
+
+func (n *Notifier) send(hook models.Webhook, event string, body []byte) error {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "docstream-webhooks/1.0")
+	req.Header.Set("X-Docstream-Event", event)
+	req.Header.Set("X-Docstream-Timestamp", timestamp)
+	req.Header.Set("X-Docstream-Signature", "sha256="+Sign(hook.Secret, timestamp, body))
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("endpoint answered %s", resp.Status)
+	}
+	return nil
+}
+
+// Sign is the HMAC-SHA256 of "<timestamp>.<body>" with the webhook secret.
+// Receivers recompute it to check the request came from us, the timestamp stops replays.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
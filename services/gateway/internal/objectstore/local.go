@@ -0,0 +1,291 @@
+package objectstore
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// uploadsDir holds unfinished multipart uploads under the root, bucket names can't start with a dot so it never clashes
+const uploadsDir = ".uploads"
+
+// localStore keeps objects as files under root/<bucket>/<key>. It is meant for tests and
+// single machine setups: presigned URLs are file:// URLs that only work on the same machine.
+type localStore struct {
+	root string
+}
+
+func newLocal(root string) (*localStore, error) {
+	if err := os.MkdirAll(filepath.Join(root, uploadsDir), 0o755); err != nil {
+		return nil, fmt.Errorf("creating storage root: %w", err)
+	}
+	return &localStore{root: root}, nil
+}
+
+func (s *localStore) Name() string { return "local" }
+
+// path maps a bucket and key to a file, keys can't climb out of their bucket
+func (s *localStore) path(bucket, key string) (string, error) {
+	if err := checkBucket(bucket); err != nil {
+		return "", err
+	}
+	clean := filepath.Clean("/" + filepath.FromSlash(key))
+	if clean == string(filepath.Separator) {
+		return "", fmt.Errorf("invalid object key %q", key)
+	}
+	return filepath.Join(s.root, bucket, clean), nil
+}
+
+func (s *localStore) Put(ctx context.Context, bucket, key string, r io.Reader, size int64, contentType string) (ObjectInfo, error) {
+	path, err := s.path(bucket, key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	written, sum, err := writeFile(path, r, size)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{Key: key, Size: written, ETag: sum, ContentType: contentType, LastModified: time.Now()}, nil
+}
+
+func (s *localStore) Get(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	path, err := s.path(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s/%s", ErrNotFound, bucket, key)
+	}
+	return f, err
+}
+
+func (s *localStore) GetRange(ctx context.Context, bucket, key string, offset, length int64) (io.ReadCloser, error) {
+	path, err := s.path(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s/%s", ErrNotFound, bucket, key)
+	} else if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(f, length), f}, nil
+}
+
+func (s *localStore) Stat(ctx context.Context, bucket, key string) (ObjectInfo, error) {
+	path, err := s.path(bucket, key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	fi, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ObjectInfo{}, fmt.Errorf("%w: %s/%s", ErrNotFound, bucket, key)
+	} else if err != nil {
+		return ObjectInfo{}, err
+	}
+	// there is nowhere to keep the content type, the extension is the best guess
+	return ObjectInfo{Key: key, Size: fi.Size(), ContentType: mime.TypeByExtension(filepath.Ext(key)), LastModified: fi.ModTime()}, nil
+}
+
+func (s *localStore) Delete(ctx context.Context, bucket, key string) error {
+	path, err := s.path(bucket, key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *localStore) Copy(ctx context.Context, bucket, srcKey, dstKey string) error {
+	src, err := s.Get(ctx, bucket, srcKey)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	_, err = s.Put(ctx, bucket, dstKey, src, -1, "")
+	return err
+}
+
+// Presign can't restrict anything for a plain file, expiry and filename are ignored
+func (s *localStore) Presign(ctx context.Context, bucket, key string, expiry time.Duration, filename string) (*url.URL, error) {
+	path, err := s.path(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	return &url.URL{Scheme: "file", Path: filepath.ToSlash(abs)}, nil
+}
+
+// PresignUpload has nothing to offer, the directory is only reachable through the gateway
+func (s *localStore) PresignUpload(ctx context.Context, bucket, key string, expiry time.Duration, contentType string) (PresignedUpload, error) {
+	return PresignedUpload{}, ErrUnsupported
+}
+
+func (s *localStore) CreateMultipart(ctx context.Context, bucket, key, contentType string) (string, error) {
+	if _, err := s.path(bucket, key); err != nil {
+		return "", err
+	}
+	id := uuid.NewString()
+	if err := os.Mkdir(filepath.Join(s.root, uploadsDir, id), 0o755); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// uploadDir is where an upload's parts wait to be joined
+func (s *localStore) uploadDir(uploadID string) (string, error) {
+	if _, err := uuid.Parse(uploadID); err != nil {
+		return "", fmt.Errorf("invalid upload ID %q", uploadID)
+	}
+	dir := filepath.Join(s.root, uploadsDir, uploadID)
+	if _, err := os.Stat(dir); err != nil {
+		return "", fmt.Errorf("upload %s: %w", uploadID, err)
+	}
+	return dir, nil
+}
+
+func (s *localStore) PutPart(ctx context.Context, bucket, key, uploadID string, number int, r io.Reader, size int64) (Part, error) {
+	dir, err := s.uploadDir(uploadID)
+	if err != nil {
+		return Part{}, err
+	}
+	written, sum, err := writeFile(filepath.Join(dir, strconv.Itoa(number)), r, size)
+	if err != nil {
+		return Part{}, err
+	}
+	return Part{Number: number, ETag: sum, Size: written}, nil
+}
+
+func (s *localStore) CompleteMultipart(ctx context.Context, bucket, key, uploadID string, parts []Part) (ObjectInfo, error) {
+	dir, err := s.uploadDir(uploadID)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	readers := make([]io.Reader, len(parts))
+	for i, p := range parts {
+		f, err := os.Open(filepath.Join(dir, strconv.Itoa(p.Number)))
+		if errors.Is(err, os.ErrNotExist) {
+			return ObjectInfo{}, &RejectedError{Message: fmt.Sprintf("part %d was never uploaded", p.Number), Err: err}
+		} else if err != nil {
+			return ObjectInfo{}, err
+		}
+		defer f.Close()
+		if sum, err := md5File(f); err != nil {
+			return ObjectInfo{}, err
+		} else if sum != p.ETag {
+			return ObjectInfo{}, &RejectedError{Message: fmt.Sprintf("part %d doesn't match its ETag", p.Number)}
+		}
+		readers[i] = f
+	}
+
+	info, err := s.Put(ctx, bucket, key, io.MultiReader(readers...), -1, "")
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	os.RemoveAll(dir)
+	return info, nil
+}
+
+func (s *localStore) AbortMultipart(ctx context.Context, bucket, key, uploadID string) error {
+	dir, err := s.uploadDir(uploadID)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+func (s *localStore) BucketExists(ctx context.Context, bucket string) (bool, error) {
+	if err := checkBucket(bucket); err != nil {
+		return false, err
+	}
+	fi, err := os.Stat(filepath.Join(s.root, bucket))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil && fi.IsDir(), err
+}
+
+func (s *localStore) MakeBucket(ctx context.Context, bucket string) error {
+	if err := checkBucket(bucket); err != nil {
+		return err
+	}
+	return os.MkdirAll(filepath.Join(s.root, bucket), 0o755)
+}
+
+// Available is always nil, a local disk is either there or the process has bigger problems
+func (s *localStore) Available() error { return nil }
+
+func checkBucket(bucket string) error {
+	if bucket == "" || strings.HasPrefix(bucket, ".") || strings.ContainsAny(bucket, `/\`) {
+		return fmt.Errorf("invalid bucket name %q", bucket)
+	}
+	return nil
+}
+
+// writeFile writes r to path through a temp file so readers never see half an object,
+// checking it came to size bytes unless size is -1. It returns the size and MD5.
+func writeFile(path string, r io.Reader, size int64) (int64, string, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, "", err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return 0, "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	hasher := md5.New()
+	written, err := io.Copy(io.MultiWriter(tmp, hasher), r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && size >= 0 && written != size {
+		err = fmt.Errorf("expected %d bytes, got %d", size, written)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	return written, hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// md5File hashes f and rewinds it
+func md5File(f *os.File) (string, error) {
+	hasher := md5.New()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
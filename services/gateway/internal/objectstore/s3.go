@@ -0,0 +1,324 @@
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+)
+
+// s3Store talks to AWS S3 (or anything speaking its API) through the v2 SDK
+type s3Store struct {
+	client  *s3.Client
+	presign *s3.PresignClient
+	region  string
+	guard   *offlineGuard
+}
+
+func newS3(ctx context.Context, cfg config.S3) (*s3Store, error) {
+	var opts []func(*awsconfig.LoadOptions) error
+	if cfg.Region != "" {
+		opts = append(opts, awsconfig.WithRegion(cfg.Region))
+	}
+	// the default chain covers static keys, shared profiles and IAM roles (instance profile, IRSA)
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("loading AWS config: %w", err)
+	}
+
+	client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+		}
+		o.UsePathStyle = cfg.UsePathStyle
+		// objects put without a checksum would log a line on every read otherwise
+		o.DisableLogOutputChecksumValidationSkipped = true
+	})
+
+	log.Println("Using S3 object storage in region", awsCfg.Region)
+	guard := &offlineGuard{name: "S3", unreachable: isUnreachable, ping: func(ctx context.Context) error {
+		_, err := client.ListBuckets(ctx, &s3.ListBucketsInput{MaxBuckets: aws.Int32(1)})
+		return err
+	}}
+	return &s3Store{client: client, presign: s3.NewPresignClient(client), region: awsCfg.Region, guard: guard}, nil
+}
+
+func (s *s3Store) Name() string { return "s3" }
+
+func (s *s3Store) Put(ctx context.Context, bucket, key string, r io.Reader, size int64, contentType string) (ObjectInfo, error) {
+	var out *s3.PutObjectOutput
+	err := s.call(func() (err error) {
+		out, err = s.client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:        aws.String(bucket),
+			Key:           aws.String(key),
+			Body:          r,
+			ContentLength: aws.Int64(size),
+			ContentType:   aws.String(contentType),
+		}, streaming(r))
+		return err
+	})
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{Key: key, Size: size, ETag: etag(out.ETag), ContentType: contentType}, nil
+}
+
+func (s *s3Store) Get(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	var out *s3.GetObjectOutput
+	err := s.call(func() (err error) {
+		out, err = s.client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+func (s *s3Store) GetRange(ctx context.Context, bucket, key string, offset, length int64) (io.ReadCloser, error) {
+	var out *s3.GetObjectOutput
+	err := s.call(func() (err error) {
+		out, err = s.client.GetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+			Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+func (s *s3Store) Stat(ctx context.Context, bucket, key string) (ObjectInfo, error) {
+	var out *s3.HeadObjectOutput
+	err := s.call(func() (err error) {
+		out, err = s.client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+		return err
+	})
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{
+		Key:          key,
+		Size:         aws.ToInt64(out.ContentLength),
+		ETag:         etag(out.ETag),
+		ContentType:  aws.ToString(out.ContentType),
+		LastModified: aws.ToTime(out.LastModified),
+	}, nil
+}
+
+func (s *s3Store) Delete(ctx context.Context, bucket, key string) error {
+	// S3 answers a delete of a missing key with success already
+	return s.call(func() error {
+		_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+		return err
+	})
+}
+
+func (s *s3Store) Copy(ctx context.Context, bucket, srcKey, dstKey string) error {
+	return s.call(func() error {
+		_, err := s.client.CopyObject(ctx, &s3.CopyObjectInput{
+			Bucket:     aws.String(bucket),
+			Key:        aws.String(dstKey),
+			CopySource: aws.String(url.PathEscape(bucket) + "/" + escapeKey(srcKey)),
+		})
+		return err
+	})
+}
+
+func (s *s3Store) Presign(ctx context.Context, bucket, key string, expiry time.Duration, filename string) (*url.URL, error) {
+	input := &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)}
+	if filename != "" {
+		input.ResponseContentDisposition = aws.String(contentDisposition(filename))
+	}
+	// signing happens locally, nothing to guard
+	req, err := s.presign.PresignGetObject(ctx, input, s3.WithPresignExpires(expiry))
+	if err != nil {
+		return nil, err
+	}
+	return url.Parse(req.URL)
+}
+
+// PresignUpload signs a PUT with the content type, the client has to send every signed header
+func (s *s3Store) PresignUpload(ctx context.Context, bucket, key string, expiry time.Duration, contentType string) (PresignedUpload, error) {
+	input := &s3.PutObjectInput{Bucket: aws.String(bucket), Key: aws.String(key), ContentType: aws.String(contentType)}
+	req, err := s.presign.PresignPutObject(ctx, input, s3.WithPresignExpires(expiry))
+	if err != nil {
+		return PresignedUpload{}, err
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		return PresignedUpload{}, err
+	}
+	headers := map[string]string{}
+	for name := range req.SignedHeader {
+		// the client's HTTP library sets the host itself
+		if !strings.EqualFold(name, "Host") {
+			headers[name] = req.SignedHeader.Get(name)
+		}
+	}
+	return PresignedUpload{Method: req.Method, URL: u, Headers: headers}, nil
+}
+
+func (s *s3Store) CreateMultipart(ctx context.Context, bucket, key, contentType string) (string, error) {
+	var out *s3.CreateMultipartUploadOutput
+	err := s.call(func() (err error) {
+		out, err = s.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+			Bucket:      aws.String(bucket),
+			Key:         aws.String(key),
+			ContentType: aws.String(contentType),
+		})
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(out.UploadId), nil
+}
+
+func (s *s3Store) PutPart(ctx context.Context, bucket, key, uploadID string, number int, r io.Reader, size int64) (Part, error) {
+	var out *s3.UploadPartOutput
+	err := s.call(func() (err error) {
+		out, err = s.client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:        aws.String(bucket),
+			Key:           aws.String(key),
+			UploadId:      aws.String(uploadID),
+			PartNumber:    aws.Int32(int32(number)),
+			Body:          r,
+			ContentLength: aws.Int64(size),
+		}, streaming(r))
+		return err
+	})
+	if err != nil {
+		return Part{}, err
+	}
+	return Part{Number: number, ETag: etag(out.ETag), Size: size}, nil
+}
+
+func (s *s3Store) CompleteMultipart(ctx context.Context, bucket, key, uploadID string, parts []Part) (ObjectInfo, error) {
+	completed := make([]types.CompletedPart, len(parts))
+	var size int64
+	for i, p := range parts {
+		completed[i] = types.CompletedPart{PartNumber: aws.Int32(int32(p.Number)), ETag: aws.String(p.ETag)}
+		size += p.Size
+	}
+
+	var out *s3.CompleteMultipartUploadOutput
+	err := s.call(func() (err error) {
+		out, err = s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(bucket),
+			Key:             aws.String(key),
+			UploadId:        aws.String(uploadID),
+			MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+		})
+		return err
+	})
+	if err != nil {
+		var re *smithyhttp.ResponseError
+		var apiErr smithy.APIError
+		if errors.As(err, &re) && re.HTTPStatusCode() == http.StatusBadRequest && errors.As(err, &apiErr) {
+			return ObjectInfo{}, &RejectedError{Message: apiErr.ErrorMessage(), Err: err}
+		}
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{Key: key, Size: size, ETag: etag(out.ETag)}, nil
+}
+
+func (s *s3Store) AbortMultipart(ctx context.Context, bucket, key, uploadID string) error {
+	return s.call(func() error {
+		_, err := s.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(bucket),
+			Key:      aws.String(key),
+			UploadId: aws.String(uploadID),
+		})
+		return err
+	})
+}
+
+func (s *s3Store) BucketExists(ctx context.Context, bucket string) (bool, error) {
+	err := s.call(func() error {
+		_, err := s.client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(bucket)})
+		return err
+	})
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *s3Store) MakeBucket(ctx context.Context, bucket string) error {
+	input := &s3.CreateBucketInput{Bucket: aws.String(bucket)}
+	// us-east-1 is the one region that must not be named
+	if s.region != "" && s.region != "us-east-1" {
+		input.CreateBucketConfiguration = &types.CreateBucketConfiguration{LocationConstraint: types.BucketLocationConstraint(s.region)}
+	}
+	return s.call(func() error {
+		_, err := s.client.CreateBucket(ctx, input)
+		return err
+	})
+}
+
+func (s *s3Store) Available() error { return s.guard.Available() }
+
+// call runs one request through the offline guard, not found errors come back as ErrNotFound
+func (s *s3Store) call(fn func() error) error {
+	err := s.guard.do(fn)
+
+	var noKey *types.NoSuchKey
+	var notFound *types.NotFound
+	var noBucket *types.NoSuchBucket
+	if errors.As(err, &noKey) || errors.As(err, &notFound) || errors.As(err, &noBucket) {
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+	return err
+}
+
+// isUnreachable is true for requests that never got a response
+func isUnreachable(err error) bool {
+	var sendErr *smithyhttp.RequestSendError
+	return errors.As(err, &sendErr)
+}
+
+// streaming lets a body that can't be rewound (a part read straight off the request) go out
+// unsigned, otherwise the SDK refuses it on endpoints without TLS because it can't hash it first.
+// It can't be retried either, the bytes are gone once sent.
+func streaming(r io.Reader) func(*s3.Options) {
+	return func(o *s3.Options) {
+		if _, ok := r.(io.Seeker); ok {
+			return
+		}
+		o.RetryMaxAttempts = 1
+		o.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+		o.APIOptions = append(o.APIOptions, v4.SwapComputePayloadSHA256ForUnsignedPayloadMiddleware)
+	}
+}
+
+// etag drops the quotes S3 puts around ETags
+func etag(s *string) string {
+	return strings.Trim(aws.ToString(s), `"`)
+}
+
+// escapeKey URL-escapes a key for CopySource, keeping the slashes
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
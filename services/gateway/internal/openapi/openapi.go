@@ -0,0 +1,376 @@
+// Package openapi describes the REST API as an OpenAPI 3 document, for frontend and SDK developers
+// to generate clients from. The paths come from the routes gin has registered and the bodies from
+// the Go types the handlers bind and answer with, so the spec can't drift from the code, what is
+// written by hand is a short Operation per route saying what it is for and who may call it.
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/gin-gonic/gin"
+)
+
+// Spec is an OpenAPI 3.0 document
+type Spec struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Tags       []tag                `json:"tags,omitempty"`
+	Paths      map[string]*pathItem `json:"paths"`
+	Components components           `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type tag struct {
+	Name string `json:"name"`
+}
+
+type pathItem map[string]*operation
+
+type operation struct {
+	Tags        []string              `json:"tags,omitempty"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	OperationID string                `json:"operationId"`
+	Parameters  []parameter           `json:"parameters,omitempty"`
+	RequestBody *body                 `json:"requestBody,omitempty"`
+	Responses   map[string]response   `json:"responses"`
+	Security    []map[string][]string `json:"security"`
+}
+
+type parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type body struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]mediaType `json:"content"`
+}
+
+type mediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type response struct {
+	Description string               `json:"description"`
+	Headers     map[string]header    `json:"headers,omitempty"`
+	Content     map[string]mediaType `json:"content,omitempty"`
+}
+
+type header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]securityScheme `json:"securitySchemes"`
+}
+
+type securityScheme struct {
+	Type         string `json:"type"`
+	Description  string `json:"description,omitempty"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	In           string `json:"in,omitempty"`
+	Name         string `json:"name,omitempty"`
+}
+
+// Auth is who may call a route
+type Auth struct {
+	// Bearer needs an access token from /login or /refresh
+	Bearer bool
+	// Scope lets an X-API-Key with this scope stand in for the token
+	Scope string
+	// Admin needs the token of an admin
+	Admin bool
+}
+
+var (
+	Public = Auth{}
+	Bearer = Auth{Bearer: true}
+	Admin  = Auth{Bearer: true, Admin: true}
+)
+
+// Keyed routes take a bearer token or an API key with the scope
+func Keyed(scope string) Auth {
+	return Auth{Bearer: true, Scope: scope}
+}
+
+// Param is a query, path or form parameter
+type Param struct {
+	Name        string
+	Description string
+	// Type is string (the default), integer, boolean or file
+	Type     string
+	Required bool
+	// Array parameters may be repeated
+	Array bool
+	Enum  []string
+}
+
+// Operation is what the routes' code doesn't say about a route
+type Operation struct {
+	Summary string
+	// Description is markdown, shown under the summary
+	Description string
+	Tag         string
+	Auth        Auth
+	// Path describes the path parameters, undescribed ones are still listed
+	Path  []Param
+	Query []Param
+	// Body is a value of the JSON body's type
+	Body any
+	// BodyOptional bodies may be left out
+	BodyOptional bool
+	// Consumes takes a raw body of this content type
+	Consumes string
+	// Form are the fields of a multipart/form-data body
+	Form []Param
+	// Response is a value of what success answers with, a gin.H of sample values works too
+	Response any
+	// Status is the success status, 200 when left out
+	Status int
+	// Produces answers with a body of these content types instead of JSON
+	Produces []string
+	// Errors are the statuses it can fail with, on top of what its Auth and rate limit add
+	Errors []int
+	// Unlimited routes aren't rate limited
+	Unlimited bool
+}
+
+// errorSchema is how every error is answered, see the apierror package
+const errorSchema = "Error"
+
+// Build describes routes, ops are keyed by "METHOD /path" the way gin registered them.
+// A route without an Operation is still listed, and logged so it gets one.
+func Build(info Info, routes gin.RoutesInfo, ops map[string]Operation) *Spec {
+	spec := &Spec{
+		OpenAPI: "3.0.3",
+		Info:    info,
+		Paths:   map[string]*pathItem{},
+		Components: components{
+			Schemas: map[string]*Schema{},
+			SecuritySchemes: map[string]securityScheme{
+				"bearerAuth": {Type: "http", Scheme: "bearer", BearerFormat: "JWT", Description: "The access token from POST /login, POST /refresh or an OAuth login"},
+				"apiKey":     {Type: "apiKey", In: "header", Name: "X-API-Key", Description: "An API key from POST /apikeys, it only works on the routes its scopes cover"},
+			},
+		},
+	}
+	gen := newGenerator(spec.Components.Schemas)
+	spec.Components.Schemas[errorSchema] = &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"error": {Type: "string", Description: "What went wrong, for people"},
+			"code":  {Type: "string", Description: "What went wrong, for programs", Enum: apierror.Codes},
+			"fields": {Type: "array", Description: "What is wrong with each field of the input, with validation_failed", Items: &Schema{
+				Type:       "object",
+				Properties: map[string]*Schema{"field": {Type: "string"}, "message": {Type: "string"}},
+				Required:   []string{"field", "message"},
+			}},
+			"request_id": {Type: "string", Description: "The request's X-Request-ID, quote it when reporting a problem"},
+		},
+		Required: []string{"error", "code", "request_id"},
+	}
+
+	tags := map[string]bool{}
+	for _, route := range routes {
+		// gin answers HEAD for us on a few routes, it is GET without the body
+		if route.Method == http.MethodHead {
+			continue
+		}
+		key := route.Method + " " + route.Path
+		op, ok := ops[key]
+		if !ok {
+			log.Printf("OpenAPI: no description of %s\n", key)
+			op = Operation{Summary: key}
+		}
+
+		path, params := pathParams(route.Path, op.Path)
+		item := spec.Paths[path]
+		if item == nil {
+			item = &pathItem{}
+			spec.Paths[path] = item
+		}
+		out := gen.operation(route.Method, route.Path, op)
+		out.Parameters = append(params, out.Parameters...)
+		(*item)[strings.ToLower(route.Method)] = out
+
+		if op.Tag != "" && !tags[op.Tag] {
+			tags[op.Tag] = true
+			spec.Tags = append(spec.Tags, tag{Name: op.Tag})
+		}
+	}
+	sort.Slice(spec.Tags, func(i, j int) bool { return spec.Tags[i].Name < spec.Tags[j].Name })
+	return spec
+}
+
+// pathParams turns gin's /documents/:id into /documents/{id} and lists its parameters
+func pathParams(route string, described []Param) (string, []parameter) {
+	var params []parameter
+	segments := strings.Split(route, "/")
+	for i, segment := range segments {
+		if len(segment) < 2 || (segment[0] != ':' && segment[0] != '*') {
+			continue
+		}
+		name := segment[1:]
+		segments[i] = "{" + name + "}"
+		p := parameter{Name: name, In: "path", Required: true, Schema: &Schema{Type: "string"}}
+		for _, d := range described {
+			if d.Name == name {
+				p.Description = d.Description
+				p.Schema = d.schema()
+			}
+		}
+		params = append(params, p)
+	}
+	return strings.Join(segments, "/"), params
+}
+
+func (g *generator) operation(method, path string, op Operation) *operation {
+	out := &operation{
+		Summary:     op.Summary,
+		Description: op.Description,
+		OperationID: operationID(method, path),
+		Responses:   map[string]response{},
+		Security:    op.Auth.security(),
+	}
+	if op.Tag != "" {
+		out.Tags = []string{op.Tag}
+	}
+	if op.Auth.Scope != "" {
+		out.Description = strings.TrimSpace(out.Description + "\n\nAPI keys need the `" + op.Auth.Scope + "` scope.")
+	} else if op.Auth.Admin {
+		out.Description = strings.TrimSpace(out.Description + "\n\nOnly admins may call it.")
+	}
+
+	for _, q := range op.Query {
+		out.Parameters = append(out.Parameters, parameter{Name: q.Name, In: "query", Description: q.Description, Required: q.Required, Schema: q.schema()})
+	}
+
+	switch {
+	case op.Body != nil:
+		out.RequestBody = &body{Required: !op.BodyOptional, Content: map[string]mediaType{"application/json": {Schema: g.of(op.Body)}}}
+	case op.Consumes != "":
+		out.RequestBody = &body{Required: true, Content: map[string]mediaType{op.Consumes: {Schema: &Schema{Type: "string", Format: "binary"}}}}
+	case len(op.Form) > 0:
+		form := &Schema{Type: "object", Properties: map[string]*Schema{}}
+		for _, f := range op.Form {
+			s := f.schema()
+			s.Description = f.Description
+			form.Properties[f.Name] = s
+			if f.Required {
+				form.Required = append(form.Required, f.Name)
+			}
+		}
+		out.RequestBody = &body{Required: true, Content: map[string]mediaType{"multipart/form-data": {Schema: form}}}
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := response{Description: http.StatusText(status)}
+	switch {
+	case len(op.Produces) > 0:
+		success.Content = map[string]mediaType{}
+		for _, contentType := range op.Produces {
+			success.Content[contentType] = mediaType{Schema: &Schema{Type: "string", Format: "binary"}}
+		}
+	case op.Response != nil:
+		success.Content = map[string]mediaType{"application/json": {Schema: g.of(op.Response)}}
+	}
+	out.Responses[strconv.Itoa(status)] = success
+
+	failures := append([]int{}, op.Errors...)
+	if op.Body != nil {
+		failures = append(failures, http.StatusBadRequest)
+	}
+	if op.Auth.Bearer {
+		failures = append(failures, http.StatusUnauthorized)
+	}
+	if op.Auth.Scope != "" || op.Auth.Admin {
+		failures = append(failures, http.StatusForbidden)
+	}
+	if !op.Unlimited {
+		failures = append(failures, http.StatusTooManyRequests)
+	}
+	failures = append(failures, http.StatusInternalServerError)
+	for _, code := range failures {
+		out.Responses[strconv.Itoa(code)] = errorResponse(code)
+	}
+	return out
+}
+
+func errorResponse(code int) response {
+	resp := response{
+		Description: http.StatusText(code),
+		Content:     map[string]mediaType{"application/json": {Schema: &Schema{Ref: "#/components/schemas/" + errorSchema}}},
+	}
+	if code == http.StatusTooManyRequests || code == http.StatusServiceUnavailable {
+		resp.Headers = map[string]header{"Retry-After": {Description: "Seconds to wait before trying again", Schema: &Schema{Type: "integer"}}}
+	}
+	return resp
+}
+
+// security is who may call it, a list of alternatives in OpenAPI terms
+func (a Auth) security() []map[string][]string {
+	out := []map[string][]string{}
+	if a.Bearer {
+		out = append(out, map[string][]string{"bearerAuth": {}})
+	}
+	if a.Scope != "" {
+		out = append(out, map[string][]string{"apiKey": {}})
+	}
+	return out
+}
+
+// operationID is a stable name for client generators, "GET /documents/:id/versions" is getDocumentsIdVersions
+func operationID(method, path string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+	for _, segment := range strings.FieldsFunc(path, func(r rune) bool { return r == '/' || r == '.' || r == '-' || r == '_' || r == ':' || r == '*' }) {
+		b.WriteString(strings.ToUpper(segment[:1]) + segment[1:])
+	}
+	return b.String()
+}
+
+func (p Param) schema() *Schema {
+	s := &Schema{Type: p.Type, Enum: p.Enum}
+	switch p.Type {
+	case "":
+		s.Type = "string"
+	case "file":
+		s = &Schema{Type: "string", Format: "binary"}
+	}
+	if p.Array {
+		return &Schema{Type: "array", Items: s}
+	}
+	return s
+}
+
+// Handler serves the spec as JSON
+func (s *Spec) Handler() gin.HandlerFunc {
+	raw, err := json.Marshal(s)
+	if err != nil {
+		panic(fmt.Sprintf("openapi: encoding the spec: %v", err))
+	}
+	return func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json; charset=utf-8", raw)
+	}
+}
@@ -0,0 +1,40 @@
+package openapi
+
+import (
+	"html/template"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// swaggerUIVersion pins the Swagger UI the docs page loads from the CDN
+const swaggerUIVersion = "5.17.14"
+
+var uiPage = template.Must(template.New("docs").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>{{.Title}}</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@{{.Version}}/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@{{.Version}}/swagger-ui-bundle.js" crossorigin></script>
+  <script>
+    window.ui = SwaggerUIBundle({url: {{.SpecURL}}, dom_id: "#swagger-ui", deepLinking: true, persistAuthorization: true});
+  </script>
+</body>
+</html>
+`))
+
+// UI serves Swagger UI for the spec at specURL, "Authorize" in it takes a bearer token or an API key
+func UI(title, specURL string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		c.Status(http.StatusOK)
+		err := uiPage.Execute(c.Writer, map[string]string{"Title": title, "Version": swaggerUIVersion, "SpecURL": specURL})
+		if err != nil {
+			c.Error(err)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+// Package passwords decides whether a new password is good enough: long enough, made of the
+// character classes the policy asks for and, when configured, not one of the passwords that
+// leaked in a known breach.
+package passwords
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+)
+
+// bcrypt only looks at the first 72 bytes and refuses longer passwords outright
+const maxBytes = 72
+
+// Policy checks passwords against the configured rules
+type Policy struct {
+	cfg    config.Passwords
+	client *http.Client
+}
+
+func New(cfg config.Passwords) *Policy {
+	if cfg.CheckBreached {
+		log.Printf("Checking new passwords against %s\n", cfg.BreachedURL)
+	}
+	return &Policy{cfg: cfg, client: &http.Client{Timeout: cfg.BreachTimeout}}
+}
+
+// Check says what is wrong with a new password, "" when nothing is. The message finishes a
+// sentence starting with the field's name and tells the user what to change, rather than
+// just that it was refused.
+func (p *Policy) Check(ctx context.Context, password string) string {
+	if len(password) > maxBytes {
+		return "must be at most " + strconv.Itoa(maxBytes) + " bytes long"
+	}
+	var problems []string
+	if utf8.RuneCountInString(password) < p.cfg.MinLength {
+		problems = append(problems, "be at least "+strconv.Itoa(p.cfg.MinLength)+" characters long")
+	}
+	if missing := p.classes(password); len(missing) > 0 {
+		problems = append(problems, "contain "+join(missing))
+	}
+	if len(problems) > 0 {
+		return "must " + join(problems)
+	}
+
+	if !p.cfg.CheckBreached {
+		return ""
+	}
+	count, err := p.breaches(ctx, password)
+	if err != nil {
+		// a weak password now beats nobody being able to sign up while the API is down
+		log.Printf("Skipping breached password check: %v\n", err)
+		return ""
+	}
+	if count > 0 {
+		return fmt.Sprintf("has appeared in %d known data breaches, choose one that hasn't", count)
+	}
+	return ""
+}
+
+// classes lists the character classes the policy asks for that password lacks
+func (p *Policy) classes(password string) []string {
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	var missing []string
+	if p.cfg.RequireUpper && !upper {
+		missing = append(missing, "an uppercase letter")
+	}
+	if p.cfg.RequireLower && !lower {
+		missing = append(missing, "a lowercase letter")
+	}
+	if p.cfg.RequireDigit && !digit {
+		missing = append(missing, "a digit")
+	}
+	if p.cfg.RequireSymbol && !symbol {
+		missing = append(missing, "a symbol")
+	}
+	return missing
+}
+
+// breaches asks the range API how often password was seen in breaches. Only the first 5
+// characters of its SHA-1 hash are sent, the API answers with the suffixes of every hash
+// sharing them and the match is found here. Add-Padding mixes in fake suffixes so the
+// response size doesn't give the prefix's real count away either.
+func (p *Policy) breaches(ctx context.Context, password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(p.cfg.BreachedURL, "/")+"/"+prefix, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Add-Padding", "true")
+	req.Header.Set("User-Agent", "docstream-gateway")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("range API answered %s", resp.Status)
+	}
+
+	// lines are "<35 hex characters>:<count>", padding has a count of 0
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		s, n, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if ok && strings.EqualFold(s, suffix) {
+			return strconv.Atoi(n)
+		}
+	}
+	return 0, scanner.Err()
+}
+
+// join lists items the way a sentence would, "a, b and c"
+func join(items []string) string {
+	if len(items) == 1 {
+		return items[0]
+	}
+	return strings.Join(items[:len(items)-1], ", ") + " and " + items[len(items)-1]
+}
@@ -0,0 +1,178 @@
+// Package policy decides what a plan lets a request do. Handlers ask it instead of reading the
+// limits of plans themselves, so a limit is enforced the same way wherever a request hits it.
+package policy
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+)
+
+// Limits a request can run into, the Limit of a Denied
+const (
+	LimitFileSize     = "max_file_size"
+	LimitMonthlyPages = "monthly_pages"
+	LimitStorage      = "max_storage"
+	LimitOCR          = "ocr"
+	LimitModels       = "models"
+	// LimitReadOnly is an account holding more than its plan's storage, see Enforce
+	LimitReadOnly = "read_only"
+)
+
+// Store is where plans, what accounts use and whether they are read-only come from
+type Store interface {
+	PlanFor(ctx context.Context, userID int, orgID string) (models.Plan, error)
+	MonthlyPages(ctx context.Context, userID int, orgID string, now time.Time) (int64, error)
+	StorageUsed(ctx context.Context, userID int, orgID string) (int64, error)
+	ReadOnly(ctx context.Context, userID int, orgID string) (bool, error)
+	SetReadOnly(ctx context.Context, userID int, orgID string, readOnly bool) (bool, error)
+}
+
+// Denied is a request the plan doesn't allow
+type Denied struct {
+	Plan    string
+	Limit   string
+	Message string
+}
+
+func (d *Denied) Error() string {
+	return d.Message
+}
+
+// For is the plan a request of userID goes by, the organization's when it is in orgID
+func For(ctx context.Context, store Store, userID int, orgID string) (models.Plan, error) {
+	plan, err := store.PlanFor(ctx, userID, orgID)
+	if err != nil {
+		return plan, fmt.Errorf("loading the plan: %w", err)
+	}
+	return plan, nil
+}
+
+// CheckFileSize refuses a file of size bytes over the plan's limit
+func CheckFileSize(plan models.Plan, size int64) error {
+	if plan.MaxFileSize > 0 && size > plan.MaxFileSize {
+		return &Denied{Plan: plan.Name, Limit: LimitFileSize,
+			Message: fmt.Sprintf("File is too large, the limit on the %s plan is %d bytes", plan.Name, plan.MaxFileSize)}
+	}
+	return nil
+}
+
+// CheckPages refuses more processing once the month's pages are used up. The pages of a job are
+// only known when it is done, so the last document of a month can go over.
+func CheckPages(ctx context.Context, store Store, plan models.Plan, userID int, orgID string) error {
+	if plan.MonthlyPages == 0 {
+		return nil
+	}
+	used, err := store.MonthlyPages(ctx, userID, orgID, time.Now())
+	if err != nil {
+		return fmt.Errorf("loading the pages used: %w", err)
+	}
+	if used >= plan.MonthlyPages {
+		return &Denied{Plan: plan.Name, Limit: LimitMonthlyPages,
+			Message: fmt.Sprintf("The %d pages a month of the %s plan are used up", plan.MonthlyPages, plan.Name)}
+	}
+	return nil
+}
+
+// CheckStorage refuses adding size bytes to an account that is read-only or would go over the
+// plan's storage with them, 0 checks what is stored already
+func CheckStorage(ctx context.Context, store Store, plan models.Plan, userID int, orgID string, size int64) error {
+	readOnly, err := store.ReadOnly(ctx, userID, orgID)
+	if err != nil {
+		return fmt.Errorf("loading the account: %w", err)
+	}
+	if readOnly {
+		return &Denied{Plan: plan.Name, Limit: LimitReadOnly,
+			Message: fmt.Sprintf("The account is read-only, it holds more than the %d bytes the %s plan stores. Delete documents or upgrade.", plan.MaxStorage, plan.Name)}
+	}
+	if plan.MaxStorage == 0 {
+		return nil
+	}
+	used, err := store.StorageUsed(ctx, userID, orgID)
+	if err != nil {
+		return fmt.Errorf("loading the storage used: %w", err)
+	}
+	if used+size > plan.MaxStorage {
+		return &Denied{Plan: plan.Name, Limit: LimitStorage,
+			Message: fmt.Sprintf("The %d bytes of storage of the %s plan are used up, %d are taken", plan.MaxStorage, plan.Name, used)}
+	}
+	return nil
+}
+
+// Enforce puts an account holding more than its plan's storage in read-only, and takes one that
+// fits back out. It runs when the plan changed, a downgrade can leave an account over, and as
+// documents are purged. changed reports whether the account was flipped either way.
+func Enforce(ctx context.Context, store Store, userID int, orgID string) (readOnly, changed bool, err error) {
+	plan, err := For(ctx, store, userID, orgID)
+	if err != nil {
+		return false, false, err
+	}
+	if plan.MaxStorage > 0 {
+		used, err := store.StorageUsed(ctx, userID, orgID)
+		if err != nil {
+			return false, false, fmt.Errorf("loading the storage used: %w", err)
+		}
+		readOnly = used > plan.MaxStorage
+	}
+	changed, err = store.SetReadOnly(ctx, userID, orgID, readOnly)
+	return readOnly, changed, err
+}
+
+// CheckModel refuses a model the request picked that the plan doesn't include, "" is the
+// configured one and always passes
+func CheckModel(plan models.Plan, name string) error {
+	if name == "" || plan.AllowsModel(name) {
+		return nil
+	}
+	return &Denied{Plan: plan.Name, Limit: LimitModels, Message: fmt.Sprintf("The %s plan doesn't include %s", plan.Name, name)}
+}
+
+// CheckPipeline refuses a pipeline, worker stages comma separated, with a stage the plan doesn't include
+func CheckPipeline(plan models.Plan, pipeline string) error {
+	if plan.OCR || pipeline == "" {
+		return nil
+	}
+	for _, stage := range strings.Split(pipeline, ",") {
+		if strings.TrimSpace(stage) == models.StageOCR {
+			return &Denied{Plan: plan.Name, Limit: LimitOCR, Message: fmt.Sprintf("The %s plan doesn't include OCR", plan.Name)}
+		}
+	}
+	return nil
+}
+
+// Defaults drops the models a plan doesn't include from options picked ahead of a job, like a
+// collection's defaults or a user's preferences. They may have been picked on another plan.
+// options is left alone.
+func Defaults(plan models.Plan, options *models.JobOptions) *models.JobOptions {
+	if options == nil {
+		return nil
+	}
+	allowed := *options
+	if !plan.AllowsModel(allowed.EmbeddingModel) {
+		allowed.EmbeddingModel = ""
+	}
+	if !plan.AllowsModel(allowed.SummaryModel) {
+		allowed.SummaryModel = ""
+	}
+	return &allowed
+}
+
+// Apply holds the options of a job about to be queued to the plan, without OCR it skips the
+// ocr stage. options is left alone, nil stays nil when nothing changes.
+func Apply(plan models.Plan, options *models.JobOptions) *models.JobOptions {
+	if plan.OCR {
+		return options
+	}
+	var applied models.JobOptions
+	if options != nil {
+		applied = *options
+	}
+	if !slices.Contains(strings.Split(applied.Skip, ","), models.StageOCR) {
+		applied.Skip = strings.Trim(applied.Skip+","+models.StageOCR, ",")
+	}
+	return &applied
+}
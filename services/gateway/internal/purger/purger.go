@@ -0,0 +1,347 @@
+package purger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/keyword"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/objectstore"
+	"github.com/dhruvkshah75/docstream/gateway/internal/queue"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/dhruvkshah75/docstream/gateway/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const reapBatch = 100
+
+// Tombstone tells downstream consumers a document is gone for good
+type Tombstone struct {
+	Type       string `json:"type"`
+	DocumentID string `json:"document_id"`
+	UserID     int    `json:"user_id"`
+	Bucket     string `json:"bucket"`
+	ObjectKey  string `json:"object_key"`
+	Timestamp  int64  `json:"timestamp"`
+	// Collections are the vector collections embedding migrations filled, besides the configured one
+	Collections []string `json:"collections,omitempty"`
+}
+
+// Purger removes soft-deleted documents for real once their retention window is over:
+// the stored objects of every version and the thumbnails go, a tombstone is published and the row is marked purged.
+// The row itself stays behind as a record of the deletion, without its tags, metadata or versions.
+// It also applies the organizations' retention rules, finishes deleting accounts, and leaves documents under legal hold alone.
+type Purger struct {
+	store   storage.Store
+	objects objectstore.Store
+	queue   queue.Publisher
+	// keywords is the keyword index, nil when keyword search is off
+	keywords keyword.Index
+	// bucket is where avatars are, documents carry their own
+	bucket string
+	// Retention is how long a deleted document can still be recovered, 0 purges right away
+	Retention time.Duration
+}
+
+// New keeps deleted documents around for retention (e.g. 72h), 0 means purge immediately
+func New(store storage.Store, objects objectstore.Store, publisher queue.Publisher, keywords keyword.Index, bucket string, retention time.Duration) *Purger {
+	return &Purger{store: store, objects: objects, queue: publisher, keywords: keywords, bucket: bucket, Retention: retention}
+}
+
+// PurgeAt is when a document deleted at deletedAt will be purged
+func (p *Purger) PurgeAt(deletedAt time.Time) time.Time {
+	return deletedAt.Add(p.Retention)
+}
+
+// Purge deletes the objects and announces the tombstone. It is safe to call again
+// after a partial failure, which is exactly what the reaper does.
+func (p *Purger) Purge(ctx context.Context, doc models.Document) error {
+	// Delete doesn't mind files the worker never got to render
+	for _, file := range models.DerivedFiles {
+		if err := p.objects.Delete(ctx, doc.Bucket, models.DerivedKey(doc.ID, file)); err != nil {
+			return fmt.Errorf("removing %s: %w", file, err)
+		}
+	}
+
+	versions, err := p.store.ListDocumentVersions(ctx, doc.ID)
+	if err != nil {
+		return fmt.Errorf("listing versions: %w", err)
+	}
+	keys := []string{doc.ObjectKey}
+	for _, v := range versions {
+		if v.ObjectKey != doc.ObjectKey {
+			keys = append(keys, v.ObjectKey)
+		}
+	}
+	for _, key := range keys {
+		// an object that is already gone counts as removed
+		spanCtx, span := tracing.Start(ctx, "objectstore.Delete", attribute.String("object.key", key))
+		err := p.objects.Delete(spanCtx, doc.Bucket, key)
+		tracing.End(span, err)
+		if err != nil {
+			return fmt.Errorf("removing object: %w", err)
+		}
+	}
+
+	// the worker drops the vectors when it hears the tombstone, the keyword index is the gateway's
+	if p.keywords != nil {
+		if err := p.keywords.DeleteDocument(ctx, doc.ID); err != nil {
+			return fmt.Errorf("removing chunks from the keyword index: %w", err)
+		}
+	}
+
+	// the worker drops the vectors from the configured collection and these
+	migrations, err := p.store.ListEmbeddingMigrations(ctx)
+	if err != nil {
+		return fmt.Errorf("listing embedding migrations: %w", err)
+	}
+	var collections []string
+	for _, m := range migrations {
+		collections = append(collections, m.Collection)
+	}
+	body, _ := json.Marshal(Tombstone{
+		Type:        "document.deleted",
+		DocumentID:  doc.ID,
+		UserID:      doc.UserID,
+		Bucket:      doc.Bucket,
+		ObjectKey:   doc.ObjectKey,
+		Timestamp:   time.Now().Unix(),
+		Collections: collections,
+	})
+	if err := p.queue.PublishTombstone(ctx, doc.ID, body); err != nil {
+		return fmt.Errorf("publishing tombstone: %w", err)
+	}
+
+	if err := p.store.MarkDocumentPurged(ctx, doc.ID); err != nil {
+		return err
+	}
+	p.audit(ctx, models.AuditDocumentPurged, fmt.Sprintf("document %s purged from the trash", doc.ID))
+	return nil
+}
+
+// Reap purges documents whose retention is over, it is the purge_documents schedule.
+// With no retention it still picks up immediate purges that failed.
+func (p *Purger) Reap(ctx context.Context) (string, error) {
+	docs, err := p.store.ListPurgeableDocuments(ctx, time.Now().Add(-p.Retention), reapBatch)
+	if err != nil {
+		return "", fmt.Errorf("listing purgeable documents: %w", err)
+	}
+
+	failed := 0
+	for _, doc := range docs {
+		if err := p.Purge(ctx, doc); err != nil {
+			log.Printf("Failed to purge document %s: %v\n", doc.ID, err)
+			failed++
+			continue
+		}
+		log.Printf("Purged document %s\n", doc.ID)
+	}
+	if failed > 0 {
+		return "", fmt.Errorf("purged %d documents, %d failed", len(docs)-failed, failed)
+	}
+	return fmt.Sprintf("purged %d documents", len(docs)), nil
+}
+
+// Expire moves documents past their organization's retention rule to the trash, it is the
+// expire_documents schedule. From there they are purged like any deleted document.
+func (p *Purger) Expire(ctx context.Context) (string, error) {
+	orgs, err := p.store.ListOrgsWithRetention(ctx)
+	if err != nil {
+		return "", fmt.Errorf("listing retention rules: %w", err)
+	}
+
+	expired, failed := 0, 0
+	for _, org := range orgs {
+		cutoff := time.Now().AddDate(0, 0, -*org.RetentionDays)
+		docs, err := p.store.ListExpiredDocuments(ctx, org.ID, cutoff, reapBatch)
+		if err != nil {
+			return "", fmt.Errorf("listing expired documents of %s: %w", org.ID, err)
+		}
+		for _, doc := range docs {
+			doc, err := p.store.SoftDeleteDocument(ctx, doc.ID, doc.UserID)
+			if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrLegalHold) {
+				// deleted or put on hold since it was listed
+				continue
+			} else if err != nil {
+				log.Printf("Failed to expire document %s: %v\n", doc.ID, err)
+				failed++
+				continue
+			}
+			expired++
+			p.audit(ctx, models.AuditDocumentExpired, fmt.Sprintf("document %s of organization %s deleted after %d days of retention", doc.ID, org.ID, *org.RetentionDays))
+
+			if p.Retention == 0 {
+				// the reaper retries it if this fails
+				if err := p.Purge(ctx, doc); err != nil {
+					log.Printf("Failed to purge document %s: %v\n", doc.ID, err)
+				}
+			}
+		}
+	}
+	if failed > 0 {
+		return "", fmt.Errorf("expired %d documents, %d failed", expired, failed)
+	}
+	return fmt.Sprintf("expired %d documents", expired), nil
+}
+
+// AbortUpload discards an upload in progress: the parts of a chunked one, whatever a direct one
+// already put in storage
+func (p *Purger) AbortUpload(ctx context.Context, session models.UploadSession) error {
+	var err error
+	if session.Direct {
+		err = p.objects.Delete(ctx, session.Bucket, session.ObjectKey)
+	} else {
+		err = p.objects.AbortMultipart(ctx, session.Bucket, session.ObjectKey, session.MinioUploadID)
+	}
+	if err != nil {
+		return fmt.Errorf("aborting upload %s: %w", session.ID, err)
+	}
+	if err := p.store.UpdateUploadSession(ctx, session.ID, models.UploadStatusAborted, ""); err != nil {
+		return err
+	}
+	return p.store.DeleteUploadParts(ctx, session.ID)
+}
+
+// ExpireUploads aborts the direct uploads that were never completed, it is the expire_uploads
+// schedule. A file may have gone in without the client coming back, it is deleted. Uploads that
+// ended are swept once more, their URL could be written to until it expired.
+func (p *Purger) ExpireUploads(ctx context.Context) (string, error) {
+	sessions, err := p.store.ListExpiredUploadSessions(ctx, time.Now().Add(-models.DirectUploadGrace), reapBatch)
+	if err != nil {
+		return "", fmt.Errorf("listing expired uploads: %w", err)
+	}
+
+	failed := 0
+	for _, session := range sessions {
+		if session.Status == models.UploadStatusInProgress {
+			err = p.AbortUpload(ctx, session)
+		} else {
+			err = p.sweepUpload(ctx, session)
+		}
+		if err != nil {
+			log.Println("Failed to expire upload:", err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return "", fmt.Errorf("expired %d uploads, %d failed", len(sessions)-failed, failed)
+	}
+	return fmt.Sprintf("expired %d uploads", len(sessions)), nil
+}
+
+// sweepUpload deletes what was sent to an ended direct upload after it ended. Uploads from before
+// completing copied the file out kept the document under their own key, that is left alone.
+func (p *Purger) sweepUpload(ctx context.Context, session models.UploadSession) error {
+	if strings.HasPrefix(session.ObjectKey, models.DirectUploadPrefix) {
+		if err := p.objects.Delete(ctx, session.Bucket, session.ObjectKey); err != nil {
+			return fmt.Errorf("sweeping upload %s: %w", session.ID, err)
+		}
+	}
+	return p.store.ClearUploadExpiry(ctx, session.ID)
+}
+
+// PurgeAccount removes what DELETE /me left of an account: its documents, whatever the retention
+// (their vectors go with the tombstones), unfinished uploads, the avatar and data exports. Like
+// Purge it is safe to call again, the purge_accounts schedule does until it gets through.
+// Documents under legal hold keep the account on its list, they are purged once the hold is lifted.
+func (p *Purger) PurgeAccount(ctx context.Context, user models.User) error {
+	purged := 0
+	for {
+		docs, err := p.store.ListAccountDocuments(ctx, user.ID, reapBatch)
+		if err != nil {
+			return fmt.Errorf("listing documents: %w", err)
+		}
+		for _, doc := range docs {
+			if doc.DeletedAt == nil {
+				// it was on hold when the account was deleted
+				if doc, err = p.store.SoftDeleteDocument(ctx, doc.ID, user.ID); err != nil {
+					return fmt.Errorf("deleting document %s: %w", doc.ID, err)
+				}
+			}
+			if err := p.Purge(ctx, doc); err != nil {
+				return fmt.Errorf("purging document %s: %w", doc.ID, err)
+			}
+			purged++
+		}
+		if len(docs) < reapBatch {
+			break
+		}
+	}
+
+	sessions, err := p.store.ListOpenUploadSessions(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("listing uploads: %w", err)
+	}
+	for _, session := range sessions {
+		if err := p.AbortUpload(ctx, session); err != nil {
+			return err
+		}
+	}
+
+	if user.AvatarKey != "" {
+		if err := p.objects.Delete(ctx, p.bucket, user.AvatarKey); err != nil {
+			return fmt.Errorf("removing avatar: %w", err)
+		}
+	}
+	// the data exports are copies of all of it
+	exports, err := p.store.ListExports(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("listing exports: %w", err)
+	}
+	for _, exp := range exports {
+		if exp.ObjectKey == "" {
+			continue
+		}
+		if err := p.objects.Delete(ctx, p.bucket, exp.ObjectKey); err != nil {
+			return fmt.Errorf("removing export %s: %w", exp.ID, err)
+		}
+	}
+	if err := p.store.DeleteExports(ctx, user.ID); err != nil {
+		return err
+	}
+	finished, err := p.store.FinishAccountPurge(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if !finished {
+		log.Printf("Account %d keeps documents under legal hold, they are purged once it is lifted\n", user.ID)
+		return nil
+	}
+	p.audit(ctx, models.AuditAccountPurged, fmt.Sprintf("account %d purged with %d documents", user.ID, purged))
+	return nil
+}
+
+// PurgeAccounts finishes deleting accounts, it is the purge_accounts schedule. DELETE /me starts
+// on its account straight away, this picks up the ones that didn't get through.
+func (p *Purger) PurgeAccounts(ctx context.Context) (string, error) {
+	users, err := p.store.ListDeletedAccounts(ctx, reapBatch)
+	if err != nil {
+		return "", fmt.Errorf("listing deleted accounts: %w", err)
+	}
+
+	failed := 0
+	for _, user := range users {
+		if err := p.PurgeAccount(ctx, user); err != nil {
+			log.Printf("Failed to purge account %d: %v\n", user.ID, err)
+			failed++
+			continue
+		}
+		log.Printf("Purged account %d\n", user.ID)
+	}
+	if failed > 0 {
+		return "", fmt.Errorf("purged %d accounts, %d failed", len(users)-failed, failed)
+	}
+	return fmt.Sprintf("purged %d accounts", len(users)), nil
+}
+
+// audit records what the purger did on its own, no user is behind it
+func (p *Purger) audit(ctx context.Context, event, detail string) {
+	if err := p.store.CreateAuditEntry(ctx, models.AuditEntry{Event: event, Detail: detail}); err != nil {
+		log.Println("Failed to write audit entry:", err)
+	}
+}
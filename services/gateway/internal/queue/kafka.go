@@ -0,0 +1,325 @@
+package queue
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/breaker"
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+	"github.com/dhruvkshah75/docstream/gateway/internal/metrics"
+	"github.com/dhruvkshah75/docstream/gateway/internal/tracing"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Kafka topics, one per kind of message, shared with the worker. Each gets the configured
+// prefix in front. Jobs that fail for good are moved to TopicDeadLetters, retries wait in
+// TopicRetries until the worker moves them back onto TopicJobs.
+const (
+	TopicJobs          = "jobs"
+	TopicRetries       = "jobs.retry"
+	TopicDeadLetters   = "jobs.dlq"
+	TopicResults       = "results"
+	TopicEvents        = "events"
+	TopicTombstones    = "tombstones"
+	TopicCancellations = "cancellations"
+	// TopicBucketEvents is where MinIO's Kafka target sends the bucket notifications
+	TopicBucketEvents = "bucket_events"
+)
+
+const (
+	// the client retries a publish on its own for this long before giving up on it
+	kafkaPublishTimeout = 10 * time.Second
+	kafkaCommitTimeout  = 10 * time.Second
+	kafkaPingInterval   = 5 * time.Second
+
+	// events and cancellations are only useful while they are fresh
+	shortRetention = time.Hour
+)
+
+// kafkaBroker publishes with one idempotent producer client, every consumer gets a client
+// of its own. Messages are keyed by document ID, so everything about one document stays
+// in order on one partition.
+type kafkaBroker struct {
+	cfg     config.Kafka
+	client  *kgo.Client
+	breaker *breaker.Breaker
+
+	// offline is kept up to date by watch, so Ready never has to touch the network
+	offline atomic.Bool
+	done    chan struct{}
+}
+
+func newKafka(ctx context.Context, cfg config.Kafka) (*kafkaBroker, error) {
+	client, err := kgo.NewClient(append(kafkaOpts(cfg), kgo.RecordDeliveryTimeout(kafkaPublishTimeout))...)
+	if err != nil {
+		return nil, fmt.Errorf("creating Kafka client: %w", err)
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := client.Ping(pingCtx); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("connecting to Kafka: %w", err)
+	}
+
+	// a locked down cluster may not let us create topics, then they have to exist already
+	if err := createTopics(ctx, client, cfg); err != nil {
+		log.Println("Warning: Failed to create the Kafka topics, they have to be created by hand:", err)
+	}
+
+	k := &kafkaBroker{cfg: cfg, client: client, breaker: breaker.New("kafka", breakerThreshold, breakerCooldown), done: make(chan struct{})}
+	go k.watch()
+
+	log.Println("Successfully connected to Kafka at", strings.Join(cfg.Brokers, ","))
+	return k, nil
+}
+
+// kafkaOpts are the connection settings every client shares
+func kafkaOpts(cfg config.Kafka) []kgo.Opt {
+	opts := []kgo.Opt{kgo.SeedBrokers(cfg.Brokers...), kgo.ClientID("docstream-gateway")}
+	if cfg.TLS {
+		opts = append(opts, kgo.DialTLSConfig(&tls.Config{MinVersion: tls.VersionTLS12}))
+	}
+	switch cfg.SASLMechanism {
+	case "plain":
+		opts = append(opts, kgo.SASL(plain.Auth{User: cfg.SASLUsername, Pass: cfg.SASLPassword}.AsMechanism()))
+	case "scram-sha-256":
+		opts = append(opts, kgo.SASL(scram.Auth{User: cfg.SASLUsername, Pass: cfg.SASLPassword}.AsSha256Mechanism()))
+	case "scram-sha-512":
+		opts = append(opts, kgo.SASL(scram.Auth{User: cfg.SASLUsername, Pass: cfg.SASLPassword}.AsSha512Mechanism()))
+	}
+	return opts
+}
+
+// createTopics creates whichever topics don't exist yet, the worker does the same on its side
+func createTopics(ctx context.Context, client *kgo.Client, cfg config.Kafka) error {
+	admin := kadm.NewClient(client)
+	retention := strconv.FormatInt(shortRetention.Milliseconds(), 10)
+
+	sets := []struct {
+		configs map[string]*string
+		topics  []string
+	}{
+		{nil, []string{TopicJobs, TopicRetries, TopicDeadLetters, TopicResults, TopicTombstones, TopicBucketEvents}},
+		{map[string]*string{"retention.ms": &retention}, []string{TopicEvents, TopicCancellations}},
+	}
+	for _, set := range sets {
+		names := make([]string, len(set.topics))
+		for i, t := range set.topics {
+			names[i] = cfg.TopicPrefix + t
+		}
+		resps, err := admin.CreateTopics(ctx, int32(cfg.Partitions), int16(cfg.ReplicationFactor), set.configs, names...)
+		if err != nil {
+			return err
+		}
+		for _, resp := range resps.Sorted() {
+			if resp.Err != nil && !errors.Is(resp.Err, kerr.TopicAlreadyExists) {
+				return fmt.Errorf("creating topic %s: %w", resp.Topic, resp.Err)
+			}
+		}
+	}
+	return nil
+}
+
+func (k *kafkaBroker) topic(name string) string { return k.cfg.TopicPrefix + name }
+
+func (k *kafkaBroker) PublishJob(ctx context.Context, documentID string, body []byte) error {
+	return k.publish(ctx, TopicJobs, documentID, body)
+}
+
+func (k *kafkaBroker) PublishTombstone(ctx context.Context, documentID string, body []byte) error {
+	return k.publish(ctx, TopicTombstones, documentID, body)
+}
+
+func (k *kafkaBroker) PublishCancellation(ctx context.Context, documentID string, body []byte) error {
+	return k.publish(ctx, TopicCancellations, documentID, body)
+}
+
+// PublishEvent leaves the breaker out of it like RabbitMQ's, the events topic is read from every
+// partition so the key only spreads the load
+func (k *kafkaBroker) PublishEvent(ctx context.Context, key string, body []byte) error {
+	if k.offline.Load() {
+		return ErrNotConnected
+	}
+	return k.client.ProduceSync(ctx, &kgo.Record{Topic: k.topic(TopicEvents), Key: []byte(key), Value: body}).FirstErr()
+}
+
+// publish waits for every in-sync replica to have the record, the client retries on its own
+// until kafkaPublishTimeout. While the breaker is open it fails right away.
+func (k *kafkaBroker) publish(ctx context.Context, topic, key string, body []byte) (err error) {
+	topic = k.topic(topic)
+	ctx, span := tracing.StartProducer(ctx, "publish "+topic,
+		attribute.String("messaging.system", "kafka"),
+		attribute.String("messaging.destination.name", topic),
+		attribute.String("messaging.kafka.message.key", key))
+	defer func() { tracing.End(span, err) }()
+
+	return k.breaker.Do(func() error {
+		if k.offline.Load() {
+			return ErrNotConnected
+		}
+
+		// the consumer picks the trace up from here
+		headers := map[string]string{}
+		tracing.Inject(ctx, headers)
+
+		rec := &kgo.Record{Topic: topic, Key: []byte(key), Value: body, Headers: kafkaHeaders(headers)}
+		if err := k.client.ProduceSync(ctx, rec).FirstErr(); err != nil {
+			metrics.PublishFailures.WithLabelValues(topic, "").Inc()
+			if errors.Is(err, kgo.ErrRecordTimeout) {
+				return fmt.Errorf("%w: %w", ErrNotConnected, err)
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+// ConsumeResults shares the results between the gateway replicas through a consumer group
+func (k *kafkaBroker) ConsumeResults(ctx context.Context) (<-chan Delivery, error) {
+	return k.consume(ctx, TopicResults, "gateway")
+}
+
+// ConsumeEvents reads every partition of the events topic from the end, no group involved
+func (k *kafkaBroker) ConsumeEvents(ctx context.Context) (<-chan Delivery, error) {
+	return k.consume(ctx, TopicEvents, "")
+}
+
+// ConsumeBucketEvents shares the bucket notifications between the gateway replicas like the results
+func (k *kafkaBroker) ConsumeBucketEvents(ctx context.Context) (<-chan Delivery, error) {
+	return k.consume(ctx, TopicBucketEvents, "gateway-bucket-events")
+}
+
+// consume reads topic with a client of its own until ctx is done. In a group the partitions
+// are shared out between its members and acking commits the offset, a new group starts at
+// the oldest record. Without a group this consumer sees everything from now on and acks do nothing.
+func (k *kafkaBroker) consume(ctx context.Context, topic, group string) (<-chan Delivery, error) {
+	opts := append(kafkaOpts(k.cfg), kgo.ConsumeTopics(k.topic(topic)))
+	if group != "" {
+		opts = append(opts, kgo.ConsumerGroup(k.cfg.TopicPrefix+group), kgo.DisableAutoCommit(), kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()))
+	} else {
+		opts = append(opts, kgo.ConsumeResetOffset(kgo.NewOffset().AtEnd()))
+	}
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Println("Listening on Kafka topic", k.topic(topic))
+	out := make(chan Delivery)
+	go func() {
+		defer close(out)
+		defer client.Close()
+		for {
+			fetches := client.PollFetches(ctx)
+			if ctx.Err() != nil || fetches.IsClientClosed() {
+				return
+			}
+			// the client keeps retrying on its own, these are just worth knowing about
+			fetches.EachError(func(t string, p int32, err error) {
+				log.Printf("Kafka fetch error on %s/%d: %v\n", t, p, err)
+			})
+			for _, rec := range fetches.Records() {
+				select {
+				case out <- k.delivery(client, rec, group != ""):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+// delivery wraps a record. Kafka can't hand the same record out twice, so a requeue
+// publishes a copy to the back of the topic and commits the original.
+func (k *kafkaBroker) delivery(consumer *kgo.Client, rec *kgo.Record, grouped bool) Delivery {
+	d := Delivery{Body: rec.Value, Headers: map[string]string{}, Attempts: 1}
+	for _, h := range rec.Headers {
+		d.Headers[h.Key] = string(h.Value)
+	}
+	if n, err := strconv.Atoi(d.Headers[AttemptsHeader]); err == nil && n > 0 {
+		d.Attempts = n
+	}
+	if !grouped {
+		return d
+	}
+
+	commit := func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), kafkaCommitTimeout)
+		defer cancel()
+		return consumer.CommitRecords(ctx, rec)
+	}
+	d.ack = commit
+	d.nack = func(requeue bool) error {
+		if requeue {
+			ctx, cancel := context.WithTimeout(context.Background(), kafkaPublishTimeout)
+			defer cancel()
+			again := &kgo.Record{Topic: rec.Topic, Key: rec.Key, Value: rec.Value, Headers: rec.Headers}
+			if err := k.client.ProduceSync(ctx, again).FirstErr(); err != nil {
+				// left uncommitted, the group hands it out again after the next rebalance
+				return err
+			}
+		}
+		return commit()
+	}
+	return d
+}
+
+func kafkaHeaders(headers map[string]string) []kgo.RecordHeader {
+	out := make([]kgo.RecordHeader, 0, len(headers))
+	for k, v := range headers {
+		out = append(out, kgo.RecordHeader{Key: k, Value: []byte(v)})
+	}
+	return out
+}
+
+// watch pings the cluster every few seconds so Ready can answer without the network
+func (k *kafkaBroker) watch() {
+	ticker := time.NewTicker(kafkaPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-k.done:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		err := k.client.Ping(ctx)
+		cancel()
+		switch {
+		case err != nil && !k.offline.Swap(true):
+			log.Println("Kafka is unreachable:", err)
+		case err == nil && k.offline.Swap(false):
+			log.Println("Kafka is reachable again")
+			k.breaker.Reset()
+		}
+	}
+}
+
+// Ready reports whether publishing can work right now: the last ping got an answer and the breaker isn't open
+func (k *kafkaBroker) Ready() error {
+	if k.offline.Load() {
+		return ErrNotConnected
+	}
+	return k.breaker.Err()
+}
+
+// Close flushes nothing, every publish has already waited for its record to be written
+func (k *kafkaBroker) Close() {
+	close(k.done)
+	k.client.Close()
+}
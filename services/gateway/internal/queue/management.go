@@ -0,0 +1,96 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const managementTimeout = 5 * time.Second
+
+// Management reads queue depths from RabbitMQ's management API, the AMQP connection can only
+// see the queues it declares one at a time
+type Management struct {
+	base       string
+	user, pass string
+	vhost      string
+	client     *http.Client
+}
+
+// QueueStats is how many messages a queue holds and how many consumers take them
+type QueueStats struct {
+	Name      string `json:"name"`
+	Messages  int    `json:"messages"` // ready and unacknowledged together
+	Ready     int    `json:"messages_ready"`
+	Unacked   int    `json:"messages_unacknowledged"`
+	Consumers int    `json:"consumers"`
+}
+
+// NewManagement talks to the API at managementURL about the vhost of rabbitURL, signing in
+// with the credentials of managementURL or else those of rabbitURL
+func NewManagement(managementURL, rabbitURL string) (*Management, error) {
+	u, err := url.Parse(managementURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rabbitmq management url: %w", err)
+	}
+	amqpURI, err := amqp.ParseURI(rabbitURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rabbitmq url: %w", err)
+	}
+
+	m := &Management{user: amqpURI.Username, pass: amqpURI.Password, vhost: amqpURI.Vhost, client: &http.Client{Timeout: managementTimeout}}
+	if u.User != nil {
+		m.user = u.User.Username()
+		m.pass, _ = u.User.Password()
+		u.User = nil
+	}
+	if m.vhost == "" {
+		m.vhost = "/"
+	}
+	m.base = strings.TrimSuffix(u.String(), "/")
+	return m, nil
+}
+
+// Queues returns every queue of the vhost, by name
+func (m *Management) Queues(ctx context.Context) ([]QueueStats, error) {
+	queues := []QueueStats{}
+	err := m.get(ctx, "/api/queues/"+url.PathEscape(m.vhost)+"?"+statsColumns+"&sort=name", &queues)
+	return queues, err
+}
+
+// Backlog is the ingestion queue's ready messages
+func (m *Management) Backlog(ctx context.Context) (int, error) {
+	var q QueueStats
+	err := m.get(ctx, "/api/queues/"+url.PathEscape(m.vhost)+"/"+url.PathEscape(IngestionQueue)+"?"+statsColumns, &q)
+	return q.Ready, err
+}
+
+// statsColumns keeps the API from sending everything it knows about a queue
+const statsColumns = "columns=name,messages,messages_ready,messages_unacknowledged,consumers"
+
+func (m *Management) get(ctx context.Context, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.base+path, nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(m.user, m.pass)
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("rabbitmq management api answered %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("reading rabbitmq queues: %w", err)
+	}
+	return nil
+}
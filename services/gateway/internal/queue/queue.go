@@ -0,0 +1,121 @@
+// Package queue is the message bus between the gateway and the workers. RabbitMQ is the
+// default, Kafka is there for teams that already run it. QUEUE_BACKEND picks one and the
+// worker has to be configured with the same.
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+)
+
+// AttemptsHeader counts how many times a job has been tried, the worker sets it on retries
+const AttemptsHeader = "x-attempts"
+
+const (
+	// publishes that gave up after every retry before the breaker opens, and how long it stays open
+	breakerThreshold = 3
+	breakerCooldown  = 15 * time.Second
+)
+
+// ErrNotConnected is returned while the broker can't be reached
+var ErrNotConnected = errors.New("not connected to the message broker")
+
+// Delivery is one message handed to a consumer
+type Delivery struct {
+	Body []byte
+	// Headers carry the trace context along
+	Headers map[string]string
+	// Attempts is how often the job has been tried, counting this one
+	Attempts int
+
+	ack  func() error
+	nack func(requeue bool) error
+}
+
+// Ack marks the message as handled, deliveries that don't need acking ignore it
+func (d Delivery) Ack() error {
+	if d.ack == nil {
+		return nil
+	}
+	return d.ack()
+}
+
+// Nack gives the message up, requeue hands it out again instead of dropping it
+func (d Delivery) Nack(requeue bool) error {
+	if d.nack == nil {
+		return nil
+	}
+	return d.nack(requeue)
+}
+
+// Publisher sends messages from the gateway. Every one is keyed by the document it is
+// about, Kafka keeps the messages for one document in order on one partition.
+// While the broker can't be reached a publish fails with an error wrapping
+// ErrNotConnected or breaker.ErrOpen.
+type Publisher interface {
+	// PublishJob hands a job to the workers and waits for the broker to have it
+	PublishJob(ctx context.Context, documentID string, body []byte) error
+	// PublishTombstone announces that a document and everything derived from it should go
+	PublishTombstone(ctx context.Context, documentID string, body []byte) error
+	// PublishCancellation tells the workers to stop a job
+	PublishCancellation(ctx context.Context, documentID string, body []byte) error
+	// PublishEvent puts a live event of the gateway's own next to the worker's progress, key is
+	// "job.<job_id>" or "user.<user_id>". Like those it is sent once and lost if nobody listens.
+	PublishEvent(ctx context.Context, key string, body []byte) error
+	// Ready reports whether publishing can work right now. It doesn't touch the network,
+	// so it is cheap enough to check on every request.
+	Ready() error
+}
+
+// Consumer receives what the workers send back. The channels close when ctx is done or
+// the broker connection drops, consume again to carry on.
+type Consumer interface {
+	// ConsumeResults delivers job status updates, each one goes to a single gateway replica
+	ConsumeResults(ctx context.Context) (<-chan Delivery, error)
+	// ConsumeEvents delivers every live event, the worker's and the gateway's, to this replica, from now on.
+	// They don't need acking.
+	ConsumeEvents(ctx context.Context) (<-chan Delivery, error)
+	// ConsumeBucketEvents delivers the object storage notifications sent to the broker, each one
+	// to a single gateway replica
+	ConsumeBucketEvents(ctx context.Context) (<-chan Delivery, error)
+}
+
+// Broker is a connection to the message bus
+type Broker interface {
+	Publisher
+	Consumer
+	Close()
+}
+
+// DeadLetters is implemented by brokers whose dead letter queue can be browsed in place
+type DeadLetters interface {
+	// PeekDeadLetters returns up to limit dead-lettered jobs without taking them off the
+	// queue, along with how many there are in total
+	PeekDeadLetters(ctx context.Context, limit int) ([]Delivery, int, error)
+	// RequeueDeadLetter moves a job back onto the jobs queue with a fresh attempt count,
+	// it returns false when the job isn't in the dead letter queue
+	RequeueDeadLetter(ctx context.Context, jobID string) (bool, error)
+}
+
+// Backlog is implemented by whatever can tell how many jobs wait for a worker, RabbitMQ's
+// connection and its management API
+type Backlog interface {
+	// Backlog returns how many jobs in the ingestion queue no worker has taken yet
+	Backlog(ctx context.Context) (int, error)
+}
+
+// New connects to the broker cfg.Backend names, rabbitURL is only used for RabbitMQ.
+// The first connection has to work, there is no point starting without a broker.
+func New(ctx context.Context, cfg config.Queue, rabbitURL string) (Broker, error) {
+	switch cfg.Backend {
+	case "rabbitmq":
+		return newRabbitMQ(rabbitURL)
+	case "kafka":
+		return newKafka(ctx, cfg.Kafka)
+	}
+	return nil, fmt.Errorf("unknown queue backend %q", cfg.Backend)
+}
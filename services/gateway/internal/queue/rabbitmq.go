@@ -0,0 +1,659 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/breaker"
+	"github.com/dhruvkshah75/docstream/gateway/internal/metrics"
+	"github.com/dhruvkshah75/docstream/gateway/internal/tracing"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// IngestionQueue is where new jobs are published for the worker
+const IngestionQueue = "ingestion_jobs"
+
+// legacyIngestionQueue is where jobs went before the ingestion queue had a dead letter exchange.
+// RabbitMQ won't add arguments to a queue that exists, so the jobs still in it are moved over.
+const legacyIngestionQueue = "ingestion_queue"
+
+// Retry and dead letter topology, shared with the worker. A job the worker rejects is dead-lettered
+// through DeadLetterExchange into DeadLetterQueue, retries wait out their TTL in RetryQueue.
+const (
+	RetryQueue         = "ingestion_retry"
+	DeadLetterExchange = "ingestion_dlx"
+	DeadLetterQueue    = "ingestion_dlq"
+)
+
+// ResultsQueue is where the worker reports job status changes
+const ResultsQueue = "ingestion_results"
+
+// EventsExchange is the topic exchange live events go through, the worker's progress is routed by
+// "job.<job_id>" and the gateway's events about a user rather than a job by "user.<user_id>"
+const EventsExchange = "job_events"
+
+// BucketEvents is the fanout exchange and the queue bound to it that MinIO's AMQP target sends the
+// bucket notifications to, the target has to be configured with exchange_type=fanout and durable=on
+const BucketEvents = "bucket_events"
+
+// DocumentTombstones is a fanout exchange announcing purged documents,
+// anything holding derived data (vector index, caches) binds its own queue to it
+const DocumentTombstones = "document_tombstones"
+
+// JobCancellations is a fanout exchange telling every worker a job was cancelled,
+// whichever one is running it stops after its current stage
+const JobCancellations = "job_cancellations"
+
+const (
+	publishAttempts = 5
+	publishBackoff  = 200 * time.Millisecond
+	reconnectDelay  = 2 * time.Second
+	maxReconnect    = 30 * time.Second
+
+	// how deep a requeue looks through the DLQ for the job it was asked for
+	maxDLQScan = 1000
+)
+
+var errNacked = errors.New("broker did not confirm the message")
+
+// rabbitMQ owns the RabbitMQ connection used for publishing, consumers open channels of their own on it.
+// It puts the channel in confirm mode so a publish only succeeds once the broker
+// has the message, and re-dials (re-declaring the queue) whenever the connection drops, or
+// opens a new channel when the broker closes only the channel.
+// While publishes keep failing a circuit breaker refuses new ones straight away.
+type rabbitMQ struct {
+	url     string
+	breaker *breaker.Breaker
+
+	mu     sync.RWMutex
+	conn   *amqp.Connection
+	ch     *amqp.Channel
+	closed bool
+}
+
+// newRabbitMQ connects to the RabbitMQ at url and declares the queue
+func newRabbitMQ(url string) (*rabbitMQ, error) {
+	p := &rabbitMQ{url: url, breaker: breaker.New("rabbitmq", breakerThreshold, breakerCooldown)}
+
+	if err := p.connect(); err != nil {
+		return nil, fmt.Errorf("connecting to RabbitMQ: %w", err)
+	}
+
+	log.Println("Successfully connected to RabbitMQ")
+	return p, nil
+}
+
+// connect dials and opens the publishing channel on the new connection
+func (p *rabbitMQ) connect() error {
+	conn, err := amqp.Dial(p.url)
+	if err != nil {
+		return err
+	}
+
+	if err := p.openChannel(conn); err != nil {
+		conn.Close()
+		return err
+	}
+
+	p.mu.Lock()
+	p.conn = conn
+	p.mu.Unlock()
+
+	// watch for the connection dying so we can bring it back
+	go p.watch(conn.NotifyClose(make(chan *amqp.Error, 1)))
+	go p.moveLegacyJobs(context.Background())
+	return nil
+}
+
+// openChannel opens a confirm-mode channel on conn, declares the queues and exchanges that are
+// published to and makes it the publishing channel
+func (p *rabbitMQ) openChannel(conn *amqp.Connection) error {
+	ch, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("opening channel: %w", err)
+	}
+
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return fmt.Errorf("enabling publisher confirms: %w", err)
+	}
+
+	if err := declareIngestionQueue(ch); err != nil {
+		ch.Close()
+		return fmt.Errorf("declaring queue: %w", err)
+	}
+
+	if err := ch.ExchangeDeclare(DocumentTombstones, "fanout", true, false, false, false, nil); err != nil {
+		ch.Close()
+		return fmt.Errorf("declaring tombstone exchange: %w", err)
+	}
+	if err := ch.ExchangeDeclare(JobCancellations, "fanout", true, false, false, false, nil); err != nil {
+		ch.Close()
+		return fmt.Errorf("declaring cancellation exchange: %w", err)
+	}
+	// publishing to an exchange that doesn't exist closes the channel, and this one is shared
+	if err := ch.ExchangeDeclare(EventsExchange, "topic", true, false, false, false, nil); err != nil {
+		ch.Close()
+		return fmt.Errorf("declaring events exchange: %w", err)
+	}
+
+	p.mu.Lock()
+	p.ch = ch
+	p.mu.Unlock()
+
+	// the broker closes a channel on a channel error and leaves the connection up
+	go p.watchChannel(conn, ch.NotifyClose(make(chan *amqp.Error, 1)))
+	return nil
+}
+
+// declareIngestionQueue declares the ingestion queue along with its retry and dead letter queues.
+// The arguments must match the worker's, RabbitMQ refuses to redeclare a queue with different ones.
+func declareIngestionQueue(ch *amqp.Channel) error {
+	if err := ch.ExchangeDeclare(DeadLetterExchange, "direct", true, false, false, false, nil); err != nil {
+		return err
+	}
+
+	queues := []struct {
+		name string
+		args amqp.Table
+	}{
+		{IngestionQueue, amqp.Table{"x-dead-letter-exchange": DeadLetterExchange, "x-dead-letter-routing-key": DeadLetterQueue}},
+		// expired retries go back to the ingestion queue through the default exchange
+		{RetryQueue, amqp.Table{"x-dead-letter-exchange": "", "x-dead-letter-routing-key": IngestionQueue}},
+		{DeadLetterQueue, nil},
+	}
+	for _, q := range queues {
+		_, err := ch.QueueDeclare(
+			q.name, // name
+			true,   // durable
+			false,  // delete when unused
+			false,  // exclusive
+			false,  // no-wait
+			q.args, // arguments
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return ch.QueueBind(DeadLetterQueue, DeadLetterQueue, DeadLetterExchange, false, nil)
+}
+
+// moveLegacyJobs republishes the jobs waiting in legacyIngestionQueue to the ingestion queue and
+// deletes it once it is empty and nothing consumes it, on a broker that still has it
+func (p *rabbitMQ) moveLegacyJobs(ctx context.Context) {
+	ch, err := p.channel()
+	if err != nil {
+		return
+	}
+	defer ch.Close()
+
+	// a passive declare of a queue that doesn't exist closes the channel, which is ours alone
+	if _, err := ch.QueueDeclarePassive(legacyIngestionQueue, true, false, false, false, nil); err != nil {
+		return
+	}
+
+	moved := 0
+	for {
+		d, ok, err := ch.Get(legacyIngestionQueue, false)
+		if err != nil {
+			log.Printf("Failed to read %s: %v\n", legacyIngestionQueue, err)
+			return
+		}
+		if !ok {
+			break
+		}
+		// publish before acking, a job that didn't make it goes back when the channel closes
+		if err := p.PublishJob(ctx, "", d.Body); err != nil {
+			log.Printf("Failed to move a job from %s: %v\n", legacyIngestionQueue, err)
+			return
+		}
+		if err := d.Ack(false); err != nil {
+			log.Printf("Failed to ack a job moved from %s: %v\n", legacyIngestionQueue, err)
+			return
+		}
+		moved++
+	}
+	if moved > 0 {
+		log.Printf("Moved %d jobs from %s to %s\n", moved, legacyIngestionQueue, IngestionQueue)
+	}
+
+	// workers still on the old queue keep it around until the next time we connect
+	if _, err := ch.QueueDelete(legacyIngestionQueue, true, true, false); err != nil {
+		log.Printf("Left %s in place: %v\n", legacyIngestionQueue, err)
+	}
+}
+
+// watch blocks until the connection closes and then re-dials with backoff
+func (p *rabbitMQ) watch(closed <-chan *amqp.Error) {
+	reason, ok := <-closed
+	if !ok || reason == nil {
+		// a clean Close() from our side
+		return
+	}
+
+	log.Println("RabbitMQ connection lost:", reason)
+	p.mu.Lock()
+	p.ch = nil
+	p.mu.Unlock()
+
+	delay := reconnectDelay
+	for {
+		if p.isClosed() {
+			return
+		}
+		if err := p.connect(); err != nil {
+			log.Printf("RabbitMQ reconnect failed, retrying in %s: %v\n", delay, err)
+			time.Sleep(delay)
+			delay = min(delay*2, maxReconnect)
+			continue
+		}
+		log.Println("Reconnected to RabbitMQ")
+		p.breaker.Reset()
+		return
+	}
+}
+
+// watchChannel blocks until the publishing channel closes and then opens a new one on conn with
+// backoff. When conn went down with it watch re-dials instead.
+func (p *rabbitMQ) watchChannel(conn *amqp.Connection, closed <-chan *amqp.Error) {
+	reason, ok := <-closed
+	if !ok || reason == nil || conn.IsClosed() {
+		// a clean Close() from our side, or the connection is gone and watch has it
+		return
+	}
+
+	log.Println("RabbitMQ channel closed:", reason)
+	p.mu.Lock()
+	p.ch = nil
+	p.mu.Unlock()
+
+	delay := reconnectDelay
+	for {
+		if p.isClosed() || conn.IsClosed() {
+			return
+		}
+		if err := p.openChannel(conn); err != nil {
+			log.Printf("RabbitMQ channel reopen failed, retrying in %s: %v\n", delay, err)
+			time.Sleep(delay)
+			delay = min(delay*2, maxReconnect)
+			continue
+		}
+		log.Println("Reopened RabbitMQ channel")
+		p.breaker.Reset()
+		return
+	}
+}
+
+// PublishJob sends a JSON payload to the ingestion queue and waits for the broker to confirm it,
+// retrying with exponential backoff across reconnects. While the breaker is open it fails
+// right away with an error wrapping breaker.ErrOpen. RabbitMQ has no use for the document ID.
+func (p *rabbitMQ) PublishJob(ctx context.Context, documentID string, body []byte) error {
+	return p.publish(ctx, "", IngestionQueue, body)
+}
+
+func (p *rabbitMQ) PublishTombstone(ctx context.Context, documentID string, body []byte) error {
+	return p.publish(ctx, DocumentTombstones, "", body)
+}
+
+func (p *rabbitMQ) PublishCancellation(ctx context.Context, documentID string, body []byte) error {
+	return p.publish(ctx, JobCancellations, "", body)
+}
+
+// PublishEvent tries once and leaves the breaker out of it, a lost event costs a client a refetch
+// and shouldn't hold up the request that caused it or count against job publishes
+func (p *rabbitMQ) PublishEvent(ctx context.Context, key string, body []byte) error {
+	return p.publishOnce(ctx, EventsExchange, key, nil, body)
+}
+
+func (p *rabbitMQ) publish(ctx context.Context, exchange, key string, body []byte) (err error) {
+	ctx, span := tracing.StartProducer(ctx, "publish "+exchange+"/"+key,
+		attribute.String("messaging.system", "rabbitmq"),
+		attribute.String("messaging.destination.name", exchange),
+		attribute.String("messaging.rabbitmq.destination.routing_key", key))
+	defer func() { tracing.End(span, err) }()
+
+	return p.breaker.Do(func() error {
+		return p.publishWithRetries(ctx, exchange, key, body)
+	})
+}
+
+func (p *rabbitMQ) publishWithRetries(ctx context.Context, exchange, key string, body []byte) (err error) {
+	// the consumer picks the trace up from here
+	headers := map[string]string{}
+	tracing.Inject(ctx, headers)
+
+	backoff := publishBackoff
+
+	for attempt := 1; attempt <= publishAttempts; attempt++ {
+		if err = p.publishOnce(ctx, exchange, key, amqpHeaders(headers), body); err == nil {
+			return nil
+		}
+		log.Printf("Publish attempt %d/%d failed: %v\n", attempt, publishAttempts, err)
+
+		if attempt == publishAttempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	metrics.PublishFailures.WithLabelValues(exchange, key).Inc()
+	return err
+}
+
+func (p *rabbitMQ) publishOnce(ctx context.Context, exchange, key string, headers amqp.Table, body []byte) error {
+	p.mu.RLock()
+	ch := p.ch
+	p.mu.RUnlock()
+
+	if ch == nil || ch.IsClosed() {
+		return ErrNotConnected
+	}
+
+	confirm, err := ch.PublishWithDeferredConfirmWithContext(ctx,
+		exchange, // exchange
+		key,      // routing key
+		false,    // mandatory
+		false,    // immediate
+		amqp.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			Headers:      headers,
+			Body:         body,
+		})
+	if err != nil {
+		return err
+	}
+
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !acked {
+		return errNacked
+	}
+	return nil
+}
+
+// channel opens a new channel on the current connection, for consumers that need their own
+func (p *rabbitMQ) channel() (*amqp.Channel, error) {
+	p.mu.RLock()
+	conn := p.conn
+	p.mu.RUnlock()
+
+	if conn == nil || conn.IsClosed() {
+		return nil, ErrNotConnected
+	}
+	return conn.Channel()
+}
+
+// ConsumeResults reads the results queue with manual acks, every replica competes for the same queue
+func (p *rabbitMQ) ConsumeResults(ctx context.Context) (<-chan Delivery, error) {
+	ch, err := p.channel()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = ch.QueueDeclare(
+		ResultsQueue, // name
+		true,         // durable
+		false,        // delete when unused
+		false,        // exclusive
+		false,        // no-wait
+		nil,          // arguments
+	)
+	if err != nil {
+		ch.Close()
+		return nil, err
+	}
+
+	deliveries, err := ch.Consume(ResultsQueue, "", false, false, false, false, nil)
+	if err != nil {
+		ch.Close()
+		return nil, err
+	}
+	log.Println("Listening for job results on", ResultsQueue)
+	return relay(ctx, ch, deliveries, true), nil
+}
+
+// ConsumeEvents binds a queue of this replica's own to the events exchange
+func (p *rabbitMQ) ConsumeEvents(ctx context.Context) (<-chan Delivery, error) {
+	ch, err := p.channel()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ch.ExchangeDeclare(EventsExchange, "topic", true, false, false, false, nil); err != nil {
+		ch.Close()
+		return nil, err
+	}
+
+	// server named, exclusive and auto-deleted: it only lives as long as this replica
+	q, err := ch.QueueDeclare("", false, true, true, false, nil)
+	if err != nil {
+		ch.Close()
+		return nil, err
+	}
+	for _, key := range []string{"job.*", "user.*"} {
+		if err := ch.QueueBind(q.Name, key, EventsExchange, false, nil); err != nil {
+			ch.Close()
+			return nil, err
+		}
+	}
+
+	deliveries, err := ch.Consume(q.Name, "", true, true, false, false, nil)
+	if err != nil {
+		ch.Close()
+		return nil, err
+	}
+	log.Println("Listening for job events on", EventsExchange)
+	return relay(ctx, ch, deliveries, false), nil
+}
+
+// ConsumeBucketEvents reads the bucket events queue with manual acks, every replica competes for it
+func (p *rabbitMQ) ConsumeBucketEvents(ctx context.Context) (<-chan Delivery, error) {
+	ch, err := p.channel()
+	if err != nil {
+		return nil, err
+	}
+
+	// declared the way MinIO declares it, whichever of the two comes first
+	if err := ch.ExchangeDeclare(BucketEvents, "fanout", true, false, false, false, nil); err != nil {
+		ch.Close()
+		return nil, err
+	}
+	if _, err := ch.QueueDeclare(BucketEvents, true, false, false, false, nil); err != nil {
+		ch.Close()
+		return nil, err
+	}
+	if err := ch.QueueBind(BucketEvents, "", BucketEvents, false, nil); err != nil {
+		ch.Close()
+		return nil, err
+	}
+
+	deliveries, err := ch.Consume(BucketEvents, "", false, false, false, false, nil)
+	if err != nil {
+		ch.Close()
+		return nil, err
+	}
+	log.Println("Listening for bucket events on", BucketEvents)
+	return relay(ctx, ch, deliveries, true), nil
+}
+
+// PeekDeadLetters reads the DLQ without acking anything, closing the channel puts every message back
+func (p *rabbitMQ) PeekDeadLetters(ctx context.Context, limit int) ([]Delivery, int, error) {
+	ch, err := p.channel()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer ch.Close()
+
+	q, err := ch.QueueDeclarePassive(DeadLetterQueue, true, false, false, false, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("inspecting %s: %w", DeadLetterQueue, err)
+	}
+
+	jobs := []Delivery{}
+	for len(jobs) < limit {
+		d, ok, err := ch.Get(DeadLetterQueue, false)
+		if err != nil {
+			return nil, 0, fmt.Errorf("reading %s: %w", DeadLetterQueue, err)
+		}
+		if !ok {
+			break
+		}
+		jobs = append(jobs, fromAMQP(d, true))
+	}
+	return jobs, q.Messages, nil
+}
+
+// Backlog declares the ingestion queue passively, which reports its ready messages without
+// touching them
+func (p *rabbitMQ) Backlog(ctx context.Context) (int, error) {
+	ch, err := p.channel()
+	if err != nil {
+		return 0, err
+	}
+	defer ch.Close()
+
+	q, err := ch.QueueDeclarePassive(IngestionQueue, true, false, false, false, nil)
+	if err != nil {
+		return 0, fmt.Errorf("inspecting %s: %w", IngestionQueue, err)
+	}
+	return q.Messages, nil
+}
+
+// RequeueDeadLetter looks through the DLQ for jobID, the messages it skips over stay
+// unacked and go back when the channel closes
+func (p *rabbitMQ) RequeueDeadLetter(ctx context.Context, jobID string) (bool, error) {
+	ch, err := p.channel()
+	if err != nil {
+		return false, err
+	}
+	defer ch.Close()
+
+	for range maxDLQScan {
+		d, ok, err := ch.Get(DeadLetterQueue, false)
+		if err != nil {
+			return false, fmt.Errorf("reading %s: %w", DeadLetterQueue, err)
+		}
+		if !ok {
+			break
+		}
+
+		var payload struct {
+			JobID string `json:"job_id"`
+		}
+		if json.Unmarshal(d.Body, &payload) != nil || payload.JobID != jobID {
+			continue
+		}
+
+		// publish before acking, at worst the job is in both queues for a moment, never in neither
+		if err := p.PublishJob(ctx, "", d.Body); err != nil {
+			return false, err
+		}
+		if err := d.Ack(false); err != nil {
+			log.Printf("Failed to ack DLQ message for %s: %v\n", jobID, err)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// relay turns AMQP deliveries into Deliveries until ctx is done or the channel closes, manual
+// says whether they are to be acked. It owns ch and closes it on the way out, which puts
+// anything unacked back on the queue.
+func relay(ctx context.Context, ch *amqp.Channel, deliveries <-chan amqp.Delivery, manual bool) <-chan Delivery {
+	out := make(chan Delivery)
+	go func() {
+		defer close(out)
+		defer ch.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case d, ok := <-deliveries:
+				if !ok {
+					return
+				}
+				select {
+				case out <- fromAMQP(d, manual):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+func fromAMQP(d amqp.Delivery, manual bool) Delivery {
+	delivery := Delivery{Body: d.Body, Headers: map[string]string{}, Attempts: 1}
+	for k, v := range d.Headers {
+		if s, ok := v.(string); ok {
+			delivery.Headers[k] = s
+		}
+	}
+	switch n := d.Headers[AttemptsHeader].(type) {
+	case int32:
+		delivery.Attempts = int(n)
+	case int64:
+		delivery.Attempts = int(n)
+	}
+	// acking an auto-acked delivery is a channel error, so those get no ack at all
+	if manual {
+		delivery.ack = func() error { return d.Ack(false) }
+		delivery.nack = func(requeue bool) error { return d.Nack(false, requeue) }
+	}
+	return delivery
+}
+
+func amqpHeaders(headers map[string]string) amqp.Table {
+	table := amqp.Table{}
+	for k, v := range headers {
+		table[k] = v
+	}
+	return table
+}
+
+// Ready reports whether publishing can work right now: there is an open channel and the breaker isn't open
+func (p *rabbitMQ) Ready() error {
+	p.mu.RLock()
+	conn, ch := p.conn, p.ch
+	p.mu.RUnlock()
+
+	if conn == nil || conn.IsClosed() || ch == nil || ch.IsClosed() {
+		return ErrNotConnected
+	}
+	return p.breaker.Err()
+}
+
+func (p *rabbitMQ) isClosed() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.closed
+}
+
+// Close shuts down the connection and stops any reconnect attempts
+func (p *rabbitMQ) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	if p.ch != nil {
+		p.ch.Close()
+	}
+	if p.conn != nil {
+		p.conn.Close()
+	}
+}
@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	per    time.Duration
+}
+
+// refill tops the bucket up for the time passed since it was last touched
+func (b *bucket) refill(now time.Time, rate Rate) {
+	perToken := rate.Per / time.Duration(rate.Requests)
+	b.tokens = min(float64(rate.Requests), b.tokens+float64(now.Sub(b.last))/float64(perToken))
+	b.last = now
+}
+
+// Memory keeps buckets in this process, fine for a single gateway
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+func NewMemory() *Memory {
+	m := &Memory{buckets: map[string]*bucket{}}
+	go m.sweep()
+	return m
+}
+
+func (m *Memory) Allow(ctx context.Context, key string, rate Rate) (bool, time.Duration, error) {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(rate.Requests), last: now}
+		m.buckets[key] = b
+	}
+	b.per = rate.Per
+	b.refill(now, rate)
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, nil
+	}
+	perToken := rate.Per / time.Duration(rate.Requests)
+	return false, time.Duration((1 - b.tokens) * float64(perToken)), nil
+}
+
+// sweep drops buckets that have been idle long enough to be full again, they'd start full anyway
+func (m *Memory) sweep() {
+	for range time.Tick(sweepInterval) {
+		now := time.Now()
+		m.mu.Lock()
+		for key, b := range m.buckets {
+			if now.Sub(b.last) > b.per {
+				delete(m.buckets, key)
+			}
+		}
+		m.mu.Unlock()
+	}
+}
@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+)
+
+// quotaTTL is how long overrides are cached, other replicas pick up an admin's change within it
+const quotaTTL = 30 * time.Second
+
+// Quotas are the per-user overrides admins set on the upload, search and ask limits, cached
+// so a limited request doesn't cost a database query
+type Quotas struct {
+	store storage.QuotaStore
+
+	mu     sync.Mutex
+	cached map[int]cachedQuota
+	// swept is when expired entries were last dropped, at most once per quotaTTL
+	swept time.Time
+}
+
+type cachedQuota struct {
+	quota   models.Quota
+	fetched time.Time
+}
+
+func NewQuotas(store storage.QuotaStore) *Quotas {
+	return &Quotas{store: store, cached: map[int]cachedQuota{}}
+}
+
+// Rate is userID's rate for the limit called name, fallback unless an admin overrode it.
+// A nil Quotas always returns fallback.
+func (q *Quotas) Rate(ctx context.Context, userID int, name string, fallback Rate) Rate {
+	if q == nil {
+		return fallback
+	}
+	value := q.get(ctx, userID).Rate(name)
+	if value == "" {
+		return fallback
+	}
+	rate, err := ParseRate(value)
+	if err != nil {
+		log.Printf("Ignoring the %s quota of user %d: %v\n", name, userID, err)
+		return fallback
+	}
+	return rate
+}
+
+func (q *Quotas) get(ctx context.Context, userID int) models.Quota {
+	q.mu.Lock()
+	c, ok := q.cached[userID]
+	q.mu.Unlock()
+	if ok && time.Since(c.fetched) < quotaTTL {
+		return c.quota
+	}
+
+	quota, err := q.store.GetQuota(ctx, userID)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		// the configured limits it is until the database answers again
+		log.Println("Quota Lookup Error:", err)
+		return models.Quota{}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	if now.Sub(q.swept) >= quotaTTL {
+		for id, c := range q.cached {
+			if now.Sub(c.fetched) >= quotaTTL {
+				delete(q.cached, id)
+			}
+		}
+		q.swept = now
+	}
+	q.cached[userID] = cachedQuota{quota: quota, fetched: now}
+	return quota
+}
+
+// Forget drops userID's cached overrides after they changed, on this replica
+func (q *Quotas) Forget(userID int) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.cached, userID)
+}
@@ -0,0 +1,127 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/apierror"
+	"github.com/dhruvkshah75/docstream/gateway/internal/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// Rate is a token bucket that holds Requests tokens and refills them all over Per
+type Rate struct {
+	Requests int
+	Per      time.Duration
+}
+
+// ParseRate reads "10/m", "100/min", "5/s" or "1000/h". "0" or "off" disables the limit (zero Rate),
+// a rate has to let at least one request through, "0/m" is refused rather than read as off.
+func ParseRate(s string) (Rate, error) {
+	s = strings.TrimSpace(s)
+	if s == "0" || s == "off" {
+		return Rate{}, nil
+	}
+
+	count, unit, ok := strings.Cut(s, "/")
+	n, err := strconv.Atoi(count)
+	if !ok || err != nil || n < 0 {
+		return Rate{}, fmt.Errorf("invalid rate %q, expected something like 10/m", s)
+	}
+	if n == 0 {
+		return Rate{}, fmt.Errorf("invalid rate %q, use off to disable a limit", s)
+	}
+
+	per := map[string]time.Duration{
+		"s": time.Second, "sec": time.Second,
+		"m": time.Minute, "min": time.Minute,
+		"h": time.Hour, "hour": time.Hour,
+	}[unit]
+	if per == 0 {
+		return Rate{}, fmt.Errorf("invalid rate unit %q, use s, m or h", unit)
+	}
+	return Rate{Requests: n, Per: per}, nil
+}
+
+// Limiter takes one token from key's bucket, returning how long to wait when it's empty
+type Limiter interface {
+	Allow(ctx context.Context, key string, rate Rate) (ok bool, retryAfter time.Duration, err error)
+}
+
+// New picks the backend: Redis when redisURL is set so every replica shares the same buckets,
+// otherwise buckets live in this process
+func New(redisURL string) Limiter {
+	url := redisURL
+	if url == "" {
+		log.Println("Rate limiting with in-memory buckets")
+		return NewMemory()
+	}
+
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		log.Fatalf("Invalid REDIS_URL: %v\n", err)
+	}
+	client := redis.NewClient(opts)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		log.Fatalf("Failed to connect to Redis: %v\n", err)
+	}
+
+	log.Println("Rate limiting with Redis")
+	return NewRedis(client)
+}
+
+// Refused hears about every request a per-user limit turns down, name is the limit's
+type Refused func(userID int, name string, retryAfter time.Duration)
+
+// PerIP limits every request by client IP
+func PerIP(l Limiter, rate Rate) gin.HandlerFunc {
+	fixed := func(*gin.Context) Rate { return rate }
+	return limit(l, fixed, "ip", func(c *gin.Context) string { return c.ClientIP() }, nil)
+}
+
+// PerUser limits by the authenticated user, so it must run after the auth middleware.
+// name keeps separate limits (say uploads and searches) in separate buckets, refused may be nil.
+// quotas overrides rate for the users an admin gave a different one, nil when there are none.
+func PerUser(l Limiter, rate Rate, name string, refused Refused, quotas *Quotas) gin.HandlerFunc {
+	key := func(c *gin.Context) string { return strconv.Itoa(middleware.UserID(c)) }
+	rateFor := func(c *gin.Context) Rate { return quotas.Rate(c.Request.Context(), middleware.UserID(c), name, rate) }
+	var onRefused func(*gin.Context, time.Duration)
+	if refused != nil {
+		onRefused = func(c *gin.Context, retryAfter time.Duration) { refused(middleware.UserID(c), name, retryAfter) }
+	}
+	return limit(l, rateFor, "user:"+name, key, onRefused)
+}
+
+func limit(l Limiter, rateFor func(*gin.Context) Rate, prefix string, key func(*gin.Context) string, refused func(*gin.Context, time.Duration)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rate := rateFor(c)
+		if rate.Requests == 0 {
+			c.Next()
+			return
+		}
+
+		ok, retryAfter, err := l.Allow(c.Request.Context(), prefix+":"+key(c), rate)
+		if err != nil {
+			// a broken limiter shouldn't take the API down with it
+			log.Println("Rate Limiter Error:", err)
+			c.Next()
+			return
+		}
+		if !ok {
+			if refused != nil {
+				refused(c, retryAfter)
+			}
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			apierror.Abort(c, http.StatusTooManyRequests, "Too many requests, slow down")
+			return
+		}
+		c.Next()
+	}
+}
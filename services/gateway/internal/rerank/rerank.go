@@ -0,0 +1,160 @@
+// Package rerank scores search candidates again with a cross-encoder, a model that reads the
+// query and a chunk together. That ranks better than comparing embeddings or counting words, but
+// costs a model call per chunk, so only the best few candidates get it.
+package rerank
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+)
+
+// Provider scores how relevant each of texts is to query, one score per text and in the same
+// order. Higher is more relevant, scores only compare within one call.
+type Provider interface {
+	Name() string
+	Model() string
+	Rerank(ctx context.Context, query string, texts []string) ([]float32, error)
+}
+
+// New picks the provider named by cfg.Provider: "cohere" for Cohere's rerank API and those that
+// copy it (Jina, Voyage, vLLM), or "tei" for a local HuggingFace text-embeddings-inference
+// serving a reranker. It returns nil when that is empty, which turns reranking off.
+func New(cfg config.Rerank) (Provider, error) {
+	switch cfg.Provider {
+	case "":
+		return nil, nil
+	case "cohere":
+		if cfg.APIKey == "" && cfg.URL == "" {
+			return nil, fmt.Errorf("RERANK_API_KEY is required for Cohere's API")
+		}
+		baseURL := orDefault(cfg.URL, "https://api.cohere.com/v2")
+		return &cohere{baseURL: strings.TrimRight(baseURL, "/"), apiKey: cfg.APIKey, model: orDefault(cfg.Model, "rerank-v3.5")}, nil
+	case "tei":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("RERANK_URL is required for tei, the text-embeddings-inference serving the reranker")
+		}
+		return &tei{baseURL: strings.TrimRight(cfg.URL, "/"), model: orDefault(cfg.Model, "BAAI/bge-reranker-base")}, nil
+	default:
+		return nil, fmt.Errorf("unknown RERANK_PROVIDER %q, use cohere or tei", cfg.Provider)
+	}
+}
+
+// cohere talks to a /rerank endpoint that takes the documents and answers with their indexes and scores
+type cohere struct {
+	baseURL string
+	apiKey  string
+	model   string
+}
+
+func (p *cohere) Name() string  { return "cohere" }
+func (p *cohere) Model() string { return p.model }
+
+func (p *cohere) Rerank(ctx context.Context, query string, texts []string) ([]float32, error) {
+	var resp struct {
+		Results []struct {
+			Index          int     `json:"index"`
+			RelevanceScore float32 `json:"relevance_score"`
+		} `json:"results"`
+	}
+	body := map[string]any{"model": p.model, "query": query, "documents": texts}
+	var headers map[string]string
+	if p.apiKey != "" {
+		headers = map[string]string{"Authorization": "Bearer " + p.apiKey}
+	}
+	if err := postJSON(ctx, p.baseURL+"/rerank", headers, body, &resp); err != nil {
+		return nil, err
+	}
+
+	scores := make([]float32, len(texts))
+	seen := 0
+	for _, r := range resp.Results {
+		if r.Index < 0 || r.Index >= len(texts) {
+			return nil, fmt.Errorf("cohere scored text %d of %d", r.Index, len(texts))
+		}
+		scores[r.Index] = r.RelevanceScore
+		seen++
+	}
+	if seen != len(texts) {
+		return nil, fmt.Errorf("cohere returned %d scores for %d texts", seen, len(texts))
+	}
+	return scores, nil
+}
+
+// tei is HuggingFace text-embeddings-inference started with a reranker (sequence classification)
+// model. Like for embeddings it serves the one model it was started with.
+type tei struct {
+	baseURL string
+	model   string
+}
+
+func (p *tei) Name() string  { return "tei" }
+func (p *tei) Model() string { return p.model }
+
+func (p *tei) Rerank(ctx context.Context, query string, texts []string) ([]float32, error) {
+	var resp []struct {
+		Index int     `json:"index"`
+		Score float32 `json:"score"`
+	}
+	body := map[string]any{"query": query, "texts": texts, "truncate": true}
+	if err := postJSON(ctx, p.baseURL+"/rerank", nil, body, &resp); err != nil {
+		return nil, err
+	}
+
+	scores := make([]float32, len(texts))
+	if len(resp) != len(texts) {
+		return nil, fmt.Errorf("tei returned %d scores for %d texts", len(resp), len(texts))
+	}
+	for _, r := range resp {
+		if r.Index < 0 || r.Index >= len(texts) {
+			return nil, fmt.Errorf("tei scored text %d of %d", r.Index, len(texts))
+		}
+		scores[r.Index] = r.Score
+	}
+	return scores, nil
+}
+
+// a search waits for the reranker, it isn't retried the way embedding a document is
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// postJSON sends body to url and decodes the JSON answer into out
+func postJSON(ctx context.Context, url string, headers map[string]string, body, out any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("reranker returned %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func orDefault(v, fallback string) string {
+	if v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,190 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+	"github.com/dhruvkshah75/docstream/gateway/internal/envelope"
+	"github.com/dhruvkshah75/docstream/gateway/internal/metrics"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/objectstore"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+	"github.com/dhruvkshah75/docstream/gateway/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// QuarantinePrefix is where infected objects are moved to inside the same bucket
+	QuarantinePrefix = "quarantine/"
+	chunkSize        = 64 << 10
+)
+
+// Verdict is what clamd made of a file
+type Verdict struct {
+	Infected  bool
+	Signature string // e.g. "Eicar-Test-Signature", only set when infected
+}
+
+// Scanner streams uploaded objects to clamd before they are handed to the worker.
+// It is off unless a clamd address is configured, so local dev doesn't need a ClamAV daemon.
+type Scanner struct {
+	store   storage.DocumentStore
+	objects objectstore.Store
+	keys    *envelope.Keyring
+	network string
+	addr    string
+	timeout time.Duration
+}
+
+// New connects to clamd at cfg.Addr, "localhost:3310" or "unix:/run/clamav/clamd.sock"
+func New(store storage.DocumentStore, objects objectstore.Store, keys *envelope.Keyring, cfg config.ClamAV) *Scanner {
+	s := &Scanner{store: store, objects: objects, keys: keys, network: "tcp", addr: cfg.Addr, timeout: cfg.Timeout}
+	if path, ok := strings.CutPrefix(s.addr, "unix:"); ok {
+		s.network, s.addr = "unix", path
+	}
+	if s.Enabled() {
+		log.Printf("Virus scanning enabled via clamd at %s\n", s.addr)
+	}
+	return s
+}
+
+// Enabled reports whether uploads get scanned at all
+func (s *Scanner) Enabled() bool {
+	return s != nil && s.addr != ""
+}
+
+// Scan sends r to clamd with the INSTREAM command: the data goes in chunks,
+// each prefixed with its length as a 4 byte big endian integer, and a zero
+// length chunk ends the stream
+func (s *Scanner) Scan(ctx context.Context, r io.Reader) (Verdict, error) {
+	dialer := net.Dialer{Timeout: 10 * time.Second}
+	conn, err := dialer.DialContext(ctx, s.network, s.addr)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("connecting to clamd: %w", err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(s.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	// the "z" prefix means commands and replies are NUL terminated
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return Verdict{}, fmt.Errorf("sending INSTREAM: %w", err)
+	}
+
+	buf := make([]byte, 4+chunkSize)
+	for {
+		n, readErr := r.Read(buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, err := conn.Write(buf[:4+n]); err != nil {
+				// clamd hangs up early when the stream goes over its StreamMaxLength, the reply says so
+				break
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return Verdict{}, fmt.Errorf("reading object: %w", readErr)
+		}
+	}
+	conn.Write([]byte{0, 0, 0, 0})
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		return Verdict{}, fmt.Errorf("reading clamd reply: %w", err)
+	}
+	return parseReply(strings.TrimRight(reply, "\x00\n"))
+}
+
+// parseReply understands "stream: OK", "stream: <signature> FOUND" and "<message> ERROR"
+func parseReply(reply string) (Verdict, error) {
+	reply = strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case reply == "OK":
+		return Verdict{}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return Verdict{Infected: true, Signature: strings.TrimSuffix(reply, " FOUND")}, nil
+	case strings.HasSuffix(reply, " ERROR"):
+		return Verdict{}, errors.New("clamd: " + strings.TrimSuffix(reply, " ERROR"))
+	default:
+		return Verdict{}, fmt.Errorf("unexpected clamd reply %q", reply)
+	}
+}
+
+// Check scans a stored document and records the outcome on its row. Infected objects
+// are moved under QuarantinePrefix, out of the way of the worker and downloads.
+// With scanning disabled every document passes without being touched.
+func (s *Scanner) Check(ctx context.Context, doc models.Document) (Verdict, error) {
+	if !s.Enabled() {
+		return Verdict{}, nil
+	}
+
+	ctx, span := tracing.Start(ctx, "clamav.Scan", attribute.String("document.id", doc.ID), attribute.String("object.key", doc.ObjectKey))
+	verdict, err := s.scanObject(ctx, doc)
+	tracing.End(span, err)
+
+	switch {
+	case err != nil:
+		metrics.VirusScans.WithLabelValues(models.ScanStatusError).Inc()
+		s.record(ctx, doc.ID, models.ScanStatusError, err.Error())
+		return verdict, err
+	case verdict.Infected:
+		metrics.VirusScans.WithLabelValues(models.ScanStatusInfected).Inc()
+		log.Printf("Document %s is infected (%s), quarantining it\n", doc.ID, verdict.Signature)
+		s.record(ctx, doc.ID, models.ScanStatusInfected, verdict.Signature)
+		if err := s.quarantine(ctx, doc); err != nil {
+			log.Printf("Failed to quarantine document %s: %v\n", doc.ID, err)
+		}
+		return verdict, nil
+	default:
+		metrics.VirusScans.WithLabelValues(models.ScanStatusClean).Inc()
+		s.record(ctx, doc.ID, models.ScanStatusClean, "")
+		return verdict, nil
+	}
+}
+
+func (s *Scanner) scanObject(ctx context.Context, doc models.Document) (Verdict, error) {
+	obj, err := s.objects.Get(ctx, doc.Bucket, doc.ObjectKey)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("opening object: %w", err)
+	}
+	// clamd has to see the file itself, not its ciphertext
+	obj, err = s.keys.Open(ctx, obj, doc.EncryptionKey, doc.Size)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("decrypting object: %w", err)
+	}
+	defer obj.Close()
+	return s.Scan(ctx, obj)
+}
+
+func (s *Scanner) record(ctx context.Context, id, status, result string) {
+	if err := s.store.SetDocumentScan(ctx, id, status, result); err != nil {
+		log.Printf("Failed to record scan result for %s: %v\n", id, err)
+	}
+}
+
+// quarantine copies the object under QuarantinePrefix and removes the original
+func (s *Scanner) quarantine(ctx context.Context, doc models.Document) error {
+	dst := QuarantinePrefix + doc.ObjectKey
+	if err := s.objects.Copy(ctx, doc.Bucket, doc.ObjectKey, dst); err != nil {
+		return fmt.Errorf("copying to quarantine: %w", err)
+	}
+	if err := s.store.QuarantineDocument(ctx, doc.ID, dst); err != nil {
+		return err
+	}
+	return s.objects.Delete(ctx, doc.Bucket, doc.ObjectKey)
+}
@@ -0,0 +1,156 @@
+// Package scheduler runs periodic tasks, like syncing connectors or purging deleted documents,
+// on cron schedules kept in the database. Every gateway replica runs a Scheduler, a run is
+// claimed in the database first so it only happens on one of them.
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+	"github.com/dhruvkshah75/docstream/gateway/internal/storage"
+)
+
+const (
+	tickInterval = 30 * time.Second
+	dueBatch     = 20
+	// a run that takes longer is cancelled
+	runTimeout = time.Hour
+)
+
+// Task is something a schedule can run
+type Task interface {
+	// Check validates a schedule's params before it is saved
+	Check(params json.RawMessage) error
+	// Run does the work, the summary is kept on the schedule as its last result
+	Run(ctx context.Context, params json.RawMessage) (summary string, err error)
+}
+
+// Func is a task without params
+type Func func(ctx context.Context) (string, error)
+
+func (f Func) Check(params json.RawMessage) error {
+	var fields map[string]any
+	if err := json.Unmarshal(params, &fields); err != nil || len(fields) > 0 {
+		return errors.New("this task takes no params")
+	}
+	return nil
+}
+
+func (f Func) Run(ctx context.Context, _ json.RawMessage) (string, error) {
+	return f(ctx)
+}
+
+// Scheduler starts the runs of due schedules
+type Scheduler struct {
+	store storage.ScheduleStore
+	tasks map[string]Task
+	// schedule IDs running right now on this replica
+	running sync.Map
+}
+
+// New runs the tasks by name, schedules of other tasks fail when they come due
+func New(store storage.ScheduleStore, tasks map[string]Task) *Scheduler {
+	return &Scheduler{store: store, tasks: tasks}
+}
+
+// Task looks up a task by the name schedules use
+func (s *Scheduler) Task(name string) (Task, bool) {
+	task, ok := s.tasks[name]
+	return task, ok
+}
+
+// Tasks names every task there is, sorted
+func (s *Scheduler) Tasks() []string {
+	names := make([]string, 0, len(s.tasks))
+	for name := range s.tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Run starts due schedules, forever. Run it in its own goroutine.
+func (s *Scheduler) Run() {
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+
+	for {
+		s.tick()
+		<-ticker.C
+	}
+}
+
+func (s *Scheduler) tick() {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+	due, err := s.store.ListDueSchedules(ctx, now, dueBatch)
+	if err != nil {
+		log.Println("Schedule Listing Error:", err)
+		return
+	}
+
+	for _, sch := range due {
+		cron, err := ParseCron(sch.Cron)
+		if err != nil {
+			log.Printf("Schedule %s has a bad cron expression: %v\n", sch.ID, err)
+			continue
+		}
+		// runs missed while no gateway was up are made up for once, not once per missed slot
+		claimed, err := s.store.ClaimScheduleRun(ctx, sch.ID, now, cron.Next(now))
+		if err != nil {
+			log.Println("Schedule Claim Error:", err)
+			continue
+		}
+		if !claimed {
+			// another replica got it
+			continue
+		}
+		if _, busy := s.running.LoadOrStore(sch.ID, true); busy {
+			log.Printf("Schedule %s is still running from last time, skipping this run\n", sch.ID)
+			continue
+		}
+		go s.execute(sch)
+	}
+}
+
+// Start runs the schedule right away, off schedule, false if it is already running here
+func (s *Scheduler) Start(ctx context.Context, sch models.Schedule) (bool, error) {
+	if _, busy := s.running.LoadOrStore(sch.ID, true); busy {
+		return false, nil
+	}
+	if err := s.store.StartScheduleRun(ctx, sch.ID, time.Now().UTC().Truncate(time.Second)); err != nil {
+		s.running.Delete(sch.ID)
+		return false, err
+	}
+	go s.execute(sch)
+	return true, nil
+}
+
+func (s *Scheduler) execute(sch models.Schedule) {
+	defer s.running.Delete(sch.ID)
+
+	status, result := models.ScheduleStatusSucceeded, ""
+	task, ok := s.tasks[sch.Task]
+	if !ok {
+		status, result = models.ScheduleStatusFailed, "unknown task "+sch.Task
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), runTimeout)
+		summary, err := task.Run(ctx, sch.Params)
+		cancel()
+		result = summary
+		if err != nil {
+			status, result = models.ScheduleStatusFailed, err.Error()
+		}
+	}
+
+	log.Printf("Schedule %s (%s) %s: %s\n", sch.ID, sch.Task, status, result)
+	if err := s.store.FinishScheduleRun(context.Background(), sch.ID, status, result); err != nil {
+		log.Println("Schedule Update Error:", err)
+	}
+}
@@ -0,0 +1,163 @@
+// Package server runs the gateway's REST API, over plain HTTP for a reverse proxy in front or
+// over HTTPS itself. HTTPS brings HTTP/2 along, browsers and clients negotiate it during the
+// handshake.
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const (
+	// slow clients get this long for their headers, bodies aren't limited since uploads and
+	// event streams take as long as they take
+	readHeaderTimeout = 10 * time.Second
+	// how often a certificate from files is checked for a renewed one
+	reloadEvery = time.Minute
+)
+
+// ListenAndServe serves handler on port until that fails, with HTTPS when cfg has a certificate
+func ListenAndServe(handler http.Handler, port string, cfg config.TLS) error {
+	srv := &http.Server{Addr: ":" + port, Handler: handler, ReadHeaderTimeout: readHeaderTimeout}
+	if !cfg.Enabled() {
+		log.Println("API Gateway running on port: ", port)
+		return srv.ListenAndServe()
+	}
+
+	// the redirect port also answers Let's Encrypt's HTTP challenges
+	var challenges func(http.Handler) http.Handler
+	if len(cfg.AutocertDomains) > 0 {
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.AutocertDomains...),
+			Cache:      autocert.DirCache(cfg.AutocertCacheDir),
+			Email:      cfg.AutocertEmail,
+		}
+		if cfg.AutocertDirectoryURL != "" {
+			m.Client = &acme.Client{DirectoryURL: cfg.AutocertDirectoryURL}
+		}
+		srv.TLSConfig = m.TLSConfig()
+		challenges = m.HTTPHandler
+		log.Println("Requesting certificates from Let's Encrypt for", cfg.AutocertDomains)
+	} else {
+		pair, err := loadKeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return err
+		}
+		srv.TLSConfig = &tls.Config{GetCertificate: pair.get}
+	}
+	srv.TLSConfig.MinVersion = tls.VersionTLS12
+
+	if cfg.RedirectPort != "" {
+		redirect := http.Handler(redirectHandler(port))
+		if challenges != nil {
+			redirect = challenges(redirect)
+		}
+		go func() {
+			r := &http.Server{Addr: ":" + cfg.RedirectPort, Handler: redirect, ReadHeaderTimeout: readHeaderTimeout}
+			log.Fatalln("HTTP redirect:", r.ListenAndServe())
+		}()
+		log.Println("Redirecting HTTP on port", cfg.RedirectPort, "to HTTPS")
+	}
+
+	log.Println("API Gateway running with TLS on port: ", port)
+	// the certificates come from TLSConfig
+	return srv.ListenAndServeTLS("", "")
+}
+
+// redirectHandler sends plain HTTP requests to the same URL over HTTPS on port. GET and HEAD
+// get a 301, the rest a 308 so clients repeat them with the same method and body.
+func redirectHandler(port string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		code := http.StatusPermanentRedirect
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			code = http.StatusMovedPermanently
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), code)
+	}
+}
+
+// keyPair is a certificate from files, picked up again when they change so a renewal by
+// certbot or cert-manager doesn't need a restart
+type keyPair struct {
+	certFile, keyFile string
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	modified time.Time
+	checked  time.Time
+}
+
+// loadKeyPair fails on a bad certificate before anything listens
+func loadKeyPair(certFile, keyFile string) (*keyPair, error) {
+	p := &keyPair{certFile: certFile, keyFile: keyFile}
+	if err := p.reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *keyPair) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if time.Since(p.checked) >= reloadEvery {
+		if err := p.reload(); err != nil {
+			// a renewal caught halfway, keep serving the last good certificate
+			log.Printf("Keeping the current TLS certificate: %v\n", err)
+		}
+	}
+	return p.cert, nil
+}
+
+// reload reads the files again when either changed since the last time, callers hold mu
+// except for the first call
+func (p *keyPair) reload() error {
+	p.checked = time.Now()
+	modified, err := latestModTime(p.certFile, p.keyFile)
+	if err != nil {
+		return err
+	}
+	if p.cert != nil && !modified.After(p.modified) {
+		return nil
+	}
+	cert, err := tls.LoadX509KeyPair(p.certFile, p.keyFile)
+	if err != nil {
+		return fmt.Errorf("loading TLS certificate: %w", err)
+	}
+	if p.cert != nil {
+		log.Println("Reloaded TLS certificate from", p.certFile)
+	}
+	p.cert, p.modified = &cert, modified
+	return nil
+}
+
+func latestModTime(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return latest, fmt.Errorf("loading TLS certificate: %w", err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
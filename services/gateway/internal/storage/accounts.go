@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+)
+
+// accountDocuments are the documents that go with a deleted account: its personal ones and those
+// in organizations nobody is left in. Run after the account left its organizations, the rest
+// belongs to teams still using it.
+const accountDocuments = `(org_id IS NULL OR NOT EXISTS (SELECT 1 FROM org_members m WHERE m.org_id = documents.org_id))`
+
+// DeleteAccount does everything that has to happen at once, in one transaction: the row loses
+// what identifies the person, every session and key stops working, what the account set up is
+// removed and its documents go to the trash. Removing their content is left to the purge.
+func (s *sqlStore) DeleteAccount(ctx context.Context, userID int, auditPolicy string) (models.AccountDeletion, error) {
+	var result models.AccountDeletion
+	t, err := s.begin(ctx)
+	if err != nil {
+		return result, err
+	}
+	defer t.Rollback()
+
+	var email string
+	if err := t.queryRow(ctx, `SELECT email FROM users WHERE id = ? AND deleted_at IS NULL`, userID).Scan(&email); err != nil {
+		return result, notFound(err)
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+
+	// .invalid never resolves, and the address itself is free for a new signup
+	query := `UPDATE users SET email = ?, password = '', is_admin = ?, display_name = '', preferences = '', deleted_at = ? WHERE id = ?`
+	if _, err := t.exec(ctx, query, fmt.Sprintf("deleted-%d@deleted.invalid", userID), false, now, userID); err != nil {
+		return result, err
+	}
+
+	if result.Sessions, err = endSessions(ctx, t, now, userID, "", ""); err != nil {
+		return result, err
+	}
+	res, err := t.exec(ctx, `UPDATE api_keys SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`, now, userID)
+	if err != nil {
+		return result, err
+	}
+	keys, _ := res.RowsAffected()
+	result.APIKeys = int(keys)
+
+	lower := strings.ToLower(email)
+	cleanup := []struct {
+		query string
+		arg   any
+	}{
+		{`DELETE FROM webhooks WHERE user_id = ?`, userID},
+		{`DELETE FROM saved_searches WHERE user_id = ?`, userID},
+		{`DELETE FROM search_history WHERE user_id = ?`, userID},
+		{`DELETE FROM chats WHERE user_id = ?`, userID},
+		{`DELETE FROM inboxes WHERE user_id = ?`, userID},
+		// their OAuth tokens for Drive or Dropbox go with them
+		{`DELETE FROM connector_files WHERE connector_id IN (SELECT id FROM connectors WHERE user_id = ?)`, userID},
+		{`DELETE FROM connectors WHERE user_id = ?`, userID},
+		{`DELETE FROM org_members WHERE user_id = ?`, userID},
+		{`DELETE FROM org_invitations WHERE email = ? AND accepted_at IS NULL`, lower},
+		{`DELETE FROM login_throttle WHERE key = ?`, "email:" + lower},
+	}
+	for _, step := range cleanup {
+		if _, err := t.exec(ctx, step.query, step.arg); err != nil {
+			return result, err
+		}
+	}
+
+	query = `UPDATE documents SET deleted_at = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = ? AND deleted_at IS NULL AND legal_hold = ? AND ` + accountDocuments
+	res, err = t.exec(ctx, query, s.timeArg(now), userID, false)
+	if err != nil {
+		return result, err
+	}
+	docs, _ := res.RowsAffected()
+	result.Documents = int(docs)
+	query = `SELECT COUNT(*) FROM documents WHERE user_id = ? AND purged_at IS NULL AND legal_hold = ? AND ` + accountDocuments
+	if err := t.queryRow(ctx, query, userID, true).Scan(&result.OnHold); err != nil {
+		return result, err
+	}
+
+	// personal collections are only names now, documents on hold are taken out of them first
+	if _, err := t.exec(ctx, `UPDATE documents SET collection_id = NULL WHERE user_id = ? AND org_id IS NULL`, userID); err != nil {
+		return result, err
+	}
+	if _, err := t.exec(ctx, `DELETE FROM collections WHERE user_id = ? AND org_id IS NULL`, userID); err != nil {
+		return result, err
+	}
+
+	if err := anonymizeAudit(ctx, t, userID, email, auditPolicy); err != nil {
+		return result, err
+	}
+	return result, t.Commit()
+}
+
+// anonymizeAudit applies the deletion policy to the account's audit entries. Lockouts name the
+// address rather than the account, so entries mentioning it count as the account's too.
+func anonymizeAudit(ctx context.Context, t *tx, userID int, email, policy string) error {
+	// the address as it was signed up with, and lowercased the way lockout keys have it
+	lower := strings.ToLower(email)
+	mentions := `(detail LIKE ? OR detail LIKE ?)`
+	switch policy {
+	case config.DeletionAuditAnonymize:
+		query := `UPDATE audit_log SET user_id = NULL, ip = '' WHERE user_id = ?`
+		if _, err := t.exec(ctx, query, userID); err != nil {
+			return err
+		}
+		query = `UPDATE audit_log SET ip = '', detail = REPLACE(REPLACE(detail, ?, '[deleted]'), ?, '[deleted]') WHERE ` + mentions
+		_, err := t.exec(ctx, query, email, lower, "%"+email+"%", "%"+lower+"%")
+		return err
+	case config.DeletionAuditDelete:
+		_, err := t.exec(ctx, `DELETE FROM audit_log WHERE user_id = ? OR `+mentions, userID, "%"+email+"%", "%"+lower+"%")
+		return err
+	}
+	return nil
+}
+
+// ListDeletedAccounts skips accounts only waiting for legal holds to be lifted, so they can't
+// crowd the rest out of the batch
+func (s *sqlStore) ListDeletedAccounts(ctx context.Context, limit int) ([]models.User, error) {
+	left := `EXISTS (SELECT 1 FROM documents WHERE documents.user_id = users.id AND purged_at IS NULL AND legal_hold = ? AND ` + accountDocuments + `)`
+	query := `SELECT ` + userColumns + ` FROM users WHERE deleted_at IS NOT NULL AND purged_at IS NULL
+		AND (NOT ` + left + ` OR ` + left + `) ORDER BY deleted_at LIMIT ?`
+	rows, err := s.query(ctx, query, true, false, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (s *sqlStore) ListAccountDocuments(ctx context.Context, userID, limit int) ([]models.Document, error) {
+	query := `SELECT ` + documentColumns + ` FROM documents
+		WHERE user_id = ? AND purged_at IS NULL AND legal_hold = ? AND ` + accountDocuments + `
+		ORDER BY created_at, id LIMIT ?`
+	rows, err := s.query(ctx, query, userID, false, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	docs := []models.Document{}
+	for rows.Next() {
+		doc, err := scanDocument(rows)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, rows.Err()
+}
+
+// FinishAccountPurge also drops the file names the purged documents and uploads still had,
+// only IDs are left to show there was anything
+func (s *sqlStore) FinishAccountPurge(ctx context.Context, userID int) (bool, error) {
+	t, err := s.begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer t.Rollback()
+
+	query := `UPDATE users SET avatar_key = '', purged_at = CURRENT_TIMESTAMP WHERE id = ? AND deleted_at IS NOT NULL
+		AND NOT EXISTS (SELECT 1 FROM documents WHERE user_id = ? AND purged_at IS NULL AND ` + accountDocuments + `)`
+	res, err := t.exec(ctx, query, userID, userID)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	query = `UPDATE documents SET filename = '' WHERE user_id = ? AND purged_at IS NOT NULL AND ` + accountDocuments
+	if _, err := t.exec(ctx, query, userID); err != nil {
+		return false, err
+	}
+	if _, err := t.exec(ctx, `UPDATE upload_sessions SET filename = '' WHERE user_id = ? AND status <> ?`, userID, models.UploadStatusInProgress); err != nil {
+		return false, err
+	}
+	return true, t.Commit()
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+)
+
+func (s *sqlStore) SystemStats(ctx context.Context) (models.SystemStats, error) {
+	stats := models.SystemStats{JobsByStatus: map[string]int{}}
+	u := &stats.Users
+	query := `SELECT
+		COUNT(CASE WHEN deleted_at IS NULL THEN 1 END),
+		COUNT(CASE WHEN deleted_at IS NULL AND is_admin = ? THEN 1 END),
+		COUNT(CASE WHEN deleted_at IS NULL AND suspended_at IS NOT NULL THEN 1 END),
+		COUNT(CASE WHEN deleted_at IS NOT NULL THEN 1 END)
+		FROM users`
+	if err := s.queryRow(ctx, query, true).Scan(&u.Total, &u.Admins, &u.Suspended, &u.Deleted); err != nil {
+		return stats, err
+	}
+
+	query = `SELECT COUNT(CASE WHEN deleted_at IS NULL THEN 1 END), COUNT(CASE WHEN ` + trashed + ` THEN 1 END) FROM documents`
+	if err := s.queryRow(ctx, query).Scan(&stats.Documents.Total, &stats.Documents.Trashed); err != nil {
+		return stats, err
+	}
+	// older versions keep their objects, the current one is a version too
+	query = `SELECT COALESCE(SUM(v.size), 0) FROM document_versions v JOIN documents d ON d.id = v.document_id WHERE d.purged_at IS NULL`
+	if err := s.queryRow(ctx, query).Scan(&stats.StorageBytes); err != nil {
+		return stats, err
+	}
+
+	rows, err := s.query(ctx, `SELECT status, COUNT(*) FROM jobs GROUP BY status`)
+	if err != nil {
+		return stats, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return stats, err
+		}
+		stats.JobsByStatus[status] = n
+	}
+	return stats, rows.Err()
+}
+
+func (s *sqlStore) GetQuota(ctx context.Context, userID int) (models.Quota, error) {
+	var q models.Quota
+	query := `SELECT user_id, uploads, search, ask, updated_at FROM user_quotas WHERE user_id = ?`
+	err := s.queryRow(ctx, query, userID).Scan(&q.UserID, &q.Uploads, &q.Search, &q.Ask, &q.UpdatedAt)
+	return q, notFound(err)
+}
+
+func (s *sqlStore) SetQuota(ctx context.Context, q models.Quota) error {
+	query := `INSERT INTO user_quotas (user_id, uploads, search, ask, updated_at) VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT (user_id) DO UPDATE SET uploads = excluded.uploads, search = excluded.search, ask = excluded.ask, updated_at = excluded.updated_at`
+	_, err := s.exec(ctx, query, q.UserID, q.Uploads, q.Search, q.Ask)
+	return err
+}
+
+func (s *sqlStore) DeleteQuota(ctx context.Context, userID int) error {
+	res, err := s.exec(ctx, `DELETE FROM user_quotas WHERE user_id = ?`, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
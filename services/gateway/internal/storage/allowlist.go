@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+)
+
+const allowedModelColumns = `kind, name, description, input_price, output_price, max_input_tokens, max_output_tokens, created_at, updated_at`
+
+func scanAllowedModel(row rowScanner) (models.AllowedModel, error) {
+	var m models.AllowedModel
+	err := row.Scan(&m.Kind, &m.Name, &m.Description, &m.InputPrice, &m.OutputPrice, &m.MaxInputTokens, &m.MaxOutputTokens, &m.CreatedAt, &m.UpdatedAt)
+	return m, err
+}
+
+// ListAllowedModels returns the allowed models of a kind, or of every kind with "", by kind and name
+func (s *sqlStore) ListAllowedModels(ctx context.Context, kind string) ([]models.AllowedModel, error) {
+	query := `SELECT ` + allowedModelColumns + ` FROM allowed_models ORDER BY kind, name`
+	var args []any
+	if kind != "" {
+		query = `SELECT ` + allowedModelColumns + ` FROM allowed_models WHERE kind = ? ORDER BY name`
+		args = append(args, kind)
+	}
+	rows, err := s.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.AllowedModel{}
+	for rows.Next() {
+		m, err := scanAllowedModel(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, m)
+	}
+	return list, rows.Err()
+}
+
+func (s *sqlStore) GetAllowedModel(ctx context.Context, kind, name string) (models.AllowedModel, error) {
+	query := `SELECT ` + allowedModelColumns + ` FROM allowed_models WHERE kind = ? AND name = ?`
+	m, err := scanAllowedModel(s.queryRow(ctx, query, kind, name))
+	return m, notFound(err)
+}
+
+// PutAllowedModel adds a model to the allowlist or replaces its prices and limits
+func (s *sqlStore) PutAllowedModel(ctx context.Context, m models.AllowedModel) error {
+	query := `INSERT INTO allowed_models (kind, name, description, input_price, output_price, max_input_tokens, max_output_tokens) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (kind, name) DO UPDATE SET description = excluded.description, input_price = excluded.input_price, output_price = excluded.output_price,
+		max_input_tokens = excluded.max_input_tokens, max_output_tokens = excluded.max_output_tokens, updated_at = CURRENT_TIMESTAMP`
+	_, err := s.exec(ctx, query, m.Kind, m.Name, m.Description, m.InputPrice, m.OutputPrice, m.MaxInputTokens, m.MaxOutputTokens)
+	return err
+}
+
+func (s *sqlStore) DeleteAllowedModel(ctx context.Context, kind, name string) error {
+	res, err := s.exec(ctx, `DELETE FROM allowed_models WHERE kind = ? AND name = ?`, kind, name)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
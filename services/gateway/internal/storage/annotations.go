@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+)
+
+const annotationColumns = `a.id, a.document_id, a.user_id, u.email, a.kind, a.page, a.start_offset, a.end_offset, a.quote, a.body, a.created_at, a.updated_at`
+
+func scanAnnotation(row rowScanner, extra ...any) (models.Annotation, error) {
+	var a models.Annotation
+	dest := []any{&a.ID, &a.DocumentID, &a.UserID, &a.Email, &a.Kind, &a.Page, &a.Start, &a.End, &a.Quote, &a.Body, &a.CreatedAt, &a.UpdatedAt}
+	err := row.Scan(append(dest, extra...)...)
+	return a, err
+}
+
+func (s *sqlStore) CreateAnnotation(ctx context.Context, a models.Annotation) error {
+	query := `INSERT INTO annotations (id, document_id, user_id, kind, page, start_offset, end_offset, quote, body) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := s.exec(ctx, query, a.ID, a.DocumentID, a.UserID, a.Kind, a.Page, a.Start, a.End, a.Quote, a.Body)
+	return err
+}
+
+func (s *sqlStore) GetAnnotation(ctx context.Context, id string) (models.Annotation, error) {
+	query := `SELECT ` + annotationColumns + ` FROM annotations a JOIN users u ON u.id = a.user_id WHERE a.id = ?`
+	a, err := scanAnnotation(s.queryRow(ctx, query, id))
+	return a, notFound(err)
+}
+
+// ListAnnotations returns a document's annotations in the order of the text, only those of kind
+// unless it is empty
+func (s *sqlStore) ListAnnotations(ctx context.Context, documentID, kind string) ([]models.Annotation, error) {
+	query := `SELECT ` + annotationColumns + ` FROM annotations a JOIN users u ON u.id = a.user_id WHERE a.document_id = ?`
+	args := []any{documentID}
+	if kind != "" {
+		query += ` AND a.kind = ?`
+		args = append(args, kind)
+	}
+	query += ` ORDER BY a.start_offset, a.end_offset, a.created_at, a.id`
+
+	rows, err := s.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	annotations := []models.Annotation{}
+	for rows.Next() {
+		a, err := scanAnnotation(rows)
+		if err != nil {
+			return nil, err
+		}
+		annotations = append(annotations, a)
+	}
+	return annotations, rows.Err()
+}
+
+func (s *sqlStore) UpdateAnnotation(ctx context.Context, id, body string) error {
+	res, err := s.exec(ctx, `UPDATE annotations SET body = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, body, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) DeleteAnnotation(ctx context.Context, id string) error {
+	res, err := s.exec(ctx, `DELETE FROM annotations WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SearchAnnotations ranks annotations like SearchChunks ranks chunks, their body counting the
+// way a chunk's heading does
+func (s *sqlStore) SearchAnnotations(ctx context.Context, terms []string, filter ChunkFilter, limit int) ([]models.AnnotationMatch, error) {
+	if len(terms) == 0 {
+		return []models.AnnotationMatch{}, nil
+	}
+
+	var query string
+	if s.dialect == dialectPostgres {
+		query = `SELECT ` + annotationColumns + `, ts_rank(a.search, q, 1) AS score
+			FROM annotations a JOIN users u ON u.id = a.user_id JOIN documents d ON d.id = a.document_id, to_tsquery('simple', ?) q
+			WHERE a.search @@ q`
+	} else {
+		query = `SELECT ` + annotationColumns + `, bm25(matchinfo(annotations_fts, 'pcnalx')) AS score
+			FROM annotations_fts JOIN annotations a ON a.rowid = annotations_fts.docid JOIN users u ON u.id = a.user_id JOIN documents d ON d.id = a.document_id
+			WHERE annotations_fts MATCH ?`
+	}
+	args := []any{s.anyTerm(terms)}
+
+	scope, scopeArgs, ok := filter.where()
+	if !ok {
+		return []models.AnnotationMatch{}, nil
+	}
+	query += scope
+	args = append(args, scopeArgs...)
+
+	query += ` ORDER BY score DESC, a.document_id, a.start_offset, a.id LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := s.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	matches := []models.AnnotationMatch{}
+	for rows.Next() {
+		var m models.AnnotationMatch
+		if m.Annotation, err = scanAnnotation(rows, &m.Score); err != nil {
+			return nil, err
+		}
+		matches = append(matches, m)
+	}
+	return matches, rows.Err()
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+)
+
+const apiKeyColumns = `id, user_id, name, prefix, scopes, created_at, last_used_at, expires_at, revoked_at`
+
+// scanAPIKey scans extra after the apiKeyColumns
+func scanAPIKey(row rowScanner, extra ...any) (models.APIKey, error) {
+	var key models.APIKey
+	var scopes string
+	var lastUsed, expires, revoked sql.NullTime
+
+	dest := []any{&key.ID, &key.UserID, &key.Name, &key.Prefix, &scopes, &key.CreatedAt, &lastUsed, &expires, &revoked}
+	err := row.Scan(append(dest, extra...)...)
+	key.Scopes = strings.Split(scopes, ",")
+	if lastUsed.Valid {
+		key.LastUsedAt = &lastUsed.Time
+	}
+	if expires.Valid {
+		key.ExpiresAt = &expires.Time
+	}
+	if revoked.Valid {
+		key.RevokedAt = &revoked.Time
+	}
+	return key, err
+}
+
+func (s *sqlStore) CreateAPIKey(ctx context.Context, key models.APIKey, keyHash string) error {
+	var expires sql.NullTime
+	if key.ExpiresAt != nil {
+		expires = sql.NullTime{Time: key.ExpiresAt.UTC(), Valid: true}
+	}
+	query := `INSERT INTO api_keys (id, user_id, name, prefix, key_hash, scopes, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	_, err := s.exec(ctx, query, key.ID, key.UserID, key.Name, key.Prefix, keyHash, strings.Join(key.Scopes, ","), expires)
+	return err
+}
+
+// GetAPIKeyByHash returns revoked and expired keys too, the caller decides what to do with them
+func (s *sqlStore) GetAPIKeyByHash(ctx context.Context, keyHash string) (models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + `, EXISTS (SELECT 1 FROM users WHERE users.id = api_keys.user_id AND suspended_at IS NOT NULL)
+		FROM api_keys WHERE key_hash = ?`
+	var suspended bool
+	key, err := scanAPIKey(s.queryRow(ctx, query, keyHash), &suspended)
+	key.OwnerSuspended = suspended
+	return key, notFound(err)
+}
+
+func (s *sqlStore) ListAPIKeys(ctx context.Context, userID int) ([]models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE user_id = ? ORDER BY created_at`
+	rows, err := s.query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (s *sqlStore) RevokeAPIKey(ctx context.Context, id string, userID int) error {
+	query := `UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP WHERE id = ? AND user_id = ? AND revoked_at IS NULL`
+	res, err := s.exec(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) TouchAPIKey(ctx context.Context, id string) error {
+	_, err := s.exec(ctx, `UPDATE api_keys SET last_used_at = CURRENT_TIMESTAMP WHERE id = ?`, id)
+	return err
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+)
+
+func (s *sqlStore) CreateAuditEntry(ctx context.Context, entry models.AuditEntry) error {
+	query := `INSERT INTO audit_log (user_id, event, ip, detail, document_id, org_id)
+		VALUES (?, ?, ?, ?, ?, COALESCE(?, (SELECT org_id FROM documents WHERE id = ?)))`
+	_, err := s.exec(ctx, query, entry.UserID, entry.Event, entry.IP, entry.Detail, nullString(entry.DocumentID), nullString(entry.OrgID), entry.DocumentID)
+	return err
+}
+
+// ListActivity returns the entries about a document or an organization, whichever the filter
+// names, the newest first
+func (s *sqlStore) ListActivity(ctx context.Context, filter ActivityFilter) ([]models.Activity, error) {
+	query := `SELECT a.id, a.event, a.user_id, COALESCE(u.email, ''), COALESCE(a.document_id, ''), a.detail, a.created_at
+		FROM audit_log a LEFT JOIN users u ON u.id = a.user_id WHERE `
+	var args []any
+	if filter.DocumentID != "" {
+		query += `a.document_id = ?`
+		args = append(args, filter.DocumentID)
+	} else {
+		query += `a.org_id = ?`
+		args = append(args, filter.OrgID)
+	}
+	if filter.Before > 0 {
+		query += ` AND a.id < ?`
+		args = append(args, filter.Before)
+	}
+	query += ` ORDER BY a.id DESC LIMIT ?`
+	args = append(args, filter.Limit)
+
+	rows, err := s.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	activity := []models.Activity{}
+	for rows.Next() {
+		var a models.Activity
+		var userID sql.NullInt64
+		if err := rows.Scan(&a.ID, &a.Event, &userID, &a.Email, &a.DocumentID, &a.Detail, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		if userID.Valid {
+			id := int(userID.Int64)
+			a.UserID = &id
+		}
+		activity = append(activity, a)
+	}
+	return activity, rows.Err()
+}
+
+func (s *sqlStore) GetLoginThrottle(ctx context.Context, key string) (models.LoginThrottle, error) {
+	t := models.LoginThrottle{Key: key}
+	var lockedUntil sql.NullTime
+	query := `SELECT failures, last_failed_at, locked_until FROM login_throttle WHERE key = ?`
+	err := s.queryRow(ctx, query, key).Scan(&t.Failures, &t.LastFailedAt, &lockedUntil)
+	t.LockedUntil = lockedUntil.Time
+	return t, notFound(err)
+}
+
+func (s *sqlStore) SaveLoginThrottle(ctx context.Context, t models.LoginThrottle) error {
+	var lockedUntil sql.NullTime
+	if !t.LockedUntil.IsZero() {
+		lockedUntil = sql.NullTime{Time: t.LockedUntil.UTC(), Valid: true}
+	}
+	query := `INSERT INTO login_throttle (key, failures, last_failed_at, locked_until) VALUES (?, ?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET failures = excluded.failures, last_failed_at = excluded.last_failed_at, locked_until = excluded.locked_until`
+	_, err := s.exec(ctx, query, t.Key, t.Failures, t.LastFailedAt.UTC(), lockedUntil)
+	return err
+}
+
+func (s *sqlStore) ClearLoginThrottle(ctx context.Context, key string) error {
+	_, err := s.exec(ctx, `DELETE FROM login_throttle WHERE key = ?`, key)
+	return err
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+)
+
+func (s *sqlStore) CreateBatch(ctx context.Context, batch models.Batch) error {
+	_, err := s.exec(ctx, `INSERT INTO batches (id, user_id, org_id) VALUES (?, ?, ?)`, batch.ID, batch.UserID, nullString(batch.OrgID))
+	return err
+}
+
+func (s *sqlStore) AddBatchItem(ctx context.Context, batchID string, item models.BatchItem) error {
+	query := `INSERT INTO batch_items (batch_id, position, filename, document_id, job_id, duplicate, error) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	_, err := s.exec(ctx, query, batchID, item.Position, item.Filename, nullString(item.DocumentID), nullString(item.JobID), item.Duplicate, item.Error)
+	return err
+}
+
+// GetBatch only finds batches created by userID. Each item's Status is its job's current
+// status, or models.BatchItemRejected when the file never got one.
+func (s *sqlStore) GetBatch(ctx context.Context, id string, userID int) (models.Batch, error) {
+	var batch models.Batch
+	var orgID sql.NullString
+	query := `SELECT id, user_id, org_id, created_at FROM batches WHERE id = ? AND user_id = ?`
+	if err := s.queryRow(ctx, query, id, userID).Scan(&batch.ID, &batch.UserID, &orgID, &batch.CreatedAt); err != nil {
+		return batch, notFound(err)
+	}
+	batch.OrgID = orgID.String
+
+	query = `SELECT i.position, i.filename, i.document_id, i.job_id, i.duplicate, i.error, j.status
+		FROM batch_items i LEFT JOIN jobs j ON j.id = i.job_id WHERE i.batch_id = ? ORDER BY i.position`
+	rows, err := s.query(ctx, query, id)
+	if err != nil {
+		return batch, err
+	}
+	defer rows.Close()
+
+	batch.Items = []models.BatchItem{}
+	for rows.Next() {
+		var item models.BatchItem
+		var documentID, jobID, status sql.NullString
+		if err := rows.Scan(&item.Position, &item.Filename, &documentID, &jobID, &item.Duplicate, &item.Error, &status); err != nil {
+			return batch, err
+		}
+		item.DocumentID = documentID.String
+		item.JobID = jobID.String
+		item.Status = status.String
+		if !jobID.Valid {
+			item.Status = models.BatchItemRejected
+		}
+		batch.Items = append(batch.Items, item)
+	}
+	return batch, rows.Err()
+}
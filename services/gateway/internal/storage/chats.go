@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+)
+
+const chatColumns = `id, user_id, title, org_id, collection_id, document_id, mode, created_at, updated_at`
+
+// encodeList stores an empty list as ""
+func encodeList[T any](list []T) (string, error) {
+	if len(list) == 0 {
+		return "", nil
+	}
+	raw, err := json.Marshal(list)
+	return string(raw), err
+}
+
+func decodeList[T any](raw string, list *[]T) error {
+	if raw == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(raw), list)
+}
+
+func scanChat(row rowScanner) (models.Chat, error) {
+	var chat models.Chat
+	var orgID, collectionID, documentID sql.NullString
+	err := row.Scan(&chat.ID, &chat.UserID, &chat.Title, &orgID, &collectionID, &documentID, &chat.Mode, &chat.CreatedAt, &chat.UpdatedAt)
+	chat.OrgID = orgID.String
+	chat.CollectionID = collectionID.String
+	chat.DocumentID = documentID.String
+	return chat, err
+}
+
+func (s *sqlStore) CreateChat(ctx context.Context, chat models.Chat) error {
+	query := `INSERT INTO chats (id, user_id, title, org_id, collection_id, document_id, mode) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	_, err := s.exec(ctx, query, chat.ID, chat.UserID, chat.Title, nullString(chat.OrgID), nullString(chat.CollectionID), nullString(chat.DocumentID), chat.Mode)
+	return err
+}
+
+func (s *sqlStore) GetChat(ctx context.Context, id string, userID int) (models.Chat, error) {
+	chat, err := scanChat(s.queryRow(ctx, `SELECT `+chatColumns+` FROM chats WHERE id = ? AND user_id = ?`, id, userID))
+	return chat, notFound(err)
+}
+
+// ListChats returns userID's chats, the one talked to last first
+func (s *sqlStore) ListChats(ctx context.Context, userID int) ([]models.Chat, error) {
+	rows, err := s.query(ctx, `SELECT `+chatColumns+` FROM chats WHERE user_id = ? ORDER BY updated_at DESC, id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	chats := []models.Chat{}
+	for rows.Next() {
+		chat, err := scanChat(rows)
+		if err != nil {
+			return nil, err
+		}
+		chats = append(chats, chat)
+	}
+	return chats, rows.Err()
+}
+
+func (s *sqlStore) SetChatTitle(ctx context.Context, id, title string) error {
+	res, err := s.exec(ctx, `UPDATE chats SET title = ? WHERE id = ?`, title, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteChat takes its messages with it
+func (s *sqlStore) DeleteChat(ctx context.Context, id string, userID int) error {
+	res, err := s.exec(ctx, `DELETE FROM chats WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// AddChatMessages appends messages to a chat in their order, a question and its answer go in
+// together or not at all
+func (s *sqlStore) AddChatMessages(ctx context.Context, chatID string, messages []models.ChatMessage) error {
+	t, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer t.Rollback()
+
+	for _, m := range messages {
+		sources, err := encodeList(m.Sources)
+		if err != nil {
+			return err
+		}
+		citations, err := encodeList(m.Citations)
+		if err != nil {
+			return err
+		}
+		query := `INSERT INTO chat_messages (chat_id, role, content, query, sources, citations) VALUES (?, ?, ?, ?, ?, ?)`
+		if _, err := t.exec(ctx, query, chatID, m.Role, m.Content, m.Query, sources, citations); err != nil {
+			return err
+		}
+	}
+	res, err := t.exec(ctx, `UPDATE chats SET updated_at = CURRENT_TIMESTAMP WHERE id = ?`, chatID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return t.Commit()
+}
+
+// ListChatMessages returns the last limit messages of a chat, or all of them with 0, oldest first
+func (s *sqlStore) ListChatMessages(ctx context.Context, chatID string, limit int) ([]models.ChatMessage, error) {
+	query := `SELECT id, role, content, query, sources, citations, created_at FROM chat_messages WHERE chat_id = ? ORDER BY id`
+	args := []any{chatID}
+	if limit > 0 {
+		query = `SELECT * FROM (SELECT id, role, content, query, sources, citations, created_at FROM chat_messages
+			WHERE chat_id = ? ORDER BY id DESC LIMIT ?) last ORDER BY id`
+		args = append(args, limit)
+	}
+	rows, err := s.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []models.ChatMessage{}
+	for rows.Next() {
+		var m models.ChatMessage
+		var sources, citations string
+		if err := rows.Scan(&m.ID, &m.Role, &m.Content, &m.Query, &sources, &citations, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := decodeList(sources, &m.Sources); err != nil {
+			return nil, err
+		}
+		if err := decodeList(citations, &m.Citations); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
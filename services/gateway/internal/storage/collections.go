@@ -0,0 +1,210 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+)
+
+const collectionColumns = `id, user_id, org_id, parent_id, name, options, created_at, updated_at`
+
+func scanCollection(row rowScanner) (models.Collection, error) {
+	var col models.Collection
+	var orgID, parentID sql.NullString
+	var options string
+	err := row.Scan(&col.ID, &col.UserID, &orgID, &parentID, &col.Name, &options, &col.CreatedAt, &col.UpdatedAt)
+	if err != nil {
+		return col, err
+	}
+	if options != "" {
+		col.Options = &models.JobOptions{}
+		if err := json.Unmarshal([]byte(options), col.Options); err != nil {
+			return col, err
+		}
+	}
+	col.OrgID = orgID.String
+	col.ParentID = parentID.String
+	return col, nil
+}
+
+// encodeOptions stores no options as "", the same way jobs do
+func encodeOptions(options *models.JobOptions) (string, error) {
+	if options == nil || *options == (models.JobOptions{}) {
+		return "", nil
+	}
+	raw, err := json.Marshal(options)
+	return string(raw), err
+}
+
+func (s *sqlStore) CreateCollection(ctx context.Context, col models.Collection) error {
+	options, err := encodeOptions(col.Options)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO collections (id, user_id, org_id, parent_id, name, options) VALUES (?, ?, ?, ?, ?, ?)`
+	_, err = s.exec(ctx, query, col.ID, col.UserID, nullString(col.OrgID), nullString(col.ParentID), col.Name, options)
+	return err
+}
+
+// GetCollection finds collections userID created or can see through one of their organizations,
+// the same rule GetDocument uses
+func (s *sqlStore) GetCollection(ctx context.Context, id string, userID int) (models.Collection, error) {
+	query := `SELECT ` + collectionColumns + ` FROM collections WHERE id = ?
+		AND (user_id = ? OR org_id IN (SELECT org_id FROM org_members WHERE user_id = ?))`
+	col, err := scanCollection(s.queryRow(ctx, query, id, userID, userID))
+	return col, notFound(err)
+}
+
+func (s *sqlStore) GetCollectionByID(ctx context.Context, id string) (models.Collection, error) {
+	col, err := scanCollection(s.queryRow(ctx, `SELECT `+collectionColumns+` FROM collections WHERE id = ?`, id))
+	return col, notFound(err)
+}
+
+// ListCollections returns userID's personal collections, or the organization's with an orgID
+func (s *sqlStore) ListCollections(ctx context.Context, userID int, orgID string) ([]models.Collection, error) {
+	query := `SELECT ` + collectionColumns + ` FROM collections WHERE org_id IS NULL AND user_id = ? ORDER BY name, id`
+	args := []any{userID}
+	if orgID != "" {
+		query = `SELECT ` + collectionColumns + ` FROM collections WHERE org_id = ? ORDER BY name, id`
+		args = []any{orgID}
+	}
+	rows, err := s.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cols := []models.Collection{}
+	for rows.Next() {
+		col, err := scanCollection(rows)
+		if err != nil {
+			return nil, err
+		}
+		cols = append(cols, col)
+	}
+	return cols, rows.Err()
+}
+
+// UpdateCollection saves the name, parent and options of an existing collection
+func (s *sqlStore) UpdateCollection(ctx context.Context, col models.Collection) error {
+	options, err := encodeOptions(col.Options)
+	if err != nil {
+		return err
+	}
+	query := `UPDATE collections SET name = ?, parent_id = ?, options = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	res, err := s.exec(ctx, query, col.Name, nullString(col.ParentID), options, col.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteCollection refuses with ErrNotEmpty while live documents or other collections are
+// still in it. Deleted documents, unfinished uploads and connectors just lose the reference.
+func (s *sqlStore) DeleteCollection(ctx context.Context, id string) error {
+	t, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer t.Rollback()
+
+	var n int
+	query := `SELECT (SELECT COUNT(*) FROM collections WHERE parent_id = ?) + (SELECT COUNT(*) FROM documents WHERE collection_id = ? AND deleted_at IS NULL)`
+	if err := t.queryRow(ctx, query, id, id).Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return ErrNotEmpty
+	}
+
+	if _, err := t.exec(ctx, `UPDATE documents SET collection_id = NULL WHERE collection_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := t.exec(ctx, `UPDATE upload_sessions SET collection_id = NULL WHERE collection_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := t.exec(ctx, `UPDATE connectors SET collection_id = NULL WHERE collection_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := t.exec(ctx, `DELETE FROM shares WHERE collection_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := t.exec(ctx, `DELETE FROM share_links WHERE collection_id = ?`, id); err != nil {
+		return err
+	}
+	res, err := t.exec(ctx, `DELETE FROM collections WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return t.Commit()
+}
+
+// ListCollectionDocumentIDs walks down the collection's tree in the query, both databases have
+// recursive CTEs
+func (s *sqlStore) ListCollectionDocumentIDs(ctx context.Context, id string, limit int) ([]string, error) {
+	query := `WITH RECURSIVE tree (id) AS (
+			SELECT id FROM collections WHERE id = ?
+			UNION ALL SELECT c.id FROM collections c JOIN tree ON c.parent_id = tree.id
+		)
+		SELECT id FROM documents WHERE collection_id IN (SELECT id FROM tree) AND deleted_at IS NULL ORDER BY id LIMIT ?`
+	rows, err := s.query(ctx, query, id, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var docID string
+		if err := rows.Scan(&docID); err != nil {
+			return nil, err
+		}
+		ids = append(ids, docID)
+	}
+	return ids, rows.Err()
+}
+
+// ListCollectionDocuments returns up to limit live documents in a collection or any of its
+// sub-collections, by name
+func (s *sqlStore) ListCollectionDocuments(ctx context.Context, id string, limit int) ([]models.Document, error) {
+	query := `WITH RECURSIVE tree (id) AS (
+			SELECT id FROM collections WHERE id = ?
+			UNION ALL SELECT c.id FROM collections c JOIN tree ON c.parent_id = tree.id
+		)
+		SELECT ` + documentColumns + ` FROM documents WHERE collection_id IN (SELECT id FROM tree) AND deleted_at IS NULL ORDER BY filename, id LIMIT ?`
+	rows, err := s.query(ctx, query, id, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	docs := []models.Document{}
+	for rows.Next() {
+		doc, err := scanDocument(rows)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, rows.Err()
+}
+
+// InCollection reports whether a live document is filed in a collection or one of its sub-collections
+func (s *sqlStore) InCollection(ctx context.Context, documentID, collectionID string) (bool, error) {
+	query := `WITH RECURSIVE tree (id) AS (
+			SELECT id FROM collections WHERE id = ?
+			UNION ALL SELECT c.id FROM collections c JOIN tree ON c.parent_id = tree.id
+		)
+		SELECT EXISTS (SELECT 1 FROM documents WHERE id = ? AND deleted_at IS NULL AND collection_id IN (SELECT id FROM tree))`
+	var found bool
+	err := s.queryRow(ctx, query, collectionID, documentID).Scan(&found)
+	return found, err
+}
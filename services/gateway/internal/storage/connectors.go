@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+)
+
+const connectorColumns = `id, user_id, org_id, collection_id, provider, account, status, error, oauth_state,
+	access_token, refresh_token, token_expiry, folders, last_synced_at, created_at, updated_at`
+
+func scanConnector(row rowScanner) (models.Connector, error) {
+	var conn models.Connector
+	var orgID, collectionID, state sql.NullString
+	var expiry, lastSynced sql.NullTime
+	var folders string
+	err := row.Scan(&conn.ID, &conn.UserID, &orgID, &collectionID, &conn.Provider, &conn.Account, &conn.Status, &conn.Error, &state,
+		&conn.AccessToken, &conn.RefreshToken, &expiry, &folders, &lastSynced, &conn.CreatedAt, &conn.UpdatedAt)
+	if err != nil {
+		return conn, err
+	}
+	if err := json.Unmarshal([]byte(folders), &conn.Folders); err != nil {
+		return conn, err
+	}
+	conn.OrgID = orgID.String
+	conn.CollectionID = collectionID.String
+	conn.OAuthState = state.String
+	conn.TokenExpiry = expiry.Time
+	if lastSynced.Valid {
+		conn.LastSyncedAt = &lastSynced.Time
+	}
+	return conn, nil
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t.UTC(), Valid: !t.IsZero()}
+}
+
+func (s *sqlStore) CreateConnector(ctx context.Context, conn models.Connector) error {
+	query := `INSERT INTO connectors (id, user_id, org_id, collection_id, provider, status, oauth_state) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	_, err := s.exec(ctx, query, conn.ID, conn.UserID, nullString(conn.OrgID), nullString(conn.CollectionID), conn.Provider, conn.Status, nullString(conn.OAuthState))
+	return err
+}
+
+func (s *sqlStore) GetConnector(ctx context.Context, id string, userID int) (models.Connector, error) {
+	conn, err := scanConnector(s.queryRow(ctx, `SELECT `+connectorColumns+` FROM connectors WHERE id = ? AND user_id = ?`, id, userID))
+	return conn, notFound(err)
+}
+
+func (s *sqlStore) GetConnectorByState(ctx context.Context, state string) (models.Connector, error) {
+	conn, err := scanConnector(s.queryRow(ctx, `SELECT `+connectorColumns+` FROM connectors WHERE oauth_state = ?`, state))
+	return conn, notFound(err)
+}
+
+func (s *sqlStore) listConnectors(ctx context.Context, query string, args ...any) ([]models.Connector, error) {
+	rows, err := s.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	conns := []models.Connector{}
+	for rows.Next() {
+		conn, err := scanConnector(rows)
+		if err != nil {
+			return nil, err
+		}
+		conns = append(conns, conn)
+	}
+	return conns, rows.Err()
+}
+
+func (s *sqlStore) ListConnectors(ctx context.Context, userID int) ([]models.Connector, error) {
+	return s.listConnectors(ctx, `SELECT `+connectorColumns+` FROM connectors WHERE user_id = ? ORDER BY created_at, id`, userID)
+}
+
+// ListDueConnectors returns active connectors with folders to sync that haven't synced since syncedBefore
+func (s *sqlStore) ListDueConnectors(ctx context.Context, syncedBefore time.Time, limit int) ([]models.Connector, error) {
+	query := `SELECT ` + connectorColumns + ` FROM connectors
+		WHERE status = ? AND folders <> '[]' AND (last_synced_at IS NULL OR last_synced_at <= ?)
+		ORDER BY last_synced_at IS NOT NULL, last_synced_at LIMIT ?`
+	return s.listConnectors(ctx, query, models.ConnectorStatusActive, s.timeArg(syncedBefore), limit)
+}
+
+// UpdateConnector saves everything about a connector that can change after it's created
+func (s *sqlStore) UpdateConnector(ctx context.Context, conn models.Connector) error {
+	folders, err := json.Marshal(conn.Folders)
+	if err != nil {
+		return err
+	}
+	if conn.Folders == nil {
+		folders = []byte("[]")
+	}
+	query := `UPDATE connectors SET collection_id = ?, account = ?, status = ?, error = ?, oauth_state = ?,
+		access_token = ?, refresh_token = ?, token_expiry = ?, folders = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	res, err := s.exec(ctx, query, nullString(conn.CollectionID), conn.Account, conn.Status, conn.Error, nullString(conn.OAuthState),
+		conn.AccessToken, conn.RefreshToken, nullTime(conn.TokenExpiry), string(folders), conn.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ClaimConnectorSync marks the connector as syncing now, unless it already synced after
+// syncedBefore. Only one gateway replica wins the claim for a given round.
+func (s *sqlStore) ClaimConnectorSync(ctx context.Context, id string, syncedBefore time.Time) (bool, error) {
+	query := `UPDATE connectors SET last_synced_at = ? WHERE id = ? AND (last_synced_at IS NULL OR last_synced_at <= ?)`
+	res, err := s.exec(ctx, query, s.timeArg(time.Now().Truncate(time.Second)), id, s.timeArg(syncedBefore))
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n == 1, nil
+}
+
+// DeleteConnector forgets the account and its files, the documents it brought in stay
+func (s *sqlStore) DeleteConnector(ctx context.Context, id string, userID int) error {
+	res, err := s.exec(ctx, `DELETE FROM connectors WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) GetConnectorFile(ctx context.Context, connectorID, remoteID string) (models.ConnectorFile, error) {
+	f := models.ConnectorFile{ConnectorID: connectorID, RemoteID: remoteID}
+	var documentID sql.NullString
+	query := `SELECT revision, document_id, error FROM connector_files WHERE connector_id = ? AND remote_id = ?`
+	err := s.queryRow(ctx, query, connectorID, remoteID).Scan(&f.Revision, &documentID, &f.Error)
+	f.DocumentID = documentID.String
+	return f, notFound(err)
+}
+
+func (s *sqlStore) SaveConnectorFile(ctx context.Context, f models.ConnectorFile) error {
+	query := `INSERT INTO connector_files (connector_id, remote_id, revision, document_id, error) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (connector_id, remote_id) DO UPDATE SET revision = excluded.revision, document_id = excluded.document_id,
+		error = excluded.error, synced_at = CURRENT_TIMESTAMP`
+	_, err := s.exec(ctx, query, f.ConnectorID, f.RemoteID, f.Revision, nullString(f.DocumentID), f.Error)
+	return err
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+)
+
+func (s *sqlStore) AddDigestItem(ctx context.Context, item models.DigestItem) error {
+	query := `INSERT INTO notification_digests (user_id, job_id, document_id, status, error) VALUES (?, ?, ?, ?, ?)`
+	_, err := s.exec(ctx, query, item.UserID, item.JobID, item.DocumentID, item.Status, item.Error)
+	if err != nil && s.isUnique(err) {
+		// a redelivered result, the job is already waiting
+		return nil
+	}
+	return err
+}
+
+func (s *sqlStore) ListDigestUsers(ctx context.Context, afterID, limit int) ([]int, error) {
+	query := `SELECT DISTINCT user_id FROM notification_digests WHERE user_id > ? ORDER BY user_id LIMIT ?`
+	rows, err := s.query(ctx, query, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		users = append(users, id)
+	}
+	return users, rows.Err()
+}
+
+func (s *sqlStore) ListDigestItems(ctx context.Context, userID int) ([]models.DigestItem, error) {
+	query := `SELECT n.id, n.user_id, n.job_id, n.document_id, COALESCE(d.filename, ''), n.status, n.error, n.created_at
+		FROM notification_digests n LEFT JOIN documents d ON d.id = n.document_id
+		WHERE n.user_id = ? ORDER BY n.id`
+	rows, err := s.query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []models.DigestItem{}
+	for rows.Next() {
+		var item models.DigestItem
+		if err := rows.Scan(&item.ID, &item.UserID, &item.JobID, &item.DocumentID, &item.Filename, &item.Status, &item.Error, &item.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (s *sqlStore) DeleteDigestItems(ctx context.Context, userID, throughID int) error {
+	_, err := s.exec(ctx, `DELETE FROM notification_digests WHERE user_id = ? AND id <= ?`, userID, throughID)
+	return err
+}
@@ -0,0 +1,530 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+)
+
+const documentColumns = `id, user_id, bucket, object_key, filename, content_type, size, status, created_at, updated_at, deleted_at, org_id, sha256, scan_status, scan_result, scanned_at, metadata, collection_id, encryption_key, language, class, summary, key_points, version, legal_hold`
+
+func scanDocument(row rowScanner) (models.Document, error) {
+	var doc models.Document
+	var deletedAt, scannedAt sql.NullTime
+	var orgID, collectionID sql.NullString
+	var metadata, keyPoints string
+	err := row.Scan(&doc.ID, &doc.UserID, &doc.Bucket, &doc.ObjectKey, &doc.Filename, &doc.ContentType, &doc.Size, &doc.Status, &doc.CreatedAt, &doc.UpdatedAt, &deletedAt, &orgID, &doc.SHA256,
+		&doc.ScanStatus, &doc.ScanResult, &scannedAt, &metadata, &collectionID, &doc.EncryptionKey, &doc.Language, &doc.Class, &doc.Summary, &keyPoints, &doc.Version, &doc.LegalHold)
+	if err != nil {
+		return doc, err
+	}
+	if metadata != "" {
+		if err := json.Unmarshal([]byte(metadata), &doc.Metadata); err != nil {
+			return doc, err
+		}
+	}
+	if keyPoints != "" {
+		if err := json.Unmarshal([]byte(keyPoints), &doc.KeyPoints); err != nil {
+			return doc, err
+		}
+	}
+	doc.OrgID = orgID.String
+	doc.CollectionID = collectionID.String
+	if scannedAt.Valid {
+		doc.ScannedAt = &scannedAt.Time
+	}
+	if deletedAt.Valid {
+		doc.DeletedAt = &deletedAt.Time
+	}
+	return doc, nil
+}
+
+// encodeMetadata stores no metadata as "", like a job without options
+func encodeMetadata(metadata map[string]string) (string, error) {
+	if len(metadata) == 0 {
+		return "", nil
+	}
+	raw, err := json.Marshal(metadata)
+	return string(raw), err
+}
+
+func (s *sqlStore) CreateDocument(ctx context.Context, doc models.Document) error {
+	metadata, err := encodeMetadata(doc.Metadata)
+	if err != nil {
+		return err
+	}
+
+	t, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer t.Rollback()
+
+	query := `INSERT INTO documents (id, user_id, org_id, collection_id, bucket, object_key, filename, content_type, size, sha256, status, metadata, encryption_key)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = t.exec(ctx, query, doc.ID, doc.UserID, nullString(doc.OrgID), nullString(doc.CollectionID), doc.Bucket, doc.ObjectKey, doc.Filename, doc.ContentType, doc.Size, doc.SHA256, models.JobStatusPending, metadata, doc.EncryptionKey)
+	if err != nil {
+		return err
+	}
+	if err := t.setTags(ctx, doc.ID, doc.Tags); err != nil {
+		return err
+	}
+	// the upload is the document's first version
+	if err := t.insertVersion(ctx, versionOf(doc, 1)); err != nil {
+		return err
+	}
+	// and the first entry of its activity feed
+	var userID *int
+	if doc.UserID != 0 {
+		userID = &doc.UserID
+	}
+	query = `INSERT INTO audit_log (user_id, event, detail, document_id, org_id) VALUES (?, ?, '', ?, ?)`
+	if _, err := t.exec(ctx, query, userID, models.AuditDocumentUploaded, doc.ID, nullString(doc.OrgID)); err != nil {
+		return err
+	}
+	return t.Commit()
+}
+
+// UpdateDocumentMetadata replaces both the tags and the metadata
+func (s *sqlStore) UpdateDocumentMetadata(ctx context.Context, id string, tags []string, metadata map[string]string) error {
+	encoded, err := encodeMetadata(metadata)
+	if err != nil {
+		return err
+	}
+
+	t, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer t.Rollback()
+
+	res, err := t.exec(ctx, `UPDATE documents SET metadata = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND deleted_at IS NULL`, encoded, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	if _, err := t.exec(ctx, `DELETE FROM document_tags WHERE document_id = ?`, id); err != nil {
+		return err
+	}
+	if err := t.setTags(ctx, id, tags); err != nil {
+		return err
+	}
+	return t.Commit()
+}
+
+// MoveDocument files a live document in a collection, an empty collectionID takes it out of any
+func (s *sqlStore) MoveDocument(ctx context.Context, id, collectionID string) error {
+	query := `UPDATE documents SET collection_id = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND deleted_at IS NULL`
+	res, err := s.exec(ctx, query, nullString(collectionID), id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (t *tx) setTags(ctx context.Context, documentID string, tags []string) error {
+	for _, tag := range tags {
+		if _, err := t.exec(ctx, `INSERT INTO document_tags (document_id, tag) VALUES (?, ?)`, documentID, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadTags fills in the tags of docs with one query, they live in their own table
+func (s *sqlStore) loadTags(ctx context.Context, docs []models.Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	index := make(map[string]int, len(docs))
+	args := make([]any, len(docs))
+	for i, doc := range docs {
+		index[doc.ID] = i
+		args[i] = doc.ID
+	}
+
+	query := `SELECT document_id, tag FROM document_tags WHERE document_id IN (?` + strings.Repeat(", ?", len(docs)-1) + `) ORDER BY tag`
+	rows, err := s.query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var documentID, tag string
+		if err := rows.Scan(&documentID, &tag); err != nil {
+			return err
+		}
+		docs[index[documentID]].Tags = append(docs[index[documentID]].Tags, tag)
+	}
+	return rows.Err()
+}
+
+// FindDocumentByHash looks for a live document with the same content the user already
+// uploaded to the same place (their personal documents, or the same organization)
+func (s *sqlStore) FindDocumentByHash(ctx context.Context, userID int, orgID, sha256 string) (models.Document, error) {
+	query := `SELECT ` + documentColumns + ` FROM documents
+		WHERE user_id = ? AND sha256 = ? AND deleted_at IS NULL AND scan_status <> 'infected' AND org_id IS NULL
+		ORDER BY created_at LIMIT 1`
+	args := []any{userID, sha256}
+	if orgID != "" {
+		query = `SELECT ` + documentColumns + ` FROM documents
+			WHERE user_id = ? AND sha256 = ? AND deleted_at IS NULL AND scan_status <> 'infected' AND org_id = ?
+			ORDER BY created_at LIMIT 1`
+		args = append(args, orgID)
+	}
+	doc, err := scanDocument(s.queryRow(ctx, query, args...))
+	return doc, notFound(err)
+}
+
+// GetDocument finds documents uploaded by userID, or shared with an organization they're in
+func (s *sqlStore) GetDocument(ctx context.Context, id string, userID int) (models.Document, error) {
+	return s.getDocument(ctx, `deleted_at IS NULL`, id, userID)
+}
+
+func (s *sqlStore) GetDeletedDocument(ctx context.Context, id string, userID int) (models.Document, error) {
+	return s.getDocument(ctx, trashed, id, userID)
+}
+
+// trashed matches documents that are soft-deleted but still have their content
+const trashed = `deleted_at IS NOT NULL AND purged_at IS NULL`
+
+func (s *sqlStore) getDocument(ctx context.Context, state, id string, userID int) (models.Document, error) {
+	query := `SELECT ` + documentColumns + ` FROM documents WHERE id = ? AND ` + state + `
+		AND (user_id = ? OR org_id IN (SELECT org_id FROM org_members WHERE user_id = ?))`
+	doc, err := scanDocument(s.queryRow(ctx, query, id, userID, userID))
+	if err != nil {
+		return doc, notFound(err)
+	}
+	docs := []models.Document{doc}
+	err = s.loadTags(ctx, docs)
+	return docs[0], err
+}
+
+func (s *sqlStore) ListDocumentEntities(ctx context.Context, documentID string) ([]models.Entity, error) {
+	query := `SELECT type, value, count FROM document_entities WHERE document_id = ? ORDER BY type, count DESC, value`
+	rows, err := s.query(ctx, query, documentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entities := []models.Entity{}
+	for rows.Next() {
+		var e models.Entity
+		if err := rows.Scan(&e.Type, &e.Value, &e.Count); err != nil {
+			return nil, err
+		}
+		entities = append(entities, e)
+	}
+	return entities, rows.Err()
+}
+
+// ListDocuments sorts on the chosen column with the ID as a tie-breaker,
+// so the (value, id) pair of the last row is enough to fetch the next page
+func (s *sqlStore) ListDocuments(ctx context.Context, filter DocumentFilter) ([]models.Document, error) {
+	state := `deleted_at IS NULL`
+	if filter.Deleted {
+		state = trashed
+	}
+	query := `SELECT ` + documentColumns + ` FROM documents WHERE org_id IS NULL AND user_id = ? AND ` + state
+	args := []any{filter.UserID}
+	if filter.OrgID != "" {
+		query = `SELECT ` + documentColumns + ` FROM documents WHERE org_id = ? AND ` + state
+		args = []any{filter.OrgID}
+	} else if filter.Shared {
+		query = sharedTree + `SELECT ` + documentColumns + ` FROM documents WHERE ` + sharedWith + ` AND ` + state
+		args = []any{filter.UserID, filter.UserID}
+	}
+
+	if filter.Status != "" {
+		query += ` AND status = ?`
+		args = append(args, filter.Status)
+	}
+	if filter.CollectionID != "" {
+		query += ` AND collection_id = ?`
+		args = append(args, filter.CollectionID)
+	}
+	if filter.ContentType != "" {
+		query += ` AND content_type = ?`
+		args = append(args, filter.ContentType)
+	}
+	if filter.Language != "" {
+		query += ` AND language = ?`
+		args = append(args, filter.Language)
+	}
+	if filter.Class != "" {
+		query += ` AND class = ?`
+		args = append(args, filter.Class)
+	}
+	if !filter.CreatedAfter.IsZero() {
+		query += ` AND created_at >= ?`
+		args = append(args, s.timeArg(filter.CreatedAfter))
+	}
+	if !filter.CreatedBefore.IsZero() {
+		query += ` AND created_at < ?`
+		args = append(args, s.timeArg(filter.CreatedBefore))
+	}
+	for _, tag := range filter.Tags {
+		query += ` AND id IN (SELECT document_id FROM document_tags WHERE tag = ?)`
+		args = append(args, tag)
+	}
+	for _, key := range filter.Entities {
+		query += ` AND id IN (SELECT document_id FROM document_entities WHERE key = ?)`
+		args = append(args, key)
+	}
+
+	column := SortCreatedAt
+	switch filter.Sort {
+	case SortFilename, SortSize:
+		column = filter.Sort
+	}
+	cmp, dir := ">", "ASC"
+	if filter.Desc {
+		cmp, dir = "<", "DESC"
+	}
+
+	if filter.After != nil {
+		var last any
+		switch column {
+		case SortFilename:
+			last = filter.After.Filename
+		case SortSize:
+			last = filter.After.Size
+		default:
+			last = s.timeArg(filter.After.CreatedAt)
+		}
+		query += ` AND (` + column + ` ` + cmp + ` ? OR (` + column + ` = ? AND id ` + cmp + ` ?))`
+		args = append(args, last, last, filter.After.ID)
+	}
+
+	query += ` ORDER BY ` + column + ` ` + dir + `, id ` + dir + ` LIMIT ?`
+	args = append(args, filter.Limit)
+
+	rows, err := s.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	docs := []models.Document{}
+	for rows.Next() {
+		doc, err := scanDocument(rows)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	return docs, s.loadTags(ctx, docs)
+}
+
+func (s *sqlStore) SetDocumentScan(ctx context.Context, id, status, result string) error {
+	query := `UPDATE documents SET scan_status = ?, scan_result = ?, scanned_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	_, err := s.exec(ctx, query, status, result, id)
+	return err
+}
+
+func (s *sqlStore) QuarantineDocument(ctx context.Context, id, objectKey string) error {
+	t, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer t.Rollback()
+
+	query := `UPDATE documents SET object_key = ?, status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	if _, err := t.exec(ctx, query, objectKey, models.DocumentStatusQuarantined, id); err != nil {
+		return err
+	}
+	// the current version's object is the one that moved
+	query = `UPDATE document_versions SET object_key = ?
+		WHERE document_id = ? AND version = (SELECT version FROM documents WHERE id = ?)`
+	if _, err := t.exec(ctx, query, objectKey, id, id); err != nil {
+		return err
+	}
+	return t.Commit()
+}
+
+func (s *sqlStore) SoftDeleteDocument(ctx context.Context, id string, userID int) (models.Document, error) {
+	doc, err := s.GetDocument(ctx, id, userID)
+	if err != nil {
+		return doc, err
+	}
+	if doc.LegalHold {
+		return doc, ErrLegalHold
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	query := `UPDATE documents SET deleted_at = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND deleted_at IS NULL AND legal_hold = ?`
+	res, err := s.exec(ctx, query, s.timeArg(now), id, false)
+	if err != nil {
+		return doc, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// someone else deleted it or put it on hold in between
+		if doc, err := s.GetDocument(ctx, id, userID); err == nil && doc.LegalHold {
+			return doc, ErrLegalHold
+		}
+		return doc, ErrNotFound
+	}
+	doc.DeletedAt = &now
+	return doc, nil
+}
+
+// RestoreDocument only takes back documents deleted after deletedAfter, older ones are the reaper's
+func (s *sqlStore) RestoreDocument(ctx context.Context, id string, deletedAfter time.Time) error {
+	query := `UPDATE documents SET deleted_at = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND ` + trashed + ` AND deleted_at > ?`
+	res, err := s.exec(ctx, query, id, s.timeArg(deletedAfter))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) ListPurgeableDocuments(ctx context.Context, deletedBefore time.Time, limit int) ([]models.Document, error) {
+	query := `SELECT ` + documentColumns + ` FROM documents
+		WHERE deleted_at IS NOT NULL AND deleted_at <= ? AND purged_at IS NULL AND legal_hold = ?
+		ORDER BY deleted_at LIMIT ?`
+	rows, err := s.query(ctx, query, s.timeArg(deletedBefore), false, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	docs := []models.Document{}
+	for rows.Next() {
+		doc, err := scanDocument(rows)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, rows.Err()
+}
+
+// ListExpiredDocuments returns the organization's live documents uploaded at or before the cutoff
+// that aren't on hold, the oldest first
+func (s *sqlStore) ListExpiredDocuments(ctx context.Context, orgID string, createdBefore time.Time, limit int) ([]models.Document, error) {
+	query := `SELECT ` + documentColumns + ` FROM documents
+		WHERE org_id = ? AND deleted_at IS NULL AND created_at <= ? AND legal_hold = ?
+		ORDER BY created_at, id LIMIT ?`
+	rows, err := s.query(ctx, query, orgID, s.timeArg(createdBefore), false, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	docs := []models.Document{}
+	for rows.Next() {
+		doc, err := scanDocument(rows)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, rows.Err()
+}
+
+// SetLegalHold works on documents in the trash too, a hold stops their purge
+func (s *sqlStore) SetLegalHold(ctx context.Context, id string, hold bool) error {
+	query := `UPDATE documents SET legal_hold = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND purged_at IS NULL`
+	res, err := s.exec(ctx, query, hold, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListDocumentsToReembed matches the model in the jobs' options JSON, which is always written by
+// json.Marshal and so has no spaces. Infected and quarantined documents never get processed.
+func (s *sqlStore) ListDocumentsToReembed(ctx context.Context, model string, limit int) ([]models.Document, error) {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(model)
+	pattern := `%"embedding_model":"` + escaped + `"%`
+	query := `SELECT ` + documentColumns + ` FROM documents d
+		WHERE deleted_at IS NULL AND scan_status <> 'infected' AND status <> ?
+		AND NOT EXISTS (SELECT 1 FROM jobs j WHERE j.document_id = d.id AND (j.options LIKE ? ESCAPE '\' OR j.status NOT IN (?, ?, ?)))
+		ORDER BY created_at, id LIMIT ?`
+	rows, err := s.query(ctx, query, models.DocumentStatusQuarantined, pattern,
+		models.JobStatusCompleted, models.JobStatusFailed, models.JobStatusCancelled, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	docs := []models.Document{}
+	for rows.Next() {
+		doc, err := scanDocument(rows)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	// the tags go along in the job
+	return docs, s.loadTags(ctx, docs)
+}
+
+// MarkDocumentPurged leaves the row as a record of the deletion and drops what described the
+// content: its tags, entities, metadata, summary, versions, shares, annotations and the data key its objects were encrypted with
+func (s *sqlStore) MarkDocumentPurged(ctx context.Context, id string) error {
+	t, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer t.Rollback()
+
+	query := `UPDATE documents SET purged_at = CURRENT_TIMESTAMP, metadata = '', summary = '', key_points = '', encryption_key = '' WHERE id = ?`
+	if _, err := t.exec(ctx, query, id); err != nil {
+		return err
+	}
+	if _, err := t.exec(ctx, `DELETE FROM document_tags WHERE document_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := t.exec(ctx, `DELETE FROM document_entities WHERE document_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := t.exec(ctx, `DELETE FROM document_versions WHERE document_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := t.exec(ctx, `DELETE FROM shares WHERE document_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := t.exec(ctx, `DELETE FROM share_links WHERE document_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := t.exec(ctx, `DELETE FROM annotations WHERE document_id = ?`, id); err != nil {
+		return err
+	}
+	return t.Commit()
+}
+
+// timeArg formats a time the way the column stores it. SQLite keeps CURRENT_TIMESTAMP
+// as "YYYY-MM-DD HH:MM:SS" text and compares it as a string, so the driver's own
+// time format (with fractions and an offset) would sort wrong against it.
+func (s *sqlStore) timeArg(t time.Time) any {
+	if s.dialect == dialectSQLite {
+		return t.UTC().Format(time.DateTime)
+	}
+	return t.UTC()
+}
@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+)
+
+const embeddingMigrationColumns = `id, embedding_model, collection, from_model, from_collection, status, batch_size, total, migrated, failed, message, created_by, created_at, updated_at, switched_at`
+
+func scanEmbeddingMigration(row rowScanner) (models.EmbeddingMigration, error) {
+	var m models.EmbeddingMigration
+	var createdBy sql.NullInt64
+	var switched sql.NullTime
+	err := row.Scan(&m.ID, &m.EmbeddingModel, &m.Collection, &m.FromModel, &m.FromCollection, &m.Status, &m.BatchSize,
+		&m.Total, &m.Migrated, &m.Failed, &m.Message, &createdBy, &m.CreatedAt, &m.UpdatedAt, &switched)
+	if err != nil {
+		return m, err
+	}
+	m.CreatedBy = int(createdBy.Int64)
+	if switched.Valid {
+		m.SwitchedAt = &switched.Time
+	}
+	return m, nil
+}
+
+// CreateEmbeddingMigration returns ErrDuplicate while another migration is running, or when
+// the collection was used before
+func (s *sqlStore) CreateEmbeddingMigration(ctx context.Context, m models.EmbeddingMigration) error {
+	query := `INSERT INTO embedding_migrations (id, embedding_model, collection, from_model, from_collection, status, batch_size, created_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	var createdBy sql.NullInt64
+	if m.CreatedBy != 0 {
+		createdBy = sql.NullInt64{Int64: int64(m.CreatedBy), Valid: true}
+	}
+	_, err := s.exec(ctx, query, m.ID, m.EmbeddingModel, m.Collection, m.FromModel, m.FromCollection, m.Status, m.BatchSize, createdBy)
+	if err != nil && s.isUnique(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (s *sqlStore) GetEmbeddingMigration(ctx context.Context, id string) (models.EmbeddingMigration, error) {
+	m, err := scanEmbeddingMigration(s.queryRow(ctx, `SELECT `+embeddingMigrationColumns+` FROM embedding_migrations WHERE id = ?`, id))
+	return m, notFound(err)
+}
+
+func (s *sqlStore) ListEmbeddingMigrations(ctx context.Context) ([]models.EmbeddingMigration, error) {
+	rows, err := s.query(ctx, `SELECT `+embeddingMigrationColumns+` FROM embedding_migrations ORDER BY created_at DESC, id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.EmbeddingMigration{}
+	for rows.Next() {
+		m, err := scanEmbeddingMigration(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, m)
+	}
+	return list, rows.Err()
+}
+
+// CurrentEmbeddingMigration returns the migration that completed last, whose collection searches
+// go to. ErrNotFound means none ever did and the configured collection is still in use.
+func (s *sqlStore) CurrentEmbeddingMigration(ctx context.Context) (models.EmbeddingMigration, error) {
+	query := `SELECT ` + embeddingMigrationColumns + ` FROM embedding_migrations WHERE status = ? ORDER BY switched_at DESC, id DESC LIMIT 1`
+	m, err := scanEmbeddingMigration(s.queryRow(ctx, query, models.EmbeddingMigrationCompleted))
+	return m, notFound(err)
+}
+
+// RunningEmbeddingMigration returns ErrNotFound when no migration is running
+func (s *sqlStore) RunningEmbeddingMigration(ctx context.Context) (models.EmbeddingMigration, error) {
+	query := `SELECT ` + embeddingMigrationColumns + ` FROM embedding_migrations WHERE status = ?`
+	m, err := scanEmbeddingMigration(s.queryRow(ctx, query, models.EmbeddingMigrationRunning))
+	return m, notFound(err)
+}
+
+// liveToEmbed matches the documents d a migration has to re-embed, infected and quarantined ones
+// never get processed
+const liveToEmbed = `d.deleted_at IS NULL AND d.scan_status <> 'infected' AND d.status <> ?`
+
+// latestJob is the subquery for a column of d's latest job
+func latestJob(column string) string {
+	return `(SELECT l.` + column + ` FROM jobs l WHERE l.document_id = d.id ORDER BY l.created_at DESC, l.id DESC LIMIT 1)`
+}
+
+// EmbeddingProgress counts the live documents by their latest job. A document reprocessed after
+// it was migrated counts as not migrated until it is again.
+func (s *sqlStore) EmbeddingProgress(ctx context.Context, collection string) (models.EmbeddingProgress, error) {
+	query := `SELECT COUNT(*),
+		COALESCE(SUM(CASE WHEN job_collection = ? AND job_status = ? THEN 1 ELSE 0 END), 0),
+		COALESCE(SUM(CASE WHEN job_collection = ? AND job_status IN (?, ?) THEN 1 ELSE 0 END), 0),
+		COALESCE(SUM(CASE WHEN job_collection = ? AND job_status NOT IN (?, ?, ?) THEN 1 ELSE 0 END), 0)
+		FROM (SELECT ` + latestJob("collection") + ` AS job_collection, ` + latestJob("status") + ` AS job_status
+			FROM documents d WHERE ` + liveToEmbed + `) latest`
+	var p models.EmbeddingProgress
+	err := s.queryRow(ctx, query,
+		collection, models.JobStatusCompleted,
+		collection, models.JobStatusFailed, models.JobStatusCancelled,
+		collection, models.JobStatusCompleted, models.JobStatusFailed, models.JobStatusCancelled,
+		models.DocumentStatusQuarantined,
+	).Scan(&p.Total, &p.Migrated, &p.Failed, &p.Queued)
+	return p, err
+}
+
+// ListDocumentsToMigrate returns live documents whose latest job didn't index into collection,
+// oldest first. Documents with a job under way are left for later, one job per document at a time.
+func (s *sqlStore) ListDocumentsToMigrate(ctx context.Context, collection string, limit int) ([]models.Document, error) {
+	query := `SELECT ` + documentColumns + ` FROM documents d
+		WHERE ` + liveToEmbed + `
+		AND NOT EXISTS (SELECT 1 FROM jobs j WHERE j.document_id = d.id AND (j.status NOT IN (?, ?, ?) OR j.collection = ? AND j.id = ` + latestJob("id") + `))
+		ORDER BY created_at, id LIMIT ?`
+	rows, err := s.query(ctx, query, models.DocumentStatusQuarantined,
+		models.JobStatusCompleted, models.JobStatusFailed, models.JobStatusCancelled, collection, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	docs := []models.Document{}
+	for rows.Next() {
+		doc, err := scanDocument(rows)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	// the tags go along in the job
+	return docs, s.loadTags(ctx, docs)
+}
+
+// UpdateEmbeddingMigration keeps the progress of a running migration, ErrNotFound once it isn't
+func (s *sqlStore) UpdateEmbeddingMigration(ctx context.Context, id string, p models.EmbeddingProgress, message string) error {
+	query := `UPDATE embedding_migrations SET total = ?, migrated = ?, failed = ?, message = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND status = ?`
+	res, err := s.exec(ctx, query, p.Total, p.Migrated, p.Failed, message, id, models.EmbeddingMigrationRunning)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SwitchEmbeddingMigration completes a running migration, which makes its collection the one
+// searches and new jobs go to. ErrNotFound when it isn't running.
+func (s *sqlStore) SwitchEmbeddingMigration(ctx context.Context, id string, p models.EmbeddingProgress, message string) error {
+	query := `UPDATE embedding_migrations SET status = ?, total = ?, migrated = ?, failed = ?, message = ?, switched_at = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND status = ?`
+	res, err := s.exec(ctx, query, models.EmbeddingMigrationCompleted, p.Total, p.Migrated, p.Failed, message, s.timeArg(time.Now()),
+		id, models.EmbeddingMigrationRunning)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// CancelEmbeddingMigration stops a running migration, ErrNotFound when it isn't running
+func (s *sqlStore) CancelEmbeddingMigration(ctx context.Context, id string) error {
+	query := `UPDATE embedding_migrations SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND status = ?`
+	res, err := s.exec(ctx, query, models.EmbeddingMigrationCancelled, id, models.EmbeddingMigrationRunning)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
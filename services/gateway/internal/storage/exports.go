@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+)
+
+const exportColumns = `id, user_id, status, object_key, size, error, created_at, started_at, finished_at, expires_at`
+
+func scanExport(row rowScanner) (models.Export, error) {
+	var exp models.Export
+	var started, finished, expires sql.NullTime
+	err := row.Scan(&exp.ID, &exp.UserID, &exp.Status, &exp.ObjectKey, &exp.Size, &exp.Error, &exp.CreatedAt, &started, &finished, &expires)
+	if err != nil {
+		return exp, err
+	}
+	if started.Valid {
+		exp.StartedAt = &started.Time
+	}
+	if finished.Valid {
+		exp.FinishedAt = &finished.Time
+	}
+	if expires.Valid {
+		exp.ExpiresAt = &expires.Time
+	}
+	return exp, nil
+}
+
+func (s *sqlStore) CreateExport(ctx context.Context, exp models.Export) error {
+	_, err := s.exec(ctx, `INSERT INTO exports (id, user_id, status) VALUES (?, ?, ?)`, exp.ID, exp.UserID, exp.Status)
+	return err
+}
+
+func (s *sqlStore) GetExport(ctx context.Context, id string, userID int) (models.Export, error) {
+	exp, err := scanExport(s.queryRow(ctx, `SELECT `+exportColumns+` FROM exports WHERE id = ? AND user_id = ?`, id, userID))
+	return exp, notFound(err)
+}
+
+func (s *sqlStore) listExports(ctx context.Context, query string, args ...any) ([]models.Export, error) {
+	rows, err := s.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exports := []models.Export{}
+	for rows.Next() {
+		exp, err := scanExport(rows)
+		if err != nil {
+			return nil, err
+		}
+		exports = append(exports, exp)
+	}
+	return exports, rows.Err()
+}
+
+func (s *sqlStore) ListExports(ctx context.Context, userID int) ([]models.Export, error) {
+	return s.listExports(ctx, `SELECT `+exportColumns+` FROM exports WHERE user_id = ? ORDER BY created_at DESC, id DESC`, userID)
+}
+
+// stalled matches exports waiting to be built, and builds that started before the cutoff
+// without finishing, their gateway went away
+const stalled = `(status = ? OR status = ? AND started_at <= ?)`
+
+func (s *sqlStore) ListPendingExports(ctx context.Context, staleBefore time.Time, limit int) ([]models.Export, error) {
+	query := `SELECT ` + exportColumns + ` FROM exports WHERE ` + stalled + ` ORDER BY created_at LIMIT ?`
+	return s.listExports(ctx, query, models.ExportStatusPending, models.ExportStatusRunning, s.timeArg(staleBefore), limit)
+}
+
+// ClaimExport marks an export running, only the caller that moves it gets true
+func (s *sqlStore) ClaimExport(ctx context.Context, id string, staleBefore time.Time) (bool, error) {
+	query := `UPDATE exports SET status = ?, started_at = ?, error = '' WHERE id = ? AND ` + stalled
+	res, err := s.exec(ctx, query, models.ExportStatusRunning, s.timeArg(time.Now()), id,
+		models.ExportStatusPending, models.ExportStatusRunning, s.timeArg(staleBefore))
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n == 1, nil
+}
+
+// FinishExport saves how a build ended, or that a completed export expired
+func (s *sqlStore) FinishExport(ctx context.Context, exp models.Export) error {
+	var finished, expires any
+	if exp.FinishedAt != nil {
+		finished = s.timeArg(*exp.FinishedAt)
+	}
+	if exp.ExpiresAt != nil {
+		expires = s.timeArg(*exp.ExpiresAt)
+	}
+	query := `UPDATE exports SET status = ?, object_key = ?, size = ?, error = ?, finished_at = ?, expires_at = ? WHERE id = ?`
+	res, err := s.exec(ctx, query, exp.Status, exp.ObjectKey, exp.Size, exp.Error, finished, expires, exp.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) ListExpiredExports(ctx context.Context, now time.Time, limit int) ([]models.Export, error) {
+	query := `SELECT ` + exportColumns + ` FROM exports WHERE status = ? AND expires_at <= ? ORDER BY expires_at LIMIT ?`
+	return s.listExports(ctx, query, models.ExportStatusCompleted, s.timeArg(now), limit)
+}
+
+func (s *sqlStore) DeleteExports(ctx context.Context, userID int) error {
+	_, err := s.exec(ctx, `DELETE FROM exports WHERE user_id = ?`, userID)
+	return err
+}
+
+// ListUploadedDocuments pages by ID through the live documents userID uploaded, whether
+// personal or shared with an organization, with their tags
+func (s *sqlStore) ListUploadedDocuments(ctx context.Context, userID int, afterID string, limit int) ([]models.Document, error) {
+	query := `SELECT ` + documentColumns + ` FROM documents WHERE user_id = ? AND deleted_at IS NULL AND id > ? ORDER BY id LIMIT ?`
+	rows, err := s.query(ctx, query, userID, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	docs := []models.Document{}
+	for rows.Next() {
+		doc, err := scanDocument(rows)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	return docs, s.loadTags(ctx, docs)
+}
@@ -0,0 +1,29 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+)
+
+func scanInbox(row rowScanner) (models.Inbox, error) {
+	var inbox models.Inbox
+	err := row.Scan(&inbox.UserID, &inbox.Token, &inbox.CreatedAt)
+	return inbox, notFound(err)
+}
+
+func (s *sqlStore) GetInbox(ctx context.Context, userID int) (models.Inbox, error) {
+	return scanInbox(s.queryRow(ctx, `SELECT user_id, token, created_at FROM inboxes WHERE user_id = ?`, userID))
+}
+
+func (s *sqlStore) GetInboxByToken(ctx context.Context, token string) (models.Inbox, error) {
+	return scanInbox(s.queryRow(ctx, `SELECT user_id, token, created_at FROM inboxes WHERE token = ?`, token))
+}
+
+// SetInboxToken gives the user an inbox, or a new address for the one they have
+func (s *sqlStore) SetInboxToken(ctx context.Context, userID int, token string) error {
+	query := `INSERT INTO inboxes (user_id, token) VALUES (?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET token = excluded.token, created_at = CURRENT_TIMESTAMP`
+	_, err := s.exec(ctx, query, userID, token)
+	return err
+}
@@ -0,0 +1,226 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+)
+
+const jobColumns = `id, user_id, document_id, filename, bucket, sha256, status, error, options, collection, created_at, updated_at`
+
+func scanJob(row rowScanner) (models.Job, error) {
+	var job models.Job
+	var userID sql.NullInt64
+	var documentID sql.NullString
+	var options string
+
+	err := row.Scan(&job.ID, &userID, &documentID, &job.Filename, &job.Bucket, &job.SHA256, &job.Status, &job.Error, &options, &job.Collection, &job.CreatedAt, &job.UpdatedAt)
+	if err != nil {
+		return job, err
+	}
+	if options != "" {
+		job.Options = &models.JobOptions{}
+		if err := json.Unmarshal([]byte(options), job.Options); err != nil {
+			return job, err
+		}
+	}
+	if userID.Valid {
+		id := int(userID.Int64)
+		job.UserID = &id
+	}
+	job.DocumentID = documentID.String
+	return job, nil
+}
+
+func (s *sqlStore) CreateJob(ctx context.Context, job models.Job) error {
+	options := ""
+	if job.Options != nil {
+		raw, err := json.Marshal(job.Options)
+		if err != nil {
+			return err
+		}
+		options = string(raw)
+	}
+
+	query := `INSERT INTO jobs (id, user_id, document_id, filename, bucket, sha256, status, options, collection) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := s.exec(ctx, query, job.ID, job.UserID, nullString(job.DocumentID), job.Filename, job.Bucket, job.SHA256, job.Status, options, job.Collection)
+	return err
+}
+
+// GetJob only finds jobs owned by userID so IDs can't be probed
+func (s *sqlStore) GetJob(ctx context.Context, id string, userID int) (models.Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE id = ? AND user_id = ?`
+	job, err := scanJob(s.queryRow(ctx, query, id, userID))
+	return job, notFound(err)
+}
+
+func (s *sqlStore) GetJobByID(ctx context.Context, id string) (models.Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE id = ?`
+	job, err := scanJob(s.queryRow(ctx, query, id))
+	return job, notFound(err)
+}
+
+// GetLatestJobForDocument returns the most recent job that processed the document
+func (s *sqlStore) GetLatestJobForDocument(ctx context.Context, documentID string) (models.Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE document_id = ? ORDER BY created_at DESC LIMIT 1`
+	job, err := scanJob(s.queryRow(ctx, query, documentID))
+	return job, notFound(err)
+}
+
+func (s *sqlStore) HasCompletedJob(ctx context.Context, documentID, collection string) (bool, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM jobs WHERE document_id = ? AND collection = ? AND status = ?`
+	err := s.queryRow(ctx, query, documentID, collection, models.JobStatusCompleted).Scan(&count)
+	return count > 0, err
+}
+
+// ListJobs returns the newest jobs first
+func (s *sqlStore) ListJobs(ctx context.Context, filter JobFilter) ([]models.Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE user_id = ?`
+	args := []any{filter.UserID}
+	if filter.Status != "" {
+		query += ` AND status = ?`
+		args = append(args, filter.Status)
+	}
+	query += ` ORDER BY created_at DESC LIMIT ? OFFSET ?`
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := s.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []models.Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+func (s *sqlStore) UpdateJobStatus(ctx context.Context, id, status, errMsg string) (bool, error) {
+	query := `UPDATE jobs SET status = ?, error = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND status NOT IN (?, ?, ?)`
+	res, err := s.exec(ctx, query, status, errMsg, id, models.JobStatusCompleted, models.JobStatusFailed, models.JobStatusCancelled)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// unknown job or already final, nothing to mirror onto the document
+		return false, nil
+	}
+
+	// the document shows the status of the job processing it
+	query = `UPDATE documents SET status = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = (SELECT document_id FROM jobs WHERE id = ?)`
+	_, err = s.exec(ctx, query, status, id)
+	return true, err
+}
+
+func (s *sqlStore) SetDocumentLanguage(ctx context.Context, jobID, language string) error {
+	query := `UPDATE documents SET language = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = (SELECT document_id FROM jobs WHERE id = ?)`
+	_, err := s.exec(ctx, query, language, jobID)
+	return err
+}
+
+func (s *sqlStore) SetDocumentClass(ctx context.Context, jobID, class string) error {
+	query := `UPDATE documents SET class = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = (SELECT document_id FROM jobs WHERE id = ?)`
+	_, err := s.exec(ctx, query, class, jobID)
+	return err
+}
+
+func (s *sqlStore) SetDocumentEntities(ctx context.Context, jobID string, entities []models.Entity) error {
+	t, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer t.Rollback()
+
+	var documentID string
+	if err := t.queryRow(ctx, `SELECT document_id FROM jobs WHERE id = ?`, jobID).Scan(&documentID); err != nil {
+		return notFound(err)
+	}
+	if _, err := t.exec(ctx, `DELETE FROM document_entities WHERE document_id = ?`, documentID); err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	for _, e := range entities {
+		key := models.EntityKey(e.Type, e.Value)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		query := `INSERT INTO document_entities (document_id, type, value, key, count) VALUES (?, ?, ?, ?, ?)`
+		if _, err := t.exec(ctx, query, documentID, e.Type, e.Value, key, e.Count); err != nil {
+			return err
+		}
+	}
+	return t.Commit()
+}
+
+func (s *sqlStore) SetDocumentSummary(ctx context.Context, jobID, summary string, keyPoints []string) error {
+	encoded := ""
+	if len(keyPoints) > 0 {
+		raw, err := json.Marshal(keyPoints)
+		if err != nil {
+			return err
+		}
+		encoded = string(raw)
+	}
+	query := `UPDATE documents SET summary = ?, key_points = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = (SELECT document_id FROM jobs WHERE id = ?)`
+	_, err := s.exec(ctx, query, summary, encoded, jobID)
+	return err
+}
+
+func (s *sqlStore) RecordJobStage(ctx context.Context, jobID, stage, status, errMsg string) error {
+	query := `INSERT INTO job_stages (job_id, stage, position, status, error)
+		SELECT id, ?, (SELECT COUNT(*) FROM job_stages WHERE job_id = jobs.id), ?, ? FROM jobs WHERE id = ?
+		ON CONFLICT (job_id, stage) DO UPDATE SET status = excluded.status, error = excluded.error,
+			runs = job_stages.runs + 1, updated_at = CURRENT_TIMESTAMP`
+	_, err := s.exec(ctx, query, stage, status, errMsg, jobID)
+	return err
+}
+
+func (s *sqlStore) ListJobStages(ctx context.Context, jobID string) ([]models.JobStage, error) {
+	query := `SELECT stage, status, error, runs, updated_at FROM job_stages WHERE job_id = ? ORDER BY position`
+	rows, err := s.query(ctx, query, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stages := []models.JobStage{}
+	for rows.Next() {
+		var st models.JobStage
+		if err := rows.Scan(&st.Stage, &st.Status, &st.Error, &st.Runs, &st.UpdatedAt); err != nil {
+			return nil, err
+		}
+		stages = append(stages, st)
+	}
+	return stages, rows.Err()
+}
+
+func (s *sqlStore) RequeueJob(ctx context.Context, id string) error {
+	query := `UPDATE jobs SET status = ?, error = '', updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	res, err := s.exec(ctx, query, models.JobStatusQueued, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+
+	query = `UPDATE documents SET status = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = (SELECT document_id FROM jobs WHERE id = ?)`
+	_, err = s.exec(ctx, query, models.JobStatusQueued, id)
+	return err
+}
@@ -0,0 +1,222 @@
+package storage
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"strings"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+)
+
+func (s *sqlStore) IndexChunks(ctx context.Context, documentID, jobID string, chunks []models.Chunk) error {
+	t, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer t.Rollback()
+
+	// an update keeps the row's id, so SQLite's full-text index is rewritten rather than added to
+	query := `INSERT INTO keyword_chunks (document_id, job_id, chunk_index, page, start_offset, end_offset, heading, text) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (document_id, chunk_index) DO UPDATE SET job_id = excluded.job_id, page = excluded.page,
+		start_offset = excluded.start_offset, end_offset = excluded.end_offset, heading = excluded.heading, text = excluded.text`
+	for _, c := range chunks {
+		if _, err := t.exec(ctx, query, documentID, jobID, c.Index, c.Page, c.Start, c.End, c.Heading, c.Text); err != nil {
+			return err
+		}
+	}
+	return t.Commit()
+}
+
+func (s *sqlStore) DeleteStaleChunks(ctx context.Context, documentID, jobID string, chunks int) error {
+	query := `DELETE FROM keyword_chunks WHERE document_id = ? AND (job_id <> ? OR chunk_index >= ?)`
+	_, err := s.exec(ctx, query, documentID, jobID, chunks)
+	return err
+}
+
+func (s *sqlStore) DeleteJobChunks(ctx context.Context, documentID, jobID string) error {
+	_, err := s.exec(ctx, `DELETE FROM keyword_chunks WHERE document_id = ? AND job_id = ?`, documentID, jobID)
+	return err
+}
+
+func (s *sqlStore) DeleteDocumentChunks(ctx context.Context, documentID string) error {
+	_, err := s.exec(ctx, `DELETE FROM keyword_chunks WHERE document_id = ?`, documentID)
+	return err
+}
+
+// GetChunk returns chunk index of a document
+func (s *sqlStore) GetChunk(ctx context.Context, documentID string, index int) (models.Chunk, error) {
+	var c models.Chunk
+	query := `SELECT chunk_index, page, start_offset, end_offset, heading, text FROM keyword_chunks WHERE document_id = ? AND chunk_index = ?`
+	err := s.queryRow(ctx, query, documentID, index).Scan(&c.Index, &c.Page, &c.Start, &c.End, &c.Heading, &c.Text)
+	return c, notFound(err)
+}
+
+// ListChunks returns every chunk of a document by index
+func (s *sqlStore) ListChunks(ctx context.Context, documentID string) ([]models.Chunk, error) {
+	query := `SELECT chunk_index, page, start_offset, end_offset, heading, text FROM keyword_chunks WHERE document_id = ? ORDER BY chunk_index`
+	rows, err := s.query(ctx, query, documentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	chunks := []models.Chunk{}
+	for rows.Next() {
+		var c models.Chunk
+		if err := rows.Scan(&c.Index, &c.Page, &c.Start, &c.End, &c.Heading, &c.Text); err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, c)
+	}
+	return chunks, rows.Err()
+}
+
+// SearchChunks matches any of the terms. SQLite ranks with bm25 over matchinfo, Postgres with
+// ts_rank normalized by the chunk's length, which is close enough to put the same chunks on top.
+func (s *sqlStore) SearchChunks(ctx context.Context, terms []string, filter ChunkFilter, limit int) ([]models.ChunkMatch, error) {
+	if len(terms) == 0 {
+		return []models.ChunkMatch{}, nil
+	}
+
+	var query string
+	if s.dialect == dialectPostgres {
+		query = `SELECT k.document_id, k.chunk_index, k.page, k.start_offset, k.end_offset, k.heading, k.text, ts_rank(k.search, q, 1) AS score
+			FROM keyword_chunks k JOIN documents d ON d.id = k.document_id, to_tsquery('simple', ?) q
+			WHERE k.search @@ q`
+	} else {
+		query = `SELECT k.document_id, k.chunk_index, k.page, k.start_offset, k.end_offset, k.heading, k.text, bm25(matchinfo(keyword_chunks_fts, 'pcnalx')) AS score
+			FROM keyword_chunks_fts JOIN keyword_chunks k ON k.id = keyword_chunks_fts.docid JOIN documents d ON d.id = k.document_id
+			WHERE keyword_chunks_fts MATCH ?`
+	}
+	args := []any{s.anyTerm(terms)}
+
+	scope, scopeArgs, ok := filter.where()
+	if !ok {
+		return []models.ChunkMatch{}, nil
+	}
+	query += scope
+	args = append(args, scopeArgs...)
+
+	query += ` ORDER BY score DESC, k.document_id, k.chunk_index LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := s.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	matches := []models.ChunkMatch{}
+	for rows.Next() {
+		var m models.ChunkMatch
+		if err := rows.Scan(&m.DocumentID, &m.Chunk.Index, &m.Chunk.Page, &m.Chunk.Start, &m.Chunk.End, &m.Chunk.Heading, &m.Chunk.Text, &m.Score); err != nil {
+			return nil, err
+		}
+		matches = append(matches, m)
+	}
+	return matches, rows.Err()
+}
+
+// anyTerm is the full-text query matching any of terms, for to_tsquery or an FTS MATCH
+func (s *sqlStore) anyTerm(terms []string) string {
+	if s.dialect == dialectPostgres {
+		// terms are letters and digits only, nothing in them means anything to to_tsquery
+		return strings.Join(terms, " | ")
+	}
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + term + `"`
+	}
+	return strings.Join(quoted, " OR ")
+}
+
+// where is the condition on the documents, as d, that a search with the filter goes through,
+// false when there are none
+func (filter ChunkFilter) where() (string, []any, bool) {
+	var args []any
+	query := ` AND d.deleted_at IS NULL`
+	var owners []string
+	if filter.UserID != 0 {
+		owners = append(owners, `(d.org_id IS NULL AND d.user_id = ?)`)
+		args = append(args, filter.UserID)
+	}
+	if len(filter.OrgIDs) > 0 {
+		owners = append(owners, `d.org_id IN (?`+strings.Repeat(", ?", len(filter.OrgIDs)-1)+`)`)
+		for _, org := range filter.OrgIDs {
+			args = append(args, org)
+		}
+	}
+	if len(filter.Shared) > 0 {
+		owners = append(owners, `d.id IN (?`+strings.Repeat(", ?", len(filter.Shared)-1)+`)`)
+		for _, id := range filter.Shared {
+			args = append(args, id)
+		}
+	}
+	if len(owners) == 0 {
+		return "", nil, false
+	}
+	query += ` AND (` + strings.Join(owners, ` OR `) + `)`
+
+	if len(filter.DocumentIDs) > 0 {
+		query += ` AND d.id IN (?` + strings.Repeat(", ?", len(filter.DocumentIDs)-1) + `)`
+		for _, id := range filter.DocumentIDs {
+			args = append(args, id)
+		}
+	}
+	if len(filter.Languages) > 0 {
+		query += ` AND d.language IN (?` + strings.Repeat(", ?", len(filter.Languages)-1) + `)`
+		for _, language := range filter.Languages {
+			args = append(args, language)
+		}
+	}
+	for _, tag := range filter.Tags {
+		query += ` AND d.id IN (SELECT document_id FROM document_tags WHERE tag = ?)`
+		args = append(args, tag)
+	}
+	for _, key := range filter.Entities {
+		query += ` AND d.id IN (SELECT document_id FROM document_entities WHERE key = ?)`
+		args = append(args, key)
+	}
+	return query, args, true
+}
+
+// BM25's usual parameters, and how much more a hit in a chunk's heading counts than one in its text
+const (
+	bm25K1      = 1.2
+	bm25B       = 0.75
+	bm25Heading = 2.0
+)
+
+// bm25 scores a row of keyword_chunks_fts from its matchinfo(..., 'pcnalx'). The idf is Lucene's,
+// which never goes negative, so a term in most chunks still counts for a little and scores come
+// out alike in SQLite and Elasticsearch. SQLite calls it for every row that matches.
+func bm25(info []byte) float64 {
+	at := func(i int) float64 {
+		if 4*i+4 > len(info) {
+			return 0
+		}
+		return float64(binary.NativeEndian.Uint32(info[4*i:]))
+	}
+	phrases, columns, rows := int(at(0)), int(at(1)), at(2)
+
+	score := 0.0
+	for p := range phrases {
+		for c := range columns {
+			// a (average tokens), l (tokens in this row) and x (hits) follow p, c and n
+			avg, length := max(at(3+c), 1), at(3+columns+c)
+			x := 3 + 2*columns + 3*(p*columns+c)
+			hits, docs := at(x), at(x+2)
+			if hits == 0 {
+				continue
+			}
+			idf := math.Log(1 + (rows-docs+0.5)/(docs+0.5))
+			weight := 1.0
+			if c == 0 {
+				weight = bm25Heading
+			}
+			score += weight * idf * hits * (bm25K1 + 1) / (hits + bm25K1*(1-bm25B+bm25B*length/avg))
+		}
+	}
+	return score
+}
@@ -0,0 +1,361 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+)
+
+// Every schema change is a numbered pair of files per dialect, like
+// migrations/sqlite/0002_document_tags.up.sql and .down.sql. Once a migration has
+// shipped it is never edited, anything else the schema needs goes in a new one.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// postgresMigrationLock is the advisory lock replicas take so only one of them migrates at a time
+const postgresMigrationLock = 72705614
+
+// Migration is one versioned schema change
+type Migration struct {
+	Version int
+	Name    string
+	up      string
+	down    string
+}
+
+// MigrationStatus is a known migration and when it was applied, AppliedAt is nil while pending
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+func loadMigrations(d dialect) ([]Migration, error) {
+	dir := "migrations/sqlite"
+	if d == dialectPostgres {
+		dir = "migrations/postgres"
+	}
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		m := migrationName.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("migration %s/%s isn't named like 0001_name.up.sql", dir, e.Name())
+		}
+		version, _ := strconv.Atoi(m[1])
+		sql, err := fs.ReadFile(migrationFiles, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		mig := byVersion[version]
+		if mig == nil {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		}
+		if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.up = string(sql)
+		} else {
+			mig.down = string(sql)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.up == "" || mig.down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down file", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrator applies and reverts the embedded migrations. Applied versions are kept in
+// schema_migrations, each migration runs in a transaction together with its row there,
+// so a failed one leaves nothing half done.
+type Migrator struct {
+	db         *sql.DB
+	dialect    dialect
+	migrations []Migration
+	// legacy brings a database from before migrations up to where 0001 can adopt it
+	legacy func(ctx context.Context, conn *sql.Conn) error
+}
+
+// OpenMigrator connects to the database cfg names without touching its schema
+func OpenMigrator(cfg config.Database) (*Migrator, error) {
+	if cfg.IsPostgres() {
+		db, err := openPostgres(cfg.URL)
+		if err != nil {
+			return nil, err
+		}
+		return newMigrator(db, dialectPostgres)
+	}
+	db, err := openSQLite(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	return newMigrator(db, dialectSQLite)
+}
+
+func newMigrator(db *sql.DB, d dialect) (*Migrator, error) {
+	migrations, err := loadMigrations(d)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	m := &Migrator{db: db, dialect: d, migrations: migrations, legacy: upgradeLegacySQLite}
+	if d == dialectPostgres {
+		m.legacy = upgradeLegacyPostgres
+	}
+	return m, nil
+}
+
+func (m *Migrator) Close() error {
+	return m.db.Close()
+}
+
+// Latest is the version the embedded migrations end at
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Up applies every pending migration and returns how many it applied
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	return m.To(ctx, m.Latest())
+}
+
+// Down reverts the last steps applied migrations
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	n := 0
+	err := m.locked(ctx, func(conn *sql.Conn, applied map[int]time.Time) error {
+		for i := len(m.migrations) - 1; i >= 0 && n < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			if err := m.run(ctx, conn, mig, false); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// To migrates up or down until exactly the migrations up to version are applied
+func (m *Migrator) To(ctx context.Context, version int) (int, error) {
+	n := 0
+	err := m.locked(ctx, func(conn *sql.Conn, applied map[int]time.Time) error {
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; ok && mig.Version > version {
+				if err := m.run(ctx, conn, mig, false); err != nil {
+					return err
+				}
+				n++
+			}
+		}
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; !ok && mig.Version <= version {
+				if err := m.run(ctx, conn, mig, true); err != nil {
+					return err
+				}
+				n++
+			}
+		}
+		return nil
+	})
+	return n, err
+}
+
+// Status lists every known migration, plus any applied one this build doesn't know about
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var status []MigrationStatus
+	err := m.locked(ctx, func(conn *sql.Conn, applied map[int]time.Time) error {
+		for _, mig := range m.migrations {
+			s := MigrationStatus{Migration: mig}
+			if at, ok := applied[mig.Version]; ok {
+				s.AppliedAt = &at
+				delete(applied, mig.Version)
+			}
+			status = append(status, s)
+		}
+		for version, at := range applied {
+			status = append(status, MigrationStatus{Migration: Migration{Version: version, Name: "unknown"}, AppliedAt: &at})
+		}
+		return nil
+	})
+	sort.Slice(status, func(i, j int) bool { return status[i].Version < status[j].Version })
+	return status, err
+}
+
+// locked runs fn on one connection while holding the migration lock, with the applied versions
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn, applied map[int]time.Time) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// SQLite only ever has one gateway on it, Postgres may have a few starting at once
+	if m.dialect == dialectPostgres {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", postgresMigrationLock); err != nil {
+			return fmt.Errorf("taking the migration lock: %w", err)
+		}
+		defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", postgresMigrationLock)
+	}
+
+	// a database with tables but no schema_migrations was set up before migrations existed
+	tracked, err := m.tableExists(ctx, conn, "schema_migrations")
+	if err != nil {
+		return err
+	}
+	if !tracked {
+		old, err := m.tableExists(ctx, conn, "users")
+		if err != nil {
+			return err
+		}
+		if old {
+			log.Println("Adopting a database from before migrations")
+			if err := m.legacy(ctx, conn); err != nil {
+				return fmt.Errorf("upgrading the old schema: %w", err)
+			}
+		}
+	}
+
+	timestamp := "DATETIME"
+	if m.dialect == dialectPostgres {
+		timestamp = "TIMESTAMPTZ"
+	}
+	_, err = conn.ExecContext(ctx, `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at `+timestamp+` NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("creating schema_migrations: %w", err)
+	}
+
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return err
+		}
+		applied[version] = at
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	return fn(conn, applied)
+}
+
+// run applies mig, or reverts it when up is false, and records that in schema_migrations
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, mig Migration, up bool) error {
+	direction, query := "Applying", mig.up
+	record, args := "INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)", []any{mig.Version, mig.Name, time.Now().UTC()}
+	if !up {
+		direction, query = "Reverting", mig.down
+		record, args = "DELETE FROM schema_migrations WHERE version = ?", []any{mig.Version}
+	}
+	log.Printf("%s migration %04d_%s\n", direction, mig.Version, mig.Name)
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("migration %04d_%s: %w", mig.Version, mig.Name, err)
+	}
+	if _, err := tx.ExecContext(ctx, m.rebind(record), args...); err != nil {
+		return fmt.Errorf("recording migration %04d_%s: %w", mig.Version, mig.Name, err)
+	}
+	return tx.Commit()
+}
+
+func (m *Migrator) rebind(query string) string {
+	return (&sqlStore{dialect: m.dialect}).rebind(query)
+}
+
+func (m *Migrator) tableExists(ctx context.Context, conn *sql.Conn, table string) (bool, error) {
+	query := "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?"
+	if m.dialect == dialectPostgres {
+		query = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?"
+	}
+	var n int
+	if err := conn.QueryRowContext(ctx, m.rebind(query), table).Scan(&n); err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// migrate brings a freshly opened database up to date, or checks that it already is when
+// auto-migration is off. Either way a schema newer than this build is only worth a warning,
+// that's what an older gateway sees during a rolling deploy.
+func migrate(db *sql.DB, d dialect, auto bool) error {
+	m, err := newMigrator(db, d)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	if auto {
+		if _, err := m.Up(ctx); err != nil {
+			return err
+		}
+	}
+
+	status, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	var pending []string
+	for _, s := range status {
+		switch {
+		case s.AppliedAt == nil:
+			pending = append(pending, fmt.Sprintf("%04d_%s", s.Version, s.Name))
+		case s.Version > m.Latest():
+			log.Printf("Warning: Database has migration %d applied, this build only knows up to %d\n", s.Version, m.Latest())
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("pending migrations %s, run `gateway migrate up` first", strings.Join(pending, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+-- Drops everything, children before the tables they reference
+DROP TABLE IF EXISTS audit_log;
+DROP TABLE IF EXISTS login_throttle;
+DROP TABLE IF EXISTS api_keys;
+DROP TABLE IF EXISTS webhooks;
+DROP TABLE IF EXISTS upload_parts;
+DROP TABLE IF EXISTS upload_sessions;
+DROP TABLE IF EXISTS jobs;
+DROP TABLE IF EXISTS documents;
+DROP TABLE IF EXISTS org_invitations;
+DROP TABLE IF EXISTS org_members;
+DROP TABLE IF EXISTS organizations;
+DROP TABLE IF EXISTS revoked_tokens;
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,186 @@
+-- The schema as it was when migrations were introduced. IF NOT EXISTS lets databases made
+-- before then adopt it, their missing columns are added before this runs.
+
+-- Admins can use the /admin endpoints, there is no API to grant it, set the column by hand
+CREATE TABLE IF NOT EXISTS users (
+	id SERIAL PRIMARY KEY,
+	email TEXT NOT NULL UNIQUE,
+	password TEXT NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	is_admin BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+-- Only the SHA-256 of the token is stored, family_id ties together every token
+-- rotated from the same login so a reused token can revoke the whole chain
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	token_hash TEXT NOT NULL UNIQUE,
+	family_id TEXT NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+	revoked_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family ON refresh_tokens(family_id);
+
+-- access tokens can't be taken back, so logging out puts their jti here until they expire
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+	jti TEXT PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+	revoked_at TIMESTAMPTZ NOT NULL,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires_at ON revoked_tokens(expires_at);
+
+-- Documents with an org_id belong to the whole team, invitations are matched by email
+CREATE TABLE IF NOT EXISTS organizations (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS org_members (
+	org_id TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	role TEXT NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (org_id, user_id),
+	FOREIGN KEY (org_id) REFERENCES organizations(id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_org_members_user_id ON org_members(user_id);
+CREATE TABLE IF NOT EXISTS org_invitations (
+	id TEXT PRIMARY KEY,
+	org_id TEXT NOT NULL,
+	email TEXT NOT NULL,
+	role TEXT NOT NULL,
+	invited_by INTEGER NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMPTZ NOT NULL,
+	accepted_at TIMESTAMPTZ,
+	FOREIGN KEY (org_id) REFERENCES organizations(id) ON DELETE CASCADE,
+	FOREIGN KEY (invited_by) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_org_invitations_email ON org_invitations(email);
+
+-- Maps a document ID to where the object lives and who owns it.
+-- deleted_at hides the document, purged_at is set once the object and derived data are gone.
+-- sha256 is for deduplication, the scan columns stay empty when virus scanning is off.
+CREATE TABLE IF NOT EXISTS documents (
+	id TEXT PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	bucket TEXT NOT NULL,
+	object_key TEXT NOT NULL,
+	filename TEXT NOT NULL,
+	content_type TEXT NOT NULL,
+	size BIGINT NOT NULL DEFAULT 0,
+	status TEXT NOT NULL DEFAULT 'pending',
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	deleted_at TIMESTAMPTZ,
+	purged_at TIMESTAMPTZ,
+	org_id TEXT REFERENCES organizations(id),
+	sha256 TEXT NOT NULL DEFAULT '',
+	scan_status TEXT NOT NULL DEFAULT '',
+	scan_result TEXT NOT NULL DEFAULT '',
+	scanned_at TIMESTAMPTZ,
+	FOREIGN KEY (user_id) REFERENCES users(id)
+);
+CREATE INDEX IF NOT EXISTS idx_documents_user_id ON documents(user_id);
+CREATE INDEX IF NOT EXISTS idx_documents_user_created ON documents(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_documents_org_created ON documents(org_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_documents_user_sha256 ON documents(user_id, sha256);
+
+-- user_id is nullable so uploads made before auth existed still fit.
+-- options holds the per-job pipeline settings as JSON, empty for the defaults.
+CREATE TABLE IF NOT EXISTS jobs (
+	id TEXT PRIMARY KEY,
+	user_id INTEGER,
+	filename TEXT NOT NULL,
+	bucket TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending',
+	error TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	document_id TEXT REFERENCES documents(id),
+	options TEXT NOT NULL DEFAULT '',
+	FOREIGN KEY (user_id) REFERENCES users(id)
+);
+CREATE INDEX IF NOT EXISTS idx_jobs_user_id ON jobs(user_id);
+
+-- A session wraps one multipart upload, parts remember their ETags so a client can
+-- resume after a dropped connection. Sessions hash their parts as they come in.
+CREATE TABLE IF NOT EXISTS upload_sessions (
+	id TEXT PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	bucket TEXT NOT NULL,
+	object_key TEXT NOT NULL,
+	filename TEXT NOT NULL,
+	content_type TEXT NOT NULL,
+	minio_upload_id TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'in_progress',
+	document_id TEXT REFERENCES documents(id),
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	org_id TEXT REFERENCES organizations(id),
+	hash_state BYTEA,
+	hashed_parts INTEGER NOT NULL DEFAULT 0,
+	FOREIGN KEY (user_id) REFERENCES users(id)
+);
+CREATE TABLE IF NOT EXISTS upload_parts (
+	session_id TEXT NOT NULL,
+	part_number INTEGER NOT NULL,
+	etag TEXT NOT NULL,
+	size BIGINT NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (session_id, part_number),
+	FOREIGN KEY (session_id) REFERENCES upload_sessions(id) ON DELETE CASCADE
+);
+
+-- events is a comma separated list like "job.completed,job.failed"
+CREATE TABLE IF NOT EXISTS webhooks (
+	id TEXT PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	url TEXT NOT NULL,
+	secret TEXT NOT NULL,
+	events TEXT NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_webhooks_user_id ON webhooks(user_id);
+
+-- only the sha256 of the key is kept, scopes is a comma separated list like "upload,documents:read"
+CREATE TABLE IF NOT EXISTS api_keys (
+	id TEXT PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	prefix TEXT NOT NULL,
+	key_hash TEXT NOT NULL UNIQUE,
+	scopes TEXT NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	last_used_at TIMESTAMPTZ,
+	expires_at TIMESTAMPTZ,
+	revoked_at TIMESTAMPTZ,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys(user_id);
+
+-- login_throttle counts recent failed logins per email and per IP
+CREATE TABLE IF NOT EXISTS login_throttle (
+	key TEXT PRIMARY KEY,
+	failures INTEGER NOT NULL,
+	last_failed_at TIMESTAMPTZ NOT NULL,
+	locked_until TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS audit_log (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER,
+	event TEXT NOT NULL,
+	ip TEXT NOT NULL DEFAULT '',
+	detail TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
+);
+CREATE INDEX IF NOT EXISTS idx_audit_log_user_id ON audit_log(user_id);
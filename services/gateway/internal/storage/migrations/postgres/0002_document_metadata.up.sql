@@ -0,0 +1,15 @@
+-- Free-form key/value metadata as a JSON object, empty for none
+ALTER TABLE documents ADD COLUMN metadata TEXT NOT NULL DEFAULT '';
+
+-- One row per tag so listings and searches can filter on them
+CREATE TABLE document_tags (
+	document_id TEXT NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+	tag TEXT NOT NULL,
+	PRIMARY KEY (document_id, tag)
+);
+CREATE INDEX idx_document_tags_tag ON document_tags(tag);
+
+-- Chunked uploads pick them at init and hand them to the document on completion,
+-- tags is a comma separated list there
+ALTER TABLE upload_sessions ADD COLUMN tags TEXT NOT NULL DEFAULT '';
+ALTER TABLE upload_sessions ADD COLUMN metadata TEXT NOT NULL DEFAULT '';
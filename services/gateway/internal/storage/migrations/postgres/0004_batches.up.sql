@@ -0,0 +1,19 @@
+-- A batch is one multi-file upload, the status is worked out from the jobs of its items.
+-- Rejected files keep their error and never get a document.
+CREATE TABLE batches (
+	id TEXT PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id),
+	org_id TEXT REFERENCES organizations(id),
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_batches_user_id ON batches(user_id);
+CREATE TABLE batch_items (
+	batch_id TEXT NOT NULL REFERENCES batches(id) ON DELETE CASCADE,
+	position INTEGER NOT NULL,
+	filename TEXT NOT NULL,
+	document_id TEXT REFERENCES documents(id),
+	job_id TEXT REFERENCES jobs(id),
+	duplicate BOOLEAN NOT NULL DEFAULT FALSE,
+	error TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (batch_id, position)
+);
@@ -0,0 +1,2 @@
+DROP TABLE connector_files;
+DROP TABLE connectors;
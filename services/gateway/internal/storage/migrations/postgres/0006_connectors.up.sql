@@ -0,0 +1,32 @@
+-- A connector is a linked Drive or Dropbox account whose picked folders are synced into documents.
+-- oauth_state is only set while the account is being linked, folders is a JSON array.
+CREATE TABLE connectors (
+	id TEXT PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id),
+	org_id TEXT REFERENCES organizations(id),
+	collection_id TEXT REFERENCES collections(id),
+	provider TEXT NOT NULL,
+	account TEXT NOT NULL DEFAULT '',
+	status TEXT NOT NULL,
+	error TEXT NOT NULL DEFAULT '',
+	oauth_state TEXT UNIQUE,
+	access_token TEXT NOT NULL DEFAULT '',
+	refresh_token TEXT NOT NULL DEFAULT '',
+	token_expiry TIMESTAMPTZ,
+	folders TEXT NOT NULL DEFAULT '[]',
+	last_synced_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_connectors_user_id ON connectors(user_id);
+-- Every remote file a connector has seen, by the provider's ID, so a sync only takes in
+-- what is new or changed. Refused files keep their error until their revision changes.
+CREATE TABLE connector_files (
+	connector_id TEXT NOT NULL REFERENCES connectors(id) ON DELETE CASCADE,
+	remote_id TEXT NOT NULL,
+	revision TEXT NOT NULL,
+	document_id TEXT REFERENCES documents(id),
+	error TEXT NOT NULL DEFAULT '',
+	synced_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (connector_id, remote_id)
+);
@@ -0,0 +1,6 @@
+-- The data key the object is encrypted with, wrapped by a master key. Empty for objects
+-- stored in plain, which covers everything from before encryption was turned on.
+ALTER TABLE documents ADD COLUMN encryption_key TEXT NOT NULL DEFAULT '';
+
+-- A chunked upload gets its data key at init, every part is encrypted with it
+ALTER TABLE upload_sessions ADD COLUMN encryption_key TEXT NOT NULL DEFAULT '';
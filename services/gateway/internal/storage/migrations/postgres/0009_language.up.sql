@@ -0,0 +1,3 @@
+-- The ISO 639-1 code the worker detected in the extracted text, empty until a job
+-- completes or when it couldn't tell
+ALTER TABLE documents ADD COLUMN language TEXT NOT NULL DEFAULT '';
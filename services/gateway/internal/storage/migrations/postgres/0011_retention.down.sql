@@ -0,0 +1,3 @@
+DELETE FROM schedules WHERE id = 'sch_expire_documents';
+ALTER TABLE documents DROP COLUMN legal_hold;
+ALTER TABLE organizations DROP COLUMN retention_days;
@@ -0,0 +1,9 @@
+-- How many days an organization keeps its documents before they go to the trash by
+-- themselves, NULL keeps them until someone deletes them
+ALTER TABLE organizations ADD COLUMN retention_days INTEGER;
+
+-- A document under legal hold can't be deleted, by hand, by a retention rule or by the purge
+ALTER TABLE documents ADD COLUMN legal_hold BOOLEAN NOT NULL DEFAULT FALSE;
+
+INSERT INTO schedules (id, name, task, cron, next_run_at) VALUES
+	('sch_expire_documents', 'Delete documents past their organization''s retention', 'expire_documents', '0 * * * *', CURRENT_TIMESTAMP);
@@ -0,0 +1,5 @@
+-- What users can change about themselves under /me. avatar_key is their picture's object in
+-- the storage bucket, preferences their own defaults as JSON, both empty when unset.
+ALTER TABLE users ADD COLUMN display_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN avatar_key TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN preferences TEXT NOT NULL DEFAULT '';
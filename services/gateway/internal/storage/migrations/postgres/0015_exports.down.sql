@@ -0,0 +1,2 @@
+DELETE FROM schedules WHERE id = 'sch_process_exports';
+DROP TABLE exports;
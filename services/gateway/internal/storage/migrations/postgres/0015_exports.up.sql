@@ -0,0 +1,21 @@
+-- Data exports from POST /me/export, a zip of everything the account has built in the
+-- background. object_key is the zip in the storage bucket once it is completed, it is
+-- removed again at expires_at. started_at tells a build that died with its gateway.
+CREATE TABLE exports (
+	id TEXT PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	status TEXT NOT NULL,
+	object_key TEXT NOT NULL DEFAULT '',
+	size BIGINT NOT NULL DEFAULT 0,
+	error TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	started_at TIMESTAMPTZ,
+	finished_at TIMESTAMPTZ,
+	expires_at TIMESTAMPTZ,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_exports_user ON exports(user_id);
+CREATE INDEX idx_exports_status ON exports(status);
+
+INSERT INTO schedules (id, name, task, cron, next_run_at) VALUES
+	('sch_process_exports', 'Build waiting data exports and remove expired ones', 'process_exports', '* * * * *', CURRENT_TIMESTAMP);
@@ -0,0 +1,3 @@
+DROP TABLE user_quotas;
+ALTER TABLE users DROP COLUMN suspension_reason;
+ALTER TABLE users DROP COLUMN suspended_at;
@@ -0,0 +1,15 @@
+-- Admins can suspend an account without deleting it, suspended_at is set while it is and
+-- suspension_reason says why for the other admins.
+ALTER TABLE users ADD COLUMN suspended_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN suspension_reason TEXT NOT NULL DEFAULT '';
+
+-- Per-user overrides of the upload, search and ask rate limits, written like the config's
+-- (10/m, off). An empty one keeps the configured limit.
+CREATE TABLE user_quotas (
+	user_id INTEGER PRIMARY KEY,
+	uploads TEXT NOT NULL DEFAULT '',
+	search TEXT NOT NULL DEFAULT '',
+	ask TEXT NOT NULL DEFAULT '',
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,14 @@
+-- How far each job got, one row per job and stage however often the worker reports it.
+-- A job redelivered after a crash runs its stages again, runs counts how often a stage
+-- was reported and status is what the latest report said. position orders the stages.
+CREATE TABLE job_stages (
+	job_id TEXT NOT NULL REFERENCES jobs(id) ON DELETE CASCADE,
+	stage TEXT NOT NULL,
+	position INTEGER NOT NULL,
+	status TEXT NOT NULL,
+	error TEXT NOT NULL DEFAULT '',
+	runs INTEGER NOT NULL DEFAULT 1,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (job_id, stage)
+);
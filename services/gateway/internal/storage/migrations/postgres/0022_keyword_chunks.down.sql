@@ -0,0 +1 @@
+DROP TABLE keyword_chunks;
@@ -0,0 +1,15 @@
+-- The text of every chunk the worker made, for keyword search. search is what the GIN index
+-- matches queries against, the heading weighs more than the text.
+CREATE TABLE keyword_chunks (
+	id SERIAL PRIMARY KEY,
+	document_id TEXT NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+	job_id TEXT NOT NULL,
+	chunk_index INTEGER NOT NULL,
+	page INTEGER NOT NULL DEFAULT 0,
+	heading TEXT NOT NULL DEFAULT '',
+	text TEXT NOT NULL,
+	search TSVECTOR GENERATED ALWAYS AS (setweight(to_tsvector('simple', heading), 'A') || to_tsvector('simple', text)) STORED,
+	UNIQUE (document_id, chunk_index)
+);
+CREATE INDEX idx_keyword_chunks_job ON keyword_chunks(job_id);
+CREATE INDEX idx_keyword_chunks_search ON keyword_chunks USING GIN (search);
@@ -0,0 +1,30 @@
+-- The queries each user ran last, newest first, filters is the rest of the search as JSON
+CREATE TABLE search_history (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	query TEXT NOT NULL,
+	filters TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_search_history_user ON search_history(user_id, id);
+
+-- notify is a comma separated list like "webhook,email", empty sends no alerts
+CREATE TABLE saved_searches (
+	id TEXT PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	query TEXT NOT NULL,
+	filters TEXT NOT NULL DEFAULT '',
+	notify TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (user_id, name)
+);
+
+-- the documents a saved search alerted on, so a reprocessed document doesn't alert again
+CREATE TABLE saved_search_alerts (
+	saved_search_id TEXT NOT NULL REFERENCES saved_searches(id) ON DELETE CASCADE,
+	document_id TEXT NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (saved_search_id, document_id)
+);
@@ -0,0 +1,26 @@
+-- collection_id and document_id have no foreign keys, a chat about a collection or document that
+-- is gone finds nothing rather than widening to the whole corpus
+CREATE TABLE chats (
+	id TEXT PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	title TEXT NOT NULL DEFAULT '',
+	org_id TEXT,
+	collection_id TEXT,
+	document_id TEXT,
+	mode TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_chats_user ON chats(user_id, updated_at);
+
+-- sources is the JSON list of chunks an answer was built from, empty for questions
+CREATE TABLE chat_messages (
+	id SERIAL PRIMARY KEY,
+	chat_id TEXT NOT NULL REFERENCES chats(id) ON DELETE CASCADE,
+	role TEXT NOT NULL,
+	content TEXT NOT NULL,
+	query TEXT NOT NULL DEFAULT '',
+	sources TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_chat_messages_chat ON chat_messages(chat_id, id);
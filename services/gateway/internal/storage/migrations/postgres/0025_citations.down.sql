@@ -0,0 +1,3 @@
+ALTER TABLE chat_messages DROP COLUMN citations;
+ALTER TABLE keyword_chunks DROP COLUMN end_offset;
+ALTER TABLE keyword_chunks DROP COLUMN start_offset;
@@ -0,0 +1 @@
+DROP TABLE allowed_models;
@@ -0,0 +1,14 @@
+-- The embedding and generation models callers may pick per request, an admin keeps the list.
+-- Prices are in USD per million tokens, a limit of 0 leaves the provider's own.
+CREATE TABLE allowed_models (
+	kind TEXT NOT NULL,
+	name TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	input_price DOUBLE PRECISION NOT NULL DEFAULT 0,
+	output_price DOUBLE PRECISION NOT NULL DEFAULT 0,
+	max_input_tokens INTEGER NOT NULL DEFAULT 0,
+	max_output_tokens INTEGER NOT NULL DEFAULT 0,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (kind, name)
+);
@@ -0,0 +1,3 @@
+DELETE FROM schedules WHERE id = 'sch_migrate_embeddings';
+ALTER TABLE jobs DROP COLUMN collection;
+DROP TABLE embedding_migrations;
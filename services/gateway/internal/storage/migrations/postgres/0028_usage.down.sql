@@ -0,0 +1,2 @@
+DELETE FROM schedules WHERE id = 'sch_report_usage';
+DROP TABLE usage_daily;
@@ -0,0 +1,3 @@
+ALTER TABLE organizations DROP COLUMN plan;
+ALTER TABLE users DROP COLUMN plan;
+DROP TABLE plans;
@@ -0,0 +1,21 @@
+-- The tiers users and organizations are on and what each allows. A limit of 0 is none, or the
+-- server's own for max_file_size. models are the allowed models the plan may pick, comma
+-- separated, '*' for all of them.
+CREATE TABLE plans (
+	name TEXT PRIMARY KEY,
+	description TEXT NOT NULL DEFAULT '',
+	max_file_size BIGINT NOT NULL DEFAULT 0,
+	monthly_pages BIGINT NOT NULL DEFAULT 0,
+	ocr BOOLEAN NOT NULL DEFAULT FALSE,
+	models TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO plans (name, description, max_file_size, monthly_pages, ocr, models) VALUES
+	('free', 'Small files, a few hundred pages a month and the default models', 10485760, 500, FALSE, ''),
+	('pro', 'Files up to the server limit, OCR and any allowed model', 0, 10000, TRUE, '*'),
+	('enterprise', 'No monthly limit', 0, 0, TRUE, '*');
+
+-- documents in an organization go by its plan, everything else by their owner's
+ALTER TABLE users ADD COLUMN plan TEXT NOT NULL DEFAULT 'free';
+ALTER TABLE organizations ADD COLUMN plan TEXT NOT NULL DEFAULT 'free';
@@ -0,0 +1,31 @@
+-- The Stripe subscriptions plans are bought with, one per user ('' org_id) or organization.
+-- user_id is who checked out. event_at is the creation time of the last event applied, an older
+-- event arriving late doesn't undo a newer one.
+CREATE TABLE subscriptions (
+	id TEXT PRIMARY KEY,
+	customer_id TEXT NOT NULL,
+	item_id TEXT NOT NULL DEFAULT '',
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	org_id TEXT NOT NULL DEFAULT '',
+	plan TEXT NOT NULL,
+	status TEXT NOT NULL,
+	cancel_at_period_end BOOLEAN NOT NULL DEFAULT FALSE,
+	current_period_end TIMESTAMPTZ,
+	event_at BIGINT NOT NULL DEFAULT 0,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_subscriptions_account ON subscriptions(user_id, org_id);
+
+-- how much the stored versions of an account's documents may take up, 0 is no limit
+ALTER TABLE plans ADD COLUMN max_storage BIGINT NOT NULL DEFAULT 0;
+UPDATE plans SET max_storage = 1073741824 WHERE name = 'free';
+UPDATE plans SET max_storage = 107374182400 WHERE name = 'pro';
+
+-- set while an account holds more than its plan's storage, after a downgrade. It can read and
+-- delete its documents but not add any until it fits again.
+ALTER TABLE users ADD COLUMN read_only_at TIMESTAMPTZ;
+ALTER TABLE organizations ADD COLUMN read_only_at TIMESTAMPTZ;
+
+INSERT INTO schedules (id, name, task, cron, next_run_at) VALUES
+	('sch_check_storage', 'Take accounts that fit their plan''s storage again out of read-only', 'check_storage', '*/15 * * * *', CURRENT_TIMESTAMP);
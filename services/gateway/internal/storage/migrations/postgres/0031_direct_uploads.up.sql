@@ -0,0 +1,10 @@
+-- Direct uploads go from the client straight to object storage through a presigned URL, their
+-- session only records what the document will be. size is what the client said it would send,
+-- expires_at when the URL stops taking it.
+ALTER TABLE upload_sessions ADD COLUMN direct BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE upload_sessions ADD COLUMN size BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE upload_sessions ADD COLUMN expires_at TIMESTAMPTZ;
+CREATE INDEX idx_upload_sessions_expiry ON upload_sessions(status, expires_at);
+
+INSERT INTO schedules (id, name, task, cron, next_run_at) VALUES
+	('sch_expire_uploads', 'Discard direct uploads that were never completed', 'expire_uploads', '0 * * * *', CURRENT_TIMESTAMP);
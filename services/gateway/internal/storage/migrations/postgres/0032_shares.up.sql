@@ -0,0 +1,31 @@
+-- Shares give a user outside a document's or collection's organization access to it, one on a
+-- collection reaches its sub-collections and the documents filed in them. Exactly one of
+-- document_id and collection_id is set. permission is read or comment.
+CREATE TABLE shares (
+	id TEXT PRIMARY KEY,
+	document_id TEXT,
+	collection_id TEXT,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	permission TEXT NOT NULL,
+	created_by INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX idx_shares_document ON shares(document_id, user_id);
+CREATE UNIQUE INDEX idx_shares_collection ON shares(collection_id, user_id);
+CREATE INDEX idx_shares_user_id ON shares(user_id);
+
+-- Public links to a document or collection, opened with the token whose hash is kept here and
+-- the password when password_hash isn't ''. They stop working at expires_at, or once their
+-- creator can't read what they point at any more.
+CREATE TABLE share_links (
+	id TEXT PRIMARY KEY,
+	token_hash TEXT NOT NULL UNIQUE,
+	document_id TEXT,
+	collection_id TEXT,
+	password_hash TEXT NOT NULL DEFAULT '',
+	expires_at TIMESTAMPTZ NOT NULL,
+	created_by INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_share_links_document_id ON share_links(document_id);
+CREATE INDEX idx_share_links_collection_id ON share_links(collection_id);
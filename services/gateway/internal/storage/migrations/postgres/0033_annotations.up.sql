@@ -0,0 +1,19 @@
+-- Highlights and comments on a document, anchored by byte offsets into its extracted text like
+-- chunks are. quote is the text between them. search is what the GIN index matches queries
+-- against, the body weighs more than the quote.
+CREATE TABLE annotations (
+	id TEXT PRIMARY KEY,
+	document_id TEXT NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	kind TEXT NOT NULL,
+	page INTEGER NOT NULL DEFAULT 0,
+	start_offset INTEGER NOT NULL,
+	end_offset INTEGER NOT NULL,
+	quote TEXT NOT NULL DEFAULT '',
+	body TEXT NOT NULL DEFAULT '',
+	search TSVECTOR GENERATED ALWAYS AS (setweight(to_tsvector('simple', body), 'A') || to_tsvector('simple', quote)) STORED,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_annotations_document_id ON annotations(document_id, start_offset);
+CREATE INDEX idx_annotations_search ON annotations USING GIN (search);
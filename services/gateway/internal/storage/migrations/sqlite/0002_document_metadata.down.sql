@@ -0,0 +1,4 @@
+ALTER TABLE upload_sessions DROP COLUMN metadata;
+ALTER TABLE upload_sessions DROP COLUMN tags;
+DROP TABLE document_tags;
+ALTER TABLE documents DROP COLUMN metadata;
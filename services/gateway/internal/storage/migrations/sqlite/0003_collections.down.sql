@@ -0,0 +1,4 @@
+ALTER TABLE upload_sessions DROP COLUMN collection_id;
+DROP INDEX idx_documents_collection_id;
+ALTER TABLE documents DROP COLUMN collection_id;
+DROP TABLE collections;
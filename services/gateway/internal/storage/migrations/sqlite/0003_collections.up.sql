@@ -0,0 +1,22 @@
+-- Collections are folders for documents, personal or in an organization like documents are.
+-- options holds the pipeline defaults for documents filed in one as JSON, empty for none.
+CREATE TABLE collections (
+	id TEXT PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id),
+	org_id TEXT REFERENCES organizations(id),
+	parent_id TEXT REFERENCES collections(id),
+	name TEXT NOT NULL,
+	options TEXT NOT NULL DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_collections_user_id ON collections(user_id);
+CREATE INDEX idx_collections_org_id ON collections(org_id);
+CREATE INDEX idx_collections_parent_id ON collections(parent_id);
+
+-- No foreign key here, SQLite can't drop a column that has one. Deleting a collection
+-- clears it on the soft-deleted documents still pointing at it.
+ALTER TABLE documents ADD COLUMN collection_id TEXT;
+CREATE INDEX idx_documents_collection_id ON documents(collection_id);
+
+ALTER TABLE upload_sessions ADD COLUMN collection_id TEXT;
@@ -0,0 +1,6 @@
+-- Each user's inbound email address is token@INBOUND_EMAIL_DOMAIN, rotating it replaces the token
+CREATE TABLE inboxes (
+	user_id INTEGER PRIMARY KEY REFERENCES users(id),
+	token TEXT NOT NULL UNIQUE,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,2 @@
+DROP INDEX idx_jobs_document_id;
+DROP TABLE schedules;
@@ -0,0 +1,26 @@
+-- Periodic jobs the gateway runs itself, like cron. cron is five fields in UTC, params are the
+-- task's settings as JSON. next_run_at is NULL while a schedule is disabled, a replica claims a
+-- run by moving it forward, so each run happens once however many gateways there are.
+CREATE TABLE schedules (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	task TEXT NOT NULL,
+	cron TEXT NOT NULL,
+	params TEXT NOT NULL DEFAULT '{}',
+	enabled BOOLEAN NOT NULL DEFAULT 1,
+	next_run_at DATETIME,
+	last_run_at DATETIME,
+	last_status TEXT NOT NULL DEFAULT '',
+	last_result TEXT NOT NULL DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_schedules_next_run_at ON schedules(next_run_at);
+
+-- What used to run on fixed timers inside the gateway, now as schedules that can be changed
+INSERT INTO schedules (id, name, task, cron, next_run_at) VALUES
+	('sch_sync_connectors', 'Sync connectors that are due', 'sync_connectors', '* * * * *', CURRENT_TIMESTAMP),
+	('sch_purge_documents', 'Purge deleted documents past retention', 'purge_documents', '*/5 * * * *', CURRENT_TIMESTAMP);
+
+-- re-embedding looks up the jobs of every document
+CREATE INDEX idx_jobs_document_id ON jobs(document_id);
@@ -0,0 +1,2 @@
+ALTER TABLE upload_sessions DROP COLUMN encryption_key;
+ALTER TABLE documents DROP COLUMN encryption_key;
@@ -0,0 +1,2 @@
+ALTER TABLE documents DROP COLUMN version;
+DROP TABLE document_versions;
@@ -0,0 +1,21 @@
+-- Every upload of a document's content is a version, numbered from 1 per document. Older
+-- versions keep their object so they can be restored, the documents row always carries the
+-- current one and version says which that is.
+CREATE TABLE document_versions (
+	document_id TEXT NOT NULL REFERENCES documents(id),
+	version INTEGER NOT NULL,
+	object_key TEXT NOT NULL,
+	filename TEXT NOT NULL,
+	content_type TEXT NOT NULL,
+	size INTEGER NOT NULL DEFAULT 0,
+	sha256 TEXT NOT NULL DEFAULT '',
+	encryption_key TEXT NOT NULL DEFAULT '',
+	user_id INTEGER NOT NULL REFERENCES users(id),
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (document_id, version)
+);
+ALTER TABLE documents ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+
+-- what is stored already is everyone's first version
+INSERT INTO document_versions (document_id, version, object_key, filename, content_type, size, sha256, encryption_key, user_id, created_at)
+	SELECT id, 1, object_key, filename, content_type, size, sha256, encryption_key, user_id, created_at FROM documents;
@@ -0,0 +1,21 @@
+-- A session is one login and every refresh token rotated from it, its id is their family_id.
+-- Access tokens carry it as the sid claim, so ending a session cuts them off right away too.
+CREATE TABLE sessions (
+	id TEXT PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	user_agent TEXT NOT NULL DEFAULT '',
+	ip TEXT NOT NULL DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	last_used_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	expires_at DATETIME NOT NULL,
+	revoked_at DATETIME,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_sessions_user ON sessions(user_id);
+
+-- logins from before sessions were tracked, the ones that can still be refreshed
+INSERT INTO sessions (id, user_id, created_at, last_used_at, expires_at)
+SELECT family_id, user_id, MIN(created_at), MAX(created_at), MAX(expires_at)
+FROM refresh_tokens
+GROUP BY family_id, user_id
+HAVING COUNT(revoked_at) < COUNT(*);
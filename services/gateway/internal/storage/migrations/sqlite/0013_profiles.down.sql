@@ -0,0 +1,3 @@
+ALTER TABLE users DROP COLUMN preferences;
+ALTER TABLE users DROP COLUMN avatar_key;
+ALTER TABLE users DROP COLUMN display_name;
@@ -0,0 +1,3 @@
+DELETE FROM schedules WHERE id = 'sch_purge_accounts';
+ALTER TABLE users DROP COLUMN purged_at;
+ALTER TABLE users DROP COLUMN deleted_at;
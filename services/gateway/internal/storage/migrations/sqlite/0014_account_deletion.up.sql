@@ -0,0 +1,8 @@
+-- A deleted account keeps its row so IDs elsewhere still point somewhere, with its email,
+-- password and profile wiped at once. purged_at is set once the purge_accounts schedule has
+-- removed its documents and objects too.
+ALTER TABLE users ADD COLUMN deleted_at DATETIME;
+ALTER TABLE users ADD COLUMN purged_at DATETIME;
+
+INSERT INTO schedules (id, name, task, cron, next_run_at) VALUES
+	('sch_purge_accounts', 'Purge the data of deleted accounts', 'purge_accounts', '*/5 * * * *', CURRENT_TIMESTAMP);
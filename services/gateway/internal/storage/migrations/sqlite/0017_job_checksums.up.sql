@@ -0,0 +1,3 @@
+-- The SHA-256 of the document's content when the job was queued, the worker checks the
+-- object it downloads against it. Empty for documents uploaded before it was recorded.
+ALTER TABLE jobs ADD COLUMN sha256 TEXT NOT NULL DEFAULT '';
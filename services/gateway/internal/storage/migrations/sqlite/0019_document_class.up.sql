@@ -0,0 +1,3 @@
+-- The class the worker's classify stage labelled the document with, like invoice or
+-- contract, empty until a job completes or when it fits none
+ALTER TABLE documents ADD COLUMN class TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,11 @@
+-- The people, organizations, dates and amounts the worker found in a document's text, the
+-- ones of the latest completed job. key is type:value in lower case, what listings filter on.
+CREATE TABLE document_entities (
+	document_id TEXT NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+	type TEXT NOT NULL,
+	value TEXT NOT NULL,
+	key TEXT NOT NULL,
+	count INTEGER NOT NULL DEFAULT 1,
+	PRIMARY KEY (document_id, key)
+);
+CREATE INDEX idx_document_entities_key ON document_entities(key);
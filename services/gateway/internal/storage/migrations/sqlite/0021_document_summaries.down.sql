@@ -0,0 +1,2 @@
+ALTER TABLE documents DROP COLUMN key_points;
+ALTER TABLE documents DROP COLUMN summary;
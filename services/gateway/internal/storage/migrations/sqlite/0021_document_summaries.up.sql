@@ -0,0 +1,4 @@
+-- A few sentences and the key points (a JSON array) an LLM wrote about the document once the
+-- worker indexed it, empty when summaries are off or the model didn't manage one
+ALTER TABLE documents ADD COLUMN summary TEXT NOT NULL DEFAULT '';
+ALTER TABLE documents ADD COLUMN key_points TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,6 @@
+DROP TRIGGER keyword_chunks_after_insert;
+DROP TRIGGER keyword_chunks_after_update;
+DROP TRIGGER keyword_chunks_before_delete;
+DROP TRIGGER keyword_chunks_before_update;
+DROP TABLE keyword_chunks_fts;
+DROP TABLE keyword_chunks;
@@ -0,0 +1,29 @@
+-- The text of every chunk the worker made, for keyword search. keyword_chunks_fts indexes the
+-- heading and text of each row by its id, which stays the same when a chunk is written over.
+-- It is FTS4 since the driver builds that in, FTS5 would need the sqlite_fts5 build tag.
+CREATE TABLE keyword_chunks (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	document_id TEXT NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+	job_id TEXT NOT NULL,
+	chunk_index INTEGER NOT NULL,
+	page INTEGER NOT NULL DEFAULT 0,
+	heading TEXT NOT NULL DEFAULT '',
+	text TEXT NOT NULL,
+	UNIQUE (document_id, chunk_index)
+);
+CREATE INDEX idx_keyword_chunks_job ON keyword_chunks(job_id);
+
+CREATE VIRTUAL TABLE keyword_chunks_fts USING fts4(content="keyword_chunks", heading, text, tokenize=unicode61 "remove_diacritics=2");
+
+CREATE TRIGGER keyword_chunks_before_update BEFORE UPDATE ON keyword_chunks BEGIN
+	DELETE FROM keyword_chunks_fts WHERE docid = old.id;
+END;
+CREATE TRIGGER keyword_chunks_before_delete BEFORE DELETE ON keyword_chunks BEGIN
+	DELETE FROM keyword_chunks_fts WHERE docid = old.id;
+END;
+CREATE TRIGGER keyword_chunks_after_update AFTER UPDATE ON keyword_chunks BEGIN
+	INSERT INTO keyword_chunks_fts (docid, heading, text) VALUES (new.id, new.heading, new.text);
+END;
+CREATE TRIGGER keyword_chunks_after_insert AFTER INSERT ON keyword_chunks BEGIN
+	INSERT INTO keyword_chunks_fts (docid, heading, text) VALUES (new.id, new.heading, new.text);
+END;
@@ -0,0 +1,7 @@
+-- Where each chunk sits in the document's extracted text, as byte offsets, so a citation can point
+-- into it. Zero for chunks indexed before they were recorded, until the document is reprocessed.
+ALTER TABLE keyword_chunks ADD COLUMN start_offset INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE keyword_chunks ADD COLUMN end_offset INTEGER NOT NULL DEFAULT 0;
+
+-- citations is the JSON list of passages an answer's sentences were traced back to
+ALTER TABLE chat_messages ADD COLUMN citations TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,27 @@
+-- Moving the corpus to another embedding model. Every document is re-embedded into a
+-- collection of its own while searches keep going to the current one, and the migration that
+-- completed last is what searches go to after. At most one runs at a time.
+CREATE TABLE embedding_migrations (
+	id TEXT PRIMARY KEY,
+	embedding_model TEXT NOT NULL,
+	collection TEXT NOT NULL UNIQUE,
+	from_model TEXT NOT NULL DEFAULT '',
+	from_collection TEXT NOT NULL DEFAULT '',
+	status TEXT NOT NULL,
+	batch_size INTEGER NOT NULL,
+	total INTEGER NOT NULL DEFAULT 0,
+	migrated INTEGER NOT NULL DEFAULT 0,
+	failed INTEGER NOT NULL DEFAULT 0,
+	message TEXT NOT NULL DEFAULT '',
+	created_by INTEGER,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	switched_at DATETIME
+);
+CREATE UNIQUE INDEX idx_embedding_migrations_running ON embedding_migrations(status) WHERE status = 'running';
+
+-- the vector collection a job indexes into, '' for the configured one
+ALTER TABLE jobs ADD COLUMN collection TEXT NOT NULL DEFAULT '';
+
+INSERT INTO schedules (id, name, task, cron, next_run_at) VALUES
+	('sch_migrate_embeddings', 'Queue the next documents of a running embedding migration', 'migrate_embeddings', '* * * * *', CURRENT_TIMESTAMP);
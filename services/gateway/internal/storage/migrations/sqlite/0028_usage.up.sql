@@ -0,0 +1,18 @@
+-- What every user consumed each day (UTC), counted per organization ('' for their own
+-- documents) and metric. Counters add up over the day, storage_bytes is the day's peak.
+-- Closed days are sent to billing once, reported_at says when.
+CREATE TABLE usage_daily (
+	day TEXT NOT NULL,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	org_id TEXT NOT NULL DEFAULT '',
+	metric TEXT NOT NULL,
+	quantity INTEGER NOT NULL DEFAULT 0,
+	reported_at DATETIME,
+	PRIMARY KEY (day, user_id, org_id, metric)
+);
+CREATE INDEX idx_usage_daily_user ON usage_daily(user_id, day);
+CREATE INDEX idx_usage_daily_org ON usage_daily(org_id, day);
+CREATE INDEX idx_usage_daily_unreported ON usage_daily(day) WHERE reported_at IS NULL;
+
+INSERT INTO schedules (id, name, task, cron, next_run_at) VALUES
+	('sch_report_usage', 'Record storage usage and send closed days to billing', 'report_usage', '5 * * * *', CURRENT_TIMESTAMP);
@@ -0,0 +1,5 @@
+DELETE FROM schedules WHERE id = 'sch_check_storage';
+ALTER TABLE organizations DROP COLUMN read_only_at;
+ALTER TABLE users DROP COLUMN read_only_at;
+ALTER TABLE plans DROP COLUMN max_storage;
+DROP TABLE subscriptions;
@@ -0,0 +1,5 @@
+DELETE FROM schedules WHERE id = 'sch_expire_uploads';
+DROP INDEX idx_upload_sessions_expiry;
+ALTER TABLE upload_sessions DROP COLUMN expires_at;
+ALTER TABLE upload_sessions DROP COLUMN size;
+ALTER TABLE upload_sessions DROP COLUMN direct;
@@ -0,0 +1,6 @@
+DROP TRIGGER annotations_after_insert;
+DROP TRIGGER annotations_after_update;
+DROP TRIGGER annotations_before_delete;
+DROP TRIGGER annotations_before_update;
+DROP TABLE annotations_fts;
+DROP TABLE annotations;
@@ -0,0 +1,32 @@
+-- Highlights and comments on a document, anchored by byte offsets into its extracted text like
+-- chunks are. quote is the text between them. annotations_fts indexes the body and quote of each
+-- row for search, the body first so bm25 weighs it like a chunk's heading.
+CREATE TABLE annotations (
+	id TEXT PRIMARY KEY,
+	document_id TEXT NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	kind TEXT NOT NULL,
+	page INTEGER NOT NULL DEFAULT 0,
+	start_offset INTEGER NOT NULL,
+	end_offset INTEGER NOT NULL,
+	quote TEXT NOT NULL DEFAULT '',
+	body TEXT NOT NULL DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_annotations_document_id ON annotations(document_id, start_offset);
+
+CREATE VIRTUAL TABLE annotations_fts USING fts4(content="annotations", body, quote, tokenize=unicode61 "remove_diacritics=2");
+
+CREATE TRIGGER annotations_before_update BEFORE UPDATE ON annotations BEGIN
+	DELETE FROM annotations_fts WHERE docid = old.rowid;
+END;
+CREATE TRIGGER annotations_before_delete BEFORE DELETE ON annotations BEGIN
+	DELETE FROM annotations_fts WHERE docid = old.rowid;
+END;
+CREATE TRIGGER annotations_after_update AFTER UPDATE ON annotations BEGIN
+	INSERT INTO annotations_fts (docid, body, quote) VALUES (new.rowid, new.body, new.quote);
+END;
+CREATE TRIGGER annotations_after_insert AFTER INSERT ON annotations BEGIN
+	INSERT INTO annotations_fts (docid, body, quote) VALUES (new.rowid, new.body, new.quote);
+END;
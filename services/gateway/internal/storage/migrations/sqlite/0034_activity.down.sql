@@ -0,0 +1,4 @@
+DROP INDEX idx_audit_log_org_id;
+DROP INDEX idx_audit_log_document_id;
+ALTER TABLE audit_log DROP COLUMN org_id;
+ALTER TABLE audit_log DROP COLUMN document_id;
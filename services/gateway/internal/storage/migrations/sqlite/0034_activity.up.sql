@@ -0,0 +1,6 @@
+-- Entries about a document name it, and its organization if it has one, so the audit log
+-- doubles as the activity feed of both
+ALTER TABLE audit_log ADD COLUMN document_id TEXT;
+ALTER TABLE audit_log ADD COLUMN org_id TEXT;
+CREATE INDEX idx_audit_log_document_id ON audit_log(document_id, id);
+CREATE INDEX idx_audit_log_org_id ON audit_log(org_id, id);
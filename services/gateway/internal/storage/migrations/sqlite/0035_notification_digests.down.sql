@@ -0,0 +1,2 @@
+DELETE FROM schedules WHERE id = 'sch_send_digests';
+DROP TABLE notification_digests;
@@ -0,0 +1,16 @@
+-- Finished jobs waiting to go out in their uploader's daily digest, for users whose
+-- preferences.notifications ask for one. The send_digests schedule emails each user theirs and
+-- deletes what it sent.
+CREATE TABLE notification_digests (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	job_id TEXT NOT NULL UNIQUE,
+	document_id TEXT NOT NULL DEFAULT '',
+	status TEXT NOT NULL,
+	error TEXT NOT NULL DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_notification_digests_user ON notification_digests(user_id, id);
+
+INSERT INTO schedules (id, name, task, cron, next_run_at) VALUES
+	('sch_send_digests', 'Email the daily digests of processing completions and failures', 'send_digests', '0 8 * * *', CURRENT_TIMESTAMP);
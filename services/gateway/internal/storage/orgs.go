@@ -0,0 +1,259 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+)
+
+// CreateOrg stores the organization with ownerID as its first owner
+func (s *sqlStore) CreateOrg(ctx context.Context, org models.Organization, ownerID int) error {
+	t, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer t.Rollback()
+
+	if _, err := t.exec(ctx, `INSERT INTO organizations (id, name) VALUES (?, ?)`, org.ID, org.Name); err != nil {
+		return err
+	}
+	query := `INSERT INTO org_members (org_id, user_id, role) VALUES (?, ?, ?)`
+	if _, err := t.exec(ctx, query, org.ID, ownerID, models.RoleOwner); err != nil {
+		return err
+	}
+	return t.Commit()
+}
+
+func (s *sqlStore) ListOrgs(ctx context.Context, userID int) ([]models.Organization, error) {
+	query := `SELECT ` + orgColumns + `, m.role FROM organizations o
+		JOIN org_members m ON m.org_id = o.id WHERE m.user_id = ? ORDER BY o.created_at`
+	rows, err := s.query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := []models.Organization{}
+	for rows.Next() {
+		var role string
+		org, err := scanOrg(rows, &role)
+		if err != nil {
+			return nil, err
+		}
+		org.Role = role
+		orgs = append(orgs, org)
+	}
+	return orgs, rows.Err()
+}
+
+const orgColumns = `o.id, o.name, o.created_at, o.retention_days, o.plan, o.read_only_at`
+
+// scanOrg scans orgColumns, and into extra what the query selects after them
+func scanOrg(row rowScanner, extra ...any) (models.Organization, error) {
+	var org models.Organization
+	var days sql.NullInt64
+	var readOnlyAt sql.NullTime
+	err := row.Scan(append([]any{&org.ID, &org.Name, &org.CreatedAt, &days, &org.Plan, &readOnlyAt}, extra...)...)
+	org.RetentionDays = retentionDays(days)
+	if readOnlyAt.Valid {
+		org.ReadOnlyAt = &readOnlyAt.Time
+	}
+	return org, err
+}
+
+func retentionDays(days sql.NullInt64) *int {
+	if !days.Valid {
+		return nil
+	}
+	n := int(days.Int64)
+	return &n
+}
+
+func (s *sqlStore) GetOrg(ctx context.Context, id string) (models.Organization, error) {
+	org, err := scanOrg(s.queryRow(ctx, `SELECT `+orgColumns+` FROM organizations o WHERE o.id = ?`, id))
+	return org, notFound(err)
+}
+
+func (s *sqlStore) SetOrgRetention(ctx context.Context, id string, days *int) error {
+	res, err := s.exec(ctx, `UPDATE organizations SET retention_days = ? WHERE id = ?`, days, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) ListOrgsWithRetention(ctx context.Context) ([]models.Organization, error) {
+	rows, err := s.query(ctx, `SELECT `+orgColumns+` FROM organizations o WHERE o.retention_days IS NOT NULL ORDER BY o.created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := []models.Organization{}
+	for rows.Next() {
+		org, err := scanOrg(rows)
+		if err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, org)
+	}
+	return orgs, rows.Err()
+}
+
+const membershipColumns = `m.org_id, m.user_id, u.email, m.role, m.created_at`
+
+func scanMembership(row rowScanner) (models.Membership, error) {
+	var m models.Membership
+	err := row.Scan(&m.OrgID, &m.UserID, &m.Email, &m.Role, &m.CreatedAt)
+	return m, err
+}
+
+func (s *sqlStore) GetMembership(ctx context.Context, orgID string, userID int) (models.Membership, error) {
+	query := `SELECT ` + membershipColumns + ` FROM org_members m JOIN users u ON u.id = m.user_id
+		WHERE m.org_id = ? AND m.user_id = ?`
+	m, err := scanMembership(s.queryRow(ctx, query, orgID, userID))
+	return m, notFound(err)
+}
+
+func (s *sqlStore) ListMembers(ctx context.Context, orgID string) ([]models.Membership, error) {
+	query := `SELECT ` + membershipColumns + ` FROM org_members m JOIN users u ON u.id = m.user_id
+		WHERE m.org_id = ? ORDER BY m.created_at`
+	rows, err := s.query(ctx, query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []models.Membership{}
+	for rows.Next() {
+		m, err := scanMembership(rows)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+func (s *sqlStore) UpdateMemberRole(ctx context.Context, orgID string, userID int, role string) error {
+	res, err := s.exec(ctx, `UPDATE org_members SET role = ? WHERE org_id = ? AND user_id = ?`, role, orgID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) RemoveMember(ctx context.Context, orgID string, userID int) error {
+	res, err := s.exec(ctx, `DELETE FROM org_members WHERE org_id = ? AND user_id = ?`, orgID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+const invitationColumns = `i.id, i.org_id, o.name, i.email, i.role, i.invited_by, i.created_at, i.expires_at, i.accepted_at`
+
+func scanInvitation(row rowScanner) (models.Invitation, error) {
+	var inv models.Invitation
+	var accepted sql.NullTime
+	err := row.Scan(&inv.ID, &inv.OrgID, &inv.OrgName, &inv.Email, &inv.Role, &inv.InvitedBy, &inv.CreatedAt, &inv.ExpiresAt, &accepted)
+	if accepted.Valid {
+		inv.AcceptedAt = &accepted.Time
+	}
+	return inv, err
+}
+
+func (s *sqlStore) CreateInvitation(ctx context.Context, inv models.Invitation) error {
+	query := `INSERT INTO org_invitations (id, org_id, email, role, invited_by, expires_at) VALUES (?, ?, ?, ?, ?, ?)`
+	_, err := s.exec(ctx, query, inv.ID, inv.OrgID, strings.ToLower(inv.Email), inv.Role, inv.InvitedBy, inv.ExpiresAt.UTC())
+	return err
+}
+
+func (s *sqlStore) listInvitations(ctx context.Context, where string, args ...any) ([]models.Invitation, error) {
+	query := `SELECT ` + invitationColumns + ` FROM org_invitations i JOIN organizations o ON o.id = i.org_id
+		WHERE ` + where + ` ORDER BY i.created_at`
+	rows, err := s.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invs := []models.Invitation{}
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invs = append(invs, inv)
+	}
+	return invs, rows.Err()
+}
+
+// ListOrgInvitations returns the invitations nobody has accepted yet, expired ones included
+func (s *sqlStore) ListOrgInvitations(ctx context.Context, orgID string) ([]models.Invitation, error) {
+	return s.listInvitations(ctx, `i.org_id = ? AND i.accepted_at IS NULL`, orgID)
+}
+
+func (s *sqlStore) ListInvitationsForEmail(ctx context.Context, email string) ([]models.Invitation, error) {
+	return s.listInvitations(ctx, `i.email = ? AND i.accepted_at IS NULL`, strings.ToLower(email))
+}
+
+func (s *sqlStore) GetInvitation(ctx context.Context, id string) (models.Invitation, error) {
+	query := `SELECT ` + invitationColumns + ` FROM org_invitations i JOIN organizations o ON o.id = i.org_id WHERE i.id = ?`
+	inv, err := scanInvitation(s.queryRow(ctx, query, id))
+	return inv, notFound(err)
+}
+
+// AcceptInvitation marks the invitation used and adds userID to its organization.
+// ErrDuplicate means the user was already a member, the invitation is used up either way.
+func (s *sqlStore) AcceptInvitation(ctx context.Context, inv models.Invitation, userID int) error {
+	t, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer t.Rollback()
+
+	res, err := t.exec(ctx, `UPDATE org_invitations SET accepted_at = CURRENT_TIMESTAMP WHERE id = ? AND accepted_at IS NULL`, inv.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+
+	// a failed statement would abort the whole transaction on Postgres, so skip conflicts instead
+	query := `INSERT INTO org_members (org_id, user_id, role) VALUES (?, ?, ?) ON CONFLICT (org_id, user_id) DO NOTHING`
+	res, err = t.exec(ctx, query, inv.OrgID, userID, inv.Role)
+	if err != nil {
+		return err
+	}
+	if err := t.Commit(); err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrDuplicate
+	}
+	return nil
+}
+
+func (s *sqlStore) DeleteInvitation(ctx context.Context, id, orgID string) error {
+	res, err := s.exec(ctx, `DELETE FROM org_invitations WHERE id = ? AND org_id = ? AND accepted_at IS NULL`, id, orgID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
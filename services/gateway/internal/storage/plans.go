@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+)
+
+const planColumns = `name, description, max_file_size, monthly_pages, max_storage, ocr, models, created_at, updated_at`
+
+func scanPlan(row rowScanner) (models.Plan, error) {
+	var p models.Plan
+	var list string
+	err := row.Scan(&p.Name, &p.Description, &p.MaxFileSize, &p.MonthlyPages, &p.MaxStorage, &p.OCR, &list, &p.CreatedAt, &p.UpdatedAt)
+	p.Models = []string{}
+	if list != "" {
+		p.Models = strings.Split(list, ",")
+	}
+	return p, err
+}
+
+func (s *sqlStore) ListPlans(ctx context.Context) ([]models.Plan, error) {
+	rows, err := s.query(ctx, `SELECT `+planColumns+` FROM plans ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	plans := []models.Plan{}
+	for rows.Next() {
+		p, err := scanPlan(rows)
+		if err != nil {
+			return nil, err
+		}
+		plans = append(plans, p)
+	}
+	return plans, rows.Err()
+}
+
+func (s *sqlStore) GetPlan(ctx context.Context, name string) (models.Plan, error) {
+	p, err := scanPlan(s.queryRow(ctx, `SELECT `+planColumns+` FROM plans WHERE name = ?`, name))
+	return p, notFound(err)
+}
+
+// PutPlan creates a plan or replaces its limits
+func (s *sqlStore) PutPlan(ctx context.Context, p models.Plan) error {
+	query := `INSERT INTO plans (name, description, max_file_size, monthly_pages, max_storage, ocr, models) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET description = excluded.description, max_file_size = excluded.max_file_size,
+		monthly_pages = excluded.monthly_pages, max_storage = excluded.max_storage, ocr = excluded.ocr, models = excluded.models, updated_at = CURRENT_TIMESTAMP`
+	_, err := s.exec(ctx, query, p.Name, p.Description, p.MaxFileSize, p.MonthlyPages, p.MaxStorage, p.OCR, strings.Join(p.Models, ","))
+	return err
+}
+
+func (s *sqlStore) DeletePlan(ctx context.Context, name string) error {
+	t, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer t.Rollback()
+
+	var used bool
+	query := `SELECT EXISTS (SELECT 1 FROM users WHERE plan = ?) OR EXISTS (SELECT 1 FROM organizations WHERE plan = ?)`
+	if err := t.queryRow(ctx, query, name, name).Scan(&used); err != nil {
+		return err
+	}
+	if used {
+		return ErrNotEmpty
+	}
+	res, err := t.exec(ctx, `DELETE FROM plans WHERE name = ?`, name)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return t.Commit()
+}
+
+func (s *sqlStore) SetUserPlan(ctx context.Context, userID int, plan string) error {
+	return s.setPlan(ctx, `UPDATE users SET plan = ? WHERE id = ? AND deleted_at IS NULL`, plan, userID)
+}
+
+func (s *sqlStore) SetOrgPlan(ctx context.Context, orgID, plan string) error {
+	return s.setPlan(ctx, `UPDATE organizations SET plan = ? WHERE id = ?`, plan, orgID)
+}
+
+// setPlan runs query with the plan and the account's ID, ErrNotFound when there is no such account
+func (s *sqlStore) setPlan(ctx context.Context, query, plan string, id any) error {
+	res, err := s.exec(ctx, query, plan, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) PlanFor(ctx context.Context, userID int, orgID string) (models.Plan, error) {
+	query := `SELECT ` + planColumns + ` FROM plans WHERE name = (SELECT plan FROM users WHERE id = ?)`
+	args := []any{userID}
+	if orgID != "" {
+		query = `SELECT ` + planColumns + ` FROM plans WHERE name = (SELECT plan FROM organizations WHERE id = ?)`
+		args = []any{orgID}
+	}
+	p, err := scanPlan(s.queryRow(ctx, query, args...))
+	return p, notFound(err)
+}
+
+func (s *sqlStore) MonthlyPages(ctx context.Context, userID int, orgID string, now time.Time) (int64, error) {
+	now = now.UTC()
+	from := now.Format("2006-01") + "-01"
+	// an organization's pages are all of its members', a user's own are those outside any
+	query := `SELECT COALESCE(SUM(quantity), 0) FROM usage_daily WHERE day >= ? AND metric = ? AND org_id = ? AND user_id = ?`
+	args := []any{from, models.MetricPages, orgID, userID}
+	if orgID != "" {
+		query = `SELECT COALESCE(SUM(quantity), 0) FROM usage_daily WHERE day >= ? AND metric = ? AND org_id = ?`
+		args = args[:3]
+	}
+	var n int64
+	err := s.queryRow(ctx, query, args...).Scan(&n)
+	return n, err
+}
+
+func (s *sqlStore) StorageUsed(ctx context.Context, userID int, orgID string) (int64, error) {
+	// like storage_bytes, every version counts until it is purged
+	query := `SELECT COALESCE(SUM(v.size), 0) FROM document_versions v JOIN documents d ON d.id = v.document_id
+		WHERE d.user_id = ? AND d.org_id IS NULL`
+	args := []any{userID}
+	if orgID != "" {
+		query = `SELECT COALESCE(SUM(v.size), 0) FROM document_versions v JOIN documents d ON d.id = v.document_id WHERE d.org_id = ?`
+		args = []any{orgID}
+	}
+	var n int64
+	err := s.queryRow(ctx, query, args...).Scan(&n)
+	return n, err
+}
+
+func (s *sqlStore) ReadOnly(ctx context.Context, userID int, orgID string) (bool, error) {
+	query := `SELECT read_only_at IS NOT NULL FROM users WHERE id = ?`
+	args := []any{userID}
+	if orgID != "" {
+		query = `SELECT read_only_at IS NOT NULL FROM organizations WHERE id = ?`
+		args = []any{orgID}
+	}
+	var readOnly bool
+	err := s.queryRow(ctx, query, args...).Scan(&readOnly)
+	return readOnly, notFound(err)
+}
+
+func (s *sqlStore) SetReadOnly(ctx context.Context, userID int, orgID string, readOnly bool) (bool, error) {
+	table, id := "users", any(userID)
+	if orgID != "" {
+		table, id = "organizations", orgID
+	}
+	query := `UPDATE ` + table + ` SET read_only_at = ? WHERE id = ? AND read_only_at IS NULL`
+	args := []any{s.timeArg(time.Now()), id}
+	if !readOnly {
+		query = `UPDATE ` + table + ` SET read_only_at = NULL WHERE id = ? AND read_only_at IS NOT NULL`
+		args = args[1:]
+	}
+	res, err := s.exec(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func (s *sqlStore) ListReadOnly(ctx context.Context) ([]Account, error) {
+	query := `SELECT id, '' FROM users WHERE read_only_at IS NOT NULL AND deleted_at IS NULL
+		UNION ALL SELECT 0, id FROM organizations WHERE read_only_at IS NOT NULL`
+	rows, err := s.query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := []Account{}
+	for rows.Next() {
+		var a Account
+		if err := rows.Scan(&a.UserID, &a.OrgID); err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, a)
+	}
+	return accounts, rows.Err()
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib" // registers the pgx driver
+)
+
+// InitPostgres connects to PostgreSQL and, with autoMigrate, applies pending migrations.
+// Same tables as SQLite, so several gateway replicas can share one database.
+func InitPostgres(url string, autoMigrate bool) Store {
+	db, err := openPostgres(url)
+	if err != nil {
+		log.Fatalf("Failed to connect to PostgreSQL: %v\n", err)
+	}
+	if err := migrate(db, dialectPostgres, autoMigrate); err != nil {
+		log.Fatalln("Failed to migrate PostgreSQL database:", err)
+	}
+
+	log.Println("Connected to PostgreSQL & Migrated Tables")
+	return &sqlStore{db: db, dialect: dialectPostgres, isUnique: isPostgresUnique}
+}
+
+func openPostgres(url string) (*sql.DB, error) {
+	db, err := sql.Open("pgx", url)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// upgradeLegacyPostgres adds the columns that used to be added on startup, a database last
+// opened by an older gateway may still miss some of them. 0001 takes it from there.
+// ADD COLUMN IF NOT EXISTS still fails on a missing table, hence the DO block.
+func upgradeLegacyPostgres(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `
+	DO $$
+	BEGIN
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS is_admin BOOLEAN NOT NULL DEFAULT FALSE;
+		IF to_regclass('documents') IS NOT NULL THEN
+			ALTER TABLE documents ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+			ALTER TABLE documents ADD COLUMN IF NOT EXISTS purged_at TIMESTAMPTZ;
+			ALTER TABLE documents ADD COLUMN IF NOT EXISTS sha256 TEXT NOT NULL DEFAULT '';
+			ALTER TABLE documents ADD COLUMN IF NOT EXISTS scan_status TEXT NOT NULL DEFAULT '';
+			ALTER TABLE documents ADD COLUMN IF NOT EXISTS scan_result TEXT NOT NULL DEFAULT '';
+			ALTER TABLE documents ADD COLUMN IF NOT EXISTS scanned_at TIMESTAMPTZ;
+		END IF;
+		IF to_regclass('documents') IS NOT NULL AND to_regclass('organizations') IS NOT NULL THEN
+			ALTER TABLE documents ADD COLUMN IF NOT EXISTS org_id TEXT REFERENCES organizations(id);
+		END IF;
+		IF to_regclass('jobs') IS NOT NULL THEN
+			ALTER TABLE jobs ADD COLUMN IF NOT EXISTS options TEXT NOT NULL DEFAULT '';
+		END IF;
+		IF to_regclass('upload_sessions') IS NOT NULL THEN
+			ALTER TABLE upload_sessions ADD COLUMN IF NOT EXISTS org_id TEXT REFERENCES organizations(id);
+			ALTER TABLE upload_sessions ADD COLUMN IF NOT EXISTS hash_state BYTEA;
+			ALTER TABLE upload_sessions ADD COLUMN IF NOT EXISTS hashed_parts INTEGER NOT NULL DEFAULT 0;
+		END IF;
+	END $$;`)
+	return err
+}
+
+func isPostgresUnique(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" // unique_violation
+}
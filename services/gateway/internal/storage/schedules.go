@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+)
+
+const scheduleColumns = `id, name, task, cron, params, enabled, next_run_at, last_run_at, last_status, last_result, created_at, updated_at`
+
+func scanSchedule(row rowScanner) (models.Schedule, error) {
+	var sch models.Schedule
+	var params string
+	var nextRun, lastRun sql.NullTime
+	err := row.Scan(&sch.ID, &sch.Name, &sch.Task, &sch.Cron, &params, &sch.Enabled, &nextRun, &lastRun,
+		&sch.LastStatus, &sch.LastResult, &sch.CreatedAt, &sch.UpdatedAt)
+	if err != nil {
+		return sch, err
+	}
+	sch.Params = []byte(params)
+	if nextRun.Valid {
+		sch.NextRunAt = &nextRun.Time
+	}
+	if lastRun.Valid {
+		sch.LastRunAt = &lastRun.Time
+	}
+	return sch, nil
+}
+
+// scheduleTime is the next run as the column stores it, nil stays NULL
+func (s *sqlStore) scheduleTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return s.timeArg(*t)
+}
+
+func scheduleParams(sch models.Schedule) string {
+	if len(sch.Params) == 0 {
+		return "{}"
+	}
+	return string(sch.Params)
+}
+
+func (s *sqlStore) CreateSchedule(ctx context.Context, sch models.Schedule) error {
+	query := `INSERT INTO schedules (id, name, task, cron, params, enabled, next_run_at) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	_, err := s.exec(ctx, query, sch.ID, sch.Name, sch.Task, sch.Cron, scheduleParams(sch), sch.Enabled, s.scheduleTime(sch.NextRunAt))
+	return err
+}
+
+func (s *sqlStore) GetSchedule(ctx context.Context, id string) (models.Schedule, error) {
+	sch, err := scanSchedule(s.queryRow(ctx, `SELECT `+scheduleColumns+` FROM schedules WHERE id = ?`, id))
+	return sch, notFound(err)
+}
+
+func (s *sqlStore) listSchedules(ctx context.Context, query string, args ...any) ([]models.Schedule, error) {
+	rows, err := s.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedules := []models.Schedule{}
+	for rows.Next() {
+		sch, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, sch)
+	}
+	return schedules, rows.Err()
+}
+
+func (s *sqlStore) ListSchedules(ctx context.Context) ([]models.Schedule, error) {
+	return s.listSchedules(ctx, `SELECT `+scheduleColumns+` FROM schedules ORDER BY created_at, id`)
+}
+
+// ListDueSchedules returns enabled schedules whose next run is at or before now, the most overdue first
+func (s *sqlStore) ListDueSchedules(ctx context.Context, now time.Time, limit int) ([]models.Schedule, error) {
+	query := `SELECT ` + scheduleColumns + ` FROM schedules
+		WHERE enabled = ? AND next_run_at IS NOT NULL AND next_run_at <= ? ORDER BY next_run_at LIMIT ?`
+	return s.listSchedules(ctx, query, true, s.timeArg(now), limit)
+}
+
+// UpdateSchedule saves what an admin can change about a schedule
+func (s *sqlStore) UpdateSchedule(ctx context.Context, sch models.Schedule) error {
+	query := `UPDATE schedules SET name = ?, cron = ?, params = ?, enabled = ?, next_run_at = ?,
+		updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	res, err := s.exec(ctx, query, sch.Name, sch.Cron, scheduleParams(sch), sch.Enabled, s.scheduleTime(sch.NextRunAt), sch.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) DeleteSchedule(ctx context.Context, id string) error {
+	res, err := s.exec(ctx, `DELETE FROM schedules WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ClaimScheduleRun moves a due schedule on to its next run and marks it running. Only the
+// caller that moves it gets true, the others see it isn't due anymore.
+func (s *sqlStore) ClaimScheduleRun(ctx context.Context, id string, now, next time.Time) (bool, error) {
+	query := `UPDATE schedules SET next_run_at = ?, last_run_at = ?, last_status = ?, last_result = ''
+		WHERE id = ? AND enabled = ? AND next_run_at IS NOT NULL AND next_run_at <= ?`
+	res, err := s.exec(ctx, query, s.timeArg(next), s.timeArg(now), models.ScheduleStatusRunning, id, true, s.timeArg(now))
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n == 1, nil
+}
+
+// StartScheduleRun marks a run started by hand, the next scheduled run stays where it is
+func (s *sqlStore) StartScheduleRun(ctx context.Context, id string, now time.Time) error {
+	query := `UPDATE schedules SET last_run_at = ?, last_status = ?, last_result = '' WHERE id = ?`
+	res, err := s.exec(ctx, query, s.timeArg(now), models.ScheduleStatusRunning, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) FinishScheduleRun(ctx context.Context, id, status, result string) error {
+	_, err := s.exec(ctx, `UPDATE schedules SET last_status = ?, last_result = ? WHERE id = ?`, status, result, id)
+	return err
+}
@@ -0,0 +1,192 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+)
+
+const savedSearchColumns = `id, user_id, name, query, filters, notify, created_at, updated_at`
+
+// encodeFilters stores no filters as "", like encodeOptions
+func encodeFilters(filters models.SearchFilters) (string, error) {
+	raw, err := json.Marshal(filters)
+	if err != nil || string(raw) == "{}" {
+		return "", err
+	}
+	return string(raw), nil
+}
+
+func decodeFilters(raw string, filters *models.SearchFilters) error {
+	if raw == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(raw), filters)
+}
+
+func scanSavedSearch(row rowScanner) (models.SavedSearch, error) {
+	var search models.SavedSearch
+	var filters, notify string
+	err := row.Scan(&search.ID, &search.UserID, &search.Name, &search.Query, &filters, &notify, &search.CreatedAt, &search.UpdatedAt)
+	if err != nil {
+		return search, err
+	}
+	search.Notify = []string{}
+	if notify != "" {
+		search.Notify = strings.Split(notify, ",")
+	}
+	return search, decodeFilters(filters, &search.Filters)
+}
+
+func (s *sqlStore) listSavedSearches(ctx context.Context, query string, args ...any) ([]models.SavedSearch, error) {
+	rows, err := s.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	searches := []models.SavedSearch{}
+	for rows.Next() {
+		search, err := scanSavedSearch(rows)
+		if err != nil {
+			return nil, err
+		}
+		searches = append(searches, search)
+	}
+	return searches, rows.Err()
+}
+
+// RecordSearch adds a query to userID's history and forgets all but their keep newest
+func (s *sqlStore) RecordSearch(ctx context.Context, userID int, query string, filters models.SearchFilters, keep int) error {
+	raw, err := encodeFilters(filters)
+	if err != nil {
+		return err
+	}
+	t, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer t.Rollback()
+
+	if _, err := t.exec(ctx, `INSERT INTO search_history (user_id, query, filters) VALUES (?, ?, ?)`, userID, query, raw); err != nil {
+		return err
+	}
+	prune := `DELETE FROM search_history WHERE user_id = ? AND id NOT IN
+		(SELECT id FROM search_history WHERE user_id = ? ORDER BY id DESC LIMIT ?)`
+	if _, err := t.exec(ctx, prune, userID, userID, keep); err != nil {
+		return err
+	}
+	return t.Commit()
+}
+
+// ListRecentSearches returns userID's history, the newest first
+func (s *sqlStore) ListRecentSearches(ctx context.Context, userID int) ([]models.RecentSearch, error) {
+	rows, err := s.query(ctx, `SELECT id, query, filters, created_at FROM search_history WHERE user_id = ? ORDER BY id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recent := []models.RecentSearch{}
+	for rows.Next() {
+		var r models.RecentSearch
+		var filters string
+		if err := rows.Scan(&r.ID, &r.Query, &filters, &r.SearchedAt); err != nil {
+			return nil, err
+		}
+		if err := decodeFilters(filters, &r.Filters); err != nil {
+			return nil, err
+		}
+		recent = append(recent, r)
+	}
+	return recent, rows.Err()
+}
+
+func (s *sqlStore) ClearSearchHistory(ctx context.Context, userID int) error {
+	_, err := s.exec(ctx, `DELETE FROM search_history WHERE user_id = ?`, userID)
+	return err
+}
+
+// CreateSavedSearch returns ErrDuplicate when the user already has a search by that name
+func (s *sqlStore) CreateSavedSearch(ctx context.Context, search models.SavedSearch) error {
+	filters, err := encodeFilters(search.Filters)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO saved_searches (id, user_id, name, query, filters, notify) VALUES (?, ?, ?, ?, ?, ?)`
+	_, err = s.exec(ctx, query, search.ID, search.UserID, search.Name, search.Query, filters, strings.Join(search.Notify, ","))
+	if err != nil && s.isUnique(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (s *sqlStore) GetSavedSearch(ctx context.Context, id string, userID int) (models.SavedSearch, error) {
+	query := `SELECT ` + savedSearchColumns + ` FROM saved_searches WHERE id = ? AND user_id = ?`
+	search, err := scanSavedSearch(s.queryRow(ctx, query, id, userID))
+	return search, notFound(err)
+}
+
+// ListSavedSearches returns userID's saved searches by name
+func (s *sqlStore) ListSavedSearches(ctx context.Context, userID int) ([]models.SavedSearch, error) {
+	return s.listSavedSearches(ctx, `SELECT `+savedSearchColumns+` FROM saved_searches WHERE user_id = ? ORDER BY name, id`, userID)
+}
+
+// UpdateSavedSearch saves the name, query, filters and notify of an existing search, ErrDuplicate
+// when it was renamed to another of the user's
+func (s *sqlStore) UpdateSavedSearch(ctx context.Context, search models.SavedSearch) error {
+	filters, err := encodeFilters(search.Filters)
+	if err != nil {
+		return err
+	}
+	query := `UPDATE saved_searches SET name = ?, query = ?, filters = ?, notify = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND user_id = ?`
+	res, err := s.exec(ctx, query, search.Name, search.Query, filters, strings.Join(search.Notify, ","), search.ID, search.UserID)
+	if err != nil {
+		if s.isUnique(err) {
+			return ErrDuplicate
+		}
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) DeleteSavedSearch(ctx context.Context, id string, userID int) error {
+	res, err := s.exec(ctx, `DELETE FROM saved_searches WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListAlertingSearches returns the saved searches with alerts on that may match a document of
+// userID's, or of orgID's when it is set: those of the uploader, and of every member for an
+// organization's document
+func (s *sqlStore) ListAlertingSearches(ctx context.Context, userID int, orgID string) ([]models.SavedSearch, error) {
+	query := `SELECT ` + savedSearchColumns + ` FROM saved_searches WHERE notify <> '' AND user_id = ? ORDER BY created_at, id`
+	args := []any{userID}
+	if orgID != "" {
+		query = `SELECT ` + savedSearchColumns + ` FROM saved_searches WHERE notify <> ''
+			AND user_id IN (SELECT user_id FROM org_members WHERE org_id = ?) ORDER BY created_at, id`
+		args = []any{orgID}
+	}
+	return s.listSavedSearches(ctx, query, args...)
+}
+
+// ClaimSearchAlert records that a saved search alerted on a document, reporting false when it already had
+func (s *sqlStore) ClaimSearchAlert(ctx context.Context, searchID, documentID string) (bool, error) {
+	query := `INSERT INTO saved_search_alerts (saved_search_id, document_id) VALUES (?, ?) ON CONFLICT (saved_search_id, document_id) DO NOTHING`
+	res, err := s.exec(ctx, query, searchID, documentID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
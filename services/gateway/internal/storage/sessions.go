@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+)
+
+func (s *sqlStore) CreateSession(ctx context.Context, session models.Session, tokenHash string) error {
+	t, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer t.Rollback()
+
+	now := time.Now().UTC()
+	query := `INSERT INTO sessions (id, user_id, user_agent, ip, created_at, last_used_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	if _, err := t.exec(ctx, query, session.ID, session.UserID, session.UserAgent, session.IP, now, now, session.ExpiresAt.UTC()); err != nil {
+		return err
+	}
+	query = `INSERT INTO refresh_tokens (user_id, token_hash, family_id, expires_at) VALUES (?, ?, ?, ?)`
+	if _, err := t.exec(ctx, query, session.UserID, tokenHash, session.ID, session.ExpiresAt.UTC()); err != nil {
+		return err
+	}
+	// expired sessions can't be refreshed and their access tokens ran out long ago
+	if _, err := t.exec(ctx, `DELETE FROM sessions WHERE user_id = ? AND expires_at < ?`, session.UserID, now); err != nil {
+		return err
+	}
+	return t.Commit()
+}
+
+func (s *sqlStore) ListSessions(ctx context.Context, userID int) ([]models.Session, error) {
+	query := `SELECT id, user_id, user_agent, ip, created_at, last_used_at, expires_at FROM sessions
+		WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ? ORDER BY last_used_at DESC`
+	rows, err := s.query(ctx, query, userID, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var session models.Session
+		err := rows.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func (s *sqlStore) RevokeSession(ctx context.Context, id string, userID int) error {
+	t, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer t.Rollback()
+
+	n, err := endSessions(ctx, t, time.Now().UTC(), userID, id, "")
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return t.Commit()
+}
+
+func (s *sqlStore) RevokeAllSessions(ctx context.Context, userID int, keep string) (int, error) {
+	t, err := s.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer t.Rollback()
+
+	n, err := endSessions(ctx, t, time.Now().UTC(), userID, "", keep)
+	if err != nil {
+		return 0, err
+	}
+	return n, t.Commit()
+}
+
+// endSessions logs out userID's session id, or all of them but keep when id is "", and revokes
+// their refresh tokens. It returns how many live sessions there were.
+func endSessions(ctx context.Context, t *tx, now time.Time, userID int, id, keep string) (int, error) {
+	sessions := `UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ?`
+	tokens := `UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`
+	args := []any{now, userID, now}
+	tokenArgs := []any{now, userID}
+	if id != "" {
+		sessions += ` AND id = ?`
+		tokens += ` AND family_id = ?`
+		args = append(args, id)
+		tokenArgs = append(tokenArgs, id)
+	}
+	if keep != "" {
+		sessions += ` AND id <> ?`
+		tokens += ` AND family_id <> ?`
+		args = append(args, keep)
+		tokenArgs = append(tokenArgs, keep)
+	}
+
+	res, err := t.exec(ctx, sessions, args...)
+	if err != nil {
+		return 0, err
+	}
+	// families from before sessions have no row, their tokens are revoked all the same
+	if _, err := t.exec(ctx, tokens, tokenArgs...); err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
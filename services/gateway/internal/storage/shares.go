@@ -0,0 +1,234 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+)
+
+// sharedTree is a CTE of the collections shared with a user and every collection under them,
+// it takes the user's ID
+const sharedTree = `WITH RECURSIVE shared_tree (id) AS (
+		SELECT collection_id FROM shares WHERE user_id = ? AND collection_id IS NOT NULL
+		UNION SELECT c.id FROM collections c JOIN shared_tree ON c.parent_id = shared_tree.id
+	) `
+
+// sharedWith matches the documents shared with a user, on their own or filed somewhere in
+// sharedTree, it takes the user's ID again
+const sharedWith = `(id IN (SELECT document_id FROM shares WHERE user_id = ? AND document_id IS NOT NULL) OR collection_id IN (SELECT id FROM shared_tree))`
+
+const shareColumns = `s.id, s.document_id, s.collection_id, s.user_id, u.email, s.permission, s.created_by, s.created_at`
+
+func scanShare(row rowScanner) (models.Share, error) {
+	var share models.Share
+	var documentID, collectionID sql.NullString
+	err := row.Scan(&share.ID, &documentID, &collectionID, &share.UserID, &share.Email, &share.Permission, &share.CreatedBy, &share.CreatedAt)
+	share.DocumentID = documentID.String
+	share.CollectionID = collectionID.String
+	return share, err
+}
+
+// SaveShare shares a document or collection with share.UserID, or changes the permission of the
+// share they already have on it. It returns the share as stored.
+func (s *sqlStore) SaveShare(ctx context.Context, share models.Share) (models.Share, error) {
+	query := `UPDATE shares SET permission = ? WHERE user_id = ? AND (document_id = ? OR collection_id = ?)`
+	res, err := s.exec(ctx, query, share.Permission, share.UserID, share.DocumentID, share.CollectionID)
+	if err != nil {
+		return share, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		query = `INSERT INTO shares (id, document_id, collection_id, user_id, permission, created_by) VALUES (?, ?, ?, ?, ?, ?)`
+		_, err = s.exec(ctx, query, share.ID, nullString(share.DocumentID), nullString(share.CollectionID), share.UserID, share.Permission, share.CreatedBy)
+		if err != nil && !s.isUnique(err) {
+			return share, err
+		}
+		// on a unique violation another request shared it at the same time, theirs stands
+	}
+	query = `SELECT ` + shareColumns + ` FROM shares s JOIN users u ON u.id = s.user_id
+		WHERE s.user_id = ? AND (s.document_id = ? OR s.collection_id = ?)`
+	saved, err := scanShare(s.queryRow(ctx, query, share.UserID, share.DocumentID, share.CollectionID))
+	return saved, notFound(err)
+}
+
+func (s *sqlStore) GetShare(ctx context.Context, id string) (models.Share, error) {
+	query := `SELECT ` + shareColumns + ` FROM shares s JOIN users u ON u.id = s.user_id WHERE s.id = ?`
+	share, err := scanShare(s.queryRow(ctx, query, id))
+	return share, notFound(err)
+}
+
+// ListShares returns who a document or collection is shared with, whichever ID isn't empty
+func (s *sqlStore) ListShares(ctx context.Context, documentID, collectionID string) ([]models.Share, error) {
+	query := `SELECT ` + shareColumns + ` FROM shares s JOIN users u ON u.id = s.user_id
+		WHERE s.document_id = ? OR s.collection_id = ? ORDER BY s.created_at, s.id`
+	return s.listShares(ctx, query, documentID, collectionID)
+}
+
+// ListReceivedShares returns what was shared with userID, leaving out documents in the trash
+func (s *sqlStore) ListReceivedShares(ctx context.Context, userID int) ([]models.Share, error) {
+	query := `SELECT ` + shareColumns + ` FROM shares s JOIN users u ON u.id = s.user_id
+		WHERE s.user_id = ? AND (s.collection_id IS NOT NULL OR s.document_id IN (SELECT id FROM documents WHERE deleted_at IS NULL))
+		ORDER BY s.created_at DESC, s.id`
+	return s.listShares(ctx, query, userID)
+}
+
+func (s *sqlStore) listShares(ctx context.Context, query string, args ...any) ([]models.Share, error) {
+	rows, err := s.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shares := []models.Share{}
+	for rows.Next() {
+		share, err := scanShare(rows)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+	return shares, rows.Err()
+}
+
+func (s *sqlStore) DeleteShare(ctx context.Context, id string) error {
+	res, err := s.exec(ctx, `DELETE FROM shares WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetReadableDocument finds live documents userID can see the way GetDocument does, or because
+// they were shared with them. Those have SharedPermission set.
+func (s *sqlStore) GetReadableDocument(ctx context.Context, id string, userID int) (models.Document, error) {
+	doc, err := s.GetDocument(ctx, id, userID)
+	if !errors.Is(err, ErrNotFound) {
+		return doc, err
+	}
+	doc, err = scanDocument(s.queryRow(ctx, `SELECT `+documentColumns+` FROM documents WHERE id = ? AND deleted_at IS NULL`, id))
+	if err != nil {
+		return doc, notFound(err)
+	}
+	if doc.SharedPermission, err = s.sharePermission(ctx, userID, doc.ID, doc.CollectionID); err != nil {
+		return models.Document{}, err
+	}
+	docs := []models.Document{doc}
+	err = s.loadTags(ctx, docs)
+	return docs[0], err
+}
+
+// GetReadableCollection is GetReadableDocument for collections
+func (s *sqlStore) GetReadableCollection(ctx context.Context, id string, userID int) (models.Collection, error) {
+	col, err := s.GetCollection(ctx, id, userID)
+	if !errors.Is(err, ErrNotFound) {
+		return col, err
+	}
+	if col, err = s.GetCollectionByID(ctx, id); err != nil {
+		return col, err
+	}
+	if col.SharedPermission, err = s.sharePermission(ctx, userID, "", col.ID); err != nil {
+		return models.Collection{}, err
+	}
+	return col, nil
+}
+
+// sharePermission is what userID was given on a document or a collection, directly or on one of
+// the collection's parents, ErrNotFound when it wasn't shared with them. "comment" sorts before
+// "read", the stronger permission wins.
+func (s *sqlStore) sharePermission(ctx context.Context, userID int, documentID, collectionID string) (string, error) {
+	query := `WITH RECURSIVE ancestors (id, parent_id) AS (
+			SELECT id, parent_id FROM collections WHERE id = ?
+			UNION ALL SELECT c.id, c.parent_id FROM collections c JOIN ancestors a ON c.id = a.parent_id
+		)
+		SELECT permission FROM shares WHERE user_id = ? AND (document_id = ? OR collection_id IN (SELECT id FROM ancestors))
+		ORDER BY permission LIMIT 1`
+	var permission string
+	err := s.queryRow(ctx, query, collectionID, userID, documentID).Scan(&permission)
+	return permission, notFound(err)
+}
+
+// ListSharedDocumentIDs returns up to limit live documents shared with userID, on their own or
+// through a collection, by ID
+func (s *sqlStore) ListSharedDocumentIDs(ctx context.Context, userID int, limit int) ([]string, error) {
+	query := sharedTree + `SELECT id FROM documents WHERE ` + sharedWith + ` AND deleted_at IS NULL ORDER BY id LIMIT ?`
+	rows, err := s.query(ctx, query, userID, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+const shareLinkColumns = `id, document_id, collection_id, password_hash, expires_at, created_by, created_at`
+
+func scanShareLink(row rowScanner) (models.ShareLink, error) {
+	var link models.ShareLink
+	var documentID, collectionID sql.NullString
+	err := row.Scan(&link.ID, &documentID, &collectionID, &link.PasswordHash, &link.ExpiresAt, &link.CreatedBy, &link.CreatedAt)
+	link.DocumentID = documentID.String
+	link.CollectionID = collectionID.String
+	link.HasPassword = link.PasswordHash != ""
+	return link, err
+}
+
+func (s *sqlStore) CreateShareLink(ctx context.Context, link models.ShareLink, tokenHash string) error {
+	query := `INSERT INTO share_links (id, token_hash, document_id, collection_id, password_hash, expires_at, created_by) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	_, err := s.exec(ctx, query, link.ID, tokenHash, nullString(link.DocumentID), nullString(link.CollectionID), link.PasswordHash, s.timeArg(link.ExpiresAt), link.CreatedBy)
+	return err
+}
+
+// GetShareLinkByHash returns expired links too, the caller tells them apart
+func (s *sqlStore) GetShareLinkByHash(ctx context.Context, tokenHash string) (models.ShareLink, error) {
+	link, err := scanShareLink(s.queryRow(ctx, `SELECT `+shareLinkColumns+` FROM share_links WHERE token_hash = ?`, tokenHash))
+	return link, notFound(err)
+}
+
+func (s *sqlStore) GetShareLink(ctx context.Context, id string) (models.ShareLink, error) {
+	link, err := scanShareLink(s.queryRow(ctx, `SELECT `+shareLinkColumns+` FROM share_links WHERE id = ?`, id))
+	return link, notFound(err)
+}
+
+// ListShareLinks returns the links to a document or collection, whichever ID isn't empty, the
+// expired ones included
+func (s *sqlStore) ListShareLinks(ctx context.Context, documentID, collectionID string) ([]models.ShareLink, error) {
+	query := `SELECT ` + shareLinkColumns + ` FROM share_links WHERE document_id = ? OR collection_id = ? ORDER BY created_at, id`
+	rows, err := s.query(ctx, query, documentID, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []models.ShareLink{}
+	for rows.Next() {
+		link, err := scanShareLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+func (s *sqlStore) DeleteShareLink(ctx context.Context, id string) error {
+	res, err := s.exec(ctx, `DELETE FROM share_links WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -1,44 +1,116 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 
-	_ "github.com/mattn/go-sqlite3" // Import the driver anonymously
+	"github.com/mattn/go-sqlite3"
 )
 
-func InitSQLite() *sql.DB {
-	// SQLite stores the database in a file 
-	if _, err := os.Stat("./data"); os.IsNotExist(err) {
-		os.Mkdir("./data", 0755) // 0755 are linux permissions 
-	}
+// sqliteDriver is sqlite3 with the functions the queries need on every connection
+const sqliteDriver = "sqlite3_docstream"
+
+func init() {
+	sql.Register(sqliteDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			// keyword search ranks with it, FTS4 only hands out the statistics
+			return conn.RegisterFunc("bm25", bm25, true)
+		},
+	})
+}
 
-	// opening the connection
-	// ./data/auth.db is where the database is stored 
-	db, err := sql.Open("sqlite3", "./data/auth.db")
+// InitSQLite opens (or creates) the database file at path and, with autoMigrate, applies pending migrations
+func InitSQLite(path string, autoMigrate bool) Store {
+	db, err := openSQLite(path)
 	if err != nil {
 		log.Fatalf("Failed to open SQLite database: %v\n", err)
 	}
+	if err := migrate(db, dialectSQLite, autoMigrate); err != nil {
+		log.Fatalln("Failed to migrate SQLite database:", err)
+	}
+
+	log.Println("Connected to SQLite & Migrated Tables")
+	return &sqlStore{db: db, dialect: dialectSQLite, isUnique: isSQLiteUnique}
+}
 
-	// Enable Foreign Keys (SQLite defaults to OFF)
-	if _, err := db.Exec("PRAGMA foreign_keys = ON;"); err != nil {
-		log.Fatal(err)
+func openSQLite(path string) (*sql.DB, error) {
+	// SQLite stores the database in a file
+	dir := filepath.Dir(path)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		os.MkdirAll(dir, 0755) // 0755 are linux permissions
 	}
 
-	// Create the Users Table
-	query := `
-	CREATE TABLE IF NOT EXISTS users (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		email TEXT NOT NULL UNIQUE,
-		password TEXT NOT NULL,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	);`
+	// Foreign keys are per connection in SQLite (and default to OFF), so they go in the DSN.
+	// busy_timeout makes concurrent writers wait instead of failing with "database is locked".
+	return sql.Open(sqliteDriver, "file:"+path+"?_foreign_keys=on&_busy_timeout=5000")
+}
 
-	if _, err := db.Exec(query); err != nil {
-		log.Fatal("Failed to create users table:", err)
+// upgradeLegacySQLite adds the columns that used to be added on startup, a database last
+// opened by an older gateway may still miss some of them. 0001 takes it from there.
+func upgradeLegacySQLite(ctx context.Context, conn *sql.Conn) error {
+	columns := []struct{ table, column, definition string }{
+		{"users", "is_admin", "BOOLEAN NOT NULL DEFAULT 0"},
+		{"jobs", "document_id", "TEXT REFERENCES documents(id)"},
+		{"jobs", "options", "TEXT NOT NULL DEFAULT ''"},
+		{"documents", "deleted_at", "DATETIME"},
+		{"documents", "purged_at", "DATETIME"},
+		{"documents", "org_id", "TEXT REFERENCES organizations(id)"},
+		{"documents", "sha256", "TEXT NOT NULL DEFAULT ''"},
+		{"documents", "scan_status", "TEXT NOT NULL DEFAULT ''"},
+		{"documents", "scan_result", "TEXT NOT NULL DEFAULT ''"},
+		{"documents", "scanned_at", "DATETIME"},
+		{"upload_sessions", "org_id", "TEXT REFERENCES organizations(id)"},
+		{"upload_sessions", "hash_state", "BLOB"},
+		{"upload_sessions", "hashed_parts", "INTEGER NOT NULL DEFAULT 0"},
+	}
+	for _, c := range columns {
+		if err := addColumnIfMissing(ctx, conn, c.table, c.column, c.definition); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	log.Println("Connected to SQLite & Migrated Tables")
-	return db
-}
\ No newline at end of file
+func isSQLiteUnique(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
+
+// addColumnIfMissing adds column unless table already has it, or doesn't exist at all yet
+func addColumnIfMissing(ctx context.Context, conn *sql.Conn, table, column, definition string) error {
+	rows, err := conn.QueryContext(ctx, "PRAGMA table_info("+table+")")
+	if err != nil {
+		return fmt.Errorf("inspecting %s table: %w", table, err)
+	}
+	defer rows.Close()
+
+	exists := false
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return fmt.Errorf("inspecting %s table: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+		exists = true
+	}
+	rows.Close()
+	// a table that was never created comes out of 0001 complete
+	if !exists {
+		return nil
+	}
+
+	if _, err := conn.ExecContext(ctx, "ALTER TABLE "+table+" ADD COLUMN "+column+" "+definition); err != nil {
+		return fmt.Errorf("adding %s.%s: %w", table, column, err)
+	}
+	log.Printf("Added column %s.%s\n", table, column)
+	return nil
+}
@@ -0,0 +1,670 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+)
+
+var (
+	// ErrNotFound is returned when a row doesn't exist (or isn't visible to the caller)
+	ErrNotFound = errors.New("not found")
+	// ErrDuplicate is returned when a unique constraint is hit
+	ErrDuplicate = errors.New("already exists")
+	// ErrNotEmpty is returned when deleting something that still has things in it
+	ErrNotEmpty = errors.New("not empty")
+	// ErrTokenReused is returned when an already rotated refresh token is presented again
+	ErrTokenReused = errors.New("refresh token reused")
+	// ErrTokenExpired is returned for refresh tokens past their expiry
+	ErrTokenExpired = errors.New("refresh token expired")
+	// ErrSessionRevoked is returned for refresh tokens of a session that was logged out
+	ErrSessionRevoked = errors.New("session revoked")
+	// ErrLegalHold is returned when deleting a document that is under legal hold
+	ErrLegalHold = errors.New("under legal hold")
+	// ErrSuspended is returned when suspending an account that is suspended already
+	ErrSuspended = errors.New("suspended")
+)
+
+// Store is everything the gateway persists. There is one SQL implementation
+// shared by SQLite and PostgreSQL, only the schema and placeholders differ.
+type Store interface {
+	UserStore
+	TokenStore
+	JobStore
+	DocumentStore
+	UploadStore
+	WebhookStore
+	APIKeyStore
+	AuditStore
+	OrgStore
+	CollectionStore
+	BatchStore
+	InboxStore
+	ConnectorStore
+	ScheduleStore
+	ExportStore
+	QuotaStore
+	StatsStore
+	KeywordStore
+	SearchStore
+	ChatStore
+	ModelStore
+	PlanStore
+	SubscriptionStore
+	EmbeddingStore
+	UsageStore
+	ShareStore
+	AnnotationStore
+	DigestStore
+
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+type UserStore interface {
+	// CreateUser returns the new user's ID, or ErrDuplicate if the email is taken
+	CreateUser(ctx context.Context, email, passwordHash string) (int, error)
+	GetUserByEmail(ctx context.Context, email string) (models.User, error)
+	GetUserByID(ctx context.Context, id int) (models.User, error)
+	// UpdateProfile saves what PATCH /me changes, ErrNotFound when the user is gone
+	UpdateProfile(ctx context.Context, user models.User) error
+	UpdatePassword(ctx context.Context, userID int, passwordHash string) error
+	// DeleteAccount anonymizes the user, ends their sessions and API keys, removes what they set up
+	// and moves their documents to the trash for the purge_accounts schedule. auditPolicy is one of
+	// the config.DeletionAudit* values. ErrNotFound when the user is gone or deleted already.
+	DeleteAccount(ctx context.Context, userID int, auditPolicy string) (models.AccountDeletion, error)
+	// ListDeletedAccounts returns deleted users whose data hasn't been purged yet, the earliest deleted
+	// first. Those with nothing left but documents under legal hold aren't listed.
+	ListDeletedAccounts(ctx context.Context, limit int) ([]models.User, error)
+	// FinishAccountPurge marks a deleted account purged, reporting false while documents of it
+	// that ListAccountDocuments would return, or that are under legal hold, are left
+	FinishAccountPurge(ctx context.Context, userID int) (bool, error)
+	// ListUsers pages through every user by ID, deleted ones included, for admins
+	ListUsers(ctx context.Context, filter UserFilter) ([]models.User, error)
+	// SuspendUser stops a user from signing in and ends their sessions, returning how many there
+	// were. ErrNotFound when the user is gone or deleted, ErrSuspended when suspended already.
+	SuspendUser(ctx context.Context, userID int, reason string) (int, error)
+	// ReactivateUser lifts a suspension, ErrNotFound unless the user is suspended
+	ReactivateUser(ctx context.Context, userID int) error
+}
+
+type TokenStore interface {
+	// CreateSession records a login along with the first refresh token of its family, the
+	// session's ID is the family ID
+	CreateSession(ctx context.Context, session models.Session, tokenHash string) error
+	// RotateRefreshToken revokes oldHash and stores newHash in the same family, returning the owner
+	// and the session. A revoked oldHash ends the session and returns ErrTokenReused, or
+	// ErrSessionRevoked when the session had been logged out already.
+	RotateRefreshToken(ctx context.Context, oldHash, newHash string, expiresAt time.Time) (int, string, error)
+	// RevokeRefreshToken ends the session tokenHash belongs to, doing nothing if it isn't userID's
+	RevokeRefreshToken(ctx context.Context, userID int, tokenHash string) error
+	// ListSessions returns userID's sessions that are neither logged out nor expired, the latest used first
+	ListSessions(ctx context.Context, userID int) ([]models.Session, error)
+	// RevokeSession logs a session out, ErrNotFound when it isn't userID's or has ended already
+	RevokeSession(ctx context.Context, id string, userID int) error
+	// RevokeAllSessions logs every session of userID out but keep, "" for none, returning how many there were
+	RevokeAllSessions(ctx context.Context, userID int, keep string) (int, error)
+	// RevokeAccessToken puts an access token's ID on the denylist until the token would have expired anyway
+	RevokeAccessToken(ctx context.Context, tokenID string, userID int, expiresAt time.Time) error
+	// IsAccessTokenRevoked reports whether the token was revoked or the session it belongs to
+	// logged out, sessionID is "" for tokens from before sessions
+	IsAccessTokenRevoked(ctx context.Context, tokenID, sessionID string) (bool, error)
+}
+
+type JobStore interface {
+	CreateJob(ctx context.Context, job models.Job) error
+	GetJob(ctx context.Context, id string, userID int) (models.Job, error)
+	// GetJobByID skips the ownership check, for internal callers like the results consumer
+	GetJobByID(ctx context.Context, id string) (models.Job, error)
+	ListJobs(ctx context.Context, filter JobFilter) ([]models.Job, error)
+	// UpdateJobStatus moves a job and its document to a new status, reporting whether anything changed.
+	// completed, failed and cancelled are final, later updates to such a job are ignored.
+	UpdateJobStatus(ctx context.Context, id, status, errMsg string) (bool, error)
+	// SetDocumentLanguage records the language the worker detected on the job's document
+	SetDocumentLanguage(ctx context.Context, jobID, language string) error
+	// SetDocumentClass records the class the worker labelled the job's document with
+	SetDocumentClass(ctx context.Context, jobID, class string) error
+	// SetDocumentEntities replaces the entities of the job's document with what the job found
+	SetDocumentEntities(ctx context.Context, jobID string, entities []models.Entity) error
+	// SetDocumentSummary records the summary and key points the worker wrote for the job's document
+	SetDocumentSummary(ctx context.Context, jobID, summary string, keyPoints []string) error
+	// RecordJobStage notes that a stage of the job completed or failed. A stage reported again
+	// keeps its row and takes the new status, unknown jobs are ignored.
+	RecordJobStage(ctx context.Context, jobID, stage, status, errMsg string) error
+	// ListJobStages returns the stages the worker reported for a job, in the order they first were
+	ListJobStages(ctx context.Context, jobID string) ([]models.JobStage, error)
+	// RequeueJob puts a job back to queued whatever its status, for manual retries out of the dead letter queue
+	RequeueJob(ctx context.Context, id string) error
+	GetLatestJobForDocument(ctx context.Context, documentID string) (models.Job, error)
+	// HasCompletedJob reports whether a job of the document completed into the vector collection,
+	// "" being the worker's configured one
+	HasCompletedJob(ctx context.Context, documentID, collection string) (bool, error)
+}
+
+type DocumentStore interface {
+	// CreateDocument stores the document as its first version and records the upload in the audit log
+	CreateDocument(ctx context.Context, doc models.Document) error
+	// GetDocument finds documents userID uploaded or can see through one of their organizations
+	GetDocument(ctx context.Context, id string, userID int) (models.Document, error)
+	// ListDocumentEntities returns what the worker found in a document, most mentioned first by type
+	ListDocumentEntities(ctx context.Context, documentID string) ([]models.Entity, error)
+	// FindDocumentByHash returns ErrNotFound unless the user already has this content in the same org (or outside any)
+	FindDocumentByHash(ctx context.Context, userID int, orgID, sha256 string) (models.Document, error)
+	// ListDocuments pages through a user's documents with keyset pagination, see DocumentFilter
+	ListDocuments(ctx context.Context, filter DocumentFilter) ([]models.Document, error)
+	// GetDeletedDocument finds a document in the trash, soft-deleted but not purged, that userID can see
+	GetDeletedDocument(ctx context.Context, id string, userID int) (models.Document, error)
+	// SoftDeleteDocument hides a document from the API, the object stays until it is purged.
+	// It only checks that userID can see the document, whether they may delete it is up to the caller.
+	// ErrLegalHold when the document is under legal hold.
+	SoftDeleteDocument(ctx context.Context, id string, userID int) (models.Document, error)
+	// RestoreDocument takes a document deleted after deletedAfter out of the trash, ErrNotFound
+	// when it isn't there or was deleted earlier than that
+	RestoreDocument(ctx context.Context, id string, deletedAfter time.Time) error
+	// ListPurgeableDocuments returns soft-deleted documents deleted at or before the cutoff that still need
+	// purging, leaving out those under legal hold
+	ListPurgeableDocuments(ctx context.Context, deletedBefore time.Time, limit int) ([]models.Document, error)
+	MarkDocumentPurged(ctx context.Context, id string) error
+	// ListExpiredDocuments returns an organization's live documents created at or before the cutoff,
+	// for its retention rule. Documents under legal hold are left out.
+	ListExpiredDocuments(ctx context.Context, orgID string, createdBefore time.Time, limit int) ([]models.Document, error)
+	// ListAccountDocuments returns the documents of a deleted account that still need purging, in the
+	// trash or not: personal ones and those of organizations it was the last member of. Those under
+	// legal hold are left out, once it is lifted they are listed too.
+	ListAccountDocuments(ctx context.Context, userID, limit int) ([]models.Document, error)
+	// SetLegalHold puts a document that isn't purged yet under legal hold or lifts it, in the trash or not
+	SetLegalHold(ctx context.Context, id string, hold bool) error
+	// SetDocumentScan records a virus scan outcome, one of the models.ScanStatus* values
+	SetDocumentScan(ctx context.Context, id, status, result string) error
+	// QuarantineDocument points the row at the quarantined copy of its object
+	QuarantineDocument(ctx context.Context, id, objectKey string) error
+	// UpdateDocumentMetadata replaces a live document's tags and metadata, ErrNotFound once it's deleted
+	UpdateDocumentMetadata(ctx context.Context, id string, tags []string, metadata map[string]string) error
+	// MoveDocument files a live document in a collection, "" takes it out again. ErrNotFound once it's deleted.
+	MoveDocument(ctx context.Context, id, collectionID string) error
+	// AddDocumentVersion records a new upload of a live document's content and makes it the
+	// current version, returning its number. ErrNotFound once the document is deleted.
+	AddDocumentVersion(ctx context.Context, version models.DocumentVersion) (int, error)
+	// ListDocumentVersions returns every version of a document, the newest first
+	ListDocumentVersions(ctx context.Context, documentID string) ([]models.DocumentVersion, error)
+	// RestoreDocumentVersion makes an older version of a live document the current one again,
+	// ErrNotFound when either doesn't exist
+	RestoreDocumentVersion(ctx context.Context, documentID string, version int) (models.DocumentVersion, error)
+	// ListDocumentsToReembed returns live documents that were never queued with the embedding
+	// model and have no job running, the oldest first
+	ListDocumentsToReembed(ctx context.Context, model string, limit int) ([]models.Document, error)
+}
+
+type UploadStore interface {
+	CreateUploadSession(ctx context.Context, session models.UploadSession) error
+	GetUploadSession(ctx context.Context, id string, userID int) (models.UploadSession, error)
+	UpdateUploadSession(ctx context.Context, id, status, documentID string) error
+	// ClaimUploadSession moves a session from in progress to completed, only one caller gets true
+	ClaimUploadSession(ctx context.Context, id string) (bool, error)
+	// SaveUploadHash stores the running content hash, see UploadSession.HashState
+	SaveUploadHash(ctx context.Context, sessionID string, hashedParts int, state []byte) error
+	// SaveUploadPart records a part, re-sending a part number replaces it
+	SaveUploadPart(ctx context.Context, sessionID string, part models.UploadPart) error
+	// ListUploadParts returns the parts ordered by part number
+	ListUploadParts(ctx context.Context, sessionID string) ([]models.UploadPart, error)
+	DeleteUploadParts(ctx context.Context, sessionID string) error
+	// ListOpenUploadSessions returns userID's sessions still in progress
+	ListOpenUploadSessions(ctx context.Context, userID int) ([]models.UploadSession, error)
+	// ListExpiredUploadSessions returns up to limit direct uploads whose URL expired before, ended
+	// ones too until ClearUploadExpiry
+	ListExpiredUploadSessions(ctx context.Context, before time.Time, limit int) ([]models.UploadSession, error)
+	ClearUploadExpiry(ctx context.Context, id string) error
+}
+
+type WebhookStore interface {
+	CreateWebhook(ctx context.Context, hook models.Webhook) error
+	ListWebhooks(ctx context.Context, userID int) ([]models.Webhook, error)
+	// ListWebhooksForEvent returns the user's webhooks subscribed to event, secrets included
+	ListWebhooksForEvent(ctx context.Context, userID int, event string) ([]models.Webhook, error)
+	DeleteWebhook(ctx context.Context, id string, userID int) error
+}
+
+type APIKeyStore interface {
+	CreateAPIKey(ctx context.Context, key models.APIKey, keyHash string) error
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (models.APIKey, error)
+	ListAPIKeys(ctx context.Context, userID int) ([]models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, id string, userID int) error
+	// TouchAPIKey records that a key was just used
+	TouchAPIKey(ctx context.Context, id string) error
+}
+
+type AuditStore interface {
+	CreateAuditEntry(ctx context.Context, entry models.AuditEntry) error
+	// ListActivity returns the audit entries about a document or an organization, newest first
+	ListActivity(ctx context.Context, filter ActivityFilter) ([]models.Activity, error)
+	// GetLoginThrottle returns ErrNotFound when the key has no recent failures
+	GetLoginThrottle(ctx context.Context, key string) (models.LoginThrottle, error)
+	SaveLoginThrottle(ctx context.Context, t models.LoginThrottle) error
+	ClearLoginThrottle(ctx context.Context, key string) error
+}
+
+type OrgStore interface {
+	// CreateOrg stores the organization with ownerID as its first owner
+	CreateOrg(ctx context.Context, org models.Organization, ownerID int) error
+	// ListOrgs returns the organizations userID belongs to, with their role filled in
+	ListOrgs(ctx context.Context, userID int) ([]models.Organization, error)
+	GetOrg(ctx context.Context, id string) (models.Organization, error)
+	// SetOrgRetention changes how many days the organization keeps documents, nil keeps them forever
+	SetOrgRetention(ctx context.Context, id string, days *int) error
+	// ListOrgsWithRetention returns the organizations that have a retention rule
+	ListOrgsWithRetention(ctx context.Context) ([]models.Organization, error)
+	// GetMembership returns ErrNotFound when userID isn't in the organization
+	GetMembership(ctx context.Context, orgID string, userID int) (models.Membership, error)
+	ListMembers(ctx context.Context, orgID string) ([]models.Membership, error)
+	UpdateMemberRole(ctx context.Context, orgID string, userID int, role string) error
+	RemoveMember(ctx context.Context, orgID string, userID int) error
+
+	CreateInvitation(ctx context.Context, inv models.Invitation) error
+	// ListOrgInvitations returns the organization's pending invitations
+	ListOrgInvitations(ctx context.Context, orgID string) ([]models.Invitation, error)
+	// ListInvitationsForEmail returns the pending invitations addressed to email
+	ListInvitationsForEmail(ctx context.Context, email string) ([]models.Invitation, error)
+	GetInvitation(ctx context.Context, id string) (models.Invitation, error)
+	// AcceptInvitation adds userID to the invitation's organization, ErrDuplicate if they were already in it
+	AcceptInvitation(ctx context.Context, inv models.Invitation, userID int) error
+	DeleteInvitation(ctx context.Context, id, orgID string) error
+}
+
+type CollectionStore interface {
+	CreateCollection(ctx context.Context, col models.Collection) error
+	// GetCollection finds collections userID created or can see through one of their organizations
+	GetCollection(ctx context.Context, id string, userID int) (models.Collection, error)
+	// GetCollectionByID skips the visibility check, for walking up to a collection's parents
+	GetCollectionByID(ctx context.Context, id string) (models.Collection, error)
+	// ListCollections returns every personal collection of userID, or every one of the organization's
+	ListCollections(ctx context.Context, userID int, orgID string) ([]models.Collection, error)
+	UpdateCollection(ctx context.Context, col models.Collection) error
+	// DeleteCollection returns ErrNotEmpty while documents or other collections are still in it
+	DeleteCollection(ctx context.Context, id string) error
+	// ListCollectionDocumentIDs returns up to limit live documents in a collection or any of its
+	// sub-collections, by ID
+	ListCollectionDocumentIDs(ctx context.Context, id string, limit int) ([]string, error)
+	// ListCollectionDocuments is ListCollectionDocumentIDs with the documents, by filename
+	ListCollectionDocuments(ctx context.Context, id string, limit int) ([]models.Document, error)
+	// InCollection reports whether a live document is in a collection or any of its sub-collections
+	InCollection(ctx context.Context, documentID, collectionID string) (bool, error)
+}
+
+type BatchStore interface {
+	CreateBatch(ctx context.Context, batch models.Batch) error
+	AddBatchItem(ctx context.Context, batchID string, item models.BatchItem) error
+	// GetBatch returns the batch with its items, each with the current status of its job
+	GetBatch(ctx context.Context, id string, userID int) (models.Batch, error)
+}
+
+type InboxStore interface {
+	GetInbox(ctx context.Context, userID int) (models.Inbox, error)
+	GetInboxByToken(ctx context.Context, token string) (models.Inbox, error)
+	// SetInboxToken creates the user's inbox or replaces its token, the old address stops working
+	SetInboxToken(ctx context.Context, userID int, token string) error
+}
+
+type ConnectorStore interface {
+	CreateConnector(ctx context.Context, conn models.Connector) error
+	GetConnector(ctx context.Context, id string, userID int) (models.Connector, error)
+	// GetConnectorByState finds the connector being linked with an OAuth state
+	GetConnectorByState(ctx context.Context, state string) (models.Connector, error)
+	ListConnectors(ctx context.Context, userID int) ([]models.Connector, error)
+	ListDueConnectors(ctx context.Context, syncedBefore time.Time, limit int) ([]models.Connector, error)
+	UpdateConnector(ctx context.Context, conn models.Connector) error
+	// ClaimConnectorSync reports whether this caller gets to sync the connector now
+	ClaimConnectorSync(ctx context.Context, id string, syncedBefore time.Time) (bool, error)
+	DeleteConnector(ctx context.Context, id string, userID int) error
+	GetConnectorFile(ctx context.Context, connectorID, remoteID string) (models.ConnectorFile, error)
+	SaveConnectorFile(ctx context.Context, f models.ConnectorFile) error
+}
+
+type ScheduleStore interface {
+	CreateSchedule(ctx context.Context, sch models.Schedule) error
+	GetSchedule(ctx context.Context, id string) (models.Schedule, error)
+	ListSchedules(ctx context.Context) ([]models.Schedule, error)
+	ListDueSchedules(ctx context.Context, now time.Time, limit int) ([]models.Schedule, error)
+	UpdateSchedule(ctx context.Context, sch models.Schedule) error
+	DeleteSchedule(ctx context.Context, id string) error
+	// ClaimScheduleRun reports whether this caller gets to run the due schedule, moving it on to next
+	ClaimScheduleRun(ctx context.Context, id string, now, next time.Time) (bool, error)
+	StartScheduleRun(ctx context.Context, id string, now time.Time) error
+	FinishScheduleRun(ctx context.Context, id, status, result string) error
+}
+
+type ExportStore interface {
+	CreateExport(ctx context.Context, exp models.Export) error
+	GetExport(ctx context.Context, id string, userID int) (models.Export, error)
+	// ListExports returns userID's exports, the newest first
+	ListExports(ctx context.Context, userID int) ([]models.Export, error)
+	// ListPendingExports returns exports waiting to be built, and those whose build started at
+	// or before staleBefore and never finished, the oldest first
+	ListPendingExports(ctx context.Context, staleBefore time.Time, limit int) ([]models.Export, error)
+	// ClaimExport marks a pending or stalled export running, reporting whether this caller got it
+	ClaimExport(ctx context.Context, id string, staleBefore time.Time) (bool, error)
+	// FinishExport saves the status, object, size, error, finished_at and expires_at of exp,
+	// ErrNotFound when the export was removed in the meantime
+	FinishExport(ctx context.Context, exp models.Export) error
+	// ListExpiredExports returns completed exports whose zip expired at or before now
+	ListExpiredExports(ctx context.Context, now time.Time, limit int) ([]models.Export, error)
+	// DeleteExports removes userID's exports, their zips are up to the caller
+	DeleteExports(ctx context.Context, userID int) error
+	// ListUploadedDocuments pages through the live documents userID uploaded anywhere, by ID
+	// after afterID, "" to start
+	ListUploadedDocuments(ctx context.Context, userID int, afterID string, limit int) ([]models.Document, error)
+}
+
+type QuotaStore interface {
+	// GetQuota returns ErrNotFound when the user has no overrides
+	GetQuota(ctx context.Context, userID int) (models.Quota, error)
+	// SetQuota creates or replaces a user's overrides
+	SetQuota(ctx context.Context, q models.Quota) error
+	// DeleteQuota puts a user back on the configured limits, ErrNotFound when they had no overrides
+	DeleteQuota(ctx context.Context, userID int) error
+}
+
+// ModelStore is the allowlist of models callers may pick per request
+type ModelStore interface {
+	ListAllowedModels(ctx context.Context, kind string) ([]models.AllowedModel, error)
+	// GetAllowedModel returns ErrNotFound for a model that isn't allowed
+	GetAllowedModel(ctx context.Context, kind, name string) (models.AllowedModel, error)
+	PutAllowedModel(ctx context.Context, m models.AllowedModel) error
+	DeleteAllowedModel(ctx context.Context, kind, name string) error
+}
+
+// PlanStore keeps the plans and which one each user and organization is on
+type PlanStore interface {
+	ListPlans(ctx context.Context) ([]models.Plan, error)
+	GetPlan(ctx context.Context, name string) (models.Plan, error)
+	PutPlan(ctx context.Context, p models.Plan) error
+	// DeletePlan returns ErrNotEmpty while users or organizations are still on the plan
+	DeletePlan(ctx context.Context, name string) error
+	// SetUserPlan and SetOrgPlan don't check the plan exists, ErrNotFound is for the account
+	SetUserPlan(ctx context.Context, userID int, plan string) error
+	SetOrgPlan(ctx context.Context, orgID, plan string) error
+	// PlanFor returns the plan of orgID, or of userID when it is ""
+	PlanFor(ctx context.Context, userID int, orgID string) (models.Plan, error)
+	// MonthlyPages is how many pages were processed in now's month (UTC): every member's in
+	// orgID, or userID's outside of organizations when it is ""
+	MonthlyPages(ctx context.Context, userID int, orgID string, now time.Time) (int64, error)
+	// StorageUsed is what the stored versions of the documents of orgID, or of userID outside
+	// of organizations when it is "", take up in bytes
+	StorageUsed(ctx context.Context, userID int, orgID string) (int64, error)
+	// ReadOnly reports whether the account of orgID, or of userID when it is "", is read-only
+	ReadOnly(ctx context.Context, userID int, orgID string) (bool, error)
+	// SetReadOnly puts the account in read-only or takes it out, reporting whether that changed anything
+	SetReadOnly(ctx context.Context, userID int, orgID string, readOnly bool) (bool, error)
+	ListReadOnly(ctx context.Context) ([]Account, error)
+}
+
+// Account is a user's own account, or an organization's with OrgID
+type Account struct {
+	UserID int
+	OrgID  string
+}
+
+// SubscriptionStore keeps the Stripe subscriptions plans were bought with
+type SubscriptionStore interface {
+	// PutSubscription records a subscription or updates it from a newer event, reporting false
+	// when the stored one came from a newer event than sub's
+	PutSubscription(ctx context.Context, sub models.Subscription) (bool, error)
+	GetSubscription(ctx context.Context, id string) (models.Subscription, error)
+	// GetAccountSubscription returns the latest subscription of orgID, or of userID's own account
+	// when it is "", whatever its status
+	GetAccountSubscription(ctx context.Context, userID int, orgID string) (models.Subscription, error)
+}
+
+// EmbeddingStore keeps the embedding migrations, moving the corpus to another model and vector collection
+type EmbeddingStore interface {
+	// CreateEmbeddingMigration returns ErrDuplicate while another one runs or when the collection was used before
+	CreateEmbeddingMigration(ctx context.Context, m models.EmbeddingMigration) error
+	GetEmbeddingMigration(ctx context.Context, id string) (models.EmbeddingMigration, error)
+	// ListEmbeddingMigrations returns every migration, the newest first
+	ListEmbeddingMigrations(ctx context.Context) ([]models.EmbeddingMigration, error)
+	// CurrentEmbeddingMigration is the one that completed last, ErrNotFound while none did
+	CurrentEmbeddingMigration(ctx context.Context) (models.EmbeddingMigration, error)
+	// RunningEmbeddingMigration returns ErrNotFound while none runs
+	RunningEmbeddingMigration(ctx context.Context) (models.EmbeddingMigration, error)
+	// EmbeddingProgress counts the live documents by whether their latest job indexed into collection
+	EmbeddingProgress(ctx context.Context, collection string) (models.EmbeddingProgress, error)
+	// ListDocumentsToMigrate returns live documents without a job under way whose latest job didn't index into collection
+	ListDocumentsToMigrate(ctx context.Context, collection string, limit int) ([]models.Document, error)
+	// UpdateEmbeddingMigration, SwitchEmbeddingMigration and CancelEmbeddingMigration return
+	// ErrNotFound for a migration that isn't running
+	UpdateEmbeddingMigration(ctx context.Context, id string, p models.EmbeddingProgress, message string) error
+	SwitchEmbeddingMigration(ctx context.Context, id string, p models.EmbeddingProgress, message string) error
+	CancelEmbeddingMigration(ctx context.Context, id string) error
+}
+
+// UsageStore keeps what users consumed a day at a time. Usage is always added to the current
+// day (UTC), so the days before it are closed and can be billed.
+type UsageStore interface {
+	// AddUsage adds to userID's counters for today in orgID, "" for their own documents
+	AddUsage(ctx context.Context, userID int, orgID string, usage models.Usage) error
+	// AddJobUsage is AddUsage for the owner of the job's document, in its organization.
+	// Jobs of anonymous uploads aren't metered.
+	AddJobUsage(ctx context.Context, jobID string, usage models.Usage) error
+	// RecordStorageUsage takes the bytes every user's versions of documents hold now, keeping
+	// the day's peak, and returns how many users and organizations hold any
+	RecordStorageUsage(ctx context.Context) (int, error)
+	// ListUsage returns the days UsageFilter picks, the oldest first
+	ListUsage(ctx context.Context, filter UsageFilter) ([]models.UsageDay, error)
+	// ListUnreportedUsage returns days before the given one that weren't reported yet, the oldest first
+	ListUnreportedUsage(ctx context.Context, before string, limit int) ([]models.UsageDay, error)
+	// MarkUsageReported notes that a day was sent to billing
+	MarkUsageReported(ctx context.Context, day models.UsageDay) error
+}
+
+// ShareStore keeps what users shared, with other users or as public links. Shares let someone
+// read, and annotate with comment, what they may change is still up to the document's organization.
+type ShareStore interface {
+	// SaveShare shares a document or collection with share.UserID, changing the permission when
+	// it already is, and returns the share as stored
+	SaveShare(ctx context.Context, share models.Share) (models.Share, error)
+	GetShare(ctx context.Context, id string) (models.Share, error)
+	// ListShares returns the shares of a document or a collection, whichever ID isn't empty
+	ListShares(ctx context.Context, documentID, collectionID string) ([]models.Share, error)
+	// ListReceivedShares returns what was shared with userID, newest first
+	ListReceivedShares(ctx context.Context, userID int) ([]models.Share, error)
+	DeleteShare(ctx context.Context, id string) error
+	// GetReadableDocument finds live documents userID can see through GetDocument's rule or a
+	// share, the document's own or one of a collection it is in. Shared ones have SharedPermission set.
+	GetReadableDocument(ctx context.Context, id string, userID int) (models.Document, error)
+	// GetReadableCollection is GetReadableDocument for collections
+	GetReadableCollection(ctx context.Context, id string, userID int) (models.Collection, error)
+	// ListSharedDocumentIDs returns up to limit live documents shared with userID, by ID
+	ListSharedDocumentIDs(ctx context.Context, userID int, limit int) ([]string, error)
+
+	CreateShareLink(ctx context.Context, link models.ShareLink, tokenHash string) error
+	// GetShareLinkByHash returns expired links too
+	GetShareLinkByHash(ctx context.Context, tokenHash string) (models.ShareLink, error)
+	GetShareLink(ctx context.Context, id string) (models.ShareLink, error)
+	ListShareLinks(ctx context.Context, documentID, collectionID string) ([]models.ShareLink, error)
+	DeleteShareLink(ctx context.Context, id string) error
+}
+
+// AnnotationStore keeps the highlights and comments on documents, searchable by their words
+type AnnotationStore interface {
+	CreateAnnotation(ctx context.Context, a models.Annotation) error
+	GetAnnotation(ctx context.Context, id string) (models.Annotation, error)
+	// ListAnnotations returns a document's annotations by where they start, only those of kind unless it is empty
+	ListAnnotations(ctx context.Context, documentID, kind string) ([]models.Annotation, error)
+	// UpdateAnnotation changes the body, ErrNotFound when there is no such annotation
+	UpdateAnnotation(ctx context.Context, id, body string) error
+	DeleteAnnotation(ctx context.Context, id string) error
+	// SearchAnnotations returns the limit annotations on live documents that match any of terms
+	// best, best first. filter narrows their documents down the way it does SearchChunks'.
+	SearchAnnotations(ctx context.Context, terms []string, filter ChunkFilter, limit int) ([]models.AnnotationMatch, error)
+}
+
+// DigestStore holds the finished jobs waiting for their uploaders' daily digests
+type DigestStore interface {
+	// AddDigestItem queues a finished job, once however often it is added
+	AddDigestItem(ctx context.Context, item models.DigestItem) error
+	// ListDigestUsers returns up to limit users with jobs waiting, by ID from past afterID
+	ListDigestUsers(ctx context.Context, afterID, limit int) ([]int, error)
+	// ListDigestItems returns the jobs waiting for a user's digest, the oldest first
+	ListDigestItems(ctx context.Context, userID int) ([]models.DigestItem, error)
+	// DeleteDigestItems removes a user's jobs up to and including throughID, the ones a digest went out with
+	DeleteDigestItems(ctx context.Context, userID, throughID int) error
+}
+
+// KeywordStore is the keyword index in the database, chunk text ranked by BM25 in SQLite and
+// by ts_rank in Postgres
+type KeywordStore interface {
+	// IndexChunks writes chunks of a document that jobID made, replacing those with the same index
+	IndexChunks(ctx context.Context, documentID, jobID string, chunks []models.Chunk) error
+	// DeleteStaleChunks removes a document's chunks that weren't written by jobID and those of
+	// jobID's past its last chunk
+	DeleteStaleChunks(ctx context.Context, documentID, jobID string, chunks int) error
+	// DeleteJobChunks removes the chunks jobID wrote for a document, undoing a cancelled job
+	DeleteJobChunks(ctx context.Context, documentID, jobID string) error
+	DeleteDocumentChunks(ctx context.Context, documentID string) error
+	GetChunk(ctx context.Context, documentID string, index int) (models.Chunk, error)
+	ListChunks(ctx context.Context, documentID string) ([]models.Chunk, error)
+	// SearchChunks returns the limit chunks of live documents that match any of terms best, best first
+	SearchChunks(ctx context.Context, terms []string, filter ChunkFilter, limit int) ([]models.ChunkMatch, error)
+}
+
+// SearchStore keeps each user's recent searches and the ones they saved
+type SearchStore interface {
+	// RecordSearch adds a query to userID's history and forgets all but their keep newest
+	RecordSearch(ctx context.Context, userID int, query string, filters models.SearchFilters, keep int) error
+	// ListRecentSearches returns userID's history, the newest first
+	ListRecentSearches(ctx context.Context, userID int) ([]models.RecentSearch, error)
+	ClearSearchHistory(ctx context.Context, userID int) error
+	// CreateSavedSearch returns ErrDuplicate when the user already has a search by that name
+	CreateSavedSearch(ctx context.Context, search models.SavedSearch) error
+	GetSavedSearch(ctx context.Context, id string, userID int) (models.SavedSearch, error)
+	// ListSavedSearches returns userID's saved searches by name
+	ListSavedSearches(ctx context.Context, userID int) ([]models.SavedSearch, error)
+	// UpdateSavedSearch saves the name, query, filters and notify of search, ErrDuplicate when the
+	// name is taken
+	UpdateSavedSearch(ctx context.Context, search models.SavedSearch) error
+	DeleteSavedSearch(ctx context.Context, id string, userID int) error
+	// ListAlertingSearches returns the saved searches with alerts on of userID, or of every member
+	// of orgID when it is set, the oldest first
+	ListAlertingSearches(ctx context.Context, userID int, orgID string) ([]models.SavedSearch, error)
+	// ClaimSearchAlert records that a saved search alerted on a document, false when it already had
+	ClaimSearchAlert(ctx context.Context, searchID, documentID string) (bool, error)
+}
+
+type ChatStore interface {
+	CreateChat(ctx context.Context, chat models.Chat) error
+	// GetChat returns the chat without its messages
+	GetChat(ctx context.Context, id string, userID int) (models.Chat, error)
+	// ListChats returns userID's chats, the one talked to last first
+	ListChats(ctx context.Context, userID int) ([]models.Chat, error)
+	SetChatTitle(ctx context.Context, id, title string) error
+	// DeleteChat takes its messages with it
+	DeleteChat(ctx context.Context, id string, userID int) error
+	// AddChatMessages appends messages to a chat in their order, all of them or none
+	AddChatMessages(ctx context.Context, chatID string, messages []models.ChatMessage) error
+	// ListChatMessages returns the last limit messages of a chat, or all of them with 0, oldest first
+	ListChatMessages(ctx context.Context, chatID string, limit int) ([]models.ChatMessage, error)
+}
+
+type StatsStore interface {
+	// SystemStats counts users, documents, their bytes and jobs across the whole installation
+	SystemStats(ctx context.Context) (models.SystemStats, error)
+}
+
+// ChunkFilter narrows SearchChunks down. A chunk matches when its document is UserID's personal
+// one, belongs to one of OrgIDs or is one of Shared, and (if set) is one of DocumentIDs, carries
+// every one of Tags, mentions every one of Entities and is in one of Languages. A zero UserID
+// leaves personal documents out.
+type ChunkFilter struct {
+	UserID      int
+	OrgIDs      []string
+	Shared      []string
+	DocumentIDs []string
+	Tags        []string
+	Languages   []string
+	Entities    []string // models.EntityKey of each
+}
+
+// ActivityFilter picks the feed of DocumentID, or of OrgID when that is empty. Before is the ID
+// of the last entry of the previous page, 0 for the first one.
+type ActivityFilter struct {
+	DocumentID string
+	OrgID      string
+	Before     int
+	Limit      int
+}
+
+// JobFilter narrows ListJobs down, an empty Status means any status
+type JobFilter struct {
+	UserID int
+	Status string
+	Limit  int
+	Offset int
+}
+
+// UsageFilter narrows ListUsage down to the days From to To, YYYY-MM-DD and both included. With
+// an OrgID it is every member's usage in that organization, otherwise UserID's in all of them.
+type UsageFilter struct {
+	UserID int
+	OrgID  string
+	From   string
+	To     string
+}
+
+// User statuses for UserFilter, active accounts are neither suspended nor deleted
+const (
+	UserStatusActive    = "active"
+	UserStatusSuspended = "suspended"
+	UserStatusDeleted   = "deleted"
+)
+
+// UserFilter narrows ListUsers down, zero values mean "don't filter"
+type UserFilter struct {
+	Email   string // part of the address, any case
+	Status  string // one of the UserStatus* constants
+	AfterID int    // continues from the last user of the previous page
+	Limit   int
+}
+
+// Sort columns for ListDocuments
+const (
+	SortCreatedAt = "created_at"
+	SortFilename  = "filename"
+	SortSize      = "size"
+)
+
+// DocumentFilter narrows ListDocuments down, zero values mean "don't filter".
+// A document has to carry every one of Tags to be listed.
+// Without an OrgID only UserID's personal documents are listed, with one the
+// organization's whole corpus is (checking membership is up to the caller).
+// After continues a listing from the last document of the previous page,
+// it only makes sense with the same Sort and Desc that produced that page.
+type DocumentFilter struct {
+	UserID        int
+	OrgID         string
+	Status        string
+	CollectionID  string // only the documents directly in it, not in its sub-collections
+	ContentType   string
+	Language      string
+	Class         string
+	Entities      []string // models.EntityKey of each, a document has to mention all of them
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	Tags          []string
+	Deleted       bool   // lists the trash instead: soft-deleted documents that aren't purged yet
+	Shared        bool   // lists the documents shared with UserID instead, on their own or through a collection
+	Sort          string // one of the Sort* constants, SortCreatedAt by default
+	Desc          bool
+	Limit         int
+	After         *models.Document
+}
+
+// InitStore opens the database the config picks, SQLite unless the driver is postgres.
+// The URL is the Postgres connection string, or the SQLite file path.
+func InitStore(cfg config.Database) Store {
+	if cfg.IsPostgres() {
+		return InitPostgres(cfg.URL, cfg.AutoMigrate)
+	}
+	return InitSQLite(cfg.URL, cfg.AutoMigrate)
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+)
+
+const subscriptionColumns = `id, customer_id, item_id, user_id, org_id, plan, status, cancel_at_period_end, current_period_end, event_at, created_at, updated_at`
+
+func scanSubscription(row rowScanner) (models.Subscription, error) {
+	var sub models.Subscription
+	var periodEnd sql.NullTime
+	err := row.Scan(&sub.ID, &sub.CustomerID, &sub.ItemID, &sub.UserID, &sub.OrgID, &sub.Plan, &sub.Status,
+		&sub.CancelAtPeriodEnd, &periodEnd, &sub.EventAt, &sub.CreatedAt, &sub.UpdatedAt)
+	if periodEnd.Valid {
+		sub.CurrentPeriodEnd = &periodEnd.Time
+	}
+	return sub, notFound(err)
+}
+
+func (s *sqlStore) PutSubscription(ctx context.Context, sub models.Subscription) (bool, error) {
+	var periodEnd any
+	if sub.CurrentPeriodEnd != nil {
+		periodEnd = s.timeArg(*sub.CurrentPeriodEnd)
+	}
+	// the account a subscription is for never changes, an event about it may only be newer
+	query := `INSERT INTO subscriptions (id, customer_id, item_id, user_id, org_id, plan, status, cancel_at_period_end, current_period_end, event_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET item_id = excluded.item_id, plan = excluded.plan, status = excluded.status,
+		cancel_at_period_end = excluded.cancel_at_period_end, current_period_end = excluded.current_period_end,
+		event_at = excluded.event_at, updated_at = CURRENT_TIMESTAMP
+		WHERE subscriptions.event_at <= excluded.event_at`
+	res, err := s.exec(ctx, query, sub.ID, sub.CustomerID, sub.ItemID, sub.UserID, sub.OrgID, sub.Plan, sub.Status,
+		sub.CancelAtPeriodEnd, periodEnd, sub.EventAt)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func (s *sqlStore) GetSubscription(ctx context.Context, id string) (models.Subscription, error) {
+	return scanSubscription(s.queryRow(ctx, `SELECT `+subscriptionColumns+` FROM subscriptions WHERE id = ?`, id))
+}
+
+func (s *sqlStore) GetAccountSubscription(ctx context.Context, userID int, orgID string) (models.Subscription, error) {
+	query := `SELECT ` + subscriptionColumns + ` FROM subscriptions WHERE user_id = ? AND org_id = '' ORDER BY created_at DESC, id LIMIT 1`
+	args := []any{userID}
+	if orgID != "" {
+		query = `SELECT ` + subscriptionColumns + ` FROM subscriptions WHERE org_id = ? ORDER BY created_at DESC, id LIMIT 1`
+		args = []any{orgID}
+	}
+	return scanSubscription(s.queryRow(ctx, query, args...))
+}
@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+func (s *sqlStore) RotateRefreshToken(ctx context.Context, oldHash, newHash string, expiresAt time.Time) (int, string, error) {
+	t, err := s.begin(ctx)
+	if err != nil {
+		return 0, "", err
+	}
+	defer t.Rollback()
+
+	var id, userID int
+	var familyID string
+	var tokenExpiry time.Time
+	var revokedAt sql.NullTime
+
+	query := `SELECT id, user_id, family_id, expires_at, revoked_at FROM refresh_tokens WHERE token_hash = ?`
+	err = t.queryRow(ctx, query, oldHash).Scan(&id, &userID, &familyID, &tokenExpiry, &revokedAt)
+	if err != nil {
+		return 0, "", notFound(err)
+	}
+
+	now := time.Now().UTC()
+
+	if revokedAt.Valid {
+		// logging a session out revokes all its tokens, presenting one again is no sign of theft
+		var sessionRevokedAt sql.NullTime
+		err := t.queryRow(ctx, `SELECT revoked_at FROM sessions WHERE id = ?`, familyID).Scan(&sessionRevokedAt)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return 0, "", err
+		}
+		if sessionRevokedAt.Valid {
+			return 0, "", ErrSessionRevoked
+		}
+
+		// someone is replaying a token that was already swapped, kill the whole chain
+		if _, err := endSessions(ctx, t, now, userID, familyID, ""); err != nil {
+			return 0, "", err
+		}
+		if err := t.Commit(); err != nil {
+			return 0, "", err
+		}
+		return 0, "", ErrTokenReused
+	}
+	if now.After(tokenExpiry) {
+		return 0, "", ErrTokenExpired
+	}
+
+	// the revoked_at check guards against two requests racing with the same token
+	res, err := t.exec(ctx, `UPDATE refresh_tokens SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`, now, id)
+	if err != nil {
+		return 0, "", err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return 0, "", ErrTokenReused
+	}
+
+	query = `INSERT INTO refresh_tokens (user_id, token_hash, family_id, expires_at) VALUES (?, ?, ?, ?)`
+	if _, err := t.exec(ctx, query, userID, newHash, familyID, expiresAt.UTC()); err != nil {
+		return 0, "", err
+	}
+	query = `UPDATE sessions SET last_used_at = ?, expires_at = ? WHERE id = ?`
+	if _, err := t.exec(ctx, query, now, expiresAt.UTC(), familyID); err != nil {
+		return 0, "", err
+	}
+	return userID, familyID, t.Commit()
+}
+
+func (s *sqlStore) RevokeRefreshToken(ctx context.Context, userID int, tokenHash string) error {
+	var familyID string
+	query := `SELECT family_id FROM refresh_tokens WHERE token_hash = ? AND user_id = ?`
+	if err := s.queryRow(ctx, query, tokenHash, userID).Scan(&familyID); errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	t, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer t.Rollback()
+	if _, err := endSessions(ctx, t, time.Now().UTC(), userID, familyID, ""); err != nil {
+		return err
+	}
+	return t.Commit()
+}
+
+func (s *sqlStore) RevokeAccessToken(ctx context.Context, tokenID string, userID int, expiresAt time.Time) error {
+	now := time.Now().UTC()
+	query := `INSERT INTO revoked_tokens (jti, user_id, expires_at, revoked_at) VALUES (?, ?, ?, ?) ON CONFLICT (jti) DO NOTHING`
+	if _, err := s.exec(ctx, query, tokenID, userID, expiresAt.UTC(), now); err != nil {
+		return err
+	}
+
+	// an expired token is rejected anyway, no need to keep remembering it
+	_, err := s.exec(ctx, `DELETE FROM revoked_tokens WHERE expires_at < ?`, now)
+	return err
+}
+
+// IsAccessTokenRevoked runs on every request, so both checks are one query
+func (s *sqlStore) IsAccessTokenRevoked(ctx context.Context, tokenID, sessionID string) (bool, error) {
+	var n int
+	query := `SELECT (SELECT COUNT(*) FROM revoked_tokens WHERE jti = ?) + (SELECT COUNT(*) FROM sessions WHERE id = ? AND revoked_at IS NOT NULL)`
+	err := s.queryRow(ctx, query, tokenID, sessionID).Scan(&n)
+	return n > 0, err
+}
@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+)
+
+func (s *sqlStore) CreateUploadSession(ctx context.Context, session models.UploadSession) error {
+	metadata, err := encodeMetadata(session.Metadata)
+	if err != nil {
+		return err
+	}
+
+	var expiresAt any
+	if session.ExpiresAt != nil {
+		expiresAt = s.timeArg(*session.ExpiresAt)
+	}
+	query := `INSERT INTO upload_sessions (id, user_id, org_id, collection_id, bucket, object_key, filename, content_type, minio_upload_id, status, tags, metadata, encryption_key, direct, size, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = s.exec(ctx, query, session.ID, session.UserID, nullString(session.OrgID), nullString(session.CollectionID), session.Bucket, session.ObjectKey, session.Filename, session.ContentType, session.MinioUploadID, session.Status,
+		strings.Join(session.Tags, ","), metadata, session.EncryptionKey, session.Direct, session.Size, expiresAt)
+	return err
+}
+
+func (s *sqlStore) GetUploadSession(ctx context.Context, id string, userID int) (models.UploadSession, error) {
+	var session models.UploadSession
+	var documentID, orgID, collectionID sql.NullString
+	var tags, metadata string
+	var expiresAt sql.NullTime
+
+	query := `SELECT id, user_id, bucket, object_key, filename, content_type, minio_upload_id, status, document_id, org_id, collection_id, hash_state, hashed_parts, tags, metadata, encryption_key,
+		direct, size, expires_at FROM upload_sessions WHERE id = ? AND user_id = ?`
+	err := s.queryRow(ctx, query, id, userID).Scan(&session.ID, &session.UserID, &session.Bucket, &session.ObjectKey,
+		&session.Filename, &session.ContentType, &session.MinioUploadID, &session.Status, &documentID, &orgID, &collectionID,
+		&session.HashState, &session.HashedParts, &tags, &metadata, &session.EncryptionKey, &session.Direct, &session.Size, &expiresAt)
+	if err != nil {
+		return session, notFound(err)
+	}
+	if expiresAt.Valid {
+		session.ExpiresAt = &expiresAt.Time
+	}
+	session.DocumentID = documentID.String
+	session.OrgID = orgID.String
+	session.CollectionID = collectionID.String
+	if tags != "" {
+		session.Tags = strings.Split(tags, ",")
+	}
+	if metadata != "" {
+		err = json.Unmarshal([]byte(metadata), &session.Metadata)
+	}
+	return session, err
+}
+
+// ListOpenUploadSessions only fills in what aborting a session takes
+func (s *sqlStore) ListOpenUploadSessions(ctx context.Context, userID int) ([]models.UploadSession, error) {
+	query := `SELECT id, user_id, bucket, object_key, minio_upload_id, status, direct FROM upload_sessions WHERE user_id = ? AND status = ?`
+	return s.listUploadSessions(ctx, query, userID, models.UploadStatusInProgress)
+}
+
+// ListExpiredUploadSessions is ListOpenUploadSessions for the direct uploads of everyone that expired
+// before, whatever their status
+func (s *sqlStore) ListExpiredUploadSessions(ctx context.Context, before time.Time, limit int) ([]models.UploadSession, error) {
+	query := `SELECT id, user_id, bucket, object_key, minio_upload_id, status, direct FROM upload_sessions
+		WHERE direct = ? AND expires_at < ? ORDER BY expires_at LIMIT ?`
+	return s.listUploadSessions(ctx, query, true, s.timeArg(before), limit)
+}
+
+// ClearUploadExpiry takes a session off ListExpiredUploadSessions
+func (s *sqlStore) ClearUploadExpiry(ctx context.Context, id string) error {
+	_, err := s.exec(ctx, `UPDATE upload_sessions SET expires_at = NULL WHERE id = ?`, id)
+	return err
+}
+
+func (s *sqlStore) listUploadSessions(ctx context.Context, query string, args ...any) ([]models.UploadSession, error) {
+	rows, err := s.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.UploadSession{}
+	for rows.Next() {
+		var session models.UploadSession
+		if err := rows.Scan(&session.ID, &session.UserID, &session.Bucket, &session.ObjectKey, &session.MinioUploadID, &session.Status, &session.Direct); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// UpdateUploadSession changes the status, and links the finished document when documentID is set
+func (s *sqlStore) UpdateUploadSession(ctx context.Context, id, status, documentID string) error {
+	if documentID == "" {
+		_, err := s.exec(ctx, `UPDATE upload_sessions SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, status, id)
+		return err
+	}
+	query := `UPDATE upload_sessions SET status = ?, document_id = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	_, err := s.exec(ctx, query, status, documentID, id)
+	return err
+}
+
+// ClaimUploadSession marks a session in progress completed, false when it wasn't in progress any more
+func (s *sqlStore) ClaimUploadSession(ctx context.Context, id string) (bool, error) {
+	query := `UPDATE upload_sessions SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND status = ?`
+	res, err := s.exec(ctx, query, models.UploadStatusCompleted, id, models.UploadStatusInProgress)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *sqlStore) SaveUploadHash(ctx context.Context, sessionID string, hashedParts int, state []byte) error {
+	_, err := s.exec(ctx, `UPDATE upload_sessions SET hashed_parts = ?, hash_state = ? WHERE id = ?`, hashedParts, state, sessionID)
+	return err
+}
+
+func (s *sqlStore) SaveUploadPart(ctx context.Context, sessionID string, part models.UploadPart) error {
+	query := `INSERT INTO upload_parts (session_id, part_number, etag, size) VALUES (?, ?, ?, ?)
+		ON CONFLICT(session_id, part_number) DO UPDATE SET etag = excluded.etag, size = excluded.size`
+	if _, err := s.exec(ctx, query, sessionID, part.PartNumber, part.ETag, part.Size); err != nil {
+		return err
+	}
+	_, err := s.exec(ctx, `UPDATE upload_sessions SET updated_at = CURRENT_TIMESTAMP WHERE id = ?`, sessionID)
+	return err
+}
+
+func (s *sqlStore) ListUploadParts(ctx context.Context, sessionID string) ([]models.UploadPart, error) {
+	rows, err := s.query(ctx, `SELECT part_number, etag, size FROM upload_parts WHERE session_id = ? ORDER BY part_number`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	parts := []models.UploadPart{}
+	for rows.Next() {
+		var p models.UploadPart
+		if err := rows.Scan(&p.PartNumber, &p.ETag, &p.Size); err != nil {
+			return nil, err
+		}
+		parts = append(parts, p)
+	}
+	return parts, rows.Err()
+}
+
+func (s *sqlStore) DeleteUploadParts(ctx context.Context, sessionID string) error {
+	_, err := s.exec(ctx, `DELETE FROM upload_parts WHERE session_id = ?`, sessionID)
+	return err
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+)
+
+// upsertUsage adds to a counter of the day, the values are day, user_id, org_id, metric and quantity
+const upsertUsage = `ON CONFLICT (day, user_id, org_id, metric) DO UPDATE SET quantity = usage_daily.quantity + excluded.quantity`
+
+// today is the day usage is added to
+func today() string {
+	return time.Now().UTC().Format(time.DateOnly)
+}
+
+func (s *sqlStore) AddUsage(ctx context.Context, userID int, orgID string, usage models.Usage) error {
+	t, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer t.Rollback()
+
+	day := today()
+	for metric, n := range usage {
+		if n == 0 {
+			continue
+		}
+		query := `INSERT INTO usage_daily (day, user_id, org_id, metric, quantity) VALUES (?, ?, ?, ?, ?) ` + upsertUsage
+		if _, err := t.exec(ctx, query, day, userID, orgID, metric, n); err != nil {
+			return err
+		}
+	}
+	return t.Commit()
+}
+
+func (s *sqlStore) AddJobUsage(ctx context.Context, jobID string, usage models.Usage) error {
+	t, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer t.Rollback()
+
+	day := today()
+	for metric, n := range usage {
+		if n == 0 {
+			continue
+		}
+		// SQLite needs the WHERE to tell the upsert's ON from a join's
+		query := `INSERT INTO usage_daily (day, user_id, org_id, metric, quantity)
+			SELECT ?, d.user_id, COALESCE(d.org_id, ''), ?, ? FROM jobs j JOIN documents d ON d.id = j.document_id WHERE j.id = ? ` + upsertUsage
+		if _, err := t.exec(ctx, query, day, metric, n, jobID); err != nil {
+			return err
+		}
+	}
+	return t.Commit()
+}
+
+func (s *sqlStore) RecordStorageUsage(ctx context.Context) (int, error) {
+	// every version counts until it is purged, trashed documents included
+	query := `INSERT INTO usage_daily (day, user_id, org_id, metric, quantity)
+		SELECT ?, d.user_id, COALESCE(d.org_id, ''), ?, SUM(v.size) FROM document_versions v JOIN documents d ON d.id = v.document_id
+		WHERE v.size > 0 GROUP BY d.user_id, COALESCE(d.org_id, '')
+		ON CONFLICT (day, user_id, org_id, metric) DO UPDATE
+		SET quantity = CASE WHEN excluded.quantity > usage_daily.quantity THEN excluded.quantity ELSE usage_daily.quantity END`
+	res, err := s.exec(ctx, query, today(), models.MetricStorageBytes)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+func (s *sqlStore) ListUsage(ctx context.Context, filter UsageFilter) ([]models.UsageDay, error) {
+	query := `SELECT day, user_id, org_id, metric, quantity FROM usage_daily WHERE day >= ? AND day <= ?`
+	args := []any{filter.From, filter.To}
+	if filter.OrgID != "" {
+		query += ` AND org_id = ?`
+		args = append(args, filter.OrgID)
+	} else {
+		query += ` AND user_id = ?`
+		args = append(args, filter.UserID)
+	}
+	return s.listUsage(ctx, query+` ORDER BY day, user_id, org_id`, args...)
+}
+
+func (s *sqlStore) ListUnreportedUsage(ctx context.Context, before string, limit int) ([]models.UsageDay, error) {
+	// the limit is on days, a day has a row per metric
+	query := `SELECT u.day, u.user_id, u.org_id, u.metric, u.quantity FROM usage_daily u
+		JOIN (SELECT DISTINCT day, user_id, org_id FROM usage_daily WHERE day < ? AND reported_at IS NULL
+			ORDER BY day, user_id, org_id LIMIT ?) p ON p.day = u.day AND p.user_id = u.user_id AND p.org_id = u.org_id
+		ORDER BY u.day, u.user_id, u.org_id`
+	return s.listUsage(ctx, query, before, limit)
+}
+
+// listUsage gathers the metric rows of query into days, the rows of one day have to come together
+func (s *sqlStore) listUsage(ctx context.Context, query string, args ...any) ([]models.UsageDay, error) {
+	rows, err := s.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := []models.UsageDay{}
+	for rows.Next() {
+		var d models.UsageDay
+		var metric string
+		var n int64
+		if err := rows.Scan(&d.Day, &d.UserID, &d.OrgID, &metric, &n); err != nil {
+			return nil, err
+		}
+		if last := len(days) - 1; last >= 0 && days[last].Day == d.Day && days[last].UserID == d.UserID && days[last].OrgID == d.OrgID {
+			days[last].Usage[metric] = n
+			continue
+		}
+		d.Usage = models.Usage{metric: n}
+		days = append(days, d)
+	}
+	return days, rows.Err()
+}
+
+func (s *sqlStore) MarkUsageReported(ctx context.Context, day models.UsageDay) error {
+	query := `UPDATE usage_daily SET reported_at = ? WHERE day = ? AND user_id = ? AND org_id = ?`
+	_, err := s.exec(ctx, query, s.timeArg(time.Now()), day.Day, day.UserID, day.OrgID)
+	return err
+}
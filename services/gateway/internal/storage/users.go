@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+)
+
+func (s *sqlStore) CreateUser(ctx context.Context, email, passwordHash string) (int, error) {
+	var id int
+	query := `INSERT INTO users (email, password) VALUES (?, ?) RETURNING id`
+	err := s.queryRow(ctx, query, email, passwordHash).Scan(&id)
+	if err != nil && s.isUnique(err) {
+		return 0, ErrDuplicate
+	}
+	return id, err
+}
+
+const userColumns = `id, email, password, is_admin, created_at, display_name, avatar_key, preferences, deleted_at, suspended_at, suspension_reason, plan, read_only_at`
+
+func scanUser(row rowScanner) (models.User, error) {
+	var u models.User
+	var preferences string
+	var deletedAt, suspendedAt, readOnlyAt sql.NullTime
+	err := row.Scan(&u.ID, &u.Email, &u.Password, &u.IsAdmin, &u.CreatedAt, &u.DisplayName, &u.AvatarKey, &preferences, &deletedAt, &suspendedAt, &u.SuspensionReason, &u.Plan, &readOnlyAt)
+	if err != nil {
+		return u, notFound(err)
+	}
+	if deletedAt.Valid {
+		u.DeletedAt = &deletedAt.Time
+	}
+	if suspendedAt.Valid {
+		u.SuspendedAt = &suspendedAt.Time
+	}
+	if readOnlyAt.Valid {
+		u.ReadOnlyAt = &readOnlyAt.Time
+	}
+	if preferences != "" {
+		u.Preferences = &models.Preferences{}
+		if err := json.Unmarshal([]byte(preferences), u.Preferences); err != nil {
+			return u, err
+		}
+	}
+	return u, nil
+}
+
+func (s *sqlStore) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	return scanUser(s.queryRow(ctx, `SELECT `+userColumns+` FROM users WHERE email = ?`, email))
+}
+
+func (s *sqlStore) GetUserByID(ctx context.Context, id int) (models.User, error) {
+	return scanUser(s.queryRow(ctx, `SELECT `+userColumns+` FROM users WHERE id = ?`, id))
+}
+
+// UpdateProfile saves the display name, avatar and preferences of an existing user
+func (s *sqlStore) UpdateProfile(ctx context.Context, user models.User) error {
+	preferences := ""
+	if user.Preferences != nil && *user.Preferences != (models.Preferences{}) {
+		raw, err := json.Marshal(user.Preferences)
+		if err != nil {
+			return err
+		}
+		preferences = string(raw)
+	}
+	query := `UPDATE users SET display_name = ?, avatar_key = ?, preferences = ? WHERE id = ?`
+	res, err := s.exec(ctx, query, user.DisplayName, user.AvatarKey, preferences, user.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) UpdatePassword(ctx context.Context, userID int, passwordHash string) error {
+	res, err := s.exec(ctx, `UPDATE users SET password = ? WHERE id = ?`, passwordHash, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) ListUsers(ctx context.Context, filter UserFilter) ([]models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE id > ?`
+	args := []any{filter.AfterID}
+	if filter.Email != "" {
+		query += ` AND LOWER(email) LIKE ?`
+		args = append(args, "%"+strings.ToLower(filter.Email)+"%")
+	}
+	switch filter.Status {
+	case UserStatusActive:
+		query += ` AND deleted_at IS NULL AND suspended_at IS NULL`
+	case UserStatusSuspended:
+		query += ` AND deleted_at IS NULL AND suspended_at IS NOT NULL`
+	case UserStatusDeleted:
+		query += ` AND deleted_at IS NOT NULL`
+	}
+	query += ` ORDER BY id LIMIT ?`
+	args = append(args, filter.Limit)
+
+	rows, err := s.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// SuspendUser ends the sessions along with setting suspended_at, so access tokens already
+// handed out stop working at once instead of when they expire
+func (s *sqlStore) SuspendUser(ctx context.Context, userID int, reason string) (int, error) {
+	t, err := s.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer t.Rollback()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	query := `UPDATE users SET suspended_at = ?, suspension_reason = ? WHERE id = ? AND deleted_at IS NULL AND suspended_at IS NULL`
+	res, err := t.exec(ctx, query, now, reason, userID)
+	if err != nil {
+		return 0, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		var suspended bool
+		if err := t.queryRow(ctx, `SELECT suspended_at IS NOT NULL FROM users WHERE id = ? AND deleted_at IS NULL`, userID).Scan(&suspended); err != nil {
+			return 0, notFound(err)
+		}
+		return 0, ErrSuspended
+	}
+	sessions, err := endSessions(ctx, t, now, userID, "", "")
+	if err != nil {
+		return 0, err
+	}
+	return sessions, t.Commit()
+}
+
+func (s *sqlStore) ReactivateUser(ctx context.Context, userID int) error {
+	query := `UPDATE users SET suspended_at = NULL, suspension_reason = '' WHERE id = ? AND deleted_at IS NULL AND suspended_at IS NOT NULL`
+	res, err := s.exec(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
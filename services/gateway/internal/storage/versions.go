@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+)
+
+const versionColumns = `document_id, version, object_key, filename, content_type, size, sha256, encryption_key, user_id, created_at`
+
+func scanVersion(row rowScanner) (models.DocumentVersion, error) {
+	var v models.DocumentVersion
+	err := row.Scan(&v.DocumentID, &v.Version, &v.ObjectKey, &v.Filename, &v.ContentType, &v.Size, &v.SHA256, &v.EncryptionKey, &v.UserID, &v.CreatedAt)
+	return v, err
+}
+
+// versionOf is the version a document's current upload makes
+func versionOf(doc models.Document, version int) models.DocumentVersion {
+	return models.DocumentVersion{
+		DocumentID:    doc.ID,
+		Version:       version,
+		ObjectKey:     doc.ObjectKey,
+		Filename:      doc.Filename,
+		ContentType:   doc.ContentType,
+		Size:          doc.Size,
+		SHA256:        doc.SHA256,
+		EncryptionKey: doc.EncryptionKey,
+		UserID:        doc.UserID,
+	}
+}
+
+func (t *tx) insertVersion(ctx context.Context, v models.DocumentVersion) error {
+	query := `INSERT INTO document_versions (document_id, version, object_key, filename, content_type, size, sha256, encryption_key, user_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := t.exec(ctx, query, v.DocumentID, v.Version, v.ObjectKey, v.Filename, v.ContentType, v.Size, v.SHA256, v.EncryptionKey, v.UserID)
+	return err
+}
+
+// makeCurrent points the document at v. The language, class, entities and summary are the worker's
+// to find out again.
+func (t *tx) makeCurrent(ctx context.Context, v models.DocumentVersion) error {
+	query := `UPDATE documents SET object_key = ?, filename = ?, content_type = ?, size = ?, sha256 = ?, encryption_key = ?,
+		version = ?, language = '', class = '', summary = '', key_points = '', updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND deleted_at IS NULL`
+	res, err := t.exec(ctx, query, v.ObjectKey, v.Filename, v.ContentType, v.Size, v.SHA256, v.EncryptionKey, v.Version, v.DocumentID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	_, err = t.exec(ctx, `DELETE FROM document_entities WHERE document_id = ?`, v.DocumentID)
+	return err
+}
+
+// AddDocumentVersion numbers the version after the highest one so far. Two uploads racing
+// for the same number collide on the primary key and the loser gets ErrDuplicate.
+func (s *sqlStore) AddDocumentVersion(ctx context.Context, v models.DocumentVersion) (int, error) {
+	t, err := s.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer t.Rollback()
+
+	err = t.queryRow(ctx, `SELECT COALESCE(MAX(version), 0) + 1 FROM document_versions WHERE document_id = ?`, v.DocumentID).Scan(&v.Version)
+	if err != nil {
+		return 0, err
+	}
+	if err := t.makeCurrent(ctx, v); err != nil {
+		return 0, err
+	}
+	if err := t.insertVersion(ctx, v); err != nil {
+		if s.isUnique(err) {
+			return 0, ErrDuplicate
+		}
+		return 0, err
+	}
+	return v.Version, t.Commit()
+}
+
+func (s *sqlStore) ListDocumentVersions(ctx context.Context, documentID string) ([]models.DocumentVersion, error) {
+	query := `SELECT ` + versionColumns + ` FROM document_versions WHERE document_id = ? ORDER BY version DESC`
+	rows, err := s.query(ctx, query, documentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []models.DocumentVersion{}
+	for rows.Next() {
+		v, err := scanVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+func (s *sqlStore) RestoreDocumentVersion(ctx context.Context, documentID string, version int) (models.DocumentVersion, error) {
+	t, err := s.begin(ctx)
+	if err != nil {
+		return models.DocumentVersion{}, err
+	}
+	defer t.Rollback()
+
+	query := `SELECT ` + versionColumns + ` FROM document_versions WHERE document_id = ? AND version = ?`
+	v, err := scanVersion(t.queryRow(ctx, query, documentID, version))
+	if err != nil {
+		return v, notFound(err)
+	}
+	if err := t.makeCurrent(ctx, v); err != nil {
+		return v, err
+	}
+	return v, t.Commit()
+}
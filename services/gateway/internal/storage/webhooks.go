@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+	"strings"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/models"
+)
+
+func scanWebhook(row rowScanner) (models.Webhook, error) {
+	var hook models.Webhook
+	var events string
+	err := row.Scan(&hook.ID, &hook.UserID, &hook.URL, &hook.Secret, &events, &hook.CreatedAt)
+	hook.Events = strings.Split(events, ",")
+	return hook, err
+}
+
+func (s *sqlStore) CreateWebhook(ctx context.Context, hook models.Webhook) error {
+	query := `INSERT INTO webhooks (id, user_id, url, secret, events) VALUES (?, ?, ?, ?, ?)`
+	_, err := s.exec(ctx, query, hook.ID, hook.UserID, hook.URL, hook.Secret, strings.Join(hook.Events, ","))
+	return err
+}
+
+func (s *sqlStore) listWebhooks(ctx context.Context, query string, args ...any) ([]models.Webhook, error) {
+	rows, err := s.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hooks := []models.Webhook{}
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, rows.Err()
+}
+
+// ListWebhooks leaves the secrets out, they are only shown on creation
+func (s *sqlStore) ListWebhooks(ctx context.Context, userID int) ([]models.Webhook, error) {
+	hooks, err := s.listWebhooks(ctx, `SELECT id, user_id, url, '', events, created_at FROM webhooks WHERE user_id = ? ORDER BY created_at`, userID)
+	return hooks, err
+}
+
+func (s *sqlStore) ListWebhooksForEvent(ctx context.Context, userID int, event string) ([]models.Webhook, error) {
+	// events is a short comma separated list, wrapping both sides in commas makes the match exact
+	query := `SELECT id, user_id, url, secret, events, created_at FROM webhooks
+		WHERE user_id = ? AND ',' || events || ',' LIKE ?`
+	return s.listWebhooks(ctx, query, userID, "%,"+event+",%")
+}
+
+func (s *sqlStore) DeleteWebhook(ctx context.Context, id string, userID int) error {
+	res, err := s.exec(ctx, `DELETE FROM webhooks WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
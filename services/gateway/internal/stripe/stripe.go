@@ -0,0 +1,185 @@
+// Package stripe is the little of the Stripe API the gateway needs to sell plans: checkout
+// sessions, moving a subscription to another price and the events of its webhook. Requests are
+// form encoded and authenticated with the secret key, the way Stripe's own libraries do it.
+package stripe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+)
+
+const requestTimeout = 30 * time.Second
+
+// Client calls the Stripe API, a nil Client is Stripe switched off
+type Client struct {
+	key    string
+	apiURL string
+	http   *http.Client
+}
+
+// New returns nil when no secret key is configured
+func New(cfg config.Stripe) *Client {
+	if !cfg.Enabled() {
+		return nil
+	}
+	return &Client{key: cfg.SecretKey, apiURL: strings.TrimSuffix(cfg.APIURL, "/"), http: &http.Client{Timeout: requestTimeout}}
+}
+
+// CheckoutParams start a checkout for a subscription to one price. Customer reuses a customer
+// that paid before, otherwise Stripe makes one for CustomerEmail. Metadata goes onto the
+// subscription too, its events carry it.
+type CheckoutParams struct {
+	Price           string
+	Customer        string
+	CustomerEmail   string
+	ClientReference string
+	SuccessURL      string
+	CancelURL       string
+	Metadata        map[string]string
+}
+
+// Session is a checkout session, URL is the page to send the buyer to
+type Session struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+}
+
+// CreateCheckoutSession starts a subscription checkout
+func (c *Client) CreateCheckoutSession(ctx context.Context, p CheckoutParams) (Session, error) {
+	form := url.Values{
+		"mode":                    {"subscription"},
+		"line_items[0][price]":    {p.Price},
+		"line_items[0][quantity]": {"1"},
+		"success_url":             {p.SuccessURL},
+		"cancel_url":              {p.CancelURL},
+		"client_reference_id":     {p.ClientReference},
+	}
+	if p.Customer != "" {
+		form.Set("customer", p.Customer)
+	} else if p.CustomerEmail != "" {
+		form.Set("customer_email", p.CustomerEmail)
+	}
+	for k, v := range p.Metadata {
+		form.Set("metadata["+k+"]", v)
+		form.Set("subscription_data[metadata]["+k+"]", v)
+	}
+	var session Session
+	err := c.call(ctx, http.MethodPost, "/checkout/sessions", form, &session)
+	return session, err
+}
+
+// Subscription is what the gateway reads of a Stripe subscription
+type Subscription struct {
+	ID                string            `json:"id"`
+	Customer          string            `json:"customer"`
+	Status            string            `json:"status"`
+	CancelAtPeriodEnd bool              `json:"cancel_at_period_end"`
+	CurrentPeriodEnd  int64             `json:"current_period_end"`
+	Metadata          map[string]string `json:"metadata"`
+	Items             struct {
+		Data []struct {
+			ID    string `json:"id"`
+			Price struct {
+				ID string `json:"id"`
+			} `json:"price"`
+			// newer API versions keep the period on the item rather than the subscription
+			CurrentPeriodEnd int64 `json:"current_period_end"`
+		} `json:"data"`
+	} `json:"items"`
+}
+
+// Item is the subscription's first item and its price, the gateway's subscriptions have one
+func (s Subscription) Item() (string, string) {
+	if len(s.Items.Data) == 0 {
+		return "", ""
+	}
+	return s.Items.Data[0].ID, s.Items.Data[0].Price.ID
+}
+
+// PeriodEnd is when the subscription's current period ends, zero when Stripe didn't say
+func (s Subscription) PeriodEnd() time.Time {
+	end := s.CurrentPeriodEnd
+	if end == 0 && len(s.Items.Data) > 0 {
+		end = s.Items.Data[0].CurrentPeriodEnd
+	}
+	if end == 0 {
+		return time.Time{}
+	}
+	return time.Unix(end, 0).UTC()
+}
+
+// Subscription statuses
+const (
+	StatusActive            = "active"
+	StatusTrialing          = "trialing"
+	StatusPastDue           = "past_due"
+	StatusIncomplete        = "incomplete"
+	StatusIncompleteExpired = "incomplete_expired"
+	StatusUnpaid            = "unpaid"
+	StatusCanceled          = "canceled"
+)
+
+// ChangePrice moves the subscription's item to price. The time left of the period is prorated
+// and invoiced right away: an upgrade is charged the difference, a downgrade credited it.
+func (c *Client) ChangePrice(ctx context.Context, subscriptionID, itemID, price string) (Subscription, error) {
+	form := url.Values{
+		"items[0][id]":         {itemID},
+		"items[0][price]":      {price},
+		"proration_behavior":   {"always_invoice"},
+		"cancel_at_period_end": {"false"},
+	}
+	var sub Subscription
+	err := c.call(ctx, http.MethodPost, "/subscriptions/"+url.PathEscape(subscriptionID), form, &sub)
+	return sub, err
+}
+
+// Error is what Stripe answered a request it refused with
+type Error struct {
+	Status  int
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("stripe answered %d: %s", e.Status, e.Message)
+}
+
+func (c *Client) call(ctx context.Context, method, path string, form url.Values, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.apiURL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.key, "")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		failure := struct {
+			Error *Error `json:"error"`
+		}{Error: &Error{}}
+		_ = json.Unmarshal(body, &failure)
+		failure.Error.Status = resp.StatusCode
+		if failure.Error.Message == "" {
+			failure.Error.Message = resp.Status
+		}
+		return failure.Error
+	}
+	return json.Unmarshal(body, out)
+}
@@ -0,0 +1,75 @@
+package stripe
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tolerance is how old a signed event may be, older ones could be replayed
+const Tolerance = 5 * time.Minute
+
+// Event types the gateway acts on
+const (
+	EventSubscriptionCreated = "customer.subscription.created"
+	EventSubscriptionUpdated = "customer.subscription.updated"
+	EventSubscriptionDeleted = "customer.subscription.deleted"
+)
+
+// ErrSignature is an event that isn't signed with the webhook secret, or not recently
+var ErrSignature = errors.New("stripe signature doesn't verify")
+
+// Event is a webhook event, Object is the subscription or whatever else it is about
+type Event struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Created int64  `json:"created"`
+	Data    struct {
+		Object json.RawMessage `json:"object"`
+	} `json:"data"`
+}
+
+// ConstructEvent verifies the Stripe-Signature header of payload and parses it. The header is
+// t=<unix time>,v1=<hex HMAC-SHA256 of "t.payload">, with a v1 for each secret being rolled.
+func ConstructEvent(payload []byte, header, secret string, now time.Time) (Event, error) {
+	var event Event
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	t, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return event, ErrSignature
+	}
+	if age := now.Sub(time.Unix(t, 0)); age > Tolerance || age < -Tolerance {
+		return event, ErrSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	expected := mac.Sum(nil)
+	verified := false
+	for _, sig := range signatures {
+		if got, err := hex.DecodeString(sig); err == nil && hmac.Equal(got, expected) {
+			verified = true
+		}
+	}
+	if !verified {
+		return event, ErrSignature
+	}
+	err = json.Unmarshal(payload, &event)
+	return event, err
+}
@@ -0,0 +1,66 @@
+package stripe
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+const secret = "whsec_test"
+
+var payload = []byte(`{"id":"evt_1","type":"customer.subscription.updated","created":1700000000,"data":{"object":{"id":"sub_1"}}}`)
+
+func sign(secret string, t int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", t)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestConstructEvent(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	signed := now.Unix()
+	good := sign(secret, signed, payload)
+
+	tests := []struct {
+		name    string
+		header  string
+		payload []byte
+		now     time.Time
+		wantErr error
+	}{
+		{"valid", fmt.Sprintf("t=%d,v1=%s", signed, good), payload, now, nil},
+		{"spaces between parts", fmt.Sprintf("t=%d, v1=%s", signed, good), payload, now, nil},
+		{"rolled secret", fmt.Sprintf("t=%d,v1=%s,v1=%s", signed, sign("whsec_old", signed, payload), good), payload, now, nil},
+		{"v0 ignored", fmt.Sprintf("t=%d,v0=%s,v1=%s", signed, sign("other", signed, payload), good), payload, now, nil},
+		{"just inside tolerance", fmt.Sprintf("t=%d,v1=%s", signed, good), payload, now.Add(Tolerance), nil},
+		{"clock behind, inside tolerance", fmt.Sprintf("t=%d,v1=%s", signed, good), payload, now.Add(-Tolerance), nil},
+
+		{"too old", fmt.Sprintf("t=%d,v1=%s", signed, good), payload, now.Add(Tolerance + time.Second), ErrSignature},
+		{"too far ahead", fmt.Sprintf("t=%d,v1=%s", signed, good), payload, now.Add(-Tolerance - time.Second), ErrSignature},
+		{"wrong secret", fmt.Sprintf("t=%d,v1=%s", signed, sign("whsec_wrong", signed, payload)), payload, now, ErrSignature},
+		{"tampered payload", fmt.Sprintf("t=%d,v1=%s", signed, good), []byte(`{"id":"evt_2"}`), now, ErrSignature},
+		{"timestamp swapped", fmt.Sprintf("t=%d,v1=%s", signed+1, good), payload, now, ErrSignature},
+		{"only v0", fmt.Sprintf("t=%d,v0=%s", signed, good), payload, now, ErrSignature},
+		{"no timestamp", "v1=" + good, payload, now, ErrSignature},
+		{"bad timestamp", "t=yesterday,v1=" + good, payload, now, ErrSignature},
+		{"not hex", fmt.Sprintf("t=%d,v1=zz%s", signed, good[2:]), payload, now, ErrSignature},
+		{"truncated signature", fmt.Sprintf("t=%d,v1=%s", signed, good[:32]), payload, now, ErrSignature},
+		{"empty header", "", payload, now, ErrSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := ConstructEvent(tt.payload, tt.header, secret, tt.now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ConstructEvent = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && (event.ID != "evt_1" || event.Type != EventSubscriptionUpdated) {
+				t.Errorf("ConstructEvent parsed %+v", event)
+			}
+		})
+	}
+}
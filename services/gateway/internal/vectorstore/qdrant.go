@@ -0,0 +1,338 @@
+package vectorstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// HTTPError is a non-2xx answer from the vector database
+type HTTPError struct {
+	Status int
+	Body   string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("vector store returned %d: %s", e.Status, e.Body)
+}
+
+// IsRetryable reports whether err is worth another attempt later. A 4xx, like
+// a vector of the wrong size for the collection, won't go away by itself.
+func IsRetryable(err error) bool {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Status == http.StatusTooManyRequests || httpErr.Status >= 500
+	}
+	return true
+}
+
+// qdrant talks to Qdrant's REST API. The collection is created on the first upsert,
+// sized to the vectors it gets, so switching to a model with other dimensions needs a new
+// collection, which is what an embedding migration fills.
+type qdrant struct {
+	baseURL    string
+	collection string
+	apiKey     string
+	client     *http.Client
+
+	mu    sync.Mutex
+	ready bool
+	// others are the stores WithCollection handed out, by collection
+	others sync.Map
+}
+
+func newQdrant(baseURL, collection, apiKey string, timeout time.Duration) *qdrant {
+	return &qdrant{baseURL: baseURL, collection: collection, apiKey: apiKey, client: &http.Client{Timeout: timeout}}
+}
+
+func (q *qdrant) Name() string { return "qdrant" }
+
+// WithCollection keeps the stores it hands out, each collection is only prepared once
+func (q *qdrant) WithCollection(collection string) Store {
+	if collection == "" || collection == q.collection {
+		return q
+	}
+	other, _ := q.others.LoadOrStore(collection, newQdrant(q.baseURL, collection, q.apiKey, q.client.Timeout))
+	return other.(*qdrant)
+}
+
+type qdrantPoint struct {
+	ID      string    `json:"id"`
+	Vector  []float32 `json:"vector"`
+	Payload Payload   `json:"payload"`
+}
+
+func (q *qdrant) Upsert(ctx context.Context, points []Point) error {
+	if len(points) == 0 {
+		return nil
+	}
+	if err := q.ensureCollection(ctx, len(points[0].Vector)); err != nil {
+		return err
+	}
+
+	body := struct {
+		Points []qdrantPoint `json:"points"`
+	}{Points: make([]qdrantPoint, len(points))}
+	for i, p := range points {
+		body.Points[i] = qdrantPoint{ID: p.ID, Vector: p.Vector, Payload: p.Payload}
+	}
+	return q.do(ctx, http.MethodPut, q.path("points")+"?wait=true", body, nil)
+}
+
+func (q *qdrant) DeleteDocument(ctx context.Context, documentID string) error {
+	return q.deleteWhere(ctx, qdrantFilter{Must: []qdrantCondition{matchValue("document_id", documentID)}})
+}
+
+func (q *qdrant) DeleteStale(ctx context.Context, documentID, jobID string) error {
+	return q.deleteWhere(ctx, qdrantFilter{
+		Must:    []qdrantCondition{matchValue("document_id", documentID)},
+		MustNot: []qdrantCondition{matchValue("job_id", jobID)},
+	})
+}
+
+func (q *qdrant) SetDocumentMetadata(ctx context.Context, documentID string, tags []string, metadata map[string]string) error {
+	if tags == nil {
+		tags = []string{}
+	}
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	body := map[string]any{
+		"payload": map[string]any{"tags": tags, "metadata": metadata},
+		"filter":  qdrantFilter{Must: []qdrantCondition{matchValue("document_id", documentID)}},
+	}
+	err := q.do(ctx, http.MethodPost, q.path("points/payload")+"?wait=true", body, nil)
+	if isNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func (q *qdrant) deleteWhere(ctx context.Context, filter qdrantFilter) error {
+	body := map[string]any{"filter": filter}
+	err := q.do(ctx, http.MethodPost, q.path("points/delete")+"?wait=true", body, nil)
+	if isNotFound(err) {
+		// no collection yet means nothing was ever indexed
+		return nil
+	}
+	return err
+}
+
+func (q *qdrant) Search(ctx context.Context, vector []float32, filter Filter, limit int) ([]Match, error) {
+	owners := filter.owners()
+	if len(owners) == 0 && len(filter.Shared) == 0 {
+		return nil, nil
+	}
+	var readable []qdrantCondition
+	if len(owners) > 0 {
+		readable = append(readable, matchAny("owner", owners))
+	}
+	if len(filter.Shared) > 0 {
+		readable = append(readable, matchAny("document_id", filter.Shared))
+	}
+	f := qdrantFilter{Must: []qdrantCondition{{Should: readable}}}
+	if len(filter.DocumentIDs) > 0 {
+		f.Must = append(f.Must, matchAny("document_id", filter.DocumentIDs))
+	}
+	// a match on an array field looks for the value among its elements, one condition per tag makes it all of them
+	for _, tag := range filter.Tags {
+		f.Must = append(f.Must, matchValue("tags", tag))
+	}
+	if len(filter.Languages) > 0 {
+		f.Must = append(f.Must, matchAny("language", filter.Languages))
+	}
+	for _, entity := range filter.Entities {
+		f.Must = append(f.Must, matchValue("entities", entity))
+	}
+
+	body := map[string]any{
+		"vector":       vector,
+		"filter":       f,
+		"limit":        limit,
+		"with_payload": true,
+	}
+	var out struct {
+		Result []struct {
+			ID      string  `json:"id"`
+			Score   float32 `json:"score"`
+			Payload Payload `json:"payload"`
+		} `json:"result"`
+	}
+	err := q.do(ctx, http.MethodPost, q.path("points/search"), body, &out)
+	if isNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]Match, len(out.Result))
+	for i, r := range out.Result {
+		matches[i] = Match{ID: r.ID, Score: r.Score, Payload: r.Payload}
+	}
+	return matches, nil
+}
+
+// scrollPage is how many points Chunks asks for at a time
+const scrollPage = 256
+
+func (q *qdrant) Chunks(ctx context.Context, documentID string) ([]Payload, error) {
+	body := map[string]any{
+		"filter":       qdrantFilter{Must: []qdrantCondition{matchValue("document_id", documentID)}},
+		"limit":        scrollPage,
+		"with_payload": true,
+		"with_vector":  false,
+	}
+	var payloads []Payload
+	for {
+		var out struct {
+			Result struct {
+				Points []struct {
+					Payload Payload `json:"payload"`
+				} `json:"points"`
+				// the ID to carry on from, null after the last page
+				NextPageOffset any `json:"next_page_offset"`
+			} `json:"result"`
+		}
+		err := q.do(ctx, http.MethodPost, q.path("points/scroll"), body, &out)
+		if isNotFound(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range out.Result.Points {
+			payloads = append(payloads, p.Payload)
+		}
+		if out.Result.NextPageOffset == nil {
+			return payloads, nil
+		}
+		body["offset"] = out.Result.NextPageOffset
+	}
+}
+
+func (q *qdrant) Chunk(ctx context.Context, documentID string, index int) (Payload, error) {
+	var out struct {
+		Result struct {
+			Payload Payload `json:"payload"`
+		} `json:"result"`
+	}
+	err := q.do(ctx, http.MethodGet, q.path("points/"+PointID(documentID, index)), nil, &out)
+	if isNotFound(err) {
+		// a missing point and a missing collection both answer 404
+		return Payload{}, ErrNotFound
+	}
+	return out.Result.Payload, err
+}
+
+// ensureCollection creates the collection (and the payload indexes searches filter on) if it isn't there yet
+func (q *qdrant) ensureCollection(ctx context.Context, dimensions int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.ready {
+		return nil
+	}
+
+	err := q.do(ctx, http.MethodGet, q.path(""), nil, nil)
+	if isNotFound(err) {
+		create := map[string]any{
+			"vectors": map[string]any{"size": dimensions, "distance": "Cosine"},
+		}
+		err = q.do(ctx, http.MethodPut, q.path(""), create, nil)
+		var httpErr *HTTPError
+		if errors.As(err, &httpErr) && httpErr.Status == http.StatusConflict {
+			// another worker got there first
+			err = nil
+		} else if err == nil {
+			for _, field := range []string{"owner", "document_id", "job_id", "tags", "language"} {
+				index := map[string]any{"field_name": field, "field_schema": "keyword"}
+				if err = q.do(ctx, http.MethodPut, q.path("index")+"?wait=true", index, nil); err != nil {
+					break
+				}
+			}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("preparing collection %s: %w", q.collection, err)
+	}
+
+	q.ready = true
+	return nil
+}
+
+type qdrantFilter struct {
+	Must    []qdrantCondition `json:"must,omitempty"`
+	MustNot []qdrantCondition `json:"must_not,omitempty"`
+}
+
+// qdrantCondition matches a payload field, or is a nested filter that matches when any of Should does
+type qdrantCondition struct {
+	Key    string            `json:"key,omitempty"`
+	Match  map[string]any    `json:"match,omitempty"`
+	Should []qdrantCondition `json:"should,omitempty"`
+}
+
+func matchValue(key, value string) qdrantCondition {
+	return qdrantCondition{Key: key, Match: map[string]any{"value": value}}
+}
+
+func matchAny(key string, values []string) qdrantCondition {
+	return qdrantCondition{Key: key, Match: map[string]any{"any": values}}
+}
+
+func (q *qdrant) path(rest string) string {
+	p := q.baseURL + "/collections/" + url.PathEscape(q.collection)
+	if rest != "" {
+		p += "/" + rest
+	}
+	return p
+}
+
+func (q *qdrant) do(ctx context.Context, method, target string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if q.apiKey != "" {
+		req.Header.Set("api-key", q.apiKey)
+	}
+
+	resp, err := q.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &HTTPError{Status: resp.StatusCode, Body: string(bytes.TrimSpace(msg))}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func isNotFound(err error) bool {
+	var httpErr *HTTPError
+	return errors.As(err, &httpErr) && httpErr.Status == http.StatusNotFound
+}
@@ -0,0 +1,132 @@
+package vectorstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/gateway/internal/config"
+	"github.com/google/uuid"
+)
+
+// Store keeps chunk embeddings searchable by similarity
+type Store interface {
+	Name() string
+	// WithCollection is the same store on another collection, "" keeps this one
+	WithCollection(collection string) Store
+	// Upsert writes points, replacing any with the same ID
+	Upsert(ctx context.Context, points []Point) error
+	// DeleteDocument removes every point belonging to a document
+	DeleteDocument(ctx context.Context, documentID string) error
+	// DeleteStale removes a document's points that weren't written by jobID,
+	// left over when reprocessing produced fewer chunks than before
+	DeleteStale(ctx context.Context, documentID, jobID string) error
+	// SetDocumentMetadata overwrites the tags and metadata on every point of a document
+	SetDocumentMetadata(ctx context.Context, documentID string, tags []string, metadata map[string]string) error
+	// Search returns the limit points closest to vector that match filter, best first
+	Search(ctx context.Context, vector []float32, filter Filter, limit int) ([]Match, error)
+	// Chunks returns the payloads of every point of a document, in no particular order
+	Chunks(ctx context.Context, documentID string) ([]Payload, error)
+	// Chunk returns the payload of a document's chunk index, ErrNotFound when there is no such point
+	Chunk(ctx context.Context, documentID string, index int) (Payload, error)
+}
+
+// ErrNotFound is returned by Chunk for a point that isn't there
+var ErrNotFound = errors.New("point not found")
+
+// Point is one embedded chunk
+type Point struct {
+	ID      string
+	Vector  []float32
+	Payload Payload
+}
+
+// Payload is what gets stored next to a vector, enough to filter on and to show a hit without a database lookup
+type Payload struct {
+	DocumentID string `json:"document_id"`
+	UserID     int    `json:"user_id"`
+	OrgID      string `json:"org_id,omitempty"`
+	// Owner is "user:<id>" for personal documents and "org:<id>" for shared ones, it's what searches filter on
+	Owner      string `json:"owner"`
+	JobID      string `json:"job_id"`
+	ChunkIndex int    `json:"chunk_index"`
+	Page       int    `json:"page,omitempty"`
+	Start      int    `json:"start"`
+	End        int    `json:"end"`
+	Heading    string `json:"heading,omitempty"`
+	Text       string `json:"text"`
+	Model      string `json:"embedding_model,omitempty"`
+	// Language is the ISO 639-1 code the worker detected for the document, searches can filter on it
+	Language string `json:"language,omitempty"`
+	// Tags and Metadata are the document's, Tags is what searches filter on
+	Tags     []string          `json:"tags,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Entities are what the document mentions as "<type>:<value in lower case>", searches can filter on them
+	Entities []string `json:"entities,omitempty"`
+}
+
+// Filter narrows a search down. A point matches when it is UserID's personal
+// document, belongs to one of OrgIDs or is one of Shared, and (if set) is one of DocumentIDs
+// and carries every one of Tags and Entities and is in one of Languages. A zero UserID leaves
+// personal documents out.
+type Filter struct {
+	UserID      int
+	OrgIDs      []string
+	Shared      []string // documents of others shared with the caller
+	DocumentIDs []string
+	Tags        []string
+	Languages   []string
+	Entities    []string
+}
+
+// Match is a search hit, higher scores are closer
+type Match struct {
+	ID      string
+	Score   float32
+	Payload Payload
+}
+
+// OwnerKey is the Payload.Owner value for a document
+func OwnerKey(userID int, orgID string) string {
+	if orgID != "" {
+		return "org:" + orgID
+	}
+	return "user:" + strconv.Itoa(userID)
+}
+
+// owners lists the Owner values a filter allows
+func (f Filter) owners() []string {
+	var owners []string
+	if f.UserID != 0 {
+		owners = append(owners, OwnerKey(f.UserID, ""))
+	}
+	for _, org := range f.OrgIDs {
+		owners = append(owners, OwnerKey(0, org))
+	}
+	return owners
+}
+
+// pointNamespace seeds PointID, changing it would orphan every indexed point
+var pointNamespace = uuid.MustParse("6f1c2a7e-4b0d-4e8a-9c3f-2d5e8b1a7c40")
+
+// PointID is stable per document and chunk so reprocessing overwrites points instead of duplicating them
+func PointID(documentID string, chunkIndex int) string {
+	return uuid.NewSHA1(pointNamespace, fmt.Appendf(nil, "%s/%d", documentID, chunkIndex)).String()
+}
+
+// New picks the store named by cfg.Kind, only "qdrant" for now.
+// It returns nil when that is empty, which turns search off.
+// This is a copy of the worker's package: the worker writes the points and the gateway
+// searches them, so the payload layout has to stay the same in both.
+func New(cfg config.VectorStore) (Store, error) {
+	switch cfg.Kind {
+	case "":
+		return nil, nil
+	case "qdrant":
+		return newQdrant("http://"+cfg.QdrantHost+":"+cfg.QdrantPort, cfg.Collection, cfg.APIKey, 30*time.Second), nil
+	default:
+		return nil, fmt.Errorf("unknown VECTOR_STORE %q, use qdrant", cfg.Kind)
+	}
+}
@@ -23,7 +23,12 @@ MINIO_SECRET_KEY = os.getenv("MINIO_SECRET_KEY")
 MINIO_BUCKET_NAME = os.getenv("MINIO_BUCKET_NAME")
 
 # Constants
-RABBITMQ_QUEUE = "ingestion_queue"
+RABBITMQ_QUEUE = "ingestion_jobs"
+# Declared by the gateway with these arguments, a declare without them is refused
+RABBITMQ_QUEUE_ARGS = {
+    "x-dead-letter-exchange": "ingestion_dlx",
+    "x-dead-letter-routing-key": "ingestion_dlq",
+}
 VISION_MODEL_PATH = "models/Qwen2-VL-2B-Instruct-Q4_K_M.gguf"
 VISION_MMPROJ_PATH = "models/mmproj-Qwen2-VL-2B-Instruct-f16.gguf"
 EMBEDDING_MODEL_NAME = "all-MiniLM-L6-v2"
@@ -170,7 +175,7 @@ def main():
         connection = pika.BlockingConnection(params)
         channel = connection.channel()
 
-        channel.queue_declare(queue=RABBITMQ_QUEUE, durable=True)
+        channel.queue_declare(queue=RABBITMQ_QUEUE, durable=True, arguments=RABBITMQ_QUEUE_ARGS)
         channel.basic_qos(prefetch_count=1)
         
         channel.basic_consume(
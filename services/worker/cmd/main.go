@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"github.com/dhruvkshah75/docstream/worker/internal/chunker"
+	"github.com/dhruvkshah75/docstream/worker/internal/config"
+	"github.com/dhruvkshah75/docstream/worker/internal/embeddings"
+	"github.com/dhruvkshah75/docstream/worker/internal/envelope"
+	"github.com/dhruvkshah75/docstream/worker/internal/llm"
+	"github.com/dhruvkshah75/docstream/worker/internal/locks"
+	"github.com/dhruvkshah75/docstream/worker/internal/objectstore"
+	"github.com/dhruvkshah75/docstream/worker/internal/pipeline"
+	"github.com/dhruvkshah75/docstream/worker/internal/queue"
+	"github.com/dhruvkshah75/docstream/worker/internal/tracing"
+	"github.com/dhruvkshah75/docstream/worker/internal/vectorstore"
+	"github.com/dhruvkshah75/docstream/worker/internal/worker"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	// 1. Load Env
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using system vars")
+	}
+
+	// Go stages of your own register with pipeline.Register from an init func in this package,
+	// the config can name them like any other stage
+	for _, plugin := range pipeline.Registered() {
+		config.Stages = append(config.Stages, plugin.Stage.Name())
+	}
+
+	// Everything configurable comes from here, a bad value stops the worker before it takes a job
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalln("Config:", err)
+	}
+	chunkDefaults := chunker.FromConfig(cfg.Chunking)
+	if err := chunkDefaults.Validate(); err != nil {
+		log.Fatalln("Config:", err)
+	}
+	chunkLanguages := chunker.LanguagesFromConfig(cfg.Chunking)
+	for code, opts := range chunkLanguages {
+		if err := chunkDefaults.Override(opts).Validate(); err != nil {
+			log.Fatalf("Config: chunking for %s: %v\n", code, err)
+		}
+	}
+
+	// Tracing first so the first job already gets spans
+	shutdownTracing := tracing.Init("docstream-worker")
+	defer shutdownTracing(context.Background())
+
+	// 2. Initialize Infrastructure
+	// Object storage is MinIO, AWS S3 or a local directory depending on STORAGE_BACKEND, the same as the gateway
+	objects, err := objectstore.New(context.Background(), cfg.Storage)
+	if err != nil {
+		log.Fatalln("Object storage:", err)
+	}
+	// Objects the gateway encrypted are decrypted with the same ENCRYPTION_KEYS or ENCRYPTION_KMS_KEY_ID
+	keys, err := envelope.New(context.Background(), cfg.Encryption)
+	if err != nil {
+		log.Fatalln("Encryption:", err)
+	}
+	// The queue is RabbitMQ or Kafka depending on QUEUE_BACKEND, the same as the gateway
+	bus, err := queue.New(context.Background(), cfg.Queue, cfg.RabbitMQURL)
+	if err != nil {
+		log.Fatalln("Queue:", err)
+	}
+
+	// close the connection when the worker stops
+	defer bus.Close()
+
+	// Embeddings are optional, EMBEDDING_PROVIDER picks openai, ollama or tei
+	embedder, err := embeddings.New(cfg.Embeddings, cfg.Providers)
+	if err != nil {
+		log.Fatalln("Embedding provider:", err)
+	}
+	if embedder == nil {
+		log.Println("EMBEDDING_PROVIDER not set, chunks won't be embedded")
+	}
+
+	// The vector index is optional too, VECTOR_STORE=qdrant turns it on
+	index, err := vectorstore.New(cfg.VectorStore)
+	if err != nil {
+		log.Fatalln("Vector store:", err)
+	}
+	if index == nil {
+		log.Println("VECTOR_STORE not set, embeddings won't be indexed")
+	}
+
+	// 3. Build the processing pipeline, add new stages here
+	stages := []pipeline.Stage{
+		pipeline.ExtractStage{TempDir: cfg.Temp.Dir},
+		pipeline.LanguageStage{},
+	}
+	// DOCUMENT_CLASSES turns on classifying, by keywords or with the embedding provider
+	if classification := cfg.Classification; len(classification.Classes) > 0 {
+		classify := pipeline.ClassifyStage{Threshold: classification.Threshold}
+		for _, class := range classification.Classes {
+			classify.Classes = append(classify.Classes, pipeline.Class{Name: class.Name, Keywords: class.Keywords, Description: class.Description})
+		}
+		if classification.Method == "embeddings" {
+			classify.Provider = embedder
+		}
+		stages = append(stages, classify)
+	}
+	// People, organizations, dates and amounts go on the document and its points, before chunking
+	if cfg.Entities.Enabled {
+		stages = append(stages, pipeline.EntitiesStage{Types: cfg.Entities.Types, Max: cfg.Entities.Max})
+	}
+	stages = append(stages,
+		pipeline.ChunkStage{Defaults: chunkDefaults, Languages: chunkLanguages},
+		pipeline.EmbedStage{Provider: embedder, BatchSize: cfg.Embeddings.BatchSize, LanguageModels: cfg.Embeddings.LanguageModels},
+		pipeline.IndexStage{Store: index},
+	)
+	// Chunk text goes to the gateway's keyword index right behind the vectors, it streams with them
+	if cfg.KeywordSearch {
+		stages = append(stages, pipeline.KeywordsStage{Publisher: bus})
+	}
+	// Summaries are optional, SUMMARY_PROVIDER picks openai or ollama. They come after indexing,
+	// a slow model doesn't keep the document out of search.
+	summarizer, err := llm.New(cfg.Summaries, cfg.Providers)
+	if err != nil {
+		log.Fatalln("Summary provider:", err)
+	}
+	if summarizer != nil {
+		stages = append(stages, pipeline.SummarizeStage{LLM: summarizer, KeyPoints: cfg.Summaries.KeyPoints, MaxInput: int(cfg.Summaries.MaxInput)})
+	}
+	// Thumbnails come last, the document is searchable before they are drawn
+	if cfg.Thumbnails.Enabled {
+		renderer := cfg.Thumbnails.PDFRenderer
+		if _, err := exec.LookPath(renderer); err != nil {
+			log.Printf("%s not found, PDFs won't get thumbnails\n", renderer)
+			renderer = ""
+		}
+		stages = append(stages, pipeline.ThumbnailStage{
+			Objects:      objects,
+			Keys:         keys,
+			PDFRenderer:  renderer,
+			Width:        cfg.Thumbnails.Width,
+			PreviewWidth: cfg.Thumbnails.PreviewWidth,
+			TempDir:      cfg.Temp.Dir,
+		})
+	}
+	// Plugins go in after the stage they name, the Go ones first and then the commands
+	plugins := pipeline.Registered()
+	for _, plugin := range cfg.Plugins {
+		plugins = append(plugins, pipeline.Plugin{
+			Stage: pipeline.ExecStage{StageName: plugin.Name, Command: plugin.Command, Timeout: plugin.Timeout},
+			After: plugin.After,
+		})
+	}
+	if stages, err = pipeline.Plug(stages, plugins); err != nil {
+		log.Fatalln("Config:", err)
+	}
+	// The chunk stage streams its chunks through embed and index a batch at a time, keep them
+	// right after it.
+	// STAGE_CONCURRENCY keeps the heavy stages to a few jobs at a time while WORKER_CONCURRENCY
+	// jobs are in flight
+	p := pipeline.New(stages...).Limit(cfg.StageConcurrency)
+	// PIPELINE_<FORMAT> or the config file's pipelines change which of the stages a format goes through
+	for format, steps := range cfg.Pipelines {
+		route := make([]pipeline.Step, len(steps))
+		for i, step := range steps {
+			route[i] = pipeline.Step{Stage: step.Stage, Needs: step.Needs}
+		}
+		if err := p.Route(format, route); err != nil {
+			log.Fatalln("Config:", err)
+		}
+	}
+
+	// Stop cleanly on Ctrl+C / docker stop
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Drop purged documents from the index, alongside the jobs
+	if index != nil {
+		go func() {
+			if err := worker.RunTombstones(ctx, bus, index); err != nil {
+				log.Println("Tombstone consumer stopped:", err)
+			}
+		}()
+	}
+
+	// Files a crashed worker left behind in WORKER_TEMP_DIR go after WORKER_TEMP_MAX_AGE
+	go worker.CleanTemp(ctx, cfg.Temp.Dir, cfg.Temp.MaxAge)
+
+	// The same document queued twice is processed once, REDIS_URL shares that between workers
+	jobLocks, err := locks.New(cfg.RedisURL)
+	if err != nil {
+		log.Fatalln("Redis:", err)
+	}
+
+	w := worker.New(bus, objects, keys, p, cfg.MaxJobAttempts, cfg.Concurrency, cfg.Temp, jobLocks)
+
+	// Cancelled jobs stop after their current stage, the cancellations come in alongside the jobs
+	go func() {
+		if err := w.RunCancellations(ctx); err != nil {
+			log.Println("Cancellation consumer stopped:", err)
+		}
+	}()
+
+	if err := w.Run(ctx); err != nil {
+		log.Fatalln("Worker stopped:", err)
+	}
+	log.Println("Stopping worker...")
+}
@@ -0,0 +1,350 @@
+package chunker
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dhruvkshah75/docstream/worker/internal/config"
+)
+
+// Strategies decide where a chunk may end
+const (
+	// StrategyTokens cuts anywhere between tokens
+	StrategyTokens = "tokens"
+	// StrategySentences only cuts between sentences, long sentences are split by tokens
+	StrategySentences = "sentences"
+	// StrategyMarkdown never lets a chunk span two sections, sections are then split by sentences
+	StrategyMarkdown = "markdown"
+)
+
+// Tokenizers decide what counts as a token
+const (
+	// TokenizerWords counts whitespace separated words
+	TokenizerWords = "words"
+	// TokenizerCharacters counts every Chinese, Japanese or Thai character on its own, those
+	// scripts don't put spaces between words. Anything else is still counted in words.
+	TokenizerCharacters = "characters"
+)
+
+const (
+	defaultSize    = 512
+	defaultOverlap = 50
+)
+
+// Options control the chunking. Size and Overlap are counted in tokens, which here
+// are whitespace separated words (or characters, see Tokenizer), a close enough stand-in for model tokens.
+type Options struct {
+	Strategy  string
+	Size      int
+	Overlap   int
+	Tokenizer string
+}
+
+// Chunk is one piece of the text, Start and End are byte offsets into it
+type Chunk struct {
+	Index   int
+	Text    string
+	Start   int
+	End     int
+	Tokens  int
+	Heading string // the markdown heading the chunk sits under, if any
+}
+
+// FromConfig turns the configured chunking into the defaults for jobs that don't set their own
+func FromConfig(cfg config.Chunking) Options {
+	return Options{Strategy: cfg.Strategy, Size: cfg.Size, Overlap: cfg.Overlap, Tokenizer: cfg.Tokenizer}.withDefaults()
+}
+
+// LanguagesFromConfig returns the per-language chunking as overrides to apply on top of the defaults
+func LanguagesFromConfig(cfg config.Chunking) map[string]Options {
+	languages := make(map[string]Options, len(cfg.Languages))
+	for code, c := range cfg.Languages {
+		languages[code] = Options{Strategy: c.Strategy, Size: c.Size, Overlap: c.Overlap, Tokenizer: c.Tokenizer}
+	}
+	return languages
+}
+
+// Override returns o with every non-zero field of other applied on top
+func (o Options) Override(other Options) Options {
+	if other.Strategy != "" {
+		o.Strategy = other.Strategy
+	}
+	if other.Size > 0 {
+		o.Size = other.Size
+		// a default overlap made for bigger chunks shouldn't make a small size invalid
+		if other.Overlap <= 0 && o.Overlap >= o.Size {
+			o.Overlap = o.Size / 10
+		}
+	}
+	if other.Overlap > 0 {
+		o.Overlap = other.Overlap
+	}
+	if other.Tokenizer != "" {
+		o.Tokenizer = other.Tokenizer
+	}
+	return o
+}
+
+func (o Options) withDefaults() Options {
+	if o.Strategy == "" {
+		o.Strategy = StrategySentences
+	}
+	if o.Size <= 0 {
+		o.Size = defaultSize
+	}
+	if o.Overlap < 0 {
+		o.Overlap = 0
+	}
+	if o.Tokenizer == "" {
+		o.Tokenizer = TokenizerWords
+	}
+	return o
+}
+
+// Validate rejects settings that can't produce sensible chunks
+func (o Options) Validate() error {
+	switch o.Strategy {
+	case StrategyTokens, StrategySentences, StrategyMarkdown:
+	default:
+		return fmt.Errorf("unknown chunk strategy %q, use tokens, sentences or markdown", o.Strategy)
+	}
+	switch o.Tokenizer {
+	case TokenizerWords, TokenizerCharacters:
+	default:
+		return fmt.Errorf("unknown chunk tokenizer %q, use words or characters", o.Tokenizer)
+	}
+	if o.Size < 1 {
+		return fmt.Errorf("chunk size must be positive")
+	}
+	if o.Overlap >= o.Size {
+		return fmt.Errorf("chunk overlap (%d) must be smaller than the chunk size (%d)", o.Overlap, o.Size)
+	}
+	return nil
+}
+
+// Split cuts text into overlapping chunks following opts.Strategy
+func Split(text string, opts Options) ([]Chunk, error) {
+	opts = opts.withDefaults()
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	var chunks []Chunk
+	chars := opts.Tokenizer == TokenizerCharacters
+	switch opts.Strategy {
+	case StrategyTokens:
+		chunks = pack(text, words(text, 0, len(text), chars), opts, "")
+	case StrategySentences:
+		chunks = pack(text, sentences(text, 0, len(text), opts.Size, chars), opts, "")
+	case StrategyMarkdown:
+		for _, sec := range sections(text) {
+			chunks = append(chunks, pack(text, sentences(text, sec.start, sec.end, opts.Size, chars), opts, sec.heading)...)
+		}
+	}
+
+	for i := range chunks {
+		chunks[i].Index = i
+	}
+	return chunks, nil
+}
+
+// span is a run of text [start, end) worth tokens tokens
+type span struct {
+	start, end int
+	tokens     int
+}
+
+// pack greedily fills chunks with whole units up to opts.Size tokens, then starts
+// the next chunk far enough back to repeat about opts.Overlap tokens
+func pack(text string, units []span, opts Options, heading string) []Chunk {
+	var chunks []Chunk
+	for i := 0; i < len(units); {
+		j, tokens := i, 0
+		for j < len(units) && (j == i || tokens+units[j].tokens <= opts.Size) {
+			tokens += units[j].tokens
+			j++
+		}
+
+		start, end := units[i].start, units[j-1].end
+		chunks = append(chunks, Chunk{Text: text[start:end], Start: start, End: end, Tokens: tokens, Heading: heading})
+		if j == len(units) {
+			break
+		}
+
+		// walk back from the end for the overlap, always moving forward at least one unit
+		k, overlap := j, 0
+		for k-1 > i && overlap+units[k-1].tokens <= opts.Overlap {
+			k--
+			overlap += units[k].tokens
+		}
+		i = k
+	}
+	return chunks
+}
+
+// words returns every whitespace separated token in text[start:end], with chars every
+// character of a script without spaces is a token of its own
+func words(text string, start, end int, chars bool) []span {
+	var spans []span
+	inWord := false
+	wordStart := 0
+	for i := start; i < end; {
+		r, size := utf8.DecodeRuneInString(text[i:end])
+		if chars && unspaced(r) {
+			if inWord {
+				spans = append(spans, span{start: wordStart, end: i, tokens: 1})
+				inWord = false
+			}
+			spans = append(spans, span{start: i, end: i + size, tokens: 1})
+		} else if unicode.IsSpace(r) {
+			if inWord {
+				spans = append(spans, span{start: wordStart, end: i, tokens: 1})
+				inWord = false
+			}
+		} else if !inWord {
+			inWord = true
+			wordStart = i
+		}
+		i += size
+	}
+	if inWord {
+		spans = append(spans, span{start: wordStart, end: end, tokens: 1})
+	}
+	return spans
+}
+
+// unspaced tells the characters of Chinese, Japanese and Thai, which run words together
+func unspaced(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Thai)
+}
+
+// the full width stops of Chinese and Japanese, they need no space after them
+var fullStops = []string{"。", "！", "？"}
+
+// sentences splits text[start:end] after ., ! or ? followed by whitespace, after 。！？ and at
+// blank lines. A sentence longer than maxTokens comes back as its words so it can still be packed.
+func sentences(text string, start, end, maxTokens int, chars bool) []span {
+	var spans []span
+	emit := func(from, to int) {
+		ws := words(text, from, to, chars)
+		if len(ws) == 0 {
+			return
+		}
+		if len(ws) > maxTokens {
+			spans = append(spans, ws...)
+			return
+		}
+		spans = append(spans, span{start: ws[0].start, end: ws[len(ws)-1].end, tokens: len(ws)})
+	}
+
+	from := start
+	for i := start; i < end; i++ {
+		switch text[i] {
+		case '.', '!', '?':
+			if i+1 == end || isSpace(text[i+1]) {
+				emit(from, i+1)
+				from = i + 1
+			}
+		case '\n':
+			if i+1 < end && text[i+1] == '\n' {
+				emit(from, i)
+				from = i + 1
+			}
+		case 0xe3, 0xef:
+			for _, stop := range fullStops {
+				if strings.HasPrefix(text[i:end], stop) {
+					emit(from, i+len(stop))
+					from = i + len(stop)
+				}
+			}
+		}
+	}
+	emit(from, end)
+	return spans
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\n' || b == '\t' || b == '\r'
+}
+
+// Heading is a markdown heading and the offset of its line in the text
+type Heading struct {
+	Start int
+	Title string
+}
+
+// Headings lists the headings of markdown text in order, the same ones the markdown strategy splits at
+func Headings(text string) []Heading {
+	var headings []Heading
+	for _, sec := range sections(text) {
+		if sec.heading != "" {
+			headings = append(headings, Heading{Start: sec.start, Title: sec.heading})
+		}
+	}
+	return headings
+}
+
+type section struct {
+	heading    string
+	start, end int
+}
+
+// sections splits markdown at ATX headings ("# Title"), ignoring anything inside ``` fences.
+// Each section runs from its heading line to the next heading.
+func sections(text string) []section {
+	var secs []section
+	current := section{}
+	var scanner HeadingScanner
+
+	for pos := 0; pos < len(text); {
+		lineEnd := strings.IndexByte(text[pos:], '\n')
+		if lineEnd < 0 {
+			lineEnd = len(text)
+		} else {
+			lineEnd += pos
+		}
+		if title, ok := scanner.Heading(text[pos:lineEnd]); ok {
+			current.end = pos
+			if current.end > current.start {
+				secs = append(secs, current)
+			}
+			current = section{heading: title, start: pos}
+		}
+		pos = lineEnd + 1
+	}
+
+	current.end = len(text)
+	if current.end > current.start {
+		secs = append(secs, current)
+	}
+	return secs
+}
+
+// HeadingScanner finds the headings of markdown that is read a line at a time, for a file too
+// big to hold as one string. They are the same ones Headings finds.
+type HeadingScanner struct {
+	inFence bool
+}
+
+// Heading returns the title of line if it is a heading, line may still end in its newline
+func (s *HeadingScanner) Heading(line string) (string, bool) {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "```") {
+		s.inFence = !s.inFence
+		return "", false
+	}
+	if s.inFence || !isHeading(line) {
+		return "", false
+	}
+	return strings.TrimSpace(strings.TrimLeft(line, "#")), true
+}
+
+func isHeading(line string) bool {
+	level := 0
+	for level < len(line) && line[level] == '#' {
+		level++
+	}
+	return level >= 1 && level <= 6 && (level == len(line) || line[level] == ' ')
+}
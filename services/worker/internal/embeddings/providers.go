@@ -0,0 +1,97 @@
+package embeddings
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// openAI talks to the /embeddings endpoint, anything OpenAI compatible works through OPENAI_BASE_URL
+type openAI struct {
+	baseURL string
+	apiKey  string
+	model   string
+	retry   retrier
+}
+
+func newOpenAI(baseURL, apiKey, model string, retry retrier) *openAI {
+	return &openAI{baseURL: strings.TrimRight(baseURL, "/"), apiKey: apiKey, model: model, retry: retry}
+}
+
+func (p *openAI) Name() string         { return "openai" }
+func (p *openAI) DefaultModel() string { return p.model }
+
+func (p *openAI) Embed(ctx context.Context, model string, texts []string) ([][]float32, error) {
+	var resp struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	body := map[string]any{"model": model, "input": texts}
+	headers := map[string]string{"Authorization": "Bearer " + p.apiKey}
+	if err := p.retry.postJSON(ctx, p.baseURL+"/embeddings", headers, body, &resp); err != nil {
+		return nil, err
+	}
+
+	// the API says data comes back in input order, sorting by index makes sure of it
+	sort.Slice(resp.Data, func(i, j int) bool { return resp.Data[i].Index < resp.Data[j].Index })
+	vectors := make([][]float32, len(resp.Data))
+	for i, d := range resp.Data {
+		vectors[i] = d.Embedding
+	}
+	return vectors, nil
+}
+
+// ollama uses the local /api/embed endpoint, which takes a batch of inputs
+type ollama struct {
+	baseURL string
+	model   string
+	retry   retrier
+}
+
+func newOllama(baseURL, model string, retry retrier) *ollama {
+	return &ollama{baseURL: strings.TrimRight(baseURL, "/"), model: model, retry: retry}
+}
+
+func (p *ollama) Name() string         { return "ollama" }
+func (p *ollama) DefaultModel() string { return p.model }
+
+func (p *ollama) Embed(ctx context.Context, model string, texts []string) ([][]float32, error) {
+	var resp struct {
+		Embeddings [][]float32 `json:"embeddings"`
+	}
+	body := map[string]any{"model": model, "input": texts}
+	if err := p.retry.postJSON(ctx, p.baseURL+"/api/embed", nil, body, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Embeddings, nil
+}
+
+// tei is HuggingFace text-embeddings-inference. It serves a single model picked when
+// the server starts, so the model name is only checked against what it reports.
+type tei struct {
+	baseURL string
+	model   string
+	retry   retrier
+}
+
+func newTEI(baseURL, model string, retry retrier) *tei {
+	return &tei{baseURL: strings.TrimRight(baseURL, "/"), model: model, retry: retry}
+}
+
+func (p *tei) Name() string         { return "tei" }
+func (p *tei) DefaultModel() string { return p.model }
+
+func (p *tei) Embed(ctx context.Context, model string, texts []string) ([][]float32, error) {
+	if model != p.model {
+		return nil, fmt.Errorf("%w: tei serves %s, not %s", ErrUnsupportedModel, p.model, model)
+	}
+	var vectors [][]float32
+	body := map[string]any{"inputs": texts, "truncate": true}
+	if err := p.retry.postJSON(ctx, p.baseURL+"/embed", nil, body, &vectors); err != nil {
+		return nil, err
+	}
+	return vectors, nil
+}
@@ -0,0 +1,186 @@
+// Package envelope encrypts stored objects, each one with a random data key of its own.
+// A master key, local or in AWS KMS, wraps the data key and the wrapped key is kept in the
+// database next to the document, so storage alone never has enough to read anything.
+package envelope
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dhruvkshah75/docstream/worker/internal/config"
+)
+
+const dataKeyLen = 32
+
+// wrapper is a master key, id goes in front of the keys it wraps so they find it again
+type wrapper interface {
+	id() string
+	wrap(ctx context.Context, key []byte) ([]byte, error)
+	unwrap(ctx context.Context, wrapped []byte) ([]byte, error)
+}
+
+// Keyring holds the master keys. The current one wraps new data keys, all of them unwrap.
+type Keyring struct {
+	current wrapper
+	byID    map[string]wrapper
+}
+
+// New builds the keyring cfg describes, with no keys at all encryption is off
+func New(ctx context.Context, cfg config.Encryption) (*Keyring, error) {
+	ring := &Keyring{byID: map[string]wrapper{}}
+	for _, entry := range strings.Split(cfg.Keys, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kid, secret, ok := strings.Cut(entry, ":")
+		if !ok || kid == "" {
+			// not quoting the entry, it is probably a bare key
+			return nil, fmt.Errorf("encryption keys are written <kid>:<base64 key>,...")
+		}
+		key, err := localKey(kid, secret)
+		if err != nil {
+			return nil, err
+		}
+		if _, dup := ring.byID[key.id()]; dup {
+			return nil, fmt.Errorf("encryption key %q is listed twice", kid)
+		}
+		ring.byID[key.id()] = key
+		if ring.current == nil {
+			ring.current = key
+		}
+	}
+
+	if cfg.KMSKeyID != "" {
+		kms, err := newKMS(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		ring.byID[kms.id()] = kms
+		ring.current = kms
+	}
+	return ring, nil
+}
+
+// Enabled says whether new objects get encrypted
+func (k *Keyring) Enabled() bool {
+	return k != nil && k.current != nil
+}
+
+// Current names the master key that wraps new data keys, for logs
+func (k *Keyring) Current() string {
+	if !k.Enabled() {
+		return ""
+	}
+	return k.current.id()
+}
+
+// NewDataKey makes a data key for one object, wrapped is what gets stored
+func (k *Keyring) NewDataKey(ctx context.Context) (key []byte, wrapped string, err error) {
+	if !k.Enabled() {
+		return nil, "", fmt.Errorf("no encryption key is configured")
+	}
+	key = make([]byte, dataKeyLen)
+	if _, err := rand.Read(key); err != nil {
+		return nil, "", err
+	}
+	sealed, err := k.current.wrap(ctx, key)
+	if err != nil {
+		return nil, "", fmt.Errorf("wrapping data key: %w", err)
+	}
+	return key, k.current.id() + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Unwrap gets a data key back out of what NewDataKey stored
+func (k *Keyring) Unwrap(ctx context.Context, wrapped string) ([]byte, error) {
+	i := strings.LastIndexByte(wrapped, ':')
+	if i < 0 {
+		return nil, fmt.Errorf("malformed wrapped data key")
+	}
+	id := wrapped[:i]
+	var w wrapper
+	if k != nil {
+		w = k.byID[id]
+	}
+	if w == nil {
+		return nil, fmt.Errorf("data key is wrapped by %s, which isn't configured (ENCRYPTION_KEYS, ENCRYPTION_KMS_KEY_ID)", id)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(wrapped[i+1:])
+	if err != nil {
+		return nil, fmt.Errorf("malformed wrapped data key: %w", err)
+	}
+	key, err := w.unwrap(ctx, sealed)
+	if err != nil {
+		return nil, fmt.Errorf("unwrapping data key: %w", err)
+	}
+	if len(key) != dataKeyLen {
+		return nil, fmt.Errorf("unwrapped data key has %d bytes", len(key))
+	}
+	return key, nil
+}
+
+// Open decrypts an object read from storage as it is read. Objects stored without encryption
+// have no wrapped key and come back as they are. obj is closed along with what Open returns.
+func (k *Keyring) Open(ctx context.Context, obj io.ReadCloser, wrapped string, size int64) (io.ReadCloser, error) {
+	if wrapped == "" {
+		return obj, nil
+	}
+	key, err := k.Unwrap(ctx, wrapped)
+	if err != nil {
+		obj.Close()
+		return nil, err
+	}
+	plain, err := Decrypt(obj, key, size)
+	if err != nil {
+		obj.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{plain, obj}, nil
+}
+
+// local is a master key from ENCRYPTION_KEYS
+type local struct {
+	kid  string
+	aead cipher.AEAD
+}
+
+// localAAD binds wrapped keys to their purpose
+var localAAD = []byte("docstream data key")
+
+func localKey(kid, secret string) (*local, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(secret))
+	if err != nil || len(raw) != 32 {
+		return nil, fmt.Errorf("encryption key %q must be 32 bytes in base64 (openssl rand -base64 32)", kid)
+	}
+	aead, err := newAEAD(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &local{kid: kid, aead: aead}, nil
+}
+
+func (l *local) id() string { return "local:" + l.kid }
+
+func (l *local) wrap(ctx context.Context, key []byte) ([]byte, error) {
+	nonce := make([]byte, l.aead.NonceSize(), l.aead.NonceSize()+len(key)+l.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return l.aead.Seal(nonce, nonce, key, localAAD), nil
+}
+
+func (l *local) unwrap(ctx context.Context, wrapped []byte) ([]byte, error) {
+	if len(wrapped) < l.aead.NonceSize() {
+		return nil, fmt.Errorf("wrapped key is too short")
+	}
+	nonce, sealed := wrapped[:l.aead.NonceSize()], wrapped[l.aead.NonceSize():]
+	return l.aead.Open(nil, nonce, sealed, localAAD)
+}
@@ -0,0 +1,167 @@
+// Package language guesses what language a document is written in. It goes by the script
+// first and, for scripts shared by many languages, by how many of each language's most common
+// words turn up. That is plenty for routing configuration and filtering searches, and needs
+// no model or service.
+package language
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SampleSize is how much of a document is looked at, the start of it says enough
+const SampleSize = 64 << 10
+
+// minLetters is the least a text needs to be judged, a table of numbers has no language
+const minLetters = 20
+
+// scripts that are written by one language, or near enough, by ISO 639-1 code
+var scriptLanguages = []struct {
+	table *unicode.RangeTable
+	code  string
+}{
+	{unicode.Hangul, "ko"},
+	{unicode.Thai, "th"},
+	{unicode.Greek, "el"},
+	{unicode.Hebrew, "he"},
+	{unicode.Devanagari, "hi"},
+	{unicode.Bengali, "bn"},
+	{unicode.Tamil, "ta"},
+	{unicode.Georgian, "ka"},
+	{unicode.Armenian, "hy"},
+}
+
+// the most common words of the languages written in Latin and Cyrillic letters. Words short
+// enough to turn up everywhere ("a", "i", "o") are left out.
+var stopwords = map[string]string{
+	"en": "the of and to in is that for it with as was on be by this are not or from at which have an but they were his her has had you",
+	"de": "der die und den das ist nicht sich mit dem des auf ein eine für von zu im auch als wird sind bei oder wie aus nach werden",
+	"fr": "le la les des est et une dans pour que qui pas sur avec sont du au ce il elle nous vous par plus mais ont été cette aux",
+	"es": "el la los las del que en y es por una con para como más pero sus le se al lo fue está son también muy este entre",
+	"it": "il la che di è per una sono del della non con gli anche le nel alla dei come più questo ma essere ha delle",
+	"pt": "que não uma os do da em para com por mais como são dos das mas foi ao também está pelo isso seu sua ele",
+	"nl": "de het een van en is dat niet op te zijn voor met die aan er als ook maar bij door wordt nog naar dan",
+	"sv": "och att det är som en på för av med den till inte har de om ett var jag men kan från vi också",
+	"da": "og at det er som en på for af med den til ikke har de et var jeg men kan fra hvad noget meget efter nogle blev mig",
+	"no": "og at det er som en på for av med den til ikke har de et var jeg men kan fra hva noe mye etter noen ble meg",
+	"fi": "ja on ei se että oli hän ovat kun mutta myös tai joka ole sen kanssa ne niin vain tämä jo mitä",
+	"pl": "w nie na się z że do to jest jak co ale po tak od za jego są przez dla czy tylko być",
+	"cs": "v se na je že to z do jako ale by jsou pro není jeho od po tak při který které také",
+	"tr": "ve bir bu da de için ile olarak çok daha ne gibi en ama olan var kadar sonra her değil mi",
+	"id": "dan yang di ini itu dengan untuk tidak dari dalam akan pada juga ke ada karena oleh saya mereka atau",
+	"ro": "și de la în este că pe cu nu un să din care mai pentru sunt fost ca sau lui",
+	"hu": "az és hogy nem is egy van de meg ez csak már mint el volt vagy ki azt még",
+	"vi": "và của là có không được những trong cho các một người với này đã để khi đến cũng",
+	"ru": "и в не на что с по как это я он а то из его но к за все так же от бы был она",
+	"uk": "і в не на що з та як це до у від за але його так я бути він вона також",
+	"bg": "и на в е да се за от че не с по са като това той но ще които или",
+}
+
+var stopwordSets = func() map[string]map[string]bool {
+	sets := make(map[string]map[string]bool, len(stopwords))
+	for code, words := range stopwords {
+		sets[code] = map[string]bool{}
+		for _, w := range strings.Fields(words) {
+			sets[code][w] = true
+		}
+	}
+	return sets
+}()
+
+// Detect returns the ISO 639-1 code of the language text is written in, "" when it can't tell
+func Detect(text string) string {
+	if len(text) > SampleSize {
+		cut := SampleSize
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		text = text[:cut]
+	}
+
+	counts := map[string]int{}
+	letters := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.Is(unicode.Latin, r):
+			counts["latin"]++
+		case unicode.Is(unicode.Cyrillic, r):
+			counts["cyrillic"]++
+		case unicode.Is(unicode.Han, r):
+			counts["han"]++
+		case unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r):
+			counts["kana"]++
+		case unicode.Is(unicode.Arabic, r):
+			counts["arabic"]++
+			if strings.ContainsRune("پچژگکی", r) {
+				counts["persian"]++
+			}
+		default:
+			for _, s := range scriptLanguages {
+				if unicode.Is(s.table, r) {
+					counts[s.code]++
+					break
+				}
+			}
+		}
+	}
+	if letters < minLetters {
+		return ""
+	}
+
+	script, most := "", 0
+	for s, n := range counts {
+		if n > most || (n == most && s < script) {
+			script, most = s, n
+		}
+	}
+	// japanese mixes in kanji, and kana alone is surely japanese
+	if counts["kana"] > 0 && counts["kana"]*10 >= counts["han"]+counts["kana"] && (script == "han" || script == "kana") {
+		return "ja"
+	}
+	switch script {
+	case "han":
+		return "zh"
+	case "arabic":
+		// the letters persian adds to the alphabet, a few of them show up in almost every sentence
+		if counts["persian"]*20 >= counts["arabic"] {
+			return "fa"
+		}
+		return "ar"
+	case "latin":
+		return byStopwords(text, "en", "de", "fr", "es", "it", "pt", "nl", "sv", "da", "no", "fi", "pl", "cs", "tr", "id", "ro", "hu", "vi")
+	case "cyrillic":
+		return byStopwords(text, "ru", "uk", "bg")
+	}
+	return script
+}
+
+// byStopwords picks whichever of the languages has the most of its common words in text
+func byStopwords(text string, codes ...string) string {
+	hits := map[string]int{}
+	words := 0
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) }) {
+		words++
+		for _, code := range codes {
+			if stopwordSets[code][w] {
+				hits[code]++
+			}
+		}
+	}
+
+	best := ""
+	for _, code := range codes {
+		if best == "" || hits[code] > hits[best] {
+			best = code
+		}
+	}
+	// in prose every tenth word or so is a common one, a list of names or part numbers has next to none
+	if hits[best] < 3 || hits[best]*20 < words {
+		return ""
+	}
+	return best
+}
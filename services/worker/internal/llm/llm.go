@@ -0,0 +1,180 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/worker/internal/config"
+)
+
+// Message is one turn of a chat
+type Message struct {
+	Role    string `json:"role"` // system, user or assistant
+	Content string `json:"content"`
+}
+
+// Chat roles
+const (
+	RoleSystem = "system"
+	RoleUser   = "user"
+)
+
+// Usage is the tokens a completion took as the provider counted them, zero when it didn't say
+type Usage struct {
+	InputTokens  int
+	OutputTokens int
+}
+
+// Provider answers a chat with a completion
+type Provider interface {
+	Name() string
+	Model() string
+	// WithModel is the same provider asking model instead
+	WithModel(model string) Provider
+	Complete(ctx context.Context, messages []Message) (string, Usage, error)
+}
+
+// New picks the provider named by cfg.Provider: "openai" (or anything speaking its chat
+// completions API through the OpenAI base URL) or "ollama". It returns nil when that is
+// empty, which turns summaries off.
+func New(cfg config.Summaries, providers config.Providers) (Provider, error) {
+	switch cfg.Provider {
+	case "":
+		return nil, nil
+	case "openai":
+		if providers.OpenAIAPIKey == "" {
+			return nil, fmt.Errorf("OPENAI_API_KEY is required for the openai summary provider")
+		}
+		return &openAI{baseURL: strings.TrimRight(providers.OpenAIBaseURL, "/"), apiKey: providers.OpenAIAPIKey, model: orDefault(cfg.Model, "gpt-4o-mini")}, nil
+	case "ollama":
+		return &ollama{baseURL: strings.TrimRight(providers.OllamaURL, "/"), model: orDefault(cfg.Model, "llama3.1")}, nil
+	default:
+		return nil, fmt.Errorf("unknown SUMMARY_PROVIDER %q, use openai or ollama", cfg.Provider)
+	}
+}
+
+// HTTPError is a non-2xx answer from a provider
+type HTTPError struct {
+	Status int
+	Body   string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("provider returned %d: %s", e.Status, e.Body)
+}
+
+// openAI calls /chat/completions
+type openAI struct {
+	baseURL string
+	apiKey  string
+	model   string
+}
+
+func (p *openAI) Name() string  { return "openai" }
+func (p *openAI) Model() string { return p.model }
+
+func (p *openAI) WithModel(model string) Provider {
+	other := *p
+	other.model = model
+	return &other
+}
+
+func (p *openAI) Complete(ctx context.Context, messages []Message) (string, Usage, error) {
+	body := map[string]any{"model": p.model, "messages": messages}
+	headers := map[string]string{"Authorization": "Bearer " + p.apiKey}
+
+	var out struct {
+		Choices []struct {
+			Message Message `json:"message"`
+		} `json:"choices"`
+		Usage struct {
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+		} `json:"usage"`
+	}
+	if err := post(ctx, p.baseURL+"/chat/completions", headers, body, &out); err != nil {
+		return "", Usage{}, err
+	}
+	usage := Usage{InputTokens: out.Usage.PromptTokens, OutputTokens: out.Usage.CompletionTokens}
+	if len(out.Choices) == 0 {
+		return "", usage, fmt.Errorf("openai returned no choices")
+	}
+	return out.Choices[0].Message.Content, usage, nil
+}
+
+// ollama calls /api/chat
+type ollama struct {
+	baseURL string
+	model   string
+}
+
+func (p *ollama) Name() string  { return "ollama" }
+func (p *ollama) Model() string { return p.model }
+
+func (p *ollama) WithModel(model string) Provider {
+	other := *p
+	other.model = model
+	return &other
+}
+
+func (p *ollama) Complete(ctx context.Context, messages []Message) (string, Usage, error) {
+	body := map[string]any{"model": p.model, "messages": messages, "stream": false}
+
+	var out struct {
+		Message         Message `json:"message"`
+		Error           string  `json:"error"`
+		PromptEvalCount int     `json:"prompt_eval_count"`
+		EvalCount       int     `json:"eval_count"`
+	}
+	if err := post(ctx, p.baseURL+"/api/chat", nil, body, &out); err != nil {
+		return "", Usage{}, err
+	}
+	if out.Error != "" {
+		return "", Usage{}, fmt.Errorf("ollama: %s", out.Error)
+	}
+	return out.Message.Content, Usage{InputTokens: out.PromptEvalCount, OutputTokens: out.EvalCount}, nil
+}
+
+// httpClient gives a slow model a few minutes, the job's context still bounds it
+var httpClient = &http.Client{Timeout: 5 * time.Minute}
+
+// post sends body to url and decodes the JSON answer into out
+func post(ctx context.Context, url string, headers map[string]string, body, out any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &HTTPError{Status: resp.StatusCode, Body: string(bytes.TrimSpace(msg))}
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func orDefault(v, fallback string) string {
+	if v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,53 @@
+package locks
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Locks are claims on a piece of work that expire unless they are extended, so a crashed
+// worker's claim doesn't outlive it. The work a claim finished can be recorded under the same key.
+type Locks interface {
+	// Lock claims key for owner, ok is false and holder says who has it while someone else
+	// does. Owner taking its own key again just extends it.
+	Lock(ctx context.Context, key, owner string, ttl time.Duration) (ok bool, holder string, err error)
+	// Extend keeps owner's claim for another ttl, false when owner doesn't hold it anymore
+	Extend(ctx context.Context, key, owner string, ttl time.Duration) (bool, error)
+	// Unlock gives key up if owner still holds it
+	Unlock(ctx context.Context, key, owner string) error
+	// SetDone records what the work under key came to, kept for keep
+	SetDone(ctx context.Context, key string, done Done, keep time.Duration) error
+	// GetDone returns what SetDone recorded, found is false when there's nothing (anymore)
+	GetDone(ctx context.Context, key string) (done Done, found bool, err error)
+}
+
+// Done is a job that finished the work under a key
+type Done struct {
+	JobID      string `json:"job_id"`
+	Language   string `json:"language,omitempty"`
+	Class      string `json:"class,omitempty"`
+	FinishedAt int64  `json:"finished_at"` // unix seconds, like a job's timestamp
+}
+
+// New picks the backend: Redis when redisURL is set so every worker sees the same locks,
+// otherwise they only cover the jobs running in this process
+func New(redisURL string) (Locks, error) {
+	if redisURL == "" {
+		log.Println("REDIS_URL not set, duplicate jobs are only caught within this worker")
+		return NewMemory(), nil
+	}
+
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, err
+	}
+	client := redis.NewClient(opts)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return NewRedis(client), nil
+}
@@ -0,0 +1,101 @@
+package locks
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const sweepInterval = time.Minute
+
+type entry struct {
+	owner   string
+	done    Done
+	expires time.Time
+}
+
+// Memory keeps locks in this process, fine for a single worker
+type Memory struct {
+	mu    sync.Mutex
+	locks map[string]entry
+	done  map[string]entry
+}
+
+func NewMemory() *Memory {
+	m := &Memory{locks: map[string]entry{}, done: map[string]entry{}}
+	go m.sweep()
+	return m
+}
+
+func (m *Memory) Lock(ctx context.Context, key, owner string, ttl time.Duration) (bool, string, error) {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if e, ok := m.locks[key]; ok && e.owner != owner && now.Before(e.expires) {
+		return false, e.owner, nil
+	}
+	m.locks[key] = entry{owner: owner, expires: now.Add(ttl)}
+	return true, owner, nil
+}
+
+func (m *Memory) Extend(ctx context.Context, key, owner string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.locks[key]
+	if !ok || e.owner != owner || !now.Before(e.expires) {
+		return false, nil
+	}
+	e.expires = now.Add(ttl)
+	m.locks[key] = e
+	return true, nil
+}
+
+func (m *Memory) Unlock(ctx context.Context, key, owner string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if e, ok := m.locks[key]; ok && e.owner == owner {
+		delete(m.locks, key)
+	}
+	return nil
+}
+
+func (m *Memory) SetDone(ctx context.Context, key string, done Done, keep time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.done[key] = entry{done: done, expires: time.Now().Add(keep)}
+	return nil
+}
+
+func (m *Memory) GetDone(ctx context.Context, key string) (Done, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.done[key]
+	if !ok || !time.Now().Before(e.expires) {
+		return Done{}, false, nil
+	}
+	return e.done, true, nil
+}
+
+// sweep drops expired locks and results, they'd be ignored anyway
+func (m *Memory) sweep() {
+	for range time.Tick(sweepInterval) {
+		now := time.Now()
+		m.mu.Lock()
+		for _, entries := range []map[string]entry{m.locks, m.done} {
+			for key, e := range entries {
+				if !now.Before(e.expires) {
+					delete(entries, key)
+				}
+			}
+		}
+		m.mu.Unlock()
+	}
+}
@@ -0,0 +1,81 @@
+package locks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// the lock is taken, extended and given up in one script each, so a claim that expired and
+// went to another worker in between is never touched
+var (
+	lockScript = redis.NewScript(`
+local holder = redis.call('GET', KEYS[1])
+if holder and holder ~= ARGV[1] then
+	return holder
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return ARGV[1]
+`)
+	extendScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+	unlockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+)
+
+// Redis shares locks between workers
+type Redis struct {
+	client *redis.Client
+}
+
+func NewRedis(client *redis.Client) *Redis {
+	return &Redis{client: client}
+}
+
+func (r *Redis) Lock(ctx context.Context, key, owner string, ttl time.Duration) (bool, string, error) {
+	holder, err := lockScript.Run(ctx, r.client, []string{"lock:" + key}, owner, ttl.Milliseconds()).Text()
+	if err != nil {
+		return false, "", err
+	}
+	return holder == owner, holder, nil
+}
+
+func (r *Redis) Extend(ctx context.Context, key, owner string, ttl time.Duration) (bool, error) {
+	n, err := extendScript.Run(ctx, r.client, []string{"lock:" + key}, owner, ttl.Milliseconds()).Int()
+	return n == 1, err
+}
+
+func (r *Redis) Unlock(ctx context.Context, key, owner string) error {
+	return unlockScript.Run(ctx, r.client, []string{"lock:" + key}, owner).Err()
+}
+
+func (r *Redis) SetDone(ctx context.Context, key string, done Done, keep time.Duration) error {
+	body, err := json.Marshal(done)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(ctx, "done:"+key, body, keep).Err()
+}
+
+func (r *Redis) GetDone(ctx context.Context, key string) (Done, bool, error) {
+	var done Done
+	body, err := r.client.Get(ctx, "done:"+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return done, false, nil
+	}
+	if err != nil {
+		return done, false, err
+	}
+	return done, true, json.Unmarshal(body, &done)
+}
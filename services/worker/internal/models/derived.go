@@ -0,0 +1,12 @@
+package models
+
+// Files the thumbnail stage renders for a document, these must match the gateway's models
+const (
+	ThumbnailFile = "thumbnail.png"
+	PreviewFile   = "preview.png"
+)
+
+// DerivedKey is where a file rendered from a document is stored, in the document's bucket
+func DerivedKey(documentID, file string) string {
+	return "derived/" + documentID + "/" + file
+}
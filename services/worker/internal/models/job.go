@@ -0,0 +1,156 @@
+package models
+
+// Job is the "Ticket" the gateway publishes on the ingestion queue
+type Job struct {
+	JobID      string `json:"job_id"`
+	DocumentID string `json:"document_id"`
+	UserID     int    `json:"user_id"`
+	OrgID      string `json:"org_id,omitempty"` // set when the document belongs to an organization
+	Filename   string `json:"filename"`
+	Bucket     string `json:"bucket"`
+	FileSize   int64  `json:"file_size"`
+	SHA256     string `json:"sha256,omitempty"` // hex digest of the content, empty for documents uploaded before it was recorded
+	Status     string `json:"status"`
+	Timestamp  int64  `json:"timestamp"`
+	// Options override the worker's defaults for this job, all optional
+	Options JobOptions `json:"options"`
+	// Tags and Metadata are what the uploader attached to the document, they go onto every vector
+	Tags     []string          `json:"tags,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// EncryptionKey is the wrapped data key the object is encrypted with, empty when it is stored in plain
+	EncryptionKey string `json:"encryption_key,omitempty"`
+	// Collection is the vector collection to index into instead of COLLECTION_NAME, set by an
+	// embedding migration and on every job after one completed
+	Collection string `json:"collection,omitempty"`
+	// ReplacesIndex is set when an earlier job of the document completed into Collection, the
+	// points this one writes overwrite that job's
+	ReplacesIndex bool `json:"replaces_index,omitempty"`
+}
+
+// JobOptions are per-job pipeline settings, zero values mean "use the worker's default"
+type JobOptions struct {
+	ChunkStrategy string `json:"chunk_strategy,omitempty"` // tokens, sentences or markdown
+	ChunkSize     int    `json:"chunk_size,omitempty"`     // in tokens
+	ChunkOverlap  int    `json:"chunk_overlap,omitempty"`  // in tokens
+	// EmbeddingModel must be one the configured provider can serve
+	EmbeddingModel string `json:"embedding_model,omitempty"`
+	// SummaryModel is the generation model the summarize stage asks instead of SUMMARY_MODEL,
+	// served by the configured provider
+	SummaryModel string `json:"summary_model,omitempty"`
+	// Pipeline is the stages to run in order, comma separated, instead of the worker's route for
+	// the document's format
+	Pipeline string `json:"pipeline,omitempty"`
+	// Skip are stages left out of whatever the document goes through, comma separated, like ocr
+	// on a plan without it
+	Skip string `json:"skip,omitempty"`
+}
+
+// Chunk is a piece of a document's text ready to be embedded
+type Chunk struct {
+	Index   int    `json:"index"`
+	Text    string `json:"text"`
+	Start   int    `json:"start"` // byte offsets into the extracted text
+	End     int    `json:"end"`
+	Tokens  int    `json:"tokens"`
+	Page    int    `json:"page,omitempty"` // 1-based PDF page, slide or sheet
+	Heading string `json:"heading,omitempty"`
+	// Embedding is filled in by the embed stage, nil when embedding is off
+	Embedding []float32 `json:"embedding,omitempty"`
+}
+
+// Tombstone is published by the gateway once a document is purged for good
+type Tombstone struct {
+	Type       string `json:"type"`
+	DocumentID string `json:"document_id"`
+	UserID     int    `json:"user_id"`
+	Timestamp  int64  `json:"timestamp"`
+	// Collections are the vector collections besides COLLECTION_NAME the document may have points in
+	Collections []string `json:"collections,omitempty"`
+}
+
+// Cancellation is published by the gateway when a user cancels a job
+type Cancellation struct {
+	JobID      string `json:"job_id"`
+	DocumentID string `json:"document_id"`
+	Timestamp  int64  `json:"timestamp"`
+}
+
+// Result is published back to the gateway whenever a job changes status
+type Result struct {
+	JobID     string `json:"job_id"`
+	Status    string `json:"status"`
+	Stage     string `json:"stage,omitempty"`      // the pipeline stage that failed, if any
+	StageDone string `json:"stage_done,omitempty"` // a stage that just got through, sent with status processing
+	Error     string `json:"error,omitempty"`
+	Language  string `json:"language,omitempty"` // what the worker detected, on completed jobs
+	Class     string `json:"class,omitempty"`    // what the classify stage labelled it, on completed jobs
+	// Entities are what the entities stage found, on completed jobs that ran it
+	Entities []Entity `json:"entities,omitempty"`
+	// Summary and KeyPoints are what the summarize stage wrote, on completed jobs that ran it
+	Summary   string   `json:"summary,omitempty"`
+	KeyPoints []string `json:"key_points,omitempty"`
+	// Keywords is chunk text for the gateway's keyword index, sent with status processing
+	Keywords *Keywords `json:"keywords,omitempty"`
+	// Usage is what the job consumed, on completed jobs. The gateway meters it for billing.
+	Usage     *Usage `json:"usage,omitempty"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// Usage counts what processing a document took. Tokens are as the providers counted them,
+// or as the chunker did for embeddings.
+type Usage struct {
+	Pages           int `json:"pages"` // PDF pages, slides or sheets, 1 for a document without any
+	EmbeddingTokens int `json:"embedding_tokens,omitempty"`
+	LLMInputTokens  int `json:"llm_input_tokens,omitempty"`
+	LLMOutputTokens int `json:"llm_output_tokens,omitempty"`
+}
+
+// Keywords carry the text of a document's chunks to the gateway, which indexes it for keyword
+// search. A job sends them a batch at a time, then once more with Final set and Total, the
+// number of chunks it made, so the gateway can drop the ones earlier runs left behind.
+type Keywords struct {
+	DocumentID string `json:"document_id"`
+	UserID     int    `json:"user_id"`
+	OrgID      string `json:"org_id,omitempty"`
+	// Language, Tags and Entities are what searches filter on, the same as on the vector points
+	Language string   `json:"language,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Entities []string `json:"entities,omitempty"`
+	Chunks   []Chunk  `json:"chunks,omitempty"` // without their embeddings
+	Final    bool     `json:"final,omitempty"`
+	Total    int      `json:"total,omitempty"`
+}
+
+// Entity is a person, organization, date or amount the text mentions
+type Entity struct {
+	Type  string `json:"type"`
+	Value string `json:"value"` // as it was first written
+	Count int    `json:"count"` // how often it comes up
+}
+
+// Event is a progress update fanned out to clients watching a job live.
+// Type "status" carries a job status change, "stage" says which pipeline stage just started.
+type Event struct {
+	JobID     string `json:"job_id"`
+	UserID    int    `json:"user_id"`
+	Type      string `json:"type"`
+	Status    string `json:"status,omitempty"`
+	Stage     string `json:"stage,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// Event types
+const (
+	EventTypeStatus = "status"
+	EventTypeStage  = "stage"
+)
+
+// Job statuses, these must match the gateway's models
+const (
+	JobStatusQueued     = "queued"
+	JobStatusProcessing = "processing"
+	JobStatusCompleted  = "completed"
+	JobStatusFailed     = "failed"
+	JobStatusCancelled  = "cancelled"
+)
@@ -0,0 +1,396 @@
+package objectstore
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/sas"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
+	"github.com/dhruvkshah75/docstream/worker/internal/config"
+	"github.com/google/uuid"
+)
+
+// how often a server side copy is checked on until it finishes
+const azureCopyPoll = 500 * time.Millisecond
+
+// azureStore keeps objects as block blobs, buckets are containers. Multipart uploads
+// stage one block per part and commit the block list to finish.
+type azureStore struct {
+	client *azblob.Client
+	// key signs SAS URLs when there is an account key, without one they are signed
+	// with a user delegation key fetched through Entra ID
+	key   *azblob.SharedKeyCredential
+	guard *offlineGuard
+}
+
+func newAzure(cfg config.Azure) (*azureStore, error) {
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.blob.core.windows.net/", cfg.Account)
+	}
+
+	// the default backoff takes ~10s to give up on an unreachable account, keep it close to the other backends
+	opts := &azblob.ClientOptions{ClientOptions: azcore.ClientOptions{
+		Retry: policy.RetryOptions{MaxRetries: 2, RetryDelay: 200 * time.Millisecond, MaxRetryDelay: time.Second},
+	}}
+
+	s := &azureStore{}
+	var err error
+	if cfg.Key != "" {
+		if s.key, err = azblob.NewSharedKeyCredential(cfg.Account, cfg.Key); err != nil {
+			return nil, fmt.Errorf("azure account key: %w", err)
+		}
+		s.client, err = azblob.NewClientWithSharedKeyCredential(endpoint, s.key, opts)
+	} else {
+		// environment, workload identity, managed identity or az login, whichever is there
+		cred, credErr := azidentity.NewDefaultAzureCredential(nil)
+		if credErr != nil {
+			return nil, fmt.Errorf("azure credentials: %w", credErr)
+		}
+		s.client, err = azblob.NewClient(endpoint, cred, opts)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("creating Azure Blob client: %w", err)
+	}
+
+	log.Println("Using Azure Blob Storage account", cfg.Account)
+	s.guard = &offlineGuard{name: "Azure Blob Storage", unreachable: networkError, ping: func(ctx context.Context) error {
+		_, err := s.client.ServiceClient().GetProperties(ctx, nil)
+		return err
+	}}
+	return s, nil
+}
+
+func (s *azureStore) Name() string { return "azure" }
+
+func (s *azureStore) blob(bucket, key string) *blob.Client {
+	return s.client.ServiceClient().NewContainerClient(bucket).NewBlobClient(key)
+}
+
+func (s *azureStore) Put(ctx context.Context, bucket, key string, r io.Reader, size int64, contentType string) (ObjectInfo, error) {
+	counter := &countingReader{r: r}
+	var resp azblob.UploadStreamResponse
+	err := s.call(func() (err error) {
+		resp, err = s.client.UploadStream(ctx, bucket, key, counter, &azblob.UploadStreamOptions{
+			HTTPHeaders: &blob.HTTPHeaders{BlobContentType: to.Ptr(contentType)},
+		})
+		return err
+	})
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	if size >= 0 && counter.n != size {
+		// the blob is committed by now, don't leave a truncated one behind
+		s.Delete(context.WithoutCancel(ctx), bucket, key)
+		return ObjectInfo{}, fmt.Errorf("expected %d bytes, got %d", size, counter.n)
+	}
+	return ObjectInfo{Key: key, Size: counter.n, ETag: azureETag(resp.ETag), ContentType: contentType, LastModified: deref(resp.LastModified)}, nil
+}
+
+func (s *azureStore) Get(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	var resp azblob.DownloadStreamResponse
+	err := s.call(func() (err error) {
+		resp, err = s.client.DownloadStream(ctx, bucket, key, nil)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *azureStore) Stat(ctx context.Context, bucket, key string) (ObjectInfo, error) {
+	var props blob.GetPropertiesResponse
+	err := s.call(func() (err error) {
+		props, err = s.blob(bucket, key).GetProperties(ctx, nil)
+		return err
+	})
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{
+		Key:          key,
+		Size:         deref(props.ContentLength),
+		ETag:         azureETag(props.ETag),
+		ContentType:  deref(props.ContentType),
+		LastModified: deref(props.LastModified),
+	}, nil
+}
+
+func (s *azureStore) Delete(ctx context.Context, bucket, key string) error {
+	err := s.call(func() error {
+		_, err := s.client.DeleteBlob(ctx, bucket, key, nil)
+		return err
+	})
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// Copy is a server side copy. The source is handed over as a SAS URL so it works the same
+// with an account key and with Entra ID, then the copy is waited on since Azure runs it async.
+func (s *azureStore) Copy(ctx context.Context, bucket, srcKey, dstKey string) error {
+	src, err := s.Presign(ctx, bucket, srcKey, 15*time.Minute, "")
+	if err != nil {
+		return err
+	}
+	dst := s.blob(bucket, dstKey)
+
+	var status *blob.CopyStatusType
+	err = s.call(func() error {
+		resp, err := dst.StartCopyFromURL(ctx, src.String(), nil)
+		status = resp.CopyStatus
+		return err
+	})
+	for err == nil && status != nil && *status == blob.CopyStatusTypePending {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(azureCopyPoll):
+		}
+		err = s.call(func() error {
+			props, err := dst.GetProperties(ctx, nil)
+			status = props.CopyStatus
+			return err
+		})
+	}
+	if err != nil {
+		return err
+	}
+	if status != nil && *status != blob.CopyStatusTypeSuccess {
+		return fmt.Errorf("copying %s to %s: %s", srcKey, dstKey, *status)
+	}
+	return nil
+}
+
+// Presign hands out a read-only SAS URL
+func (s *azureStore) Presign(ctx context.Context, bucket, key string, expiry time.Duration, filename string) (*url.URL, error) {
+	now := time.Now().UTC()
+	values := sas.BlobSignatureValues{
+		// a little slack for clocks that are behind ours
+		StartTime:     now.Add(-5 * time.Minute),
+		ExpiryTime:    now.Add(expiry),
+		Permissions:   (&sas.BlobPermissions{Read: true}).String(),
+		ContainerName: bucket,
+		BlobName:      key,
+	}
+	if filename != "" {
+		values.ContentDisposition = contentDisposition(filename)
+	}
+
+	var params sas.QueryParameters
+	var err error
+	if s.key != nil {
+		params, err = values.SignWithSharedKey(s.key)
+	} else {
+		// needs a role that may delegate, e.g. Storage Blob Delegator, a key is good for 7 days at most
+		var delegation *service.UserDelegationCredential
+		err = s.call(func() (err error) {
+			delegation, err = s.client.ServiceClient().GetUserDelegationCredential(ctx, service.KeyInfo{
+				Start:  to.Ptr(values.StartTime.Format(sas.TimeFormat)),
+				Expiry: to.Ptr(values.ExpiryTime.Format(sas.TimeFormat)),
+			}, nil)
+			return err
+		})
+		if err == nil {
+			params, err = values.SignWithUserDelegation(delegation)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return url.Parse(s.blob(bucket, key).URL() + "?" + params.Encode())
+}
+
+// CreateMultipart has nothing to create, blocks are staged against the blob itself.
+// The upload ID carries the content type along since nothing can hold it until the commit.
+func (s *azureStore) CreateMultipart(ctx context.Context, bucket, key, contentType string) (string, error) {
+	return uuid.NewString() + ";" + contentType, nil
+}
+
+// parseAzureUpload splits an upload ID back into its UUID and content type
+func parseAzureUpload(uploadID string) (uuid.UUID, string, error) {
+	raw, contentType, _ := strings.Cut(uploadID, ";")
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return uuid.UUID{}, "", fmt.Errorf("invalid upload ID %q", uploadID)
+	}
+	return id, contentType, nil
+}
+
+// azureBlockID names a part's block after its upload, number and MD5, so blocks of other
+// uploads to the same blob can't get mixed in and a wrong ETag names a block that doesn't exist.
+// Every block ID of a blob has to be the same length, 59 bytes here.
+func azureBlockID(id uuid.UUID, number int, etag string) (string, error) {
+	sum, err := hex.DecodeString(etag)
+	if err != nil || len(sum) != md5.Size {
+		return "", fmt.Errorf("invalid ETag %q for part %d", etag, number)
+	}
+	raw := fmt.Sprintf("%x%05d%s", id[:], number, base64.RawStdEncoding.EncodeToString(sum))
+	return base64.StdEncoding.EncodeToString([]byte(raw)), nil
+}
+
+func (s *azureStore) PutPart(ctx context.Context, bucket, key, uploadID string, number int, r io.Reader, size int64) (Part, error) {
+	id, _, err := parseAzureUpload(uploadID)
+	if err != nil {
+		return Part{}, err
+	}
+
+	// StageBlock rewinds the body to retry, so a part read straight off the request is spooled first
+	f, written, sum, err := spool(r, size)
+	if err != nil {
+		return Part{}, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	etag := hex.EncodeToString(sum)
+	blockID, _ := azureBlockID(id, number, etag)
+	err = s.call(func() error {
+		_, err := s.client.ServiceClient().NewContainerClient(bucket).NewBlockBlobClient(key).StageBlock(ctx, blockID, f, &blockblob.StageBlockOptions{
+			TransactionalValidation: blob.TransferValidationTypeMD5(sum),
+		})
+		return err
+	})
+	if err != nil {
+		return Part{}, err
+	}
+	return Part{Number: number, ETag: etag, Size: written}, nil
+}
+
+func (s *azureStore) CompleteMultipart(ctx context.Context, bucket, key, uploadID string, parts []Part) (ObjectInfo, error) {
+	id, contentType, err := parseAzureUpload(uploadID)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	blockIDs := make([]string, len(parts))
+	var size int64
+	for i, p := range parts {
+		if blockIDs[i], err = azureBlockID(id, p.Number, p.ETag); err != nil {
+			return ObjectInfo{}, &RejectedError{Message: err.Error(), Err: err}
+		}
+		size += p.Size
+	}
+
+	var resp blockblob.CommitBlockListResponse
+	err = s.call(func() (err error) {
+		resp, err = s.client.ServiceClient().NewContainerClient(bucket).NewBlockBlobClient(key).CommitBlockList(ctx, blockIDs, &blockblob.CommitBlockListOptions{
+			HTTPHeaders: &blob.HTTPHeaders{BlobContentType: to.Ptr(contentType)},
+		})
+		return err
+	})
+	if bloberror.HasCode(err, bloberror.InvalidBlockList) {
+		return ObjectInfo{}, &RejectedError{Message: "a part doesn't match what was uploaded", Err: err}
+	} else if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{Key: key, Size: size, ETag: azureETag(resp.ETag), ContentType: contentType, LastModified: deref(resp.LastModified)}, nil
+}
+
+// AbortMultipart has nothing to do, Azure has no call to drop staged blocks and throws
+// away the ones that were never committed after a week
+func (s *azureStore) AbortMultipart(ctx context.Context, bucket, key, uploadID string) error {
+	_, _, err := parseAzureUpload(uploadID)
+	return err
+}
+
+func (s *azureStore) BucketExists(ctx context.Context, bucket string) (bool, error) {
+	err := s.call(func() error {
+		_, err := s.client.ServiceClient().NewContainerClient(bucket).GetProperties(ctx, nil)
+		return err
+	})
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *azureStore) MakeBucket(ctx context.Context, bucket string) error {
+	return s.call(func() error {
+		_, err := s.client.CreateContainer(ctx, bucket, nil)
+		return err
+	})
+}
+
+func (s *azureStore) Available() error { return s.guard.Available() }
+
+// call runs one request through the offline guard, not found errors come back as ErrNotFound
+func (s *azureStore) call(fn func() error) error {
+	err := s.guard.do(fn)
+	if bloberror.HasCode(err, bloberror.BlobNotFound, bloberror.ContainerNotFound) {
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+	return err
+}
+
+// azureETag drops the quotes Azure puts around ETags
+func azureETag(etag *azcore.ETag) string {
+	if etag == nil {
+		return ""
+	}
+	return strings.Trim(string(*etag), `"`)
+}
+
+// spool copies r into a temp file, checking it came to size bytes, and returns it rewound
+// along with its size and MD5. The caller closes and removes it.
+func spool(r io.Reader, size int64) (*os.File, int64, []byte, error) {
+	f, err := os.CreateTemp("", "docstream-part-*")
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	hasher := md5.New()
+	written, err := io.Copy(io.MultiWriter(f, hasher), r)
+	if err == nil && written != size {
+		err = fmt.Errorf("expected %d bytes, got %d", size, written)
+	}
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, 0, nil, err
+	}
+	return f, written, hasher.Sum(nil), nil
+}
+
+// countingReader counts what has been read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// deref is the zero value for a nil pointer, the SDK leaves most response fields optional
+func deref[T any](p *T) T {
+	if p == nil {
+		var zero T
+		return zero
+	}
+	return *p
+}
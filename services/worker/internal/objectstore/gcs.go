@@ -0,0 +1,331 @@
+package objectstore
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/dhruvkshah75/docstream/worker/internal/config"
+	"github.com/google/uuid"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+// GCS composes at most this many objects into one per request
+const maxComposeSources = 32
+
+// gcsStore keeps objects in Google Cloud Storage. The Go client has no S3 style multipart
+// upload, so parts are stored as objects of their own under .uploads/<upload ID>/ and
+// composed into the final object, the same way gsutil does parallel uploads.
+type gcsStore struct {
+	client    *storage.Client
+	projectID string
+	guard     *offlineGuard
+}
+
+func newGCS(ctx context.Context, cfg config.GCS) (*gcsStore, error) {
+	var opts []option.ClientOption
+	if cfg.Endpoint != "" {
+		opts = append(opts, option.WithEndpoint(cfg.Endpoint), option.WithoutAuthentication())
+	}
+	client, err := storage.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating GCS client: %w", err)
+	}
+	// the client retries until the context runs out by default, that would hold a request for minutes
+	client.SetRetry(storage.WithMaxAttempts(3))
+
+	log.Println("Using Google Cloud Storage for objects")
+	guard := &offlineGuard{name: "GCS", unreachable: networkError, ping: func(ctx context.Context) error {
+		// any bucket will do, a 404 or 403 means GCS answered
+		_, err := client.Bucket("docstream-probe").Attrs(ctx)
+		return err
+	}}
+	return &gcsStore{client: client, projectID: cfg.ProjectID, guard: guard}, nil
+}
+
+func (s *gcsStore) Name() string { return "gcs" }
+
+func (s *gcsStore) Put(ctx context.Context, bucket, key string, r io.Reader, size int64, contentType string) (ObjectInfo, error) {
+	var attrs *storage.ObjectAttrs
+	err := s.call(func() error {
+		var err error
+		attrs, err = s.write(ctx, s.client.Bucket(bucket).Object(key), r, size, contentType)
+		return err
+	})
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return gcsInfo(attrs), nil
+}
+
+// write streams r into obj, checking it came to size bytes unless size is -1
+func (s *gcsStore) write(ctx context.Context, obj *storage.ObjectHandle, r io.Reader, size int64, contentType string) (*storage.ObjectAttrs, error) {
+	// cancelling the writer's context is the only way to abandon a half written object
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w := obj.NewWriter(ctx)
+	w.ContentType = contentType
+	written, err := io.Copy(w, r)
+	if err == nil && size >= 0 && written != size {
+		err = fmt.Errorf("expected %d bytes, got %d", size, written)
+	}
+	if err != nil {
+		cancel()
+		w.Close()
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return w.Attrs(), nil
+}
+
+func (s *gcsStore) Get(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	var r *storage.Reader
+	err := s.call(func() (err error) {
+		r, err = s.client.Bucket(bucket).Object(key).NewReader(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (s *gcsStore) Stat(ctx context.Context, bucket, key string) (ObjectInfo, error) {
+	var attrs *storage.ObjectAttrs
+	err := s.call(func() (err error) {
+		attrs, err = s.client.Bucket(bucket).Object(key).Attrs(ctx)
+		return err
+	})
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return gcsInfo(attrs), nil
+}
+
+func (s *gcsStore) Delete(ctx context.Context, bucket, key string) error {
+	err := s.call(func() error {
+		return s.client.Bucket(bucket).Object(key).Delete(ctx)
+	})
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (s *gcsStore) Copy(ctx context.Context, bucket, srcKey, dstKey string) error {
+	b := s.client.Bucket(bucket)
+	return s.call(func() error {
+		_, err := b.Object(dstKey).CopierFrom(b.Object(srcKey)).Run(ctx)
+		return err
+	})
+}
+
+// Presign signs a V4 URL locally with a service account key, or through the IAM
+// signBlob API when running as a service account without one
+func (s *gcsStore) Presign(ctx context.Context, bucket, key string, expiry time.Duration, filename string) (*url.URL, error) {
+	opts := &storage.SignedURLOptions{
+		Scheme:  storage.SigningSchemeV4,
+		Method:  "GET",
+		Expires: time.Now().Add(expiry),
+	}
+	if filename != "" {
+		opts.QueryParameters = url.Values{"response-content-disposition": {contentDisposition(filename)}}
+	}
+	signed, err := s.client.Bucket(bucket).SignedURL(key, opts)
+	if err != nil {
+		return nil, err
+	}
+	return url.Parse(signed)
+}
+
+// gcsUploadPrefix is where the parts of an upload wait to be composed
+func gcsUploadPrefix(uploadID string) (string, error) {
+	if _, err := uuid.Parse(uploadID); err != nil {
+		return "", fmt.Errorf("invalid upload ID %q", uploadID)
+	}
+	return uploadsDir + "/" + uploadID + "/", nil
+}
+
+// CreateMultipart leaves an empty marker object behind, it remembers the content type
+// and tells a real upload ID from a made up one
+func (s *gcsStore) CreateMultipart(ctx context.Context, bucket, key, contentType string) (string, error) {
+	id := uuid.NewString()
+	prefix, _ := gcsUploadPrefix(id)
+	err := s.call(func() error {
+		_, err := s.write(ctx, s.client.Bucket(bucket).Object(prefix+"upload"), strings.NewReader(""), 0, contentType)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func (s *gcsStore) PutPart(ctx context.Context, bucket, key, uploadID string, number int, r io.Reader, size int64) (Part, error) {
+	prefix, err := gcsUploadPrefix(uploadID)
+	if err != nil {
+		return Part{}, err
+	}
+	var attrs *storage.ObjectAttrs
+	err = s.call(func() (err error) {
+		attrs, err = s.write(ctx, s.client.Bucket(bucket).Object(prefix+strconv.Itoa(number)), r, size, "")
+		return err
+	})
+	if err != nil {
+		return Part{}, err
+	}
+	return Part{Number: number, ETag: gcsETag(attrs), Size: attrs.Size}, nil
+}
+
+func (s *gcsStore) CompleteMultipart(ctx context.Context, bucket, key, uploadID string, parts []Part) (ObjectInfo, error) {
+	prefix, err := gcsUploadPrefix(uploadID)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	b := s.client.Bucket(bucket)
+
+	marker, err := s.attrs(ctx, b.Object(prefix+"upload"))
+	if errors.Is(err, ErrNotFound) {
+		return ObjectInfo{}, &RejectedError{Message: "upload " + uploadID + " doesn't exist", Err: err}
+	} else if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	sources := make([]*storage.ObjectHandle, len(parts))
+	for i, p := range parts {
+		obj := b.Object(prefix + strconv.Itoa(p.Number))
+		attrs, err := s.attrs(ctx, obj)
+		if errors.Is(err, ErrNotFound) {
+			return ObjectInfo{}, &RejectedError{Message: fmt.Sprintf("part %d was never uploaded", p.Number), Err: err}
+		} else if err != nil {
+			return ObjectInfo{}, err
+		}
+		if gcsETag(attrs) != p.ETag {
+			return ObjectInfo{}, &RejectedError{Message: fmt.Sprintf("part %d doesn't match its ETag", p.Number)}
+		}
+		sources[i] = obj
+	}
+
+	// more than 32 parts are composed in rounds, each one folding 32 objects into one
+	for round := 0; len(sources) > maxComposeSources; round++ {
+		var next []*storage.ObjectHandle
+		for i := 0; i < len(sources); i += maxComposeSources {
+			batch := sources[i:min(i+maxComposeSources, len(sources))]
+			dst := b.Object(fmt.Sprintf("%scompose-%d-%d", prefix, round, len(next)))
+			if err := s.call(func() error {
+				_, err := dst.ComposerFrom(batch...).Run(ctx)
+				return err
+			}); err != nil {
+				return ObjectInfo{}, err
+			}
+			next = append(next, dst)
+		}
+		sources = next
+	}
+
+	var attrs *storage.ObjectAttrs
+	err = s.call(func() error {
+		composer := b.Object(key).ComposerFrom(sources...)
+		composer.ContentType = marker.ContentType
+		var err error
+		attrs, err = composer.Run(ctx)
+		return err
+	})
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	if err := s.removePrefix(ctx, bucket, prefix); err != nil {
+		log.Printf("Warning: Failed to clean up the parts of upload %s: %v\n", uploadID, err)
+	}
+	return gcsInfo(attrs), nil
+}
+
+func (s *gcsStore) AbortMultipart(ctx context.Context, bucket, key, uploadID string) error {
+	prefix, err := gcsUploadPrefix(uploadID)
+	if err != nil {
+		return err
+	}
+	return s.removePrefix(ctx, bucket, prefix)
+}
+
+// removePrefix deletes every object under prefix, the parts and marker of one upload
+func (s *gcsStore) removePrefix(ctx context.Context, bucket, prefix string) error {
+	b := s.client.Bucket(bucket)
+	it := b.Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := s.Delete(ctx, bucket, attrs.Name); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *gcsStore) attrs(ctx context.Context, obj *storage.ObjectHandle) (*storage.ObjectAttrs, error) {
+	var attrs *storage.ObjectAttrs
+	err := s.call(func() (err error) {
+		attrs, err = obj.Attrs(ctx)
+		return err
+	})
+	return attrs, err
+}
+
+func (s *gcsStore) BucketExists(ctx context.Context, bucket string) (bool, error) {
+	err := s.call(func() error {
+		_, err := s.client.Bucket(bucket).Attrs(ctx)
+		return err
+	})
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *gcsStore) MakeBucket(ctx context.Context, bucket string) error {
+	if s.projectID == "" {
+		return fmt.Errorf("GCS bucket %s doesn't exist, set GCS_PROJECT_ID to have it created", bucket)
+	}
+	return s.call(func() error {
+		return s.client.Bucket(bucket).Create(ctx, s.projectID, nil)
+	})
+}
+
+func (s *gcsStore) Available() error { return s.guard.Available() }
+
+// call runs one request through the offline guard, not found errors come back as ErrNotFound
+func (s *gcsStore) call(fn func() error) error {
+	err := s.guard.do(fn)
+	if errors.Is(err, storage.ErrObjectNotExist) || errors.Is(err, storage.ErrBucketNotExist) {
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+	return err
+}
+
+func gcsInfo(attrs *storage.ObjectAttrs) ObjectInfo {
+	return ObjectInfo{Key: attrs.Name, Size: attrs.Size, ETag: gcsETag(attrs), ContentType: attrs.ContentType, LastModified: attrs.Updated}
+}
+
+// gcsETag is the MD5 like S3 has it, composed objects don't get one so they fall back to the GCS ETag
+func gcsETag(attrs *storage.ObjectAttrs) string {
+	if len(attrs.MD5) > 0 {
+		return hex.EncodeToString(attrs.MD5)
+	}
+	return attrs.Etag
+}
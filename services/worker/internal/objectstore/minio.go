@@ -0,0 +1,156 @@
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/worker/internal/config"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// how often the client probes MinIO once it has seen it go down
+const minioHealthInterval = 5 * time.Second
+
+type minioStore struct {
+	client *minio.Client
+	// the multipart primitives only live on minio.Core
+	core *minio.Core
+}
+
+func newMinio(cfg config.Minio) (*minioStore, error) {
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Once a request fails on the network the client marks MinIO offline and fails every
+	// call straight away, until this health check sees it answer again
+	if _, err := client.HealthCheck(minioHealthInterval); err != nil {
+		log.Println("Warning: MinIO health check not started:", err)
+	}
+
+	log.Println("Successfully connected to MinIO")
+	return &minioStore{client: client, core: &minio.Core{Client: client}}, nil
+}
+
+func (s *minioStore) Name() string { return "minio" }
+
+func (s *minioStore) Put(ctx context.Context, bucket, key string, r io.Reader, size int64, contentType string) (ObjectInfo, error) {
+	info, err := s.client.PutObject(ctx, bucket, key, r, size, minio.PutObjectOptions{ContentType: contentType})
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{Key: info.Key, Size: info.Size, ETag: info.ETag, ContentType: contentType}, nil
+}
+
+func (s *minioStore) Get(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	obj, err := s.client.GetObject(ctx, bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, minioError(err)
+	}
+	// GetObject is lazy, Stat makes the request so a missing object shows up here and not on the first read
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		return nil, minioError(err)
+	}
+	return obj, nil
+}
+
+func (s *minioStore) Stat(ctx context.Context, bucket, key string) (ObjectInfo, error) {
+	info, err := s.client.StatObject(ctx, bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return ObjectInfo{}, minioError(err)
+	}
+	return ObjectInfo{Key: info.Key, Size: info.Size, ETag: info.ETag, ContentType: info.ContentType, LastModified: info.LastModified}, nil
+}
+
+func (s *minioStore) Delete(ctx context.Context, bucket, key string) error {
+	err := s.client.RemoveObject(ctx, bucket, key, minio.RemoveObjectOptions{})
+	if errors.Is(minioError(err), ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (s *minioStore) Copy(ctx context.Context, bucket, srcKey, dstKey string) error {
+	_, err := s.client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: bucket, Object: dstKey},
+		minio.CopySrcOptions{Bucket: bucket, Object: srcKey})
+	return minioError(err)
+}
+
+func (s *minioStore) Presign(ctx context.Context, bucket, key string, expiry time.Duration, filename string) (*url.URL, error) {
+	params := url.Values{}
+	if filename != "" {
+		params.Set("response-content-disposition", contentDisposition(filename))
+	}
+	return s.client.PresignedGetObject(ctx, bucket, key, expiry, params)
+}
+
+func (s *minioStore) CreateMultipart(ctx context.Context, bucket, key, contentType string) (string, error) {
+	return s.core.NewMultipartUpload(ctx, bucket, key, minio.PutObjectOptions{ContentType: contentType})
+}
+
+func (s *minioStore) PutPart(ctx context.Context, bucket, key, uploadID string, number int, r io.Reader, size int64) (Part, error) {
+	part, err := s.core.PutObjectPart(ctx, bucket, key, uploadID, number, r, size, minio.PutObjectPartOptions{})
+	if err != nil {
+		return Part{}, err
+	}
+	return Part{Number: part.PartNumber, ETag: part.ETag, Size: part.Size}, nil
+}
+
+func (s *minioStore) CompleteMultipart(ctx context.Context, bucket, key, uploadID string, parts []Part) (ObjectInfo, error) {
+	completed := make([]minio.CompletePart, len(parts))
+	for i, p := range parts {
+		completed[i] = minio.CompletePart{PartNumber: p.Number, ETag: p.ETag}
+	}
+	info, err := s.core.CompleteMultipartUpload(ctx, bucket, key, uploadID, completed, minio.PutObjectOptions{})
+	if err != nil {
+		if resp := minio.ToErrorResponse(err); resp.StatusCode == http.StatusBadRequest {
+			return ObjectInfo{}, &RejectedError{Message: resp.Message, Err: err}
+		}
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{Key: info.Key, Size: info.Size, ETag: info.ETag}, nil
+}
+
+func (s *minioStore) AbortMultipart(ctx context.Context, bucket, key, uploadID string) error {
+	return s.core.AbortMultipartUpload(ctx, bucket, key, uploadID)
+}
+
+func (s *minioStore) BucketExists(ctx context.Context, bucket string) (bool, error) {
+	return s.client.BucketExists(ctx, bucket)
+}
+
+func (s *minioStore) MakeBucket(ctx context.Context, bucket string) error {
+	return s.client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{})
+}
+
+func (s *minioStore) Available() error {
+	if s.client.IsOffline() {
+		return ErrOffline
+	}
+	return nil
+}
+
+// minioError turns MinIO's not found codes into ErrNotFound
+func minioError(err error) error {
+	if err == nil {
+		return nil
+	}
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchKey", "NoSuchBucket":
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+	return err
+}
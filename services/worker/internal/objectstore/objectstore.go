@@ -0,0 +1,197 @@
+package objectstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/worker/internal/config"
+)
+
+var (
+	// ErrNotFound is returned for objects that don't exist
+	ErrNotFound = errors.New("object not found")
+	// ErrOffline is returned straight away while the backend is known to be unreachable
+	ErrOffline = errors.New("object storage is offline")
+	// ErrChecksum is returned for an object that isn't what the gateway stored, it was
+	// corrupted or replaced along the way
+	ErrChecksum = errors.New("object doesn't match its checksum")
+)
+
+// RejectedError is the backend refusing a request as invalid, say a multipart upload
+// with parts under the minimum size. Message is meant for the client.
+type RejectedError struct {
+	Message string
+	Err     error
+}
+
+func (e *RejectedError) Error() string { return e.Message }
+func (e *RejectedError) Unwrap() error { return e.Err }
+
+// Store is where uploaded documents are kept: MinIO, AWS S3, Google Cloud Storage,
+// Azure Blob Storage or a local directory
+type Store interface {
+	// Name is the backend, for logs
+	Name() string
+
+	Put(ctx context.Context, bucket, key string, r io.Reader, size int64, contentType string) (ObjectInfo, error)
+	// Get opens an object for reading, the caller closes it
+	Get(ctx context.Context, bucket, key string) (io.ReadCloser, error)
+	Stat(ctx context.Context, bucket, key string) (ObjectInfo, error)
+	// Delete doesn't mind the object being gone already
+	Delete(ctx context.Context, bucket, key string) error
+	Copy(ctx context.Context, bucket, srcKey, dstKey string) error
+	// Presign returns a URL the object can be fetched from without credentials until expiry.
+	// A filename makes browsers save it under that name.
+	Presign(ctx context.Context, bucket, key string, expiry time.Duration, filename string) (*url.URL, error)
+
+	Multipart
+
+	BucketExists(ctx context.Context, bucket string) (bool, error)
+	MakeBucket(ctx context.Context, bucket string) error
+
+	// Available is nil unless the backend is known to be down, it doesn't touch the network
+	Available() error
+}
+
+// Multipart assembles one object out of parts uploaded separately, resumable uploads are built on it
+type Multipart interface {
+	CreateMultipart(ctx context.Context, bucket, key, contentType string) (uploadID string, err error)
+	// PutPart stores a part, sending the same number again replaces it
+	PutPart(ctx context.Context, bucket, key, uploadID string, number int, r io.Reader, size int64) (Part, error)
+	// CompleteMultipart joins parts in the order given, a RejectedError means the parts don't add up
+	CompleteMultipart(ctx context.Context, bucket, key, uploadID string, parts []Part) (ObjectInfo, error)
+	AbortMultipart(ctx context.Context, bucket, key, uploadID string) error
+}
+
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ETag         string
+	ContentType  string
+	LastModified time.Time
+}
+
+type Part struct {
+	Number int
+	ETag   string
+	Size   int64
+}
+
+// New opens the backend cfg.Backend names: minio, s3, gcs, azure or local
+func New(ctx context.Context, cfg config.Storage) (Store, error) {
+	switch cfg.Backend {
+	case "", "minio":
+		return newMinio(cfg.Minio)
+	case "s3":
+		return newS3(ctx, cfg.S3)
+	case "gcs":
+		return newGCS(ctx, cfg.GCS)
+	case "azure":
+		return newAzure(cfg.Azure)
+	case "local":
+		return newLocal(cfg.LocalRoot)
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_BACKEND %q, use minio, s3, gcs, azure or local", cfg.Backend)
+	}
+}
+
+// how often a failed bucket setup is retried
+const bucketRetryDelay = 10 * time.Second
+
+// SetupBucket creates bucket unless it exists. The backend may just not be up yet,
+// so a failure is retried in the background instead of needing a restart.
+func SetupBucket(s Store, bucket string) {
+	if err := ensureBucket(s, bucket); err != nil {
+		log.Printf("Warning: Bucket setup failed: %v\n", err)
+		go func() {
+			for {
+				time.Sleep(bucketRetryDelay)
+				if err := ensureBucket(s, bucket); err != nil {
+					log.Printf("Bucket setup failed, retrying in %s: %v\n", bucketRetryDelay, err)
+					continue
+				}
+				log.Println("Bucket setup done:", bucket)
+				return
+			}
+		}()
+	}
+}
+
+func ensureBucket(s Store, bucket string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	exists, err := s.BucketExists(ctx, bucket)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if err := s.MakeBucket(ctx, bucket); err != nil {
+			return err
+		}
+		log.Printf("Created a new bucket: %s\n", bucket)
+	}
+	return nil
+}
+
+// TempPrefix starts the name of every temp file and directory the worker makes
+const TempPrefix = "docstream-"
+
+// DownloadToTemp streams an object into a temp file in dir so large PDFs never sit in memory,
+// an empty dir is the system's temp directory. The caller is responsible for removing the returned path.
+func DownloadToTemp(ctx context.Context, s Store, bucket, key, dir string) (string, error) {
+	obj, err := s.Get(ctx, bucket, key)
+	if err != nil {
+		return "", err
+	}
+	defer obj.Close()
+	return SaveToTemp(obj, dir)
+}
+
+// SaveToTemp is DownloadToTemp for an object that is already open, say to decrypt it on the way
+func SaveToTemp(obj io.Reader, dir string) (string, error) {
+	tmp, err := os.CreateTemp(dir, TempPrefix+"*")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(tmp, obj)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// SaveVerified is SaveToTemp checking the content against its hex SHA-256 on the way,
+// an empty sum isn't checked. Nothing is left behind when it doesn't match.
+func SaveVerified(obj io.Reader, dir, sum string) (string, error) {
+	if sum == "" {
+		return SaveToTemp(obj, dir)
+	}
+	h := sha256.New()
+	path, err := SaveToTemp(io.TeeReader(obj, h), dir)
+	if err != nil {
+		return "", err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != sum {
+		os.Remove(path)
+		return "", fmt.Errorf("%w: expected sha256 %s, got %s", ErrChecksum, sum, got)
+	}
+	return path, nil
+}
+
+// contentDisposition makes browsers download an object as filename
+func contentDisposition(filename string) string {
+	return fmt.Sprintf("attachment; filename=%q", filename)
+}
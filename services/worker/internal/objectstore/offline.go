@@ -0,0 +1,67 @@
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// how often a backend is probed once a request couldn't reach it
+const probeInterval = 5 * time.Second
+
+// offlineGuard does for the SDK backends what minio-go's health check does for MinIO:
+// once a request can't reach the backend at all, calls fail with ErrOffline straight
+// away until a background probe gets an answer again
+type offlineGuard struct {
+	name string
+	// unreachable is true for errors where the request never got a response
+	unreachable func(error) bool
+	// ping is any cheap request, an error response still counts as reachable
+	ping func(ctx context.Context) error
+
+	offline atomic.Bool
+}
+
+func (g *offlineGuard) Available() error {
+	if g.offline.Load() {
+		return ErrOffline
+	}
+	return nil
+}
+
+// do runs one request, failing fast while the backend is offline
+func (g *offlineGuard) do(fn func() error) error {
+	if err := g.Available(); err != nil {
+		return err
+	}
+	err := fn()
+	if err != nil && g.unreachable(err) && g.offline.CompareAndSwap(false, true) {
+		log.Printf("%s is unreachable, failing requests until it answers again: %v\n", g.name, err)
+		go g.probe()
+	}
+	return err
+}
+
+func (g *offlineGuard) probe() {
+	for {
+		time.Sleep(probeInterval)
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		err := g.ping(ctx)
+		cancel()
+		if err == nil || !g.unreachable(err) {
+			log.Printf("%s is reachable again\n", g.name)
+			g.offline.Store(false)
+			return
+		}
+	}
+}
+
+// networkError is the unreachable check for SDKs that hand transport errors back as
+// they are, a request the caller cancelled says nothing about the backend
+func networkError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && !errors.Is(err, context.Canceled)
+}
@@ -0,0 +1,149 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+
+	"github.com/dhruvkshah75/docstream/worker/internal/chunker"
+	"github.com/dhruvkshah75/docstream/worker/internal/models"
+)
+
+// chunkWindow is about how much of the text is split at once, a big document is read a window
+// at a time. A window ends where a page or section starts when there's one close enough,
+// otherwise at a paragraph. Chunks don't reach across windows.
+const chunkWindow = 1 << 20
+
+// ChunkStage splits the extracted text into overlapping chunks for embedding.
+// Defaults come from the worker's config, then whatever Languages sets for the
+// document's language, the job's options win over both.
+type ChunkStage struct {
+	Defaults  chunker.Options
+	Languages map[string]chunker.Options
+}
+
+func (ChunkStage) Name() string { return "chunk" }
+
+// Process leaves every chunk in doc.Chunks, for a pipeline that doesn't stream them
+func (s ChunkStage) Process(ctx context.Context, doc *Document) error {
+	doc.Chunks = nil
+	return s.Emit(ctx, doc, func(chunks []models.Chunk) error {
+		doc.Chunks = append(doc.Chunks, chunks...)
+		return nil
+	})
+}
+
+// Emit hands over the chunks of one window at a time
+func (s ChunkStage) Emit(ctx context.Context, doc *Document, emit func(chunks []models.Chunk) error) error {
+	opts := s.Defaults.Override(s.Languages[doc.Language]).Override(chunker.Options{
+		Strategy: doc.Job.Options.ChunkStrategy,
+		Size:     doc.Job.Options.ChunkSize,
+		Overlap:  doc.Job.Options.ChunkOverlap,
+	})
+
+	f, err := os.Open(doc.TextPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	breaks := slices.Clone(doc.Pages)
+	for _, sec := range doc.Sections {
+		breaks = append(breaks, sec.Start)
+	}
+	slices.Sort(breaks)
+
+	count := 0
+	buf := make([]byte, min(chunkWindow, doc.TextSize))
+	for start := 0; start < doc.TextSize; {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		end, clean := windowEnd(start, doc.TextSize, breaks)
+		window := buf[:end-start]
+		if _, err := f.ReadAt(window, int64(start)); err != nil && err != io.EOF {
+			return err
+		}
+		if !clean {
+			window = cutWindow(window)
+			end = start + len(window)
+		}
+
+		chunks, err := chunker.Split(string(window), opts)
+		if err != nil {
+			// bad settings in the job won't get better on a retry
+			return Permanent(err)
+		}
+		batch := make([]models.Chunk, len(chunks))
+		for i, c := range chunks {
+			c.Start += start
+			c.End += start
+			// the markdown strategy knows its chunk's heading, the others get the section they start in
+			if c.Heading == "" {
+				c.Heading = sectionAt(doc.Sections, c.Start)
+			}
+			batch[i] = models.Chunk{
+				Index:   count + i,
+				Text:    c.Text,
+				Start:   c.Start,
+				End:     c.End,
+				Tokens:  c.Tokens,
+				Page:    pageAt(doc.Pages, c.Start),
+				Heading: c.Heading,
+			}
+		}
+		count += len(batch)
+		if len(batch) > 0 {
+			if err := emit(batch); err != nil {
+				return err
+			}
+		}
+		start = end
+	}
+	doc.Metadata["chunks"] = fmt.Sprint(count)
+	return nil
+}
+
+// windowEnd picks where the window from start ends: the end of the text, or the last page or
+// section start within chunkWindow of it that's past the first quarter. Otherwise the window
+// still has to be cut with cutWindow.
+func windowEnd(start, size int, breaks []int) (end int, clean bool) {
+	limit := start + chunkWindow
+	if limit >= size {
+		return size, true
+	}
+	i := sort.SearchInts(breaks, limit+1)
+	if i > 0 && breaks[i-1] > start+chunkWindow/4 {
+		return breaks[i-1], true
+	}
+	return limit, false
+}
+
+// cutWindow ends window after its last blank line, or failing that its last line or word
+func cutWindow(window []byte) []byte {
+	if i := bytes.LastIndex(window, []byte("\n\n")); i > 0 {
+		return window[:i+2]
+	}
+	if i := bytes.LastIndexAny(window, "\n \t"); i > 0 {
+		return window[:i+1]
+	}
+	return wholeRunes(window)
+}
+
+// pageAt returns the 1-based page holding offset, 0 when the document has no pages
+func pageAt(pages []int, offset int) int {
+	return sort.Search(len(pages), func(i int) bool { return pages[i] > offset })
+}
+
+// sectionAt returns the title of the section holding offset, "" before the first one
+func sectionAt(sections []Section, offset int) string {
+	i := sort.Search(len(sections), func(i int) bool { return sections[i].Start > offset })
+	if i == 0 {
+		return ""
+	}
+	return sections[i-1].Title
+}
@@ -0,0 +1,132 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+
+	"github.com/dhruvkshah75/docstream/worker/internal/embeddings"
+)
+
+// classifySample is how much of the start of the text a document is classified by
+const classifySample = 64 << 10
+
+// classifyEmbedSample is the part of it compared with the classes' descriptions, embedding
+// models don't take much more
+const classifyEmbedSample = 4 << 10
+
+// Class is a label a document can get
+type Class struct {
+	Name     string
+	Keywords []string // counted in the text, case doesn't matter
+	// Description is what the text is compared with when classifying with embeddings
+	Description string
+}
+
+// ClassifyStage labels a document with the class it fits best, like invoice or contract. The
+// gateway stores the label with the document, and a route for it set with Route takes over the
+// stages after this one.
+type ClassifyStage struct {
+	Classes []Class
+	// Provider compares the text with each class's description, nil counts their keywords instead
+	Provider embeddings.Provider
+	// Threshold is the least the best class has to score to be picked, keyword hits or cosine similarity
+	Threshold float64
+}
+
+func (ClassifyStage) Name() string { return "classify" }
+
+func (s ClassifyStage) Process(ctx context.Context, doc *Document) error {
+	sample, err := doc.Head(classifySample)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(sample) == "" {
+		return nil
+	}
+
+	var scores []float64
+	if s.Provider != nil {
+		if scores, err = s.similarities(ctx, sample); err != nil {
+			return err
+		}
+	} else {
+		scores = s.keywordHits(sample)
+	}
+
+	best := -1
+	for i, score := range scores {
+		if score > 0 && score >= s.Threshold && (best < 0 || score > scores[best]) {
+			best = i
+		}
+	}
+	if best < 0 {
+		log.Printf("[%s] fits none of the classes\n", doc.Job.JobID)
+		return nil
+	}
+	doc.Class = s.Classes[best].Name
+	doc.Metadata["class"] = doc.Class
+	log.Printf("[%s] class is %s\n", doc.Job.JobID, doc.Class)
+	return nil
+}
+
+// keywordHits counts how often each class's keywords come up in sample
+func (s ClassifyStage) keywordHits(sample string) []float64 {
+	sample = strings.ToLower(sample)
+	hits := make([]float64, len(s.Classes))
+	for i, class := range s.Classes {
+		for _, keyword := range class.Keywords {
+			if keyword = strings.ToLower(strings.TrimSpace(keyword)); keyword != "" {
+				hits[i] += float64(strings.Count(sample, keyword))
+			}
+		}
+	}
+	return hits
+}
+
+// similarities embeds the start of sample with every class's description and returns how close
+// each description is to it
+func (s ClassifyStage) similarities(ctx context.Context, sample string) ([]float64, error) {
+	texts := []string{string(wholeRunes([]byte(sample[:min(len(sample), classifyEmbedSample)])))}
+	for _, class := range s.Classes {
+		texts = append(texts, description(class))
+	}
+	vectors, err := s.Provider.Embed(ctx, s.Provider.DefaultModel(), texts)
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != len(texts) {
+		return nil, fmt.Errorf("%s returned %d embeddings for %d texts", s.Provider.Name(), len(vectors), len(texts))
+	}
+	scores := make([]float64, len(s.Classes))
+	for i := range s.Classes {
+		scores[i] = cosine(vectors[0], vectors[i+1])
+	}
+	return scores, nil
+}
+
+// description is what a class is compared by, its name and keywords when it has no description
+func description(class Class) string {
+	if class.Description != "" {
+		return class.Description
+	}
+	if len(class.Keywords) == 0 {
+		return class.Name
+	}
+	return class.Name + ": " + strings.Join(class.Keywords, ", ")
+}
+
+func cosine(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := range min(len(a), len(b)) {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
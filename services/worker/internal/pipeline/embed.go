@@ -0,0 +1,67 @@
+package pipeline
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/dhruvkshah75/docstream/worker/internal/embeddings"
+	"github.com/dhruvkshah75/docstream/worker/internal/models"
+)
+
+// EmbedStage attaches a vector to every chunk. With no provider configured
+// the stage does nothing, so jobs still complete without an embedding model.
+type EmbedStage struct {
+	Provider  embeddings.Provider
+	BatchSize int
+	// LanguageModels picks the model by the document's language when the job doesn't name one
+	LanguageModels map[string]string
+}
+
+func (EmbedStage) Name() string { return "embed" }
+
+func (s EmbedStage) Process(ctx context.Context, doc *Document) error {
+	if err := s.Consume(ctx, doc, doc.Chunks); err != nil {
+		return err
+	}
+	return s.Flush(ctx, doc)
+}
+
+// Consume embeds a batch of chunks in place
+func (s EmbedStage) Consume(ctx context.Context, doc *Document, chunks []models.Chunk) error {
+	if s.Provider == nil || len(chunks) == 0 {
+		return nil
+	}
+
+	model := cmp.Or(doc.Job.Options.EmbeddingModel, s.LanguageModels[doc.Language], s.Provider.DefaultModel())
+
+	texts := make([]string, len(chunks))
+	for i, c := range chunks {
+		texts[i] = c.Text
+	}
+
+	vectors, err := embeddings.EmbedAll(ctx, s.Provider, model, texts, s.BatchSize)
+	if err != nil {
+		if !embeddings.IsRetryable(err) {
+			return Permanent(err)
+		}
+		return err
+	}
+
+	for i := range chunks {
+		chunks[i].Embedding = vectors[i]
+		doc.Usage.EmbeddingTokens += chunks[i].Tokens
+	}
+	doc.Metadata["embedding_provider"] = s.Provider.Name()
+	doc.Metadata["embedding_model"] = model
+	doc.Metadata["embedding_dimensions"] = fmt.Sprint(len(vectors[0]))
+	return nil
+}
+
+func (s EmbedStage) Flush(ctx context.Context, doc *Document) error {
+	if model := doc.Metadata["embedding_model"]; model != "" {
+		log.Printf("[%s] embedded %s chunks with %s/%s\n", doc.Job.JobID, doc.Metadata["chunks"], s.Provider.Name(), model)
+	}
+	return nil
+}
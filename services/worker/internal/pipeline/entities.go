@@ -0,0 +1,137 @@
+package pipeline
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/dhruvkshah75/docstream/worker/internal/models"
+)
+
+// Entity types the entities stage finds
+const (
+	EntityPerson       = "person"
+	EntityOrganization = "organization"
+	EntityDate         = "date"
+	EntityAmount       = "amount"
+)
+
+// EntityTypes are all of them, in the order they are listed on a document
+var EntityTypes = []string{EntityPerson, EntityOrganization, EntityDate, EntityAmount}
+
+const months = `(?:Jan(?:uary)?|Feb(?:ruary)?|Mar(?:ch)?|Apr(?:il)?|May|June?|July?|Aug(?:ust)?|Sep(?:t(?:ember)?)?|Oct(?:ober)?|Nov(?:ember)?|Dec(?:ember)?)`
+
+// entityPatterns find each type by its shape, the first group is the entity when there is one.
+// People are only told apart from other capitalized words by a title in front of them.
+var entityPatterns = map[string]*regexp.Regexp{
+	EntityPerson:       regexp.MustCompile(`\b(?:Mr|Mrs|Ms|Miss|Dr|Prof|Sir|Dame)\.?\s+((?:[A-Z][a-z]+(?:-[A-Z][a-z]+)?\s+){0,2}[A-Z][a-z]+(?:-[A-Z][a-z]+)?)\b`),
+	EntityOrganization: regexp.MustCompile(`\b((?:[A-Z][\w&'-]*\s+){0,4}[A-Z][\w&'-]*,?\s+(?:Inc|Corp|Corporation|Company|LLC|LLP|Ltd|Limited|GmbH|AG|S\.A|SA|PLC|plc|Pvt|Co)\b\.?)`),
+	EntityDate:         regexp.MustCompile(`\b(\d{4}-\d{2}-\d{2}|\d{1,2}/\d{1,2}/\d{2,4}|` + months + `\.?\s+\d{1,2}(?:st|nd|rd|th)?,?\s+\d{4}|\d{1,2}(?:st|nd|rd|th)?\s+` + months + `\.?,?\s+\d{4})\b`),
+	EntityAmount:       regexp.MustCompile(`((?:[$€£¥₹]|\b(?:USD|EUR|GBP|INR|JPY)\s?)\s?\d{1,3}(?:[,\s]\d{3})*(?:\.\d{1,2})?\b|\b\d{1,3}(?:,\d{3})*(?:\.\d{1,2})?\s?(?:USD|EUR|GBP|INR|JPY|dollars|euros|pounds|rupees)\b)`),
+}
+
+// entityBlock is how much of the text is searched at once, a block ends at a line break so
+// an entity is never cut in two
+const entityBlock = 256 << 10
+
+// EntitiesStage finds the people, organizations, dates and amounts the text mentions. They are
+// stored with the document for the gateway to list and filter by, and go on the chunks' points
+// so searches can be narrowed down to documents mentioning one.
+type EntitiesStage struct {
+	Types []string // which of EntityTypes to look for, all of them when empty
+	// Max is how many of each type a document keeps, the most mentioned first
+	Max int
+}
+
+func (EntitiesStage) Name() string { return "entities" }
+
+func (s EntitiesStage) Process(ctx context.Context, doc *Document) error {
+	types := s.Types
+	if len(types) == 0 {
+		types = EntityTypes
+	}
+	found := map[string]map[string]*models.Entity{}
+	for _, t := range types {
+		found[t] = map[string]*models.Entity{}
+	}
+
+	err := s.blocks(doc, func(block string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for _, t := range types {
+			for _, match := range entityPatterns[t].FindAllStringSubmatch(block, -1) {
+				value := strings.Join(strings.Fields(strings.TrimRight(match[1], ",")), " ")
+				key := EntityKey(t, value)
+				if e, ok := found[t][key]; ok {
+					e.Count++
+				} else {
+					found[t][key] = &models.Entity{Type: t, Value: value, Count: 1}
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	doc.Entities = nil
+	for _, t := range types {
+		var entities []models.Entity
+		for _, e := range found[t] {
+			entities = append(entities, *e)
+		}
+		// the most mentioned first, then by name so the same text always keeps the same ones
+		slices.SortFunc(entities, func(a, b models.Entity) int {
+			return cmp.Or(cmp.Compare(b.Count, a.Count), strings.Compare(a.Value, b.Value))
+		})
+		if s.Max > 0 && len(entities) > s.Max {
+			entities = entities[:s.Max]
+		}
+		doc.Entities = append(doc.Entities, entities...)
+	}
+	log.Printf("[%s] found %d entities\n", doc.Job.JobID, len(doc.Entities))
+	return nil
+}
+
+// blocks hands the text to fn a block at a time
+func (s EntitiesStage) blocks(doc *Document, fn func(block string) error) error {
+	f, err := os.Open(doc.TextPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	buf := make([]byte, entityBlock)
+	carry := 0
+	for {
+		n, err := io.ReadFull(f, buf[carry:])
+		n += carry
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return fn(string(buf[:n]))
+		} else if err != nil {
+			return err
+		}
+		// what comes after the last line break goes with the next block, unless there is none
+		end := bytes.LastIndexByte(buf[:n], '\n') + 1
+		if end == 0 {
+			end = len(wholeRunes(buf[:n]))
+		}
+		if err := fn(string(buf[:end])); err != nil {
+			return err
+		}
+		carry = copy(buf, buf[end:n])
+	}
+}
+
+// EntityKey is how an entity is matched: its type and its value in lower case, "person:jane doe"
+func EntityKey(entityType, value string) string {
+	return entityType + ":" + strings.ToLower(value)
+}
@@ -0,0 +1,174 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/worker/internal/models"
+)
+
+// ExecStage runs a program of your own as a stage, written in whatever language. It gets an
+// ExecRequest as JSON on stdin and may answer with an ExecResponse as JSON on stdout, nothing
+// at all leaves the document as it is. To change the text it rewrites the file at text_path.
+// What it writes to stderr goes to the worker's log.
+//
+// Exiting with a status other than 0 fails the stage and the job is retried, an answer with
+// "permanent": true sends it to the dead letter queue instead. The program doesn't see the
+// worker's environment, only PATH, HOME, LANG and TMPDIR, so it can't read its credentials.
+type ExecStage struct {
+	StageName string
+	Command   []string      // the program and its arguments
+	Timeout   time.Duration // 0 is no limit besides the job's
+}
+
+// ExecRequest is what an ExecStage's program reads from stdin
+type ExecRequest struct {
+	JobID      string `json:"job_id"`
+	DocumentID string `json:"document_id"`
+	Filename   string `json:"filename"`
+	Format     string `json:"format"` // pdf, docx, pptx, xlsx, html, md or txt, empty if it can't be told
+	// Path is the downloaded file, it shouldn't be changed
+	Path string `json:"path"`
+	// TextPath is the extracted text, empty before the extract stage ran
+	TextPath string            `json:"text_path,omitempty"`
+	Language string            `json:"language,omitempty"`
+	Pages    []int             `json:"pages,omitempty"`
+	Sections []Section         `json:"sections,omitempty"`
+	Chunks   []models.Chunk    `json:"chunks,omitempty"`
+	Metadata map[string]string `json:"metadata"`
+	Options  models.JobOptions `json:"options"`
+}
+
+// ExecResponse is what an ExecStage's program may write to stdout, what it leaves out stays
+// as it was. A program that changed the length of the text should send pages and sections
+// with their new offsets, otherwise they are dropped.
+type ExecResponse struct {
+	Language *string         `json:"language"`
+	Pages    *[]int          `json:"pages"`
+	Sections *[]Section      `json:"sections"`
+	Chunks   *[]models.Chunk `json:"chunks"`
+	// Metadata is merged into the document's, an empty value removes the key
+	Metadata map[string]string `json:"metadata"`
+	// Error fails the stage, whatever the exit status was
+	Error     string `json:"error"`
+	Permanent bool   `json:"permanent"`
+}
+
+func (s ExecStage) Name() string { return s.StageName }
+
+func (s ExecStage) Process(ctx context.Context, doc *Document) error {
+	format, _ := detectFormat(doc.Path, doc.Job.Filename)
+	request := ExecRequest{
+		JobID:      doc.Job.JobID,
+		DocumentID: doc.Job.DocumentID,
+		Filename:   doc.Job.Filename,
+		Format:     format,
+		Path:       doc.Path,
+		TextPath:   doc.TextPath,
+		Language:   doc.Language,
+		Pages:      doc.Pages,
+		Sections:   doc.Sections,
+		Chunks:     doc.Chunks,
+		Metadata:   doc.Metadata,
+		Options:    doc.Job.Options,
+	}
+	input, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, s.Command[0], s.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Env = execEnv()
+	cmd.WaitDelay = 5 * time.Second
+	runErr := cmd.Run()
+
+	for _, line := range strings.Split(strings.TrimSpace(stderr.String()), "\n") {
+		if line != "" {
+			log.Printf("[%s] %s: %s\n", doc.Job.JobID, s.StageName, line)
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	var response ExecResponse
+	if out := bytes.TrimSpace(stdout.Bytes()); len(out) > 0 {
+		if err := json.Unmarshal(out, &response); err != nil && runErr == nil {
+			return fmt.Errorf("%s answered with invalid JSON: %w", s.Command[0], err)
+		}
+	}
+	if response.Error != "" {
+		err := errors.New(response.Error)
+		if response.Permanent {
+			return Permanent(err)
+		}
+		return err
+	}
+	if runErr != nil {
+		return fmt.Errorf("%s: %w", s.Command[0], runErr)
+	}
+	return s.apply(doc, response)
+}
+
+// apply takes what the program answered into doc
+func (s ExecStage) apply(doc *Document, response ExecResponse) error {
+	if doc.TextPath != "" {
+		info, err := os.Stat(doc.TextPath)
+		if err != nil {
+			return err
+		}
+		if size := int(info.Size()); size != doc.TextSize {
+			// the offsets into the text moved, unless the program says where they went
+			doc.TextSize = size
+			doc.Pages, doc.Sections = nil, nil
+		}
+	}
+	if response.Language != nil {
+		doc.Language = *response.Language
+	}
+	if response.Pages != nil {
+		doc.Pages = *response.Pages
+	}
+	if response.Sections != nil {
+		doc.Sections = *response.Sections
+	}
+	if response.Chunks != nil {
+		doc.Chunks = *response.Chunks
+	}
+	for key, value := range response.Metadata {
+		if value == "" {
+			delete(doc.Metadata, key)
+		} else {
+			doc.Metadata[key] = value
+		}
+	}
+	return nil
+}
+
+// execEnv is the little of the worker's environment a program gets
+func execEnv() []string {
+	var env []string
+	for _, name := range []string{"PATH", "HOME", "LANG", "TMPDIR"} {
+		if v, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+v)
+		}
+	}
+	return env
+}
@@ -0,0 +1,306 @@
+package pipeline
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dhruvkshah75/docstream/worker/internal/chunker"
+	"github.com/dhruvkshah75/docstream/worker/internal/objectstore"
+	"github.com/ledongthuc/pdf"
+)
+
+// the formats the extract stage reads, it leaves the one it found in doc.Metadata["format"]
+const (
+	formatPDF      = "pdf"
+	formatDOCX     = "docx"
+	formatPPTX     = "pptx"
+	formatXLSX     = "xlsx"
+	formatHTML     = "html"
+	formatMarkdown = "md"
+	formatText     = "txt"
+)
+
+// extractors turn a file into text, one per binary format. Markdown and plain text are read as they are.
+var extractors = map[string]func(path string, b *textBuilder) error{
+	formatPDF:  extractPDF,
+	formatDOCX: extractDOCX,
+	formatPPTX: extractPPTX,
+	formatXLSX: extractXLSX,
+	formatHTML: extractHTML,
+}
+
+// what the pages of a format are called in the metadata
+var pageNames = map[string]string{formatPDF: "pages", formatPPTX: "slides", formatXLSX: "sheets"}
+
+// ExtractStage pulls plain text out of the downloaded file. Every format comes out the same:
+// paragraphs apart by blank lines, table rows as tab separated lines and headings as markdown
+// "#" lines, with doc.Pages and doc.Sections saying where pages, slides, sheets and headings start.
+// The text goes to a file in TempDir as it comes out, a PDF page at a time, plain text and
+// markdown are their own text.
+type ExtractStage struct {
+	TempDir string // empty is the system's temp directory
+}
+
+func (ExtractStage) Name() string { return "extract" }
+
+func (s ExtractStage) Process(ctx context.Context, doc *Document) error {
+	format, err := detectFormat(doc.Path, doc.Job.Filename)
+	if err != nil {
+		return err
+	}
+	doc.Metadata["format"] = format
+
+	var b textBuilder
+	switch format {
+	case formatMarkdown, formatText:
+		if err := b.scan(doc.Path, format == formatMarkdown); err != nil {
+			return err
+		}
+		doc.TextPath = doc.Path
+	default:
+		f, err := os.CreateTemp(s.TempDir, objectstore.TempPrefix+"text-*")
+		if err != nil {
+			return err
+		}
+		// the worker removes it along with the download, whatever happens from here
+		doc.TextPath = f.Name()
+		b.w = bufio.NewWriter(f)
+		err = extractors[format](doc.Path, &b)
+		if err != nil {
+			f.Close()
+			// a file that doesn't parse won't parse next time either
+			return Permanent(err)
+		}
+		// a full disk is worth another try, maybe on another worker
+		if err := b.w.Flush(); err != nil {
+			f.Close()
+			return fmt.Errorf("writing the extracted text: %w", err)
+		}
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("writing the extracted text: %w", err)
+		}
+	}
+
+	doc.TextSize = b.n
+	doc.Pages = b.pages
+	doc.Sections = b.sections
+	if name, ok := pageNames[format]; ok {
+		doc.Metadata[name] = fmt.Sprint(len(b.pages))
+	}
+	if len(b.sections) > 0 {
+		doc.Metadata["sections"] = fmt.Sprint(len(b.sections))
+	}
+
+	if !b.ink {
+		return Permanent(fmt.Errorf("no text could be extracted"))
+	}
+	return nil
+}
+
+// detectFormat works out the format from the first bytes of the file, like the gateway does
+// on upload. The extension only tells apart what the bytes can't, markdown from plain text.
+func detectFormat(path, filename string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	f.Close()
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	detected := http.DetectContentType(head[:n])
+	ext := strings.ToLower(filepath.Ext(filename))
+
+	switch {
+	case strings.HasPrefix(detected, "application/pdf"):
+		return formatPDF, nil
+	case detected == "application/zip":
+		if format := officeFormat(path); format != "" {
+			return format, nil
+		}
+	case strings.HasPrefix(detected, "text/html"):
+		if ext == ".md" || ext == ".markdown" {
+			return formatMarkdown, nil
+		}
+		return formatHTML, nil
+	case strings.HasPrefix(detected, "text/plain"):
+		switch ext {
+		case ".md", ".markdown":
+			return formatMarkdown, nil
+		case ".html", ".htm":
+			return formatHTML, nil
+		}
+		return formatText, nil
+	}
+	return "", Permanent(fmt.Errorf("unsupported file type %q, the contents look like %s", ext, detected))
+}
+
+// officeFormat tells which OOXML format a zip is by the folder its main part is in, "" if it isn't one
+func officeFormat(path string) string {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return ""
+	}
+	defer zr.Close()
+	main, err := (&ooxml{zr: zr, files: partsOf(zr)}).mainPart()
+	if err != nil {
+		return ""
+	}
+	switch {
+	case strings.HasPrefix(main, "word/"):
+		return formatDOCX
+	case strings.HasPrefix(main, "ppt/"):
+		return formatPPTX
+	case strings.HasPrefix(main, "xl/"):
+		return formatXLSX
+	}
+	return ""
+}
+
+// textBuilder writes the text of a document out as it is extracted, noting where its pages and
+// sections start
+type textBuilder struct {
+	// w is nil for plain text and markdown, they are only scanned. Write errors stick,
+	// Flush reports them.
+	w    *bufio.Writer
+	n    int     // bytes written so far
+	tail [2]byte // the last two of them
+	ink  bool    // whether any of them wasn't a space
+
+	pages    []int
+	sections []Section
+}
+
+func (b *textBuilder) write(text string) {
+	if text == "" {
+		return
+	}
+	b.w.WriteString(text)
+	b.n += len(text)
+	if len(text) >= 2 {
+		b.tail = [2]byte{text[len(text)-2], text[len(text)-1]}
+	} else {
+		b.tail = [2]byte{b.tail[1], text[0]}
+	}
+	if !b.ink {
+		b.ink = strings.TrimSpace(text) != ""
+	}
+}
+
+// scan takes a plain text or markdown file as the text it is, reading it a line at a time for
+// its headings
+func (b *textBuilder) scan(path string, markdown bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReaderSize(f, 64<<10)
+	var headings chunker.HeadingScanner
+	lineStart := true
+	for {
+		// a line longer than the buffer comes in pieces, only its first one can be a heading
+		line, err := r.ReadSlice('\n')
+		if markdown && lineStart {
+			if title, ok := headings.Heading(string(line)); ok {
+				b.sections = append(b.sections, Section{Start: b.n, Title: title})
+			}
+		}
+		if !b.ink {
+			b.ink = len(bytes.TrimSpace(line)) > 0
+		}
+		b.n += len(line)
+		switch {
+		case err == bufio.ErrBufferFull:
+			lineStart = false
+		case err == io.EOF:
+			return nil
+		case err != nil:
+			return err
+		default:
+			lineStart = true
+		}
+	}
+}
+
+// page marks the start of the next page, slide or sheet
+func (b *textBuilder) page() {
+	b.pages = append(b.pages, b.n)
+}
+
+// heading writes a markdown heading and starts a section with it
+func (b *textBuilder) heading(level int, title string) {
+	title = strings.Join(strings.Fields(title), " ")
+	if title == "" {
+		return
+	}
+	b.breakBlock()
+	b.sections = append(b.sections, Section{Start: b.n, Title: title})
+	b.write(strings.Repeat("#", min(max(level, 1), 6)) + " " + title + "\n\n")
+}
+
+func (b *textBuilder) paragraph(text string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+	b.breakBlock()
+	b.write(text + "\n\n")
+}
+
+// row writes one table row as a line of tab separated cells, rows of a table stay together
+func (b *textBuilder) row(cells []string) {
+	for len(cells) > 0 && strings.TrimSpace(cells[len(cells)-1]) == "" {
+		cells = cells[:len(cells)-1]
+	}
+	if len(cells) == 0 {
+		return
+	}
+	for i, cell := range cells {
+		cells[i] = strings.Join(strings.Fields(cell), " ")
+	}
+	b.write(strings.Join(cells, "\t") + "\n")
+}
+
+// breakBlock ends a run of rows with a blank line, so the chunker sees them as one block
+func (b *textBuilder) breakBlock() {
+	if b.tail[1] == '\n' && b.tail[0] != '\n' {
+		b.write("\n")
+	}
+}
+
+// extractPDF writes the text of every page as it gets to it, only one page is held in memory
+func extractPDF(path string, b *textBuilder) error {
+	f, reader, err := pdf.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	numPages := reader.NumPage()
+	for i := 1; i <= numPages; i++ {
+		b.page()
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+		text, err := page.GetPlainText(nil)
+		if err != nil {
+			return fmt.Errorf("page %d: %w", i, err)
+		}
+		b.write(text)
+		b.write("\n")
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package pipeline
+
+import (
+	"os"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+)
+
+// elements whose contents never show on the page
+var hiddenElements = map[atom.Atom]bool{
+	atom.Head: true, atom.Script: true, atom.Style: true, atom.Noscript: true,
+	atom.Template: true, atom.Svg: true, atom.Iframe: true, atom.Object: true,
+}
+
+// elements that start a paragraph of their own
+var blockElements = map[atom.Atom]bool{
+	atom.Html: true, atom.Body: true, atom.Main: true, atom.Article: true, atom.Section: true,
+	atom.Header: true, atom.Footer: true, atom.Nav: true, atom.Aside: true, atom.Div: true,
+	atom.P: true, atom.Blockquote: true, atom.Pre: true, atom.Address: true, atom.Hr: true,
+	atom.Ul: true, atom.Ol: true, atom.Li: true, atom.Dl: true, atom.Dt: true, atom.Dd: true,
+	atom.Figure: true, atom.Figcaption: true, atom.Details: true, atom.Summary: true,
+	atom.Form: true, atom.Fieldset: true, atom.Table: true, atom.Caption: true, atom.Tr: true,
+}
+
+// extractHTML writes the visible text of a web page, h1 to h6 as headings and tables as rows
+func extractHTML(path string, b *textBuilder) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// the page's own <meta charset> decides, html.Parse only reads UTF-8
+	r, err := charset.NewReader(f, "")
+	if err != nil {
+		return err
+	}
+	root, err := html.Parse(r)
+	if err != nil {
+		return err
+	}
+
+	w := htmlText{b: b}
+	w.walk(root)
+	w.flush()
+	return nil
+}
+
+// htmlText collects the inline text of a page into paragraphs
+type htmlText struct {
+	b     *textBuilder
+	text  strings.Builder
+	cells []string
+	pre   int // inside <pre>, whitespace is kept
+	cell  int // inside <td>, blocks don't end the cell
+}
+
+func (w *htmlText) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		if w.pre > 0 {
+			w.text.WriteString(n.Data)
+		} else {
+			// line breaks in the source are just spaces, <br> makes the real ones
+			w.text.WriteString(strings.Map(func(r rune) rune {
+				if unicode.IsSpace(r) {
+					return ' '
+				}
+				return r
+			}, n.Data))
+		}
+		return
+	case html.ElementNode:
+		if hiddenElements[n.DataAtom] {
+			return
+		}
+		switch n.DataAtom {
+		case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+			if w.cell == 0 {
+				w.flush()
+				w.b.heading(int(n.Data[1]-'0'), nodeText(n))
+				return
+			}
+		case atom.Br:
+			w.text.WriteByte('\n')
+			return
+		case atom.Td, atom.Th:
+			w.cell++
+			w.children(n)
+			w.cell--
+			if w.cell == 0 {
+				w.cells = append(w.cells, w.text.String())
+				w.text.Reset()
+			}
+			return
+		}
+	}
+
+	block := n.Type == html.ElementNode && blockElements[n.DataAtom]
+	if block {
+		w.flush()
+	}
+	if n.DataAtom == atom.Pre {
+		w.pre++
+	}
+	if n.DataAtom == atom.Li {
+		w.text.WriteString("- ")
+	}
+	w.children(n)
+	if block {
+		w.flush()
+	}
+	if n.DataAtom == atom.Pre {
+		w.pre--
+	}
+	if n.DataAtom == atom.Tr && w.cell == 0 {
+		w.b.row(w.cells)
+		w.cells = nil
+	}
+}
+
+func (w *htmlText) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.walk(c)
+	}
+}
+
+// flush ends the paragraph collected so far, inside a table cell it only leaves a space
+func (w *htmlText) flush() {
+	if w.cell > 0 {
+		w.text.WriteByte(' ')
+		return
+	}
+	text := w.text.String()
+	w.text.Reset()
+	if w.pre > 0 {
+		w.b.paragraph(strings.Trim(text, "\n"))
+		return
+	}
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	w.b.paragraph(strings.Join(lines, "\n"))
+}
+
+// nodeText is all the text under n, for headings
+func nodeText(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data + " ")
+		}
+		if n.Type == html.ElementNode && hiddenElements[n.DataAtom] {
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return sb.String()
+}
@@ -0,0 +1,112 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/dhruvkshah75/docstream/worker/internal/models"
+	"github.com/dhruvkshah75/docstream/worker/internal/vectorstore"
+)
+
+// IndexStage writes the embedded chunks to the vector store, into the collection the job names.
+// It does nothing without a store, or when the embed stage didn't produce vectors.
+type IndexStage struct {
+	Store vectorstore.Store
+}
+
+func (IndexStage) Name() string { return "index" }
+
+func (s IndexStage) Process(ctx context.Context, doc *Document) error {
+	if err := s.Consume(ctx, doc, doc.Chunks); err != nil {
+		return err
+	}
+	return s.Flush(ctx, doc)
+}
+
+// Consume writes a batch of embedded chunks
+func (s IndexStage) Consume(ctx context.Context, doc *Document, chunks []models.Chunk) error {
+	if s.Store == nil || len(chunks) == 0 || chunks[0].Embedding == nil {
+		return nil
+	}
+
+	job := doc.Job
+	var entities []string
+	for _, e := range doc.Entities {
+		entities = append(entities, EntityKey(e.Type, e.Value))
+	}
+	points := make([]vectorstore.Point, len(chunks))
+	for i, c := range chunks {
+		points[i] = vectorstore.Point{
+			ID:     vectorstore.PointID(job.DocumentID, c.Index),
+			Vector: c.Embedding,
+			Payload: vectorstore.Payload{
+				DocumentID: job.DocumentID,
+				UserID:     job.UserID,
+				OrgID:      job.OrgID,
+				Owner:      vectorstore.OwnerKey(job.UserID, job.OrgID),
+				JobID:      job.JobID,
+				ChunkIndex: c.Index,
+				Page:       c.Page,
+				Start:      c.Start,
+				End:        c.End,
+				Heading:    c.Heading,
+				Text:       c.Text,
+				Language:   doc.Language,
+				Model:      doc.Metadata["embedding_model"],
+				Tags:       job.Tags,
+				Metadata:   job.Metadata,
+				Entities:   entities,
+			},
+		}
+	}
+
+	if err := s.store(doc).Upsert(ctx, points); err != nil {
+		return indexError(fmt.Errorf("upserting %d points: %w", len(points), err))
+	}
+	return nil
+}
+
+// Flush trims the points of earlier runs once every batch is in, so a reprocessed document
+// never drops out of search. Points are keyed by document and chunk, a job that is redelivered
+// after a crash writes over its own and only has to drop those past its last chunk.
+func (s IndexStage) Flush(ctx context.Context, doc *Document) error {
+	if s.Store == nil || doc.Metadata["embedding_model"] == "" {
+		return nil
+	}
+	job := doc.Job
+	chunks, _ := strconv.Atoi(doc.Metadata["chunks"])
+	store := s.store(doc)
+	if err := store.DeleteStale(ctx, job.DocumentID, job.JobID, chunks); err != nil {
+		return indexError(fmt.Errorf("removing stale points: %w", err))
+	}
+
+	log.Printf("[%s] indexed %s chunks in %s\n", job.JobID, doc.Metadata["chunks"], store.Name())
+	return nil
+}
+
+// Cleanup removes whatever points this job managed to write. On a document that was indexed
+// before they took the place of the earlier job's, and are all of it that is left in search, so
+// they stay until the document is processed again.
+func (s IndexStage) Cleanup(ctx context.Context, doc *Document) error {
+	if s.Store == nil {
+		return nil
+	}
+	if doc.Job.ReplacesIndex {
+		log.Printf("[%s] keeping the points written over the document's earlier index\n", doc.Job.JobID)
+		return nil
+	}
+	return s.store(doc).DeleteJob(ctx, doc.Job.DocumentID, doc.Job.JobID)
+}
+
+func (s IndexStage) store(doc *Document) vectorstore.Store {
+	return s.Store.WithCollection(doc.Job.Collection)
+}
+
+func indexError(err error) error {
+	if !vectorstore.IsRetryable(err) {
+		return Permanent(err)
+	}
+	return err
+}
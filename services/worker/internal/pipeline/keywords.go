@@ -0,0 +1,86 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/worker/internal/models"
+	"github.com/dhruvkshah75/docstream/worker/internal/queue"
+)
+
+// KeywordsStage sends the text of the chunks to the gateway on the results queue, it keeps the
+// keyword index that /search ranks by BM25 next to (or instead of) the vectors. It needs no
+// embeddings, a worker without an embedding provider still makes documents searchable this way.
+type KeywordsStage struct {
+	Publisher queue.Publisher
+}
+
+func (KeywordsStage) Name() string { return "keywords" }
+
+func (s KeywordsStage) Process(ctx context.Context, doc *Document) error {
+	if err := s.Consume(ctx, doc, doc.Chunks); err != nil {
+		return err
+	}
+	return s.Flush(ctx, doc)
+}
+
+// Consume sends a batch of chunks
+func (s KeywordsStage) Consume(ctx context.Context, doc *Document, chunks []models.Chunk) error {
+	if len(chunks) == 0 {
+		return nil
+	}
+	keywords := s.keywords(doc)
+	keywords.Chunks = make([]models.Chunk, len(chunks))
+	for i, c := range chunks {
+		c.Embedding = nil
+		keywords.Chunks[i] = c
+	}
+	return s.publish(ctx, doc, keywords)
+}
+
+// Flush tells the gateway how many chunks the document has now, it drops those of earlier runs
+func (s KeywordsStage) Flush(ctx context.Context, doc *Document) error {
+	keywords := s.keywords(doc)
+	keywords.Final = true
+	keywords.Total, _ = strconv.Atoi(doc.Metadata["chunks"])
+	if err := s.publish(ctx, doc, keywords); err != nil {
+		return err
+	}
+	log.Printf("[%s] sent %d chunks to the keyword index\n", doc.Job.JobID, keywords.Total)
+	return nil
+}
+
+func (s KeywordsStage) keywords(doc *Document) *models.Keywords {
+	job := doc.Job
+	keywords := &models.Keywords{
+		DocumentID: job.DocumentID,
+		UserID:     job.UserID,
+		OrgID:      job.OrgID,
+		Language:   doc.Language,
+		Tags:       job.Tags,
+	}
+	for _, e := range doc.Entities {
+		keywords.Entities = append(keywords.Entities, EntityKey(e.Type, e.Value))
+	}
+	return keywords
+}
+
+func (s KeywordsStage) publish(ctx context.Context, doc *Document, keywords *models.Keywords) error {
+	body, err := json.Marshal(models.Result{
+		JobID:     doc.Job.JobID,
+		Status:    models.JobStatusProcessing,
+		Keywords:  keywords,
+		Timestamp: time.Now().Unix(),
+	})
+	if err != nil {
+		return Permanent(err)
+	}
+	if err := s.Publisher.PublishResult(ctx, doc.Job.DocumentID, body); err != nil {
+		return fmt.Errorf("sending chunks to the keyword index: %w", err)
+	}
+	return nil
+}
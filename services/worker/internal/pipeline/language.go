@@ -0,0 +1,29 @@
+package pipeline
+
+import (
+	"context"
+	"log"
+
+	"github.com/dhruvkshah75/docstream/worker/internal/language"
+)
+
+// LanguageStage works out what language the extracted text is in, the stages after it
+// pick their settings by it and the gateway stores it on the document
+type LanguageStage struct{}
+
+func (LanguageStage) Name() string { return "language" }
+
+func (LanguageStage) Process(ctx context.Context, doc *Document) error {
+	sample, err := doc.Head(language.SampleSize)
+	if err != nil {
+		return err
+	}
+	doc.Language = language.Detect(sample)
+	if doc.Language == "" {
+		log.Printf("[%s] couldn't tell the language\n", doc.Job.JobID)
+		return nil
+	}
+	doc.Metadata["language"] = doc.Language
+	log.Printf("[%s] language is %s\n", doc.Job.JobID, doc.Language)
+	return nil
+}
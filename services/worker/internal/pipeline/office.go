@@ -0,0 +1,664 @@
+package pipeline
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// maxPartSize caps what one XML part of an Office file may unpack to, past it the file is a zip bomb
+const maxPartSize = 256 << 20
+
+// the relationship types the extractors follow, by the end of their URI
+const (
+	relOfficeDocument = "/officeDocument"
+	relStyles         = "/styles"
+	relSlide          = "/slide"
+	relNotesSlide     = "/notesSlide"
+	relWorksheet      = "/worksheet"
+	relSharedStrings  = "/sharedStrings"
+)
+
+// ooxml is an open Office Open XML file, a zip of XML parts tied together by relationships
+type ooxml struct {
+	zr    *zip.ReadCloser
+	files map[string]*zip.File
+}
+
+func openOOXML(path string) (*ooxml, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	return &ooxml{zr: zr, files: partsOf(zr)}, nil
+}
+
+func partsOf(zr *zip.ReadCloser) map[string]*zip.File {
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	return files
+}
+
+func (o *ooxml) Close() error { return o.zr.Close() }
+
+func (o *ooxml) open(name string) (io.ReadCloser, error) {
+	f := o.files[name]
+	if f == nil {
+		return nil, fmt.Errorf("%s is missing", name)
+	}
+	// the zip reader fails a part that unpacks to more than it declares, so the declared size can be trusted
+	if f.UncompressedSize64 > maxPartSize {
+		return nil, fmt.Errorf("%s unpacks to %d bytes, more than the %d allowed", name, f.UncompressedSize64, maxPartSize)
+	}
+	return f.Open()
+}
+
+// unmarshal decodes a whole part into v
+func (o *ooxml) unmarshal(name string, v any) error {
+	r, err := o.open(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err := xml.NewDecoder(r).Decode(v); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// tokens feeds the tokens of a part to fn one by one, for parts too big to unmarshal
+func (o *ooxml) tokens(name string, fn func(tok xml.Token)) error {
+	r, err := o.open(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		fn(tok)
+	}
+}
+
+type relationship struct {
+	ID     string `xml:"Id,attr"`
+	Type   string `xml:"Type,attr"`
+	Target string `xml:"Target,attr"`
+	Mode   string `xml:"TargetMode,attr"`
+}
+
+// rels returns the relationships of a part by id, with targets resolved to part names.
+// "" is the package itself. A part without relationships has none, that's not an error.
+func (o *ooxml) rels(part string) (map[string]relationship, error) {
+	name := path.Join(path.Dir(part), "_rels", path.Base(part)+".rels")
+	if part == "" {
+		name = "_rels/.rels"
+	}
+	rels := map[string]relationship{}
+	if o.files[name] == nil {
+		return rels, nil
+	}
+	var doc struct {
+		Relationships []relationship `xml:"Relationship"`
+	}
+	if err := o.unmarshal(name, &doc); err != nil {
+		return nil, err
+	}
+	for _, rel := range doc.Relationships {
+		if rel.Mode == "External" {
+			continue
+		}
+		if strings.HasPrefix(rel.Target, "/") {
+			rel.Target = rel.Target[1:]
+		} else {
+			rel.Target = path.Join(path.Dir(part), rel.Target)
+		}
+		rels[rel.ID] = rel
+	}
+	return rels, nil
+}
+
+// related returns the first target of part with the given relationship type, "" if there is none
+func (o *ooxml) related(part, relType string) (string, error) {
+	rels, err := o.rels(part)
+	if err != nil {
+		return "", err
+	}
+	for _, rel := range rels {
+		if strings.HasSuffix(rel.Type, relType) {
+			return rel.Target, nil
+		}
+	}
+	return "", nil
+}
+
+// mainPart is the document.xml, presentation.xml or workbook.xml the package points at
+func (o *ooxml) mainPart() (string, error) {
+	main, err := o.related("", relOfficeDocument)
+	if err == nil && main == "" {
+		err = fmt.Errorf("no main document part")
+	}
+	return main, err
+}
+
+// relID picks the r:id out of an element's attributes, which shares its local name with plain ids
+func relID(attrs []xml.Attr) string {
+	for _, a := range attrs {
+		if a.Name.Local == "id" && a.Name.Space != "" {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func attr(el xml.StartElement, local string) string {
+	for _, a := range el.Attr {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// extractDOCX writes the paragraphs of a Word document, headings as headings and tables as rows
+func extractDOCX(path string, b *textBuilder) error {
+	o, err := openOOXML(path)
+	if err != nil {
+		return err
+	}
+	defer o.Close()
+	main, err := o.mainPart()
+	if err != nil {
+		return err
+	}
+	levels, err := headingStyles(o, main)
+	if err != nil {
+		return err
+	}
+
+	type paragraph struct {
+		text  strings.Builder
+		level int
+		list  bool
+	}
+	// text boxes put paragraphs inside paragraphs
+	var paras []*paragraph
+	var cell strings.Builder
+	var row []string
+	tables, inProps, inText := 0, false, false
+
+	err = o.tokens(main, func(tok xml.Token) {
+		var p *paragraph
+		if len(paras) > 0 {
+			p = paras[len(paras)-1]
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				paras = append(paras, &paragraph{})
+			case "pPr":
+				inProps = true
+			case "pStyle":
+				if p != nil {
+					p.level = levels.of(attr(t, "val"))
+				}
+			case "outlineLvl":
+				if n, err := strconv.Atoi(attr(t, "val")); err == nil && n < 9 && p != nil {
+					p.level = n + 1
+				}
+			case "numPr":
+				if p != nil {
+					p.list = true
+				}
+			case "t":
+				inText = true
+			case "tab":
+				// a tab in pPr is a tab stop, not a character
+				if p != nil && !inProps {
+					p.text.WriteByte('\t')
+				}
+			case "br", "cr":
+				if p != nil {
+					p.text.WriteByte('\n')
+				}
+			case "tbl":
+				tables++
+			case "tr":
+				if tables == 1 {
+					row = row[:0]
+				}
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "pPr":
+				inProps = false
+			case "p":
+				if p == nil {
+					break
+				}
+				paras = paras[:len(paras)-1]
+				text := p.text.String()
+				switch {
+				case tables > 0:
+					cell.WriteString(" " + text)
+				case p.level > 0:
+					b.heading(p.level, text)
+				case p.list && strings.TrimSpace(text) != "":
+					b.paragraph("- " + strings.TrimSpace(text))
+				default:
+					b.paragraph(text)
+				}
+			case "tc":
+				// cells of nested tables run into the cell around them
+				if tables == 1 {
+					row = append(row, cell.String())
+					cell.Reset()
+				}
+			case "tr":
+				if tables == 1 {
+					b.row(row)
+				}
+			case "tbl":
+				tables--
+			}
+		case xml.CharData:
+			if inText && p != nil {
+				p.text.Write(t)
+			}
+		}
+	})
+	return err
+}
+
+// styleLevels maps paragraph style ids to heading levels
+type styleLevels map[string]int
+
+// of is the heading level of a style, 0 for body text. Without a styles part the
+// English ids ("Heading2") are all there is to go by.
+func (l styleLevels) of(id string) int {
+	if level, ok := l[id]; ok {
+		return level
+	}
+	return builtinHeading(id)
+}
+
+// builtinHeading reads the level out of a built-in style name or id, "heading 2" or "Heading2"
+func builtinHeading(name string) int {
+	name = strings.ToLower(strings.ReplaceAll(name, " ", ""))
+	if name == "title" {
+		return 1
+	}
+	if n, err := strconv.Atoi(strings.TrimPrefix(name, "heading")); err == nil && strings.HasPrefix(name, "heading") && n >= 1 && n <= 9 {
+		return n
+	}
+	return 0
+}
+
+// headingStyles finds the heading styles of a Word document. Style ids are translated with Word,
+// so it goes by the built-in names and outline levels the styles declare, following basedOn.
+func headingStyles(o *ooxml, main string) (styleLevels, error) {
+	part, err := o.related(main, relStyles)
+	if err != nil || part == "" {
+		return nil, err
+	}
+	var doc struct {
+		Styles []struct {
+			Type    string  `xml:"type,attr"`
+			ID      string  `xml:"styleId,attr"`
+			Name    xmlVal  `xml:"name"`
+			BasedOn xmlVal  `xml:"basedOn"`
+			Outline *xmlVal `xml:"pPr>outlineLvl"`
+		} `xml:"style"`
+	}
+	if err := o.unmarshal(part, &doc); err != nil {
+		return nil, err
+	}
+
+	direct := map[string]int{}
+	basedOn := map[string]string{}
+	for _, s := range doc.Styles {
+		if s.Type != "paragraph" {
+			continue
+		}
+		level := builtinHeading(s.Name.Val)
+		if n, err := strconv.Atoi(s.Outline.value()); err == nil && n < 9 && level == 0 {
+			level = n + 1
+		}
+		direct[s.ID] = level
+		basedOn[s.ID] = s.BasedOn.Val
+	}
+
+	levels := styleLevels{}
+	for id := range direct {
+		// a custom style inherits being a heading, the chain is cut short in case it loops
+		level, at := 0, id
+		for range 10 {
+			if level = direct[at]; level > 0 || basedOn[at] == "" {
+				break
+			}
+			at = basedOn[at]
+		}
+		levels[id] = level
+	}
+	return levels, nil
+}
+
+// xmlVal is the w:val attribute most WordprocessingML settings are made of
+type xmlVal struct {
+	Val string `xml:"val,attr"`
+}
+
+func (v *xmlVal) value() string {
+	if v == nil {
+		return ""
+	}
+	return v.Val
+}
+
+// slideShape is the text of one shape on a slide, placeholder is its role ("title", "body") if it has one
+type slideShape struct {
+	placeholder string
+	text        string
+}
+
+// slideShapes reads the shapes of a slide or notes page in order. Text outside a shape, like
+// a table, comes last as a shape of its own.
+func slideShapes(o *ooxml, part string) ([]slideShape, error) {
+	var shapes []slideShape
+	var loose, shape []string
+	var line strings.Builder
+	inShape, inText := false, false
+	placeholder := ""
+
+	err := o.tokens(part, func(tok xml.Token) {
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "sp":
+				inShape, placeholder, shape = true, "", nil
+			case "ph":
+				// a placeholder without a type is a body
+				placeholder = attr(t, "type")
+				if placeholder == "" {
+					placeholder = "body"
+				}
+			case "p":
+				line.Reset()
+			case "t":
+				inText = true
+			case "br":
+				line.WriteByte('\n')
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				if inShape {
+					shape = append(shape, line.String())
+				} else {
+					loose = append(loose, line.String())
+				}
+			case "sp":
+				inShape = false
+				shapes = append(shapes, slideShape{placeholder: placeholder, text: strings.TrimSpace(strings.Join(shape, "\n"))})
+			}
+		case xml.CharData:
+			if inText {
+				line.Write(t)
+			}
+		}
+	})
+	if len(loose) > 0 {
+		shapes = append(shapes, slideShape{text: strings.TrimSpace(strings.Join(loose, "\n"))})
+	}
+	return shapes, err
+}
+
+// extractPPTX writes a page per slide, headed by its number and title, with its speaker notes after it
+func extractPPTX(path string, b *textBuilder) error {
+	o, err := openOOXML(path)
+	if err != nil {
+		return err
+	}
+	defer o.Close()
+	main, err := o.mainPart()
+	if err != nil {
+		return err
+	}
+	rels, err := o.rels(main)
+	if err != nil {
+		return err
+	}
+	var pres struct {
+		Slides []struct {
+			Attrs []xml.Attr `xml:",any,attr"`
+		} `xml:"sldIdLst>sldId"`
+	}
+	if err := o.unmarshal(main, &pres); err != nil {
+		return err
+	}
+
+	for i, slide := range pres.Slides {
+		rel, ok := rels[relID(slide.Attrs)]
+		if !ok || !strings.HasSuffix(rel.Type, relSlide) {
+			continue
+		}
+		shapes, err := slideShapes(o, rel.Target)
+		if err != nil {
+			return fmt.Errorf("slide %d: %w", i+1, err)
+		}
+
+		title := fmt.Sprintf("Slide %d", i+1)
+		var body []string
+		for _, s := range shapes {
+			switch s.placeholder {
+			case "title", "ctrTitle":
+				if s.text != "" {
+					title += ": " + s.text
+				}
+			case "sldNum", "dt", "ftr", "hdr":
+				// slide furniture, the same on every slide
+			default:
+				body = append(body, s.text)
+			}
+		}
+
+		b.page()
+		b.heading(1, title)
+		for _, text := range body {
+			b.paragraph(text)
+		}
+
+		notes, err := o.related(rel.Target, relNotesSlide)
+		if err != nil || notes == "" {
+			continue
+		}
+		shapes, err = slideShapes(o, notes)
+		if err != nil {
+			return fmt.Errorf("notes of slide %d: %w", i+1, err)
+		}
+		for _, s := range shapes {
+			if s.placeholder == "body" && s.text != "" {
+				b.paragraph("Notes: " + s.text)
+			}
+		}
+	}
+	return nil
+}
+
+// maxColumns is as wide as a sheet can be (XFD)
+const maxColumns = 16384
+
+// extractXLSX writes a page per sheet, headed by its name, with a row per spreadsheet row.
+// Cells come out as stored, so dates are serial numbers and formulas their last result.
+func extractXLSX(path string, b *textBuilder) error {
+	o, err := openOOXML(path)
+	if err != nil {
+		return err
+	}
+	defer o.Close()
+	main, err := o.mainPart()
+	if err != nil {
+		return err
+	}
+	rels, err := o.rels(main)
+	if err != nil {
+		return err
+	}
+	var book struct {
+		Sheets []struct {
+			Name  string     `xml:"name,attr"`
+			Attrs []xml.Attr `xml:",any,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := o.unmarshal(main, &book); err != nil {
+		return err
+	}
+	shared, err := sharedStrings(o, main)
+	if err != nil {
+		return err
+	}
+
+	for _, sheet := range book.Sheets {
+		rel, ok := rels[relID(sheet.Attrs)]
+		if !ok || !strings.HasSuffix(rel.Type, relWorksheet) {
+			// chartsheets and dialog sheets hold no cells
+			continue
+		}
+		b.page()
+
+		// the name heads the sheet's rows, an empty sheet gets no heading to stand on its own
+		headed := false
+		var cells []string
+		var value strings.Builder
+		col, kind, inValue := -1, "", false
+		err := o.tokens(rel.Target, func(tok xml.Token) {
+			switch t := tok.(type) {
+			case xml.StartElement:
+				switch t.Name.Local {
+				case "row":
+					cells, col = cells[:0], -1
+				case "c":
+					col, kind = cellColumn(attr(t, "r"), col), attr(t, "t")
+					value.Reset()
+				case "v", "t":
+					inValue = true
+				}
+			case xml.EndElement:
+				switch t.Name.Local {
+				case "v", "t":
+					inValue = false
+				case "c":
+					if col >= maxColumns {
+						break
+					}
+					for len(cells) <= col {
+						cells = append(cells, "")
+					}
+					cells[col] = cellText(value.String(), kind, shared)
+				case "row":
+					if !headed && strings.TrimSpace(strings.Join(cells, "")) != "" {
+						b.heading(1, sheet.Name)
+						headed = true
+					}
+					b.row(cells)
+				}
+			case xml.CharData:
+				if inValue {
+					value.Write(t)
+				}
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("sheet %s: %w", sheet.Name, err)
+		}
+	}
+	return nil
+}
+
+// sharedStrings reads the workbook's string table, which most text cells point into
+func sharedStrings(o *ooxml, main string) ([]string, error) {
+	part, err := o.related(main, relSharedStrings)
+	if err != nil || part == "" {
+		return nil, err
+	}
+	var table []string
+	var item strings.Builder
+	inText, phonetic := false, false
+	err = o.tokens(part, func(tok xml.Token) {
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "si":
+				item.Reset()
+			case "t":
+				inText = true
+			case "rPh":
+				// the reading of East Asian text, not part of it
+				phonetic = true
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "si":
+				table = append(table, item.String())
+			case "t":
+				inText = false
+			case "rPh":
+				phonetic = false
+			}
+		case xml.CharData:
+			if inText && !phonetic {
+				item.Write(t)
+			}
+		}
+	})
+	return table, err
+}
+
+// cellColumn is the 0-based column of a cell reference like "AB12", a cell without one follows the last
+func cellColumn(ref string, last int) int {
+	col := 0
+	letters := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		col = col*26 + int(r-'A'+1)
+		letters++
+	}
+	if letters == 0 || letters > 3 {
+		return last + 1
+	}
+	return col - 1
+}
+
+func cellText(value, kind string, shared []string) string {
+	switch kind {
+	case "s":
+		if i, err := strconv.Atoi(value); err == nil && i >= 0 && i < len(shared) {
+			return shared[i]
+		}
+		return ""
+	case "b":
+		if value == "1" {
+			return "TRUE"
+		}
+		return "FALSE"
+	}
+	return value
+}
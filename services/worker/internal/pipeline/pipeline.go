@@ -0,0 +1,349 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"unicode/utf8"
+
+	"github.com/dhruvkshah75/docstream/worker/internal/models"
+	"github.com/dhruvkshah75/docstream/worker/internal/tracing"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Document is passed through every stage, each stage reads what earlier stages left behind
+type Document struct {
+	Job  models.Job
+	Path string // local temp file holding the downloaded object
+	// TextPath is the file the extract stage wrote the text to, Path itself for plain text and
+	// markdown. The text of a big document is never held in memory all at once.
+	TextPath  string
+	TextSize  int             // bytes in TextPath
+	Pages     []int           // byte offset in the text where each PDF page, slide or sheet starts
+	Sections  []Section       // the headings, slides and sheets of the text in order
+	Language  string          // ISO 639-1 code from the language stage, "" when it couldn't tell
+	Class     string          // from the classify stage, "" when the document fits no class
+	Entities  []models.Entity // from the entities stage, nil when it didn't run
+	Summary   string          // from the summarize stage, "" without one
+	KeyPoints []string
+	Chunks    []models.Chunk    // filled in by the chunk stage, unless it streams them to the stages after it
+	Metadata  map[string]string // free-form values stages want to hand to later stages
+	// Usage adds up the tokens stages spent on the document, the worker reports it once it is done
+	Usage models.Usage
+}
+
+// Head returns up to n bytes from the start of the text, cut back to a whole character
+func (d *Document) Head(n int) (string, error) {
+	f, err := os.Open(d.TextPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	buf := make([]byte, min(n, d.TextSize))
+	read, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	return string(wholeRunes(buf[:read])), nil
+}
+
+// RemoveText removes the file the text was extracted to, the download itself is left alone
+func (d *Document) RemoveText() {
+	if d.TextPath != "" && d.TextPath != d.Path {
+		os.Remove(d.TextPath)
+	}
+}
+
+// wholeRunes drops a character cut off at the end of b
+func wholeRunes(b []byte) []byte {
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if !utf8.FullRune(b[i:]) {
+				return b[:i]
+			}
+			break
+		}
+	}
+	return b
+}
+
+// Section is a titled part of the extracted text, Start is its byte offset in Text
+type Section struct {
+	Start int    `json:"start"`
+	Title string `json:"title"`
+}
+
+// Stage is a single step of the processing pipeline.
+// Implement this to plug new processing into the worker.
+type Stage interface {
+	Name() string
+	Process(ctx context.Context, doc *Document) error
+}
+
+// Cleaner is implemented by stages that leave something behind outside the worker,
+// so a cancelled job can take it back. Cleanup must be safe to call when the stage never ran.
+type Cleaner interface {
+	Cleanup(ctx context.Context, doc *Document) error
+}
+
+// ChunkSource is the chunk stage, it hands the chunks to emit as it splits them off. When the
+// stages right after it in the pipeline are ChunkSinks they get every batch as it comes, and
+// a big document never has all of its chunks and their vectors in memory at once.
+type ChunkSource interface {
+	Stage
+	Emit(ctx context.Context, doc *Document, emit func(chunks []models.Chunk) error) error
+}
+
+// ChunkSink is a stage that works on chunks a batch at a time, Flush runs after the last
+// batch. Process does the same for doc.Chunks in one go, for a pipeline that doesn't stream.
+type ChunkSink interface {
+	Stage
+	Consume(ctx context.Context, doc *Document, chunks []models.Chunk) error
+	Flush(ctx context.Context, doc *Document) error
+}
+
+// StageError tells the caller which stage broke
+type StageError struct {
+	Stage string
+	Err   error
+}
+
+func (e *StageError) Error() string {
+	return fmt.Sprintf("stage %s: %v", e.Stage, e.Err)
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+// permanentError marks a failure that retrying won't fix, like an unsupported or empty file
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so the worker sends the job straight to the dead letter queue instead of retrying it
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err (or anything it wraps) was marked with Permanent
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// Pipeline runs a document's stages in order and stops at the first failure. Which stages
+// those are can depend on the document's format and the job, see Route.
+type Pipeline struct {
+	// stages are all the stages it knows, in the order a document goes through them by default
+	stages []Stage
+	// routes are the stage orders set with Route, keyed by format
+	routes map[string][]Stage
+	// slots hold a token for every job running a capped stage
+	slots map[string]chan struct{}
+}
+
+func New(stages ...Stage) *Pipeline {
+	return &Pipeline{stages: stages, routes: map[string][]Stage{}, slots: map[string]chan struct{}{}}
+}
+
+// Limit caps how many jobs run each named stage at once, stages it doesn't name aren't capped.
+// Names that aren't stages of the pipeline can still be waited for with Acquire.
+func (p *Pipeline) Limit(limits map[string]int) *Pipeline {
+	for name, n := range limits {
+		p.slots[name] = make(chan struct{}, n)
+	}
+	return p
+}
+
+// Acquire waits for a turn at the named stage and returns the func that gives it back.
+// It only fails when ctx is done first.
+func (p *Pipeline) Acquire(ctx context.Context, name string) (func(), error) {
+	slots, ok := p.slots[name]
+	if !ok {
+		return func() {}, nil
+	}
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	default:
+	}
+	log.Printf("Waiting for a free %s slot, %d jobs are running it\n", name, cap(slots))
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Progress hears about the stages of a run, either func may be nil
+type Progress struct {
+	Started func(stage string)
+	// Done is called once a stage got through, the stages after it may still fail
+	Done func(stage string)
+}
+
+func (p Progress) started(stage string) {
+	if p.Started != nil {
+		p.Started(stage)
+	}
+}
+
+func (p Progress) done(stage string) {
+	if p.Done != nil {
+		p.Done(stage)
+	}
+}
+
+// Run executes the stages of doc's route on it, telling progress as each one starts and is done
+func (p *Pipeline) Run(ctx context.Context, doc *Document, progress Progress) error {
+	if doc.Metadata == nil {
+		doc.Metadata = map[string]string{}
+	}
+
+	stages, err := p.stagesFor(doc)
+	if err != nil {
+		return &StageError{Stage: "pipeline", Err: err}
+	}
+	stages = skip(stages, doc.Job.Options.Skip)
+	class := doc.Class
+	for i := 0; i < len(stages); i++ {
+		stage := stages[i]
+		// stop early if the worker is shutting down
+		if err := ctx.Err(); err != nil {
+			return &StageError{Stage: stage.Name(), Err: err}
+		}
+
+		if source, ok := stage.(ChunkSource); ok {
+			var sinks []ChunkSink
+			for _, next := range stages[i+1:] {
+				sink, ok := next.(ChunkSink)
+				if !ok {
+					break
+				}
+				sinks = append(sinks, sink)
+			}
+			if len(sinks) > 0 {
+				if err := p.stream(ctx, source, sinks, doc, progress); err != nil {
+					return err
+				}
+				i += len(sinks)
+				continue
+			}
+		}
+
+		if err := p.run(ctx, stage, doc, progress); err != nil {
+			return &StageError{Stage: stage.Name(), Err: err}
+		}
+		progress.done(stage.Name())
+		if doc.Class != class {
+			class = doc.Class
+			stages = skip(p.reroute(doc, stages, i), doc.Job.Options.Skip)
+		}
+	}
+	return nil
+}
+
+// stream runs source with every batch of chunks going through sinks in order as it comes,
+// then flushes the sinks. Each sink's turn at its stage is taken per batch, source holds on
+// to its own for the whole document.
+func (p *Pipeline) stream(ctx context.Context, source ChunkSource, sinks []ChunkSink, doc *Document, progress Progress) error {
+	release, err := p.Acquire(ctx, source.Name())
+	if err != nil {
+		return &StageError{Stage: source.Name(), Err: err}
+	}
+	defer release()
+
+	// a sink's stage starts with its first batch, as far as progress and tracing go
+	sinkCtxs := make([]context.Context, len(sinks))
+	sinkSpans := make([]trace.Span, len(sinks))
+	defer func() {
+		for _, span := range sinkSpans {
+			if span != nil {
+				span.End()
+			}
+		}
+	}()
+	through := func(i int, do func(ctx context.Context) error) error {
+		if sinkCtxs[i] == nil {
+			log.Printf("[%s] running stage %s\n", doc.Job.JobID, sinks[i].Name())
+			progress.started(sinks[i].Name())
+			sinkCtxs[i], sinkSpans[i] = tracing.Start(ctx, "stage "+sinks[i].Name())
+		}
+		release, err := p.Acquire(ctx, sinks[i].Name())
+		if err == nil {
+			err = do(sinkCtxs[i])
+			release()
+		}
+		if err != nil {
+			tracing.End(sinkSpans[i], err)
+			sinkSpans[i] = nil
+			return &StageError{Stage: sinks[i].Name(), Err: err}
+		}
+		return nil
+	}
+
+	log.Printf("[%s] running stage %s\n", doc.Job.JobID, source.Name())
+	progress.started(source.Name())
+	sourceCtx, span := tracing.Start(ctx, "stage "+source.Name())
+	err = source.Emit(sourceCtx, doc, func(chunks []models.Chunk) error {
+		for i, sink := range sinks {
+			if err := through(i, func(ctx context.Context) error { return sink.Consume(ctx, doc, chunks) }); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	tracing.End(span, err)
+	var stageErr *StageError
+	if errors.As(err, &stageErr) {
+		return err
+	} else if err != nil {
+		return &StageError{Stage: source.Name(), Err: err}
+	}
+	progress.done(source.Name())
+
+	for i, sink := range sinks {
+		if err := through(i, func(ctx context.Context) error { return sink.Flush(ctx, doc) }); err != nil {
+			return err
+		}
+		progress.done(sink.Name())
+	}
+	return nil
+}
+
+// run runs one stage once it gets a turn at it
+func (p *Pipeline) run(ctx context.Context, stage Stage, doc *Document, progress Progress) error {
+	release, err := p.Acquire(ctx, stage.Name())
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	log.Printf("[%s] running stage %s\n", doc.Job.JobID, stage.Name())
+	progress.started(stage.Name())
+	stageCtx, span := tracing.Start(ctx, "stage "+stage.Name())
+	err = stage.Process(stageCtx, doc)
+	tracing.End(span, err)
+	return err
+}
+
+// Cleanup asks every stage that implements Cleaner to undo its work on doc, trying all of them even if one fails
+func (p *Pipeline) Cleanup(ctx context.Context, doc *Document) error {
+	var errs []error
+	for _, stage := range p.stages {
+		if cleaner, ok := stage.(Cleaner); ok {
+			if err := cleaner.Cleanup(ctx, doc); err != nil {
+				errs = append(errs, &StageError{Stage: stage.Name(), Err: err})
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,63 @@
+package pipeline
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Plugin is a stage of your own and where it goes among the others
+type Plugin struct {
+	Stage Stage
+	// After is the stage it runs after, empty runs it after all of them. A route can still put
+	// it anywhere, or leave it out.
+	After string
+}
+
+// registered are the Go stages added with Register
+var registered []Plugin
+
+// Register adds a Go stage of your own, like PII redaction or a parser for another format,
+// to the worker's pipeline. Call it from an init func in a file of the worker's main package:
+//
+//	func init() {
+//		pipeline.Register(RedactStage{}, "extract")
+//	}
+//
+// Stages that aren't written in Go are run as commands instead, see ExecStage.
+func Register(stage Stage, after string) {
+	registered = append(registered, Plugin{Stage: stage, After: after})
+}
+
+// Registered returns the stages added with Register, in the order they were
+func Registered() []Plugin {
+	return slices.Clone(registered)
+}
+
+// Plug puts plugins among stages, each right after the stage it names. Plugins after the
+// same stage run in the order they are given, one may name a plugin before it.
+func Plug(stages []Stage, plugins []Plugin) ([]Stage, error) {
+	stages = slices.Clone(stages)
+	// the next one after a stage goes behind the plugins already put after it
+	last := map[string]string{}
+	for _, plugin := range plugins {
+		name := plugin.Stage.Name()
+		if slices.ContainsFunc(stages, func(stage Stage) bool { return stage.Name() == name }) {
+			return nil, fmt.Errorf("plugin %s: there is a stage by that name already", name)
+		}
+		if plugin.After == "" {
+			stages = append(stages, plugin.Stage)
+			continue
+		}
+		after := plugin.After
+		if l, ok := last[after]; ok {
+			after = l
+		}
+		i := slices.IndexFunc(stages, func(stage Stage) bool { return stage.Name() == after })
+		if i < 0 {
+			return nil, fmt.Errorf("plugin %s: no stage %q to run after, is it enabled?", name, plugin.After)
+		}
+		stages = slices.Insert(stages, i+1, plugin.Stage)
+		last[plugin.After] = name
+	}
+	return stages, nil
+}
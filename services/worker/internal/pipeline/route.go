@@ -0,0 +1,146 @@
+package pipeline
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// DefaultRoute is the format Route takes for every format without a route of its own
+const DefaultRoute = "default"
+
+// ClassRoute goes in front of a class to route documents by it instead of a format, e.g.
+// "class:invoice". The route takes over once the classify stage picked the class.
+const ClassRoute = "class:"
+
+// Step is a stage of a route and the stages it waits for. Needs left nil is the step listed
+// right before it, so a plain list of steps runs in the order it is written.
+type Step struct {
+	Stage string
+	Needs []string
+}
+
+// Route sends documents of format through steps instead of every stage. The steps form a
+// graph, they run one at a time in an order where each comes after what it needs, otherwise
+// in the order they are listed. Stages can be left out, reordered or swapped for another
+// stage this way, as long as the stages after them still find what they read in the document.
+func (p *Pipeline) Route(format string, steps []Step) error {
+	order, err := order(steps)
+	if err != nil {
+		return fmt.Errorf("pipeline for %s: %w", format, err)
+	}
+	route := make([]Stage, len(order))
+	for i, name := range order {
+		stage := p.stage(name)
+		if stage == nil {
+			return fmt.Errorf("pipeline for %s: no stage %q, is it enabled?", format, name)
+		}
+		route[i] = stage
+	}
+	p.routes[format] = route
+	return nil
+}
+
+// order sorts steps so each comes after the ones it needs, keeping their order otherwise
+func order(steps []Step) ([]string, error) {
+	needs := map[string][]string{}
+	for i, step := range steps {
+		if _, dup := needs[step.Stage]; dup {
+			return nil, fmt.Errorf("stage %s is listed twice", step.Stage)
+		}
+		needs[step.Stage] = step.Needs
+		if step.Needs == nil && i > 0 {
+			needs[step.Stage] = []string{steps[i-1].Stage}
+		}
+	}
+	for _, step := range steps {
+		for _, need := range needs[step.Stage] {
+			if _, ok := needs[need]; !ok {
+				return nil, fmt.Errorf("stage %s needs %s, which isn't in the pipeline", step.Stage, need)
+			}
+		}
+	}
+
+	done := map[string]bool{}
+	var order []string
+	for len(order) < len(steps) {
+		next := slices.IndexFunc(steps, func(step Step) bool {
+			return !done[step.Stage] && !slices.ContainsFunc(needs[step.Stage], func(need string) bool { return !done[need] })
+		})
+		if next < 0 {
+			return nil, fmt.Errorf("the stages need each other in a circle")
+		}
+		done[steps[next].Stage] = true
+		order = append(order, steps[next].Stage)
+	}
+	return order, nil
+}
+
+// stagesFor picks doc's stages: the ones its job lists, or else the route for its format
+func (p *Pipeline) stagesFor(doc *Document) ([]Stage, error) {
+	if names := doc.Job.Options.Pipeline; names != "" {
+		var stages []Stage
+		for _, name := range strings.Split(names, ",") {
+			stage := p.stage(strings.TrimSpace(name))
+			if stage == nil {
+				// the job asked for it, it won't be there next time either
+				return nil, Permanent(fmt.Errorf("the job's pipeline has stage %q, this worker has no such stage", name))
+			}
+			stages = append(stages, stage)
+		}
+		return stages, nil
+	}
+
+	if len(p.routes) == 0 {
+		return p.stages, nil
+	}
+	// a file whose format can't be told takes the default route, extract says what's wrong with it
+	if format, err := detectFormat(doc.Path, doc.Job.Filename); err == nil {
+		if route, ok := p.routes[format]; ok {
+			return route, nil
+		}
+	}
+	if route, ok := p.routes[DefaultRoute]; ok {
+		return route, nil
+	}
+	return p.stages, nil
+}
+
+// reroute switches a document that was just classified, with stages up to done run already,
+// to its class's route. Stages of the route that already ran aren't run again. A job that
+// picked its own stages keeps them.
+func (p *Pipeline) reroute(doc *Document, stages []Stage, done int) []Stage {
+	route, ok := p.routes[ClassRoute+doc.Class]
+	if !ok || doc.Job.Options.Pipeline != "" {
+		return stages
+	}
+	next := slices.Clone(stages[:done+1])
+	for _, stage := range route {
+		ran := slices.ContainsFunc(next, func(other Stage) bool { return other.Name() == stage.Name() })
+		if !ran {
+			next = append(next, stage)
+		}
+	}
+	return next
+}
+
+// skip leaves out the stages named in names, comma separated, the ones after them read what they can without
+func skip(stages []Stage, names string) []Stage {
+	if names == "" {
+		return stages
+	}
+	skipped := strings.Split(names, ",")
+	return slices.DeleteFunc(slices.Clone(stages), func(stage Stage) bool {
+		return slices.ContainsFunc(skipped, func(name string) bool { return strings.TrimSpace(name) == stage.Name() })
+	})
+}
+
+// stage finds a stage by name, nil if there's none
+func (p *Pipeline) stage(name string) Stage {
+	for _, stage := range p.stages {
+		if stage.Name() == name {
+			return stage
+		}
+	}
+	return nil
+}
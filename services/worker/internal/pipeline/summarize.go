@@ -0,0 +1,84 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/dhruvkshah75/docstream/worker/internal/llm"
+)
+
+// summaryPrompt asks for JSON, models that wrap it in a code block or add a sentence around
+// it are still understood
+const summaryPrompt = `You summarize documents for a document management system. Read the document the user sends and answer with JSON only, no other text:
+{"summary": "<two to four sentences on what the document is and says>", "key_points": ["<the most important facts, figures or conclusions, one short sentence each>"]}
+Give at most %d key points. Write in the language of the document.`
+
+// SummarizeStage has an LLM write a short summary and the key points of a document, so the UI
+// can show what it is about without opening it. Only the start of a long document is sent.
+// A model that fails or answers nonsense leaves the document without a summary, the job
+// doesn't fail over it. A job naming a summary model has it asked instead of the configured one.
+type SummarizeStage struct {
+	LLM       llm.Provider
+	KeyPoints int // at most this many
+	MaxInput  int // bytes of text sent to the model
+}
+
+func (SummarizeStage) Name() string { return "summarize" }
+
+func (s SummarizeStage) Process(ctx context.Context, doc *Document) error {
+	if s.LLM == nil {
+		return nil
+	}
+	text, err := doc.Head(s.MaxInput)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+	if len(text) < doc.TextSize {
+		text += "\n[...the rest of the document is left out]"
+	}
+
+	provider := s.LLM
+	if model := doc.Job.Options.SummaryModel; model != "" {
+		provider = provider.WithModel(model)
+	}
+	answer, usage, err := provider.Complete(ctx, []llm.Message{
+		{Role: llm.RoleSystem, Content: fmt.Sprintf(summaryPrompt, s.KeyPoints)},
+		{Role: llm.RoleUser, Content: text},
+	})
+	// the tokens are spent whether the answer is any use or not
+	doc.Usage.LLMInputTokens += usage.InputTokens
+	doc.Usage.LLMOutputTokens += usage.OutputTokens
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Printf("[%s] No summary, %s failed: %v\n", doc.Job.JobID, provider.Model(), err)
+		return nil
+	}
+
+	var summary struct {
+		Summary   string   `json:"summary"`
+		KeyPoints []string `json:"key_points"`
+	}
+	start, end := strings.Index(answer, "{"), strings.LastIndex(answer, "}")
+	if start < 0 || end < start || json.Unmarshal([]byte(answer[start:end+1]), &summary) != nil || strings.TrimSpace(summary.Summary) == "" {
+		log.Printf("[%s] No summary, %s didn't answer with one\n", doc.Job.JobID, provider.Model())
+		return nil
+	}
+	doc.Summary = strings.TrimSpace(summary.Summary)
+	doc.KeyPoints = nil
+	for _, point := range summary.KeyPoints {
+		if point = strings.TrimSpace(point); point != "" && len(doc.KeyPoints) < s.KeyPoints {
+			doc.KeyPoints = append(doc.KeyPoints, point)
+		}
+	}
+	doc.Metadata["summary_model"] = provider.Model()
+	log.Printf("[%s] Summarized with %d key points\n", doc.Job.JobID, len(doc.KeyPoints))
+	return nil
+}
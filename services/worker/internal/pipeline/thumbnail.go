@@ -0,0 +1,169 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/worker/internal/envelope"
+	"github.com/dhruvkshah75/docstream/worker/internal/models"
+	"github.com/dhruvkshah75/docstream/worker/internal/objectstore"
+)
+
+const (
+	// renderTimeout bounds pdftoppm on one page, a pathological PDF shouldn't hold up the job
+	renderTimeout = 30 * time.Second
+	// textPageBytes is more of the text than fits on one page
+	textPageBytes = 16 << 10
+)
+
+// ThumbnailStage renders the first page as a small thumbnail and a low-res preview and stores
+// them under derived/<document id>/. PDFs go through pdftoppm, everything else is drawn from its
+// extracted text as a page of grey lines. They are nice to have, so a failure is logged and the job goes on.
+type ThumbnailStage struct {
+	Objects objectstore.Store
+	// Keys encrypts the images with the document's own data key when the document is encrypted
+	Keys *envelope.Keyring
+	// PDFRenderer is the pdftoppm binary, empty skips PDFs
+	PDFRenderer  string
+	Width        int
+	PreviewWidth int
+	TempDir      string // where pdftoppm draws, empty is the system's temp directory
+}
+
+func (ThumbnailStage) Name() string { return "thumbnail" }
+
+func (s ThumbnailStage) Process(ctx context.Context, doc *Document) error {
+	job := doc.Job
+	format := doc.Metadata["format"]
+	if format == formatPDF && s.PDFRenderer == "" {
+		return nil
+	}
+
+	for _, size := range []struct {
+		file  string
+		width int
+	}{{models.ThumbnailFile, s.Width}, {models.PreviewFile, s.PreviewWidth}} {
+		var img []byte
+		var err error
+		if format == formatPDF {
+			img, err = s.renderPDF(ctx, doc.Path, size.width)
+		} else {
+			// everything but plain text is extracted with markdown headings
+			var text string
+			if text, err = doc.Head(textPageBytes); err == nil {
+				img, err = textPage(text, format != formatText, size.width)
+			}
+		}
+		if err == nil {
+			err = s.put(ctx, job, size.file, img)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Printf("[%s] No %s: %v\n", job.JobID, size.file, err)
+			return nil
+		}
+	}
+	log.Printf("[%s] Rendered thumbnail and preview\n", job.JobID)
+	return nil
+}
+
+// put stores one image, sealed with the document's data key if the document itself is
+func (s ThumbnailStage) put(ctx context.Context, job models.Job, file string, img []byte) error {
+	var body io.Reader = bytes.NewReader(img)
+	size := int64(len(img))
+	if job.EncryptionKey != "" {
+		key, err := s.Keys.Unwrap(ctx, job.EncryptionKey)
+		if err != nil {
+			return err
+		}
+		if body, err = envelope.Encrypt(body, key, 1); err != nil {
+			return err
+		}
+		size = envelope.SealedSize(size)
+	}
+	_, err := s.Objects.Put(ctx, job.Bucket, models.DerivedKey(job.DocumentID, file), body, size, "image/png")
+	return err
+}
+
+// renderPDF has pdftoppm draw the first page width pixels wide as a PNG
+func (s ThumbnailStage) renderPDF(ctx context.Context, path string, width int) ([]byte, error) {
+	dir, err := os.MkdirTemp(s.TempDir, objectstore.TempPrefix+"thumbnail-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(ctx, renderTimeout)
+	defer cancel()
+	out := filepath.Join(dir, "page")
+	cmd := exec.CommandContext(ctx, s.PDFRenderer, "-png", "-f", "1", "-l", "1", "-singlefile",
+		"-scale-to-x", strconv.Itoa(width), "-scale-to-y", "-1", path, out)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %w: %s", s.PDFRenderer, err, strings.TrimSpace(stderr.String()))
+	}
+	return os.ReadFile(out + ".png")
+}
+
+// textPage draws text the way a page of it looks from a distance: an A4 sheet with a grey bar
+// per line, as long as the line is. Markdown headings come out darker and thicker.
+func textPage(text string, markdown bool, width int) ([]byte, error) {
+	const columns = 80
+	height := width * 1414 / 1000
+	margin := width / 12
+	row := max(2, width/48)
+	usable := width - 2*margin
+
+	page := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(page, page.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	body := image.NewUniform(color.Gray{Y: 0xb4})
+	heading := image.NewUniform(color.Gray{Y: 0x5a})
+
+	y := margin
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		ink, thickness := body, max(1, row/2)
+		if markdown && strings.HasPrefix(line, "#") {
+			line = strings.TrimLeft(line, "# ")
+			ink, thickness = heading, max(1, row*3/4)
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+		chars := len([]rune(line)) - indent
+		if chars == 0 {
+			y += row
+		}
+		// long lines wrap onto the next rows like they would on paper
+		for chars > 0 && y+thickness <= height-margin {
+			n := min(chars, columns-min(indent, columns/2))
+			x := margin + min(indent, columns/2)*usable/columns
+			draw.Draw(page, image.Rect(x, y, x+max(1, n*usable/columns), y+thickness), ink, image.Point{}, draw.Src)
+			chars -= n
+			y += row
+		}
+		if y+row > height-margin {
+			break
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, page); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,374 @@
+package queue
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/worker/internal/config"
+	"github.com/dhruvkshah75/docstream/worker/internal/tracing"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+)
+
+// Kafka topics, one per kind of message, shared with the gateway. Each gets the configured
+// prefix in front. Jobs that fail for good are moved to TopicDeadLetters, retries wait in
+// TopicRetries until they are due and are then moved back onto TopicJobs.
+const (
+	TopicJobs          = "jobs"
+	TopicRetries       = "jobs.retry"
+	TopicDeadLetters   = "jobs.dlq"
+	TopicResults       = "results"
+	TopicEvents        = "events"
+	TopicTombstones    = "tombstones"
+	TopicCancellations = "cancellations"
+)
+
+// retryAtHeader is when a parked retry is due, in Unix milliseconds
+const retryAtHeader = "x-retry-at"
+
+const (
+	// the client retries a publish on its own for this long before giving up on it
+	kafkaPublishTimeout = 10 * time.Second
+	kafkaCommitTimeout  = 10 * time.Second
+	// how long moving a due retry waits before trying again when Kafka won't take it
+	forwardRetryDelay = 5 * time.Second
+
+	// events and cancellations are only useful while they are fresh
+	shortRetention = time.Hour
+)
+
+// kafkaBroker publishes with one idempotent producer client, every consumer gets a client
+// of its own. Messages are keyed by document ID, so everything about one document stays
+// in order on one partition. How many workers can take jobs at once is capped by the
+// number of partitions of the jobs topic.
+type kafkaBroker struct {
+	cfg    config.Kafka
+	client *kgo.Client
+}
+
+func newKafka(ctx context.Context, cfg config.Kafka) (*kafkaBroker, error) {
+	client, err := kgo.NewClient(append(kafkaOpts(cfg), kgo.RecordDeliveryTimeout(kafkaPublishTimeout))...)
+	if err != nil {
+		return nil, fmt.Errorf("creating Kafka client: %w", err)
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := client.Ping(pingCtx); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("connecting to Kafka: %w", err)
+	}
+
+	// a locked down cluster may not let us create topics, then they have to exist already
+	if err := createTopics(ctx, client, cfg); err != nil {
+		log.Println("Warning: Failed to create the Kafka topics, they have to be created by hand:", err)
+	}
+
+	log.Println("Successfully connected to Kafka at", strings.Join(cfg.Brokers, ","))
+	return &kafkaBroker{cfg: cfg, client: client}, nil
+}
+
+// kafkaOpts are the connection settings every client shares
+func kafkaOpts(cfg config.Kafka) []kgo.Opt {
+	opts := []kgo.Opt{kgo.SeedBrokers(cfg.Brokers...), kgo.ClientID("docstream-worker")}
+	if cfg.TLS {
+		opts = append(opts, kgo.DialTLSConfig(&tls.Config{MinVersion: tls.VersionTLS12}))
+	}
+	switch cfg.SASLMechanism {
+	case "plain":
+		opts = append(opts, kgo.SASL(plain.Auth{User: cfg.SASLUsername, Pass: cfg.SASLPassword}.AsMechanism()))
+	case "scram-sha-256":
+		opts = append(opts, kgo.SASL(scram.Auth{User: cfg.SASLUsername, Pass: cfg.SASLPassword}.AsSha256Mechanism()))
+	case "scram-sha-512":
+		opts = append(opts, kgo.SASL(scram.Auth{User: cfg.SASLUsername, Pass: cfg.SASLPassword}.AsSha512Mechanism()))
+	}
+	return opts
+}
+
+// createTopics creates whichever topics don't exist yet, the gateway does the same on its side
+func createTopics(ctx context.Context, client *kgo.Client, cfg config.Kafka) error {
+	admin := kadm.NewClient(client)
+	retention := strconv.FormatInt(shortRetention.Milliseconds(), 10)
+
+	sets := []struct {
+		configs map[string]*string
+		topics  []string
+	}{
+		{nil, []string{TopicJobs, TopicRetries, TopicDeadLetters, TopicResults, TopicTombstones}},
+		{map[string]*string{"retention.ms": &retention}, []string{TopicEvents, TopicCancellations}},
+	}
+	for _, set := range sets {
+		names := make([]string, len(set.topics))
+		for i, t := range set.topics {
+			names[i] = cfg.TopicPrefix + t
+		}
+		resps, err := admin.CreateTopics(ctx, int32(cfg.Partitions), int16(cfg.ReplicationFactor), set.configs, names...)
+		if err != nil {
+			return err
+		}
+		for _, resp := range resps.Sorted() {
+			if resp.Err != nil && !errors.Is(resp.Err, kerr.TopicAlreadyExists) {
+				return fmt.Errorf("creating topic %s: %w", resp.Topic, resp.Err)
+			}
+		}
+	}
+	return nil
+}
+
+func (k *kafkaBroker) topic(name string) string { return k.cfg.TopicPrefix + name }
+
+// ConsumeJobs shares the jobs topic between the workers through a consumer group. Whoever
+// takes jobs also moves due retries back onto the jobs topic.
+func (k *kafkaBroker) ConsumeJobs(ctx context.Context) (<-chan Delivery, error) {
+	retries, err := k.consume(ctx, TopicRetries, "retries")
+	if err != nil {
+		return nil, err
+	}
+	go k.forwardRetries(ctx, retries)
+
+	return k.consume(ctx, TopicJobs, "worker")
+}
+
+func (k *kafkaBroker) ConsumeTombstones(ctx context.Context) (<-chan Delivery, error) {
+	return k.consume(ctx, TopicTombstones, "vector-tombstones")
+}
+
+// ConsumeCancellations reads every partition from the end, no group involved
+func (k *kafkaBroker) ConsumeCancellations(ctx context.Context) (<-chan Delivery, error) {
+	return k.consume(ctx, TopicCancellations, "")
+}
+
+func (k *kafkaBroker) PublishResult(ctx context.Context, documentID string, body []byte) error {
+	headers := map[string]string{}
+	tracing.Inject(ctx, headers)
+	return k.produce(ctx, TopicResults, documentID, body, headers)
+}
+
+func (k *kafkaBroker) PublishEvent(ctx context.Context, documentID, jobID string, body []byte) error {
+	return k.produce(ctx, TopicEvents, documentID, body, nil)
+}
+
+// PublishRetry parks the job on the retry topic, stamped with when it is due
+func (k *kafkaBroker) PublishRetry(ctx context.Context, d Delivery, attempt int, delay time.Duration) error {
+	headers := map[string]string{}
+	for name, v := range d.Headers {
+		headers[name] = v
+	}
+	headers[AttemptsHeader] = strconv.Itoa(attempt)
+	headers[retryAtHeader] = strconv.FormatInt(time.Now().Add(delay).UnixMilli(), 10)
+	return k.produce(ctx, TopicRetries, d.Key, d.Body, headers)
+}
+
+// forwardRetries moves parked retries back onto the jobs topic once they are due. A
+// partition's retries come out in the order they went in, so a short delay can end up
+// waiting behind a longer one. The retry is late then, but never lost.
+func (k *kafkaBroker) forwardRetries(ctx context.Context, retries <-chan Delivery) {
+	for d := range retries {
+		due, _ := strconv.ParseInt(d.Headers[retryAtHeader], 10, 64)
+		if !sleep(ctx, time.Until(time.UnixMilli(due))) {
+			return
+		}
+
+		headers := map[string]string{}
+		for name, v := range d.Headers {
+			if name != retryAtHeader {
+				headers[name] = v
+			}
+		}
+		for {
+			err := k.produce(ctx, TopicJobs, d.Key, d.Body, headers)
+			if err == nil {
+				break
+			}
+			log.Printf("Failed to move a retry back onto %s: %v\n", k.topic(TopicJobs), err)
+			if !sleep(ctx, forwardRetryDelay) {
+				return
+			}
+		}
+		if err := d.Ack(); err != nil {
+			log.Println("Failed to commit a forwarded retry:", err)
+		}
+	}
+}
+
+// sleep waits for d, it returns false if ctx is done first
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// produce waits for every in-sync replica to have the record, the client retries on its own until kafkaPublishTimeout
+func (k *kafkaBroker) produce(ctx context.Context, topic, key string, body []byte, headers map[string]string) error {
+	rec := &kgo.Record{Topic: k.topic(topic), Key: []byte(key), Value: body, Headers: kafkaHeaders(headers)}
+	return k.client.ProduceSync(ctx, rec).FirstErr()
+}
+
+// consume reads topic with a client of its own until ctx is done. In a group the partitions
+// are shared out between its members and acking commits the offset, a new group starts at
+// the oldest record. Without a group this consumer sees everything from now on and acks do nothing.
+func (k *kafkaBroker) consume(ctx context.Context, topic, group string) (<-chan Delivery, error) {
+	opts := append(kafkaOpts(k.cfg), kgo.ConsumeTopics(k.topic(topic)))
+	if group != "" {
+		opts = append(opts, kgo.ConsumerGroup(k.cfg.TopicPrefix+group), kgo.DisableAutoCommit(), kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()))
+	} else {
+		opts = append(opts, kgo.ConsumeResetOffset(kgo.NewOffset().AtEnd()))
+	}
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Listening on Kafka topic '%s'\n", k.topic(topic))
+	commits := &commitOrder{client: client, partitions: map[topicPartition][]*pending{}}
+	out := make(chan Delivery)
+	go func() {
+		defer close(out)
+		defer client.Close()
+		for {
+			fetches := client.PollFetches(ctx)
+			if ctx.Err() != nil || fetches.IsClientClosed() {
+				return
+			}
+			// the client keeps retrying on its own, these are just worth knowing about
+			fetches.EachError(func(t string, p int32, err error) {
+				log.Printf("Kafka fetch error on %s/%d: %v\n", t, p, err)
+			})
+			for _, rec := range fetches.Records() {
+				select {
+				case out <- k.delivery(commits, rec, group != ""):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+// delivery wraps a record. Kafka can't hand the same record out twice, so a requeue
+// publishes a copy to the back of the topic, and a rejected job is copied to the dead
+// letter topic, before the original is committed.
+func (k *kafkaBroker) delivery(commits *commitOrder, rec *kgo.Record, grouped bool) Delivery {
+	d := Delivery{Body: rec.Value, Key: string(rec.Key), Headers: map[string]string{}, Attempts: 1}
+	for _, h := range rec.Headers {
+		d.Headers[h.Key] = string(h.Value)
+	}
+	if n, err := strconv.Atoi(d.Headers[AttemptsHeader]); err == nil && n > 0 {
+		d.Attempts = n
+	}
+	if !grouped {
+		return d
+	}
+
+	p := commits.track(rec)
+	commit := func() error { return commits.done(p) }
+	d.ack = commit
+	d.nack = func(requeue bool) error {
+		topic := rec.Topic
+		if !requeue {
+			if topic != k.topic(TopicJobs) {
+				return commit()
+			}
+			topic = k.topic(TopicDeadLetters)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), kafkaPublishTimeout)
+		defer cancel()
+		again := &kgo.Record{Topic: topic, Key: rec.Key, Value: rec.Value, Headers: rec.Headers}
+		if err := k.client.ProduceSync(ctx, again).FirstErr(); err != nil {
+			// left uncommitted, the group hands it out again after the next rebalance
+			return err
+		}
+		return commit()
+	}
+	return d
+}
+
+// commitOrder commits the records of a partition in order while they are acked in any order.
+// Committing a record's offset marks everything before it as done, so a job that finished
+// early is only committed once every job before it on its partition is, a crash in between
+// hands out the finished one again rather than losing the one still running.
+type commitOrder struct {
+	client *kgo.Client
+
+	// mu is held through the commit itself, two commits for one partition racing each other
+	// could move its offset backwards
+	mu         sync.Mutex
+	partitions map[topicPartition][]*pending // handed out and not committed, by offset
+}
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+type pending struct {
+	rec  *kgo.Record
+	done bool
+}
+
+// track notes a record as it is handed out, records of a partition come in offset order
+func (o *commitOrder) track(rec *kgo.Record) *pending {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	tp := topicPartition{rec.Topic, rec.Partition}
+	list := o.partitions[tp]
+	// a partition that came back after a rebalance starts over at its last commit, whatever
+	// was still outstanding belongs to the old assignment and is handed out again
+	if n := len(list); n > 0 && list[n-1].rec.Offset >= rec.Offset {
+		list = nil
+	}
+	p := &pending{rec: rec}
+	o.partitions[tp] = append(list, p)
+	return p
+}
+
+// done marks p as acked and commits as far as every record before it is acked too
+func (o *commitOrder) done(p *pending) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	p.done = true
+	tp := topicPartition{p.rec.Topic, p.rec.Partition}
+	list := o.partitions[tp]
+	var last *kgo.Record
+	for len(list) > 0 && list[0].done {
+		last, list = list[0].rec, list[1:]
+	}
+	o.partitions[tp] = list
+	if last == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), kafkaCommitTimeout)
+	defer cancel()
+	return o.client.CommitRecords(ctx, last)
+}
+
+func kafkaHeaders(headers map[string]string) []kgo.RecordHeader {
+	out := make([]kgo.RecordHeader, 0, len(headers))
+	for k, v := range headers {
+		out = append(out, kgo.RecordHeader{Key: k, Value: []byte(v)})
+	}
+	return out
+}
+
+func (k *kafkaBroker) Close() {
+	k.client.Close()
+}
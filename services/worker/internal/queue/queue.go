@@ -0,0 +1,90 @@
+// Package queue is the message bus between the gateway and the workers, RabbitMQ or Kafka.
+// QUEUE_BACKEND picks one and has to match the gateway's.
+package queue
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/worker/internal/config"
+)
+
+// AttemptsHeader counts how many times a job has been tried
+const AttemptsHeader = "x-attempts"
+
+// Delivery is one message handed to a consumer
+type Delivery struct {
+	Body []byte
+	// Key is the document the message is about, RabbitMQ deliveries don't carry one
+	Key string
+	// Headers carry the trace context along
+	Headers map[string]string
+	// Attempts is how often the job has been tried, counting this one
+	Attempts int
+
+	ack  func() error
+	nack func(requeue bool) error
+}
+
+// Ack marks the message as handled, deliveries that don't need acking ignore it
+func (d Delivery) Ack() error {
+	if d.ack == nil {
+		return nil
+	}
+	return d.ack()
+}
+
+// Nack gives the message up. requeue hands it out again, otherwise a job goes to the
+// dead letter queue and anything else is dropped.
+func (d Delivery) Nack(requeue bool) error {
+	if d.nack == nil {
+		return nil
+	}
+	return d.nack(requeue)
+}
+
+// Publisher sends what the worker reports back. Every message is keyed by the document it
+// is about, Kafka keeps the messages for one document in order on one partition.
+type Publisher interface {
+	// PublishResult sends a job status update to the gateway
+	PublishResult(ctx context.Context, documentID string, body []byte) error
+	// PublishEvent sends a live progress event. Events are fire-and-forget, nobody may be
+	// listening so they aren't kept around.
+	PublishEvent(ctx context.Context, documentID, jobID string, body []byte) error
+	// PublishRetry parks a copy of a job, it comes back to the jobs queue as attempt number
+	// attempt after delay. The original headers go along so the retry stays in the same trace.
+	PublishRetry(ctx context.Context, d Delivery, attempt int, delay time.Duration) error
+}
+
+// Consumer hands out what the gateway sends. The channels close when ctx is done or the
+// broker connection drops.
+type Consumer interface {
+	// ConsumeJobs delivers jobs, each job goes to a single worker. They may be acked in any
+	// order, so several can be worked on at once.
+	ConsumeJobs(ctx context.Context) (<-chan Delivery, error)
+	// ConsumeTombstones delivers purged documents, shared between the workers.
+	// Only call it when there is an index to clean up, otherwise they just pile up.
+	ConsumeTombstones(ctx context.Context) (<-chan Delivery, error)
+	// ConsumeCancellations delivers every cancellation to every worker, from now on.
+	// They don't need acking.
+	ConsumeCancellations(ctx context.Context) (<-chan Delivery, error)
+}
+
+// Broker is a connection to the message bus
+type Broker interface {
+	Publisher
+	Consumer
+	Close()
+}
+
+// New connects to the broker cfg.Backend names, rabbitURL is only used for RabbitMQ
+func New(ctx context.Context, cfg config.Queue, rabbitURL string) (Broker, error) {
+	switch cfg.Backend {
+	case "rabbitmq":
+		return newRabbitMQ(rabbitURL, cfg.Prefetch)
+	case "kafka":
+		return newKafka(ctx, cfg.Kafka)
+	}
+	return nil, fmt.Errorf("unknown queue backend %q", cfg.Backend)
+}
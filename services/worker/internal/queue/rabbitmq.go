@@ -0,0 +1,325 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/worker/internal/tracing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// IngestionQueue is where the gateway publishes new jobs. It replaced ingestion_queue, which
+	// RabbitMQ won't redeclare with a dead letter exchange, the gateway moves what is left there over.
+	IngestionQueue = "ingestion_jobs"
+	// ResultsQueue is where job status updates go back to the gateway
+	ResultsQueue = "ingestion_results"
+	// EventsExchange is a topic exchange for live progress, routed by "job.<job_id>"
+	EventsExchange = "job_events"
+
+	// RetryQueue holds failed jobs until their per-message TTL runs out, then dead-letters them back onto the ingestion queue
+	RetryQueue = "ingestion_retry"
+	// DeadLetterExchange receives jobs rejected from the ingestion queue and routes them to DeadLetterQueue
+	DeadLetterExchange = "ingestion_dlx"
+	// DeadLetterQueue is where jobs end up after their last attempt
+	DeadLetterQueue = "ingestion_dlq"
+
+	// DocumentTombstones is the gateway's fanout exchange announcing purged documents
+	DocumentTombstones = "document_tombstones"
+	// VectorTombstonesQueue is bound to DocumentTombstones so purged documents leave the vector index too
+	VectorTombstonesQueue = "vector_tombstones"
+
+	// JobCancellations is the gateway's fanout exchange announcing cancelled jobs, every worker hears every one
+	JobCancellations = "job_cancellations"
+)
+
+// The queue arguments have to match the gateway's exactly, RabbitMQ refuses to redeclare a queue with different ones.
+var (
+	ingestionQueueArgs = amqp.Table{
+		"x-dead-letter-exchange":    DeadLetterExchange,
+		"x-dead-letter-routing-key": DeadLetterQueue,
+	}
+	retryQueueArgs = amqp.Table{
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": IngestionQueue,
+	}
+)
+
+// rabbitMQ publishes on one channel, every consumer gets a channel of its own on the same connection
+type rabbitMQ struct {
+	conn *amqp.Connection
+	ch   *amqp.Channel
+	// prefetch is how many unacked jobs the consumer holds at once
+	prefetch int
+}
+
+// newRabbitMQ connects to the RabbitMQ at url and declares both the ingestion and results queues
+func newRabbitMQ(url string, prefetch int) (*rabbitMQ, error) {
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to RabbitMQ: %w", err)
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("opening RabbitMQ channel: %w", err)
+	}
+
+	if err := declare(ch); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	log.Println("Successfully connected to RabbitMQ")
+	return &rabbitMQ{conn: conn, ch: ch, prefetch: max(prefetch, 1)}, nil
+}
+
+func declare(ch *amqp.Channel) error {
+	if err := ch.ExchangeDeclare(DeadLetterExchange, "direct", true, false, false, false, nil); err != nil {
+		return fmt.Errorf("declaring RabbitMQ dead letter exchange: %w", err)
+	}
+
+	queues := []struct {
+		name string
+		args amqp.Table
+	}{
+		{IngestionQueue, ingestionQueueArgs},
+		{ResultsQueue, nil},
+		{RetryQueue, retryQueueArgs},
+		{DeadLetterQueue, nil},
+	}
+	for _, q := range queues {
+		_, err := ch.QueueDeclare(
+			q.name, // name
+			true,   // durable
+			false,  // delete when unused
+			false,  // exclusive
+			false,  // no-wait
+			q.args, // arguments
+		)
+		if err != nil {
+			return fmt.Errorf("declaring RabbitMQ queue %s: %w", q.name, err)
+		}
+	}
+
+	if err := ch.QueueBind(DeadLetterQueue, DeadLetterQueue, DeadLetterExchange, false, nil); err != nil {
+		return fmt.Errorf("binding RabbitMQ dead letter queue: %w", err)
+	}
+
+	err := ch.ExchangeDeclare(
+		EventsExchange, // name
+		"topic",        // kind
+		true,           // durable
+		false,          // auto-deleted
+		false,          // internal
+		false,          // no-wait
+		nil,            // arguments
+	)
+	if err != nil {
+		return fmt.Errorf("declaring RabbitMQ events exchange: %w", err)
+	}
+	return nil
+}
+
+// ConsumeJobs starts delivering messages from the ingestion queue with manual acks.
+// A rejected job is dead-lettered into the DLQ by RabbitMQ itself.
+func (r *rabbitMQ) ConsumeJobs(ctx context.Context) (<-chan Delivery, error) {
+	ch, err := r.conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+
+	// Only hand us as many jobs as we can work on, PDFs are heavy and the rest are better off
+	// with another worker
+	if err := ch.Qos(r.prefetch, 0, false); err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("setting RabbitMQ prefetch: %w", err)
+	}
+
+	deliveries, err := ch.Consume(
+		IngestionQueue, // queue
+		"",             // consumer tag, let the server pick
+		false,          // auto-ack, we ack after processing
+		false,          // exclusive
+		false,          // no-local
+		false,          // no-wait
+		nil,            // args
+	)
+	if err != nil {
+		ch.Close()
+		return nil, err
+	}
+	return relay(ctx, ch, deliveries, true), nil
+}
+
+// PublishResult sends a JSON status update to the results queue, carrying the trace in ctx along
+func (r *rabbitMQ) PublishResult(ctx context.Context, documentID string, body []byte) error {
+	headers := map[string]string{}
+	tracing.Inject(ctx, headers)
+
+	return r.ch.PublishWithContext(ctx,
+		"",           // exchange
+		ResultsQueue, // routing key
+		false,        // mandatory
+		false,        // immediate
+		amqp.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			Headers:      amqpHeaders(headers),
+			Body:         body,
+		})
+}
+
+// PublishEvent sends a progress event to the events exchange, unpersisted
+func (r *rabbitMQ) PublishEvent(ctx context.Context, documentID, jobID string, body []byte) error {
+	return r.ch.PublishWithContext(ctx,
+		EventsExchange, // exchange
+		"job."+jobID,   // routing key
+		false,          // mandatory
+		false,          // immediate
+		amqp.Publishing{
+			ContentType: "application/json",
+			Body:        body,
+		})
+}
+
+// PublishRetry parks the job on the retry queue, its per-message TTL sends it back to the ingestion queue
+func (r *rabbitMQ) PublishRetry(ctx context.Context, d Delivery, attempt int, delay time.Duration) error {
+	headers := amqpHeaders(d.Headers)
+	headers[AttemptsHeader] = int32(attempt)
+
+	return r.ch.PublishWithContext(ctx,
+		"",         // exchange
+		RetryQueue, // routing key
+		false,      // mandatory
+		false,      // immediate
+		amqp.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			Headers:      headers,
+			Expiration:   strconv.FormatInt(delay.Milliseconds(), 10),
+			Body:         d.Body,
+		})
+}
+
+// ConsumeTombstones binds the vector index's queue to the tombstone exchange and starts delivering from it with manual acks
+func (r *rabbitMQ) ConsumeTombstones(ctx context.Context) (<-chan Delivery, error) {
+	ch, err := r.conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries, err := func() (<-chan amqp.Delivery, error) {
+		if err := ch.ExchangeDeclare(DocumentTombstones, "fanout", true, false, false, false, nil); err != nil {
+			return nil, err
+		}
+		if _, err := ch.QueueDeclare(VectorTombstonesQueue, true, false, false, false, nil); err != nil {
+			return nil, err
+		}
+		if err := ch.QueueBind(VectorTombstonesQueue, "", DocumentTombstones, false, nil); err != nil {
+			return nil, err
+		}
+		return ch.Consume(VectorTombstonesQueue, "", false, false, false, false, nil)
+	}()
+	if err != nil {
+		ch.Close()
+		return nil, err
+	}
+	log.Printf("Listening for purged documents on '%s'\n", VectorTombstonesQueue)
+	return relay(ctx, ch, deliveries, true), nil
+}
+
+// ConsumeCancellations gives this worker its own throwaway queue on the cancellation exchange.
+// Cancellations are only useful while they are fresh, so the queue goes away with the connection.
+func (r *rabbitMQ) ConsumeCancellations(ctx context.Context) (<-chan Delivery, error) {
+	ch, err := r.conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries, err := func() (<-chan amqp.Delivery, error) {
+		if err := ch.ExchangeDeclare(JobCancellations, "fanout", true, false, false, false, nil); err != nil {
+			return nil, err
+		}
+		q, err := ch.QueueDeclare("", false, true, true, false, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := ch.QueueBind(q.Name, "", JobCancellations, false, nil); err != nil {
+			return nil, err
+		}
+		return ch.Consume(q.Name, "", true, true, false, false, nil)
+	}()
+	if err != nil {
+		ch.Close()
+		return nil, err
+	}
+	return relay(ctx, ch, deliveries, false), nil
+}
+
+// relay turns AMQP deliveries into Deliveries until ctx is done or the channel closes, manual
+// says whether they are to be acked. It owns ch and closes it on the way out, which puts
+// anything unacked back on the queue.
+func relay(ctx context.Context, ch *amqp.Channel, deliveries <-chan amqp.Delivery, manual bool) <-chan Delivery {
+	out := make(chan Delivery)
+	go func() {
+		defer close(out)
+		defer ch.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case d, ok := <-deliveries:
+				if !ok {
+					return
+				}
+				select {
+				case out <- fromAMQP(d, manual):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+func fromAMQP(d amqp.Delivery, manual bool) Delivery {
+	delivery := Delivery{Body: d.Body, Headers: map[string]string{}, Attempts: 1}
+	for k, v := range d.Headers {
+		if s, ok := v.(string); ok {
+			delivery.Headers[k] = s
+		}
+	}
+	switch n := d.Headers[AttemptsHeader].(type) {
+	case int32:
+		delivery.Attempts = int(n)
+	case int64:
+		delivery.Attempts = int(n)
+	}
+	// acking an auto-acked delivery is a channel error, so those get no ack at all
+	if manual {
+		delivery.ack = func() error { return d.Ack(false) }
+		// rejecting without requeue dead-letters a job through the ingestion queue's DLX
+		delivery.nack = func(requeue bool) error { return d.Nack(false, requeue) }
+	}
+	return delivery
+}
+
+func amqpHeaders(headers map[string]string) amqp.Table {
+	table := amqp.Table{}
+	for k, v := range headers {
+		table[k] = v
+	}
+	return table
+}
+
+// Close closes the publishing channel and the connection, consumer channels go with it
+func (r *rabbitMQ) Close() {
+	r.ch.Close()
+	r.conn.Close()
+}
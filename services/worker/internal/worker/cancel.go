@@ -0,0 +1,92 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/worker/internal/models"
+)
+
+// cancelledTTL is how long a cancellation is remembered for a job this worker hasn't seen yet,
+// long enough to cover one still waiting in the queue or on the retry queue
+const cancelledTTL = time.Hour
+
+// errCancelled is the cause a job's context is cancelled with when the user cancels it
+var errCancelled = errors.New("job cancelled")
+
+// cancellations tracks the running jobs' cancel functions and recently cancelled job IDs
+type cancellations struct {
+	mu        sync.Mutex
+	running   map[string]context.CancelCauseFunc
+	cancelled map[string]time.Time
+}
+
+func newCancellations() *cancellations {
+	return &cancellations{running: map[string]context.CancelCauseFunc{}, cancelled: map[string]time.Time{}}
+}
+
+// start registers a job that is about to run, it returns false if the job was already cancelled
+func (c *cancellations) start(jobID string, cancel context.CancelCauseFunc) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.cancelled[jobID]; ok {
+		return false
+	}
+	c.running[jobID] = cancel
+	return true
+}
+
+func (c *cancellations) finish(jobID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.running, jobID)
+}
+
+// cancel stops jobID if it is running here and remembers it in case it shows up later
+func (c *cancellations) cancel(jobID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for id, at := range c.cancelled {
+		if now.Sub(at) > cancelledTTL {
+			delete(c.cancelled, id)
+		}
+	}
+	c.cancelled[jobID] = now
+
+	if cancel, ok := c.running[jobID]; ok {
+		cancel(errCancelled)
+	}
+}
+
+// RunCancellations listens for cancelled jobs until the context is cancelled.
+// Run it in its own goroutine, Run is busy with the jobs.
+func (w *Worker) RunCancellations(ctx context.Context) error {
+	deliveries, err := w.queue.ConsumeCancellations(ctx)
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case d, ok := <-deliveries:
+			if !ok {
+				return errors.New("cancellation channel closed")
+			}
+			var msg models.Cancellation
+			if err := json.Unmarshal(d.Body, &msg); err != nil || msg.JobID == "" {
+				log.Println("Invalid cancellation, dropping:", string(d.Body))
+				continue
+			}
+			log.Printf("[%s] Cancellation received\n", msg.JobID)
+			w.cancels.cancel(msg.JobID)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package worker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/worker/internal/locks"
+	"github.com/dhruvkshah75/docstream/worker/internal/models"
+)
+
+const (
+	// lockTTL is how long a job's claim on its document outlives the worker that took it
+	lockTTL = time.Minute
+	// duplicateWait is how often a duplicate looks whether the job it waits for is done
+	duplicateWait = 5 * time.Second
+	// doneTTL is how long a finished job is remembered for duplicates queued before it finished
+	doneTTL = 24 * time.Hour
+)
+
+// dedupKey names the work a job does: its document, the content it has and the options it is
+// processed with. Two jobs with the same key would write the same chunks and vectors.
+func dedupKey(job models.Job) string {
+	options, _ := json.Marshal(job.Options)
+	sum := sha256.Sum256(options)
+	return "docstream:job:" + job.DocumentID + ":" + job.SHA256 + ":" + hex.EncodeToString(sum[:8])
+}
+
+// runOnce processes job unless another job is already doing the same work. A duplicate waits
+// for that one and takes its result when it completes, a job queued after it completed is
+// processed anew since that's what whoever queued it asked for. The locks failing doesn't
+// stop anything, processing twice beats not processing at all.
+func (w *Worker) runOnce(ctx context.Context, job models.Job) (models.Result, bool) {
+	if w.locks == nil || job.DocumentID == "" {
+		return w.process(ctx, job)
+	}
+	key := dedupKey(job)
+
+	waiting := false
+	for {
+		done, found, err := w.locks.GetDone(ctx, key)
+		if err == nil && found && job.Timestamp <= done.FinishedAt {
+			log.Printf("[%s] Same work was done by %s, taking its result\n", job.JobID, done.JobID)
+			return models.Result{JobID: job.JobID, Status: models.JobStatusCompleted, Language: done.Language, Class: done.Class}, false
+		}
+
+		ok, holder, err := w.locks.Lock(ctx, key, job.JobID, lockTTL)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("[%s] Duplicate check failed, processing anyway: %v\n", job.JobID, err)
+			return w.process(ctx, job)
+		}
+		if ok {
+			return w.processLocked(ctx, job, key)
+		}
+
+		if err == nil && !waiting {
+			log.Printf("[%s] %s is doing the same work, waiting for it\n", job.JobID, holder)
+			waiting = true
+		}
+		select {
+		case <-ctx.Done():
+			// shutting down or cancelled while waiting
+			if isCancelled(ctx) {
+				return w.cancelled(ctx, job, nil), false
+			}
+			return models.Result{JobID: job.JobID, Status: models.JobStatusFailed, Error: ctx.Err().Error()}, true
+		case <-time.After(duplicateWait):
+		}
+	}
+}
+
+// processLocked runs the job while holding key, extending it until the job is done
+func (w *Worker) processLocked(ctx context.Context, job models.Job, key string) (models.Result, bool) {
+	lockCtx := context.WithoutCancel(ctx)
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(lockTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if ok, err := w.locks.Extend(lockCtx, key, job.JobID, lockTTL); err != nil || !ok {
+					log.Printf("[%s] Lost the duplicate lock (%v), another job may start the same work\n", job.JobID, err)
+				}
+			}
+		}
+	}()
+
+	result, retryable := w.process(ctx, job)
+	close(stop)
+
+	if result.Status == models.JobStatusCompleted {
+		done := locks.Done{JobID: job.JobID, Language: result.Language, Class: result.Class, FinishedAt: time.Now().Unix()}
+		if err := w.locks.SetDone(lockCtx, key, done, doneTTL); err != nil {
+			log.Printf("[%s] Failed to record the job for duplicates: %v\n", job.JobID, err)
+		}
+	}
+	if err := w.locks.Unlock(lockCtx, key, job.JobID); err != nil {
+		log.Printf("[%s] Failed to release the duplicate lock: %v\n", job.JobID, err)
+	}
+	return result, retryable
+}
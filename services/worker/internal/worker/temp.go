@@ -0,0 +1,75 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/worker/internal/objectstore"
+)
+
+// how often CleanTemp looks for leftovers
+const cleanTempEvery = time.Hour
+
+// checkSpace makes sure a download of size bytes fits in dir and still leaves minFree
+func checkSpace(dir string, size, minFree int64) error {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	free, err := freeSpace(dir)
+	if err != nil || free < 0 {
+		// nothing to go by, the download fails on its own if the disk fills up
+		return err
+	}
+	if free-size < minFree {
+		return fmt.Errorf("not enough disk space in %s, %d MB free but the download needs %d MB and %d MB are kept free",
+			dir, free>>20, size>>20, minFree>>20)
+	}
+	return nil
+}
+
+// CleanTemp removes the downloads, extracted text and thumbnails a crashed worker left in dir,
+// anything of ours that hasn't changed for maxAge. It looks right away and then every hour
+// until ctx is done.
+func CleanTemp(ctx context.Context, dir string, maxAge time.Duration) {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	ticker := time.NewTicker(cleanTempEvery)
+	defer ticker.Stop()
+	for {
+		cleanTemp(dir, maxAge)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func cleanTemp(dir string, maxAge time.Duration) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Println("Temp Cleanup Error:", err)
+		return
+	}
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), objectstore.TempPrefix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < maxAge {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if err := os.RemoveAll(path); err != nil {
+			log.Println("Temp Cleanup Error:", err)
+			continue
+		}
+		log.Println("Removed leftover temp file", path)
+	}
+}
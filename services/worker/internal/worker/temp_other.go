@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package worker
+
+// freeSpace can't tell here, -1 skips the check
+func freeSpace(dir string) (int64, error) {
+	return -1, nil
+}
@@ -0,0 +1,14 @@
+//go:build linux || darwin
+
+package worker
+
+import "syscall"
+
+// freeSpace is how many bytes in dir's filesystem are left for us to write
+func freeSpace(dir string) (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
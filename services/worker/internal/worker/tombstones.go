@@ -0,0 +1,62 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/worker/internal/models"
+	"github.com/dhruvkshah75/docstream/worker/internal/queue"
+	"github.com/dhruvkshah75/docstream/worker/internal/vectorstore"
+)
+
+// tombstoneRetryDelay keeps a vector store outage from turning into a hot requeue loop
+const tombstoneRetryDelay = 5 * time.Second
+
+// RunTombstones removes purged documents from the vector index until the context is cancelled.
+// It consumes separately from the jobs, so a long job doesn't hold tombstones up.
+func RunTombstones(ctx context.Context, consumer queue.Consumer, store vectorstore.Store) error {
+	deliveries, err := consumer.ConsumeTombstones(ctx)
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case d, ok := <-deliveries:
+			if !ok {
+				return errors.New("tombstone channel closed")
+			}
+			handleTombstone(ctx, d, store)
+		}
+	}
+}
+
+func handleTombstone(ctx context.Context, d queue.Delivery, store vectorstore.Store) {
+	var tomb models.Tombstone
+	if err := json.Unmarshal(d.Body, &tomb); err != nil || tomb.DocumentID == "" {
+		log.Println("Invalid tombstone, dropping:", string(d.Body))
+		d.Ack()
+		return
+	}
+
+	// every collection an embedding migration filled has the document too
+	for _, collection := range append([]string{""}, tomb.Collections...) {
+		if err := store.WithCollection(collection).DeleteDocument(ctx, tomb.DocumentID); err != nil {
+			log.Printf("Failed to remove %s from the vector index: %v\n", tomb.DocumentID, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(tombstoneRetryDelay):
+			}
+			d.Nack(true)
+			return
+		}
+	}
+
+	log.Printf("Removed %s from the vector index\n", tomb.DocumentID)
+	d.Ack()
+}
@@ -0,0 +1,315 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dhruvkshah75/docstream/worker/internal/config"
+	"github.com/dhruvkshah75/docstream/worker/internal/envelope"
+	"github.com/dhruvkshah75/docstream/worker/internal/locks"
+	"github.com/dhruvkshah75/docstream/worker/internal/models"
+	"github.com/dhruvkshah75/docstream/worker/internal/objectstore"
+	"github.com/dhruvkshah75/docstream/worker/internal/pipeline"
+	"github.com/dhruvkshah75/docstream/worker/internal/queue"
+	"github.com/dhruvkshah75/docstream/worker/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+const (
+	retryBaseDelay = 10 * time.Second
+	retryMaxDelay  = 5 * time.Minute
+	// cleanupTimeout bounds undoing a cancelled job's work
+	cleanupTimeout = 30 * time.Second
+)
+
+// Worker glues the queue, object storage and the processing pipeline together
+type Worker struct {
+	queue    queue.Broker
+	objects  objectstore.Store
+	keys     *envelope.Keyring
+	pipeline *pipeline.Pipeline
+	// maxAttempts is how often a job is tried before it goes to the dead letter queue
+	maxAttempts int
+	// concurrency is how many jobs run at once
+	concurrency int
+	// temp is where downloads go
+	temp config.Temp
+	// locks keep two jobs from doing the same work at once, see runOnce
+	locks   locks.Locks
+	cancels *cancellations
+}
+
+func New(broker queue.Broker, objects objectstore.Store, keys *envelope.Keyring, p *pipeline.Pipeline, maxAttempts, concurrency int, temp config.Temp, l locks.Locks) *Worker {
+	return &Worker{queue: broker, objects: objects, keys: keys, pipeline: p, maxAttempts: maxAttempts, concurrency: concurrency, temp: temp, locks: l, cancels: newCancellations()}
+}
+
+// Run consumes jobs until the context is cancelled or the delivery channel closes, with as
+// many jobs running at once as the worker's concurrency. It returns once the running ones are done.
+func (w *Worker) Run(ctx context.Context) error {
+	deliveries, err := w.queue.ConsumeJobs(ctx)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Worker started with %d slots. Waiting for messages...\n", w.concurrency)
+	var wg sync.WaitGroup
+	for range max(w.concurrency, 1) {
+		wg.Go(func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case d, ok := <-deliveries:
+					if !ok {
+						return
+					}
+					w.handle(ctx, d)
+				}
+			}
+		})
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return nil
+	}
+	return errors.New("delivery channel closed")
+}
+
+func (w *Worker) handle(ctx context.Context, d queue.Delivery) {
+	var job models.Job
+	if err := json.Unmarshal(d.Body, &job); err != nil || job.JobID == "" || job.Filename == "" {
+		// a malformed message will never succeed, drop it
+		log.Println("Invalid job payload, dropping:", string(d.Body))
+		d.Ack()
+		return
+	}
+
+	attempt := d.Attempts
+
+	// pick up the trace the gateway started when the file was uploaded
+	ctx, span := tracing.StartConsumer(ctx, d.Headers, "process job",
+		attribute.String("job.id", job.JobID),
+		attribute.String("document.id", job.DocumentID),
+		attribute.Int("job.attempt", attempt))
+	defer span.End()
+
+	// the job gets a context of its own, cancelling it stops this job and nothing else
+	jobCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	if !w.cancels.start(job.JobID, cancel) {
+		log.Printf("[%s] Job was cancelled before it started, dropping\n", job.JobID)
+		w.report(ctx, job, models.Result{JobID: job.JobID, Status: models.JobStatusCancelled})
+		d.Ack()
+		return
+	}
+	defer w.cancels.finish(job.JobID)
+
+	log.Printf("Received Job: %s (%s/%s), attempt %d/%d\n", job.JobID, job.Bucket, job.Filename, attempt, w.maxAttempts)
+	w.report(ctx, job, models.Result{JobID: job.JobID, Status: models.JobStatusProcessing})
+
+	result, retryable := w.runOnce(jobCtx, job)
+	if result.Status == models.JobStatusFailed {
+		span.SetStatus(codes.Error, result.Error)
+	}
+
+	if ctx.Err() != nil {
+		// shutting down mid-job isn't the job's fault, hand it back untouched
+		d.Nack(true)
+		return
+	}
+
+	if result.Status == models.JobStatusCancelled {
+		w.report(ctx, job, result)
+		d.Ack()
+		return
+	}
+
+	if result.Status == models.JobStatusFailed && retryable && attempt < w.maxAttempts {
+		delay := retryDelay(attempt)
+		if err := w.queue.PublishRetry(ctx, d, attempt+1, delay); err != nil {
+			log.Printf("[%s] Failed to schedule retry: %v\n", job.JobID, err)
+			d.Nack(true)
+			return
+		}
+
+		log.Printf("[%s] Attempt %d failed, retrying in %s\n", job.JobID, attempt, delay)
+		result.Status = models.JobStatusQueued
+		result.Error = fmt.Sprintf("attempt %d failed, retrying in %s: %s", attempt, delay, result.Error)
+		w.report(ctx, job, result)
+		d.Ack()
+		return
+	}
+
+	w.report(ctx, job, result)
+
+	// ack only after the result is out, a crash before this point redelivers the job
+	if result.Status == models.JobStatusFailed {
+		// rejecting dead-letters it into the DLQ, where it can be inspected and requeued
+		d.Nack(false)
+		return
+	}
+	d.Ack()
+}
+
+// retryDelay doubles with every attempt, capped at retryMaxDelay
+func retryDelay(attempt int) time.Duration {
+	delay := retryBaseDelay << (attempt - 1)
+	if delay <= 0 || delay > retryMaxDelay {
+		return retryMaxDelay
+	}
+	return delay
+}
+
+// process runs the job and says whether a failure is worth retrying
+func (w *Worker) process(ctx context.Context, job models.Job) (models.Result, bool) {
+	result := models.Result{JobID: job.JobID, Status: models.JobStatusCompleted}
+
+	// 1. DOWNLOAD
+	w.emitStage(ctx, job, "download")
+	path, err := w.download(ctx, job)
+	if err == nil {
+		defer os.Remove(path)
+	}
+	if isCancelled(ctx) {
+		return w.cancelled(ctx, job, nil), false
+	}
+	if err != nil {
+		log.Printf("[%s] MinIO Download Error: %v\n", job.JobID, err)
+		result.Status = models.JobStatusFailed
+		result.Stage = "download"
+		result.Error = err.Error()
+		// the object is there (the gateway wrote it), so this is MinIO being unreachable or the
+		// disk being full, unless it doesn't decrypt or match its checksum, which no retry fixes
+		return result, !errors.Is(err, envelope.ErrCorrupt) && !errors.Is(err, objectstore.ErrChecksum)
+	}
+
+	w.stageDone(ctx, job, "download")
+
+	// 2. PROCESS
+	doc := &pipeline.Document{Job: job, Path: path}
+	defer doc.RemoveText()
+	progress := pipeline.Progress{
+		Started: func(stage string) { w.emitStage(ctx, job, stage) },
+		Done:    func(stage string) { w.stageDone(ctx, job, stage) },
+	}
+	err = w.pipeline.Run(ctx, doc, progress)
+	if isCancelled(ctx) {
+		// even when the last stage got through, the user asked for none of it
+		return w.cancelled(ctx, job, doc), false
+	}
+	if err != nil {
+		log.Printf("[%s] Pipeline Error: %v\n", job.JobID, err)
+		result.Status = models.JobStatusFailed
+		result.Error = err.Error()
+
+		var stageErr *pipeline.StageError
+		if errors.As(err, &stageErr) {
+			result.Stage = stageErr.Stage
+			result.Error = stageErr.Err.Error()
+		}
+		return result, !pipeline.IsPermanent(err)
+	}
+
+	log.Printf("[%s] Job Complete. Extracted %d bytes of text into %s chunks\n", job.JobID, doc.TextSize, doc.Metadata["chunks"])
+	result.Language = doc.Language
+	result.Class = doc.Class
+	result.Entities = doc.Entities
+	result.Summary, result.KeyPoints = doc.Summary, doc.KeyPoints
+	doc.Usage.Pages = max(1, len(doc.Pages))
+	result.Usage = &doc.Usage
+	return result, false
+}
+
+// download streams the job's object into a temp file, decrypting it when the gateway stored it
+// encrypted and checking it against the checksum the gateway took at upload. It waits its turn like the pipeline stages do, STAGE_CONCURRENCY can cap it too,
+// and first makes sure the file fits on the disk.
+func (w *Worker) download(ctx context.Context, job models.Job) (path string, err error) {
+	release, err := w.pipeline.Acquire(ctx, "download")
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	if err := checkSpace(w.temp.Dir, job.FileSize, int64(w.temp.MinFree)); err != nil {
+		return "", err
+	}
+
+	ctx, span := tracing.Start(ctx, "objectstore.Get", attribute.String("object.key", job.Filename))
+	defer func() { tracing.End(span, err) }()
+	obj, err := w.objects.Get(ctx, job.Bucket, job.Filename)
+	if err != nil {
+		return "", err
+	}
+	obj, err = w.keys.Open(ctx, obj, job.EncryptionKey, job.FileSize)
+	if err != nil {
+		return "", err
+	}
+	defer obj.Close()
+	return objectstore.SaveVerified(obj, w.temp.Dir, job.SHA256)
+}
+
+// isCancelled reports whether the job's context was cancelled by the user rather than a shutdown
+func isCancelled(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errCancelled)
+}
+
+// cancelled undoes what the pipeline stages left behind for a cancelled job, doc is nil if nothing ran yet.
+// The temp file is removed by process either way.
+func (w *Worker) cancelled(ctx context.Context, job models.Job, doc *pipeline.Document) models.Result {
+	log.Printf("[%s] Job cancelled, cleaning up\n", job.JobID)
+	if doc != nil {
+		cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+		defer cancel()
+		if err := w.pipeline.Cleanup(cleanupCtx, doc); err != nil {
+			log.Printf("[%s] Cleanup after cancellation failed: %v\n", job.JobID, err)
+		}
+	}
+	return models.Result{JobID: job.JobID, Status: models.JobStatusCancelled}
+}
+
+// report publishes a status update, failures are only logged since the job itself is done
+func (w *Worker) report(ctx context.Context, job models.Job, result models.Result) {
+	w.publishResult(ctx, job, result)
+	w.emit(ctx, job, models.Event{
+		JobID:  job.JobID,
+		UserID: job.UserID,
+		Type:   models.EventTypeStatus,
+		Status: result.Status,
+		Stage:  result.Stage,
+		Error:  result.Error,
+	})
+}
+
+// stageDone tells the gateway a stage got through, clients watching the job already saw it start
+func (w *Worker) stageDone(ctx context.Context, job models.Job, stage string) {
+	w.publishResult(ctx, job, models.Result{JobID: job.JobID, Status: models.JobStatusProcessing, StageDone: stage})
+}
+
+func (w *Worker) publishResult(ctx context.Context, job models.Job, result models.Result) {
+	result.Timestamp = time.Now().Unix()
+	body, _ := json.Marshal(result)
+	if err := w.queue.PublishResult(ctx, job.DocumentID, body); err != nil {
+		log.Printf("[%s] Failed to publish result: %v\n", result.JobID, err)
+	}
+}
+
+func (w *Worker) emitStage(ctx context.Context, job models.Job, stage string) {
+	w.emit(ctx, job, models.Event{JobID: job.JobID, UserID: job.UserID, Type: models.EventTypeStage, Stage: stage})
+}
+
+// emit sends a live progress event, these are best effort
+func (w *Worker) emit(ctx context.Context, job models.Job, event models.Event) {
+	event.Timestamp = time.Now().Unix()
+	body, _ := json.Marshal(event)
+	if err := w.queue.PublishEvent(ctx, job.DocumentID, event.JobID, body); err != nil {
+		log.Printf("[%s] Failed to publish event: %v\n", event.JobID, err)
+	}
+}